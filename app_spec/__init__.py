@@ -4,14 +4,14 @@ Application specification models for Orchestry.
 
 from .models import (
     AppSpec, Metadata, ContainerSpec, ScalingPolicy, HealthCheck,
-    TerminationConfig, EnvVar, ResourceRequirements, Port,
+    TerminationConfig, TracingConfig, AuthConfig, OIDCConfig, EnvVar, ResourceRequirements, Port,
     AppStatus, AppStatusDetail, ScalingEvent, ContainerStatus,
     ScalingMode, validate_app_spec, get_default_spec, get_example_specs
 )
 
 __all__ = [
     'AppSpec', 'Metadata', 'ContainerSpec', 'ScalingPolicy', 'HealthCheck',
-    'TerminationConfig', 'EnvVar', 'ResourceRequirements', 'Port',
+    'TerminationConfig', 'TracingConfig', 'AuthConfig', 'OIDCConfig', 'EnvVar', 'ResourceRequirements', 'Port',
     'AppStatus', 'AppStatusDetail', 'ScalingEvent', 'ContainerStatus',
     'ScalingMode', 'validate_app_spec', 'get_default_spec', 'get_example_specs'
 ]
\ No newline at end of file
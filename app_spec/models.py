@@ -3,7 +3,7 @@ Pydantic dataclasses for Orchestry application specifications.
 Defines the schema for YAML/JSON app registration format.
 """
 
-from typing import Dict, List, Optional, Any, Union
+from typing import Dict, List, Optional, Any, Union, Literal
 from pydantic import BaseModel, Field, validator
 from enum import Enum
 
@@ -22,6 +22,7 @@ class Protocol(str, Enum):
     """Supported protocols."""
     HTTP = "HTTP"
     TCP = "TCP"
+    UDP = "UDP"
 
 class EnvVarSource(str, Enum):
     """Environment variable sources."""
@@ -69,16 +70,41 @@ class Port(BaseModel):
     protocol: Protocol = Field(Protocol.HTTP, description="Port protocol")
     name: Optional[str] = Field(None, description="Port name")
 
+class TmpfsMount(BaseModel):
+    """Size-limited in-memory scratch mount."""
+    path: str = Field(..., description="Absolute mount path inside the container")
+    size: Union[str, int] = Field(..., description="Size limit (e.g. '64Mi' or bytes); counts against the container's memory")
+    mode: Optional[str] = Field(None, description="Octal permissions (e.g. '1777')")
+
 class HealthCheck(BaseModel):
     """Health check configuration."""
+    type: Optional[str] = Field(None, description="http or udp (default: http, udp for UDP apps)", regex=r'^(http|udp)$')
     path: str = Field("/health", description="Health check endpoint path")
     port: Optional[int] = Field(None, description="Health check port (defaults to container port)")
+    send: Optional[str] = Field(None, description="UDP probe payload")
+    expect: Optional[str] = Field(None, description="Text the UDP reply must contain (without it, a port that does not refuse the probe passes)")
     initialDelaySeconds: int = Field(30, description="Delay before first health check")
     periodSeconds: int = Field(10, description="Interval between health checks")
     timeoutSeconds: int = Field(5, description="Health check timeout")
     failureThreshold: int = Field(3, description="Failures before marking unhealthy")
     successThreshold: int = Field(1, description="Successes before marking healthy")
 
+class UdpConfig(BaseModel):
+    """Load balancing settings for UDP apps."""
+    listenPort: Optional[int] = Field(None, ge=1, le=65535, description="nginx UDP port (default: one from ORCHESTRY_UDP_PORT_RANGE)")
+    proxyResponses: Optional[int] = Field(None, ge=0, le=1000, description="Replies expected per datagram (0 for one-way traffic such as syslog)")
+    proxyTimeoutSeconds: Optional[int] = Field(None, ge=1, le=3600, description="Idle time before a client's session ends (default 30)")
+
+class WarmPoolConfig(BaseModel):
+    """Standby containers kept ready for fast scale-out."""
+    size: int = Field(0, ge=0, le=20, description="Number of standby containers")
+    mode: Literal["created", "paused"] = Field("created", description="created (disk only) or paused (booted, holds memory)")
+
+class DecisionWebhookConfig(BaseModel):
+    """External service that approves, vetoes or adjusts scaling decisions."""
+    url: str = Field(..., description="http(s) URL the decision is POSTed to")
+    timeoutSeconds: float = Field(2, gt=0, le=30, description="Local decision is used after this long")
+
 class ScalingPolicy(BaseModel):
     """Autoscaling policy configuration."""
     mode: ScalingMode = Field(ScalingMode.AUTO, description="Scaling mode: auto or manual")
@@ -92,6 +118,12 @@ class ScalingPolicy(BaseModel):
     scaleInThresholdPct: int = Field(30, ge=1, le=100, description="Threshold to scale in")
     windowSeconds: int = Field(60, ge=10, description="Evaluation window in seconds")
     cooldownSeconds: int = Field(300, ge=30, description="Cooldown between scaling events")
+    saturationErrorRatePct: float = Field(5, ge=0, le=100, description="Share of requests failing with 502/504 or failed upstream attempts that triggers an immediate scale-out (0 disables)")
+    saturationScaleFactor: float = Field(1.5, gt=1, le=10, description="Replicas are multiplied by this on saturation")
+    saturationCooldownSeconds: int = Field(20, ge=0, description="Minimum time between saturation scale-outs")
+    evaluationIntervalSeconds: int = Field(10, ge=1, le=3600, description="Seconds between metric collection and scaling evaluation")
+    decisionWebhook: Optional[Union[str, DecisionWebhookConfig]] = Field(None, description="External scaling decision service")
+    warmPool: Optional[Union[int, WarmPoolConfig]] = Field(None, description="Standby containers activated first on scale-out")
     
     @validator('maxReplicas')
     def max_greater_than_min(cls, v, values):
@@ -105,16 +137,73 @@ class ScalingPolicy(BaseModel):
             raise ValueError('scaleOutThresholdPct must be > scaleInThresholdPct')
         return v
 
+class SecurityConfig(BaseModel):
+    """Container security hardening."""
+    readOnlyRootFilesystem: Optional[bool] = Field(None, description="Mount the container's root filesystem read-only")
+    noNewPrivileges: Optional[bool] = Field(None, description="Prevent processes from gaining privileges (setuid etc.)")
+    capDrop: Optional[List[str]] = Field(None, description="Linux capabilities to drop (or ALL)")
+    capAdd: Optional[List[str]] = Field(None, description="Linux capabilities to add")
+    user: Optional[str] = Field(None, description="user[:group] or uid[:gid] to run as")
+    seccompProfile: Optional[str] = Field(None, description="default, unconfined or localhost/<profile>")
+
+class ProtectionConfig(BaseModel):
+    """Changes that need a second approval."""
+    enabled: bool = Field(True, description="Set to false to remove protection")
+    minReplicas: int = Field(1, ge=0, description="Scaling below this many replicas needs approval")
+
 class TerminationConfig(BaseModel):
     """Graceful termination configuration."""
     drainSeconds: int = Field(30, ge=0, le=300, description="Time to drain connections")
     terminationGracePeriodSeconds: int = Field(30, ge=0, le=300, description="SIGTERM timeout")
 
+class TracingConfig(BaseModel):
+    """Request tracing at the proxy."""
+    enabled: bool = Field(False, description="Forward W3C traceparent headers, starting a trace when the client sends none")
+
+class LatencyWeightingConfig(BaseModel):
+    """Replica weights that follow observed upstream latency."""
+    enabled: bool = Field(False, description="Weight replicas by their response times")
+    intervalSeconds: int = Field(30, ge=10, le=3600, description="How often weights are recomputed")
+
+class OutlierDetectionConfig(BaseModel):
+    """Quarantine replicas whose error rate or latency is far worse than their siblings'."""
+    enabled: bool = Field(False, description="Detect and replace outlier replicas")
+    intervalSeconds: int = Field(30, ge=10, le=3600, description="How often replicas are compared")
+    minRequests: int = Field(20, ge=1, description="Requests a replica needs in the interval to be compared")
+    errorRateFactor: float = Field(3, ge=1.5, le=100, description="Error rate multiple of the siblings' median that marks an outlier")
+    latencyFactor: float = Field(3, ge=1.5, le=100, description="Mean latency multiple of the siblings' median that marks an outlier")
+
+class PublicStatusConfig(BaseModel):
+    """Unauthenticated status JSON and badge for the app."""
+    enabled: bool = Field(False, description="Serve /public/apps/<name>/status and badge.svg")
+    label: Optional[str] = Field(None, max_length=40, description="Badge label (default: app name)")
+
+class OIDCConfig(BaseModel):
+    """OIDC login handled by an oauth2-proxy sidecar."""
+    issuerUrl: str = Field(..., description="OIDC issuer URL")
+    clientId: str = Field(..., description="OAuth client ID")
+    clientSecretRef: str = Field(..., description="Secret holding the OAuth client secret")
+    cookieSecretRef: str = Field(..., description="Secret holding the session cookie secret (16, 24 or 32 bytes)")
+    emailDomains: List[str] = Field(default_factory=lambda: ["*"], description="Email domains allowed to log in")
+    redirectUrl: Optional[str] = Field(None, description="OAuth callback URL (https://<host>/oauth2/callback)")
+    cookieSecure: bool = Field(True, description="Only send the session cookie over HTTPS")
+
+class AuthConfig(BaseModel):
+    """Authentication enforced by nginx before traffic reaches the app."""
+    type: str = Field(..., description="basic or oidc", regex=r'^(basic|oidc)$')
+    realm: Optional[str] = Field(None, description="Basic auth realm")
+    secretRef: Optional[str] = Field(None, description="Secret holding htpasswd entries (basic)")
+    oidc: Optional[OIDCConfig] = Field(None, description="OIDC settings (oidc)")
+
 class Metadata(BaseModel):
     """App metadata."""
     name: str = Field(..., description="Application name", regex=r'^[a-zA-Z0-9]([a-zA-Z0-9\-])*[a-zA-Z0-9]$')
     labels: Optional[Dict[str, str]] = Field(default_factory=dict, description="Key-value labels")
     annotations: Optional[Dict[str, str]] = Field(default_factory=dict, description="Key-value annotations")
+    owner: Optional[str] = Field(None, description="Person or service account that owns the app")
+    team: Optional[str] = Field(None, description="Owning team, used to route alerts")
+    contact: Optional[str] = Field(None, description="Contact for the app (email, chat handle or alert webhook URL)")
+    namespace: str = Field("default", description="Namespace whose policies apply to the app")
     
     @validator('name')
     def validate_name(cls, v):
@@ -131,6 +220,21 @@ class ContainerSpec(BaseModel):
     env: Optional[List[EnvVar]] = Field(default_factory=list, description="Environment variables")
     resources: Optional[ResourceRequirements] = Field(default_factory=ResourceRequirements)
     ports: List[Port] = Field(..., description="Container ports")
+    platform: Optional[str] = Field(None, description="Container platform as os/arch[/variant], e.g. linux/arm64 (default: Docker host platform)")
+    dns: Optional[List[str]] = Field(None, description="Custom DNS server addresses")
+    extraHosts: Optional[Union[List[str], Dict[str, str]]] = Field(None, description="Extra /etc/hosts entries as hostname:ip")
+    sysctls: Optional[Dict[str, Union[str, int]]] = Field(None, description="Namespaced kernel parameters (net.*, kernel.shm*, ...)")
+    ulimits: Optional[Dict[str, Union[int, Dict[str, int]]]] = Field(None, description="Resource limits, e.g. nofile: 65536 or nofile: {soft, hard}")
+    shmSize: Optional[Union[str, int]] = Field(None, description="Size of /dev/shm (e.g. '256Mi' or bytes)")
+    tmpfs: Optional[List[TmpfsMount]] = Field(None, description="Size-limited tmpfs scratch mounts")
+    storageSize: Optional[Union[str, int]] = Field(None, description="Limit on the container's writable layer (e.g. '2Gi' or bytes)")
+    hostPort: Optional[int] = Field(None, ge=1, le=65535, description="Publish replica N on this host port + N")
+    publishRange: Optional[str] = Field(None, description="Publish each replica on a free host port from this range (e.g. 30000-30099)")
+    udp: Optional[UdpConfig] = Field(None, description="UDP load balancing settings (type: udp apps)")
+    allowFrom: Optional[List[str]] = Field(default_factory=list, description="CIDRs allowed to reach the app (empty = everyone)")
+    denyFrom: Optional[List[str]] = Field(default_factory=list, description="CIDRs blocked from reaching the app")
+    security: Optional[SecurityConfig] = Field(None, description="Container security hardening")
+    protection: Optional[ProtectionConfig] = Field(None, description="Require a second approval for down, delete, image updates and scaling below minReplicas")
     
     @validator('image')
     def validate_image(cls, v):
@@ -138,6 +242,14 @@ class ContainerSpec(BaseModel):
             raise ValueError('Image must include a tag (e.g., myapp:latest)')
         return v
         
+    @validator('platform')
+    def validate_platform(cls, v):
+        if v is not None:
+            parts = v.split('/')
+            if len(parts) not in (2, 3) or not all(parts):
+                raise ValueError('platform must look like os/arch or os/arch/variant (e.g. linux/arm64)')
+        return v
+
     @validator('ports')
     def validate_ports(cls, v):
         if not v:
@@ -161,6 +273,11 @@ class AppSpec(BaseModel):
     healthCheck: Optional[HealthCheck] = Field(default_factory=HealthCheck, description="Health check config")
     termination: Optional[TerminationConfig] = Field(default_factory=TerminationConfig, description="Termination config")
     restartPolicy: RestartPolicy = Field(RestartPolicy.ALWAYS, description="Restart policy")
+    tracing: Optional[TracingConfig] = Field(default_factory=TracingConfig, description="Request tracing config")
+    auth: Optional[AuthConfig] = Field(None, description="Edge authentication config")
+    publicStatus: Optional[PublicStatusConfig] = Field(None, description="Public status badge config")
+    latencyWeighting: Optional[LatencyWeightingConfig] = Field(None, description="Latency-weighted routing config")
+    outlierDetection: Optional[OutlierDetectionConfig] = Field(None, description="Outlier replica quarantine config")
     
     @validator('apiVersion')
     def validate_api_version(cls, v):
@@ -1,5 +1,8 @@
 import os
+import json
+import getpass
 import yaml
+from datetime import datetime
 from platformdirs import user_config_dir
 import typer
 import requests
@@ -7,20 +10,177 @@ import requests
 CONFIG_DIR = user_config_dir("orchestry", "orchestry")
 CONFIG_FILE = os.path.join(CONFIG_DIR, "config.yaml")
 
-def save_config(host, port):
+def _read_config():
+    if os.path.exists(CONFIG_FILE):
+        with open(CONFIG_FILE) as f:
+            return yaml.safe_load(f) or {}
+    return {}
+
+def _write_config(data):
     os.makedirs(CONFIG_DIR, exist_ok=True)
-    data = {"host": host, "port": port}
     with open(CONFIG_FILE, "w") as f:
         yaml.dump(data, f)
 
-def load_config():
-    if os.path.exists(CONFIG_FILE):
-        with open(CONFIG_FILE) as f:
-            data = yaml.safe_load(f)
-            if data and "host" in data and "port" in data:
-                return f"http://{data['host']}:{data['port']}"
+def save_config(host, port):
+    data = _read_config()
+    data.update(host=host, port=port)
+    _write_config(data)
+
+def load_config(cluster=None):
+    """URL of the configured controller, or of a named cluster (see `orchestry clusters`)."""
+    if cluster:
+        return load_clusters().get(cluster)
+    data = _read_config()
+    if "host" in data and "port" in data:
+        return f"http://{data['host']}:{data['port']}"
     return None
 
+def load_clusters():
+    """Named clusters the CLI can target, as {name: url}. The controller set up with
+    `orchestry config` is included as "default"."""
+    data = _read_config()
+    clusters = {}
+    if "host" in data and "port" in data:
+        clusters["default"] = f"http://{data['host']}:{data['port']}"
+    clusters.update(data.get("clusters") or {})
+    return clusters
+
+def save_cluster(name, url):
+    data = _read_config()
+    data.setdefault("clusters", {})[name] = url.rstrip("/")
+    _write_config(data)
+
+def remove_cluster(name):
+    """Forget a named cluster. Returns False if it was not configured."""
+    data = _read_config()
+    if name not in (data.get("clusters") or {}):
+        return False
+    del data["clusters"][name]
+    _write_config(data)
+    return True
+
+# Exit codes of every command, so scripts and CI can branch on the outcome
+EXIT_OK = 0
+EXIT_ERROR = 1
+EXIT_NOT_FOUND = 2
+EXIT_NOT_LEADER = 3
+EXIT_VALIDATION = 4
+EXIT_TIMEOUT = 5
+
+# API error codes (see controller/errors.py) that have an exit code of their own
+ERROR_EXIT_CODES = {
+    "APP_NOT_FOUND": EXIT_NOT_FOUND,
+    "NOT_FOUND": EXIT_NOT_FOUND,
+    "NOT_LEADER": EXIT_NOT_LEADER,
+    "VALIDATION_FAILED": EXIT_VALIDATION,
+}
+
+# Set by --quiet: only results and errors are printed
+QUIET = False
+
+def say(message="", err=False):
+    """Print decorative output (progress, confirmations, headings) unless --quiet is set."""
+    if not QUIET:
+        typer.echo(message, err=err)
+
+# Set by -o/--output and --columns: how commands print their results
+OUTPUT = None
+COLUMNS = None
+OUTPUT_FORMATS = ("json", "yaml", "table")
+# Table cells longer than this are cut off
+MAX_CELL_WIDTH = 60
+TIMESTAMP_FIELDS = ("timestamp", "created_at", "updated_at", "last_scaled_at", "state_since", "next_evaluation_at",
+                    "lastTransitionTime")
+
+def _lookup(record, path):
+    """The value at a dotted path of a record, e.g. spec.image, or None."""
+    for part in path.split("."):
+        if not isinstance(record, dict):
+            return None
+        record = record.get(part)
+    return record
+
+def _flatten(data, prefix=""):
+    """Nested mappings as dotted keys, for a table of one record's fields."""
+    fields = {}
+    for key, value in data.items():
+        if isinstance(value, dict) and value:
+            fields.update(_flatten(value, f"{prefix}{key}."))
+        else:
+            fields[f"{prefix}{key}"] = value
+    return fields
+
+def _cell(column, value):
+    if value is None:
+        return "-"
+    if column.rpartition(".")[2] in TIMESTAMP_FIELDS and isinstance(value, (int, float)) and not isinstance(value, bool):
+        return datetime.fromtimestamp(value).strftime("%Y-%m-%d %H:%M:%S")
+    if isinstance(value, bool):
+        return "true" if value else "false"
+    if isinstance(value, float):
+        text = f"{value:.2f}"
+    elif isinstance(value, (dict, list, tuple)):
+        text = json.dumps(value, separators=(",", ":"), default=str)
+    else:
+        text = str(value)
+    text = text.replace("\n", " ")
+    return text if len(text) <= MAX_CELL_WIDTH else text[:MAX_CELL_WIDTH - 3] + "..."
+
+def table(rows, columns):
+    """rows as an aligned text table of the given (dotted) columns."""
+    cells = [[_cell(column, _lookup(row, column)) for column in columns] for row in rows]
+    headers = [column.upper() for column in columns]
+    widths = [max([len(header)] + [len(line[index]) for line in cells]) for index, header in enumerate(headers)]
+    return "\n".join(
+        "  ".join(value.ljust(width) for value, width in zip(line, widths)).rstrip()
+        for line in [headers] + cells
+    )
+
+def emit(data, rows=None, columns=None, default="json", title=None):
+    """Print a command's result in the format -o/--output asks for, or default. A table shows
+    rows (records of data) with columns, which --columns replaces; without rows it lists the
+    fields of data. title is printed above a table."""
+    output = OUTPUT or default
+    if output == "json":
+        typer.echo(json.dumps(data, indent=2, default=str))
+    elif output == "yaml":
+        typer.echo(yaml.safe_dump(data, default_flow_style=False, sort_keys=False), nl=False)
+    else:
+        if title:
+            say(title)
+        if rows is None:
+            fields = _flatten(data) if isinstance(data, dict) else {}
+            rows = [{"field": key, "value": _cell(key, value)} for key, value in fields.items()]
+            columns = ["field", "value"]
+        columns = COLUMNS or columns or sorted({key for row in rows for key in row})
+        if not rows:
+            say(" Nothing to show")
+            return
+        typer.echo(table(rows, columns))
+
+def exit_code_for(response=None, error=None):
+    """The exit code for a failed API reply or a request exception."""
+    if isinstance(error, requests.exceptions.Timeout):
+        return EXIT_TIMEOUT
+    if response is None:
+        return EXIT_ERROR
+    code = error_code(response)
+    if code in ERROR_EXIT_CODES:
+        return ERROR_EXIT_CODES[code]
+    # Controllers that predate error codes
+    if response.status_code == 404:
+        return EXIT_NOT_FOUND
+    if response.status_code in (400, 422):
+        return EXIT_VALIDATION
+    if response.status_code in (408, 504):
+        return EXIT_TIMEOUT
+    return EXIT_ERROR
+
+def fail(message, response=None, error=None, code=None):
+    """Print message on stderr and exit with code, or the exit code for response or error."""
+    typer.echo(message, err=True)
+    raise typer.Exit(code if code is not None else exit_code_for(response, error))
+
 def check_service_running(API_URL):
     """Check if orchestry controller is running and provide helpful error messages."""
     try:
@@ -30,6 +190,7 @@ def check_service_running(API_URL):
             raise typer.Exit(1)
         response = requests.get(f"{API_URL}/health", timeout=5)
         if response.status_code == 200:
+            warn_if_frozen(response.json())
             return True
     except requests.exceptions.ConnectionError:
         typer.echo(" orchestry controller is not running.", err=True)
@@ -45,8 +206,148 @@ def check_service_running(API_URL):
     except requests.exceptions.Timeout:
         typer.echo(" orchestry controller is not responding (timeout).", err=True)
         typer.echo(" Check if the service is healthy: docker-compose ps", err=True)
-        raise typer.Exit(1)
+        raise typer.Exit(EXIT_TIMEOUT)
+    except typer.Exit:
+        raise
     except Exception as e:
         typer.echo(f" Error connecting to orchestry: {e}", err=True)
         raise typer.Exit(1)
     return False
+
+def warn_if_frozen(health):
+    """Print a banner when the controller is frozen for maintenance."""
+    freeze = health.get("freeze") or {}
+    if freeze.get("frozen"):
+        typer.echo(f" WARNING: orchestry is FROZEN for maintenance ({freeze.get('reason')}). "
+                   "Autoscaling and automatic restarts are paused and changes are rejected.", err=True)
+
+def user_headers(override=None):
+    """Identify the caller on write requests. Approvers (ORCHESTRY_APPROVER_TOKEN) are identified by
+    their token; everyone else by their local user name. override is the audit reason for making
+    the change inside a deployment freeze window."""
+    headers = {"X-Orchestry-User": getpass.getuser()}
+    if os.getenv("ORCHESTRY_APPROVER_TOKEN"):
+        headers["X-Approver-Token"] = os.getenv("ORCHESTRY_APPROVER_TOKEN")
+    if override:
+        headers["X-Override-Reason"] = override
+    return headers
+
+def report_pending_approval(response):
+    """Explain a 202 reply for a protected app. Returns True if the change is waiting for approval."""
+    if response.status_code != 202:
+        return False
+    data = response.json()
+    operation = data.get("operation") or {}
+    typer.echo(f" {data.get('app')} is protected: {operation.get('reason')} needs a second approval.")
+    typer.echo(f" Pending operation {operation.get('id')} - another approver can run "
+               f"'orchestry operations approve {operation.get('id')}'")
+    return True
+
+# Extra advice for API error codes, shown after the controller's message
+ERROR_HINTS = {
+    "NOT_LEADER": "the controller you reached is not the leader; retry, or check 'orchestry cluster leader'",
+    "DOCKER_UNAVAILABLE": "the controller cannot reach Docker; check that the Docker daemon is running on its host",
+    "FROZEN": "pass --override with a reason if the change cannot wait",
+}
+
+def format_error(response):
+    """One readable line for an API error reply: the message, its error code and advice
+    for the codes that have some. Replies without the error envelope fall back to their text."""
+    try:
+        data = response.json()
+    except ValueError:
+        return response.text or f"HTTP {response.status_code}"
+    error = data.get("error") if isinstance(data, dict) else None
+    if not isinstance(error, dict):
+        detail = data.get("detail", data) if isinstance(data, dict) else data
+        return str(detail)
+    message = f"{error.get('message')} [{error.get('code')}]"
+    if error.get("code") == "QUOTA_EXCEEDED" and response.headers.get("Retry-After"):
+        message += f" - retry in {response.headers['Retry-After']}s"
+    elif error.get("code") in ERROR_HINTS:
+        message += f" - {ERROR_HINTS[error['code']]}"
+    return message
+
+def error_code(response):
+    """The machine-readable code of an API error reply, or None."""
+    try:
+        error = response.json().get("error")
+    except (ValueError, AttributeError):
+        return None
+    return error.get("code") if isinstance(error, dict) else None
+
+# API version this CLI speaks. Controllers that predate API versions are called without a prefix.
+API_VERSION = "v1"
+# Used when the CLI runs from a source checkout rather than an installed package
+FALLBACK_CLI_VERSION = "1.0.1"
+_api_urls = {}
+
+def cli_version():
+    """Version of this CLI."""
+    try:
+        from importlib.metadata import version
+        return version("orchestry")
+    except Exception:
+        return FALLBACK_CLI_VERSION
+
+def parse_version(value):
+    """A version string such as "1.2.0" or "v1.2" as a comparable tuple, or None."""
+    parts = str(value or "").strip().lstrip("v").split(".")
+    if not parts or not all(part.isdigit() for part in parts):
+        return None
+    return tuple(int(part) for part in parts) + (0,) * (3 - len(parts))
+
+def version_drift(versions):
+    """Describe how this CLI drifts from a controller's GET /versions, or None if it doesn't."""
+    served = versions.get("versions") or []
+    if served and API_VERSION not in served:
+        return (f"this CLI speaks API {API_VERSION} but the controller serves {', '.join(served)}, "
+                f"run 'orchestry self-update'")
+    cli = versions.get("cli") or {}
+    current = parse_version(cli_version())
+    if current and parse_version(cli.get("minimum")) and current < parse_version(cli.get("minimum")):
+        return (f"CLI {cli_version()} is older than {cli['minimum']}, the oldest version the controller "
+                f"supports, run 'orchestry self-update'")
+    return None
+
+def get_versions(API_URL):
+    """The controller's GET /versions, or None if it cannot be fetched."""
+    try:
+        response = requests.get(f"{API_URL.rstrip('/')}/versions", timeout=5)
+    except requests.exceptions.RequestException:
+        return None
+    return response.json() if response.status_code == 200 else None
+
+def api_url(API_URL):
+    """API_URL with the version prefix, if the controller serves that version (GET /versions).
+    Warns once if this CLI has drifted from what the controller supports."""
+    if API_URL not in _api_urls:
+        base = API_URL.rstrip("/")
+        try:
+            response = requests.get(f"{base}/versions", timeout=5)
+        except requests.exceptions.RequestException:
+            return base
+        versions = response.json() if response.status_code == 200 else {}
+        _api_urls[API_URL] = f"{base}/{API_VERSION}" if API_VERSION in versions.get("versions", []) else base
+        drift = version_drift(versions)
+        if drift:
+            typer.echo(f" Warning: {drift}", err=True)
+    return _api_urls[API_URL]
+
+def write_api_url(API_URL):
+    """The leader's write endpoint with the version prefix."""
+    return api_url(resolve_write_url(API_URL))
+
+def resolve_write_url(API_URL):
+    """Return the write endpoint advertised by the cluster leader, falling back to API_URL."""
+    try:
+        response = requests.get(f"{API_URL}/health", timeout=5)
+        leader = response.json().get("leader") if response.status_code == 200 else None
+        advertise_url = leader.get("advertise_url") if leader else None
+        if advertise_url and advertise_url.rstrip("/") != API_URL.rstrip("/"):
+            probe = requests.get(f"{advertise_url}/health", timeout=3)
+            if probe.status_code == 200:
+                return advertise_url.rstrip("/")
+    except Exception:
+        pass
+    return API_URL
@@ -2,11 +2,16 @@ import typer
 import requests
 from dotenv import load_dotenv
 import os
+import re
+import sys
+import hashlib
 import json
+import time
 import yaml
-from typing import Optional
+from typing import List, Optional
 
 import cli.helpers as helpers
+from cli.verify import SmokeTest, DEFAULT_ECHO_IMAGE
 
 load_dotenv()
 
@@ -14,6 +19,30 @@ app = typer.Typer(name="orchestry", help="Orchestry SDK CLI")
 
 ORCHESTRY_URL = helpers.load_config()
 
+@app.callback()
+def main(cluster: Optional[str] = typer.Option(None, "--cluster", "-c", envvar="ORCHESTRY_CLUSTER",
+                                                help="Named cluster to target (see 'orchestry clusters')"),
+         quiet: bool = typer.Option(False, "--quiet", "-q", envvar="ORCHESTRY_QUIET",
+                                    help="Only print results and errors, no progress or confirmations"),
+         output: Optional[str] = typer.Option(None, "--output", "-o", envvar="ORCHESTRY_OUTPUT",
+                                              help="Print results as json, yaml or table (default: each command's own)"),
+         columns: Optional[str] = typer.Option(None, "--columns", envvar="ORCHESTRY_COLUMNS",
+                                               help="Comma-separated (dotted) fields shown by -o table, e.g. name,status,spec.image")):
+    """Orchestry SDK CLI. Exit codes: 0 success, 1 error, 2 not found, 3 not leader,
+    4 validation error, 5 timeout."""
+    global ORCHESTRY_URL
+    helpers.QUIET = quiet
+    if output and output not in helpers.OUTPUT_FORMATS:
+        helpers.fail(f" Unknown output format '{output}', use {', '.join(helpers.OUTPUT_FORMATS)}",
+                     code=helpers.EXIT_VALIDATION)
+    helpers.OUTPUT = output
+    helpers.COLUMNS = [column.strip() for column in columns.split(",") if column.strip()] if columns else None
+    if cluster:
+        ORCHESTRY_URL = helpers.load_config(cluster)
+        if not ORCHESTRY_URL:
+            helpers.fail(f" Unknown cluster '{cluster}', add it with 'orchestry clusters add {cluster} URL'",
+                         code=helpers.EXIT_NOT_FOUND)
+
 @app.command()
 def config():
     """Configure orchestry by adding ORCHESTRY_HOST and orchestry_PORT"""
@@ -21,104 +50,379 @@ def config():
     ORCHESTRY_HOST = typer.prompt("Host (e.g., localhost or an IP address)")
     ORCHESTRY_PORT = typer.prompt("Port (e.g., 8000)")
 
-    typer.echo(f"Connecting to orchestry at http://{ORCHESTRY_HOST}:{ORCHESTRY_PORT}...")
+    helpers.say(f"Connecting to orchestry at http://{ORCHESTRY_HOST}:{ORCHESTRY_PORT}...")
     if helpers.check_service_running(f"http://{ORCHESTRY_HOST}:{ORCHESTRY_PORT}") == True:
         helpers.save_config(ORCHESTRY_HOST, ORCHESTRY_PORT)
-        typer.echo(f"Configuration saved to {helpers.CONFIG_FILE}")
+        helpers.say(f"Configuration saved to {helpers.CONFIG_FILE}")
     else:
         typer.echo("Failed to connect to the specified host and port. Please ensure the orchestry controller is running.", err=True)
         raise typer.Exit(1)
 
 @app.command()
-def register(config: str):
-    """Register an app from YAML/JSON spec."""
+def register(
+    config: str = typer.Argument(..., help="Spec file, directory of specs, '-' for stdin, or an http(s) URL"),
+    sha256: Optional[str] = typer.Option(None, "--sha256", help="Refuse the spec unless its SHA-256 checksum is this (hex)"),
+    override: Optional[str] = typer.Option(None, "--override", help="Audit reason for making this change during a deployment freeze window"),
+    env_file: Optional[List[str]] = typer.Option(None, "--env-file", help=".env file merged into the spec's env, overriding it (repeatable, later files win)")
+):
+    """Register an app from YAML/JSON spec, or every YAML/JSON spec in a directory."""
     if helpers.check_service_running(ORCHESTRY_URL) == False:
         typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
         raise typer.Exit(1)
-    if not os.path.exists(config):
-        typer.echo(f" Config file '{config}' not found", err=True)
-        raise typer.Exit(1)
+    remote = config == "-" or config.startswith(("http://", "https://"))
+    if not remote and not os.path.exists(config):
+        helpers.fail(f" Config file '{config}' not found", code=helpers.EXIT_NOT_FOUND)
+    if not remote and os.path.isdir(config):
+        _register_directory(config, override, env_file)
+        return
 
     try:
-        with open(config) as f:
-            if config.endswith(('.yml', '.yaml')):
-                spec = yaml.safe_load(f)
-            else:
-                spec = json.load(f)
+        spec, source = _read_spec_source(config, sha256)
+        # envFile paths are relative to the spec file, or to the working directory for stdin
+        if config == "-":
+            base_dir = os.getcwd()
+        else:
+            base_dir = None if remote else os.path.dirname(os.path.abspath(config))
+        _merge_env_files(spec, base_dir, env_file)
+        if spec.get("placement"):
+            _register_federated(spec, override)
+            return
 
         response = requests.post(
-            f"{ORCHESTRY_URL}/apps/register",
-            json=spec,
-            headers={"Content-Type": "application/json"}
+            f"{helpers.write_api_url(ORCHESTRY_URL)}/apps/register",
+            json=spec, params=source,
+            headers={"Content-Type": "application/json", **helpers.user_headers(override)}
         )
 
+        if helpers.report_pending_approval(response):
+            return
         if response.status_code == 200:
             result = response.json()
-            typer.echo(" App registered successfully!")
-            typer.echo(json.dumps(result, indent=2))
+            helpers.say(" App registered successfully!")
+            helpers.emit(result)
+            for warning in result.get("warnings") or []:
+                typer.echo(f" Warning: {warning}", err=True)
         else:
-            typer.echo(f" Registration failed: {response.json()}")
-            raise typer.Exit(1)
+            helpers.fail(f" Registration failed: {helpers.format_error(response)}", response)
 
+    except typer.Exit:
+        raise
+    except (ValueError, yaml.YAMLError) as e:
+        # An unreadable spec or a checksum mismatch
+        helpers.fail(f" Error: {e}", code=helpers.EXIT_VALIDATION)
     except Exception as e:
-        typer.echo(f" Error: {e}", err=True)
+        helpers.fail(f" Error: {e}", error=e)
+
+def _register_federated(spec: dict, override: Optional[str] = None):
+    """Register a spec with placement on every cluster it names, through the controller's federation."""
+    response = requests.post(
+        f"{helpers.resolve_write_url(ORCHESTRY_URL)}/federation/apps/register",
+        json=spec,
+        headers={"Content-Type": "application/json", **helpers.user_headers(override)}
+    )
+    if response.status_code != 200:
+        helpers.fail(f" Registration failed: {helpers.format_error(response)}", response)
+    result = response.json()
+    for item in result["results"]:
+        if item["status"] == "registered":
+            typer.echo(f" {item['cluster']:<16} registered (revision {item.get('revision')})")
+        elif item["status"] == "pending_approval":
+            typer.echo(f" {item['cluster']:<16} waiting for approval (operation {item.get('operation')})")
+        else:
+            typer.echo(f" {item['cluster']:<16} failed: {item.get('error')}", err=True)
+    if result["failed"]:
+        raise typer.Exit(1)
+
+def _load_spec(path: str) -> dict:
+    with open(path) as f:
+        if path.endswith(('.yml', '.yaml')):
+            return yaml.safe_load(f)
+        return json.load(f)
+
+SPEC_FETCH_TIMEOUT_SECONDS = 30
+
+def _read_spec_source(config: str, sha256: Optional[str] = None) -> tuple:
+    """Read a spec from a file, stdin ('-') or an http(s) URL, checking its SHA-256 if one is
+    given. Returns (spec, source query params recorded with the revision)."""
+    if config == "-":
+        raw, source_type = sys.stdin.buffer.read(), "stdin"
+    elif config.startswith(("http://", "https://")):
+        response = requests.get(config, timeout=SPEC_FETCH_TIMEOUT_SECONDS)
+        if response.status_code != 200:
+            raise ValueError(f"fetching {config} returned HTTP {response.status_code}")
+        raw, source_type = response.content, "url"
+    else:
+        with open(config, "rb") as f:
+            raw, source_type = f.read(), "file"
+
+    digest = hashlib.sha256(raw).hexdigest()
+    if sha256 and sha256.strip().lower() != digest:
+        raise ValueError(f"checksum mismatch: the spec's SHA-256 is {digest}, expected {sha256}")
+    text = raw.decode("utf-8")
+    # YAML is a superset of JSON, but file specs keep the parser their extension asks for
+    spec = json.loads(text) if source_type == "file" and not config.endswith(('.yml', '.yaml')) else yaml.safe_load(text)
+    if not isinstance(spec, dict):
+        raise ValueError(f"{'stdin' if config == '-' else config} does not contain a spec")
+    location = None if source_type == "stdin" else (config if source_type == "url" else os.path.basename(config))
+    return spec, {"source_type": source_type, "source": location, "source_sha256": digest}
+
+ENV_NAME = re.compile(r"^[A-Za-z_][A-Za-z0-9_]*$")
+
+def _read_env_file(path: str) -> dict:
+    """KEY=VALUE lines of a .env file. Blank lines, # comments and a leading `export` are
+    ignored; values may be quoted, and double-quoted values may use \\n, \\" and \\\\."""
+    variables = {}
+    with open(path) as f:
+        for number, line in enumerate(f, 1):
+            line = line.strip()
+            if not line or line.startswith("#"):
+                continue
+            if line.startswith("export "):
+                line = line[len("export "):].lstrip()
+            name, sep, value = line.partition("=")
+            name, value = name.strip(), value.strip()
+            if not sep or not ENV_NAME.match(name):
+                raise ValueError(f"{path}:{number}: expected NAME=VALUE")
+            if value[:1] in ('"', "'"):
+                quote = value[0]
+                end = value.find(quote, 1)
+                while quote == '"' and end > 0 and value[end - 1] == "\\":
+                    end = value.find(quote, end + 1)
+                if end < 0 or value[end + 1:].strip()[:1] not in ("", "#"):
+                    raise ValueError(f"{path}:{number}: unterminated or malformed quoted value")
+                value = value[1:end]
+                if quote == '"':
+                    value = re.sub(r"\\(.)", lambda match: "\n" if match.group(1) == "n" else match.group(1), value)
+            else:
+                value = value.split(" #", 1)[0].rstrip()
+            variables[name] = value
+    return variables
+
+def _merge_env_files(spec: dict, base_dir: Optional[str], env_files: Optional[List[str]] = None):
+    """Merge the .env files a spec's `envFile` names (relative to base_dir), then its `env`, then
+    env_files into spec.env, each overriding variables of the ones before it."""
+    app_spec = spec.get("spec")
+    if not isinstance(app_spec, dict):
+        return
+    named = app_spec.pop("envFile", None)
+    if named is None and not env_files:
+        return
+    if isinstance(named, str):
+        named = [named]
+    # `list` is the name of a command in this module
+    if named is not None and (not isinstance(named, (tuple, type([]))) or not all(isinstance(path, str) for path in named)):
+        raise ValueError("spec.envFile must be a path or a list of paths")
+    if named and base_dir is None:
+        raise ValueError("spec.envFile cannot be resolved for a spec fetched from a URL; use --env-file")
+    merged = {}
+    for path in named or []:
+        for name, value in _read_env_file(os.path.join(base_dir, path)).items():
+            merged[name] = {"name": name, "value": value}
+    for entry in app_spec.get("env") or []:
+        merged[entry.get("name")] = entry
+    for path in env_files or []:
+        for name, value in _read_env_file(path).items():
+            merged[name] = {"name": name, "value": value}
+    app_spec["env"] = [*merged.values()]
+
+REGISTER_BATCH_SIZE = 200
+
+def _register_directory(directory: str, override: Optional[str] = None, env_files: Optional[List[str]] = None):
+    """Submit every spec in a directory through the batch registration API."""
+    files = sorted(
+        os.path.join(directory, name) for name in os.listdir(directory)
+        if name.endswith(('.yml', '.yaml', '.json')) and os.path.isfile(os.path.join(directory, name))
+    )
+    if not files:
+        typer.echo(f" No YAML or JSON specs found in '{directory}'", err=True)
+        raise typer.Exit(1)
+
+    specs, sources = [], []
+    for path in files:
+        try:
+            spec = _load_spec(path)
+            _merge_env_files(spec, directory, env_files)
+        except Exception as e:
+            helpers.fail(f" Error: could not read {path}: {e}", code=helpers.EXIT_VALIDATION)
+        specs.append(spec)
+        sources.append(path)
+
+    helpers.say(f" Registering {len(specs)} app(s) from {directory}")
+    failed = 0
+    try:
+        for start in range(0, len(specs), REGISTER_BATCH_SIZE):
+            batch = specs[start:start + REGISTER_BATCH_SIZE]
+            response = requests.post(
+                f"{helpers.resolve_write_url(ORCHESTRY_URL)}/apps/registerBatch",
+                json={"apps": batch},
+                headers={"Content-Type": "application/json", **helpers.user_headers(override)}
+            )
+            if response.status_code != 200:
+                helpers.fail(f" Registration failed: {helpers.format_error(response)}", response)
+
+            for source, item in zip(sources[start:start + REGISTER_BATCH_SIZE], response.json()["results"]):
+                if item["status"] == "failed":
+                    failed += 1
+                    typer.echo(f" {item['app'] or source}: failed - {item['error']}")
+                elif item["status"] == "pending_approval":
+                    typer.echo(f" {item['app']}: waiting for approval (operation {item['operation']})")
+                else:
+                    typer.echo(f" {item['app']}: registered")
+                for warning in item.get("warnings") or []:
+                    typer.echo(f" {item['app']}: warning - {warning}", err=True)
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+
+    typer.echo(f" {len(specs) - failed} registered, {failed} failed")
+    if failed:
         raise typer.Exit(1)
 
+def _lock_mode(fail_if_busy: bool) -> str:
+    return "fail" if fail_if_busy else "queue"
+
 @app.command()
-def up(name: str):
+def up(
+    name: str,
+    fail_if_busy: bool = typer.Option(False, "--fail-if-busy", help="Fail right away if another operation on the app is in progress instead of waiting for it")
+):
     """Start the app."""
     if helpers.check_service_running(ORCHESTRY_URL) == False:
         typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
         raise typer.Exit(1)
 
-    response = requests.post(f"{ORCHESTRY_URL}/apps/{name}/up")
+    response = requests.post(f"{helpers.write_api_url(ORCHESTRY_URL)}/apps/{name}/up",
+                             params={"lock": _lock_mode(fail_if_busy)}, headers=helpers.user_headers())
+    if response.status_code != 200:
+        helpers.fail(f" Error: {helpers.format_error(response)}", response)
+    res = response.json()
+    helpers.emit(res)
+
+@app.command()
+def prepull(name: str, reason: str = typer.Option("manual", "--reason", help="Why the pull is requested, e.g. a forecast")):
+    """Pull the app's image on every controller node ahead of a scale-out."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+    response = requests.post(f"{helpers.resolve_write_url(ORCHESTRY_URL)}/apps/{name}/prepull",
+                             params={"reason": reason}, headers=helpers.user_headers())
+    if response.status_code != 200:
+        helpers.fail(f" Error: {helpers.format_error(response)}", response)
     res = response.json()
-    typer.echo(json.dumps(res, indent=2))
+    helpers.emit(res)
 
 @app.command()
-def down(name: str):
+def down(
+    name: str,
+    grace_period: Optional[int] = typer.Option(None, "--grace-period", help="Seconds replicas get to exit after SIGTERM before SIGKILL (default: the app's terminationGracePeriodSeconds)"),
+    fail_if_busy: bool = typer.Option(False, "--fail-if-busy", help="Fail right away if another operation on the app is in progress instead of waiting for it"),
+    override: Optional[str] = typer.Option(None, "--override", help="Audit reason for making this change during a deployment freeze window")
+):
     """Stop the app."""
     if helpers.check_service_running(ORCHESTRY_URL) == False:
         typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
         raise typer.Exit(1)
-    response = requests.post(f"{ORCHESTRY_URL}/apps/{name}/down")
+    response = requests.post(f"{helpers.write_api_url(ORCHESTRY_URL)}/apps/{name}/down",
+                             params={"grace_period": grace_period, "lock": _lock_mode(fail_if_busy)},
+                             headers=helpers.user_headers(override))
+    if helpers.report_pending_approval(response):
+        return
+    if response.status_code != 200:
+        helpers.fail(f" Error: {helpers.format_error(response)}", response)
     res = response.json()
-    typer.echo(json.dumps(res, indent=2))
+    helpers.emit(res)
 
 @app.command()
-def delete(name: str, force: bool = typer.Option(False, "--force", "-f", help="Skip confirmation prompt")):
+def delete(
+    name: str,
+    yes: bool = typer.Option(False, "--yes", "-y", "--force", "-f", help="Skip confirmation prompt"),
+    purge: bool = typer.Option(False, "--purge", help="Kill replicas that do not stop and delete the app's revisions and host ports with it in one transaction"),
+    grace_period: Optional[int] = typer.Option(None, "--grace-period", help="Seconds replicas get to exit after SIGTERM before SIGKILL (default: the app's terminationGracePeriodSeconds)"),
+    fail_if_busy: bool = typer.Option(False, "--fail-if-busy", help="Fail right away if another operation on the app is in progress instead of waiting for it"),
+    override: Optional[str] = typer.Option(None, "--override", help="Audit reason for making this change during a deployment freeze window")
+):
     """Delete an application completely."""
     if helpers.check_service_running(ORCHESTRY_URL) == False:
         typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
         raise typer.Exit(1)
     
-    # Confirm deletion unless force flag is set
-    if not force:
+    # Confirm deletion unless --yes is set
+    if not yes:
         confirm = typer.confirm(f"Are you sure you want to delete app '{name}'? This will stop all containers and remove the app registration.")
         if not confirm:
-            typer.echo(" Deletion cancelled")
+            helpers.say(" Deletion cancelled")
             raise typer.Exit(0)
     
     try:
-        response = requests.delete(f"{ORCHESTRY_URL}/apps/{name}")
+        response = requests.delete(f"{helpers.write_api_url(ORCHESTRY_URL)}/apps/{name}",
+                                   params={"grace_period": grace_period, "lock": _lock_mode(fail_if_busy),
+                                           "purge": purge},
+                                   headers=helpers.user_headers(override))
         
+        if helpers.report_pending_approval(response):
+            return
         if response.status_code == 200:
             res = response.json()
-            typer.echo(" App deleted successfully!")
-            typer.echo(json.dumps(res, indent=2))
+            helpers.say(" App deleted successfully!")
+            helpers.emit(res)
         elif response.status_code == 404:
-            typer.echo(f" App '{name}' not found", err=True)
-            raise typer.Exit(1)
+            helpers.fail(f" App '{name}' not found", code=helpers.EXIT_NOT_FOUND)
         else:
-            typer.echo(f" Error: {response.json()}", err=True)
-            raise typer.Exit(1)
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
     except requests.exceptions.RequestException as e:
-        typer.echo(f" Error: Unable to connect to API - {e}", err=True)
-        raise typer.Exit(1)
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+    except typer.Exit:
+        raise
     except Exception as e:
-        typer.echo(f" Error: {e}", err=True)
+        helpers.fail(f" Error: {e}", error=e)
+
+# Same command under the name people look for when undoing `register`
+app.command("unregister", help="Delete an application completely (same as delete).")(delete)
+
+@app.command()
+def archive(
+    name: str,
+    grace_period: Optional[int] = typer.Option(None, "--grace-period", help="Seconds replicas get to exit after SIGTERM before SIGKILL (default: the app's terminationGracePeriodSeconds)"),
+    fail_if_busy: bool = typer.Option(False, "--fail-if-busy", help="Fail right away if another operation on the app is in progress instead of waiting for it"),
+    override: Optional[str] = typer.Option(None, "--override", help="Audit reason for making this change during a deployment freeze window")
+):
+    """Decommission an app: stop its containers but keep its spec and history ('orchestry restore' brings it back)."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+
+    try:
+        response = requests.post(f"{helpers.resolve_write_url(ORCHESTRY_URL)}/apps/{name}/archive",
+                                 params={"grace_period": grace_period, "lock": _lock_mode(fail_if_busy)},
+                                 headers=helpers.user_headers(override))
+        if helpers.report_pending_approval(response):
+            return
+        if response.status_code != 200:
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+        res = response.json()
+        typer.echo(f" App '{name}' archived ({res['containers_stopped']} containers stopped)")
+        helpers.say(f" Its spec, revisions, events and scaling history are kept; run 'orchestry restore {name}' to bring it back")
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+
+@app.command()
+def restore(name: str):
+    """Restore an archived app. It comes back stopped; start it with 'orchestry up'."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
         raise typer.Exit(1)
 
+    try:
+        response = requests.post(f"{helpers.resolve_write_url(ORCHESTRY_URL)}/apps/{name}/restore",
+                                 headers=helpers.user_headers())
+        if response.status_code != 200:
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+        res = response.json()
+        typer.echo(f" App '{name}' restored at revision {res.get('revision')}; run 'orchestry up {name}' to start it")
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+
+CONDITION_COLUMNS = ["type", "status", "reason", "message", "lastTransitionTime"]
+
 @app.command()
 def status(name: str):
     """Check app status."""
@@ -126,66 +430,333 @@ def status(name: str):
         typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
         raise typer.Exit(1)
 
-    response = requests.get(f"{ORCHESTRY_URL}/apps/{name}/status")
+    response = requests.get(f"{helpers.api_url(ORCHESTRY_URL)}/apps/{name}/status")
+    if response.status_code != 200:
+        helpers.fail(f" Error: {helpers.format_error(response)}", response)
+    res = response.json()
+    helpers.emit(res, rows=res.get("instances", []),
+                 columns=["container_id", "ip", "port", "state", "state_since", "cpu_percent", "memory_percent", "failures"],
+                 title=f" {res.get('app', name)}: {res.get('status')} "
+                       f"({res.get('ready_replicas', 0)}/{res.get('replicas', 0)} ready)")
+    if helpers.OUTPUT == "table" and res.get("conditions"):
+        # Conditions say what exactly is wrong; --columns only applies to the replicas
+        helpers.say()
+        typer.echo(helpers.table(res["conditions"], CONDITION_COLUMNS))
+        for condition in res["conditions"]:
+            if condition.get("hint"):
+                typer.echo(f" {condition['type']}: {condition['hint']}")
+
+@app.command()
+def timeline(
+    name: str,
+    since: Optional[float] = typer.Option(None, "--since", help="Only show transitions after this Unix timestamp"),
+    limit: int = typer.Option(100, "--limit", help="Maximum number of transitions to show"),
+    json_output: bool = typer.Option(False, "--json", help="Print the raw API response")
+):
+    """Show an app's status transitions (registered, running, degraded, stopped...) and their causes."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+
+    try:
+        response = requests.get(f"{ORCHESTRY_URL}/apps/{name}/timeline",
+                                params={"since": since, "limit": limit})
+        if response.status_code != 200:
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+
+        data = response.json()
+        if json_output:
+            typer.echo(json.dumps(data, indent=2))
+            return
+        if not data["transitions"]:
+            typer.echo(f" No status transitions recorded for {name}")
+            return
+        from datetime import datetime
+        for transition in data["transitions"]:
+            at = datetime.fromtimestamp(transition["timestamp"]).strftime("%Y-%m-%d %H:%M:%S")
+            change = f"{transition['from_status'] or '-'} -> {transition['to_status']}"
+            by = (transition.get("details") or {}).get("requested_by")
+            cause = transition["cause"] + (f" (by {by})" if by else "")
+            typer.echo(f" {at}  {change:<24} {_format_duration(transition['duration_seconds']):>9}  {cause}")
+
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+
+def _format_duration(seconds: float) -> str:
+    seconds = int(seconds)
+    if seconds < 60:
+        return f"{seconds}s"
+    if seconds < 3600:
+        return f"{seconds // 60}m{seconds % 60:02d}s"
+    if seconds < 86400:
+        return f"{seconds // 3600}h{seconds % 3600 // 60:02d}m"
+    return f"{seconds // 86400}d{seconds % 86400 // 3600:02d}h"
+
+HISTORY_COLUMNS = ["timestamp", "app", "replicas", "reason", "metrics"]
+
+def _history_rows(res: dict) -> list:
+    """One table row per scaling action, with the metrics that triggered it in short form."""
+    rows = []
+    for item in res.get("scaling_history", []):
+        snapshot = item.get("metrics_snapshot") or {}
+        metrics = []
+        if snapshot.get("rps") is not None:
+            metrics.append(f"rps={snapshot['rps']:.1f}")
+        if snapshot.get("p95_latency_ms") is not None:
+            metrics.append(f"p95={snapshot['p95_latency_ms']:.0f}ms")
+        if snapshot.get("active_connections") is not None:
+            metrics.append(f"conns={snapshot['active_connections']}")
+        if snapshot.get("cpu_percent") is not None:
+            metrics.append(f"cpu={snapshot['cpu_percent']:.0f}%")
+        if snapshot.get("memory_percent") is not None:
+            metrics.append(f"mem={snapshot['memory_percent']:.0f}%")
+        metrics += [f"{name}={value:g}" for name, value in (snapshot.get("external") or {}).items()]
+        rows.append({"timestamp": item["timestamp"], "app": item["app_name"],
+                     "replicas": f"{item['from_replicas']} -> {item['to_replicas']}",
+                     "reason": item["trigger_reason"], "metrics": " ".join(metrics) or None})
+    return rows
+
+@app.command()
+def history(
+    name: Optional[str] = typer.Argument(None, help="Only show scaling actions of this app"),
+    since: Optional[str] = typer.Option(None, "--since", help="Only show actions after this time: an age such as 30m, 2h or 7d, an ISO 8601 timestamp or Unix seconds"),
+    limit: int = typer.Option(50, "--limit", help="Maximum number of actions to show")
+):
+    """Show scaling actions (replicas before and after, reason, triggering metrics), newest first."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+
+    try:
+        params = {"limit": limit}
+        if since:
+            params["since"] = since
+        if name:
+            response = requests.get(f"{ORCHESTRY_URL}/apps/{name}/scaling-history", params=params)
+        else:
+            response = requests.get(f"{ORCHESTRY_URL}/scaling-history", params=params)
+        if response.status_code == 404:
+            helpers.fail(f" App '{name}' not found", code=helpers.EXIT_NOT_FOUND)
+        if response.status_code != 200:
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+        res = response.json()
+        helpers.emit(res, rows=_history_rows(res), columns=HISTORY_COLUMNS, default="table")
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+    except typer.Exit:
+        raise
+    except Exception as e:
+        helpers.fail(f" Error: {e}", error=e)
+
+@app.command()
+def graph(dot: bool = typer.Option(False, "--dot", help="Print the graph in Graphviz DOT format")):
+    """Show the app dependency graph (dependsOn) with each app's effective health."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+
+    response = requests.get(f"{ORCHESTRY_URL}/apps/graph")
+    if response.status_code != 200:
+        helpers.fail(f" Error: {helpers.format_error(response)}", response)
     res = response.json()
-    typer.echo(json.dumps(res, indent=2))
+    if not dot:
+        helpers.emit(res, rows=res.get("nodes", []),
+                     columns=["name", "namespace", "status", "effective_status", "cause"])
+        return
+
+    colors = {"up": "green", "degraded": "orange", "dependency_down": "orange", "down": "red"}
+    typer.echo("digraph orchestry {")
+    for node in res["nodes"]:
+        color = colors.get(node["effective_status"], "gray")
+        typer.echo(f'  "{node["name"]}" [label="{node["name"]}\\n{node["effective_status"]}", color={color}];')
+    for edge in res["edges"]:
+        typer.echo(f'  "{edge["from"]}" -> "{edge["to"]}";')
+    typer.echo("}")
+
+def _print_scale_preview(name: str, replicas: int):
+    response = requests.get(f"{ORCHESTRY_URL}/apps/{name}/scale/preview",
+                            params={"replicas": replicas}, headers=helpers.user_headers())
+    if response.status_code != 200:
+        helpers.fail(f" Error: {helpers.format_error(response)}", response)
+
+    preview = response.json()
+    create, remove = preview["create"], preview["remove"]
+    typer.echo(f" Dry run: scaling '{name}' from {preview['current_replicas']} to {replicas} replicas would")
+    if create["count"]:
+        typer.echo(f"   create {create['count']} replica(s): {create['from_warm_pool']} from the warm pool, "
+                   f"{create['new_containers']} new container(s)")
+    for replica in remove:
+        typer.echo(f"   remove {replica['container']} ({replica['state']})")
+    if not create["count"] and not remove:
+        typer.echo("   change nothing")
+
+    resources = preview["resources"]
+    for key, unit in (("cpu", " cores"), ("memory_gb", " GiB")):
+        limit = resources["host_capacity"][key]
+        typer.echo(f" Host {key}: {resources['host_used'][key]:g} -> {resources['host_projected'][key]:g}{unit} requested"
+                   + (f" of {limit:g}" if limit else ""))
+    if resources["exceeds_capacity"]:
+        typer.echo(f" Warning: the host would be overcommitted on {', '.join(resources['exceeds_capacity'])}", err=True)
+    if not preview["quota"]["within_quota"]:
+        typer.echo(" Warning: the scale request would exceed your API quota", err=True)
+    if preview["approval_required"]:
+        typer.echo(f" Needs approval: {preview['approval_required']}")
+    if preview["availability"]:
+        typer.echo(f" Availability: {preview['availability']}")
+
+    autoscaler = preview["autoscaler"]
+    if autoscaler["would_counteract"]:
+        typer.echo(f" The autoscaler would move it to {autoscaler['target_replicas']} replicas within about "
+                   f"{autoscaler['after_seconds']:g}s ({autoscaler['reason']})")
+    else:
+        typer.echo(f" The autoscaler would leave it ({autoscaler['reason']})")
 
 @app.command()
-def scale(name: str, replicas: int):
+def scale(
+    name: str,
+    replicas: int,
+    grace_period: Optional[int] = typer.Option(None, "--grace-period", help="Seconds removed replicas get to exit after SIGTERM before SIGKILL (default: the app's terminationGracePeriodSeconds)"),
+    fail_if_busy: bool = typer.Option(False, "--fail-if-busy", help="Fail right away if another operation on the app is in progress instead of waiting for it"),
+    dry_run: bool = typer.Option(False, "--dry-run", help="Show what the scale would change without doing it")
+):
     """Scale app to specific replica count."""
     if helpers.check_service_running(ORCHESTRY_URL) == False:
         typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
         raise typer.Exit(1)
 
     try:
-        info_response = requests.get(f"{ORCHESTRY_URL}/apps/{name}/status")
+        info_response = requests.get(f"{helpers.api_url(ORCHESTRY_URL)}/apps/{name}/status")
         if info_response.status_code == 404:
-            typer.echo(f" App '{name}' not found", err=True)
-            raise typer.Exit(1)
+            helpers.fail(f" App '{name}' not found", code=helpers.EXIT_NOT_FOUND)
         elif info_response.status_code != 200:
-            typer.echo(f" Error: {info_response.json()}", err=True)
-            raise typer.Exit(1)
+            helpers.fail(f" Error: {helpers.format_error(info_response)}", info_response)
 
         app_info = info_response.json()
         app_mode = app_info.get('mode', 'auto')
 
+        if dry_run:
+            _print_scale_preview(name, replicas)
+            return
+
         if app_mode == 'manual':
-            typer.echo(f"  Scaling '{name}' to {replicas} replicas (manual mode)")
+            helpers.say(f"  Scaling '{name}' to {replicas} replicas (manual mode)")
         else:
-            typer.echo(f"  Scaling '{name}' to {replicas} replicas (auto mode - may be overridden by autoscaler)")
+            helpers.say(f"  Scaling '{name}' to {replicas} replicas (auto mode - may be overridden by autoscaler)")
 
         response = requests.post(
-            f"{ORCHESTRY_URL}/apps/{name}/scale",
-            json={"replicas": replicas}
+            f"{helpers.write_api_url(ORCHESTRY_URL)}/apps/{name}/scale",
+            json={"replicas": replicas, "grace_period": grace_period},
+            params={"lock": _lock_mode(fail_if_busy)},
+            headers=helpers.user_headers()
         )
 
+        if helpers.report_pending_approval(response):
+            return
         if response.status_code == 200:
             result = response.json()
-            typer.echo(" " + str(json.dumps(result, indent=2)))
+            helpers.emit(result)
 
             if app_mode == 'auto':
-                typer.echo("\n Tip: This app uses automatic scaling. To use manual scaling, set 'mode: manual' in the scaling section of your YAML spec.")
+                helpers.say("\n Tip: This app uses automatic scaling. To use manual scaling, set 'mode: manual' in the scaling section of your YAML spec.")
         else:
-            typer.echo(f" Error: {response.json()}", err=True)
-            raise typer.Exit(1)
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
 
     except requests.exceptions.RequestException as e:
-        typer.echo(f" Error: Unable to connect to API - {e}", err=True)
-        raise typer.Exit(1)
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+    except typer.Exit:
+        raise
     except Exception as e:
-        typer.echo(f" Error: {e}", err=True)
-        raise typer.Exit(1)
+        helpers.fail(f" Error: {e}", error=e)
+
+# Default columns of `list -o table`
+APP_COLUMNS = ["name", "namespace", "status", "ready_replicas", "replicas", "mode", "team", "spec.image"]
 
 @app.command()
-def list():
+def list(
+    team: Optional[str] = typer.Option(None, "--team", help="Only show apps owned by this team"),
+    owner: Optional[str] = typer.Option(None, "--owner", help="Only show apps with this owner"),
+    namespace: Optional[str] = typer.Option(None, "--namespace", "-N", help="Only show apps in this namespace"),
+    all_clusters: bool = typer.Option(False, "--all-clusters", help="List apps on every cluster in 'orchestry clusters'")
+):
     """List all applications.""" 
+    params = {"team": team, "owner": owner, "namespace": namespace}
+    if all_clusters:
+        _list_all_clusters(params)
+        return
+
     if helpers.check_service_running(ORCHESTRY_URL) == False:
         typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
         raise typer.Exit(1)
 
-    response = requests.get(f"{ORCHESTRY_URL}/apps")
+    response = requests.get(f"{ORCHESTRY_URL}/apps", params=params)
+    if response.status_code != 200:
+        helpers.fail(f" Error: {helpers.format_error(response)}", response)
     res = response.json()
-    typer.echo(json.dumps(res, indent=2))
+    helpers.emit(res, rows=res.get("apps", []), columns=APP_COLUMNS)
+
+def _list_all_clusters(params: dict):
+    """List apps on every configured cluster at once. Unreachable clusters are reported in errors."""
+    from concurrent.futures import ThreadPoolExecutor
+
+    clusters = helpers.load_clusters()
+    if not clusters:
+        typer.echo(" No clusters configured, run 'orchestry config' or 'orchestry clusters add'", err=True)
+        raise typer.Exit(1)
+
+    def fetch(item):
+        name, url = item
+        try:
+            response = requests.get(f"{url}/apps", params=params, timeout=10)
+            if response.status_code != 200:
+                return name, {"error": f"HTTP {response.status_code}: {response.text}"}
+            return name, response.json()
+        except requests.exceptions.RequestException as e:
+            return name, {"error": str(e)}
+
+    with ThreadPoolExecutor(max_workers=min(8, len(clusters))) as pool:
+        results = pool.map(fetch, clusters.items())
+    apps, errors = [], {}
+    for name, result in results:
+        if "error" in result:
+            errors[name] = result["error"]
+        else:
+            apps += [{**item, "cluster": name} for item in result.get("apps", [])]
+    helpers.emit({"apps": apps, "errors": errors}, rows=apps, columns=["cluster"] + APP_COLUMNS)
+    if helpers.OUTPUT == "table":
+        for name, error in errors.items():
+            typer.echo(f" {name}: {error}", err=True)
+    if errors and not apps:
+        raise typer.Exit(1)
+
+@app.command()
+def clusters(
+    action: str = typer.Argument("list", help="list, add or remove"),
+    name: Optional[str] = typer.Argument(None, help="Cluster name, e.g. eu-west"),
+    url: Optional[str] = typer.Argument(None, help="Controller URL of the cluster (add), e.g. http://orchestry.eu-west:8000")
+):
+    """Manage the named clusters the CLI can target with --cluster and list --all-clusters."""
+    if action == "list":
+        configured = helpers.load_clusters()
+        if not configured:
+            typer.echo(" No clusters configured, run 'orchestry config' or 'orchestry clusters add'")
+            return
+        for cluster_name, cluster_url in configured.items():
+            typer.echo(f" {cluster_name:<16} {cluster_url}")
+    elif action == "add":
+        if not name or not url:
+            helpers.fail(" Error: clusters add needs a name and a URL", code=helpers.EXIT_VALIDATION)
+        if name == "default":
+            helpers.fail(" Error: 'default' is the controller set up with 'orchestry config'", code=helpers.EXIT_VALIDATION)
+        if not url.startswith(("http://", "https://")):
+            url = f"http://{url}"
+        helpers.save_cluster(name, url)
+        helpers.say(f" Added cluster {name} ({url})")
+    elif action == "remove":
+        if not name or not helpers.remove_cluster(name):
+            helpers.fail(f" Error: no cluster named '{name}'", code=helpers.EXIT_NOT_FOUND)
+        helpers.say(f" Removed cluster {name}")
+    else:
+        helpers.fail(f" Error: unknown action '{action}', use list, add or remove", code=helpers.EXIT_VALIDATION)
 
 @app.command()
 def metrics(name: Optional[str] = None):
@@ -195,12 +766,14 @@ def metrics(name: Optional[str] = None):
         raise typer.Exit(1)
 
     if name:
-        response = requests.get(f"{ORCHESTRY_URL}/apps/{name}/metrics")
+        response = requests.get(f"{helpers.api_url(ORCHESTRY_URL)}/apps/{name}/metrics")
     else:
         response = requests.get(f"{ORCHESTRY_URL}/metrics")
 
+    if response.status_code != 200:
+        helpers.fail(f" Error: {helpers.format_error(response)}", response)
     res = response.json()
-    typer.echo(json.dumps(res, indent=2))
+    helpers.emit(res)
 
 @app.command()
 def info():
@@ -210,10 +783,13 @@ def info():
         if response.status_code == 200:
             typer.echo(" orchestry Controller: Running")
             typer.echo(f"   API: {ORCHESTRY_URL}")
+            freeze_state = response.json().get("freeze") or {}
+            if freeze_state.get("frozen"):
+                typer.echo(f"   Maintenance: FROZEN - {freeze_state.get('reason')}")
 
             apps_response = requests.get(f"{ORCHESTRY_URL}/apps")
             if apps_response.status_code == 200:
-                apps = apps_response.json()
+                apps = apps_response.json().get("apps", [])
                 typer.echo(f"   Apps: {len(apps)} registered")
             typer.echo("")
             typer.echo(" Docker Services:")
@@ -236,6 +812,108 @@ def info():
     except Exception as e:
         typer.echo(f" Error checking status: {e}")
 
+@app.command()
+def version(check: bool = typer.Option(False, "--check", help="Compare with the versions the controller supports")):
+    """Show the CLI version. Use --check to see whether it matches the controller."""
+    typer.echo(f"orchestry CLI {helpers.cli_version()} (API {helpers.API_VERSION})")
+    if not check:
+        return
+    versions = helpers.get_versions(ORCHESTRY_URL)
+    if versions is None:
+        typer.echo(" Could not reach the orchestry controller, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+    cli = versions.get("cli") or {}
+    typer.echo(f"Controller: {versions.get('controller', 'unknown')} (API {', '.join(versions.get('versions', [])) or 'unversioned'})")
+    if cli.get("recommended"):
+        typer.echo(f"Recommended CLI: {cli['recommended']}")
+    if cli.get("minimum"):
+        typer.echo(f"Minimum CLI: {cli['minimum']}")
+    drift = helpers.version_drift(versions)
+    if drift:
+        typer.echo(f" {drift}", err=True)
+        raise typer.Exit(1)
+    current = helpers.parse_version(helpers.cli_version())
+    recommended = helpers.parse_version(cli.get("recommended"))
+    if current and recommended and current < recommended:
+        typer.echo(f" CLI {cli['recommended']} is available, run 'orchestry self-update'")
+    else:
+        typer.echo(" CLI is up to date")
+
+def _platform():
+    """This machine as the os-arch name standalone CLI binaries are published under."""
+    import platform
+    machine = platform.machine().lower()
+    arch = {"x86_64": "amd64", "amd64": "amd64", "aarch64": "arm64", "arm64": "arm64"}.get(machine, machine)
+    return f"{platform.system().lower()}-{arch}"
+
+@app.command("self-update")
+def self_update(target: Optional[str] = typer.Option(None, "--version", help="Version to install (default: the controller's recommended version)"),
+                yes: bool = typer.Option(False, "--yes", "-y", help="Skip confirmation")):
+    """Update the CLI to the version the controller recommends."""
+    versions = helpers.get_versions(ORCHESTRY_URL)
+    if versions is None:
+        typer.echo(" Could not reach the orchestry controller, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+    cli = versions.get("cli") or {}
+    target = (target or cli.get("recommended") or "").lstrip("v")
+    if not helpers.parse_version(target):
+        typer.echo(" The controller does not advertise a CLI version, pass one with --version", err=True)
+        raise typer.Exit(1)
+    if target == helpers.cli_version():
+        typer.echo(f" CLI {target} is already installed")
+        return
+    if cli.get("minimum") and helpers.parse_version(target) < helpers.parse_version(cli["minimum"]):
+        typer.echo(f" CLI {target} is older than {cli['minimum']}, the oldest version the controller supports", err=True)
+        raise typer.Exit(1)
+    if not yes and not typer.confirm(f"Update the CLI from {helpers.cli_version()} to {target}?"):
+        raise typer.Exit(0)
+
+    if not getattr(sys, "frozen", False):
+        # Installed as a Python package
+        import subprocess
+        result = subprocess.run([sys.executable, "-m", "pip", "install", "--upgrade", f"orchestry=={target}"])
+        if result.returncode != 0:
+            typer.echo(" pip install failed", err=True)
+            raise typer.Exit(1)
+        helpers.say(f" CLI updated to {target}")
+        return
+
+    platform_name = _platform()
+    if not cli.get("download_url"):
+        typer.echo(" The controller does not advertise a CLI download URL (ORCHESTRY_CLI_DOWNLOAD_URL)", err=True)
+        raise typer.Exit(1)
+    if platform_name not in cli.get("platforms", []):
+        typer.echo(f" No CLI binary is published for {platform_name}", err=True)
+        raise typer.Exit(1)
+    os_name, arch = platform_name.split("-", 1)
+    url = cli["download_url"].format(version=target, os=os_name, arch=arch)
+    try:
+        checksum_response = requests.get(f"{url}.sha256", timeout=30)
+        binary_response = requests.get(url, timeout=300)
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Download failed: {e}", error=e)
+    if binary_response.status_code != 200 or checksum_response.status_code != 200:
+        typer.echo(f" Download failed: {url} returned {binary_response.status_code}", err=True)
+        raise typer.Exit(1)
+    expected = checksum_response.text.split()[0].lower() if checksum_response.text.split() else ""
+    if hashlib.sha256(binary_response.content).hexdigest() != expected:
+        typer.echo(f" Checksum mismatch for {url}, not installing it", err=True)
+        raise typer.Exit(1)
+
+    # Write next to the running binary and rename over it, so an interrupted update leaves the old one
+    executable = os.path.realpath(sys.executable)
+    temporary = f"{executable}.new"
+    try:
+        with open(temporary, "wb") as f:
+            f.write(binary_response.content)
+        os.chmod(temporary, os.stat(executable).st_mode | 0o111)
+        os.replace(temporary, executable)
+    except OSError as e:
+        if os.path.exists(temporary):
+            os.remove(temporary)
+        helpers.fail(f" Could not replace {executable}: {e}", error=e)
+    helpers.say(f" CLI updated to {target} ({platform_name})")
+
 @app.command()
 def spec(name: str, raw: bool = False):
     """Get app specification. Use --raw to see the original submitted spec."""
@@ -246,49 +924,173 @@ def spec(name: str, raw: bool = False):
     try:
         response = requests.get(f"{ORCHESTRY_URL}/apps/{name}/raw")
         if response.status_code == 404:
-            typer.echo(f" App '{name}' not found", err=True)
-            raise typer.Exit(1)
+            helpers.fail(f" App '{name}' not found", code=helpers.EXIT_NOT_FOUND)
         elif response.status_code != 200:
-            typer.echo(f" Error: {response.json()}", err=True)
-            raise typer.Exit(1)
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
 
         data = response.json()
 
         if raw:
             if data.get("raw"):
-                typer.echo(yaml.dump(data["raw"], default_flow_style=False))
+                helpers.emit(data["raw"], default="yaml")
             else:
                 typer.echo("No raw spec available")
         else:
             parsed = data.get("parsed", {})
             for field in ["created_at", "updated_at"]:
                 parsed.pop(field, None)
-            typer.echo(yaml.dump(parsed, default_flow_style=False))
+            helpers.emit(parsed, default="yaml")
 
+    except typer.Exit:
+        raise
     except Exception as e:
-        typer.echo(f" Error: {e}", err=True)
+        helpers.fail(f" Error: {e}", error=e)
+
+DIFF_SYMBOLS = {"added": ("+", typer.colors.GREEN), "removed": ("-", typer.colors.RED), "changed": ("~", typer.colors.YELLOW)}
+
+def _diff_value(value) -> str:
+    return value if isinstance(value, str) else json.dumps(value)
+
+@app.command()
+def apply(
+    spec_file: str = typer.Option(..., "--file", "-f", help="Spec file, '-' for stdin, or an http(s) URL"),
+    up: bool = typer.Option(False, "--up", help="Also start the app if it is not running"),
+    sha256: Optional[str] = typer.Option(None, "--sha256", help="Refuse the spec unless its SHA-256 checksum is this (hex)"),
+    override: Optional[str] = typer.Option(None, "--override", help="Audit reason for making this change during a deployment freeze window"),
+    env_file: Optional[List[str]] = typer.Option(None, "--env-file", help=".env file merged into the spec's env, overriding it (repeatable, later files win)")
+):
+    """Make an app match a spec: register it if it is missing, update it if the spec changed,
+    and do nothing otherwise. Safe to run again and again, e.g. from CI."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+    remote = spec_file == "-" or spec_file.startswith(("http://", "https://"))
+    if not remote and not os.path.isfile(spec_file):
+        helpers.fail(f" Spec file '{spec_file}' not found", code=helpers.EXIT_NOT_FOUND)
+
+    try:
+        spec, source = _read_spec_source(spec_file, sha256)
+        base_dir = os.getcwd() if spec_file == "-" else (None if remote else os.path.dirname(os.path.abspath(spec_file)))
+        _merge_env_files(spec, base_dir, env_file)
+        name = (spec.get("metadata") or {}).get("name")
+        if not name:
+            helpers.fail(" Error: the spec has no metadata.name", code=helpers.EXIT_VALIDATION)
+        if spec.get("placement"):
+            helpers.fail(" Error: apply does not support federated specs; use 'orchestry register'",
+                         code=helpers.EXIT_VALIDATION)
+
+        response = requests.post(
+            f"{helpers.resolve_write_url(ORCHESTRY_URL)}/apps/{name}/apply",
+            json=spec, params={**source, "up": up},
+            headers={"Content-Type": "application/json", **helpers.user_headers(override)}
+        )
+        if helpers.report_pending_approval(response):
+            return
+        if response.status_code != 200:
+            helpers.fail(f" Apply failed: {helpers.format_error(response)}", response)
+
+        result = response.json()
+        if result["action"] == "created":
+            helpers.say(f" {name} created (revision {result['revision']})")
+        elif result["action"] == "updated":
+            helpers.say(f" {name} updated to revision {result['revision']}: {len(result['changes'])} change(s)"
+                        f"{', restarted' if result['restarted'] else ''}")
+        else:
+            helpers.say(f" {name} is up to date (revision {result['revision']})")
+        if result["started"]:
+            helpers.say(f" {name} started")
+        helpers.emit(result)
+        for warning in result.get("warnings") or []:
+            typer.echo(f" Warning: {warning}", err=True)
+
+    except typer.Exit:
+        raise
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+    except (OSError, ValueError, yaml.YAMLError) as e:
+        helpers.fail(f" Error: {e}", code=helpers.EXIT_VALIDATION)
+
+@app.command()
+def diff(
+    path: str = typer.Argument(..., help="Local spec file (YAML or JSON)"),
+    revision: Optional[int] = typer.Option(None, "--revision", "-r", help="Compare with this revision instead of the latest"),
+    exit_code: bool = typer.Option(False, "--exit-code", help="Exit with 1 if the specs differ, like git diff --exit-code")
+):
+    """Show what registering a local spec would change in the deployed app, by section
+    (image, env, resources, scaling, other). Formatting differences are ignored."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
         raise typer.Exit(1)
 
+    try:
+        spec = _load_spec(path)
+        name = (spec.get("metadata") or {}).get("name")
+        if not name:
+            helpers.fail(" Error: the spec has no metadata.name", code=helpers.EXIT_VALIDATION)
+
+        response = requests.post(f"{ORCHESTRY_URL}/apps/{name}/diff", json=spec,
+                                 params={"revision": revision} if revision is not None else None)
+        if response.status_code == 404 and revision is None:
+            typer.echo(f" App '{name}' is not registered; registering {path} would create it")
+            raise typer.Exit(1 if exit_code else 0)
+        if response.status_code != 200:
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+
+        data = response.json()
+        if data["identical"]:
+            typer.echo(f" {path} matches {name} revision {data['revision']}")
+            return
+
+        typer.echo(f" {path} vs {name} revision {data['revision']}:")
+        current = None
+        for change in data["changes"]:
+            if change["section"] != current:
+                current = change["section"]
+                typer.echo(typer.style(f"\n {current}", bold=True))
+            symbol, color = DIFF_SYMBOLS[change["op"]]
+            if change["op"] == "changed":
+                line = f"   {symbol} {change['path']}: {_diff_value(change['old'])} -> {_diff_value(change['new'])}"
+            else:
+                line = f"   {symbol} {change['path']}: {_diff_value(change.get('new', change.get('old')))}"
+            typer.echo(typer.style(line, fg=color))
+        typer.echo(f"\n {data['count']} change(s)")
+        if exit_code:
+            raise typer.Exit(1)
+
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+    except FileNotFoundError as e:
+        helpers.fail(f" Error: {e}", code=helpers.EXIT_NOT_FOUND)
+    except (OSError, ValueError, yaml.YAMLError) as e:
+        helpers.fail(f" Error: {e}", code=helpers.EXIT_VALIDATION)
+
 @app.command()
 def logs(
     name: str,
     lines: int = typer.Option(100, "--lines", "-n", help="Number of log lines to retrieve"),
-    follow: bool = typer.Option(False, "--follow", "-f", help="Follow log output (not yet implemented)")
+    follow: bool = typer.Option(False, "--follow", "-f", help="Keep printing new log lines as replicas write them"),
+    access: bool = typer.Option(False, "--access", help="Show nginx access log entries instead of container logs"),
+    request_id: Optional[str] = typer.Option(None, "--request-id", help="Only show access log entries for this X-Request-ID")
 ):
     """Get logs for an application."""
     if helpers.check_service_running(ORCHESTRY_URL) == False:
         typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
         raise typer.Exit(1)
 
+    if access or request_id:
+        _show_access_logs(name, lines, request_id)
+        return
+    if follow:
+        _follow_logs(name, lines)
+        return
+
     try:
-        response = requests.get(f"{ORCHESTRY_URL}/apps/{name}/logs", params={"lines": lines})
+        response = requests.get(f"{helpers.api_url(ORCHESTRY_URL)}/apps/{name}/logs", params={"lines": lines})
 
         if response.status_code == 404:
-            typer.echo(f" App '{name}' not found or not running", err=True)
-            raise typer.Exit(1)
+            helpers.fail(f" App '{name}' not found or not running", code=helpers.EXIT_NOT_FOUND)
         elif response.status_code != 200:
-            typer.echo(f" Error: {response.json()}", err=True)
-            raise typer.Exit(1)
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
 
         data = response.json()
         logs_list = data.get("logs", [])
@@ -298,8 +1100,8 @@ def logs(
             typer.echo(f" No logs available for app '{name}'")
             return
 
-        typer.echo(f" Logs for '{name}' ({total_containers} container(s)):")
-        typer.echo("")
+        helpers.say(f" Logs for '{name}' ({total_containers} container(s)):")
+        helpers.say("")
 
         # Display logs sorted by timestamp
         for log_entry in logs_list:
@@ -315,61 +1117,1579 @@ def logs(
             # Color-code by container (simple approach using container ID)
             typer.echo(f"{time_str} [{container_id}] {message}")
 
-        if follow:
-            typer.echo("\n Note: Log following (--follow/-f) is not yet implemented")
-
     except requests.exceptions.RequestException as e:
-        typer.echo(f" Error: Unable to connect to API - {e}", err=True)
-        raise typer.Exit(1)
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+    except typer.Exit:
+        raise
     except Exception as e:
-        typer.echo(f" Error: {e}", err=True)
-        raise typer.Exit(1)
+        helpers.fail(f" Error: {e}", error=e)
+
+# The controller sends a heartbeat every 15 seconds; a stream silent for longer is dead
+LOG_STREAM_READ_TIMEOUT = 45
+LOG_STREAM_MAX_BACKOFF = 10
+
+def _follow_logs(name: str, lines: int):
+    """Print an app's log stream until interrupted, reconnecting after the last line received."""
+    from datetime import datetime
+    last_event_id = None
+    backoff = 1
+    try:
+        while True:
+            try:
+                headers = {"Accept": "text/event-stream"}
+                if last_event_id:
+                    headers["Last-Event-ID"] = last_event_id
+                with requests.get(f"{ORCHESTRY_URL}/apps/{name}/logs/stream",
+                                  params={"tail": lines}, headers=headers, stream=True,
+                                  timeout=(5, LOG_STREAM_READ_TIMEOUT)) as response:
+                    if response.status_code == 404:
+                        helpers.fail(f" App '{name}' not found", code=helpers.EXIT_NOT_FOUND)
+                    elif 400 <= response.status_code < 500:
+                        helpers.fail(f" Error: {helpers.format_error(response)}", response)
+                    elif response.status_code != 200:
+                        raise requests.exceptions.ConnectionError(helpers.format_error(response))
+                    backoff = 1
+                    event_id = None
+                    for line in response.iter_lines(decode_unicode=True):
+                        if line.startswith("id: "):
+                            event_id = line[4:]
+                        elif line.startswith("data: "):
+                            entry = json.loads(line[6:])
+                            time_str = datetime.fromtimestamp(entry.get("timestamp", 0)).strftime("%Y-%m-%d %H:%M:%S")
+                            typer.echo(f"{time_str} [{entry.get('container', 'unknown')}] {entry.get('message', '')}")
+                            last_event_id = event_id or last_event_id
+                # The controller closed the stream, e.g. while it restarted
+                time.sleep(backoff)
+            except requests.exceptions.RequestException as e:
+                helpers.say(f" Log stream interrupted ({e}), reconnecting in {backoff}s", err=True)
+                time.sleep(backoff)
+                backoff = min(backoff * 2, LOG_STREAM_MAX_BACKOFF)
+    except KeyboardInterrupt:
+        return
+
+def _show_access_logs(name: str, lines: int, request_id: Optional[str]):
+    try:
+        response = requests.get(
+            f"{ORCHESTRY_URL}/apps/{name}/access-logs",
+            params={"lines": lines, "request_id": request_id}
+        )
+
+        if response.status_code == 404:
+            helpers.fail(f" App '{name}' not found", code=helpers.EXIT_NOT_FOUND)
+        elif response.status_code != 200:
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+
+        entries = response.json().get("entries", [])
+        if not entries:
+            scope = f" for request {request_id}" if request_id else ""
+            typer.echo(f" No access log entries{scope} for app '{name}'")
+            return
+
+        for entry in entries:
+            typer.echo(
+                f"{entry.get('time', '')} [{entry.get('request_id', '-')}] "
+                f"{entry.get('method', '')} {entry.get('uri', '')} {entry.get('status', '')} "
+                f"{entry.get('request_time', '')}s upstream={entry.get('upstream', '-')}"
+            )
+
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
 
 @app.command()
-def cluster(opts: str):
-    """Get cluster information(status, leader, health)"""
+def cost(
+    name: str,
+    range: str = typer.Option("30d", "--range", "-r", help="Time range, e.g. 12h, 30d or 2w")
+):
+    """Show estimated cost and resource usage for an application."""
     if helpers.check_service_running(ORCHESTRY_URL) == False:
         typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
         raise typer.Exit(1)
 
     try:
-        response = requests.get(f"{ORCHESTRY_URL}/cluster/{opts}")
+        response = requests.get(f"{ORCHESTRY_URL}/apps/{name}/cost", params={"range": range})
+
         if response.status_code == 404:
-            typer.echo(f"Cluster '{opts}' not found", err=True)
-            raise typer.Exit(1)
+            helpers.fail(f" App '{name}' not found", code=helpers.EXIT_NOT_FOUND)
         elif response.status_code != 200:
-            typer.echo(f"Error: {response.json()}", err=True)
-            raise typer.Exit(1)
-        res = response.json()
-        typer.echo(json.dumps(res, indent=2))
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+
+        report = response.json()
+        usage = report.get("usage", {})
+        costs = report.get("cost", {})
+        pricing = report.get("pricing", {})
+        currency = pricing.get("currency", "")
+
+        typer.echo(f" Cost for '{name}' over the last {report.get('range', range)}:")
+        typer.echo(f"   Replica-hours:   {usage.get('replica_hours', 0):.2f}")
+        typer.echo(f"   CPU-hours:       {usage.get('cpu_hours', 0):.2f} x {pricing.get('per_cpu_hour', 0)} = {costs.get('cpu', 0):.2f} {currency}")
+        typer.echo(f"   Memory GB-hours: {usage.get('memory_gb_hours', 0):.2f} x {pricing.get('per_gb_hour', 0)} = {costs.get('memory', 0):.2f} {currency}")
+        typer.echo(f"   Total:           {costs.get('total', 0):.2f} {currency}")
+
+        daily = report.get("daily", [])
+        if daily:
+            typer.echo("")
+            typer.echo(" Daily breakdown:")
+            for day in daily:
+                typer.echo(
+                    f"   {day['date']}  {day['replica_hours']:8.2f} replica-h  "
+                    f"peak {day['peak_replicas']:>3}  {day['cost']:.2f} {currency}"
+                )
+
     except requests.exceptions.RequestException as e:
-        typer.echo(f" Error: Unable to connect to API - {e}", err=True)
-        raise typer.Exit(1)
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+    except typer.Exit:
+        raise
     except Exception as e:
-        typer.echo(f" Error: {e}", err=True)
-        raise typer.Exit(1)
+        helpers.fail(f" Error: {e}", error=e)
 
 @app.command()
-def events():
-    """Get recent events"""
+def access(
+    name: str,
+    allow: Optional[List[str]] = typer.Option(None, "--allow", help="CIDR allowed to reach the app (repeatable); replaces the allowlist"),
+    deny: Optional[List[str]] = typer.Option(None, "--deny", help="CIDR blocked from reaching the app (repeatable); replaces the denylist"),
+    clear: bool = typer.Option(False, "--clear", help="Remove all IP rules")
+):
+    """Show or update the IP allow/deny lists nginx enforces for an application."""
     if helpers.check_service_running(ORCHESTRY_URL) == False:
         typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
         raise typer.Exit(1)
 
     try:
-        response = requests.get(f"{ORCHESTRY_URL}/events")
+        if clear or allow or deny:
+            current = requests.get(f"{ORCHESTRY_URL}/apps/{name}/access")
+            if current.status_code != 200:
+                helpers.fail(f" Error: {helpers.format_error(current)}", current)
+            rules = current.json()
+            body = {
+                "allowFrom": [] if clear else (allow or rules.get("allowFrom", [])),
+                "denyFrom": [] if clear else (deny or rules.get("denyFrom", []))
+            }
+            response = requests.put(f"{helpers.resolve_write_url(ORCHESTRY_URL)}/apps/{name}/access", json=body,
+                                    headers=helpers.user_headers())
+        else:
+            response = requests.get(f"{ORCHESTRY_URL}/apps/{name}/access")
+
         if response.status_code != 200:
-            typer.echo(f" Error: {response.json()}", err=True)
-            raise typer.Exit(1)
-        res = response.json()
-        typer.echo(json.dumps(res, indent=2))
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+
+        data = response.json()
+        typer.echo(f" IP access rules for '{name}':")
+        typer.echo(f"   Allow: {', '.join(data.get('allowFrom') or []) or 'everyone'}")
+        typer.echo(f"   Deny:  {', '.join(data.get('denyFrom') or []) or 'nobody'}")
+        typer.echo(f"   Always allowed (controller probes): {', '.join(data.get('probe') or [])}")
+
     except requests.exceptions.RequestException as e:
-        typer.echo(f" Error: Unable to connect to API - {e}", err=True)
-        raise typer.Exit(1)
-    except Exception as e:
-        typer.echo(f" Error: {e}", err=True)
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+
+@app.command("access-log")
+def access_log(
+    name: str,
+    mode: Optional[str] = typer.Option(None, "--mode", help="all, sampled or errors"),
+    rate: Optional[int] = typer.Option(None, "--rate", help="Log 1 in N responses below 500 (sampled mode)")
+):
+    """Show or change how much of an application's traffic nginx writes to its access log."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
         raise typer.Exit(1)
 
+    try:
+        if mode or rate:
+            body = {"mode": mode or "sampled"}
+            if rate is not None:
+                body["sampleRate"] = rate
+            response = requests.put(f"{helpers.resolve_write_url(ORCHESTRY_URL)}/apps/{name}/access-logs/sampling",
+                                    json=body, headers=helpers.user_headers())
+        else:
+            response = requests.get(f"{ORCHESTRY_URL}/apps/{name}/access-logs/sampling")
+
+        if response.status_code != 200:
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+
+        config = response.json()["accessLog"]
+        if config["mode"] == "sampled":
+            typer.echo(f" Access log of '{name}': every 5xx and 1 in {config['sampleRate']} other responses")
+        elif config["mode"] == "errors":
+            typer.echo(f" Access log of '{name}': 5xx responses only")
+        else:
+            typer.echo(f" Access log of '{name}': every request")
+
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+
+@app.command()
+def headers(
+    name: str,
+    request_set: Optional[List[str]] = typer.Option(None, "--request-set", help="NAME=VALUE header sent to replicas (repeatable)"),
+    request_remove: Optional[List[str]] = typer.Option(None, "--request-remove", help="Request header replicas never see (repeatable)"),
+    response_set: Optional[List[str]] = typer.Option(None, "--response-set", help="NAME=VALUE header sent to clients (repeatable)"),
+    response_remove: Optional[List[str]] = typer.Option(None, "--response-remove", help="Response header hidden from clients (repeatable)"),
+    unset: Optional[List[str]] = typer.Option(None, "--unset", help="Drop every rule for a header (repeatable)"),
+    clear: bool = typer.Option(False, "--clear", help="Remove all header rules")
+):
+    """Show or change the headers nginx adds, replaces and removes for an application."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+
+    try:
+        if clear or request_set or request_remove or response_set or response_remove or unset:
+            current = requests.get(f"{ORCHESTRY_URL}/apps/{name}/headers")
+            if current.status_code != 200:
+                helpers.fail(f" Error: {helpers.format_error(current)}", current)
+            rules = {} if clear else current.json()["headers"]
+            for direction, assignments, removed in (("request", request_set, request_remove),
+                                                    ("response", response_set, response_remove)):
+                values = {}
+                for assignment in assignments or []:
+                    if "=" not in assignment:
+                        helpers.fail(f" Error: --{direction}-set takes NAME=VALUE, got '{assignment}'",
+                                     code=helpers.EXIT_VALIDATION)
+                    header, value = assignment.split("=", 1)
+                    values[header.strip()] = value
+                dropped_here = {header.lower() for header in [*(unset or []), *(removed or []), *values]}
+                kept = rules.get(direction, {})
+                rules[direction] = {
+                    "set": {**{header: value for header, value in kept.get("set", {}).items()
+                               if header.lower() not in dropped_here}, **values},
+                    "remove": [header for header in kept.get("remove", []) if header.lower() not in dropped_here]
+                              + [*(removed or [])]
+                }
+            response = requests.put(f"{helpers.resolve_write_url(ORCHESTRY_URL)}/apps/{name}/headers", json=rules,
+                                    headers=helpers.user_headers())
+        else:
+            response = requests.get(f"{ORCHESTRY_URL}/apps/{name}/headers")
+
+        if response.status_code != 200:
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+
+        rules = response.json()["headers"]
+        if not any(rules[direction]["set"] or rules[direction]["remove"] for direction in ("request", "response")):
+            typer.echo(f" No header rules for '{name}'")
+            return
+        typer.echo(f" Header rules for '{name}':")
+        for direction, label in (("request", "Requests to replicas"), ("response", "Responses to clients")):
+            typer.echo(f"   {label}:")
+            for header, value in rules[direction]["set"].items():
+                typer.echo(f"     set    {header}: {value}")
+            for header in rules[direction]["remove"]:
+                typer.echo(f"     remove {header}")
+            if not rules[direction]["set"] and not rules[direction]["remove"]:
+                typer.echo("     unchanged")
+
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+
+@app.command()
+def maintenance(
+    action: str = typer.Argument(..., help="on, off or status"),
+    name: str = typer.Argument(..., help="App name"),
+    message: Optional[str] = typer.Option(None, "--message", "-m", help="Message shown on the built-in maintenance page (on)")
+):
+    """Answer every request to an application with its maintenance page, or route traffic to it again."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+
+    try:
+        if action in ("on", "off"):
+            response = requests.put(f"{helpers.resolve_write_url(ORCHESTRY_URL)}/apps/{name}/maintenance",
+                                    json={"enabled": action == "on", "message": message},
+                                    headers=helpers.user_headers())
+        elif action == "status":
+            response = requests.get(f"{ORCHESTRY_URL}/apps/{name}/maintenance")
+        else:
+            helpers.fail(f" Error: unknown action '{action}', use on, off or status", code=helpers.EXIT_VALIDATION)
+
+        if response.status_code != 200:
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+
+        from datetime import datetime
+        data = response.json()
+        if not data["enabled"]:
+            typer.echo(f" Maintenance mode for '{name}' is off")
+            return
+        since = datetime.fromtimestamp(data["since"]).strftime('%Y-%m-%d %H:%M:%S')
+        typer.echo(f" Maintenance mode for '{name}' is on since {since}"
+                   + (f" (by {data['requested_by']})" if data.get("requested_by") else ""))
+        typer.echo(f"   Page: {data['page']}")
+        if data.get("message"):
+            typer.echo(f"   Message: {data['message']}")
+
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+
+@app.command()
+def promote(
+    name: str,
+    from_namespace: str = typer.Option(..., "--from", help="Namespace the app is promoted from, e.g. staging"),
+    to_namespace: str = typer.Option(..., "--to", help="Namespace the app is promoted to, e.g. prod"),
+    target: Optional[str] = typer.Option(None, "--target", help="Name of the app in the target namespace (default: name with the namespace suffix swapped)"),
+    yes: bool = typer.Option(False, "--yes", "-y", help="Skip confirmation prompt"),
+    override: Optional[str] = typer.Option(None, "--override", help="Audit reason for making this change during a deployment freeze window")
+):
+    """Promote an app's current revision, with its image pinned by digest, to another namespace."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+
+    url = f"{helpers.resolve_write_url(ORCHESTRY_URL)}/apps/{name}/promote"
+    body = {
+        "from_namespace": from_namespace,
+        "to_namespace": to_namespace,
+        "target": target
+    }
+    try:
+        response = requests.post(url, json=body, headers=helpers.user_headers())
+        if response.status_code != 200:
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+
+        plan = response.json()
+        source, dest = plan["source"], plan["target"]
+        typer.echo(f" Promote {source['app']} ({source['namespace']}, revision {source['revision']})")
+        typer.echo(f"      to {dest['app']} ({dest['namespace']}, {'existing ' + str(dest['status']) if dest['exists'] else 'new app'})")
+        typer.echo(f"   Image: {plan['image']}")
+        if dest.get("image"):
+            typer.echo(f"   Replaces: {dest['image']}")
+        if dest.get("status") == "running":
+            typer.echo("   The target's containers will be restarted")
+
+        if not yes and not typer.confirm(" Proceed with the promotion?"):
+            helpers.say(" Promotion cancelled")
+            raise typer.Exit(0)
+
+        response = requests.post(url, json={**body, "revision": source["revision"], "confirm": True},
+                                 headers=helpers.user_headers(override))
+        if helpers.report_pending_approval(response):
+            return
+        if response.status_code != 200:
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+        result = response.json()
+        helpers.say(f" Promoted to {result['target']['app']} (revision {result.get('revision')})")
+
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+
+@app.command()
+def clone(
+    source: str = typer.Argument(..., help="App to copy"),
+    target: str = typer.Argument(..., help="Name of the new app"),
+    set_values: Optional[List[str]] = typer.Option(None, "--set", help="PATH=VALUE override of the copied spec, e.g. image=shop:pr-12, env.DEBUG=1 or scaling.maxReplicas=2 (repeatable)"),
+    namespace: Optional[str] = typer.Option(None, "--namespace", "-n", help="Namespace of the new app (default: the source's)"),
+    start: bool = typer.Option(False, "--start", help="Start the new app once it is registered"),
+    override: Optional[str] = typer.Option(None, "--override", help="Audit reason for making this change during a deployment freeze window")
+):
+    """Register a copy of an app under a new name, e.g. for a review environment."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+
+    overrides = {}
+    for item in set_values or []:
+        path, sep, value = item.partition("=")
+        if not sep or not path.strip():
+            helpers.fail(f" Error: --set expects PATH=VALUE, got '{item}'", code=helpers.EXIT_VALIDATION)
+        path = path.strip()
+        overrides[path] = value
+        if value and not path.startswith("env."):
+            # YAML turns 3 into a number and true into a boolean; env values stay strings
+            try:
+                overrides[path] = yaml.safe_load(value)
+            except yaml.YAMLError:
+                pass
+
+    try:
+        response = requests.post(f"{helpers.resolve_write_url(ORCHESTRY_URL)}/apps/{source}/clone",
+                                 json={"target": target, "namespace": namespace, "set": overrides, "start": start},
+                                 headers=helpers.user_headers(override))
+        if helpers.report_pending_approval(response):
+            return
+        if response.status_code != 200:
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+
+        result = response.json()
+        origin = result["source"]
+        helpers.say(f" Cloned {origin['app']} (revision {origin['revision']}) to {result['app']} "
+                    f"in namespace {result['namespace']} (revision {result.get('revision')})")
+        for warning in result.get("warnings") or []:
+            typer.echo(f" Warning: {warning}", err=True)
+        if result.get("start_error"):
+            helpers.fail(f" Error: {result['app']} was registered but did not start: {result['start_error']}")
+        if result.get("started"):
+            helpers.say(f" Started {result['app']}")
+        elif not start:
+            helpers.say(f" Start it with: orchestry up {result['app']}")
+
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+
+# Exit codes of `orchestry deploy`, for CI pipelines, next to the ones every command uses
+DEPLOY_EXIT_FAILED = helpers.EXIT_ERROR
+DEPLOY_EXIT_TIMEOUT = helpers.EXIT_TIMEOUT
+DEPLOY_EXIT_PENDING_APPROVAL = 6
+DEPLOY_EXIT_REJECTED = 7
+
+def _deploy_result(result: dict, code: int = 0):
+    """Print the deploy outcome as one JSON object and exit with code."""
+    typer.echo(json.dumps(result, indent=2))
+    raise typer.Exit(code)
+
+@app.command()
+def deploy(
+    name: str = typer.Option(..., "--app", "-a", help="App to deploy"),
+    image: str = typer.Option(..., "--image", "-i", help="New image, e.g. ghcr.io/acme/api:3f9c2e1"),
+    wait: bool = typer.Option(False, "--wait", help="Wait until every replica runs the new image and is ready"),
+    timeout: int = typer.Option(600, "--timeout", help="Seconds to wait with --wait"),
+    ready_timeout: Optional[int] = typer.Option(None, "--ready-timeout", help="Seconds each new replica may take to become ready (default: controller setting)"),
+    grace_period: Optional[int] = typer.Option(None, "--grace-period", help="Seconds replaced replicas get to exit after SIGTERM before SIGKILL (default: the app's terminationGracePeriodSeconds)"),
+    fail_if_busy: bool = typer.Option(False, "--fail-if-busy", help="Fail right away if another operation on the app is in progress instead of waiting for it"),
+    override: Optional[str] = typer.Option(None, "--override", help="Audit reason for making this change during a deployment freeze window")
+):
+    """Change only the image of an app and roll it out replica by replica. Prints one JSON
+    object; exits 0 on success, 1 on failure, 2 if the app does not exist, 3 if no leader could
+    take the change, 4 if the image was refused, 5 on timeout, 6 if approval is needed and 7 if
+    the change was rejected (freeze window, quota, or a rollout or other operation in progress)."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(DEPLOY_EXIT_FAILED)
+
+    write_url = helpers.resolve_write_url(ORCHESTRY_URL)
+    outcome = {"app": name, "image": image}
+    try:
+        response = requests.post(f"{write_url}/apps/{name}/deploy",
+                                 json={"image": image, "ready_timeout": ready_timeout, "grace_period": grace_period},
+                                 params={"lock": _lock_mode(fail_if_busy)}, headers=helpers.user_headers(override))
+        if response.status_code == 202:
+            operation = response.json().get("operation") or {}
+            _deploy_result({**outcome, "status": "pending_approval", "operation": operation.get("id"),
+                            "reason": operation.get("reason")}, DEPLOY_EXIT_PENDING_APPROVAL)
+        if response.status_code != 200:
+            try:
+                detail = response.json().get("detail", response.text)
+            except ValueError:
+                detail = response.text
+            code = DEPLOY_EXIT_REJECTED if response.status_code in (409, 423, 429) else helpers.exit_code_for(response)
+            _deploy_result({**outcome, "status": "rejected" if code == DEPLOY_EXIT_REJECTED else "failed",
+                            "http_status": response.status_code, "error": detail,
+                            "error_code": helpers.error_code(response)}, code)
+
+        result = response.json()
+        outcome.update(status=result["status"], revision=result.get("revision"), rollout=result.get("rollout"))
+        if result["status"] != "rolling_out" or not wait:
+            _deploy_result(outcome)
+
+        deadline = time.time() + timeout
+        replaced = -1
+        while time.time() < deadline:
+            time.sleep(2)
+            response = requests.get(f"{write_url}/apps/{name}/rollout", timeout=10)
+            if response.status_code != 200:
+                continue
+            progress = response.json()
+            outcome["rollout"] = progress
+            if progress.get("revision") != outcome["revision"]:
+                continue
+            if progress["replaced"] != replaced:
+                replaced = progress["replaced"]
+                helpers.say(f" {name}: {replaced}/{progress['total']} replicas on {image}", err=True)
+            if progress["state"] == "succeeded":
+                _deploy_result({**outcome, "status": "succeeded"})
+            if progress["state"] == "failed":
+                _deploy_result({**outcome, "status": "failed", "error": progress.get("error")}, DEPLOY_EXIT_FAILED)
+
+        _deploy_result({**outcome, "status": "timeout",
+                        "error": f"Rollout did not finish within {timeout}s"}, DEPLOY_EXIT_TIMEOUT)
+
+    except requests.exceptions.RequestException as e:
+        _deploy_result({**outcome, "status": "failed", "error": f"Unable to connect to API - {e}"},
+                       helpers.exit_code_for(error=e))
+
+@app.command()
+def env(
+    action: str = typer.Argument(..., help="list, set or unset"),
+    name: str = typer.Argument(..., help="App name"),
+    variables: Optional[List[str]] = typer.Argument(None, help="KEY=VALUE pairs (set) or KEY names (unset)"),
+    no_restart: bool = typer.Option(False, "--no-restart", help="Defer the change: running replicas keep their env until they are next restarted"),
+    ready_timeout: Optional[int] = typer.Option(None, "--ready-timeout", help="Seconds each restarted replica may take to become ready (default: controller setting)"),
+    grace_period: Optional[int] = typer.Option(None, "--grace-period", help="Seconds replaced replicas get to exit after SIGTERM before SIGKILL (default: the app's terminationGracePeriodSeconds)"),
+    override: Optional[str] = typer.Option(None, "--override", help="Audit reason for making this change during a deployment freeze window")
+):
+    """Show or change an app's env variables without re-registering its spec. A running
+    app's replicas are restarted one at a time unless --no-restart is given."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+
+    variables = variables or []
+    if action in ("set", "unset") and not variables:
+        helpers.fail(f" Error: '{action}' needs at least one variable", code=helpers.EXIT_VALIDATION)
+
+    try:
+        if action == "list":
+            response = requests.get(f"{ORCHESTRY_URL}/apps/{name}/env")
+        elif action in ("set", "unset"):
+            body = {"restart": not no_restart, "ready_timeout": ready_timeout, "grace_period": grace_period}
+            if action == "set":
+                body["set"] = {}
+                for item in variables:
+                    key, sep, value = item.partition("=")
+                    if not sep or not key.strip():
+                        raise ValueError(f"set expects KEY=VALUE, got '{item}'")
+                    body["set"][key.strip()] = value
+            else:
+                body["unset"] = variables
+            response = requests.post(f"{helpers.resolve_write_url(ORCHESTRY_URL)}/apps/{name}/env",
+                                     json=body, headers=helpers.user_headers(override))
+        else:
+            helpers.fail(f" Error: unknown action '{action}', use list, set or unset", code=helpers.EXIT_VALIDATION)
+
+        if response.status_code != 200:
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+
+        data = response.json()
+        if action == "list":
+            if not data["env"]:
+                typer.echo(f" {name} has no env variables")
+            for key, value in data["env"].items():
+                typer.echo(f" {key}={value if value is not None else '(valueFrom)'}")
+        elif data["status"] == "unchanged":
+            helpers.say(f" {name} already has this env (revision {data['revision']})")
+        elif data["status"] == "rolling_out":
+            helpers.say(f" Updated env of {name} (revision {data['revision']}), restarting "
+                        f"{data['rollout']['total']} replicas one at a time")
+            helpers.say(f" Follow progress with GET /apps/{name}/rollout")
+        elif data["status"] == "deferred":
+            helpers.say(f" Updated env of {name} (revision {data['revision']}); running replicas keep "
+                        "the old env until they are restarted")
+        else:
+            helpers.say(f" Updated env of {name} (revision {data['revision']}); it applies when the app is started")
+
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+    except ValueError as e:
+        helpers.fail(f" Error: {e}", error=e)
+
+@app.command()
+def toggle(
+    action: str = typer.Argument(..., help="list, set or unset"),
+    name: str = typer.Argument(..., help="App name"),
+    variables: Optional[List[str]] = typer.Argument(None, help="KEY=VALUE pairs (set) or KEY names (unset)"),
+    ready_timeout: Optional[int] = typer.Option(None, "--ready-timeout", help="Seconds each restarted replica may take to become ready (default: controller setting)"),
+    grace_period: Optional[int] = typer.Option(None, "--grace-period", help="Seconds replaced replicas get to exit after SIGTERM before SIGKILL (default: the app's terminationGracePeriodSeconds)"),
+    override: Optional[str] = typer.Option(None, "--override", help="Audit reason for making this change during a deployment freeze window")
+):
+    """Show or flip the env toggles an app's spec allows, such as LOG_LEVEL. A running
+    app's replicas are restarted one at a time."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+
+    variables = variables or []
+    if action in ("set", "unset") and not variables:
+        helpers.fail(f" Error: '{action}' needs at least one toggle", code=helpers.EXIT_VALIDATION)
+
+    try:
+        if action == "list":
+            response = requests.get(f"{ORCHESTRY_URL}/apps/{name}/toggles")
+        elif action in ("set", "unset"):
+            body = {"ready_timeout": ready_timeout, "grace_period": grace_period}
+            if action == "set":
+                body["set"] = {}
+                for item in variables:
+                    key, sep, value = item.partition("=")
+                    if not sep or not key.strip():
+                        raise ValueError(f"set expects KEY=VALUE, got '{item}'")
+                    body["set"][key.strip()] = value
+            else:
+                body["unset"] = variables
+            response = requests.post(f"{helpers.resolve_write_url(ORCHESTRY_URL)}/apps/{name}/toggles",
+                                     json=body, headers=helpers.user_headers(override))
+        else:
+            helpers.fail(f" Error: unknown action '{action}', use list, set or unset", code=helpers.EXIT_VALIDATION)
+
+        if response.status_code != 200:
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+
+        data = response.json()
+        if action == "list":
+            if not data["toggles"]:
+                typer.echo(f" {name} has no toggles")
+            for item in data["toggles"]:
+                allowed = f"  ({', '.join(item['values'])})" if item.get("values") else ""
+                typer.echo(f" {item['name']}={item['value'] if item['value'] is not None else '(unset)'}{allowed}")
+        elif data["status"] == "unchanged":
+            helpers.say(f" {name} already has these toggles (revision {data['revision']})")
+        elif data["status"] == "rolling_out":
+            helpers.say(f" Updated toggles of {name} (revision {data['revision']}), restarting "
+                        f"{data['rollout']['total']} replicas one at a time")
+            helpers.say(f" Follow progress with GET /apps/{name}/rollout")
+        else:
+            helpers.say(f" Updated toggles of {name} (revision {data['revision']}); they apply when the app is started")
+
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+    except ValueError as e:
+        helpers.fail(f" Error: {e}", error=e)
+
+@app.command()
+def shadow(
+    action: str = typer.Argument(..., help="start, status or stop"),
+    name: str = typer.Argument(..., help="App name"),
+    image: Optional[str] = typer.Option(None, "--image", "-i", help="Candidate image (start)"),
+    percent: float = typer.Option(10.0, "--percent", "-p", help="Share of requests to mirror to the shadow"),
+    replicas: int = typer.Option(1, "--replicas", "-r", help="Shadow replicas to run")
+):
+    """Mirror a share of an app's live traffic to a candidate image and compare its
+    error rate and latency with the app's before a real rollout."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+
+    write_url = helpers.resolve_write_url(ORCHESTRY_URL)
+    try:
+        if action == "start":
+            if not image:
+                helpers.fail(" Error: 'start' needs --image", code=helpers.EXIT_VALIDATION)
+            response = requests.post(f"{write_url}/apps/{name}/shadow",
+                                     json={"image": image, "percent": percent, "replicas": replicas},
+                                     headers=helpers.user_headers())
+        elif action == "status":
+            response = requests.get(f"{write_url}/apps/{name}/shadow")
+        elif action == "stop":
+            response = requests.delete(f"{write_url}/apps/{name}/shadow", headers=helpers.user_headers())
+        else:
+            helpers.fail(f" Error: unknown action '{action}', use start, status or stop", code=helpers.EXIT_VALIDATION)
+
+        if response.status_code != 200:
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+
+        data = response.json()
+        if action == "start":
+            helpers.say(f" Starting {replicas} shadow replica(s) of {name} with {image}; "
+                        f"{percent:g}% of requests will be mirrored")
+            return
+        record = data if action == "status" else data["shadow"]
+        comparison = record.get("comparison") or {}
+        if action == "stop":
+            helpers.say(f" Stopped the shadow of {name}. Verdict: {comparison.get('verdict', 'none')}")
+            return
+
+        typer.echo(f" Shadow of {name}: {record['image']} ({record['state']}"
+                   + (f" {record['percent']:g}% for {comparison['window_seconds']}s" if comparison.get("window_seconds") else "")
+                   + ")")
+        if record.get("error"):
+            typer.echo(f" Error: {record['error']}")
+        if comparison.get("primary") and comparison.get("shadow"):
+            typer.echo(f" {'':<8}{'requests':>10}{'errors':>8}{'error rate':>12}{'mean ms':>9}{'p95 ms':>8}")
+            for label, stats in (("app", comparison["primary"]), ("shadow", comparison["shadow"])):
+                rate = f"{stats['error_rate']:.2f}%" if stats.get("error_rate") is not None else "-"
+                mean = f"{stats['mean_ms']:.1f}" if stats.get("mean_ms") is not None else "-"
+                p95 = f"{stats['p95_ms']:.1f}" if stats.get("p95_ms") is not None else "-"
+                typer.echo(f" {label:<8}{stats['requests']:>10}{stats['errors']:>8}{rate:>12}{mean:>9}{p95:>8}")
+        if comparison:
+            typer.echo(f" Verdict: {comparison['verdict']}")
+            for reason in comparison.get("reasons") or []:
+                typer.echo(f"  - {reason}")
+
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+
+@app.command("app")
+def app_bundle(
+    action: str = typer.Argument(..., help="export or import"),
+    target: str = typer.Argument(..., help="App name (export) or bundle file, '-' for stdin (import)"),
+    output: Optional[str] = typer.Option(None, "--output", "-o", help="Write the bundle to this file instead of stdout (export)"),
+    override: Optional[str] = typer.Option(None, "--override", help="Audit reason for importing during a deployment freeze window")
+):
+    """Move an app between controllers: export its definition as a bundle, or import a bundle."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+
+    try:
+        if action == "export":
+            response = requests.get(f"{ORCHESTRY_URL}/apps/{target}/export")
+            if response.status_code != 200:
+                helpers.fail(f" Error: {helpers.format_error(response)}", response)
+            bundle = response.json()
+            text = json.dumps(bundle, indent=2)
+            if output:
+                with open(output, "w") as f:
+                    f.write(text + "\n")
+            else:
+                typer.echo(text)
+            helpers.say(f" Exported {target} with {len(bundle['revisions'])} revisions", err=True)
+            if bundle.get("secrets"):
+                typer.echo(f" Secrets it needs on the target controller: {', '.join(bundle['secrets'])}", err=True)
+        elif action == "import":
+            if target == "-":
+                bundle = json.load(sys.stdin)
+            else:
+                with open(target) as f:
+                    bundle = json.load(f)
+            response = requests.post(f"{helpers.resolve_write_url(ORCHESTRY_URL)}/apps/import",
+                                     json={"bundle": bundle}, headers=helpers.user_headers(override))
+            if response.status_code != 200:
+                helpers.fail(f" Error: {helpers.format_error(response)}", response)
+            res = response.json()
+            helpers.say(f" Imported {res['app']} with {res['revisions']} revisions (now at revision {res['revision']}, stopped)")
+            if res.get("missing_secrets"):
+                typer.echo(f" Warning: create these secrets before starting it: {', '.join(res['missing_secrets'])}", err=True)
+        else:
+            helpers.fail(f" Error: unknown action '{action}', use export or import", code=helpers.EXIT_VALIDATION)
+
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+    except (OSError, ValueError) as e:
+        helpers.fail(f" Error: {e}", error=e)
+
+@app.command()
+def secret(
+    action: str = typer.Argument(..., help="set, list or delete"),
+    name: Optional[str] = typer.Argument(None, help="Secret name (set, delete)"),
+    value: Optional[str] = typer.Option(None, "--value", help="Secret value (set)"),
+    from_file: Optional[str] = typer.Option(None, "--from-file", help="Read the secret value from a file, e.g. an htpasswd file (set)")
+):
+    """Manage secrets referenced by app specs. Requires ORCHESTRY_ADMIN_TOKEN."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+
+    headers = {"X-Admin-Token": os.getenv("ORCHESTRY_ADMIN_TOKEN", "")}
+    if action in ("set", "delete") and not name:
+        helpers.fail(f" Error: '{action}' needs a secret name", code=helpers.EXIT_VALIDATION)
+
+    try:
+        if action == "list":
+            response = requests.get(f"{helpers.api_url(ORCHESTRY_URL)}/secrets", headers=headers)
+        elif action == "set":
+            if from_file:
+                with open(from_file) as f:
+                    value = f.read()
+            if not value:
+                helpers.fail(" Error: provide the value with --value or --from-file", code=helpers.EXIT_VALIDATION)
+            response = requests.put(
+                f"{helpers.write_api_url(ORCHESTRY_URL)}/secrets/{name}",
+                json={"value": value}, headers=headers
+            )
+        elif action == "delete":
+            response = requests.delete(f"{helpers.write_api_url(ORCHESTRY_URL)}/secrets/{name}", headers=headers)
+        else:
+            helpers.fail(f" Error: unknown action '{action}', use set, list or delete", code=helpers.EXIT_VALIDATION)
+
+        if response.status_code != 200:
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+
+        data = response.json()
+        if action == "list":
+            if not data.get("secrets"):
+                typer.echo(" No secrets stored")
+            for item in data.get("secrets", []):
+                typer.echo(f" {item['name']}")
+        elif action == "set":
+            helpers.say(f" Secret '{name}' stored")
+            if data.get("refreshed_apps"):
+                helpers.say(f" Refreshed edge auth for: {', '.join(data['refreshed_apps'])}")
+        else:
+            helpers.say(f" Secret '{name}' deleted")
+
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+    except OSError as e:
+        helpers.fail(f" Error: {e}", error=e)
+
+# policy set options and the scaling fields they change
+POLICY_OPTIONS = {
+    "mode": "mode",
+    "min_replicas": "minReplicas",
+    "max_replicas": "maxReplicas",
+    "target_rps": "targetRPSPerReplica",
+    "max_latency": "maxP95LatencyMs",
+    "scale_out_threshold": "scaleOutThresholdPct",
+    "scale_in_threshold": "scaleInThresholdPct",
+    "window": "windowSeconds",
+    "cooldown": "cooldownSeconds",
+    "evaluation_interval": "evaluationIntervalSeconds",
+}
+
+def _policy_rows(res: dict) -> list:
+    """One table row per policy field, with where its value comes from."""
+    own, inherited = res.get("fields") or {}, set(res.get("inherited") or [])
+    return [{"field": key, "value": value,
+             "source": "app" if key in own else "namespace" if key in inherited else "default"}
+            for key, value in (res.get("policy") or {}).items()]
+
+@app.command()
+def policy(
+    action: str = typer.Argument(..., help="get or set"),
+    name: str = typer.Argument(..., help="Application name"),
+    file: Optional[str] = typer.Option(None, "--file", "-f", help="YAML/JSON policy to set; fields the options give are changed on top of it"),
+    mode: Optional[str] = typer.Option(None, "--mode", help="auto or manual"),
+    min_replicas: Optional[int] = typer.Option(None, "--min-replicas", help="Fewest replicas to scale in to"),
+    max_replicas: Optional[int] = typer.Option(None, "--max-replicas", help="Most replicas to scale out to"),
+    target_rps: Optional[int] = typer.Option(None, "--target-rps", help="Requests per second each replica should handle"),
+    max_latency: Optional[int] = typer.Option(None, "--max-latency", help="p95 latency in ms above which to scale out"),
+    scale_out_threshold: Optional[int] = typer.Option(None, "--scale-out-threshold", help="Load percent at which to add replicas"),
+    scale_in_threshold: Optional[int] = typer.Option(None, "--scale-in-threshold", help="Load percent below which to remove replicas"),
+    window: Optional[int] = typer.Option(None, "--window", help="Seconds of metrics to average"),
+    cooldown: Optional[int] = typer.Option(None, "--cooldown", help="Seconds to wait between scaling actions"),
+    evaluation_interval: Optional[int] = typer.Option(None, "--evaluation-interval", help="Seconds between autoscaler evaluations")
+):
+    """Show or change an app's scaling policy. set changes only the fields given and keeps the
+    others; with -f the file replaces the fields the app sets."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+    if action not in ("get", "set"):
+        helpers.fail(f" Error: unknown action '{action}', use get or set", code=helpers.EXIT_VALIDATION)
+    values = {"mode": mode, "min_replicas": min_replicas, "max_replicas": max_replicas, "target_rps": target_rps,
+              "max_latency": max_latency, "scale_out_threshold": scale_out_threshold,
+              "scale_in_threshold": scale_in_threshold, "window": window, "cooldown": cooldown,
+              "evaluation_interval": evaluation_interval}
+    changes = {POLICY_OPTIONS[option]: value for option, value in values.items() if value is not None}
+    if action == "set" and not changes and not file:
+        helpers.fail(" Error: give the fields to change as options or a policy file with -f",
+                     code=helpers.EXIT_VALIDATION)
+
+    try:
+        response = requests.get(f"{helpers.api_url(ORCHESTRY_URL)}/apps/{name}/policy")
+        if response.status_code == 404:
+            helpers.fail(f" App '{name}' not found", code=helpers.EXIT_NOT_FOUND)
+        if response.status_code != 200:
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+        res = response.json()
+
+        if action == "set":
+            if file:
+                fields = _load_spec(file) or {}
+                if not isinstance(fields, dict):
+                    raise ValueError(f"{file} must hold a mapping of policy fields")
+                # Accept a bare policy, {"policy": ...} or a spec's scaling section
+                fields = fields.get("policy") or fields.get("scaling") or fields
+            else:
+                fields = res.get("fields") or {}
+            response = requests.put(f"{helpers.write_api_url(ORCHESTRY_URL)}/apps/{name}/policy",
+                                    json={"policy": {**fields, **changes}}, headers=helpers.user_headers())
+            if response.status_code != 200:
+                helpers.fail(f" Error: {helpers.format_error(response)}", response)
+            res = response.json()
+            helpers.say(f" Updated the scaling policy of {name}")
+
+        helpers.emit(res, rows=_policy_rows(res), columns=["field", "value", "source"])
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+    except (OSError, ValueError) as e:
+        helpers.fail(f" Error: {e}", error=e)
+
+@app.command()
+def namespace(
+    action: str = typer.Argument(..., help="list, get, set-security or set-scaling"),
+    name: Optional[str] = typer.Argument(None, help="Namespace name (get, set-security, set-scaling)"),
+    from_file: Optional[str] = typer.Option(None, "--from-file", help="YAML/JSON security policy (set-security) or scaling defaults (set-scaling); omit to clear them")
+):
+    """Show namespaces or set a namespace's security policy or scaling defaults (set-security and
+    set-scaling require ORCHESTRY_ADMIN_TOKEN)."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+    if action in ("get", "set-security", "set-scaling") and not name:
+        helpers.fail(f" Error: '{action}' needs a namespace name", code=helpers.EXIT_VALIDATION)
+
+    try:
+        if action == "list":
+            response = requests.get(f"{ORCHESTRY_URL}/namespaces")
+        elif action == "get":
+            response = requests.get(f"{ORCHESTRY_URL}/namespaces/{name}")
+        elif action == "set-security":
+            policy = _load_spec(from_file) if from_file else {}
+            response = requests.put(
+                f"{helpers.resolve_write_url(ORCHESTRY_URL)}/namespaces/{name}/security",
+                json={"policy": policy or {}},
+                headers={"X-Admin-Token": os.getenv("ORCHESTRY_ADMIN_TOKEN", "")}
+            )
+        elif action == "set-scaling":
+            defaults = _load_spec(from_file) if from_file else {}
+            response = requests.put(
+                f"{helpers.resolve_write_url(ORCHESTRY_URL)}/namespaces/{name}/scaling",
+                json={"policy": defaults or {}},
+                headers={"X-Admin-Token": os.getenv("ORCHESTRY_ADMIN_TOKEN", "")}
+            )
+        else:
+            helpers.fail(f" Error: unknown action '{action}', use list, get, set-security or set-scaling",
+                         code=helpers.EXIT_VALIDATION)
+
+        if response.status_code != 200:
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+
+        data = response.json()
+        if action == "list":
+            for item in data.get("namespaces", []):
+                config = item.get("config") or {}
+                policies = [label for key, label in (("security", "security policy"), ("scaling", "scaling defaults"))
+                            if config.get(key)]
+                typer.echo(f" {item['name']:<24} {item['apps']:>4} app(s)  {', '.join(policies)}")
+        else:
+            typer.echo(json.dumps(data, indent=2))
+            for item in data.get("non_compliant", []):
+                typer.echo(f" Warning: {item['app']} does not satisfy the new policy: {item['error']}", err=True)
+            for item in data.get("conflicting", []):
+                typer.echo(f" Warning: {item['app']} keeps its current scaling policy: {item['error']}", err=True)
+
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+    except (OSError, ValueError) as e:
+        helpers.fail(f" Error: {e}", error=e)
+
+@app.command()
+def operations(
+    action: str = typer.Argument("list", help="list, get, approve, reject or active"),
+    operation_id: Optional[str] = typer.Argument(None, help="Operation ID (get, approve, reject)"),
+    status: Optional[str] = typer.Option("pending", "--status", help="Only list operations in this status ('all' for every status)"),
+    app_name: Optional[str] = typer.Option(None, "--app", help="Only list operations on this app (active: the app to show)")
+):
+    """List, approve or reject changes to protected apps (approve/reject require ORCHESTRY_APPROVER_TOKEN),
+    or show the operation running on an app and the ones queued behind it (active --app NAME)."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+    if action in ("get", "approve", "reject") and not operation_id:
+        helpers.fail(f" Error: '{action}' needs an operation ID", code=helpers.EXIT_VALIDATION)
+    if action == "active" and not app_name:
+        helpers.fail(" Error: 'active' needs --app", code=helpers.EXIT_VALIDATION)
+
+    try:
+        if action == "list":
+            params = {"status": None if status == "all" else status, "app_name": app_name}
+            response = requests.get(f"{ORCHESTRY_URL}/operations", params=params)
+        elif action == "get":
+            response = requests.get(f"{ORCHESTRY_URL}/operations/{operation_id}")
+        elif action == "active":
+            response = requests.get(f"{helpers.resolve_write_url(ORCHESTRY_URL)}/apps/{app_name}/operations/active")
+        elif action in ("approve", "reject"):
+            response = requests.post(
+                f"{helpers.resolve_write_url(ORCHESTRY_URL)}/operations/{operation_id}/{action}",
+                headers={"X-Approver-Token": os.getenv("ORCHESTRY_APPROVER_TOKEN", "")}
+            )
+        else:
+            helpers.fail(f" Error: unknown action '{action}', use list, get, approve, reject or active", code=helpers.EXIT_VALIDATION)
+
+        if response.status_code != 200:
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+
+        data = response.json()
+        if action == "list":
+            if not data.get("operations"):
+                typer.echo(" No operations")
+            for item in data.get("operations", []):
+                typer.echo(f" {item['id']}  {item['status']:<9} {item['action']:<9} {item['app']:<24} "
+                           f"{item['reason']} (requested by {item['requested_by']})")
+        elif action == "active":
+            active = data.get("active")
+            if not active:
+                typer.echo(f" No operation in progress on {app_name}")
+            for item in ([active] if active else []) + data.get("queued", []):
+                state = "running" if item is active else "queued"
+                typer.echo(f" {item['id']}  {state:<8} {item['operation']:<10} (requested by {item.get('requested_by') or 'orchestry'})")
+        elif action == "approve":
+            typer.echo(f" Operation {operation_id} {data['status']}")
+            typer.echo(json.dumps(data.get("result"), indent=2))
+            if data["status"] == "failed":
+                raise typer.Exit(1)
+        else:
+            typer.echo(json.dumps(data, indent=2))
+
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+
+@app.command()
+def journal(
+    app_name: Optional[str] = typer.Option(None, "--app", help="Only list operations on this app"),
+    status: Optional[str] = typer.Option(None, "--status", help="Only list operations in this status (e.g. in_progress)"),
+    steps: bool = typer.Option(False, "--steps", help="Also print the steps each operation completed")
+):
+    """List journaled scales and rollouts, which a new leader replays or rolls back after a crash."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+
+    try:
+        response = requests.get(f"{ORCHESTRY_URL}/operation-journal",
+                                params={"app_name": app_name, "status": status})
+        if response.status_code != 200:
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+
+        from datetime import datetime
+        entries = response.json().get("entries", [])
+        if not entries:
+            typer.echo(" No journaled operations")
+        for entry in entries:
+            started = datetime.fromtimestamp(entry["started_at"]).strftime("%Y-%m-%d %H:%M:%S")
+            typer.echo(f" {entry['id']}  {entry['status']:<11} {entry['operation']:<6} {entry['app']:<24} "
+                       f"{started}  {len(entry['steps'])} step(s) (requested by {entry.get('requested_by') or 'orchestry'})")
+            if steps:
+                for step in entry["steps"]:
+                    details = {key: value[:12] if isinstance(value, str) else value
+                               for key, value in step.items() if key not in ("step", "at")}
+                    typer.echo(f"     {step['step']:<19} {json.dumps(details)}")
+
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+
+@app.command()
+def quotas(
+    namespace: Optional[str] = typer.Option(None, "--namespace", "-N", help="Namespace to show quotas for (default: the app's, or default)"),
+    app_name: Optional[str] = typer.Option(None, "--app", help="Also show per-app quotas for this app")
+):
+    """Show the API request quotas that apply to you and how much of each is left."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+
+    try:
+        response = requests.get(f"{ORCHESTRY_URL}/quotas", params={"namespace": namespace, "app_name": app_name},
+                                headers=helpers.user_headers())
+        if response.status_code != 200:
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+
+        data = response.json()
+        if not data.get("quotas"):
+            typer.echo(" No API quotas apply")
+            return
+        typer.echo(f" API quotas for {data['caller']} in namespace {data['namespace']}:")
+        for quota in data["quotas"]:
+            resets_in = max(0, int(quota["resets_at"] - time.time()))
+            typer.echo(f"   {quota['action']:<9} per {quota['by']:<9} {quota['subject']:<24} "
+                       f"{quota['used']}/{quota['limit']} per {quota['window_seconds']}s (resets in {resets_in}s)")
+
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+
+@app.command()
+def freeze(reason: str = typer.Option(..., "--reason", "-r", help="Why the controller is frozen, shown in /health")):
+    """Freeze the controller for maintenance: no autoscaling, restarts or cleanup, and writes are rejected."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+
+    try:
+        response = requests.post(
+            f"{helpers.resolve_write_url(ORCHESTRY_URL)}/admin/freeze",
+            json={"reason": reason},
+            headers={"X-Admin-Token": os.getenv("ORCHESTRY_ADMIN_TOKEN", "")}
+        )
+        if response.status_code != 200:
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+        helpers.say(f" Controller frozen: {reason}")
+        helpers.say(" Run 'orchestry unfreeze' to resume automatic operations")
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+
+@app.command()
+def unfreeze():
+    """Lift a maintenance freeze."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+
+    try:
+        response = requests.delete(
+            f"{helpers.resolve_write_url(ORCHESTRY_URL)}/admin/freeze",
+            headers={"X-Admin-Token": os.getenv("ORCHESTRY_ADMIN_TOKEN", "")}
+        )
+        if response.status_code != 200:
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+        helpers.say(" Controller unfrozen, automatic operations resumed")
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+
+@app.command()
+def calendar(
+    action: str = typer.Argument("list", help="list or set"),
+    namespace: Optional[str] = typer.Option(None, "--namespace", "-N", help="Namespace whose windows to show or set (default: org-wide only)"),
+    days: int = typer.Option(14, "--days", help="How far ahead to list windows (list)"),
+    from_file: Optional[str] = typer.Option(None, "--from-file", help="YAML/JSON list of freeze windows (set); omit to clear them")
+):
+    """Show upcoming deployment freeze windows, or replace them (set requires ORCHESTRY_ADMIN_TOKEN)."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+
+    try:
+        if action == "list":
+            response = requests.get(f"{ORCHESTRY_URL}/freeze-windows", params={"namespace": namespace, "days": days})
+        elif action == "set":
+            windows = _load_spec(from_file) if from_file else []
+            if isinstance(windows, dict):
+                windows = windows.get("freezeWindows") or windows.get("windows") or []
+            path = f"/namespaces/{namespace}/freeze-windows" if namespace else "/admin/freeze-windows"
+            response = requests.put(
+                f"{helpers.resolve_write_url(ORCHESTRY_URL)}{path}",
+                json={"windows": windows},
+                headers={"X-Admin-Token": os.getenv("ORCHESTRY_ADMIN_TOKEN", "")}
+            )
+        else:
+            helpers.fail(f" Error: unknown action '{action}', use list or set", code=helpers.EXIT_VALIDATION)
+
+        if response.status_code != 200:
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+
+        data = response.json()
+        if action == "set":
+            count = len(data.get("windows") if "windows" in data else (data.get("config") or {}).get("freezeWindows") or [])
+            helpers.say(f" {count} freeze window(s) set for {namespace or 'the whole org'}")
+            return
+        if not data.get("windows"):
+            typer.echo(f" No freeze windows in the next {days} day(s)")
+            return
+        from datetime import datetime
+        for window in data["windows"]:
+            starts = datetime.fromtimestamp(window["starts_at"]).strftime("%a %Y-%m-%d %H:%M")
+            ends = datetime.fromtimestamp(window["ends_at"]).strftime("%a %Y-%m-%d %H:%M")
+            state = "ACTIVE" if window["active"] else ""
+            typer.echo(f" {starts} - {ends}  {window['scope']:<16} {window['name']:<24} {state}")
+
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+    except (OSError, ValueError) as e:
+        helpers.fail(f" Error: {e}", error=e)
+
+def _parse_set_values(values: List[str]) -> dict:
+    """--set key=value pairs as a dict."""
+    parsed = {}
+    for item in values:
+        key, sep, value = item.partition("=")
+        if not sep or not key.strip():
+            raise ValueError(f"--set expects key=value, got '{item}'")
+        parsed[key.strip()] = value
+    return parsed
+
+@app.command()
+def catalog(
+    action: str = typer.Argument("list", help="list, show, deploy, add or remove"),
+    template: Optional[str] = typer.Argument(None, help="Template name"),
+    name: Optional[str] = typer.Option(None, "--name", "-n", help="Name of the new app (deploy)"),
+    values: List[str] = typer.Option([], "--set", help="Template parameter as key=value (deploy), repeatable"),
+    namespace: Optional[str] = typer.Option(None, "--namespace", "-N", help="Namespace of the new app (deploy)"),
+    no_start: bool = typer.Option(False, "--no-start", help="Only register the app (deploy)"),
+    dry_run: bool = typer.Option(False, "--dry-run", help="Print the spec instead of deploying it (deploy)"),
+    from_file: Optional[str] = typer.Option(None, "--from-file", help="YAML/JSON template with description, parameters and spec (add)"),
+    override: Optional[str] = typer.Option(None, "--override", help="Audit reason for deploying during a deployment freeze window")
+):
+    """Launch common services from app templates (add and remove require ORCHESTRY_ADMIN_TOKEN)."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+    if action != "list" and not template:
+        helpers.fail(f" Error: catalog {action} needs a template name", code=helpers.EXIT_VALIDATION)
+
+    admin_headers = {"X-Admin-Token": os.getenv("ORCHESTRY_ADMIN_TOKEN", ""), **helpers.user_headers()}
+    try:
+        if action == "list":
+            response = requests.get(f"{ORCHESTRY_URL}/catalog")
+        elif action == "show":
+            response = requests.get(f"{ORCHESTRY_URL}/catalog/{template}")
+        elif action == "deploy":
+            if not name:
+                helpers.fail(" Error: catalog deploy needs --name", code=helpers.EXIT_VALIDATION)
+            response = requests.post(
+                f"{helpers.resolve_write_url(ORCHESTRY_URL)}/catalog/{template}/deploy",
+                json={"name": name, "namespace": namespace, "values": _parse_set_values(values),
+                      "start": not no_start, "dry_run": dry_run},
+                headers=helpers.user_headers(override)
+            )
+        elif action == "add":
+            if not from_file:
+                helpers.fail(" Error: catalog add needs --from-file", code=helpers.EXIT_VALIDATION)
+            response = requests.put(f"{helpers.resolve_write_url(ORCHESTRY_URL)}/admin/catalog/{template}",
+                                    json={"template": _load_spec(from_file)}, headers=admin_headers)
+        elif action == "remove":
+            response = requests.delete(f"{helpers.resolve_write_url(ORCHESTRY_URL)}/admin/catalog/{template}",
+                                       headers=admin_headers)
+        else:
+            helpers.fail(f" Error: unknown action '{action}', use list, show, deploy, add or remove", code=helpers.EXIT_VALIDATION)
+
+        if response.status_code != 200:
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+
+        data = response.json()
+        if action == "list":
+            for item in data["templates"]:
+                required = [key for key, parameter in item["parameters"].items() if parameter.get("required")]
+                needs = f"  (needs {', '.join(required)})" if required else ""
+                typer.echo(f" {item['name']:<16} {item['description']}{needs}")
+        elif action == "show":
+            typer.echo(f" {data['name']}: {data['description']}")
+            typer.echo(" Parameters:")
+            for key, parameter in data["parameters"].items():
+                default = "required" if parameter.get("required") else f"default: {parameter.get('default')}"
+                typer.echo(f"   {key:<20} {parameter.get('description', '')} ({default})")
+            typer.echo(yaml.safe_dump(data["spec"], sort_keys=False))
+        elif action == "deploy" and dry_run:
+            typer.echo(yaml.safe_dump(data["spec"], sort_keys=False))
+        elif action == "deploy":
+            state = f"started with {data.get('replicas')} replica(s)" if data.get("started") else "registered"
+            helpers.say(f" {data['app']} {state} from template {template} (revision {data.get('revision')})")
+            if data.get("message") and not data.get("started"):
+                typer.echo(f" {data['message']}", err=True)
+        elif action == "add":
+            helpers.say(f" Template {data['name']} saved")
+        else:
+            helpers.say(f" Template {template} removed")
+
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+    except (OSError, ValueError) as e:
+        helpers.fail(f" Error: {e}", error=e)
+
+@app.command()
+def fsck(fix: bool = typer.Option(False, "--fix", help="Apply the suggested repairs")):
+    """Check that Docker, the database, the controller's memory and nginx agree about what is running."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+
+    try:
+        response = requests.post(
+            f"{helpers.resolve_write_url(ORCHESTRY_URL)}/admin/fsck",
+            params={"fix": fix},
+            headers={"X-Admin-Token": os.getenv("ORCHESTRY_ADMIN_TOKEN", "")}
+        )
+        if response.status_code != 200:
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+
+        report = response.json()
+        checked = report["checked"]
+        typer.echo(f" Checked {checked['apps']} apps, {checked['containers']} containers, "
+                   f"{checked['instance_rows']} instance rows, {checked['tracked_instances']} tracked instances "
+                   f"and {checked['nginx_configs']} nginx configs")
+        if report["consistent"]:
+            typer.echo(" No inconsistencies found")
+            return
+        for item in report["issues"]:
+            target = item["app"] + (f" {item['container_id']}" if item.get("container_id") else "")
+            outcome = ""
+            if fix:
+                outcome = " [repaired]" if item.get("repaired") else f" [NOT repaired: {item.get('repair_error', 'failed')}]"
+            typer.echo(f" {item['type']:<27} {target:<38} {item['detail']}")
+            typer.echo(f"   -> {item['repair']}{outcome}")
+        if not fix:
+            typer.echo(f" {report['count']} issue(s) found, run 'orchestry fsck --fix' to repair them")
+            raise typer.Exit(1)
+
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+
+@app.command()
+def images(
+    action: str = typer.Argument("report", help="report or gc"),
+    dry_run: bool = typer.Option(False, "--dry-run", help="Only report what would be removed (gc)")
+):
+    """Show the latest image garbage collection report of each node, or ask every node to
+    remove unused app images now (gc, requires ORCHESTRY_ADMIN_TOKEN)."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+
+    try:
+        if action == "gc":
+            response = requests.post(
+                f"{helpers.resolve_write_url(ORCHESTRY_URL)}/admin/images/gc", json={"dry_run": dry_run},
+                headers={**helpers.user_headers(), "X-Admin-Token": os.getenv("ORCHESTRY_ADMIN_TOKEN", "")}
+            )
+        elif action == "report":
+            response = requests.get(f"{ORCHESTRY_URL}/images/gc")
+        else:
+            helpers.fail(f" Error: unknown action '{action}', use report or gc", code=helpers.EXIT_VALIDATION)
+
+        if response.status_code != 200:
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+
+        data = response.json()
+        if action == "gc":
+            helpers.say(f" Requested image GC{' (dry run)' if dry_run else ''} on every node "
+                        f"(request {data['request']['id']}); see 'orchestry images report'")
+            return
+
+        policy = data["policy"]
+        typer.echo(f" Policy: keep the last {policy['keep_revisions']} revisions per app, images younger than "
+                   f"{policy['min_age_hours']:g}h and images labelled {policy['keep_label']}; "
+                   + (f"runs every {policy['interval_seconds']}s" if policy["enabled"] else "scheduled runs off"))
+        request = data.get("request")
+        if not request:
+            typer.echo(" No collection has been requested yet")
+            return
+        typer.echo(f" Request {request['id']} ({request['reason']}{', dry run' if request.get('dry_run') else ''})")
+        for node in data["nodes"]:
+            if not node.get("current"):
+                typer.echo(f"   {node['node_id']:<24} pending")
+                continue
+            verb = "would remove" if node.get("dry_run") else "removed"
+            typer.echo(f"   {node['node_id']:<24} {verb} {len(node['removed'])} image(s), "
+                       f"{node['reclaimed_bytes'] / 1024 ** 2:.0f} MiB; kept {len(node['kept'])}, "
+                       f"{len(node['errors'])} error(s)")
+            for entry in node["removed"]:
+                typer.echo(f"     - {', '.join(entry['references'])}")
+            for entry in node["errors"]:
+                typer.echo(f"     ! {', '.join(entry['references'])}: {entry['error']}")
+
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+
+@app.command()
+def verify(
+    nginx_url: Optional[str] = typer.Option(None, "--nginx-url", help="Load balancer URL to test routing through (default: controller host on port 80)"),
+    image: str = typer.Option(DEFAULT_ECHO_IMAGE, "--image", help="Echo server image to deploy"),
+    timeout: int = typer.Option(120, "--timeout", help="Seconds to wait for each step")
+):
+    """Run an end-to-end smoke test: deploy an echo app, exercise it and tear it down."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+
+    if not nginx_url:
+        from urllib.parse import urlparse
+        nginx_url = f"http://{urlparse(ORCHESTRY_URL).hostname}"
+
+    def report(result):
+        mark = "PASS" if result.passed else "FAIL"
+        typer.echo(f" {mark}  {result.step:<10} {result.duration:6.1f}s  {result.detail}")
+
+    smoke = SmokeTest(
+        helpers.api_url(ORCHESTRY_URL),
+        helpers.write_api_url(ORCHESTRY_URL),
+        nginx_url,
+        image=image,
+        timeout=timeout,
+        on_step=report
+    )
+    helpers.say(f" Verifying orchestry at {ORCHESTRY_URL} (routing via {nginx_url}) with app '{smoke.run.app}'")
+    helpers.say("")
+
+    run = smoke.execute()
+
+    helpers.say("")
+    passed = sum(1 for r in run.results if r.passed)
+    if run.passed:
+        typer.echo(f" All {passed} checks passed")
+    else:
+        typer.echo(f" {len(run.results) - passed} of {len(run.results)} checks failed", err=True)
+        raise typer.Exit(1)
+
+@app.command()
+def cluster(
+    opts: str,
+    term: Optional[int] = typer.Option(None, "--term", help="Only show events from this election term (events)"),
+    node: Optional[str] = typer.Option(None, "--node", help="Only show events from this node (events)"),
+    event_type: Optional[str] = typer.Option(None, "--type", help="Only show events of this type, e.g. leader_elected (events)"),
+    limit: int = typer.Option(100, "--limit", "-n", help="Maximum number of events to show (events)"),
+    to: Optional[str] = typer.Option(None, "--to", help="Node to hand leadership to; defaults to the healthiest follower (transfer-leader)")
+):
+    """Get cluster information(status, leader, health, endpoints, events) or transfer leadership"""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+
+    params = {}
+    if opts == "events":
+        params = {"term": term, "node": node, "type": event_type, "limit": limit}
+
+    try:
+        if opts == "transfer-leader":
+            response = requests.post(
+                f"{helpers.resolve_write_url(ORCHESTRY_URL)}/cluster/leader/transfer",
+                params={"to": to},
+                headers={"X-Admin-Token": os.getenv("ORCHESTRY_ADMIN_TOKEN", "")},
+                timeout=60
+            )
+        else:
+            response = requests.get(f"{ORCHESTRY_URL}/cluster/{opts}", params=params)
+        if response.status_code == 404:
+            helpers.fail(f"Cluster '{opts}' not found", code=helpers.EXIT_NOT_FOUND)
+        elif response.status_code != 200:
+            helpers.fail(f"Error: {helpers.format_error(response)}", response)
+        res = response.json()
+        helpers.emit(res)
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+    except typer.Exit:
+        raise
+    except Exception as e:
+        helpers.fail(f" Error: {e}", error=e)
+
+@app.command()
+def controller(
+    action: str = typer.Argument(..., help="upgrade or status"),
+    version: Optional[str] = typer.Option(None, "--version", help="Controller version to upgrade to, e.g. v1.2.0 (upgrade)"),
+    image: Optional[str] = typer.Option(None, "--image", help="Controller image (default: the controller's ORCHESTRY_CONTROLLER_IMAGE tagged with the version)"),
+    node_timeout: int = typer.Option(180, "--node-timeout", help="Seconds each controller may take to rejoin healthy (upgrade)"),
+    no_rollback: bool = typer.Option(False, "--no-rollback", help="Leave upgraded controllers in place if a later one fails (upgrade)"),
+    wait: bool = typer.Option(True, "--wait/--no-wait", help="Follow the upgrade until it finishes (upgrade)")
+):
+    """Upgrade the controllers one by one to a new version, or show the latest upgrade.
+    Requires ORCHESTRY_ADMIN_TOKEN in the environment for upgrade."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+
+    try:
+        if action == "status":
+            response = requests.get(f"{ORCHESTRY_URL}/cluster/upgrade", timeout=10)
+            if response.status_code != 200:
+                helpers.fail(f" Error: {helpers.format_error(response)}", response)
+            typer.echo(json.dumps(response.json(), indent=2))
+            return
+        if action != "upgrade":
+            helpers.fail(f" Error: unknown action '{action}', use upgrade or status", code=helpers.EXIT_VALIDATION)
+        if not version:
+            helpers.fail(" Error: controller upgrade needs --version", code=helpers.EXIT_VALIDATION)
+
+        helpers.say(f" Pulling {image or 'the controller image'} for v{version.lstrip('v')} and starting the upgrade...")
+        response = requests.post(
+            f"{helpers.resolve_write_url(ORCHESTRY_URL)}/cluster/upgrade",
+            json={"target_version": version, "image": image, "node_timeout_seconds": node_timeout,
+                  "auto_rollback": not no_rollback},
+            headers={"X-Admin-Token": os.getenv("ORCHESTRY_ADMIN_TOKEN", "")},
+            timeout=900
+        )
+        if response.status_code != 200:
+            helpers.fail(f" Upgrade not started: {helpers.format_error(response)}", response)
+        upgrade = response.json()
+        typer.echo(f" Upgrade {upgrade['id']} to {upgrade['image']}: {' -> '.join(upgrade['plan'])}")
+        if not wait:
+            return
+        _follow_controller_upgrade(upgrade)
+
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+
+def _follow_controller_upgrade(upgrade: dict):
+    """Print each controller as it is upgraded (or rolled back) until the upgrade finishes.
+    Connection errors are expected while the controller answering is replaced."""
+    upgrade_id = upgrade["id"]
+    deadline = time.time() + upgrade["node_timeout_seconds"] * len(upgrade["plan"]) * 2 + 120
+    reported = set()
+    rolling_back = False
+    while time.time() < deadline:
+        time.sleep(5)
+        try:
+            response = requests.get(f"{ORCHESTRY_URL}/cluster/upgrade", timeout=10)
+        except requests.exceptions.RequestException:
+            continue
+        if response.status_code != 200:
+            continue
+        latest = response.json()
+        rollback = latest.get("rollback_of") == upgrade_id
+        if latest["id"] != upgrade_id and not rollback:
+            continue
+        for node in latest["completed_nodes"]:
+            if (latest["id"], node) not in reported:
+                reported.add((latest["id"], node))
+                verb = "rolled back to" if rollback else "upgraded to"
+                helpers.say(f" {node}: {verb} v{latest['target_version']}, healthy")
+
+        if rollback and latest["status"] == "completed":
+            typer.echo(f" Upgrade failed and was rolled back to v{latest['target_version']}", err=True)
+            raise typer.Exit(1)
+        if rollback and latest["status"] == "failed":
+            typer.echo(f" Upgrade failed and the rollback failed too: {latest.get('failure_reason')}", err=True)
+            raise typer.Exit(1)
+        if latest["status"] == "completed":
+            typer.echo(f" All controllers run v{latest['target_version']}")
+            return
+        if latest["status"] == "failed":
+            if latest["completed_nodes"] and latest.get("auto_rollback"):
+                if not rolling_back:
+                    helpers.say(f" Upgrade failed: {latest.get('failure_reason')}; rolling back...", err=True)
+                    rolling_back = True
+                continue
+            typer.echo(f" Upgrade failed: {latest.get('failure_reason')}", err=True)
+            raise typer.Exit(1)
+
+    helpers.fail(" Timed out following the upgrade, check 'orchestry controller status'", code=helpers.EXIT_TIMEOUT)
+
+@app.command()
+def events(
+    app_name: Optional[str] = typer.Argument(None, help="Only show events for this app"),
+    app_option: Optional[str] = typer.Option(None, "--app", help="Only show events for this app (same as the argument)"),
+    event_type: Optional[List[str]] = typer.Option(None, "--type", "-t", help="Only show events of this type, e.g. registered or scaled (repeatable or comma-separated)"),
+    since: Optional[str] = typer.Option(None, "--since", help="Only show events after this time: an age such as 30m, 2h or 7d, an ISO 8601 timestamp or Unix seconds"),
+    severity: str = typer.Option(None, "--severity", help="Minimum severity: info, warning or critical"),
+    limit: int = typer.Option(100, "--limit", help="Maximum number of events to show")
+):
+    """Get recent events, e.g. registrations, scaling and health changes"""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+    if app_name and app_option and app_name != app_option:
+        helpers.fail(" Error: give the app either as an argument or with --app", code=helpers.EXIT_VALIDATION)
+    app_name = app_name or app_option
+
+    try:
+        params = {"limit": limit}
+        if event_type:
+            params["type"] = ",".join(event_type)
+        if since:
+            params["since"] = since
+        if severity:
+            params["severity"] = severity
+        if app_name:
+            response = requests.get(f"{helpers.api_url(ORCHESTRY_URL)}/apps/{app_name}/events", params=params)
+        else:
+            response = requests.get(f"{ORCHESTRY_URL}/events", params=params)
+        if response.status_code == 404:
+            helpers.fail(f" App '{app_name}' not found", code=helpers.EXIT_NOT_FOUND)
+        if response.status_code != 200:
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+        res = response.json()
+        helpers.emit(res, rows=res.get("events", []),
+                     columns=["timestamp", "severity", "app_name", "event_type", "message"])
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+    except typer.Exit:
+        raise
+    except Exception as e:
+        helpers.fail(f" Error: {e}", error=e)
+
+SEARCH_COLUMNS = ["kind", "id", "app", "matched", "detail"]
+
+def _search_rows(res: dict) -> list:
+    """One table row per match, whatever kind it is."""
+    rows = [{"kind": "app", "id": item["name"], "app": item["name"], "matched": item["matched"],
+             "detail": item.get("image")} for item in res.get("apps", [])]
+    rows += [{"kind": "container", "id": item["container_id"][:12], "app": item["app_name"],
+              "matched": "container", "detail": f"{item['ip']}:{item['port']} {item['status']}"}
+             for item in res.get("containers", [])]
+    rows += [{"kind": "event", "id": item["id"], "app": item["app_name"], "matched": item["event_type"],
+              "detail": item["message"]} for item in res.get("events", [])]
+    return rows
+
+@app.command()
+def search(
+    query: str = typer.Argument(..., help="Text to look for: an app name, image, label value, container ID prefix, IP or event message"),
+    kind: Optional[str] = typer.Option(None, "--kind", "-k", help="Only search these kinds (comma-separated: apps, containers, events)"),
+    limit: int = typer.Option(20, "--limit", help="Maximum number of matches of each kind"),
+    event_days: int = typer.Option(7, "--event-days", help="Search events of this many past days")
+):
+    """Find apps, containers and recent events matching some text, e.g. which app owns a container."""
+    if helpers.check_service_running(ORCHESTRY_URL) == False:
+        typer.echo(" orchestry controller is not running, run 'orchestry config' to configure", err=True)
+        raise typer.Exit(1)
+
+    try:
+        params = {"q": query, "limit": limit, "event_days": event_days}
+        if kind:
+            params["kind"] = kind
+        response = requests.get(f"{ORCHESTRY_URL}/search", params=params)
+        if response.status_code != 200:
+            helpers.fail(f" Error: {helpers.format_error(response)}", response)
+        res = response.json()
+        helpers.emit(res, rows=_search_rows(res), columns=SEARCH_COLUMNS, default="table")
+    except requests.exceptions.RequestException as e:
+        helpers.fail(f" Error: Unable to connect to API - {e}", error=e)
+    except typer.Exit:
+        raise
+    except Exception as e:
+        helpers.fail(f" Error: {e}", error=e)
+
 
 if __name__ == "__main__":
     if not ORCHESTRY_URL:
@@ -0,0 +1,182 @@
+"""
+End-to-end smoke test for a running Orchestry installation.
+Deploys a tiny echo app, drives it through its lifecycle via the API,
+checks routing through nginx with real HTTP requests and cleans up.
+"""
+
+import time
+import uuid
+import requests
+from dataclasses import dataclass, field
+from typing import Callable, List, Optional
+
+DEFAULT_ECHO_IMAGE = "ealen/echo-server:0.9.2"
+ECHO_PORT = 8080
+VERIFY_HEADER = "X-Orchestry-Verify"
+
+@dataclass
+class StepResult:
+    step: str
+    passed: bool
+    duration: float
+    detail: str = ""
+
+@dataclass
+class VerifyRun:
+    app: str
+    results: List[StepResult] = field(default_factory=list)
+
+    @property
+    def passed(self) -> bool:
+        return bool(self.results) and all(r.passed for r in self.results)
+
+def echo_app_spec(app_name: str, image: str) -> dict:
+    """Spec for the built-in echo app used by verify."""
+    return {
+        "apiVersion": "v1",
+        "kind": "App",
+        "metadata": {
+            "name": app_name,
+            "labels": {"app": app_name, "managed-by": "orchestry-verify"}
+        },
+        "spec": {
+            "type": "http",
+            "image": image,
+            "ports": [{"containerPort": ECHO_PORT, "protocol": "HTTP"}],
+            "env": [{"name": "PORT", "value": str(ECHO_PORT)}],
+            "resources": {"cpu": "50m", "memory": "64Mi"}
+        },
+        "scaling": {
+            "mode": "manual",
+            "minReplicas": 1,
+            "maxReplicas": 2,
+            "targetRPSPerReplica": 50,
+            "maxP95LatencyMs": 500,
+            "scaleOutThresholdPct": 80,
+            "scaleInThresholdPct": 30
+        },
+        "healthCheck": {
+            "path": "/",
+            "port": ECHO_PORT,
+            "initialDelaySeconds": 2,
+            "periodSeconds": 2,
+            "timeoutSeconds": 2,
+            "failureThreshold": 3
+        }
+    }
+
+class SmokeTest:
+    """Runs the verify steps in order; later steps are skipped once one fails."""
+
+    def __init__(self, api_url: str, write_url: str, nginx_url: str,
+                 image: str = DEFAULT_ECHO_IMAGE, timeout: int = 120,
+                 on_step: Optional[Callable[[StepResult], None]] = None):
+        self.api_url = api_url.rstrip("/")
+        self.write_url = write_url.rstrip("/")
+        self.nginx_url = nginx_url.rstrip("/")
+        self.image = image
+        self.timeout = timeout
+        self.on_step = on_step
+        self.nonce = uuid.uuid4().hex[:8]
+        self.run = VerifyRun(app=f"orchestry-verify-{self.nonce}")
+
+    def execute(self) -> VerifyRun:
+        steps = [
+            ("register", self._register),
+            ("up", self._up),
+            ("scale", self._scale),
+            ("health", self._health),
+            ("routing", self._routing),
+            ("logs", self._logs),
+            ("down", self._down),
+        ]
+        try:
+            for name, fn in steps:
+                if not self._step(name, fn):
+                    break
+        finally:
+            self._step("cleanup", self._cleanup)
+        return self.run
+
+    def _step(self, name: str, fn: Callable[[], str]) -> bool:
+        start = time.time()
+        try:
+            detail = fn()
+            result = StepResult(name, True, time.time() - start, detail or "")
+        except Exception as e:
+            result = StepResult(name, False, time.time() - start, str(e))
+        self.run.results.append(result)
+        if self.on_step:
+            self.on_step(result)
+        return result.passed
+
+    @staticmethod
+    def _check(response: requests.Response, action: str):
+        if response.status_code != 200:
+            try:
+                detail = response.json().get("detail", response.text)
+            except Exception:
+                detail = response.text
+            raise Exception(f"{action} returned {response.status_code}: {detail}")
+        return response.json()
+
+    def _register(self) -> str:
+        spec = echo_app_spec(self.run.app, self.image)
+        self._check(requests.post(f"{self.write_url}/apps/register", json=spec, timeout=30), "register")
+        return f"registered {self.run.app} ({self.image})"
+
+    def _up(self) -> str:
+        result = self._check(requests.post(f"{self.write_url}/apps/{self.run.app}/up", timeout=self.timeout), "up")
+        return f"{result.get('replicas', 0)} replica(s) started"
+
+    def _scale(self) -> str:
+        self._check(requests.post(
+            f"{self.write_url}/apps/{self.run.app}/scale", json={"replicas": 2}, timeout=self.timeout
+        ), "scale")
+        return "scaled to 2 replicas"
+
+    def _health(self) -> str:
+        deadline = time.time() + self.timeout
+        status = {}
+        while time.time() < deadline:
+            status = self._check(requests.get(f"{self.api_url}/apps/{self.run.app}/status", timeout=10), "status")
+            if status.get("ready_replicas", 0) >= 2:
+                return f"{status['ready_replicas']}/{status.get('replicas', 0)} replicas ready"
+            time.sleep(2)
+        raise Exception(
+            f"only {status.get('ready_replicas', 0)}/{status.get('replicas', 0)} replicas ready after {self.timeout}s"
+        )
+
+    def _routing(self) -> str:
+        deadline = time.time() + self.timeout
+        last_error = "no response"
+        while time.time() < deadline:
+            try:
+                ok = 0
+                for _ in range(5):
+                    response = requests.get(
+                        f"{self.nginx_url}/verify", headers={VERIFY_HEADER: self.nonce}, timeout=5
+                    )
+                    if response.status_code == 200 and self.nonce in response.text:
+                        ok += 1
+                if ok == 5:
+                    return f"5/5 requests via {self.nginx_url} reached the echo app"
+                last_error = f"{ok}/5 requests reached the echo app"
+            except requests.exceptions.RequestException as e:
+                last_error = str(e)
+            time.sleep(2)
+        raise Exception(f"routing through {self.nginx_url} failed: {last_error}")
+
+    def _logs(self) -> str:
+        data = self._check(requests.get(f"{self.api_url}/apps/{self.run.app}/logs", params={"lines": 20}, timeout=30), "logs")
+        return f"{len(data.get('logs', []))} log line(s) from {data.get('total_containers', 0)} container(s)"
+
+    def _down(self) -> str:
+        self._check(requests.post(f"{self.write_url}/apps/{self.run.app}/down", timeout=self.timeout), "down")
+        return "stopped"
+
+    def _cleanup(self) -> str:
+        response = requests.delete(f"{self.write_url}/apps/{self.run.app}", timeout=self.timeout)
+        if response.status_code not in (200, 404):
+            self._check(response, "delete")
+        return "app removed"
@@ -8,6 +8,7 @@ Components:
 - AppManager: Container lifecycle management
 - PostgreSQL Database: High-availability persistent state management 
 - NginxManager: Nginx configuration management
+- ContainerRuntime / LoadBalancer: Docker and nginx interfaces, with in-memory fakes for tests
 - AutoScaler: Autoscaling decision engine
 - HealthChecker: Container health monitoring
 - API: FastAPI-based admin interface
@@ -15,6 +16,8 @@ Components:
 
 from .manager import AppManager, ContainerInstance
 from .nginx import DockerNginxManager, NginxManager  # NginxManager is alias for backward compatibility
+from .runtime import ContainerRuntime, FakeRuntime, configured_runtime, docker_runtime
+from .loadbalancer import LoadBalancer, FakeLoadBalancer
 from .scaler import AutoScaler, ScalingPolicy, ScalingMetrics, ScalingDecision
 from .health import HealthChecker, HealthCheckConfig, HealthStatus
 from .api import app as api_app
@@ -26,6 +29,12 @@ __all__ = [
     "ContainerInstance", 
     "DockerNginxManager",
     "NginxManager",
+    "ContainerRuntime",
+    "FakeRuntime",
+    "configured_runtime",
+    "docker_runtime",
+    "LoadBalancer",
+    "FakeLoadBalancer",
     "AutoScaler",
     "ScalingPolicy",
     "ScalingMetrics", 
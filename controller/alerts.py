@@ -0,0 +1,248 @@
+"""
+Alert notifications for Orchestry.
+Routes alerts about an app to its owning team's channel using webhooks.
+Every alert is also recorded as an event with a severity (info, warning or
+critical). A channel only receives alerts at or above its minimum severity,
+either as they happen or bundled into a daily digest of events.
+"""
+
+import os
+import json
+import time
+import hashlib
+import logging
+import threading
+import requests
+from datetime import datetime, timezone
+from typing import Dict, Optional, Any
+
+from state.db import SEVERITIES
+
+logger = logging.getLogger(__name__)
+
+# Suppress repeats of the same alert for the same app within this window
+ALERT_COOLDOWN_SECONDS = 300
+CHANNEL_MODES = ("immediate", "digest")
+# A digest lists at most this many events; the counts still cover all of them
+DIGEST_MAX_EVENTS = 200
+DIGEST_SETTING_PREFIX = "alert_digest:"
+SYSTEM_EVENT_SCOPE = "orchestry"
+
+class AlertManager:
+    """
+    Sends app alerts to webhook channels.
+
+    Routing, in order of preference:
+    - the app's own `contact` when it is a webhook URL
+    - the channel configured for the app's `team`
+    - the default channel
+    """
+
+    def __init__(self, state_store: Any = None):
+        self.state_store = state_store
+        self.default_min_severity = self._env_choice("ORCHESTRY_ALERT_MIN_SEVERITY", SEVERITIES, "info")
+        self.default_mode = self._env_choice("ORCHESTRY_ALERT_MODE", CHANNEL_MODES, "immediate")
+        self.digest_hour = int(os.getenv("ORCHESTRY_ALERT_DIGEST_HOUR", "9")) % 24
+        self.default_channel = self._channel(os.getenv("ORCHESTRY_ALERT_WEBHOOK"))
+        self.team_channels = self._load_team_channels()
+        self.timeout = float(os.getenv("ORCHESTRY_ALERT_TIMEOUT", "5"))
+        self._last_sent: Dict[str, float] = {}
+        self._next_digest_at = 0.0
+        self._lock = threading.Lock()
+
+    @staticmethod
+    def _env_choice(name: str, choices: tuple, default: str) -> str:
+        value = os.getenv(name, default).strip().lower()
+        if value not in choices:
+            logger.warning(f"{name} must be one of {', '.join(choices)}, using {default}")
+            return default
+        return value
+
+    def _channel(self, value: Any) -> Optional[Dict[str, str]]:
+        """Normalize a channel given as a webhook URL or {"url", "minSeverity", "mode"}."""
+        if not value:
+            return None
+        if isinstance(value, str):
+            value = {"url": value}
+        if not isinstance(value, dict) or not value.get("url"):
+            logger.warning(f"Ignoring alert channel without a url: {value}")
+            return None
+        min_severity = str(value.get("minSeverity", self.default_min_severity)).lower()
+        if min_severity not in SEVERITIES:
+            logger.warning(f"Unknown minSeverity '{min_severity}' for alert channel, using {self.default_min_severity}")
+            min_severity = self.default_min_severity
+        mode = str(value.get("mode", self.default_mode)).lower()
+        if mode not in CHANNEL_MODES:
+            logger.warning(f"Unknown mode '{mode}' for alert channel, using {self.default_mode}")
+            mode = self.default_mode
+        return {"url": str(value["url"]), "min_severity": min_severity, "mode": mode}
+
+    def _load_team_channels(self) -> Dict[str, Dict[str, str]]:
+        """Load team -> channel mapping from ORCHESTRY_ALERT_TEAM_CHANNELS (JSON object).
+        A channel is a webhook URL or {"url", "minSeverity", "mode"}."""
+        raw = os.getenv("ORCHESTRY_ALERT_TEAM_CHANNELS", "")
+        if not raw:
+            return {}
+        try:
+            channels = json.loads(raw)
+            if isinstance(channels, dict):
+                result = {}
+                for team, value in channels.items():
+                    channel = self._channel(value)
+                    if channel:
+                        result[str(team)] = channel
+                return result
+            logger.warning("ORCHESTRY_ALERT_TEAM_CHANNELS must be a JSON object, ignoring")
+        except Exception as e:
+            logger.warning(f"Invalid ORCHESTRY_ALERT_TEAM_CHANNELS: {e}")
+        return {}
+
+    def _route(self, team: Optional[str], contact: Optional[str]):
+        if contact and contact.startswith(("http://", "https://")):
+            return self._channel(contact), "contact"
+        if team and team in self.team_channels:
+            return self.team_channels[team], "team"
+        return self.default_channel, "default"
+
+    def resolve_route(self, app_name: str) -> Dict[str, Optional[str]]:
+        """Work out which channel alerts for an app should go to."""
+        owner = team = contact = None
+        if self.state_store:
+            app_record = self.state_store.get_app(app_name)
+            if app_record:
+                owner, team, contact = app_record.owner, app_record.team, app_record.contact
+
+        channel, route = self._route(team, contact)
+        return {
+            "app": app_name,
+            "owner": owner,
+            "team": team,
+            "contact": contact,
+            "route": route if channel else None,
+            "channel": channel["url"] if channel else None,
+            "min_severity": channel["min_severity"] if channel else None,
+            "mode": channel["mode"] if channel else None
+        }
+
+    def notify(self, app_name: str, alert_type: str, message: str,
+               details: Optional[Dict[str, Any]] = None, severity: str = "warning") -> bool:
+        """Record an alert about an app as an event and send it without blocking the caller.
+        Returns False if nothing was sent right away."""
+        key = f"{app_name}:{alert_type}"
+        now = time.time()
+        with self._lock:
+            if now - self._last_sent.get(key, 0) < ALERT_COOLDOWN_SECONDS:
+                return False
+            self._last_sent[key] = now
+
+        if self.state_store:
+            self.state_store.log_event(app_name, alert_type, details, severity=severity, message=message)
+
+        try:
+            route = self.resolve_route(app_name)
+        except Exception as e:
+            logger.error(f"Failed to resolve alert route for {app_name}: {e}")
+            return False
+
+        if not route["channel"]:
+            logger.debug(f"No alert channel configured for {app_name}, dropping {alert_type} alert")
+            return False
+        if SEVERITIES.index(severity) < SEVERITIES.index(route["min_severity"]):
+            logger.debug(f"{alert_type} alert for {app_name} is below the channel's {route['min_severity']} threshold")
+            return False
+        if route["mode"] == "digest":
+            logger.debug(f"{alert_type} alert for {app_name} will be sent in the next digest")
+            return False
+
+        payload = {
+            "app": app_name,
+            "type": alert_type,
+            "severity": severity,
+            "message": message,
+            "owner": route["owner"],
+            "team": route["team"],
+            "contact": route["contact"],
+            "details": details or {},
+            "timestamp": now
+        }
+        threading.Thread(
+            target=self._deliver, args=(route["channel"], payload), daemon=True
+        ).start()
+        return True
+
+    def _digest_due_time(self, now: float) -> float:
+        """The most recent scheduled digest time (ORCHESTRY_ALERT_DIGEST_HOUR, UTC) at or before now."""
+        due = datetime.fromtimestamp(now, timezone.utc).replace(
+            hour=self.digest_hour, minute=0, second=0, microsecond=0
+        ).timestamp()
+        return due if due <= now else due - 86400
+
+    def send_due_digests(self):
+        """Send the daily digest to every digest-mode channel that has not had today's yet.
+        Cheap to call often; the leader calls it from its monitoring loop."""
+        now = time.time()
+        if now < self._next_digest_at or not self.state_store:
+            return
+        due = self._digest_due_time(now)
+        self._next_digest_at = due + 86400
+
+        # Group apps by the digest channel their alerts are routed to
+        channels: Dict[str, Dict[str, Any]] = {}
+        if self.default_channel and self.default_channel["mode"] == "digest":
+            channels[self.default_channel["url"]] = {"channel": self.default_channel, "apps": {SYSTEM_EVENT_SCOPE}}
+        for app in self.state_store.list_apps():
+            channel, _ = self._route(app.get("team"), app.get("contact"))
+            if channel and channel["mode"] == "digest":
+                channels.setdefault(channel["url"], {"channel": channel, "apps": set()})["apps"].add(app["name"])
+
+        for url, entry in channels.items():
+            try:
+                self._send_digest(entry["channel"], entry["apps"], due, now)
+            except Exception as e:
+                logger.error(f"Failed to send alert digest: {e}")
+
+    def _send_digest(self, channel: Dict[str, str], apps: set, due: float, now: float):
+        setting_key = DIGEST_SETTING_PREFIX + hashlib.sha256(channel["url"].encode()).hexdigest()[:16]
+        last = self.state_store.get_setting(setting_key)
+        if last and last >= due:
+            return  # another controller already sent today's digest
+        since = last or due - 86400
+
+        events = [
+            event for event in self.state_store.get_events(
+                since=since, min_severity=channel["min_severity"], limit=10000
+            )
+            if event["app_name"] in apps
+        ]
+        self.state_store.save_setting(setting_key, now)
+        if not events:
+            return
+
+        counts = {severity: 0 for severity in SEVERITIES}
+        for event in events:
+            counts[event.get("severity", "info")] = counts.get(event.get("severity", "info"), 0) + 1
+        highest = max((s for s in SEVERITIES if counts[s]), key=SEVERITIES.index)
+        payload = {
+            "type": "digest",
+            "severity": highest,
+            "message": f"{len(events)} event(s) for {len(apps)} app(s) since "
+                       f"{datetime.fromtimestamp(since, timezone.utc).strftime('%Y-%m-%d %H:%M UTC')}",
+            "period": {"from": since, "to": now},
+            "counts": counts,
+            "events": events[:DIGEST_MAX_EVENTS],
+            "truncated": len(events) > DIGEST_MAX_EVENTS,
+            "timestamp": now
+        }
+        threading.Thread(target=self._deliver, args=(channel["url"], payload), daemon=True).start()
+
+    def _deliver(self, channel: str, payload: Dict[str, Any]):
+        """POST the alert payload to a webhook channel."""
+        subject = payload.get("app", "digest")
+        try:
+            response = requests.post(channel, json=payload, timeout=self.timeout)
+            if response.status_code >= 300:
+                logger.warning(f"Alert webhook for {subject} returned {response.status_code}")
+            else:
+                logger.info(f"📣 Sent {payload['type']} alert for {subject}")
+        except Exception as e:
+            logger.error(f"Failed to deliver {payload['type']} alert for {subject}: {e}")
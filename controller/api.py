@@ -1,27 +1,128 @@
+import asyncio
 import logging
+import os
+import re
+import hmac
+import json
 import time
 from typing import Optional
+from datetime import datetime, timezone
+from email.utils import format_datetime
 import docker
-from fastapi import FastAPI, HTTPException
+from fastapi import APIRouter, FastAPI, HTTPException, Header, Depends, Query, Request
+from fastapi.responses import JSONResponse, Response, StreamingResponse
+from fastapi.encoders import jsonable_encoder
+from fastapi.routing import APIRoute
+from fastapi.exceptions import RequestValidationError
+from starlette.exceptions import HTTPException as StarletteHTTPException
+from starlette.routing import Match
 from fastapi.middleware.cors import CORSMiddleware
 from functools import wraps
 from dotenv import load_dotenv
 
-from .scaler import ScalingMetrics, ScalingPolicy
+from .scaler import ScalingMetrics, SCALING_DEFAULTS, policy_from_scaling
 from controller.utils.models import (
     AppSpec,
+    RegisterBatchRequest,
+    DeregisterBatchRequest,
     ScaleRequest,
     PolicyRequest,
     SimulatedMetricsRequest,
     AppRegistrationResponse,
-    AppStatusResponse
+    AppStatusResponse,
+    ChaosKillRequest,
+    ChaosHealthFailureRequest,
+    ChaosPauseRequest,
+    UpgradeRequest,
+    CampaignRequest,
+    SecretRequest,
+    FreezeRequest,
+    ImageGCRequest,
+    NamespacePolicyRequest,
+    PromoteRequest,
+    CloneRequest,
+    DeployRequest,
+    EnvRequest,
+    TogglesRequest,
+    ImportBundleRequest,
+    ShadowRequest,
+    CatalogDeployRequest,
+    CatalogTemplateRequest,
+    AccessRulesRequest,
+    MaintenanceRequest,
+    LogSamplingRequest,
+    HeaderRulesRequest,
+    FreezeWindowsRequest,
+    V1AppRequest,
+    V1PolicyRequest
 )
 from controller.utils import lifecycle
+from controller import tracing
+from controller import promotion
+from controller import cloning
+from controller import expiry
+from controller import search
+from controller import reconciliation
+from controller import rollout
+from controller import termination
+from controller import toggles
+from controller import app_locks
+from controller import flapping
+from controller import bundles
+from controller import status_timeline
+from controller import arbiter
+from controller import cli_releases
+from controller import watch
+from controller import log_stream
+from controller.cluster import CONTROLLER_VERSION
+from controller import spec_diff
+from controller import registry_webhook
+from controller import federation as federation_module
+from controller import upgrade as upgrade_module
+from controller import approvals
+from controller import operation_journal
+from controller import errors
+from controller import public_status
+from controller import udp
+from controller import metrics_sources
+from controller import namespaces
+from controller import simulated_cluster
+from controller.simulated_cluster import SimulatedCluster
+from state.db import SEVERITIES
 
 load_dotenv()
 
 logger = logging.getLogger(__name__)
 
+# How many apps a batch request registers or deletes at once
+BATCH_CONCURRENCY = max(1, int(os.getenv("ORCHESTRY_BATCH_CONCURRENCY", "4")))
+
+# API versions served under /<version>, oldest first; the last one is current
+API_VERSIONS = ("v1",)
+API_VERSION_HEADER = "X-Orchestry-API-Version"
+VERSIONED_PATH = re.compile(r"^/(v\d+)(/|$)")
+# Unversioned paths that have moved stay as deprecated aliases of the current version until this date
+UNVERSIONED_SUNSET = os.getenv("ORCHESTRY_UNVERSIONED_API_SUNSET", "2027-06-30")
+# Paths that are never versioned: probes, public badges, registry webhooks, version discovery and docs
+UNVERSIONED_PREFIXES = ("/health", "/public/", "/integrations/", "/versions", "/docs", "/redoc", "/openapi.json")
+
+# Unversioned routes that moved under /v1 (next to the stable v1 API below). Routes not listed
+# here are only served unversioned, and are not deprecated, until they are versioned too.
+V1_MOVED_ROUTES = (
+    ("POST", "/apps/register"),
+    ("POST", "/apps/{name}/up"),
+    ("POST", "/apps/{name}/down"),
+    ("POST", "/apps/{name}/scale"),
+    ("GET", "/apps/{name}/status"),
+    ("GET", "/apps/{name}/logs"),
+    ("GET", "/apps/{name}/events"),
+    ("GET", "/apps/{name}/metrics"),
+)
+
+def _sunset_header() -> str:
+    sunset = datetime.strptime(UNVERSIONED_SUNSET, "%Y-%m-%d").replace(tzinfo=timezone.utc)
+    return format_datetime(sunset, usegmt=True)
+
 def leader_required(f):
     """Decorator to ensure only the leader can execute certain operations"""
     @wraps(f)
@@ -29,21 +130,96 @@ def leader_required(f):
         cluster_controller = get_cluster_controller()
         if cluster_controller and not cluster_controller.is_leader:
             leader_info = cluster_controller.get_leader_info()
-            if leader_info:
-                # Instead of redirecting, return 503 to let load balancer try next controller
-                raise HTTPException(
-                    status_code=503, 
-                    detail=f"Not the leader. Leader is: {leader_info.get('leader_id', 'unknown')}",
-                    headers={"X-Current-Leader": leader_info.get('leader_id', 'unknown')}
-                )
-            else:
-                raise HTTPException(
-                    status_code=503, 
-                    detail="No leader elected, cluster not ready"
-                )
+            # Instead of redirecting, return 503 to let load balancer try next controller
+            raise errors.not_leader(leader_info.get('leader_id', 'unknown') if leader_info else None)
+        freeze_state = get_freeze_state()
+        if freeze_state and not getattr(f, "allowed_when_frozen", False) and freeze_state.is_frozen():
+            raise HTTPException(
+                status_code=423,
+                detail=f"Controller is frozen for maintenance: {freeze_state.status().get('reason')}"
+            )
         return await f(*args, **kwargs)
     return decorated_function
 
+def allowed_when_frozen(f):
+    """Mark a leader-only endpoint as usable while the controller is frozen for maintenance"""
+    f.allowed_when_frozen = True
+    return f
+
+def admin_required(x_admin_token: Optional[str] = Header(None)):
+    """Dependency restricting an endpoint to callers presenting ORCHESTRY_ADMIN_TOKEN"""
+    admin_token = os.getenv("ORCHESTRY_ADMIN_TOKEN")
+    if not admin_token:
+        raise HTTPException(status_code=403, detail="Admin API disabled: ORCHESTRY_ADMIN_TOKEN is not set")
+    if not x_admin_token or not hmac.compare_digest(x_admin_token, admin_token):
+        raise HTTPException(status_code=401, detail="Invalid or missing X-Admin-Token header")
+
+def current_user(x_orchestry_user: Optional[str] = Header(None),
+                 x_approver_token: Optional[str] = Header(None)) -> str:
+    """Who is making a request: the approver owning X-Approver-Token if one is sent,
+    otherwise the self-declared X-Orchestry-User header"""
+    return approvals.approver_for_token(x_approver_token) or (x_orchestry_user or "anonymous").strip()[:255]
+
+def override_reason(x_override_reason: Optional[str] = Header(None)) -> Optional[str]:
+    """Audit reason given for making a change inside a deployment freeze window"""
+    return x_override_reason
+
+def lock_wait(lock: str = Query("queue")) -> bool:
+    """Whether a request waits for an app's running operation (lock=queue) or fails with 409 (lock=fail)"""
+    if lock not in app_locks.LOCK_MODES:
+        raise HTTPException(status_code=400, detail=f"lock must be one of: {', '.join(app_locks.LOCK_MODES)}")
+    return lock == "queue"
+
+SPEC_SOURCE_TYPES = ("file", "stdin", "url")
+
+def spec_source(source_type: Optional[str] = Query(None), source: Optional[str] = Query(None, max_length=2048),
+                source_sha256: Optional[str] = Query(None)) -> Optional[dict]:
+    """Where a registered spec was read from (source_type=file|stdin|url), as reported by the client"""
+    if source_type is None:
+        return None
+    if source_type not in SPEC_SOURCE_TYPES:
+        raise HTTPException(status_code=400, detail=f"source_type must be one of: {', '.join(SPEC_SOURCE_TYPES)}")
+    if source_sha256 is not None and not re.fullmatch(r"[0-9a-f]{64}", source_sha256):
+        raise HTTPException(status_code=400, detail="source_sha256 must be a hex SHA-256 digest")
+    return {"type": source_type, "location": source, "sha256": source_sha256}
+
+RELATIVE_TIME = re.compile(r"^(\d+)([smhdw])$")
+RELATIVE_TIME_UNITS = {"s": 1, "m": 60, "h": 3600, "d": 86400, "w": 604800}
+
+def events_since(since: Optional[str] = Query(None, max_length=64)) -> Optional[float]:
+    """Dependency parsing an event time filter: Unix seconds, an age such as 30m, 2h or 7d,
+    or an ISO 8601 timestamp (UTC unless it has an offset)"""
+    if not since:
+        return None
+    since = since.strip()
+    relative = RELATIVE_TIME.match(since)
+    if relative:
+        return time.time() - int(relative.group(1)) * RELATIVE_TIME_UNITS[relative.group(2)]
+    try:
+        return float(since)
+    except ValueError:
+        pass
+    try:
+        moment = datetime.fromisoformat(since.replace("Z", "+00:00"))
+    except ValueError:
+        raise errors.validation_failed("since must be Unix seconds, an age such as 30m, 2h or 7d, "
+                                       "or an ISO 8601 timestamp")
+    return (moment if moment.tzinfo else moment.replace(tzinfo=timezone.utc)).timestamp()
+
+def event_types(type: Optional[str] = Query(None, max_length=1024)) -> Optional[list]:
+    """Dependency parsing a comma-separated event type filter"""
+    types = [name.strip() for name in (type or "").split(",") if name.strip()]
+    return types or None
+
+def approver_required(x_approver_token: Optional[str] = Header(None)) -> str:
+    """Dependency restricting an endpoint to approvers listed in ORCHESTRY_APPROVERS; returns the approver"""
+    if not approvals.approvers():
+        raise HTTPException(status_code=403, detail="Approvals disabled: ORCHESTRY_APPROVERS is not set")
+    approver = approvals.approver_for_token(x_approver_token)
+    if not approver:
+        raise HTTPException(status_code=401, detail="Invalid or missing X-Approver-Token header")
+    return approver
+
 # FastAPI app
 app = FastAPI(
     title="Orchestry Controller API",
@@ -59,6 +235,89 @@ app.add_middleware(
     allow_headers=["*"],
 )
 
+@app.middleware("http")
+async def request_id_middleware(request: Request, call_next):
+    """Tag each request with an X-Request-ID so controller logs can be correlated with nginx access logs."""
+    request_id = tracing.resolve_request_id(request.headers.get(tracing.REQUEST_ID_HEADER))
+    token = tracing.set_request_id(request_id)
+    try:
+        response = await call_next(request)
+    finally:
+        tracing.reset_request_id(token)
+    response.headers[tracing.REQUEST_ID_HEADER] = request_id
+    return response
+
+@app.middleware("http")
+async def simulated_node_middleware(request: Request, call_next):
+    """In simulated cluster mode, serve each request as the node listening on the port it came in on."""
+    cluster = get_cluster_controller()
+    if not isinstance(cluster, SimulatedCluster):
+        return await call_next(request)
+    server = request.scope.get("server")
+    node = cluster.node_for_port(server[1] if server else None)
+    token = simulated_cluster.bind(node)
+    try:
+        response = await call_next(request)
+    finally:
+        simulated_cluster.reset(token)
+    if node:
+        response.headers[simulated_cluster.NODE_HEADER] = node.node_id
+    return response
+
+@app.middleware("http")
+async def api_version_middleware(request: Request, call_next):
+    """Mark unversioned paths that have a versioned successor as deprecated aliases of it. A
+    client can pick the version of an unversioned path with the X-Orchestry-API-Version header
+    instead; paths that version does not serve are served unversioned."""
+    path = request.scope["path"]
+    versioned = VERSIONED_PATH.match(path)
+    if versioned or path.startswith(UNVERSIONED_PREFIXES):
+        response = await call_next(request)
+        if versioned:
+            response.headers[API_VERSION_HEADER] = versioned.group(1)
+        return response
+
+    requested = request.headers.get(API_VERSION_HEADER)
+    if requested:
+        version = requested if requested.startswith("v") else f"v{requested}"
+        if version not in API_VERSIONS:
+            message = f"API version {requested} is not supported (supported: {', '.join(API_VERSIONS)})"
+            return JSONResponse(status_code=400,
+                                content=errors.error_body(400, errors.UNSUPPORTED_API_VERSION, message))
+        if not _has_successor(request.scope, version):
+            return await call_next(request)
+        request.scope["path"] = f"/{version}{path}"
+        response = await call_next(request)
+        response.headers[API_VERSION_HEADER] = version
+        return response
+
+    if not _has_successor(request.scope, API_VERSIONS[-1]):
+        return await call_next(request)
+    response = await call_next(request)
+    response.headers["Deprecation"] = "true"
+    response.headers["Sunset"] = _sunset_header()
+    response.headers["Link"] = f'</{API_VERSIONS[-1]}{path}>; rel="successor-version"'
+    return response
+
+@app.exception_handler(StarletteHTTPException)
+async def http_error_handler(request: Request, exc: StarletteHTTPException):
+    """Give every error response a stable code next to its message (see controller/errors.py)."""
+    body = errors.error_body(exc.status_code, errors.error_code(exc), exc.detail, getattr(exc, "details", None))
+    return JSONResponse(status_code=exc.status_code, content=body, headers=getattr(exc, "headers", None))
+
+@app.exception_handler(RequestValidationError)
+async def validation_error_handler(request: Request, exc: RequestValidationError):
+    """Request bodies that do not match their model fail with VALIDATION_FAILED. `detail`
+    stays FastAPI's list of problems; the message joins them into one line."""
+    problems = jsonable_encoder(exc.errors())
+    message = "; ".join(
+        f"{'.'.join(str(part) for part in problem['loc'] if part != 'body')}: {problem['msg']}"
+        for problem in problems
+    )
+    body = errors.error_body(422, errors.VALIDATION_FAILED, message, problems)
+    body["detail"] = problems
+    return JSONResponse(status_code=422, content=body)
+
 @app.on_event("startup")
 async def startup_event():
     """Initialize all components when the API starts."""
@@ -87,109 +346,474 @@ def get_health_checker():
 def get_cluster_controller():
     return lifecycle.get_cluster_controller()
 
+def get_cost_estimator():
+    return lifecycle.get_cost_estimator()
+
+def get_chaos_monkey():
+    return lifecycle.get_chaos_monkey()
+
+def get_upgrade_coordinator():
+    return lifecycle.get_upgrade_coordinator()
+
+def get_secret_store():
+    return lifecycle.get_secret_store()
+
+def get_freeze_state():
+    return lifecycle.get_freeze_state()
+
+def get_change_calendar():
+    return lifecycle.get_change_calendar()
+
+def get_catalog():
+    return lifecycle.get_catalog()
+
+def get_federation():
+    return lifecycle.get_federation()
+
+def get_dns_steering():
+    return lifecycle.get_dns_steering()
+
+def get_approval_manager():
+    return lifecycle.get_approval_manager()
+
+def get_quota_manager():
+    return lifecycle.get_quota_manager()
+
+def get_consistency_checker():
+    return lifecycle.get_consistency_checker()
+
+def get_health_shards():
+    return lifecycle.get_health_shards()
+
+def get_image_prepuller():
+    return lifecycle.get_image_prepuller()
+
+def get_image_gc():
+    return lifecycle.get_image_gc()
+
+def get_disk_monitor():
+    return lifecycle.get_disk_monitor()
+
+def get_watch_hub():
+    return lifecycle.get_watch_hub()
+
+def _resource_version() -> Optional[int]:
+    """The resource version a list is current at, to watch from (None before the watch hub starts)."""
+    hub = get_watch_hub()
+    return hub.latest_resource_version() if hub else None
+
+
+def _register_spec(spec_dict: dict, source: Optional[dict] = None) -> dict:
+    """Register one app and set up its default scaling policy. Returns {"error": ...} on failure."""
+    # Get app name from metadata
+    app_name = spec_dict.get("metadata", {}).get("name")
+    if not app_name:
+        return {"error": "App name is required in metadata"}
+
+    result = get_app_manager().register(spec_dict, source)
+    if "error" in result:
+        return result
+
+    # Set up the scaling policy from the scaling section and the namespace's defaults
+    get_auto_scaler().set_policy(app_name, get_app_manager().scaling_policy(app_name, spec_dict.get("scaling")))
+
+    # Have every node pull the image now rather than when the app first scales out there
+    if get_image_prepuller():
+        get_image_prepuller().request(spec_dict.get("spec", {}).get("image"),
+                                      "updated" if (result.get("revision") or 1) > 1 else "registered")
+
+    # Log event
+    get_state_store().log_event(app_name, "registered", {"spec": spec_dict.get("spec", {})})
+
+    response = {
+        "status": "registered",
+        "app": app_name,
+        "revision": result.get("revision"),
+        "message": "Application registered successfully"
+    }
+    if result.get("warnings"):
+        response["warnings"] = result["warnings"]
+    return response
+
+def _delete_app(name: str, grace_period: Optional[int] = None, wait: bool = True,
+                requested_by: Optional[str] = None, purge: bool = False) -> dict:
+    """Delete one app and record the event. Returns {"error": ...} on failure."""
+    result = get_app_manager().delete(name, grace_period, purge=purge, wait=wait, requested_by=requested_by)
+    if "error" not in result:
+        get_state_store().log_event(name, "deleted", result)
+    return result
+
+def _stop_app(name: str, grace_period: Optional[int] = None, wait: bool = True,
+              requested_by: Optional[str] = None) -> dict:
+    """Stop one app and record the event. Returns {"error": ...} on failure."""
+    result = get_app_manager().stop(name, grace_period, wait=wait, requested_by=requested_by)
+    if "error" not in result:
+        get_state_store().log_event(name, "stopped", result)
+    return result
+
+def _archive_app(name: str, grace_period: Optional[int] = None, wait: bool = True,
+                 requested_by: Optional[str] = None) -> dict:
+    """Archive one app and record the event. Returns {"error": ...} on failure."""
+    result = get_app_manager().archive(name, grace_period, wait=wait, requested_by=requested_by)
+    if "error" not in result:
+        get_state_store().log_event(name, "archived", {**result, "requested_by": requested_by})
+    return result
+
+def _scale_app(name: str, replicas: int, grace_period: Optional[int] = None, wait: bool = True,
+               requested_by: Optional[str] = None) -> dict:
+    """Scale one app and record the scaling action. Returns {"error": ...} on failure."""
+    current_replicas = len(get_app_manager().instances.get(name, []))
+    result = get_app_manager().scale(name, replicas, grace_period=grace_period, wait=wait, requested_by=requested_by)
+    if "error" in result:
+        return result
+
+    get_state_store().log_scaling_action(
+        name, current_replicas, replicas,
+        "Manual scaling", ["manual"]
+    )
+    get_state_store().log_event(name, "manual_scale", {
+        "old_replicas": current_replicas,
+        "new_replicas": replicas
+    })
+    return result
+
+def _app_namespace(name: Optional[str]) -> str:
+    record = get_state_store().get_app(name) if name else None
+    return record.namespace if record else "default"
+
+def _quota_error(action: str, user: str, name: Optional[str] = None,
+                 namespace: Optional[str] = None) -> Optional[dict]:
+    """Count a write request against the API quotas. Returns {"error", "retry_after"} if it is over budget."""
+    if namespace is None:
+        namespace = _app_namespace(name)
+    return get_quota_manager().check(action, user, namespace, name)
+
+def _enforce_quota(action: str, user: str, name: Optional[str] = None, namespace: Optional[str] = None):
+    """Like _quota_error, but rejects the request with 429."""
+    exceeded = _quota_error(action, user, name, namespace)
+    if exceeded:
+        raise errors.quota_exceeded(exceeded["error"], exceeded["retry_after"])
+
+def _freeze_window_error(action: str, user: str, name: Optional[str] = None, namespace: Optional[str] = None,
+                         override: Optional[str] = None) -> Optional[dict]:
+    """Check a change against the deployment freeze windows. Returns {"error", "window"} if it is frozen."""
+    calendar = get_change_calendar()
+    if not calendar:
+        return None
+    if namespace is None:
+        namespace = _app_namespace(name)
+    return calendar.check(action, namespace, name, user, override)
+
+def _enforce_freeze_windows(action: str, user: str, name: Optional[str] = None, namespace: Optional[str] = None,
+                            override: Optional[str] = None):
+    """Like _freeze_window_error, but rejects the request with 423."""
+    frozen = _freeze_window_error(action, user, name, namespace, override)
+    if frozen:
+        raise HTTPException(status_code=423, detail=frozen["error"])
+
+def _approval_gate(name: str, action: str, params: dict, requested_by: str) -> Optional[dict]:
+    """If name is a protected app and action needs a second approval, record a pending
+    operation and return the response for it. Returns None if the action can go ahead."""
+    record = get_state_store().get_app(name)
+    if not record:
+        return None
+    reason = approvals.approval_reason(record.spec, action, params)
+    if not reason:
+        return None
+    operation = get_approval_manager().create(name, action, params, requested_by, reason)
+    if "error" in operation:
+        return operation
+    return {
+        "status": "pending_approval",
+        "app": name,
+        "operation": {key: value for key, value in operation.items() if key != "params"},
+        "message": f"{name} is protected: {reason} needs approval (POST /operations/{operation['id']}/approve)"
+    }
+
+def _pending_response(gate: dict):
+    if "error" in gate:
+        raise HTTPException(status_code=500, detail=gate["error"])
+    return JSONResponse(status_code=202, content=gate)
+
+def _execute_operation(operation: dict) -> dict:
+    """Run an approved operation."""
+    name, params = operation["app"], operation["params"]
+    requested_by = operation["requested_by"]
+    if operation["action"] == "scale":
+        return _scale_app(name, params["replicas"], params.get("grace_period"), requested_by=requested_by)
+    if operation["action"] == "down":
+        return _stop_app(name, params.get("grace_period"), requested_by=requested_by)
+    if operation["action"] == "delete":
+        return _delete_app(name, params.get("grace_period"), requested_by=requested_by,
+                           purge=params.get("purge", False))
+    if operation["action"] == "archive":
+        return _archive_app(name, params.get("grace_period"), requested_by=requested_by)
+    if operation["action"] == "register":
+        return _register_spec(params["spec"], params.get("source"))
+    if operation["action"] == "promote":
+        return _apply_promotion(params["source_app"], params["plan"], operation["requested_by"])
+    if operation["action"] == "deploy":
+        return _deploy_image(name, params["spec"], operation["requested_by"], params.get("ready_timeout"),
+                             params.get("grace_period"))
+    return {"error": f"Unknown operation {operation['action']}"}
+
+async def _run_batch(items: list, action) -> list:
+    """Run a blocking per-app action for every item, at most BATCH_CONCURRENCY at a time."""
+    semaphore = asyncio.Semaphore(BATCH_CONCURRENCY)
+
+    async def run_one(item):
+        async with semaphore:
+            try:
+                return await asyncio.to_thread(action, item)
+            except Exception as e:
+                return {"error": str(e)}
+
+    return await asyncio.gather(*(run_one(item) for item in items))
+
+def _batch_response(names: list, results: list, done_status: str) -> dict:
+    items = []
+    for name, result in zip(names, results):
+        if "error" in result:
+            items.append({"app": name, "status": "failed", "error": result["error"]})
+        elif result.get("status") == "pending_approval":
+            items.append({"app": name, "status": "pending_approval", "operation": result["operation"]["id"],
+                          "message": result.get("message")})
+        else:
+            item = {"app": name, "status": done_status, "message": result.get("message")}
+            if result.get("warnings"):
+                item["warnings"] = result["warnings"]
+            items.append(item)
+    failed = sum(1 for item in items if item["status"] == "failed")
+    pending = sum(1 for item in items if item["status"] == "pending_approval")
+    return {
+        "results": items,
+        "succeeded": len(items) - failed - pending,
+        "failed": failed,
+        "pending_approval": pending
+    }
 
 @app.post("/apps/register", response_model=AppRegistrationResponse)
 @leader_required
-async def register_app(app_spec: AppSpec):
+async def register_app(app_spec: AppSpec, user: str = Depends(current_user),
+                       override: Optional[str] = Depends(override_reason),
+                       read_from: Optional[dict] = Depends(spec_source)):
     """Register a new application."""
     try:
         # Convert AppSpec to dict for manager
         spec_dict = app_spec.dict() if hasattr(app_spec, 'dict') else app_spec
-        result = get_app_manager().register(spec_dict)
-        
+        metadata = spec_dict.get("metadata", {})
+        _enforce_quota("register", user, metadata.get("name"), metadata.get("namespace") or "default")
+        _enforce_freeze_windows("register", user, metadata.get("name"), metadata.get("namespace") or "default", override)
+        source = {"spec_source": read_from, "requested_by": user} if read_from else None
+        gate = _approval_gate(metadata.get("name"), "register", {"spec": spec_dict, "source": source}, user)
+        if gate:
+            return _pending_response(gate)
+
+        result = _register_spec(spec_dict, source)
+
         if "error" in result:
-            raise HTTPException(status_code=400, detail=result["error"])
-        
-        # Get app name from metadata
-        app_name = spec_dict.get("metadata", {}).get("name")
-        if not app_name:
-            raise HTTPException(status_code=400, detail="App name is required in metadata")
-        
-        # Set up default scaling policy from the scaling section
-        scaling_config = spec_dict.get("scaling", {})
-        
-        policy = ScalingPolicy(
-            min_replicas=scaling_config.get("minReplicas", 1),
-            max_replicas=scaling_config.get("maxReplicas", 5),
-            target_rps_per_replica=scaling_config.get("targetRPSPerReplica", 50),
-            max_p95_latency_ms=scaling_config.get("maxP95LatencyMs", 250),
-            scale_out_threshold_pct=scaling_config.get("scaleOutThresholdPct", 80),
-            scale_in_threshold_pct=scaling_config.get("scaleInThresholdPct", 30),
-            window_seconds=scaling_config.get("windowSeconds", 60),
-            cooldown_seconds=scaling_config.get("cooldownSeconds", 300)
-        )
-        
-        get_auto_scaler().set_policy(app_name, policy)
-        
-        # Log event
-        get_state_store().log_event(app_name, "registered", {"spec": spec_dict.get("spec", {})})
-        
-        return AppRegistrationResponse(
-            status="registered",
-            app=app_name,
-            message="Application registered successfully"
-        )
-        
+            raise errors.from_result(result, 400)
+
+        return AppRegistrationResponse(**result)
+
+    except HTTPException:
+        raise
     except Exception as e:
         logger.error(f"Failed to register app: {e}")
-        raise HTTPException(status_code=500, detail=str(e))
+        raise errors.internal_error(e)
+
+@app.post("/apps/registerBatch")
+@leader_required
+async def register_apps_batch(request: RegisterBatchRequest, user: str = Depends(current_user),
+                              override: Optional[str] = Depends(override_reason)):
+    """Register many applications at once. Each app succeeds or fails on its own."""
+    specs = [app_spec.dict() for app_spec in request.apps]
+    names = [spec.get("metadata", {}).get("name") for spec in specs]
+
+    # The same name twice in one batch would race; only the first one is registered
+    seen = set()
+    to_run, duplicates = [], set()
+    for index, name in enumerate(names):
+        if name and name in seen:
+            duplicates.add(index)
+        else:
+            seen.add(name)
+            to_run.append(index)
+
+    def register_one(spec: dict) -> dict:
+        metadata = spec.get("metadata", {})
+        name = metadata.get("name")
+        namespace = metadata.get("namespace") or "default"
+        return _quota_error("register", user, name, namespace) or \
+            _freeze_window_error("register", user, name, namespace, override) or \
+            _approval_gate(name, "register", {"spec": spec}, user) or _register_spec(spec)
+
+    run_results = await _run_batch([specs[i] for i in to_run], register_one)
+    results = [{"error": f"Duplicate app name {names[i]} in batch"} for i in range(len(specs))]
+    for index, result in zip(to_run, run_results):
+        results[index] = result
+
+    response = _batch_response(names, results, "registered")
+    logger.info(f"Batch registration: {response['succeeded']} registered, {response['failed']} failed")
+    return response
+
+@app.post("/apps/deregisterBatch")
+@leader_required
+async def deregister_apps_batch(request: DeregisterBatchRequest, user: str = Depends(current_user),
+                                override: Optional[str] = Depends(override_reason)):
+    """Delete many applications at once. Each app succeeds or fails on its own."""
+    names = list(dict.fromkeys(request.names))
+    results = await _run_batch(names, lambda name: _quota_error("delete", user, name) or
+                               _freeze_window_error("delete", user, name, override=override) or
+                               _approval_gate(name, "delete", {}, user) or _delete_app(name, requested_by=user))
+    response = _batch_response(names, results, "deleted")
+    logger.info(f"Batch deletion: {response['succeeded']} deleted, {response['failed']} failed")
+    return response
 
 @app.post("/apps/{name}/up")
 @leader_required
-async def start_app(name: str):
+async def start_app(name: str, user: str = Depends(current_user), wait: bool = Depends(lock_wait)):
     """Start an application."""
     try:
-        result = get_app_manager().start(name)
+        _enforce_quota("up", user, name)
+        result = await asyncio.to_thread(get_app_manager().start, name, wait=wait, requested_by=user)
         
         if "error" in result:
-            raise HTTPException(status_code=400, detail=result["error"])
+            raise errors.from_result(result, 400)
         
         # Log event
         get_state_store().log_event(name, "started", result)
         
         return result
         
+    except HTTPException:
+        raise
     except Exception as e:
         logger.error(f"Failed to start app {name}: {e}")
-        raise HTTPException(status_code=500, detail=str(e))
+        raise errors.internal_error(e)
+
+@app.post("/apps/{name}/prepull")
+@leader_required
+async def prepull_app_image(name: str, reason: str = "manual"):
+    """Ask every controller node to pull an app's image ahead of an expected scale-out."""
+    try:
+        app_record = get_state_store().get_app(name)
+        if not app_record:
+            raise errors.app_not_found(name)
+        image = (app_record.spec or {}).get("image")
+        prepuller = get_image_prepuller()
+        if not prepuller or not prepuller.request(image, reason):
+            raise HTTPException(status_code=400, detail="Image pre-pulls are disabled")
+        return {"app": name, "image": image, "status": "requested", "reason": reason}
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to request image pre-pull for app {name}: {e}")
+        raise errors.internal_error(e)
 
 @app.post("/apps/{name}/down")
 @leader_required
-async def stop_app(name: str):
-    """Stop an application."""
+async def stop_app(name: str, user: str = Depends(current_user),
+                   override: Optional[str] = Depends(override_reason),
+                   grace_period: Optional[int] = Query(None, ge=0, le=termination.MAX_GRACE_PERIOD_SECONDS),
+                   wait: bool = Depends(lock_wait)):
+    """Stop an application. grace_period overrides the seconds replicas get to exit after SIGTERM."""
     try:
-        result = get_app_manager().stop(name)
+        _enforce_quota("down", user, name)
+        _enforce_freeze_windows("down", user, name, override=override)
+        gate = _approval_gate(name, "down", {"grace_period": grace_period}, user)
+        if gate:
+            return _pending_response(gate)
+
+        result = await asyncio.to_thread(_stop_app, name, grace_period, wait, user)
         
         if "error" in result:
-            raise HTTPException(status_code=400, detail=result["error"])
-        
-        # Log event
-        get_state_store().log_event(name, "stopped", result)
+            raise errors.from_result(result, 400)
         
         return result
         
+    except HTTPException:
+        raise
     except Exception as e:
         logger.error(f"Failed to stop app {name}: {e}")
-        raise HTTPException(status_code=500, detail=str(e))
+        raise errors.internal_error(e)
 
 @app.delete("/apps/{name}")
 @leader_required
-async def delete_app(name: str):
-    """Delete an application completely."""
+async def delete_app(name: str, user: str = Depends(current_user),
+                     override: Optional[str] = Depends(override_reason),
+                     grace_period: Optional[int] = Query(None, ge=0, le=termination.MAX_GRACE_PERIOD_SECONDS),
+                     wait: bool = Depends(lock_wait), purge: bool = False):
+    """Delete an application completely. grace_period overrides the seconds replicas get to exit after SIGTERM.
+    With purge, replicas that do not stop are killed and the app's rows are deleted in one transaction."""
     try:
-        result = get_app_manager().delete(name)
+        _enforce_quota("delete", user, name)
+        _enforce_freeze_windows("delete", user, name, override=override)
+        gate = _approval_gate(name, "delete", {"grace_period": grace_period, "purge": purge}, user)
+        if gate:
+            return _pending_response(gate)
+
+        result = await asyncio.to_thread(_delete_app, name, grace_period, wait, user, purge)
         
         if "error" in result:
-            raise HTTPException(status_code=400, detail=result["error"])
-        
-        # Log event
-        get_state_store().log_event(name, "deleted", result)
+            raise errors.from_result(result, 400)
         
         return result
         
+    except HTTPException:
+        raise
     except Exception as e:
         logger.error(f"Failed to delete app {name}: {e}")
-        raise HTTPException(status_code=500, detail=str(e))
+        raise errors.internal_error(e)
+
+@app.post("/apps/{name}/archive")
+@leader_required
+async def archive_app(name: str, user: str = Depends(current_user),
+                      override: Optional[str] = Depends(override_reason),
+                      grace_period: Optional[int] = Query(None, ge=0, le=termination.MAX_GRACE_PERIOD_SECONDS),
+                      wait: bool = Depends(lock_wait)):
+    """Decommission an application: stop its containers and remove its nginx config, but keep
+    its spec, revisions, events and scaling history so it can be restored."""
+    try:
+        _enforce_quota("archive", user, name)
+        _enforce_freeze_windows("archive", user, name, override=override)
+        gate = _approval_gate(name, "archive", {"grace_period": grace_period}, user)
+        if gate:
+            return _pending_response(gate)
+
+        result = await asyncio.to_thread(_archive_app, name, grace_period, wait, user)
+
+        if "error" in result:
+            raise errors.from_result(result, 400)
+
+        return result
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to archive app {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.post("/apps/{name}/restore")
+@leader_required
+async def restore_app(name: str, user: str = Depends(current_user), wait: bool = Depends(lock_wait)):
+    """Bring an archived application back as a stopped app."""
+    try:
+        _enforce_quota("restore", user, name)
+        result = await asyncio.to_thread(get_app_manager().restore, name, wait=wait, requested_by=user)
+
+        if "error" in result:
+            raise errors.from_result(result, 400)
+
+        get_state_store().log_event(name, "restored", {**result, "requested_by": user})
+        return result
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to restore app {name}: {e}")
+        raise errors.internal_error(e)
 
 @app.get("/apps/{name}/status", response_model=AppStatusResponse)
 async def app_status(name: str):
@@ -198,7 +822,7 @@ async def app_status(name: str):
         result = get_app_manager().status(name)
         
         if "error" in result:
-            raise HTTPException(status_code=404, detail=result["error"])
+            raise errors.from_result(result, 404)
         
         # Get app mode from database
         app_record = get_state_store().get_app(name)
@@ -206,59 +830,182 @@ async def app_status(name: str):
         
         # Add mode to the result
         result["mode"] = app_mode
+        if app_record:
+            result["owner"] = app_record.owner
+            result["team"] = app_record.team
+            result["contact"] = app_record.contact
+            result["namespace"] = app_record.namespace
+            result["expiry"] = expiry.describe((app_record.spec or {}).get("expiry"))
+            image = (app_record.spec or {}).get("image")
+            if image and get_image_prepuller():
+                result["image_prepull"] = get_image_prepuller().status(image)
         
         return AppStatusResponse(**result)
         
     except Exception as e:
         logger.error(f"Failed to get status for app {name}: {e}")
-        raise HTTPException(status_code=500, detail=str(e))
+        raise errors.internal_error(e)
+
+def _public_app(name: str):
+    """The app's record and public status, or 404 if it has not opted in."""
+    app_record = get_state_store().get_app(name)
+    if not app_record or not (app_record.spec or {}).get("publicStatus"):
+        # Apps that have not opted in look the same as apps that do not exist
+        raise HTTPException(status_code=404, detail="Not found")
+    runtime = get_app_manager().runtime_summary().get(name)
+    return app_record, public_status.public_status(app_record, runtime)
+
+def _cached_response(request: Request, body: str, media_type: str) -> Response:
+    tag = public_status.etag(body)
+    headers = {
+        "Cache-Control": f"public, max-age={public_status.PUBLIC_STATUS_MAX_AGE_SECONDS}",
+        "ETag": tag
+    }
+    if request.headers.get("if-none-match") == tag:
+        return Response(status_code=304, headers=headers)
+    return Response(content=body, media_type=media_type, headers=headers)
+
+@app.get("/public/apps/{name}/status")
+async def public_app_status(name: str, request: Request):
+    """Unauthenticated up/degraded/down status of an app that enabled publicStatus."""
+    try:
+        _, status = _public_app(name)
+        return _cached_response(request, json.dumps(status), "application/json")
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get public status for app {name}: {e}")
+        raise HTTPException(status_code=500, detail="Status unavailable")
+
+@app.get("/public/apps/{name}/badge.svg")
+async def public_app_badge(name: str, request: Request):
+    """SVG status badge of an app that enabled publicStatus."""
+    try:
+        app_record, status = _public_app(name)
+        label = app_record.spec["publicStatus"].get("label") or name
+        return _cached_response(request, public_status.render_badge(label, status["status"]), "image/svg+xml")
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to render badge for app {name}: {e}")
+        raise HTTPException(status_code=500, detail="Status unavailable")
 
 @app.post("/apps/{name}/scale")
 @leader_required
-async def scale_app(name: str, scale_request: ScaleRequest):
+async def scale_app(name: str, scale_request: ScaleRequest, user: str = Depends(current_user),
+                    wait: bool = Depends(lock_wait)):
     """Manually scale an application."""
     try:
-        result = get_app_manager().scale(name, scale_request.replicas)
+        _enforce_quota("scale", user, name)
+        gate = _approval_gate(name, "scale", {"replicas": scale_request.replicas,
+                                              "grace_period": scale_request.grace_period}, user)
+        if gate:
+            return _pending_response(gate)
+
+        result = await asyncio.to_thread(_scale_app, name, scale_request.replicas, scale_request.grace_period,
+                                         wait, user)
         
         if "error" in result:
-            raise HTTPException(status_code=400, detail=result["error"])
-        
-        # Log scaling action
-        current_replicas = len(get_app_manager().instances.get(name, []))
-        get_state_store().log_scaling_action(
-            name, current_replicas, scale_request.replicas,
-            "Manual scaling", ["manual"]
-        )
-        
-        # Log event
-        get_state_store().log_event(name, "manual_scale", {
-            "old_replicas": current_replicas,
-            "new_replicas": scale_request.replicas
-        })
+            raise errors.from_result(result, 400)
         
         return result
         
+    except HTTPException:
+        raise
     except Exception as e:
         logger.error(f"Failed to scale app {name}: {e}")
-        raise HTTPException(status_code=500, detail=str(e))
+        raise errors.internal_error(e)
+
+@app.get("/apps/{name}/scale/preview")
+async def preview_scale(name: str, replicas: int = Query(..., ge=0, le=100), user: str = Depends(current_user)):
+    """What scaling an application to `replicas` would change, without doing it: the containers
+    created and removed, the host capacity requested afterwards, the API quota left for the
+    request, whether it needs approval and whether the autoscaler would undo it."""
+    try:
+        record = get_state_store().get_app(name)
+        if not record:
+            raise errors.app_not_found(name)
+
+        changes = await asyncio.to_thread(get_app_manager().preview_scale, name, replicas)
+        if "error" in changes:
+            raise errors.from_result(changes, 400)
+
+        # Manual scaling is not arbitrated, so the preview only warns when the host would be overcommitted
+        app_spec = record.spec or {}
+        running = get_state_store().list_apps(status="running")
+        used = arbiter.usage({app["name"]: (app["spec"] or {}, len(get_app_manager().instances.get(app["name"], [])))
+                              for app in running})
+        request = arbiter.replica_request(app_spec)
+        delta = replicas - changes["current_replicas"]
+        projected = {key: round(used[key] + request[key] * delta, 3) for key in used}
+        limits = arbiter.capacity()
+
+        quota_usage = get_quota_manager().usage(user, record.namespace, name)
+        quotas = [quota for quota in quota_usage["quotas"] if quota["action"] in ("scale", "*")]
+
+        return {
+            "app": name,
+            **changes,
+            "resources": {
+                "per_replica": request,
+                "app": {key: round(value * replicas, 3) for key, value in request.items()},
+                "host_used": {key: round(value, 3) for key, value in used.items()},
+                "host_projected": projected,
+                "host_capacity": limits,
+                "exceeds_capacity": [key for key in projected if limits[key] and projected[key] > limits[key]]
+            },
+            "quota": {
+                "within_quota": all(quota["remaining"] > 0 for quota in quotas),
+                "quotas": quotas
+            },
+            "approval_required": approvals.approval_reason(app_spec, "scale", {"replicas": replicas}),
+            "autoscaler": get_auto_scaler().preview(name, replicas, record.mode)
+        }
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to preview scaling app {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/apps/{name}/policy")
+async def get_scaling_policy(name: str):
+    """Get an application's scaling policy: every field's value, and which ones the app sets
+    itself or inherits from its namespace."""
+    try:
+        record = get_state_store().get_app(name)
+        if not record:
+            raise errors.app_not_found(name)
+        return _v1_policy(record)
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get policy for app {name}: {e}")
+        raise errors.internal_error(e)
 
 @app.post("/apps/{name}/policy")
 @leader_required
-async def set_scaling_policy(name: str, policy_request: PolicyRequest):
+async def set_scaling_policy(name: str, policy_request: PolicyRequest, user: str = Depends(current_user)):
     """Update scaling policy for an application."""
     try:
-        policy_data = policy_request.policy
-        
-        policy = ScalingPolicy(
-            min_replicas=policy_data.get("minReplicas", 1),
-            max_replicas=policy_data.get("maxReplicas", 5),
-            target_rps_per_replica=policy_data.get("targetRPSPerReplica", 50),
-            max_p95_latency_ms=policy_data.get("maxP95LatencyMs", 250),
-            scale_out_threshold_pct=policy_data.get("scaleOutThresholdPct", 80),
-            scale_in_threshold_pct=policy_data.get("scaleInThresholdPct", 30),
-            window_seconds=policy_data.get("windowSeconds", 20),
-            cooldown_seconds=policy_data.get("cooldownSeconds", 30)
-        )
+        _enforce_quota("policy", user, name)
+        # Fields left out come from the namespace's scaling defaults
+        namespace_defaults = get_app_manager().namespaces.scaling_defaults(_app_namespace(name))
+        policy_data = {**namespace_defaults, **policy_request.policy}
+        # External metrics are kept unless the update replaces them
+        if "externalMetrics" in policy_data:
+            external_metrics, error = metrics_sources.validate_external_metrics(policy_data["externalMetrics"])
+            if error:
+                raise errors.validation_failed(error)
+        else:
+            current = get_auto_scaler().get_policy(name)
+            external_metrics = current.external_metrics if current else []
+
+        try:
+            policy = policy_from_scaling({**policy_request.policy, "externalMetrics": external_metrics},
+                                         namespace_defaults)
+        except ValueError as e:
+            raise errors.validation_failed(f"Invalid policy: {e}")
         
         get_auto_scaler().set_policy(name, policy)
         
@@ -267,66 +1014,1000 @@ async def set_scaling_policy(name: str, policy_request: PolicyRequest):
         
         return {"status": "updated", "app": name, "policy": policy_data}
         
+    except HTTPException:
+        raise
     except Exception as e:
         logger.error(f"Failed to update policy for app {name}: {e}")
-        raise HTTPException(status_code=500, detail=str(e))
+        raise errors.internal_error(e)
 
-@app.get("/apps")
-async def list_apps():
-    """List all registered applications."""
+@app.get("/apps/{name}/access")
+async def get_access_rules(name: str):
+    """Get the IP allow/deny lists nginx enforces for an application."""
     try:
-        apps = get_state_store().list_apps()
-        
-        # Add runtime status
-        for app in apps:
-            status_result = get_app_manager().status(app["name"])
-            app["status"] = status_result.get("status", "unknown")
-            app["replicas"] = status_result.get("replicas", 0)
-            app["ready_replicas"] = status_result.get("ready_replicas", 0)
-        
-        return {"apps": apps}
-        
+        result = get_app_manager().get_access_rules(name)
+
+        if "error" in result:
+            raise errors.from_result(result, 404)
+
+        return result
+
+    except HTTPException:
+        raise
     except Exception as e:
-        logger.error(f"Failed to list apps: {e}")
-        raise HTTPException(status_code=500, detail=str(e))
+        logger.error(f"Failed to get access rules for app {name}: {e}")
+        raise errors.internal_error(e)
 
-@app.get("/apps/{name}/raw")
-async def get_app_raw_spec(name: str):
-    """Get the raw and parsed spec for an application."""
+@app.put("/apps/{name}/access")
+@leader_required
+async def set_access_rules(name: str, request: AccessRulesRequest, user: str = Depends(current_user)):
+    """Replace the IP allow/deny lists for an application."""
     try:
-        # Get the parsed spec (normalized)
-        parsed_spec = get_state_store().get_app(name)
-        if not parsed_spec:
-            raise HTTPException(status_code=404, detail=f"App {name} not found")
-            
-        # Get the raw spec (as submitted by user)
-        raw_spec = get_state_store().get_raw_spec(name)
-        
-        return {
-            "name": name,
-            "raw": raw_spec,
-            "parsed": parsed_spec
-        }
+        if not get_state_store().get_app(name):
+            raise errors.app_not_found(name)
+        _enforce_quota("access", user, name)
+
+        result = get_app_manager().set_access_rules(name, request.allowFrom, request.denyFrom)
+
+        if "error" in result:
+            raise errors.from_result(result, 400)
+
+        return result
+
     except HTTPException:
         raise
     except Exception as e:
-        logger.error(f"Failed to get raw spec for app {name}: {e}")
-        raise HTTPException(status_code=500, detail=str(e))
+        logger.error(f"Failed to set access rules for app {name}: {e}")
+        raise errors.internal_error(e)
 
-@app.get("/apps/{name}/logs")
-async def get_app_logs(name: str, lines: int = 100):
-    """Get logs for an application."""
+@app.get("/apps/{name}/access-logs/sampling")
+async def get_log_sampling(name: str):
+    """How much of an application's traffic nginx writes to its access log."""
     try:
-        if name not in get_app_manager().instances:
-            raise HTTPException(status_code=404, detail="App not found or not running")
-        
-        app_manager = get_app_manager()
-        instances = app_manager.instances[name]
-        
-        if not instances:
-            return {
-                "app": name,
-                "logs": []
+        result = get_app_manager().get_log_sampling(name)
+
+        if "error" in result:
+            raise errors.from_result(result, 404)
+
+        return result
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get access log sampling for app {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.put("/apps/{name}/access-logs/sampling")
+@leader_required
+async def set_log_sampling(name: str, request: LogSamplingRequest, user: str = Depends(current_user)):
+    """Log every request, a sample of them, or only errors for an application."""
+    try:
+        if not get_state_store().get_app(name):
+            raise errors.app_not_found(name)
+        _enforce_quota("logging", user, name)
+
+        config = {"mode": request.mode}
+        if request.sampleRate is not None:
+            config["sampleRate"] = request.sampleRate
+        result = get_app_manager().set_log_sampling(name, config, requested_by=user)
+
+        if "error" in result:
+            raise errors.from_result(result, 400)
+
+        return result
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to set access log sampling for app {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/apps/{name}/headers")
+async def get_header_rules(name: str):
+    """Get the headers nginx adds, replaces and removes for an application."""
+    try:
+        result = get_app_manager().get_header_rules(name)
+
+        if "error" in result:
+            raise errors.from_result(result, 404)
+
+        return result
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get header rules for app {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.put("/apps/{name}/headers")
+@leader_required
+async def set_header_rules(name: str, request: HeaderRulesRequest, user: str = Depends(current_user)):
+    """Replace the headers nginx adds, replaces and removes for an application."""
+    try:
+        if not get_state_store().get_app(name):
+            raise errors.app_not_found(name)
+        _enforce_quota("headers", user, name)
+
+        config = {direction: rules for direction, rules in
+                  (("request", request.request), ("response", request.response)) if rules is not None}
+        result = get_app_manager().set_header_rules(name, config, requested_by=user)
+
+        if "error" in result:
+            raise errors.from_result(result, 400)
+
+        return result
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to set header rules for app {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/apps/{name}/maintenance")
+async def get_maintenance(name: str):
+    """Whether nginx answers an application's requests with its maintenance page."""
+    try:
+        result = get_app_manager().get_maintenance(name)
+
+        if "error" in result:
+            raise errors.from_result(result, 404)
+
+        return result
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get maintenance mode for app {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.put("/apps/{name}/maintenance")
+@leader_required
+async def set_maintenance(name: str, request: MaintenanceRequest, user: str = Depends(current_user)):
+    """Turn an application's maintenance mode on or off. Its replicas keep running."""
+    try:
+        if not get_state_store().get_app(name):
+            raise errors.app_not_found(name)
+        _enforce_quota("maintenance", user, name)
+
+        result = get_app_manager().set_maintenance(name, request.enabled, request.message, requested_by=user)
+
+        if "error" in result:
+            raise errors.from_result(result, 400)
+
+        return result
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to set maintenance mode for app {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/ports")
+async def list_host_ports(app: Optional[str] = None):
+    """Host ports assigned to app replicas on the Docker host, and nginx UDP listen ports."""
+    try:
+        allocator = get_app_manager().ports
+        assignments = allocator.assignments(app)
+        udp_ports = get_state_store().list_host_ports(udp.NGINX_HOST, app)
+        return {"host": allocator.host, "ports": assignments, "count": len(assignments), "udp_listen_ports": udp_ports}
+    except Exception as e:
+        logger.error(f"Failed to list host ports: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/capacity")
+async def get_capacity():
+    """Host capacity apps may request, what running replicas request, and the latest
+    arbitration of contended scale-outs."""
+    try:
+        running = get_state_store().list_apps(status="running")
+        used = arbiter.usage({app["name"]: (app["spec"] or {}, len(get_app_manager().instances.get(app["name"], [])))
+                              for app in running})
+        return lifecycle.get_capacity_arbiter().describe(used)
+    except Exception as e:
+        logger.error(f"Failed to get host capacity: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/apps/{name}/revisions")
+async def list_app_revisions(name: str, limit: int = 20):
+    """List the recorded spec revisions of an application, newest first."""
+    try:
+        if not get_state_store().get_app(name):
+            raise errors.app_not_found(name)
+
+        revisions = get_state_store().list_app_revisions(name, limit=max(1, min(limit, 200)))
+        return {"app": name, "revisions": revisions, "count": len(revisions)}
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to list revisions for app {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/apps/{name}/timeline")
+async def get_app_timeline(name: str, since: Optional[float] = None, limit: int = status_timeline.DEFAULT_LIMIT):
+    """An application's status transitions with their causes, oldest first. Deleted apps
+    keep their timeline."""
+    try:
+        transitions = get_app_manager().timeline.history(name, since=since, limit=limit)
+        record = get_state_store().get_app(name)
+        if not record and not transitions:
+            raise errors.app_not_found(name)
+
+        return {
+            "app": name,
+            "status": transitions[-1]["to_status"] if transitions else record.status,
+            "transitions": transitions,
+            "count": len(transitions)
+        }
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get timeline for app {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/apps/{name}/export")
+async def export_app(name: str):
+    """Export an app's definition as a bundle another controller can import: its spec
+    revisions, scaling section, access rules and the names of the secrets it needs."""
+    try:
+        bundle = bundles.build_bundle(get_state_store(), name, federation_module.CLUSTER_NAME or None)
+        if "error" in bundle:
+            raise errors.from_result(bundle, 400)
+        return bundle
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to export app {name}: {e}")
+        raise errors.internal_error(e)
+
+def _import_bundle(bundle: dict, requested_by: str) -> dict:
+    """Record a bundle's older revisions as history, register its latest one and apply its
+    stored scaling section and access rules. Returns {"error": ...} on failure."""
+    name = bundle["app"]
+    history, latest = bundles.history_and_latest(bundle)
+    for revision in history:
+        get_state_store().save_app_revision(name, revision["spec"],
+                                            bundles.import_source(bundle, revision, requested_by))
+    result = _register_spec(latest["spec"], bundles.import_source(bundle, latest, requested_by))
+    if "error" in result:
+        return result
+
+    # The stored scaling section and access rules can change without a new revision
+    record = get_state_store().get_app(name)
+    scaling = bundle.get("scaling")
+    if scaling and scaling != record.spec.get("scaling"):
+        get_auto_scaler().set_policy(name, get_app_manager().scaling_policy(name, scaling))
+        get_app_manager().set_scaling(name, scaling)
+    config = bundle.get("config") or {}
+    if any(config.get(key) != (record.spec.get(key) or []) for key in bundles.CONFIG_KEYS):
+        rules = get_app_manager().set_access_rules(name, config.get("allowFrom") or [], config.get("denyFrom") or [])
+        if "error" in rules:
+            logger.warning(f"Imported {name} without its access rules: {rules['error']}")
+
+    missing = [secret for secret in bundle.get("secrets") or [] if not get_secret_store().describe(secret)]
+    get_state_store().log_event(name, "imported", {
+        "from": bundle.get("exported_from"), "revisions": len(bundle["revisions"]),
+        "missing_secrets": missing, "requested_by": requested_by
+    })
+    return {"status": "imported", "app": name, "revision": result.get("revision"),
+            "revisions": len(bundle["revisions"]), "missing_secrets": missing}
+
+@app.post("/apps/import")
+@leader_required
+async def import_app(request: ImportBundleRequest, user: str = Depends(current_user),
+                     override: Optional[str] = Depends(override_reason)):
+    """Create an app from a bundle exported by another controller. The app is registered
+    stopped, with the bundle's revisions as its history."""
+    try:
+        bundle = request.bundle
+        bundle_error = bundles.validate_bundle(bundle)
+        if bundle_error:
+            raise HTTPException(status_code=400, detail=bundle_error)
+        name = bundle["app"]
+        if get_state_store().get_app(name):
+            raise HTTPException(status_code=409, detail=f"App {name} already exists on this controller")
+        namespace = bundle.get("namespace") or "default"
+        _enforce_quota("register", user, name, namespace)
+        _enforce_freeze_windows("register", user, name, namespace, override)
+
+        result = await asyncio.to_thread(_import_bundle, bundle, user)
+        if "error" in result:
+            raise errors.from_result(result, 400)
+        return result
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to import app bundle: {e}")
+        raise errors.internal_error(e)
+
+@app.post("/apps/{name}/diff")
+async def diff_app_spec(name: str, app_spec: AppSpec, revision: Optional[int] = None):
+    """Compare a spec with the app's latest (or the given) revision. Both are normalized
+    first, so only changes that registering the spec would make are listed."""
+    try:
+        spec_dict = app_spec.dict()
+        if spec_dict.get("metadata", {}).get("name") != name:
+            raise HTTPException(status_code=400, detail=f"The spec is for {spec_dict.get('metadata', {}).get('name')}, not {name}")
+        deployed = get_state_store().get_app_revision(name, revision)
+        if not deployed:
+            if revision is not None and get_state_store().get_app(name):
+                raise HTTPException(status_code=404, detail=f"App {name} has no revision {revision}")
+            raise errors.app_not_found(name)
+
+        changes = spec_diff.diff(deployed["spec"], spec_dict)
+        return {"app": name, "revision": deployed["revision"], "identical": not changes,
+                "changes": changes, "count": len(changes)}
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to diff spec of app {name}: {e}")
+        raise errors.internal_error(e)
+
+def _register_in_place(spec_dict: dict, source: Optional[dict] = None, wait: bool = True) -> dict:
+    """Register a spec over an existing app, restarting it if it was running. The result
+    says whether it was restarted."""
+    # Re-registering resets the app's replicas, so stop it first and bring it back after
+    name = spec_dict.get("metadata", {}).get("name")
+    with get_app_manager().app_operation(name, "register", (source or {}).get("requested_by"), wait) as busy:
+        if busy:
+            return busy
+        existing = get_state_store().get_app(name) if name else None
+        was_running = bool(existing and existing.status == "running")
+        if was_running:
+            get_app_manager().stop(name)
+
+        result = _register_spec(spec_dict, source)
+        if "error" in result:
+            return result
+
+        if was_running:
+            started = get_app_manager().start(name)
+            if "error" in started:
+                logger.error(f"Registered {name} but failed to restart it: {started['error']}")
+    return {**result, "restarted": was_running}
+
+@app.post("/apps/{name}/apply")
+@leader_required
+async def apply_app_spec(name: str, app_spec: AppSpec, up: bool = False, user: str = Depends(current_user),
+                         override: Optional[str] = Depends(override_reason),
+                         read_from: Optional[dict] = Depends(spec_source)):
+    """Make the app match a spec: register it if it does not exist, register the spec over it
+    (restarting it if it runs) if it differs from the latest revision, and leave it alone
+    otherwise. With up=true the app is also started if it is not running."""
+    try:
+        spec_dict = app_spec.dict()
+        metadata = spec_dict.get("metadata", {})
+        if metadata.get("name") != name:
+            raise HTTPException(status_code=400, detail=f"The spec is for {metadata.get('name')}, not {name}")
+        namespace = metadata.get("namespace") or "default"
+
+        existing = get_state_store().get_app(name)
+        deployed = get_state_store().get_app_revision(name) if existing else None
+        changes = spec_diff.diff(deployed["spec"], spec_dict) if deployed else None
+        response = {"app": name, "action": "unchanged", "revision": deployed["revision"] if deployed else None,
+                    "changes": changes or [], "restarted": False, "started": False}
+
+        if not deployed or changes:
+            _enforce_quota("register", user, name, namespace)
+            _enforce_freeze_windows("register", user, name, namespace, override)
+            source = {"spec_source": read_from, "requested_by": user} if read_from else {"requested_by": user}
+            gate = _approval_gate(name, "register", {"spec": spec_dict, "source": source}, user)
+            if gate:
+                return _pending_response(gate)
+            if existing:
+                result = await asyncio.to_thread(_register_in_place, spec_dict, source)
+            else:
+                result = await asyncio.to_thread(_register_spec, spec_dict, source)
+            if "error" in result:
+                raise errors.from_result(result, 400)
+            response.update(action="updated" if existing else "created", revision=result.get("revision"),
+                            restarted=result.get("restarted", False))
+            if result.get("warnings"):
+                response["warnings"] = result["warnings"]
+
+        record = get_state_store().get_app(name)
+        if up and not response["restarted"] and record and record.status != "running":
+            _enforce_quota("up", user, name)
+            started = await asyncio.to_thread(get_app_manager().start, name, requested_by=user)
+            if "error" in started:
+                raise errors.from_result(started, 400)
+            get_state_store().log_event(name, "started", started)
+            response["started"] = True
+
+        logger.info(f"Applied spec of {name}: {response['action']}{', started' if response['started'] else ''}")
+        return response
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to apply spec of app {name}: {e}")
+        raise errors.internal_error(e)
+
+def _apply_promotion(name: str, plan: dict, requested_by: str) -> dict:
+    """Register a promotion plan's spec as the target app and record it in the audit log."""
+    target = plan["target"]["app"]
+    summary = {key: plan[key] for key in ("source", "target", "image")}
+    source = {
+        "promoted_from": plan["source"],
+        "image": plan["image"],
+        "requested_by": requested_by
+    }
+
+    result = _register_in_place(plan["spec"], source)
+    if "error" in result:
+        return result
+    was_running = result["restarted"]
+
+    audit = {**summary, "revision": result.get("revision"), "requested_by": requested_by}
+    get_state_store().log_event(target, "promoted", audit)
+    get_state_store().log_event(name, "promoted_to", audit)
+    logger.info(f"Promoted {name} ({plan['source']['namespace']}) to {target} ({plan['target']['namespace']}) as {plan['image']}")
+
+    return {"status": "promoted", **summary, "revision": result.get("revision"), "restarted": was_running}
+
+@app.post("/apps/{name}/promote")
+@leader_required
+async def promote_app(name: str, request: PromoteRequest, user: str = Depends(current_user),
+                      override: Optional[str] = Depends(override_reason)):
+    """Copy an app's latest revision, with its image pinned by digest, to the matching
+    app in another namespace. Without confirm=true only the plan is returned."""
+    try:
+        # Promotions count against the namespace they change
+        _enforce_quota("promote", user, name, request.to_namespace)
+        plan = promotion.plan_promotion(
+            get_state_store(), get_app_manager().docker_client, name,
+            request.from_namespace, request.to_namespace, request.target
+        )
+        if "error" in plan:
+            raise HTTPException(status_code=400, detail=plan["error"])
+
+        if request.revision is not None and request.revision != plan["source"]["revision"]:
+            raise HTTPException(
+                status_code=409,
+                detail=f"{name} is now at revision {plan['source']['revision']}, not {request.revision}; review the promotion again"
+            )
+
+        summary = {key: plan[key] for key in ("source", "target", "image")}
+        if not request.confirm:
+            return {"status": "pending_confirmation", **summary}
+        _enforce_freeze_windows("promote", user, plan["target"]["app"], request.to_namespace, override)
+
+        gate = _approval_gate(
+            plan["target"]["app"], "promote",
+            {"spec": plan["spec"], "plan": plan, "source_app": name}, user
+        )
+        if gate:
+            return _pending_response(gate)
+
+        result = await asyncio.to_thread(_apply_promotion, name, plan, user)
+        if "error" in result:
+            raise errors.from_result(result, 400)
+        return result
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to promote app {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.post("/apps/{name}/clone")
+@leader_required
+async def clone_app(name: str, request: CloneRequest, user: str = Depends(current_user),
+                    override: Optional[str] = Depends(override_reason)):
+    """Register a copy of an app's latest revision, with its runtime settings and the given
+    overrides, as a new app, e.g. for a review environment."""
+    try:
+        if not get_state_store().get_app(name):
+            raise errors.app_not_found(name)
+        if get_state_store().get_app(request.target):
+            raise HTTPException(status_code=409, detail=f"App {request.target} already exists")
+        plan = cloning.plan_clone(get_state_store(), name, request.target, request.namespace, request.set)
+        if "error" in plan:
+            raise errors.from_result(plan, 400)
+        target, namespace = plan["target"], plan["namespace"]
+        # A clone is a registration in the namespace it lands in
+        _enforce_quota("register", user, target, namespace)
+        _enforce_freeze_windows("register", user, target, namespace, override)
+        source = {"cloned_from": plan["source"], "requested_by": user}
+        gate = _approval_gate(target, "register", {"spec": plan["spec"], "source": source}, user)
+        if gate:
+            return _pending_response(gate)
+
+        result = _register_spec(plan["spec"], source)
+        if "error" in result:
+            raise errors.from_result(result, 400)
+
+        audit = {"source": plan["source"], "target": target, "namespace": namespace,
+                 "overrides": sorted(request.set), "requested_by": user}
+        get_state_store().log_event(target, "cloned_from", audit)
+        get_state_store().log_event(name, "cloned_to", audit)
+        logger.info(f"Cloned {name} to {target} ({namespace})")
+
+        response = {"status": "cloned", "app": target, "namespace": namespace, "source": plan["source"],
+                    "revision": result.get("revision"), "started": False}
+        if result.get("warnings"):
+            response["warnings"] = result["warnings"]
+        if request.start:
+            started = await asyncio.to_thread(get_app_manager().start, target, requested_by=user)
+            if "error" in started:
+                response["start_error"] = started["error"]
+            else:
+                response["started"] = True
+        return response
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to clone app {name}: {e}")
+        raise errors.internal_error(e)
+
+def _deploy_image(name: str, spec_dict: dict, requested_by: str, ready_timeout: Optional[int] = None,
+                  grace_period: Optional[int] = None, wait: bool = True) -> dict:
+    """Register a spec with a new image and roll it out to the app's replicas."""
+    image = spec_dict["spec"]["image"]
+    result = get_app_manager().deploy(
+        spec_dict, {"deployed_image": image, "requested_by": requested_by}, requested_by,
+        ready_timeout or rollout.DEFAULT_READY_TIMEOUT_SECONDS, grace_period, wait
+    )
+    if "error" in result:
+        return result
+
+    if get_image_prepuller():
+        get_image_prepuller().request(image, "updated")
+    get_state_store().log_event(name, "deployed", {
+        "image": image, "revision": result.get("revision"), "requested_by": requested_by
+    })
+    return result
+
+@app.post("/apps/{name}/deploy")
+@leader_required
+async def deploy_app(name: str, request: DeployRequest, user: str = Depends(current_user),
+                     override: Optional[str] = Depends(override_reason), wait: bool = Depends(lock_wait)):
+    """Change only the image of an app's latest revision. A running app gets a rolling
+    update in the background; follow it with GET /apps/{name}/rollout."""
+    try:
+        image_error = rollout.validate_image(request.image)
+        if image_error:
+            raise HTTPException(status_code=400, detail=image_error)
+        latest = get_state_store().get_app_revision(name)
+        if not latest:
+            raise errors.app_not_found(name)
+
+        image = request.image.strip()
+        if latest["spec"].get("spec", {}).get("image") == image:
+            return {"status": "unchanged", "app": name, "revision": latest["revision"], "image": image, "rollout": None}
+        if get_app_manager().rollout_in_progress(name):
+            raise HTTPException(status_code=409, detail=f"A rollout of {name} is already in progress")
+
+        _enforce_quota("deploy", user, name)
+        _enforce_freeze_windows("deploy", user, name, override=override)
+        spec_dict = rollout.patch_image(latest["spec"], image)
+        gate = _approval_gate(name, "deploy", {"spec": spec_dict, "ready_timeout": request.ready_timeout,
+                                               "grace_period": request.grace_period}, user)
+        if gate:
+            return _pending_response(gate)
+
+        result = await asyncio.to_thread(_deploy_image, name, spec_dict, user, request.ready_timeout,
+                                         request.grace_period, wait)
+        if "error" in result:
+            raise errors.from_result(result, 400)
+        return result
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to deploy app {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/apps/{name}/rollout")
+@leader_required
+@allowed_when_frozen
+async def get_app_rollout(name: str):
+    """Progress of an app's latest rolling update (kept on the leader that ran it)."""
+    try:
+        progress = get_app_manager().rollouts.get(name)
+        if not progress:
+            raise HTTPException(status_code=404, detail=f"No rollout of {name} is known to this controller")
+        return dict(progress)
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get rollout of app {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/apps/{name}/operations/active")
+@leader_required
+@allowed_when_frozen
+async def get_app_active_operations(name: str):
+    """The operation holding an app's lock on this controller and the ones queued behind it."""
+    try:
+        if not get_state_store().get_app(name):
+            raise errors.app_not_found(name)
+        return get_app_manager().active_operations(name)
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get active operations of app {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/apps/{name}/env")
+async def get_app_env(name: str):
+    """The env of an app's latest revision. Variables set with valueFrom have no value."""
+    try:
+        latest = get_state_store().get_app_revision(name)
+        if not latest:
+            raise errors.app_not_found(name)
+        return {"app": name, "revision": latest["revision"],
+                "env": rollout.env_values(latest["spec"].get("spec", {}))}
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get env of app {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.post("/apps/{name}/env")
+@leader_required
+async def update_app_env(name: str, request: EnvRequest, user: str = Depends(current_user),
+                         override: Optional[str] = Depends(override_reason), wait: bool = Depends(lock_wait)):
+    """Set or unset env variables of an app's latest revision. A running app's replicas
+    are restarted one at a time in the background unless restart is false, in which case
+    only replicas started later get the new env."""
+    try:
+        env_error = rollout.validate_env_changes(request.set, request.unset)
+        if env_error:
+            raise HTTPException(status_code=400, detail=env_error)
+        latest = get_state_store().get_app_revision(name)
+        if not latest:
+            raise errors.app_not_found(name)
+
+        spec_dict = rollout.patch_env(latest["spec"], request.set, request.unset)
+        if spec_dict == latest["spec"]:
+            return {"status": "unchanged", "app": name, "revision": latest["revision"], "rollout": None}
+        if get_app_manager().rollout_in_progress(name):
+            raise HTTPException(status_code=409, detail=f"A rollout of {name} is already in progress")
+
+        _enforce_quota("env", user, name)
+        _enforce_freeze_windows("env", user, name, override=override)
+        changes = {"set": sorted(request.set), "unset": sorted(request.unset)}
+        result = await asyncio.to_thread(
+            get_app_manager().update_env,
+            spec_dict, {"env_changed": changes, "requested_by": user}, user,
+            request.ready_timeout or rollout.DEFAULT_READY_TIMEOUT_SECONDS, request.restart, request.grace_period, wait
+        )
+        if "error" in result:
+            raise errors.from_result(result, 400)
+
+        # Values are left out of the event log, they may be credentials
+        get_state_store().log_event(name, "env_updated", {
+            **changes, "revision": result.get("revision"), "restart": request.restart, "requested_by": user
+        })
+        result.pop("image", None)
+        if result["status"] == "registered" and not request.restart:
+            result["status"] = "deferred"
+        return result
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to update env of app {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/apps/{name}/toggles")
+async def get_app_toggles(name: str):
+    """The env toggles an app allows, with their current values."""
+    try:
+        record = get_state_store().get_app(name)
+        latest = get_state_store().get_app_revision(name)
+        if not record or not latest:
+            raise errors.app_not_found(name)
+        env = rollout.env_values(latest["spec"].get("spec", {}))
+        return {"app": name, "revision": latest["revision"],
+                "toggles": toggles.current_values(record.spec.get("toggles"), env)}
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get toggles of app {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.post("/apps/{name}/toggles")
+@leader_required
+async def update_app_toggles(name: str, request: TogglesRequest, user: str = Depends(current_user),
+                             override: Optional[str] = Depends(override_reason), wait: bool = Depends(lock_wait)):
+    """Change env variables the app's spec lists under toggles, and nothing else. A running
+    app's replicas are restarted one at a time in the background."""
+    try:
+        env_error = rollout.validate_env_changes(request.set, request.unset)
+        if env_error:
+            raise HTTPException(status_code=400, detail=env_error)
+        record = get_state_store().get_app(name)
+        latest = get_state_store().get_app_revision(name)
+        if not record or not latest:
+            raise errors.app_not_found(name)
+        toggle_error = toggles.check_changes(record.spec.get("toggles"), request.set, request.unset)
+        if toggle_error:
+            raise HTTPException(status_code=403, detail=toggle_error)
+
+        spec_dict = rollout.patch_env(latest["spec"], request.set, request.unset)
+        if spec_dict == latest["spec"]:
+            return {"status": "unchanged", "app": name, "revision": latest["revision"], "rollout": None}
+        if get_app_manager().rollout_in_progress(name):
+            raise HTTPException(status_code=409, detail=f"A rollout of {name} is already in progress")
+
+        _enforce_quota("toggles", user, name)
+        _enforce_freeze_windows("toggles", user, name, override=override)
+        changes = {"set": request.set, "unset": sorted(request.unset)}
+        result = await asyncio.to_thread(
+            get_app_manager().update_env,
+            spec_dict, {"toggles_changed": changes, "requested_by": user}, user,
+            request.ready_timeout or rollout.DEFAULT_READY_TIMEOUT_SECONDS, True, request.grace_period, wait
+        )
+        if "error" in result:
+            raise errors.from_result(result, 400)
+
+        # Unlike env updates, values are logged: variables set with valueFrom cannot be toggles
+        get_state_store().log_event(name, "toggles_updated", {
+            **changes, "revision": result.get("revision"), "requested_by": user
+        })
+        result.pop("image", None)
+        return result
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to update toggles of app {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/apps/{name}/shadow")
+@leader_required
+@allowed_when_frozen
+async def get_app_shadow(name: str):
+    """An app's latest shadow deployment, comparing the shadow's responses with the app's."""
+    try:
+        report = get_app_manager().shadow_report(name)
+        if not report:
+            raise HTTPException(status_code=404, detail=f"No shadow of {name} is known to this controller")
+        return report
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get shadow of app {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.post("/apps/{name}/shadow")
+@leader_required
+async def start_app_shadow(name: str, request: ShadowRequest, user: str = Depends(current_user)):
+    """Run replicas of a candidate image next to an app and mirror a share of its requests
+    to them. Clients never see the shadow's responses."""
+    try:
+        image_error = rollout.validate_image(request.image)
+        if image_error:
+            raise HTTPException(status_code=400, detail=image_error)
+        if not get_state_store().get_app(name):
+            raise errors.app_not_found(name)
+        if get_app_manager().shadow_active(name):
+            raise HTTPException(status_code=409, detail=f"{name} already has a shadow")
+
+        _enforce_quota("shadow", user, name)
+        result = get_app_manager().start_shadow(name, request.image.strip(), request.percent,
+                                                request.replicas, user)
+        if "error" in result:
+            raise errors.from_result(result, 400)
+        return result
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to start shadow of app {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.delete("/apps/{name}/shadow")
+@leader_required
+@allowed_when_frozen
+async def stop_app_shadow(name: str, user: str = Depends(current_user)):
+    """Stop mirroring to an app's shadow and remove its replicas. The response keeps the
+    final comparison."""
+    try:
+        result = get_app_manager().stop_shadow(name, "stopped by request", user)
+        if "error" in result:
+            raise HTTPException(status_code=404, detail=result["error"])
+        return result
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to stop shadow of app {name}: {e}")
+        raise errors.internal_error(e)
+
+def _deploy_push(name: str, push: dict) -> dict:
+    """Roll a pushed image out to one app that follows its repository."""
+    record = get_state_store().get_app(name)
+    latest = get_state_store().get_app_revision(name)
+    if not record or not latest:
+        return {"app": name, "status": "skipped", "reason": "app has no recorded revision"}
+    digest = registry_webhook.resolve_digest(get_app_manager().docker_client, record.spec, push)
+    image = registry_webhook.target_image(record.spec, push, digest)
+    outcome = {"app": name, "image": image}
+    if latest["spec"].get("spec", {}).get("image") == image:
+        return {**outcome, "status": "unchanged"}
+    if get_app_manager().rollout_in_progress(name):
+        return {**outcome, "status": "skipped", "reason": "a rollout is already in progress"}
+
+    user = registry_webhook.WEBHOOK_USER
+    frozen = _freeze_window_error("deploy", user, name)
+    if frozen:
+        return {**outcome, "status": "frozen", "reason": frozen["error"]}
+    spec_dict = rollout.patch_image(latest["spec"], image)
+    gate = _approval_gate(name, "deploy", {"spec": spec_dict}, user)
+    if gate:
+        if "error" in gate:
+            return {**outcome, "status": "failed", "reason": gate["error"]}
+        return {**outcome, "status": "pending_approval", "operation": gate["operation"]["id"]}
+
+    result = _deploy_image(name, spec_dict, user)
+    if "error" in result:
+        return {**outcome, "status": "failed", "reason": result["error"]}
+    return {**outcome, "status": result["status"], "revision": result.get("revision")}
+
+@app.post("/integrations/registry/webhook")
+@leader_required
+async def registry_push_webhook(request: Request, token: Optional[str] = None):
+    """Receive Docker Hub, GHCR and Harbor push events and roll the pushed image out to the
+    apps that opted into continuous deployment of its repository and tag."""
+    try:
+        secret = registry_webhook.webhook_secret()
+        if not secret:
+            raise HTTPException(status_code=404, detail="Registry webhook is not configured")
+        body = await request.body()
+        if not registry_webhook.authenticate(secret, body, dict(request.headers), token):
+            raise HTTPException(status_code=401, detail="Invalid webhook secret")
+        try:
+            payload = json.loads(body or b"{}")
+        except ValueError:
+            raise HTTPException(status_code=400, detail="Payload is not JSON")
+
+        pushes = registry_webhook.parse_push_event(payload)
+        results = []
+        for push in pushes:
+            for item in get_state_store().list_apps():
+                record = get_state_store().get_app(item["name"])
+                if record and registry_webhook.matches(record.spec or {}, push):
+                    result = await asyncio.to_thread(_deploy_push, item["name"], push)
+                    results.append({**result, "repository": push["repository"], "tag": push["tag"]})
+        if pushes:
+            logger.info(f"Registry push of {', '.join(p['repository'] + ':' + p['tag'] for p in pushes)} "
+                        f"matched {len(results)} apps")
+        return {"pushes": pushes, "results": results}
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to handle registry push: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/apps")
+async def list_apps(team: Optional[str] = None, owner: Optional[str] = None,
+                    namespace: Optional[str] = None):
+    """List all registered applications, optionally filtered by owning team, owner or namespace."""
+    try:
+        resource_version = _resource_version()
+        apps = get_state_store().list_apps(team=team, owner=owner, namespace=namespace)
+        
+        # Add runtime status
+        for app in apps:
+            status_result = get_app_manager().status(app["name"])
+            app["status"] = status_result.get("status", "unknown")
+            app["replicas"] = status_result.get("replicas", 0)
+            app["ready_replicas"] = status_result.get("ready_replicas", 0)
+        
+        return {"apps": apps, "resource_version": resource_version}
+        
+    except Exception as e:
+        logger.error(f"Failed to list apps: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/apps/graph")
+async def app_dependency_graph():
+    """Apps as nodes and their dependsOn declarations as edges, with own and effective health."""
+    try:
+        graph = get_app_manager().dependency_graph()
+        return dict(graph, timestamp=time.time())
+
+    except Exception as e:
+        logger.error(f"Failed to build dependency graph: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/apps/summary")
+async def list_app_summaries():
+    """Compact per-app rollup for dashboards, built from one DB query and in-memory state."""
+    try:
+        rows = get_state_store().get_app_summaries()
+        runtime = get_app_manager().runtime_summary()
+
+        apps = []
+        for row in rows:
+            live = runtime.get(row["name"])
+            if live and live["replicas"] > 0:
+                status = "running" if live["ready_replicas"] > 0 else "degraded"
+            else:
+                status = "stopped" if row["status"] == "running" else row["status"]
+            apps.append({
+                "name": row["name"],
+                "status": status,
+                "replicas": live["replicas"] if live else 0,
+                "ready_replicas": live["ready_replicas"] if live else 0,
+                "mode": row["mode"],
+                "last_scaled_at": row["last_scaled_at"],
+                "unhealthy_ratio": live["unhealthy_ratio"] if live else 0.0
+            })
+
+        return {"apps": apps, "count": len(apps), "timestamp": time.time()}
+
+    except Exception as e:
+        logger.error(f"Failed to build app summary: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/apps/{name}/cost")
+async def get_app_cost(name: str, range: str = "30d"):
+    """Estimate what an app has cost over a time range, from recorded replica-hours and requested resources."""
+    try:
+        if not get_state_store().get_app(name):
+            raise errors.app_not_found(name)
+
+        return get_cost_estimator().report(name, range)
+
+    except HTTPException:
+        raise
+    except ValueError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+    except Exception as e:
+        logger.error(f"Failed to get cost for app {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/apps/{name}/raw")
+async def get_app_raw_spec(name: str):
+    """Get the raw and parsed spec for an application."""
+    try:
+        # Get the parsed spec (normalized)
+        parsed_spec = get_state_store().get_app(name)
+        if not parsed_spec:
+            raise errors.app_not_found(name)
+            
+        # Get the raw spec (as submitted by user)
+        raw_spec = get_state_store().get_raw_spec(name)
+        
+        return {
+            "name": name,
+            "raw": raw_spec,
+            "parsed": parsed_spec
+        }
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get raw spec for app {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/apps/{name}/logs")
+async def get_app_logs(name: str, lines: int = 100):
+    """Get logs for an application."""
+    try:
+        if name not in get_app_manager().instances:
+            raise HTTPException(status_code=404, detail="App not found or not running")
+        
+        app_manager = get_app_manager()
+        instances = app_manager.instances[name]
+        
+        if not instances:
+            return {
+                "app": name,
+                "logs": []
             }
         
         all_logs = []
@@ -380,166 +2061,1023 @@ async def get_app_logs(name: str, lines: int = 100):
             except Exception as e:
                 logger.error(f"Failed to get logs from container {instance.container_id[:12]}: {e}")
                 continue
-        
-        # Sort logs by timestamp (most recent first)
-        all_logs.sort(key=lambda x: x["timestamp"], reverse=True)
-        
-        # Limit to requested number of lines
-        all_logs = all_logs[:lines]
-        
+        
+        # Sort logs by timestamp (most recent first)
+        all_logs.sort(key=lambda x: x["timestamp"], reverse=True)
+        
+        # Limit to requested number of lines
+        all_logs = all_logs[:lines]
+        
+        return {
+            "app": name,
+            "total_containers": len(instances),
+            "logs": all_logs
+        }
+        
+    except Exception as e:
+        logger.error(f"Failed to get logs for app {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/apps/{name}/logs/stream")
+async def stream_app_logs(request: Request, name: str, since: Optional[str] = None,
+                          tail: int = Query(10, ge=0, le=log_stream.MAX_TAIL),
+                          last_event_id: Optional[str] = Header(None)):
+    """Stream the log lines of all of an application's replicas as server-sent events. Starts
+    with the last `tail` lines of each replica, or after `since` / Last-Event-ID."""
+    try:
+        if not get_state_store().get_app(name):
+            raise errors.app_not_found(name)
+        try:
+            start = log_stream.parse_since(last_event_id or since)
+        except ValueError as e:
+            raise errors.validation_failed(str(e))
+
+        return StreamingResponse(_log_stream(request, name, start, tail), media_type="text/event-stream",
+                                 headers={"Cache-Control": "no-cache", "X-Accel-Buffering": "no"})
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to stream logs for app {name}: {e}")
+        raise errors.internal_error(e)
+
+async def _log_stream(request: Request, name: str, start, tail: int):
+    """Server-sent events for GET /apps/{name}/logs/stream, with a comment line when no line was
+    written for a while."""
+    app_manager = get_app_manager()
+    follower = log_stream.LogFollower(app_manager.client, start)
+    quiet_since = time.time()
+    while not await request.is_disconnected():
+        instances = list(app_manager.instances.get(name, []))
+        entries = await asyncio.to_thread(follower.poll, instances, tail)
+        for entry in entries:
+            yield log_stream.sse_event(entry)
+        if entries:
+            quiet_since = time.time()
+        elif time.time() - quiet_since >= log_stream.HEARTBEAT_SECONDS:
+            quiet_since = time.time()
+            yield ": heartbeat\n\n"
+        await asyncio.sleep(log_stream.POLL_SECONDS)
+
+@app.get("/apps/{name}/access-logs")
+async def get_app_access_logs(name: str, lines: int = 100, request_id: Optional[str] = None):
+    """Get nginx access log entries for an application, optionally for a single X-Request-ID."""
+    try:
+        if not get_state_store().get_app(name):
+            raise errors.app_not_found(name)
+
+        result = get_nginx_manager().get_access_logs(name, lines=lines, request_id=request_id)
+        if "error" in result:
+            raise errors.from_result(result, 500)
+        return result
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get access logs for app {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/apps/{name}/metrics")
+async def get_app_metrics(name: str):
+    """Get metrics for an application."""
+    try:
+        metrics_summary = get_auto_scaler().get_metrics_summary(name)
+        history = get_state_store().get_scaling_history(name, limit=flapping.HISTORY_LIMIT)
+        
+        return {
+            "app": name,
+            "metrics": metrics_summary,
+            "next_evaluation_at": lifecycle.get_evaluation_schedule().get(name),
+            "scaling_history": history[:10],
+            "flapping": flapping.analyze(history, get_auto_scaler().get_policy(name))
+        }
+        
+    except Exception as e:
+        logger.error(f"Failed to get metrics for app {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/scaling-history")
+async def get_all_scaling_history(app_name: Optional[str] = Query(None, alias="app"),
+                                  limit: int = Query(50, ge=1, le=1000),
+                                  since: Optional[float] = Depends(events_since)):
+    """Scaling actions of all applications (or of app), newest first."""
+    try:
+        history = get_state_store().get_scaling_history(app_name, limit=limit, since=since)
+        return {"scaling_history": history, "count": len(history)}
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get scaling history: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/apps/{name}/scaling-history")
+async def get_app_scaling_history(name: str, limit: int = Query(50, ge=1, le=1000),
+                                  since: Optional[float] = Depends(events_since)):
+    """An application's scaling actions, newest first: replicas before and after, the reason
+    and the metrics that triggered it. Deleted apps keep their history."""
+    try:
+        history = get_state_store().get_scaling_history(name, limit=limit, since=since)
+        if not history and not get_state_store().get_app(name):
+            raise errors.app_not_found(name)
+        return {"app": name, "scaling_history": history, "count": len(history)}
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get scaling history for app {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.post("/apps/{name}/simulateMetrics")
+@leader_required
+async def simulate_metrics(name: str, sim: SimulatedMetricsRequest):
+    """Inject simulated metrics for an app and optionally trigger immediate autoscale evaluation.
+    Helpful for verifying autoscaling without generating real load."""
+    try:
+        if name not in get_app_manager().instances:
+            raise HTTPException(status_code=404, detail="App not running")
+
+        instances = get_app_manager().instances[name]
+        replica_count = len(instances)
+        healthy = sum(1 for i in instances if i.state == 'ready')
+        healthy_replicas = sim.healthyReplicas if sim.healthyReplicas is not None else healthy
+        metrics = ScalingMetrics(
+            rps=sim.rps,
+            p95_latency_ms=sim.p95LatencyMs,
+            active_connections=sim.activeConnections,
+            cpu_percent=sim.cpuPercent,
+            memory_percent=sim.memoryPercent,
+            healthy_replicas=healthy_replicas,
+            total_replicas=replica_count,
+            external=dict(sim.externalMetrics)
+        )
+        get_auto_scaler().add_metrics(name, metrics)
+
+        evaluation = None
+        action = None
+        if sim.evaluate:
+            # Get app mode from database
+            app_record = get_state_store().get_app(name)
+            app_mode = app_record.mode if app_record else "auto"
+            
+            evaluation = get_auto_scaler().evaluate_scaling(name, replica_count, mode=app_mode)
+            if evaluation.should_scale:
+                result = await asyncio.to_thread(get_app_manager().scale, name, evaluation.target_replicas)
+                if result.get('status') == 'scaled':
+                    get_auto_scaler().record_scaling_action(name, evaluation.target_replicas)
+                    get_state_store().log_scaling_action(
+                        name,
+                        evaluation.current_replicas,
+                        evaluation.target_replicas,
+                        evaluation.reason,
+                        evaluation.triggered_by,
+                        evaluation.metrics.__dict__ if evaluation.metrics else None
+                    )
+                    action = {
+                        "scaled": True,
+                        "from": evaluation.current_replicas,
+                        "to": evaluation.target_replicas,
+                        "reason": evaluation.reason
+                    }
+                else:
+                    action = {"scaled": False, "error": result}
+
+        return {
+            "app": name,
+            "metrics_added": metrics.__dict__,
+            "evaluation": {
+                "should_scale": evaluation.should_scale if evaluation else None,
+                "target_replicas": evaluation.target_replicas if evaluation else None,
+                "reason": evaluation.reason if evaluation else None,
+                "scale_factors": get_auto_scaler().last_scale_factors.get(name)
+            } if evaluation else None,
+            "action": action
+        }
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to simulate metrics for {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/metrics")
+async def get_system_metrics():
+    """Get system-wide metrics for monitoring."""
+    try:
+        # Collect metrics from all components
+        all_apps = get_state_store().list_apps()
+        total_apps = len(all_apps)
+        running_apps = 0
+        total_instances = 0
+        healthy_instances = 0
+        
+        for app in all_apps:
+            app_name = app["name"]
+            if app_name in get_app_manager().instances:
+                instances = get_app_manager().instances[app_name]
+                if instances:
+                    running_apps += 1
+                    total_instances += len(instances)
+                    healthy_instances += sum(1 for inst in instances if inst.state == "ready")
+        
+        # Get nginx status
+        nginx_status = get_nginx_manager().get_nginx_status()
+        
+        # Get health check summary
+        health_summary = get_health_checker().get_health_summary()
+
+        # Docker disk usage of each node's host
+        disk_monitor = get_disk_monitor()
+        
+        return {
+            "timestamp": time.time(),
+            "cluster": get_cluster_controller().get_cluster_status() if get_cluster_controller() else None,
+            "apps": {
+                "total": total_apps,
+                "running": running_apps
+            },
+            "instances": {
+                "total": total_instances,
+                "healthy": healthy_instances,
+                "unhealthy": total_instances - healthy_instances
+            },
+            "nginx": nginx_status,
+            "health_checks": health_summary,
+            "disk": disk_monitor.status() if disk_monitor else None,
+            # In-memory state of the controller and how close it is to its caps
+            "state": {
+                "autoscaler": get_auto_scaler().state_footprint() if get_auto_scaler() else None
+            }
+        }
+        
+    except Exception as e:
+        logger.error(f"Failed to get system metrics: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/events")
+async def get_events(app: Optional[str] = None, limit: int = 100, severity: Optional[str] = None,
+                     types: Optional[list] = Depends(event_types), since: Optional[float] = Depends(events_since)):
+    """Get recent events, optionally only those of some types, since a time, or at or above a severity."""
+    try:
+        if severity and severity not in SEVERITIES:
+            raise HTTPException(status_code=400, detail=f"severity must be one of {', '.join(SEVERITIES)}")
+        events = get_state_store().get_events(app_name=app, limit=limit, min_severity=severity,
+                                              event_types=types, since=since)
+        return {"events": events}
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get events: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/apps/{name}/events")
+async def get_app_events(name: str, limit: int = 100, severity: Optional[str] = None,
+                         types: Optional[list] = Depends(event_types), since: Optional[float] = Depends(events_since)):
+    """Get an application's events, newest first, with the same filters as GET /events."""
+    try:
+        if severity and severity not in SEVERITIES:
+            raise HTTPException(status_code=400, detail=f"severity must be one of {', '.join(SEVERITIES)}")
+        if not get_state_store().get_app(name) and not get_state_store().get_events(app_name=name, limit=1):
+            raise errors.app_not_found(name)
+        events = get_state_store().get_events(app_name=name, limit=limit, min_severity=severity,
+                                              event_types=types, since=since)
+        return {"app_name": name, "events": events, "count": len(events)}
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get events of app {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/search")
+async def search_all(q: Optional[str] = None, kind: Optional[str] = None,
+                     limit: int = Query(search.DEFAULT_LIMIT, ge=1, le=search.MAX_LIMIT),
+                     event_days: int = Query(search.DEFAULT_EVENT_DAYS, ge=1, le=search.MAX_EVENT_DAYS)):
+    """Find apps (by name, image or label), containers (by ID prefix or IP) and recent events
+    (by message or type) containing q. kind limits the search to some of them."""
+    try:
+        parsed, error = search.validate_query(q, kind)
+        if error:
+            raise errors.validation_failed(error)
+        query, kinds = parsed
+        return await asyncio.to_thread(search.search, get_state_store(), query, kinds, limit, event_days)
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to search for {q!r}: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/watch/apps")
+async def watch_apps(request: Request, since: Optional[int] = None, app_name: Optional[str] = Query(None, alias="app"),
+                     kind: Optional[str] = None, timeout: int = watch.DEFAULT_WATCH_TIMEOUT_SECONDS,
+                     stream: bool = False, last_event_id: Optional[str] = Header(None)):
+    """Changes to apps and their instances after resource version `since` (default: now). Waits
+    up to `timeout` seconds for the first one, or streams them as server-sent events with
+    `stream=true` or `Accept: text/event-stream`."""
+    try:
+        hub = get_watch_hub()
+        if not hub:
+            raise errors.ApiError(503, errors.UNAVAILABLE, "The watch API is not ready yet")
+        try:
+            kinds = watch.validate_kinds(kind)
+            if since is None and last_event_id:
+                since = int(last_event_id)
+        except ValueError as e:
+            raise errors.validation_failed(str(e))
+        if since is None:
+            since = hub.latest_resource_version()
+        if since < 0:
+            raise errors.validation_failed("since must be a resource version (0 or more)")
+
+        if stream or "text/event-stream" in request.headers.get("accept", ""):
+            # Fail with 410 now rather than in the middle of the stream
+            hub.changes_since(since, app_name, kinds, limit=1)
+            return StreamingResponse(_watch_stream(request, hub, since, app_name, kinds),
+                                     media_type="text/event-stream",
+                                     headers={"Cache-Control": "no-cache", "X-Accel-Buffering": "no"})
+
+        timeout = max(0, min(timeout, watch.MAX_WATCH_TIMEOUT_SECONDS))
+        changes, resource_version = await hub.wait(since, timeout, app_name, kinds)
+        return JSONResponse({"resource_version": resource_version, "changes": changes},
+                            headers={watch.RESOURCE_VERSION_HEADER: str(resource_version)})
+
+    except watch.ResourceVersionTooOld as e:
+        raise errors.ApiError(410, errors.RESOURCE_VERSION_TOO_OLD, str(e),
+                              details={"since": e.since, "compacted": e.compacted})
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to watch apps: {e}")
+        raise errors.internal_error(e)
+
+async def _watch_stream(request: Request, hub, since: int, app_name: Optional[str], kinds):
+    """Server-sent events for GET /watch/apps, with a comment line when nothing changed for a while."""
+    while not await request.is_disconnected():
+        try:
+            changes, since = await hub.wait(since, watch.HEARTBEAT_SECONDS, app_name, kinds)
+        except watch.ResourceVersionTooOld as e:
+            body = errors.error_body(410, errors.RESOURCE_VERSION_TOO_OLD, str(e))
+            yield f"event: ERROR\ndata: {json.dumps(body)}\n\n"
+            return
+        for change in changes:
+            yield watch.sse_event(change)
+        if not changes:
+            yield ": heartbeat\n\n"
+
+@app.get("/quotas")
+async def get_quotas(namespace: Optional[str] = None, app_name: Optional[str] = None,
+                     user: str = Depends(current_user)):
+    """The API quotas that apply to the caller (and a namespace or app), with what is left of each."""
+    try:
+        if namespace is None:
+            record = get_state_store().get_app(app_name) if app_name else None
+            namespace = record.namespace if record else "default"
+        return get_quota_manager().usage(user, namespace, app_name)
+    except Exception as e:
+        logger.error(f"Failed to get API quotas: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/admin/quotas/usage", dependencies=[Depends(admin_required)])
+async def get_quota_usage(scope: Optional[str] = None):
+    """Request counts of every caller, namespace and app in the current quota windows."""
+    try:
+        usage = get_state_store().list_api_usage(scope_prefix=scope)
+        return {"rules": get_quota_manager().rules, "usage": usage, "count": len(usage)}
+    except Exception as e:
+        logger.error(f"Failed to get API usage: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/operations")
+async def list_operations(status: Optional[str] = None, app_name: Optional[str] = None):
+    """List operations on protected apps (pending, approved, rejected, executed, failed or expired)."""
+    try:
+        return get_approval_manager().list(status=status, app_name=app_name)
+    except Exception as e:
+        logger.error(f"Failed to list operations: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/operation-journal")
+async def list_operation_journal(app_name: Optional[str] = None, status: Optional[str] = None,
+                                 limit: int = Query(100, ge=1, le=1000)):
+    """List journaled scales and rollouts, newest first, with the steps they completed."""
+    try:
+        if status and status not in operation_journal.STATUSES:
+            raise errors.validation_failed(f"status must be one of {', '.join(operation_journal.STATUSES)}")
+        return get_app_manager().journal.list(app_name, status, limit)
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to list the operation journal: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/operations/{operation_id}")
+async def get_operation(operation_id: str):
+    """Get one operation, including the parameters it will run with."""
+    try:
+        operation = get_approval_manager().get(operation_id)
+        if not operation:
+            raise HTTPException(status_code=404, detail=f"Operation {operation_id} not found")
+        return operation
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get operation {operation_id}: {e}")
+        raise errors.internal_error(e)
+
+@app.post("/operations/{operation_id}/approve")
+@leader_required
+async def approve_operation(operation_id: str, approver: str = Depends(approver_required)):
+    """Approve a pending operation on a protected app and run it. The approver must not be the requester."""
+    try:
+        operation = get_approval_manager().approve(operation_id, approver)
+        if "error" in operation:
+            raise HTTPException(status_code=400, detail=operation["error"])
+
+        logger.info(f"{approver} approved operation {operation_id} ({operation['action']} {operation['app']})")
+        result = await asyncio.to_thread(_execute_operation, operation)
+        return {**get_approval_manager().finish(operation_id, result), "result": result}
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to approve operation {operation_id}: {e}")
+        get_approval_manager().finish(operation_id, {"error": str(e)})
+        raise errors.internal_error(e)
+
+@app.post("/operations/{operation_id}/reject")
+@leader_required
+async def reject_operation(operation_id: str, approver: str = Depends(approver_required)):
+    """Reject a pending operation on a protected app."""
+    try:
+        operation = get_approval_manager().reject(operation_id, approver)
+        if "error" in operation:
+            raise HTTPException(status_code=400, detail=operation["error"])
+        return operation
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to reject operation {operation_id}: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/namespaces")
+async def list_namespaces():
+    """List namespaces with their policies and app counts."""
+    try:
+        return get_app_manager().namespaces.list()
+    except Exception as e:
+        logger.error(f"Failed to list namespaces: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/namespaces/{name}")
+async def get_namespace(name: str):
+    """Get a namespace's policies and the apps in it."""
+    try:
+        result = get_app_manager().namespaces.get(name)
+        if "error" in result:
+            raise errors.from_result(result, 400)
+        return result
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get namespace {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.put("/namespaces/{name}/security", dependencies=[Depends(admin_required)])
+@leader_required
+async def set_namespace_security(name: str, request: NamespacePolicyRequest):
+    """Replace the security policy every app in a namespace must satisfy."""
+    try:
+        result = get_app_manager().namespaces.set_security_policy(name, request.policy)
+        if "error" in result:
+            raise errors.from_result(result, 400)
+        return result
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to set security policy for namespace {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.put("/namespaces/{name}/scaling", dependencies=[Depends(admin_required)])
+@leader_required
+async def set_namespace_scaling(name: str, request: NamespacePolicyRequest):
+    """Replace the scaling defaults of a namespace's apps. Fields an app sets itself win."""
+    try:
+        result = get_app_manager().namespaces.set_scaling_defaults(name, request.policy)
+        if "error" in result:
+            raise errors.from_result(result, 400)
+        for app_name, policy in result.pop("policies").items():
+            get_auto_scaler().set_policy(app_name, policy)
+        return result
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to set scaling defaults for namespace {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/freeze-windows")
+async def list_freeze_windows(namespace: Optional[str] = None, days: int = 14):
+    """Deployment freeze windows that are active or start within the next days, org-wide
+    and, if a namespace is given, that namespace's own."""
+    try:
+        calendar = get_change_calendar()
+        if not calendar:
+            raise HTTPException(status_code=503, detail="Controller not initialized")
+        windows = calendar.upcoming(namespace, days=max(0, min(days, 366)))
+        return {
+            "namespace": namespace,
+            "windows": windows,
+            "active": next((window for window in windows if window["active"]), None),
+            "org_windows": calendar.org_windows(),
+            "count": len(windows)
+        }
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to list freeze windows: {e}")
+        raise errors.internal_error(e)
+
+@app.put("/admin/freeze-windows", dependencies=[Depends(admin_required)])
+@leader_required
+async def set_org_freeze_windows(request: FreezeWindowsRequest):
+    """Replace the org-wide deployment freeze windows."""
+    try:
+        result = get_change_calendar().set_org_windows(request.windows)
+        if "error" in result:
+            raise errors.from_result(result, 400)
+        return result
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to set org freeze windows: {e}")
+        raise errors.internal_error(e)
+
+@app.put("/namespaces/{name}/freeze-windows", dependencies=[Depends(admin_required)])
+@leader_required
+async def set_namespace_freeze_windows(name: str, request: FreezeWindowsRequest):
+    """Replace a namespace's deployment freeze windows."""
+    try:
+        result = get_app_manager().namespaces.set_freeze_windows(name, request.windows)
+        if "error" in result:
+            raise errors.from_result(result, 400)
+        return result
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to set freeze windows for namespace {name}: {e}")
+        raise errors.internal_error(e)
+
+def _federated_result(cluster: str, status_code: int, body: dict) -> dict:
+    """One cluster's outcome of a federated registration."""
+    if status_code == 200:
+        return {"cluster": cluster, "status": "registered", "revision": body.get("revision")}
+    if status_code == 202:
+        return {"cluster": cluster, "status": "pending_approval", "operation": (body.get("operation") or {}).get("id")}
+    error = body.get("detail") or body.get("error") or f"HTTP {status_code}"
+    return {"cluster": cluster, "status": "failed", "error": error, "http_status": status_code or None}
+
+@app.get("/federation/clusters")
+async def list_federated_clusters():
+    """The clusters this controller federates with, and whether they answer."""
+    try:
+        federation = get_federation()
+        clusters = await asyncio.to_thread(federation.status)
+        return {"local": federation.local_name or None, "clusters": clusters}
+    except Exception as e:
+        logger.error(f"Failed to list federated clusters: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/federation/apps")
+async def list_federated_apps(namespace: Optional[str] = None):
+    """List apps on every federated cluster. Clusters that cannot be reached are reported
+    in errors; the others are still listed."""
+    try:
+        federation = get_federation()
+
+        async def cluster_apps(name: str) -> dict:
+            if federation.is_local(name):
+                return await list_apps(namespace=namespace)
+            return await asyncio.to_thread(federation.get, name, "/apps", {"namespace": namespace})
+
+        names = federation.names()
+        results = await asyncio.gather(*(cluster_apps(name) for name in names), return_exceptions=True)
+        apps, errors = [], {}
+        for name, result in zip(names, results):
+            if isinstance(result, Exception) or "error" in result:
+                errors[name] = str(result) if isinstance(result, Exception) else result["error"]
+                continue
+            apps += [{**item, "cluster": name} for item in result.get("apps", [])]
+        return {"apps": apps, "errors": errors}
+
+    except Exception as e:
+        logger.error(f"Failed to list federated apps: {e}")
+        raise errors.internal_error(e)
+
+@app.post("/federation/apps/register")
+@leader_required
+async def register_federated_app(app_spec: AppSpec, request: Request, user: str = Depends(current_user),
+                                 override: Optional[str] = Depends(override_reason)):
+    """Register a spec on every cluster in its placement.clusters. Each cluster applies its
+    own gates, so some clusters can succeed while others fail or wait for approval."""
+    try:
+        spec_dict = app_spec.dict()
+        placement, error = federation_module.validate_placement(spec_dict.get("placement"))
+        if error or not placement:
+            raise HTTPException(status_code=400, detail=error or "The spec has no placement.clusters")
+        federation = get_federation()
+        unknown = [name for name in placement["clusters"] if name not in federation.names()]
+        if unknown:
+            raise HTTPException(status_code=400, detail=f"Unknown clusters: {', '.join(unknown)} "
+                                                        f"(federated: {', '.join(federation.names()) or 'none'})")
+
+        async def register_on(name: str) -> dict:
+            if not federation.is_local(name):
+                status_code, body = await asyncio.to_thread(
+                    federation.post, name, "/apps/register", spec_dict, dict(request.headers))
+                return _federated_result(name, status_code, body)
+            try:
+                response = await register_app(app_spec, user, override)
+            except HTTPException as e:
+                return _federated_result(name, e.status_code, {"detail": e.detail})
+            if isinstance(response, JSONResponse):
+                return _federated_result(name, response.status_code, json.loads(response.body))
+            return _federated_result(name, 200, response.dict())
+
+        results = await asyncio.gather(*(register_on(name) for name in placement["clusters"]))
+        failed = sum(1 for item in results if item["status"] == "failed")
+        pending = sum(1 for item in results if item["status"] == "pending_approval")
+        get_state_store().log_event(spec_dict["metadata"].get("name"), "federated_registration", {
+            "clusters": placement["clusters"], "failed": failed, "pending_approval": pending, "requested_by": user
+        })
         return {
-            "app": name,
-            "total_containers": len(instances),
-            "logs": all_logs
+            "app": spec_dict["metadata"].get("name"),
+            "results": list(results),
+            "succeeded": len(results) - failed - pending,
+            "failed": failed,
+            "pending_approval": pending
         }
-        
+
+    except HTTPException:
+        raise
     except Exception as e:
-        logger.error(f"Failed to get logs for app {name}: {e}")
-        raise HTTPException(status_code=500, detail=str(e))
+        logger.error(f"Failed to register federated app: {e}")
+        raise errors.internal_error(e)
 
-@app.get("/apps/{name}/metrics")
-async def get_app_metrics(name: str):
-    """Get metrics for an application."""
+def _steered_app(name: str):
+    app_record = get_state_store().get_app(name)
+    if not app_record:
+        raise errors.app_not_found(name)
+    config = (app_record.spec or {}).get("dnsSteering")
+    if not config:
+        raise HTTPException(status_code=404, detail=f"App {name} has no dnsSteering")
+    return app_record, config
+
+@app.get("/apps/{name}/dns-steering")
+@leader_required
+@allowed_when_frozen
+async def get_dns_steering_status(name: str):
+    """The DNS record an app is steered through and the weights last written to it."""
     try:
-        metrics_summary = get_auto_scaler().get_metrics_summary(name)
-        scaling_history = get_state_store().get_scaling_history(name, limit=10)
-        
+        _, config = _steered_app(name)
+        last = dict(get_dns_steering().status.get(name) or {})
+        last.pop("config", None)
+        return {"app": name, "config": config, "last_sync": last or None}
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get DNS steering of {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.post("/apps/{name}/dns-steering/sync")
+@leader_required
+@allowed_when_frozen
+async def sync_dns_steering(name: str):
+    """Write an app's DNS weights now, even if they have not changed."""
+    try:
+        app_record, config = _steered_app(name)
+        steering = get_dns_steering()
+        await asyncio.to_thread(steering.sync, app_record, config, True)
+        last = dict(steering.status.get(name) or {})
+        last.pop("config", None)
+        if last.get("error"):
+            raise HTTPException(status_code=502, detail=last["error"])
+        return {"app": name, "status": "synced", **last}
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to sync DNS steering of {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/catalog")
+async def list_catalog():
+    """List the app templates that can be deployed by name."""
+    try:
+        templates = get_catalog().list()
         return {
-            "app": name,
-            "metrics": metrics_summary,
-            "scaling_history": scaling_history
+            "templates": [{key: template[key] for key in ("name", "description", "builtin", "parameters")}
+                          for template in templates],
+            "count": len(templates)
         }
-        
     except Exception as e:
-        logger.error(f"Failed to get metrics for app {name}: {e}")
-        raise HTTPException(status_code=500, detail=str(e))
+        logger.error(f"Failed to list catalog: {e}")
+        raise errors.internal_error(e)
 
-@app.post("/apps/{name}/simulateMetrics")
+@app.get("/catalog/{template}")
+async def get_catalog_template(template: str):
+    """Get one template, including the spec it renders."""
+    try:
+        result = get_catalog().get(template)
+        if not result:
+            raise HTTPException(status_code=404, detail=f"Template {template} not found")
+        return result
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get catalog template {template}: {e}")
+        raise errors.internal_error(e)
+
+@app.post("/catalog/{template}/deploy")
 @leader_required
-async def simulate_metrics(name: str, sim: SimulatedMetricsRequest):
-    """Inject simulated metrics for an app and optionally trigger immediate autoscale evaluation.
-    Helpful for verifying autoscaling without generating real load."""
+async def deploy_catalog_template(template: str, request: CatalogDeployRequest, user: str = Depends(current_user),
+                                  override: Optional[str] = Depends(override_reason)):
+    """Register (and by default start) a new app from a template and parameter values."""
     try:
-        if name not in get_app_manager().instances:
-            raise HTTPException(status_code=404, detail="App not running")
+        spec, error = get_catalog().render(template, request.name, request.values, request.namespace)
+        if error:
+            raise HTTPException(status_code=400, detail=error)
+        spec_dict = AppSpec(**spec).dict()
+        if request.dry_run:
+            return {"status": "rendered", "template": template, "app": request.name, "spec": spec_dict}
+        if get_state_store().get_app(request.name):
+            raise HTTPException(status_code=409, detail=f"App {request.name} already exists")
 
-        instances = get_app_manager().instances[name]
-        replica_count = len(instances)
-        healthy = sum(1 for i in instances if i.state == 'ready')
-        healthy_replicas = sim.healthyReplicas if sim.healthyReplicas is not None else healthy
-        metrics = ScalingMetrics(
-            rps=sim.rps,
-            p95_latency_ms=sim.p95LatencyMs,
-            active_connections=sim.activeConnections,
-            cpu_percent=sim.cpuPercent,
-            memory_percent=sim.memoryPercent,
-            healthy_replicas=healthy_replicas,
-            total_replicas=replica_count
-        )
-        get_auto_scaler().add_metrics(name, metrics)
+        namespace = request.namespace or "default"
+        _enforce_quota("register", user, request.name, namespace)
+        _enforce_freeze_windows("register", user, request.name, namespace, override)
+        result = await asyncio.to_thread(_register_spec, spec_dict, {"catalog_template": template, "requested_by": user})
+        if "error" in result:
+            raise errors.from_result(result, 400)
 
-        evaluation = None
-        action = None
-        if sim.evaluate:
-            # Get app mode from database
-            app_record = get_state_store().get_app(name)
-            app_mode = app_record.mode if app_record else "auto"
-            
-            evaluation = get_auto_scaler().evaluate_scaling(name, replica_count, mode=app_mode)
-            if evaluation.should_scale:
-                result = get_app_manager().scale(name, evaluation.target_replicas)
-                if result.get('status') == 'scaled':
-                    get_auto_scaler().record_scaling_action(name, evaluation.target_replicas)
-                    get_state_store().log_scaling_action(
-                        name,
-                        evaluation.current_replicas,
-                        evaluation.target_replicas,
-                        evaluation.reason,
-                        evaluation.triggered_by,
-                        evaluation.metrics.__dict__ if evaluation.metrics else None
-                    )
-                    action = {
-                        "scaled": True,
-                        "from": evaluation.current_replicas,
-                        "to": evaluation.target_replicas,
-                        "reason": evaluation.reason
-                    }
-                else:
-                    action = {"scaled": False, "error": result}
+        response = {**result, "template": template, "spec": spec_dict, "started": False}
+        if request.start:
+            started = await asyncio.to_thread(get_app_manager().start, request.name, requested_by=user)
+            if "error" in started:
+                response["message"] = f"Registered, but failed to start: {started['error']}"
+            else:
+                get_state_store().log_event(request.name, "started", started)
+                response.update(started=True, replicas=started.get("replicas"))
+        return response
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to deploy template {template}: {e}")
+        raise errors.internal_error(e)
+
+@app.put("/admin/catalog/{template}", dependencies=[Depends(admin_required)])
+@leader_required
+async def put_catalog_template(template: str, request: CatalogTemplateRequest, user: str = Depends(current_user)):
+    """Add or replace a custom template. Built-in templates cannot be changed."""
+    try:
+        result = get_catalog().put(template, request.template, user)
+        if "error" in result:
+            raise errors.from_result(result, 400)
+        return result
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to save catalog template {template}: {e}")
+        raise errors.internal_error(e)
+
+@app.delete("/admin/catalog/{template}", dependencies=[Depends(admin_required)])
+@leader_required
+async def delete_catalog_template(template: str, user: str = Depends(current_user)):
+    """Remove a custom template. Apps deployed from it are not affected."""
+    try:
+        result = get_catalog().delete(template, user)
+        if "error" in result:
+            status = 404 if "not found" in result["error"] else 400
+            raise errors.from_result(result, status)
+        return result
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to delete catalog template {template}: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/secrets", dependencies=[Depends(admin_required)])
+async def list_secrets():
+    """List secret names. Values are never returned."""
+    try:
+        secrets = get_secret_store().list()
+        return {"secrets": secrets, "count": len(secrets)}
+
+    except Exception as e:
+        logger.error(f"Failed to list secrets: {e}")
+        raise errors.internal_error(e)
+
+@app.put("/secrets/{name}", dependencies=[Depends(admin_required)])
+@leader_required
+async def put_secret(name: str, request: SecretRequest):
+    """Create or replace a secret and refresh apps whose edge auth uses it."""
+    try:
+        result = get_secret_store().put(name, request.value)
+
+        if "error" in result:
+            raise errors.from_result(result, 400)
+
+        result["refreshed_apps"] = get_app_manager().refresh_secret_consumers(name)
+        return result
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to store secret {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.delete("/secrets/{name}", dependencies=[Depends(admin_required)])
+@leader_required
+async def delete_secret(name: str):
+    """Delete a secret."""
+    try:
+        result = get_secret_store().delete(name)
+
+        if "error" in result:
+            raise errors.from_result(result, 404)
+
+        return result
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to delete secret {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.post("/chaos/apps/{name}/kill", dependencies=[Depends(admin_required)])
+@leader_required
+async def chaos_kill_replica(name: str, request: Optional[ChaosKillRequest] = None):
+    """Chaos: kill one replica of an app to exercise automatic recovery."""
+    try:
+        result = get_chaos_monkey().kill_replica(name, request.container_id if request else None)
+
+        if "error" in result:
+            raise errors.from_result(result, 400)
+
+        return result
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Chaos kill failed for app {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.post("/chaos/apps/{name}/health-failure", dependencies=[Depends(admin_required)])
+@leader_required
+async def chaos_health_failure(name: str, request: ChaosHealthFailureRequest):
+    """Chaos: make replicas of an app fail health checks for a while."""
+    try:
+        result = get_chaos_monkey().inject_health_failure(name, request.duration_seconds, request.replicas)
+
+        if "error" in result:
+            raise errors.from_result(result, 400)
+
+        return result
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Chaos health failure injection failed for app {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.post("/chaos/nginx/pause", dependencies=[Depends(admin_required)])
+@leader_required
+async def chaos_pause_nginx(request: ChaosPauseRequest):
+    """Chaos: pause the nginx load balancer container for a while."""
+    try:
+        result = get_chaos_monkey().pause_nginx(request.duration_seconds)
+
+        if "error" in result:
+            raise errors.from_result(result, 409)
+
+        return result
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Chaos nginx pause failed: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/admin/freeze")
+async def get_freeze():
+    """Get the maintenance freeze state."""
+    freeze_state = get_freeze_state()
+    if not freeze_state:
+        raise HTTPException(status_code=503, detail="Controller not initialized")
+    return freeze_state.status(refresh=True)
+
+@app.get("/admin/last-reconciliation")
+async def get_last_reconciliation():
+    """The report of the latest startup or leader takeover reconciliation: containers adopted,
+    restarted and removed as orphans, nginx configs rebuilt and scaling policies restored."""
+    try:
+        report = reconciliation.last(get_state_store())
+        if not report:
+            raise HTTPException(status_code=404, detail="No reconciliation has been recorded yet")
+        return report
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get the last reconciliation: {e}")
+        raise errors.internal_error(e)
+
+@app.post("/admin/freeze", dependencies=[Depends(admin_required)])
+@leader_required
+@allowed_when_frozen
+async def freeze_controller(request: FreezeRequest):
+    """Freeze the controller: stop autoscaling, automatic restarts and cleanup, and reject writes."""
+    try:
+        cluster_controller = get_cluster_controller()
+        result = get_freeze_state().freeze(
+            request.reason,
+            frozen_by=cluster_controller.node_id if cluster_controller else None
+        )
+        if "error" in result:
+            raise errors.from_result(result, 409)
+        return result
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to freeze controller: {e}")
+        raise errors.internal_error(e)
 
-        return {
-            "app": name,
-            "metrics_added": metrics.__dict__,
-            "evaluation": {
-                "should_scale": evaluation.should_scale if evaluation else None,
-                "target_replicas": evaluation.target_replicas if evaluation else None,
-                "reason": evaluation.reason if evaluation else None,
-                "scale_factors": get_auto_scaler().last_scale_factors.get(name)
-            } if evaluation else None,
-            "action": action
-        }
+@app.post("/admin/fsck", dependencies=[Depends(admin_required)])
+@leader_required
+@allowed_when_frozen
+async def run_consistency_check(fix: bool = False):
+    """Cross-check Docker, the instances table, in-memory instance maps and nginx configs.
+    With fix=true, apply the suggested repairs."""
+    try:
+        freeze_state = get_freeze_state()
+        if fix and freeze_state and freeze_state.is_frozen():
+            raise HTTPException(
+                status_code=423,
+                detail=f"Controller is frozen for maintenance, run without fix: {freeze_state.status().get('reason')}"
+            )
+        return await asyncio.to_thread(get_consistency_checker().check, fix)
     except HTTPException:
         raise
     except Exception as e:
-        logger.error(f"Failed to simulate metrics for {name}: {e}")
-        raise HTTPException(status_code=500, detail=str(e))
+        logger.error(f"Consistency check failed: {e}")
+        raise errors.internal_error(e)
 
-@app.get("/metrics")
-async def get_system_metrics():
-    """Get system-wide metrics for monitoring."""
+@app.get("/images/gc")
+async def get_image_gc_status():
+    """The image GC policy, the latest collection request and each node's report of it."""
     try:
-        # Collect metrics from all components
-        all_apps = get_state_store().list_apps()
-        total_apps = len(all_apps)
-        running_apps = 0
-        total_instances = 0
-        healthy_instances = 0
-        
-        for app in all_apps:
-            app_name = app["name"]
-            if app_name in get_app_manager().instances:
-                instances = get_app_manager().instances[app_name]
-                if instances:
-                    running_apps += 1
-                    total_instances += len(instances)
-                    healthy_instances += sum(1 for inst in instances if inst.state == "ready")
-        
-        # Get nginx status
-        nginx_status = get_nginx_manager().get_nginx_status()
-        
-        # Get health check summary
-        health_summary = get_health_checker().get_health_summary()
-        
-        return {
-            "timestamp": time.time(),
-            "cluster": get_cluster_controller().get_cluster_status() if get_cluster_controller() else None,
-            "apps": {
-                "total": total_apps,
-                "running": running_apps
-            },
-            "instances": {
-                "total": total_instances,
-                "healthy": healthy_instances,
-                "unhealthy": total_instances - healthy_instances
-            },
-            "nginx": nginx_status,
-            "health_checks": health_summary
-        }
-        
+        if not get_image_gc():
+            raise HTTPException(status_code=503, detail="Image garbage collection is not running")
+        return get_image_gc().status()
+    except HTTPException:
+        raise
     except Exception as e:
-        logger.error(f"Failed to get system metrics: {e}")
-        raise HTTPException(status_code=500, detail=str(e))
+        logger.error(f"Failed to get image GC status: {e}")
+        raise errors.internal_error(e)
 
-@app.get("/events")
-async def get_events(app: Optional[str] = None, limit: int = 100):
-    """Get recent events."""
+@app.post("/admin/images/gc", dependencies=[Depends(admin_required)])
+@leader_required
+async def request_image_gc(request: Optional[ImageGCRequest] = None, user: str = Depends(current_user)):
+    """Ask every node to remove unused app images now. Follow the reports with GET /images/gc."""
     try:
-        events = get_state_store().get_events(app, limit)
-        return {"events": events}
-        
+        if not get_image_gc():
+            raise HTTPException(status_code=503, detail="Image garbage collection is not running")
+        dry_run = bool(request and request.dry_run)
+        result = get_image_gc().request(dry_run=dry_run, requested_by=user)
+        if "error" in result:
+            raise errors.from_result(result, 500)
+        return {"status": "requested", "request": result}
+    except HTTPException:
+        raise
     except Exception as e:
-        logger.error(f"Failed to get events: {e}")
-        raise HTTPException(status_code=500, detail=str(e))
+        logger.error(f"Failed to request image GC: {e}")
+        raise errors.internal_error(e)
+
+@app.delete("/admin/freeze", dependencies=[Depends(admin_required)])
+@leader_required
+@allowed_when_frozen
+async def unfreeze_controller():
+    """Lift the maintenance freeze and resume automatic operations."""
+    try:
+        result = get_freeze_state().unfreeze()
+        if "error" in result:
+            raise errors.from_result(result, 409)
+        return result
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to unfreeze controller: {e}")
+        raise errors.internal_error(e)
 
 @app.get("/cluster/status")
 async def get_cluster_status():
@@ -548,10 +3086,14 @@ async def get_cluster_status():
         raise HTTPException(status_code=503, detail="Clustering not enabled")
         
     try:
-        return get_cluster_controller().get_cluster_status()
+        status = get_cluster_controller().get_cluster_status()
+        shards = get_health_shards()
+        targets = list(get_app_manager().health_checker.health_configs) if get_app_manager() else []
+        status["health_shards"] = shards.describe(targets) if shards else {"enabled": False}
+        return status
     except Exception as e:
         logger.error(f"Failed to get cluster status: {e}")
-        raise HTTPException(status_code=500, detail=str(e))
+        raise errors.internal_error(e)
 
 @app.get("/cluster/leader")
 async def get_cluster_leader():
@@ -567,7 +3109,178 @@ async def get_cluster_leader():
             raise HTTPException(status_code=503, detail="No leader elected")
     except Exception as e:
         logger.error(f"Failed to get cluster leader: {e}")
-        raise HTTPException(status_code=500, detail=str(e))
+        raise errors.internal_error(e)
+
+@app.post("/cluster/leader/transfer", dependencies=[Depends(admin_required)])
+@leader_required
+@allowed_when_frozen
+async def transfer_cluster_leadership(to: Optional[str] = None):
+    """Gracefully hand leadership to another node (the healthiest follower if none is given)."""
+    if not get_cluster_controller():
+        raise HTTPException(status_code=503, detail="Clustering not enabled")
+
+    try:
+        # The handoff waits for the target to take the lease, so keep it off the event loop
+        result = await asyncio.to_thread(get_cluster_controller().transfer_leadership, to)
+
+        if "error" in result:
+            raise errors.from_result(result, 400)
+
+        return result
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to transfer leadership: {e}")
+        raise errors.internal_error(e)
+
+@app.post("/cluster/leader/campaign")
+async def campaign_for_leadership(request: CampaignRequest):
+    """Called by the outgoing leader on the transfer target to make it campaign immediately."""
+    if not get_cluster_controller():
+        raise HTTPException(status_code=503, detail="Clustering not enabled")
+
+    try:
+        result = get_cluster_controller().campaign_for_transfer(request.from_node, request.term)
+
+        if "error" in result:
+            raise errors.from_result(result, 409)
+
+        return result
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to campaign for leadership transfer: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/cluster/simulation")
+async def get_cluster_simulation():
+    """The nodes of a simulated cluster (see controller/simulated_cluster.py)."""
+    cluster = get_cluster_controller()
+    if not isinstance(cluster, SimulatedCluster):
+        return {"enabled": False}
+    return cluster.describe()
+
+@app.post("/cluster/simulation/nodes/{node_id}/{action}", dependencies=[Depends(admin_required)])
+async def act_on_simulated_node(node_id: str, action: str):
+    """Start, stop or crash a node of a simulated cluster to exercise elections and failover."""
+    cluster = get_cluster_controller()
+    if not isinstance(cluster, SimulatedCluster):
+        raise HTTPException(status_code=404, detail="Simulated cluster mode is not enabled")
+    if action not in simulated_cluster.ACTIONS:
+        raise errors.validation_failed(f"Unknown action {action}, use {', '.join(simulated_cluster.ACTIONS)}")
+    node = cluster.get_node(node_id)
+    if not node:
+        raise HTTPException(status_code=404, detail=f"Simulated node {node_id} not found")
+
+    try:
+        # Stopping waits for the node's threads, so keep it off the event loop
+        result = await asyncio.to_thread(cluster.act, node, action)
+        if "error" in result:
+            raise errors.from_result(result, 409)
+        return result
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to {action} simulated node {node_id}: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/cluster/endpoints")
+async def get_cluster_endpoints():
+    """List controller API endpoints and their roles for external load balancer configuration."""
+    if not get_cluster_controller():
+        raise HTTPException(status_code=503, detail="Clustering not enabled")
+
+    try:
+        return get_cluster_controller().get_endpoints()
+    except Exception as e:
+        logger.error(f"Failed to get cluster endpoints: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/cluster/events")
+async def get_cluster_events(term: Optional[int] = None, node: Optional[str] = None,
+                             type: Optional[str] = None, since: Optional[float] = None,
+                             until: Optional[float] = None, limit: int = 100):
+    """Get the cluster coordination timeline (elections, leadership changes, membership)."""
+    if not get_cluster_controller():
+        raise HTTPException(status_code=503, detail="Clustering not enabled")
+
+    try:
+        events = get_cluster_controller().get_cluster_events(
+            term=term, node_id=node, event_type=type, since=since, until=until, limit=limit
+        )
+        return {"events": events, "count": len(events)}
+    except Exception as e:
+        logger.error(f"Failed to get cluster events: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/cluster/split-brain")
+async def get_split_brain_reports():
+    """List split-brain detections recorded by this node, most recent first."""
+    if not get_cluster_controller():
+        raise HTTPException(status_code=503, detail="Clustering not enabled")
+
+    try:
+        reports = get_cluster_controller().get_split_brain_reports()
+        return {
+            "node_id": get_cluster_controller().node_id,
+            "reports": reports,
+            "count": len(reports),
+            "timestamp": time.time()
+        }
+    except Exception as e:
+        logger.error(f"Failed to get split-brain reports: {e}")
+        raise errors.internal_error(e)
+
+@app.post("/cluster/upgrade", dependencies=[Depends(admin_required)])
+@leader_required
+@allowed_when_frozen
+async def start_cluster_upgrade(request: UpgradeRequest):
+    """Start a rolling controller upgrade: followers one by one, then the leader after handing off."""
+    if not get_cluster_controller():
+        raise HTTPException(status_code=503, detail="Clustering not enabled")
+
+    try:
+        coordinator = get_upgrade_coordinator()
+        if coordinator.get_active():
+            raise HTTPException(status_code=409, detail="An upgrade is already in progress")
+
+        target_version = request.target_version.strip().lstrip("v")
+        image = request.image or upgrade_module.controller_image(target_version)
+        # Pulling the image can take a while
+        result = await asyncio.to_thread(coordinator.start, image, target_version,
+                                         request.node_timeout_seconds, request.auto_rollback)
+
+        if "error" in result:
+            status_code = 409 if "in progress" in result["error"] else 400
+            raise errors.from_result(result, status_code)
+
+        return result
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to start cluster upgrade: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/cluster/upgrade")
+async def get_cluster_upgrade():
+    """Get progress of the latest rolling upgrade and the version each node reports."""
+    if not get_cluster_controller():
+        raise HTTPException(status_code=503, detail="Clustering not enabled")
+
+    try:
+        upgrade = get_upgrade_coordinator().get_status()
+        if not upgrade:
+            raise HTTPException(status_code=404, detail="No upgrades have been run")
+        return upgrade
+
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get cluster upgrade status: {e}")
+        raise errors.internal_error(e)
 
 @app.get("/cluster/health")
 async def cluster_health_check():
@@ -593,6 +3306,7 @@ async def cluster_health_check():
             "leader_id": cluster_status["leader_id"],
             "cluster_size": cluster_status["cluster_size"],
             "cluster_ready": is_ready,
+            "warnings": cluster_status["warnings"],
             "timestamp": time.time(),
             "version": "1.0.0"
         }
@@ -608,13 +3322,360 @@ async def cluster_health_check():
 
 @app.get("/health")
 async def health_check():
-    """Health check endpoint."""
-    return {
+    """Health check endpoint. Also advertises the leader's write endpoint for client discovery."""
+    payload = {
         "status": "healthy",
         "timestamp": time.time(),
         "version": "1.0.0"
     }
 
+    cluster_controller = get_cluster_controller()
+    if cluster_controller:
+        try:
+            leader_info = cluster_controller.get_leader_info()
+            payload["leader"] = {
+                "leader_id": leader_info["leader_id"],
+                "advertise_url": leader_info["advertise_url"],
+                "term": leader_info["term"]
+            } if leader_info else None
+        except Exception as e:
+            logger.warning(f"Failed to attach leader info to health payload: {e}")
+
+    freeze_state = get_freeze_state()
+    if freeze_state:
+        try:
+            freeze = freeze_state.status()
+            payload["frozen"] = bool(freeze.get("frozen"))
+            payload["freeze"] = freeze
+        except Exception as e:
+            logger.warning(f"Failed to attach freeze state to health payload: {e}")
+
+    return payload
+
+# Stable v1 API: apps, scaling policies and secrets with list/read/write/delete symmetry.
+# Used by the Terraform provider; fields are only ever added here, never changed or removed.
+v1 = APIRouter(prefix="/v1", tags=["v1"])
+
+# Fields of a spec's `scaling` section that make up a v1 policy
+V1_POLICY_FIELDS = tuple(SCALING_DEFAULTS)
+
+def _v1_app(name: str) -> Optional[dict]:
+    """An app as the v1 API returns it, or None if it does not exist."""
+    record = get_state_store().get_app(name)
+    if not record:
+        return None
+    latest = get_state_store().get_app_revision(name) or {}
+    live = get_app_manager().runtime_summary().get(name) or {}
+    return {
+        "name": record.name,
+        "namespace": record.namespace,
+        "revision": latest.get("revision"),
+        # The spec as it was last submitted, without the optional sections that were left out
+        "spec": {key: value for key, value in (latest.get("spec") or {}).items() if value is not None},
+        "status": record.status,
+        "running": record.status == "running",
+        "replicas": live.get("replicas", 0),
+        "ready_replicas": live.get("ready_replicas", 0),
+        "mode": record.mode,
+        "created_at": record.created_at,
+        "updated_at": record.updated_at
+    }
+
+def _v1_policy(record) -> dict:
+    scaling = (record.spec or {}).get("scaling") or {}
+    defaults = get_app_manager().namespaces.scaling_defaults(record.namespace)
+    return {
+        "app": record.name,
+        "policy": {key: scaling.get(key, defaults.get(key, SCALING_DEFAULTS[key])) for key in V1_POLICY_FIELDS},
+        "custom": any(key in scaling for key in V1_POLICY_FIELDS),
+        "inherited": namespaces.inherited_fields(scaling, defaults),
+        # What the app sets itself, so a client can change some fields and PUT the rest back
+        "fields": {key: scaling[key] for key in V1_POLICY_FIELDS if scaling.get(key) is not None}
+    }
+
+def _v1_secret(name: str) -> dict:
+    secret = get_secret_store().describe(name)
+    if not secret:
+        raise HTTPException(status_code=404, detail=f"Secret {name} not found")
+    return secret
+
+@v1.get("/apps")
+async def v1_list_apps(namespace: Optional[str] = None, team: Optional[str] = None, owner: Optional[str] = None):
+    """List apps (without their specs)."""
+    try:
+        resource_version = _resource_version()
+        runtime = get_app_manager().runtime_summary()
+        apps = []
+        for item in get_state_store().list_apps(team=team, owner=owner, namespace=namespace):
+            live = runtime.get(item["name"]) or {}
+            apps.append({
+                "name": item["name"],
+                "namespace": item.get("namespace", "default"),
+                "status": item["status"],
+                "running": item["status"] == "running",
+                "replicas": live.get("replicas", 0),
+                "ready_replicas": live.get("ready_replicas", 0),
+                "mode": item.get("mode", "auto"),
+                "owner": item.get("owner"),
+                "team": item.get("team"),
+                "contact": item.get("contact"),
+                "updated_at": item.get("updated_at")
+            })
+        return {"apps": apps, "count": len(apps), "resource_version": resource_version}
+    except Exception as e:
+        logger.error(f"Failed to list apps: {e}")
+        raise errors.internal_error(e)
+
+@v1.get("/apps/{name}")
+async def v1_get_app(name: str):
+    """Read an app, including the spec it was last registered with."""
+    try:
+        result = _v1_app(name)
+        if not result:
+            raise errors.app_not_found(name)
+        return result
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get app {name}: {e}")
+        raise errors.internal_error(e)
+
+@v1.put("/apps/{name}")
+@leader_required
+async def v1_put_app(name: str, request: V1AppRequest, user: str = Depends(current_user),
+                     override: Optional[str] = Depends(override_reason), wait: bool = Depends(lock_wait)):
+    """Create or update an app from a spec and optionally start or stop it. Updating a running
+    app restarts it with the new spec."""
+    try:
+        spec_dict = request.spec.dict()
+        metadata = spec_dict.get("metadata", {})
+        if metadata.get("name") != name:
+            raise HTTPException(status_code=400, detail=f"metadata.name must be {name}")
+        namespace = metadata.get("namespace") or "default"
+        _enforce_quota("register", user, name, namespace)
+        _enforce_freeze_windows("register", user, name, namespace, override)
+        gate = _approval_gate(name, "register", {"spec": spec_dict}, user)
+        if gate:
+            return _pending_response(gate)
+
+        result = await asyncio.to_thread(_register_in_place, spec_dict, {"requested_by": user}, wait)
+        if "error" in result:
+            raise errors.from_result(result, 400)
+
+        running = result["restarted"]
+        if request.running is True and not running:
+            started = await asyncio.to_thread(get_app_manager().start, name, wait=wait, requested_by=user)
+            if "error" in started:
+                raise HTTPException(status_code=400, detail=started["error"])
+            get_state_store().log_event(name, "started", started)
+        elif request.running is False and running:
+            stopped = await asyncio.to_thread(_stop_app, name, None, wait, user)
+            if "error" in stopped:
+                raise HTTPException(status_code=400, detail=stopped["error"])
+
+        return _v1_app(name)
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to apply app {name}: {e}")
+        raise errors.internal_error(e)
+
+@v1.delete("/apps/{name}")
+@leader_required
+async def v1_delete_app(name: str, user: str = Depends(current_user),
+                        override: Optional[str] = Depends(override_reason),
+                        grace_period: Optional[int] = Query(None, ge=0, le=termination.MAX_GRACE_PERIOD_SECONDS),
+                        wait: bool = Depends(lock_wait), purge: bool = False):
+    """Delete an app and its containers. grace_period overrides the seconds replicas get to exit after SIGTERM.
+    With purge, replicas that do not stop are killed and the app's rows are deleted in one transaction."""
+    try:
+        if not get_state_store().get_app(name):
+            raise errors.app_not_found(name)
+        _enforce_quota("delete", user, name)
+        _enforce_freeze_windows("delete", user, name, override=override)
+        gate = _approval_gate(name, "delete", {"grace_period": grace_period, "purge": purge}, user)
+        if gate:
+            return _pending_response(gate)
+
+        result = await asyncio.to_thread(_delete_app, name, grace_period, wait, user, purge)
+        if "error" in result:
+            raise errors.from_result(result, 400)
+        return {"status": "deleted", "app": name}
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to delete app {name}: {e}")
+        raise errors.internal_error(e)
+
+@v1.get("/apps/{name}/policy")
+async def v1_get_policy(name: str):
+    """Read an app's scaling policy. custom is false when every field is a default."""
+    try:
+        record = get_state_store().get_app(name)
+        if not record:
+            raise errors.app_not_found(name)
+        return _v1_policy(record)
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get policy for app {name}: {e}")
+        raise errors.internal_error(e)
+
+async def _v1_apply_policy(name: str, policy: dict, user: str) -> dict:
+    record = get_state_store().get_app(name)
+    if not record:
+        raise errors.app_not_found(name)
+    unknown = sorted(set(policy) - set(V1_POLICY_FIELDS))
+    if unknown:
+        raise HTTPException(status_code=400, detail=f"Unknown policy fields: {', '.join(unknown)}")
+    _enforce_quota("policy", user, name)
+
+    # Keep the scaling settings that are not part of the policy, e.g. warmPool
+    scaling = {key: value for key, value in ((record.spec or {}).get("scaling") or {}).items()
+               if key not in V1_POLICY_FIELDS}
+    scaling.update({key: value for key, value in policy.items() if value is not None})
+    try:
+        scaling_policy = get_app_manager().scaling_policy(name, scaling)
+    except (ValueError, TypeError) as e:
+        raise HTTPException(status_code=400, detail=f"Invalid policy: {e}")
+
+    result = get_app_manager().set_scaling(name, scaling)
+    if "error" in result:
+        raise errors.from_result(result, 400)
+    get_auto_scaler().set_policy(name, scaling_policy)
+    return _v1_policy(get_state_store().get_app(name))
+
+@v1.put("/apps/{name}/policy")
+@leader_required
+async def v1_put_policy(name: str, request: V1PolicyRequest, user: str = Depends(current_user)):
+    """Replace an app's scaling policy. Fields left out take their defaults."""
+    try:
+        return await _v1_apply_policy(name, request.policy, user)
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to set policy for app {name}: {e}")
+        raise errors.internal_error(e)
+
+@v1.delete("/apps/{name}/policy")
+@leader_required
+async def v1_delete_policy(name: str, user: str = Depends(current_user)):
+    """Reset an app's scaling policy to the defaults."""
+    try:
+        return await _v1_apply_policy(name, {}, user)
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to reset policy for app {name}: {e}")
+        raise errors.internal_error(e)
+
+@v1.get("/secrets", dependencies=[Depends(admin_required)])
+async def v1_list_secrets():
+    """List secret names and timestamps. Values are never returned."""
+    try:
+        secrets = get_secret_store().list()
+        return {"secrets": secrets, "count": len(secrets)}
+    except Exception as e:
+        logger.error(f"Failed to list secrets: {e}")
+        raise errors.internal_error(e)
+
+@v1.get("/secrets/{name}", dependencies=[Depends(admin_required)])
+async def v1_get_secret(name: str):
+    """Read a secret's name and timestamps."""
+    try:
+        return _v1_secret(name)
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to get secret {name}: {e}")
+        raise errors.internal_error(e)
+
+@v1.put("/secrets/{name}", dependencies=[Depends(admin_required)])
+@leader_required
+async def v1_put_secret(name: str, request: SecretRequest):
+    """Create or replace a secret and refresh apps whose edge auth uses it."""
+    try:
+        result = get_secret_store().put(name, request.value)
+        if "error" in result:
+            raise errors.from_result(result, 400)
+        refreshed = get_app_manager().refresh_secret_consumers(name)
+        return {**_v1_secret(name), "refreshed_apps": refreshed}
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to store secret {name}: {e}")
+        raise errors.internal_error(e)
+
+@v1.delete("/secrets/{name}", dependencies=[Depends(admin_required)])
+@leader_required
+async def v1_delete_secret(name: str):
+    """Delete a secret."""
+    try:
+        result = get_secret_store().delete(name)
+        if "error" in result:
+            raise errors.from_result(result, 404)
+        return result
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"Failed to delete secret {name}: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/metrics-sources")
+async def list_metrics_sources():
+    """The sources scaling.externalMetrics can read from: compiled-in ones and the exec
+    plugins currently installed in ORCHESTRY_METRICS_PLUGIN_DIR."""
+    try:
+        metrics_sources.registry.discover()
+        return {
+            "sources": metrics_sources.registry.describe(),
+            "plugin_dir": metrics_sources.PLUGIN_DIR or None,
+            "protocol_version": metrics_sources.PLUGIN_PROTOCOL_VERSION
+        }
+    except Exception as e:
+        logger.error(f"Failed to list metrics sources: {e}")
+        raise errors.internal_error(e)
+
+@app.get("/versions")
+async def api_versions():
+    """The API versions this controller serves, for clients to negotiate with, and the CLI
+    versions it advertises."""
+    return {
+        "versions": list(API_VERSIONS),
+        "current": API_VERSIONS[-1],
+        "header": API_VERSION_HEADER,
+        "unversioned": {"deprecated": True, "sunset": UNVERSIONED_SUNSET, "successor": API_VERSIONS[-1]},
+        "controller": CONTROLLER_VERSION,
+        "cli": cli_releases.describe()
+    }
+
+def _version_routes():
+    """Serve the routes in V1_MOVED_ROUTES under /v1 as well, with the same handlers."""
+    routes = {(method, route.path): route for route in app.routes if isinstance(route, APIRoute)
+              for method in route.methods}
+    for method, path in V1_MOVED_ROUTES:
+        route = routes[(method, path)]
+        v1.add_api_route(
+            path, route.endpoint, methods=[method], dependencies=route.dependencies,
+            response_model=route.response_model, status_code=route.status_code,
+            response_class=route.response_class, responses=route.responses, name=f"v1_{route.name}",
+            summary=route.summary, description=route.description, include_in_schema=route.include_in_schema
+        )
+
+def _has_successor(scope: dict, version: str) -> bool:
+    """Whether the route serving an unversioned request is also served under `version`: it
+    moved there, or that version's stable API has the same method and path."""
+    for route in app.routes:
+        match, _ = route.matches(scope)
+        if match == Match.FULL:
+            return isinstance(route, APIRoute) and (scope["method"], route.path) in VERSION_ROUTES[version]
+    return False
+
+_version_routes()
+app.include_router(v1)
+# (method, path without the prefix) of each route a version serves
+VERSION_ROUTES = {"v1": {(method, route.path[len(v1.prefix):]) for route in v1.routes for method in route.methods}}
+
 if __name__ == "__main__":
     import uvicorn
     uvicorn.run(app, host="0.0.0.0", port=8000)
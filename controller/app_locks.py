@@ -0,0 +1,107 @@
+"""
+Per-app operation locks.
+Operations that change an app's containers (start, stop, delete, scale,
+re-registration and rollouts) hold the app's lock, so concurrent API calls
+and the autoscaler cannot interleave Docker operations on the same app.
+Other apps are not held up. A request either queues behind the running
+operation, first come first served, for up to
+ORCHESTRY_OPERATION_LOCK_TIMEOUT_SECONDS (`lock=queue`, the default), or
+fails right away (`lock=fail`). Automated operations always fail fast and
+are tried again on their next tick. A rollout holds the lock until it has
+finished. The lock is reentrant for the thread holding it.
+"""
+
+import os
+import time
+import uuid
+import threading
+from typing import Any, Dict, List, Optional, Tuple
+
+LOCK_TIMEOUT_SECONDS = int(os.getenv("ORCHESTRY_OPERATION_LOCK_TIMEOUT_SECONDS", "60"))
+LOCK_MODES = ("queue", "fail")
+
+def _public(entry: Optional[Dict[str, Any]]) -> Optional[Dict[str, Any]]:
+    return {key: value for key, value in entry.items() if not key.startswith("_")} if entry else None
+
+def busy_result(app_name: str, holder: Optional[Dict[str, Any]]) -> Dict[str, Any]:
+    """The {"error": ...} result of an operation that could not get the app's lock."""
+    holder = holder or {}
+    by = f" requested by {holder['requested_by']}" if holder.get("requested_by") else ""
+    return {
+        "error": f"{app_name} is busy: {holder.get('operation', 'another operation')}{by} is in progress",
+        "active_operation": holder
+    }
+
+class AppOperationLocks:
+    """One FIFO lock per app, with the running and waiting operations visible."""
+
+    def __init__(self):
+        self._cond = threading.Condition()
+        self._active: Dict[str, Dict[str, Any]] = {}  # app_name -> operation holding the lock
+        self._queued: Dict[str, List[Dict[str, Any]]] = {}  # app_name -> operations waiting, oldest first
+
+    def acquire(self, app_name: str, operation: str, requested_by: Optional[str] = None, wait: bool = True,
+                timeout: Optional[float] = None) -> Tuple[Optional[Dict[str, Any]], Optional[Dict[str, Any]]]:
+        """Take the app's lock. Returns (entry to release, None), or (None, the operation in
+        the way) when wait is False or the lock is still taken after timeout seconds."""
+        me = threading.get_ident()
+        with self._cond:
+            active = self._active.get(app_name)
+            if active and active["_thread"] == me:
+                active["_depth"] += 1
+                return active, None
+            entry = {"id": uuid.uuid4().hex[:12], "app": app_name, "operation": operation,
+                     "requested_by": requested_by, "queued_at": time.time(), "started_at": None,
+                     "_thread": me, "_depth": 1}
+            queue = self._queued.get(app_name, [])
+            if active or queue:
+                if not wait:
+                    return None, _public(active or queue[0])
+                queue = self._queued.setdefault(app_name, [])
+                queue.append(entry)
+                deadline = time.time() + (LOCK_TIMEOUT_SECONDS if timeout is None else timeout)
+                while self._active.get(app_name) or queue[0] is not entry:
+                    remaining = deadline - time.time()
+                    if remaining <= 0:
+                        queue.remove(entry)
+                        if not queue:
+                            self._queued.pop(app_name, None)
+                        # The next waiter may be first in line now
+                        self._cond.notify_all()
+                        return None, _public(self._active.get(app_name) or (queue[0] if queue else None))
+                    self._cond.wait(remaining)
+                queue.pop(0)
+                if not queue:
+                    self._queued.pop(app_name, None)
+            entry["started_at"] = time.time()
+            self._active[app_name] = entry
+            return entry, None
+
+    def release(self, entry: Dict[str, Any]):
+        with self._cond:
+            entry["_depth"] -= 1
+            if entry["_depth"] > 0:
+                return
+            if self._active.get(entry["app"]) is entry:
+                del self._active[entry["app"]]
+            self._cond.notify_all()
+
+    def hand_off(self, entry: Dict[str, Any]):
+        """Give up ownership by the current thread before another thread adopts the entry,
+        so the current thread cannot re-enter the lock in the meantime."""
+        with self._cond:
+            entry["_thread"] = None
+
+    def adopt(self, entry: Dict[str, Any]):
+        """Make the current thread the owner of a handed-off entry."""
+        with self._cond:
+            entry["_thread"] = threading.get_ident()
+
+    def snapshot(self, app_name: str) -> Dict[str, Any]:
+        """The operation holding the app's lock and the ones waiting for it."""
+        with self._cond:
+            return {
+                "app": app_name,
+                "active": _public(self._active.get(app_name)),
+                "queued": [_public(entry) for entry in self._queued.get(app_name, [])]
+            }
@@ -0,0 +1,159 @@
+"""
+Two-person approval for changes to protected apps.
+An app with a `protection` block in its spec cannot be scaled below
+`protection.minReplicas`, stopped, deleted, or given a new image straight away:
+the request creates a pending operation, and it only runs once a different
+approver (one of ORCHESTRY_APPROVERS) approves it.
+"""
+
+import os
+import hmac
+import time
+import uuid
+import logging
+from typing import Any, Dict, Optional, Tuple
+
+logger = logging.getLogger(__name__)
+
+# Pending operations that nobody approves within this many seconds expire
+APPROVAL_TTL_SECONDS = int(os.getenv("ORCHESTRY_APPROVAL_TTL_SECONDS", "86400"))
+
+def approvers() -> Dict[str, str]:
+    """Approver tokens from ORCHESTRY_APPROVERS ("alice:token1,bob:token2") as {user: token}."""
+    result = {}
+    for entry in os.getenv("ORCHESTRY_APPROVERS", "").split(","):
+        user, _, token = entry.strip().partition(":")
+        if user and token:
+            result[user.strip()] = token.strip()
+    return result
+
+def approver_for_token(token: Optional[str]) -> Optional[str]:
+    """The approver a token belongs to, or None."""
+    if not token:
+        return None
+    for user, expected in approvers().items():
+        if hmac.compare_digest(token, expected):
+            return user
+    return None
+
+def validate_protection(protection: Any) -> Tuple[Optional[Dict[str, Any]], Optional[str]]:
+    """Normalize an app's `protection` block. Returns (protection or None if off, error)."""
+    if not protection:
+        return None, None
+    if not isinstance(protection, dict):
+        return None, "protection must be a mapping"
+    if protection.get("enabled") is False:
+        return None, None
+    try:
+        min_replicas = int(protection.get("minReplicas", 1))
+    except (TypeError, ValueError):
+        return None, "protection.minReplicas must be an integer"
+    if min_replicas < 0:
+        return None, "protection.minReplicas must not be negative"
+    if len(approvers()) < 2:
+        return None, "protected apps need at least two approvers in ORCHESTRY_APPROVERS on the controller"
+    return {"minReplicas": min_replicas}, None
+
+def approval_reason(app_spec: Dict[str, Any], action: str, params: Dict[str, Any]) -> Optional[str]:
+    """Why action on an app with this (stored) spec needs approval, or None if it does not."""
+    protection = app_spec.get("protection")
+    if not protection:
+        return None
+    if action == "scale":
+        min_replicas = protection.get("minReplicas", 1)
+        if params["replicas"] < min_replicas:
+            return f"scaling below {min_replicas} replicas"
+    elif action == "down":
+        return "stopping a protected app"
+    elif action == "delete":
+        return "deleting a protected app"
+    elif action == "archive":
+        return "archiving a protected app"
+    elif action in ("register", "promote", "deploy"):
+        new_spec = (params.get("spec") or {}).get("spec") or {}
+        if new_spec.get("image") != app_spec.get("image"):
+            return f"changing the image from {app_spec.get('image')} to {new_spec.get('image')}"
+        new_protection, _ = validate_protection(new_spec.get("protection"))
+        if new_protection != protection:
+            return "changing the app's protection"
+    return None
+
+class ApprovalManager:
+    """Creates, approves and rejects pending operations."""
+
+    def __init__(self, state_store: Any):
+        self.state_store = state_store
+
+    def _expire(self, operation: Optional[Dict[str, Any]]) -> Optional[Dict[str, Any]]:
+        if operation and operation["status"] == "pending" and \
+                time.time() - operation["requested_at"] > APPROVAL_TTL_SECONDS:
+            self.state_store.update_operation(operation["id"], "expired", expected_status="pending")
+            operation["status"] = "expired"
+        return operation
+
+    def create(self, app_name: str, action: str, params: Dict[str, Any],
+               requested_by: str, reason: str) -> Dict[str, Any]:
+        operation = {
+            "id": uuid.uuid4().hex[:12],
+            "app": app_name,
+            "action": action,
+            "params": params,
+            "reason": reason,
+            "status": "pending",
+            "requested_by": requested_by,
+            "requested_at": time.time(),
+            "expires_at": time.time() + APPROVAL_TTL_SECONDS
+        }
+        if not self.state_store.save_operation(operation):
+            return {"error": "Failed to save the pending operation"}
+        self.state_store.log_event(app_name, "approval_requested", {
+            "operation": operation["id"], "action": action, "reason": reason, "requested_by": requested_by
+        })
+        logger.info(f"Operation {operation['id']} ({action} {app_name}) is waiting for approval: {reason}")
+        return operation
+
+    def get(self, operation_id: str) -> Optional[Dict[str, Any]]:
+        return self._expire(self.state_store.get_operation(operation_id))
+
+    def list(self, status: Optional[str] = None, app_name: Optional[str] = None) -> Dict[str, Any]:
+        operations = [self._expire(op) for op in self.state_store.list_operations(app_name=app_name)]
+        if status:
+            operations = [op for op in operations if op["status"] == status]
+        return {"operations": operations, "count": len(operations)}
+
+    def approve(self, operation_id: str, approver: str) -> Dict[str, Any]:
+        """Claim a pending operation for execution. The caller runs it and reports with finish()."""
+        operation = self.get(operation_id)
+        if not operation:
+            return {"error": f"Operation {operation_id} not found"}
+        if operation["status"] != "pending":
+            return {"error": f"Operation {operation_id} is {operation['status']}"}
+        if approver == operation["requested_by"]:
+            return {"error": "An operation must be approved by someone other than the requester"}
+        # Only one approval can win if two approvers race
+        if not self.state_store.update_operation(operation_id, "approved", decided_by=approver,
+                                                 expected_status="pending"):
+            return {"error": f"Operation {operation_id} is no longer pending"}
+        operation.update({"status": "approved", "decided_by": approver})
+        self.state_store.log_event(operation["app"], "approval_granted", {
+            "operation": operation_id, "action": operation["action"], "approved_by": approver
+        })
+        return operation
+
+    def reject(self, operation_id: str, approver: str) -> Dict[str, Any]:
+        operation = self.get(operation_id)
+        if not operation:
+            return {"error": f"Operation {operation_id} not found"}
+        if not self.state_store.update_operation(operation_id, "rejected", decided_by=approver,
+                                                 expected_status="pending"):
+            return {"error": f"Operation {operation_id} is {operation['status']}"}
+        self.state_store.log_event(operation["app"], "approval_rejected", {
+            "operation": operation_id, "action": operation["action"], "rejected_by": approver
+        })
+        return self.get(operation_id)
+
+    def finish(self, operation_id: str, result: Dict[str, Any]) -> Dict[str, Any]:
+        """Record the outcome of an approved operation."""
+        status = "failed" if "error" in result else "executed"
+        self.state_store.update_operation(operation_id, status, result=result)
+        return self.get(operation_id)
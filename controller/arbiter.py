@@ -0,0 +1,135 @@
+"""
+Host capacity arbitration for scale-outs.
+When ORCHESTRY_HOST_CPU and/or ORCHESTRY_HOST_MEMORY_GB set the capacity
+apps may request on the host, the autoscaler does not carry out scale-outs
+in the order apps happen to be evaluated. It collects every scale-out of an
+evaluation pass and grants replicas by `scaling.priority`: higher priorities
+first, and within a priority, one replica at a time to the app that has so
+far been granted the smallest share of what it asked for (proportional
+fairness). Replicas below minReplicas are always granted. Whatever does not
+fit is deferred, logged as a `scale_deferred` event and asked for again on
+the app's next evaluation. Manual scaling is not arbitrated.
+"""
+
+import os
+import time
+import threading
+from typing import Any, Dict, List, Optional, Tuple
+
+from .cost import parse_cpu, parse_memory_gb
+
+# Capacity apps may request on the host; 0 means unlimited
+HOST_CPU = float(os.getenv("ORCHESTRY_HOST_CPU", "0"))
+HOST_MEMORY_GB = float(os.getenv("ORCHESTRY_HOST_MEMORY_GB", "0"))
+DEFAULT_PRIORITY = 0
+MIN_PRIORITY, MAX_PRIORITY = -1000, 1000
+# Requests assumed for replicas of apps that do not set spec.resources
+DEFAULT_CPU = "100m"
+DEFAULT_MEMORY = "128Mi"
+
+def validate_priority(value: Any) -> Tuple[Optional[int], Optional[str]]:
+    """Normalize `scaling.priority`. Returns (priority to store or None, error)."""
+    if value is None:
+        return None, None
+    if not isinstance(value, int) or isinstance(value, bool) or not MIN_PRIORITY <= value <= MAX_PRIORITY:
+        return None, f"scaling.priority must be an integer between {MIN_PRIORITY} and {MAX_PRIORITY}"
+    return value, None
+
+def priority(app_spec: Dict[str, Any]) -> int:
+    return (app_spec.get("scaling") or {}).get("priority", DEFAULT_PRIORITY)
+
+def replica_request(app_spec: Dict[str, Any]) -> Dict[str, float]:
+    """CPU cores and GiB of memory one replica of the app requests."""
+    resources = app_spec.get("resources") or {}
+    return {"cpu": parse_cpu(resources.get("cpu", DEFAULT_CPU)),
+            "memory_gb": parse_memory_gb(resources.get("memory", DEFAULT_MEMORY))}
+
+def enabled() -> bool:
+    return HOST_CPU > 0 or HOST_MEMORY_GB > 0
+
+def capacity() -> Dict[str, Optional[float]]:
+    return {"cpu": HOST_CPU or None, "memory_gb": HOST_MEMORY_GB or None}
+
+def usage(replicas: Dict[str, Tuple[Dict[str, Any], int]]) -> Dict[str, float]:
+    """Capacity requested by running replicas, from app name -> (spec, replicas)."""
+    used = {"cpu": 0.0, "memory_gb": 0.0}
+    for app_spec, count in replicas.values():
+        request = replica_request(app_spec)
+        used["cpu"] += request["cpu"] * count
+        used["memory_gb"] += request["memory_gb"] * count
+    return used
+
+def _fits(free: Dict[str, float], request: Dict[str, float]) -> bool:
+    return all(free[key] is None or request[key] <= free[key] + 1e-9 for key in ("cpu", "memory_gb"))
+
+def _take(free: Dict[str, float], request: Dict[str, float]):
+    for key in ("cpu", "memory_gb"):
+        if free[key] is not None:
+            free[key] -= request[key]
+
+def allocate(requests: List[Dict[str, Any]], used: Dict[str, float]) -> Dict[str, Any]:
+    """Grant scale-outs from the free capacity. Each request has app, priority, current,
+    target, min_replicas and request (one replica's cpu/memory_gb). Returns the round:
+    each request with granted (the replicas to scale to) and the capacity left."""
+    limits = capacity()
+    free = {key: (limits[key] - used[key]) if limits[key] else None for key in ("cpu", "memory_gb")}
+    grants = {r["app"]: r["current"] for r in requests}
+
+    # Replicas below minReplicas are not up for arbitration
+    for r in requests:
+        floor = min(max(r["min_replicas"], r["current"]), r["target"])
+        _take(free, {key: value * (floor - r["current"]) for key, value in r["request"].items()})
+        grants[r["app"]] = floor
+
+    for tier in sorted({r["priority"] for r in requests}, reverse=True):
+        wanting = [r for r in requests if r["priority"] == tier]
+        while True:
+            candidates = [r for r in wanting if grants[r["app"]] < r["target"] and _fits(free, r["request"])]
+            if not candidates:
+                break
+            # The app furthest from what it asked for, relative to the size of its ask, goes next
+            r = min(candidates, key=lambda r: ((grants[r["app"]] - r["current"]) / (r["target"] - r["current"]), r["app"]))
+            _take(free, r["request"])
+            grants[r["app"]] += 1
+
+    decisions = []
+    for r in requests:
+        granted = grants[r["app"]]
+        decision = {"app": r["app"], "priority": r["priority"], "current": r["current"],
+                    "requested": r["target"], "granted": granted}
+        if granted < r["target"]:
+            decision["deferred"] = r["target"] - granted
+            decision["reason"] = (f"host capacity is contended: granted {granted - r['current']} of "
+                                  f"{r['target'] - r['current']} replicas")
+        decisions.append(decision)
+    return {
+        "timestamp": time.time(),
+        "capacity": limits,
+        "used": {key: round(value, 3) for key, value in used.items()},
+        "free": {key: (round(value, 3) if value is not None else None) for key, value in free.items()},
+        "decisions": decisions
+    }
+
+class CapacityArbiter:
+    """Keeps the latest arbitration round for GET /scaling/capacity."""
+
+    def __init__(self):
+        self._lock = threading.Lock()
+        self.last_round: Optional[Dict[str, Any]] = None
+
+    def arbitrate(self, requests: List[Dict[str, Any]], used: Dict[str, float]) -> Dict[str, Any]:
+        round_ = allocate(requests, used)
+        with self._lock:
+            self.last_round = round_
+        return round_
+
+    def describe(self, used: Dict[str, float]) -> Dict[str, Any]:
+        limits = capacity()
+        with self._lock:
+            last_round = self.last_round
+        return {
+            "enabled": enabled(),
+            "capacity": limits,
+            "used": {key: round(value, 3) for key, value in used.items()},
+            "last_round": last_round
+        }
@@ -0,0 +1,45 @@
+"""
+Availability floors.
+With `availability.minReady`, automated operations never take an app below
+that many ready replicas: the autoscaler's scale-in, outlier quarantine and
+the removal of old replicas during a rollout. minReady is a replica count
+or a percentage of the replicas the app runs, rounded up. An operation that
+would break the floor is queued and retried until enough replicas are ready
+again (on each container monitoring pass, every 10 seconds). Manual
+scaling and stop/delete are not held back.
+"""
+
+import math
+from typing import Any, Dict, Optional, Tuple
+
+def validate_availability(config: Any) -> Tuple[Optional[Dict[str, Any]], Optional[str]]:
+    """Normalize `availability`. Returns (config to store or None, error)."""
+    if config is None:
+        return None, None
+    if not isinstance(config, dict):
+        return None, "availability must be an object"
+    min_ready = config.get("minReady")
+    if min_ready is None:
+        return None, None
+    if isinstance(min_ready, str) and min_ready.strip().endswith("%"):
+        try:
+            percent = float(min_ready.strip()[:-1])
+        except ValueError:
+            return None, f"availability.minReady {min_ready} is not a valid percentage"
+        if not 0 < percent <= 100:
+            return None, "availability.minReady must be a percentage between 0% and 100%"
+        return {"minReady": f"{percent:g}%"}, None
+    if not isinstance(min_ready, int) or isinstance(min_ready, bool) or min_ready < 1:
+        return None, "availability.minReady must be a positive replica count or a percentage like \"50%\""
+    return {"minReady": min_ready}, None
+
+def availability_config(app_spec: Dict[str, Any]) -> Optional[Dict[str, Any]]:
+    return app_spec.get("availability")
+
+def floor(config: Dict[str, Any], replicas: int) -> int:
+    """Ready replicas an app running `replicas` replicas must keep. Never more than replicas,
+    so an app can always be scaled in to fewer replicas than minReady."""
+    min_ready = config["minReady"]
+    if isinstance(min_ready, str):
+        min_ready = math.ceil(float(min_ready[:-1]) * replicas / 100)
+    return min(min_ready, replicas)
@@ -0,0 +1,86 @@
+"""
+App bundles: one app's definition, exported from one controller and imported
+into another (dev -> staging -> prod).
+A bundle is a JSON document with the app's spec revisions (oldest first), the
+stored scaling section and access rules, and the names of the secrets its
+spec references. Secret values are never exported; the target controller
+must have secrets of the same names. A checksum over the contents catches
+bundles that were truncated or edited by hand.
+"""
+
+import copy
+import hashlib
+import json
+import time
+from typing import Any, Dict, List, Optional, Tuple
+
+from .edge_auth import secret_refs
+from . import edge_tls
+
+BUNDLE_FORMAT = "orchestry.app-bundle/v1"
+# Revisions kept in a bundle, newest ones first
+MAX_BUNDLE_REVISIONS = 50
+# Keys of the stored spec that can change without a new revision
+CONFIG_KEYS = ("allowFrom", "denyFrom")
+
+def _checksum(bundle: Dict[str, Any]) -> str:
+    contents = {key: value for key, value in bundle.items() if key != "checksum"}
+    return hashlib.sha256(json.dumps(contents, sort_keys=True, default=str).encode()).hexdigest()
+
+def build_bundle(state_store: Any, app_name: str, source: Optional[str] = None) -> Dict[str, Any]:
+    """Export an app. Returns the bundle or {"error": ...}."""
+    record = state_store.get_app(app_name)
+    if not record:
+        return {"error": f"App {app_name} not found"}
+    revisions = []
+    for item in reversed(state_store.list_app_revisions(app_name, limit=MAX_BUNDLE_REVISIONS)):
+        revision = state_store.get_app_revision(app_name, item["revision"])
+        if revision:
+            revisions.append({key: revision[key] for key in ("revision", "spec", "source", "created_at")})
+    if not revisions:
+        return {"error": f"App {app_name} has no recorded revision to export"}
+
+    spec = record.spec or {}
+    bundle = {
+        "format": BUNDLE_FORMAT,
+        "app": app_name,
+        "namespace": record.namespace,
+        "exported_at": time.time(),
+        "exported_from": source,
+        "revisions": revisions,
+        "scaling": spec.get("scaling"),
+        "mode": record.mode,
+        "config": {key: spec.get(key) or [] for key in CONFIG_KEYS},
+        "secrets": sorted(secret_refs(spec.get("auth")) | edge_tls.secret_refs(spec.get("tls")))
+    }
+    bundle["checksum"] = _checksum(bundle)
+    return bundle
+
+def validate_bundle(bundle: Any) -> Optional[str]:
+    """Error message if bundle is not an intact app bundle, else None."""
+    if not isinstance(bundle, dict) or bundle.get("format") != BUNDLE_FORMAT:
+        return f"not an app bundle: format must be {BUNDLE_FORMAT}"
+    if bundle.get("checksum") != _checksum(bundle):
+        return "bundle checksum does not match its contents; it was truncated or edited"
+    revisions = bundle.get("revisions")
+    if not isinstance(revisions, list) or not revisions:
+        return "bundle has no revisions"
+    for revision in revisions:
+        spec = revision.get("spec") if isinstance(revision, dict) else None
+        if not isinstance(spec, dict) or (spec.get("metadata") or {}).get("name") != bundle.get("app"):
+            return f"bundle revision {revision.get('revision') if isinstance(revision, dict) else revision!r} is not a spec of {bundle.get('app')}"
+    return None
+
+def import_source(bundle: Dict[str, Any], revision: Dict[str, Any], requested_by: Optional[str]) -> Dict[str, Any]:
+    """The source recorded with an imported revision."""
+    return {
+        "imported_from": bundle.get("exported_from"),
+        "imported_revision": revision.get("revision"),
+        "original_source": revision.get("source"),
+        "requested_by": requested_by
+    }
+
+def history_and_latest(bundle: Dict[str, Any]) -> Tuple[List[Dict[str, Any]], Dict[str, Any]]:
+    """The revisions to record as history, and the latest one, which is registered."""
+    revisions = [copy.deepcopy(revision) for revision in bundle["revisions"]]
+    return revisions[:-1], revisions[-1]
@@ -0,0 +1,267 @@
+"""
+Catalog of reusable app templates.
+A template is an app spec with `{{parameter}}` placeholders plus the
+parameters it takes. `orchestry catalog deploy redis --name cache1 --set
+memory=512Mi` fills in the placeholders and registers the result like any
+other spec. Built-in templates ship with the controller; admins can add their
+own, which are stored in the database.
+"""
+
+import re
+import copy
+import time
+import logging
+from typing import Any, Dict, List, Optional, Tuple
+
+logger = logging.getLogger(__name__)
+
+SETTING_KEY = "catalog_templates"
+SYSTEM_EVENT_SCOPE = "orchestry"
+
+TEMPLATE_NAME_PATTERN = re.compile(r"^[a-z0-9]([a-z0-9-]{0,38}[a-z0-9])?$")
+PLACEHOLDER_PATTERN = re.compile(r"\{\{\s*([A-Za-z][A-Za-z0-9_]*)\s*\}\}")
+PARAMETER_TYPES = ("string", "int")
+
+BUILTIN_TEMPLATES: Dict[str, Dict[str, Any]] = {
+    "redis": {
+        "description": "Single Redis instance. Reach it on the orchestry network as <name>-0:6379, or on hostPort.",
+        "parameters": {
+            "image": {"default": "redis:7-alpine", "description": "Redis image"},
+            "memory": {"default": "256Mi", "description": "Memory limit"},
+            "cpu": {"default": "250m", "description": "CPU limit"},
+            "hostPort": {"type": "int", "default": None, "description": "Publish Redis on this Docker host port"},
+        },
+        "spec": {
+            "apiVersion": "v1",
+            "kind": "App",
+            "metadata": {"labels": {"catalog": "redis"}},
+            "spec": {
+                "type": "http",
+                "image": "{{image}}",
+                "ports": [{"containerPort": 6379}],
+                "resources": {"cpu": "{{cpu}}", "memory": "{{memory}}"},
+                "hostPort": "{{hostPort}}",
+            },
+            "scaling": {"mode": "manual", "minReplicas": 1, "maxReplicas": 1},
+        },
+    },
+    "postgres": {
+        "description": "Single PostgreSQL instance. Reach it on the orchestry network as <name>-0:5432, or on hostPort.",
+        "parameters": {
+            "image": {"default": "postgres:16-alpine", "description": "PostgreSQL image"},
+            "password": {"required": True, "description": "Password of the database user"},
+            "user": {"default": "postgres", "description": "Database user"},
+            "database": {"default": "app", "description": "Database created on first start"},
+            "memory": {"default": "512Mi", "description": "Memory limit"},
+            "cpu": {"default": "500m", "description": "CPU limit"},
+            "hostPort": {"type": "int", "default": None, "description": "Publish PostgreSQL on this Docker host port"},
+        },
+        "spec": {
+            "apiVersion": "v1",
+            "kind": "App",
+            "metadata": {"labels": {"catalog": "postgres"}},
+            "spec": {
+                "type": "http",
+                "image": "{{image}}",
+                "ports": [{"containerPort": 5432}],
+                "resources": {"cpu": "{{cpu}}", "memory": "{{memory}}"},
+                "env": [
+                    {"name": "POSTGRES_PASSWORD", "value": "{{password}}"},
+                    {"name": "POSTGRES_USER", "value": "{{user}}"},
+                    {"name": "POSTGRES_DB", "value": "{{database}}"},
+                ],
+                "hostPort": "{{hostPort}}",
+            },
+            "scaling": {"mode": "manual", "minReplicas": 1, "maxReplicas": 1},
+        },
+    },
+    "echo": {
+        "description": "HTTP echo server that returns each request, for testing routing and scaling.",
+        "parameters": {
+            "image": {"default": "ealen/echo-server:0.9.2", "description": "Echo server image"},
+            "minReplicas": {"type": "int", "default": 1, "description": "Fewest replicas"},
+            "maxReplicas": {"type": "int", "default": 3, "description": "Most replicas"},
+        },
+        "spec": {
+            "apiVersion": "v1",
+            "kind": "App",
+            "metadata": {"labels": {"catalog": "echo"}},
+            "spec": {
+                "type": "http",
+                "image": "{{image}}",
+                "ports": [{"containerPort": 80}],
+                "env": [{"name": "PORT", "value": "80"}],
+                "resources": {"cpu": "100m", "memory": "64Mi"},
+            },
+            "scaling": {"minReplicas": "{{minReplicas}}", "maxReplicas": "{{maxReplicas}}"},
+            "healthCheck": {"path": "/", "port": 80},
+        },
+    },
+    "web": {
+        "description": "Generic autoscaled web app for any HTTP image.",
+        "parameters": {
+            "image": {"required": True, "description": "Image of the web app"},
+            "port": {"type": "int", "default": 8080, "description": "Port the app listens on"},
+            "healthPath": {"default": "/", "description": "Path that returns 200 when the app is healthy"},
+            "memory": {"default": "256Mi", "description": "Memory limit"},
+            "cpu": {"default": "250m", "description": "CPU limit"},
+            "minReplicas": {"type": "int", "default": 1, "description": "Fewest replicas"},
+            "maxReplicas": {"type": "int", "default": 5, "description": "Most replicas"},
+            "targetRPSPerReplica": {"type": "int", "default": 50, "description": "Requests per second each replica should handle"},
+        },
+        "spec": {
+            "apiVersion": "v1",
+            "kind": "App",
+            "metadata": {"labels": {"catalog": "web"}},
+            "spec": {
+                "type": "http",
+                "image": "{{image}}",
+                "ports": [{"containerPort": "{{port}}"}],
+                "resources": {"cpu": "{{cpu}}", "memory": "{{memory}}"},
+            },
+            "scaling": {
+                "minReplicas": "{{minReplicas}}",
+                "maxReplicas": "{{maxReplicas}}",
+                "targetRPSPerReplica": "{{targetRPSPerReplica}}",
+            },
+            "healthCheck": {"path": "{{healthPath}}", "port": "{{port}}"},
+        },
+    },
+}
+
+def _placeholders(value: Any) -> set:
+    if isinstance(value, str):
+        return set(PLACEHOLDER_PATTERN.findall(value))
+    if isinstance(value, dict):
+        return set().union(*(_placeholders(item) for item in value.values())) if value else set()
+    if isinstance(value, list):
+        return set().union(*(_placeholders(item) for item in value)) if value else set()
+    return set()
+
+def validate_template(name: Any, template: Any) -> Tuple[Optional[Dict[str, Any]], Optional[str]]:
+    """Normalize a custom template. Returns (template, error)."""
+    if not isinstance(name, str) or not TEMPLATE_NAME_PATTERN.match(name):
+        return None, "Template names must be 1-40 lowercase letters, digits or dashes"
+    if not isinstance(template, dict):
+        return None, "A template must be a mapping with description, parameters and spec"
+    spec = template.get("spec")
+    if not isinstance(spec, dict) or not isinstance(spec.get("spec"), dict):
+        return None, "template.spec must be an app spec"
+    parameters = template.get("parameters") or {}
+    if not isinstance(parameters, dict):
+        return None, "template.parameters must be a mapping"
+
+    normalized = {}
+    for key, parameter in parameters.items():
+        parameter = parameter if isinstance(parameter, dict) else {"default": parameter}
+        kind = parameter.get("type", "string")
+        if kind not in PARAMETER_TYPES:
+            return None, f"Parameter {key}: type must be one of {', '.join(PARAMETER_TYPES)}"
+        normalized[key] = {
+            "type": kind,
+            "required": bool(parameter.get("required", False)),
+            "default": parameter.get("default"),
+            "description": str(parameter.get("description", ""))
+        }
+    missing = _placeholders(spec) - set(normalized)
+    if missing:
+        return None, f"The spec uses undeclared parameters: {', '.join(sorted(missing))}"
+    return {"description": str(template.get("description", "")), "parameters": normalized, "spec": spec}, None
+
+def _coerce(key: str, parameter: Dict[str, Any], value: Any) -> Tuple[Any, Optional[str]]:
+    if value is None or parameter.get("type", "string") != "int":
+        return value, None
+    try:
+        return int(value), None
+    except (TypeError, ValueError):
+        return None, f"{key} must be an integer"
+
+def _fill(value: Any, values: Dict[str, Any]) -> Any:
+    """Replace placeholders. A string that is only a placeholder takes the value as is (an int
+    stays an int, and None drops the key); otherwise the value is formatted into the string."""
+    if isinstance(value, dict):
+        filled = {key: _fill(item, values) for key, item in value.items()}
+        return {key: item for key, item in filled.items() if item is not None}
+    if isinstance(value, list):
+        return [item for item in (_fill(item, values) for item in value) if item is not None]
+    if isinstance(value, str):
+        whole = PLACEHOLDER_PATTERN.fullmatch(value.strip())
+        if whole:
+            return values.get(whole.group(1))
+        return PLACEHOLDER_PATTERN.sub(lambda match: str(values.get(match.group(1), "")), value)
+    return value
+
+class Catalog:
+    """Built-in and admin-defined app templates."""
+
+    def __init__(self, state_store: Any):
+        self.state_store = state_store
+
+    def _custom(self) -> Dict[str, Dict[str, Any]]:
+        return self.state_store.get_setting(SETTING_KEY) or {}
+
+    def list(self) -> List[Dict[str, Any]]:
+        templates = [{"name": name, "builtin": True, **template} for name, template in BUILTIN_TEMPLATES.items()]
+        templates += [{"name": name, "builtin": False, **template} for name, template in sorted(self._custom().items())]
+        for template in templates:
+            template["parameters"] = {key: {"type": "string", "required": False, "default": None, **parameter}
+                                      for key, parameter in template["parameters"].items()}
+        return templates
+
+    def get(self, name: str) -> Optional[Dict[str, Any]]:
+        return next((template for template in self.list() if template["name"] == name), None)
+
+    def put(self, name: str, template: Any, user: str) -> Dict[str, Any]:
+        if name in BUILTIN_TEMPLATES:
+            return {"error": f"{name} is a built-in template"}
+        template, error = validate_template(name, template)
+        if error:
+            return {"error": error}
+        custom = self._custom()
+        custom[name] = {**template, "updated_by": user, "updated_at": time.time()}
+        if not self.state_store.save_setting(SETTING_KEY, custom):
+            return {"error": "Failed to save the template"}
+        self.state_store.log_event(SYSTEM_EVENT_SCOPE, "catalog_template_saved", {"template": name, "by": user})
+        return self.get(name)
+
+    def delete(self, name: str, user: str) -> Dict[str, Any]:
+        if name in BUILTIN_TEMPLATES:
+            return {"error": f"{name} is a built-in template"}
+        custom = self._custom()
+        if name not in custom:
+            return {"error": f"Template {name} not found"}
+        del custom[name]
+        if not self.state_store.save_setting(SETTING_KEY, custom):
+            return {"error": "Failed to delete the template"}
+        self.state_store.log_event(SYSTEM_EVENT_SCOPE, "catalog_template_deleted", {"template": name, "by": user})
+        return {"status": "deleted", "template": name}
+
+    def render(self, name: str, app_name: str, values: Optional[Dict[str, Any]] = None,
+               namespace: Optional[str] = None) -> Tuple[Optional[Dict[str, Any]], Optional[str]]:
+        """The app spec a template produces for app_name and the --set values. Returns (spec, error)."""
+        template = self.get(name)
+        if not template:
+            return None, f"Template {name} not found"
+        values = dict(values or {})
+        unknown = set(values) - set(template["parameters"])
+        if unknown:
+            return None, f"Unknown parameters for {name}: {', '.join(sorted(unknown))} " \
+                         f"(available: {', '.join(template['parameters'])})"
+
+        resolved = {}
+        for key, parameter in template["parameters"].items():
+            value = values.get(key, parameter.get("default"))
+            if value is None and parameter.get("required"):
+                return None, f"{name} needs a value for {key} (--set {key}=...)"
+            value, error = _coerce(key, parameter, value)
+            if error:
+                return None, error
+            resolved[key] = value
+
+        spec = _fill(copy.deepcopy(template["spec"]), resolved)
+        spec.setdefault("metadata", {})
+        spec["metadata"]["name"] = app_name
+        if namespace:
+            spec["metadata"]["namespace"] = namespace
+        spec["metadata"].setdefault("labels", {})["catalog"] = name
+        return spec, None
@@ -0,0 +1,177 @@
+"""
+Deployment freeze windows (change calendar).
+Freeze windows are periods in which registering or updating apps and taking
+them down is rejected, e.g. weekends or a holiday season. They can be set
+org-wide (a cluster setting) or per namespace (namespace config). A window is
+either weekly ("Fri 18:00" to "Mon 08:00") or one-off (ISO date-times), in a
+given time zone. A change can still go through during a window when the
+caller supplies an override reason; every override is recorded as an event.
+"""
+
+import re
+import time
+import logging
+from datetime import datetime, timedelta
+from typing import Any, Dict, Iterator, List, Optional, Tuple
+from zoneinfo import ZoneInfo, ZoneInfoNotFoundError
+
+logger = logging.getLogger(__name__)
+
+SYSTEM_EVENT_SCOPE = "orchestry"
+ORG_SETTING_KEY = "freeze_windows"
+ORG_SCOPE = "org"
+MAX_WINDOWS = 50
+DAYS = ("mon", "tue", "wed", "thu", "fri", "sat", "sun")
+_WEEKLY = re.compile(r"^(mon|tue|wed|thu|fri|sat|sun)[a-z]*\s+(\d{1,2}):(\d{2})$", re.IGNORECASE)
+WEEK_MINUTES = 7 * 24 * 60
+
+def _weekly_minute(value: str) -> Optional[int]:
+    """Minutes since Monday 00:00 for "Fri 18:00", or None if it is not a weekly time."""
+    match = _WEEKLY.match(value.strip())
+    if not match:
+        return None
+    hour, minute = int(match.group(2)), int(match.group(3))
+    if hour > 23 or minute > 59:
+        return None
+    return DAYS.index(match.group(1)[:3].lower()) * 24 * 60 + hour * 60 + minute
+
+def validate_windows(windows: Any) -> Tuple[List[Dict[str, Any]], Optional[str]]:
+    """Normalize a list of freeze windows. Returns (windows, error)."""
+    if windows is None:
+        return [], None
+    if not isinstance(windows, list):
+        return [], "freeze windows must be a list"
+    if len(windows) > MAX_WINDOWS:
+        return [], f"at most {MAX_WINDOWS} freeze windows are allowed"
+
+    result = []
+    for index, window in enumerate(windows):
+        if not isinstance(window, dict):
+            return [], f"freeze window {index} must be an object"
+        name = str(window.get("name") or f"window-{index + 1}")[:100]
+        timezone = window.get("timezone") or "UTC"
+        try:
+            ZoneInfo(timezone)
+        except (ZoneInfoNotFoundError, ValueError):
+            return [], f"freeze window {name}: unknown timezone {timezone!r}"
+        start, end = window.get("start"), window.get("end")
+        if not isinstance(start, str) or not isinstance(end, str):
+            return [], f"freeze window {name}: start and end are required"
+
+        start_minute, end_minute = _weekly_minute(start), _weekly_minute(end)
+        if start_minute is not None and end_minute is not None:
+            if start_minute == end_minute:
+                return [], f"freeze window {name}: start and end must differ"
+            result.append({"name": name, "type": "weekly", "start": start.strip(), "end": end.strip(),
+                           "timezone": timezone})
+            continue
+
+        try:
+            start_at = datetime.fromisoformat(start)
+            end_at = datetime.fromisoformat(end)
+        except ValueError:
+            return [], f"freeze window {name}: start and end must both be weekly times like 'Fri 18:00' " \
+                       f"or both ISO date-times like '2026-12-24T00:00'"
+        if start_at.tzinfo or end_at.tzinfo:
+            return [], f"freeze window {name}: give one-off times without an offset and set timezone instead"
+        if end_at <= start_at:
+            return [], f"freeze window {name}: end must be after start"
+        result.append({"name": name, "type": "once", "start": start_at.isoformat(timespec="minutes"),
+                       "end": end_at.isoformat(timespec="minutes"), "timezone": timezone})
+    return result, None
+
+def occurrences(window: Dict[str, Any], since: float, until: float) -> Iterator[Tuple[float, float]]:
+    """(starts_at, ends_at) Unix times of a window's occurrences overlapping [since, until)."""
+    tz = ZoneInfo(window["timezone"])
+    if window["type"] == "once":
+        start = datetime.fromisoformat(window["start"]).replace(tzinfo=tz).timestamp()
+        end = datetime.fromisoformat(window["end"]).replace(tzinfo=tz).timestamp()
+        if start < until and end > since:
+            yield start, end
+        return
+
+    start_minute, end_minute = _weekly_minute(window["start"]), _weekly_minute(window["end"])
+    duration = timedelta(minutes=(end_minute - start_minute) % WEEK_MINUTES)
+    local = datetime.fromtimestamp(since, tz)
+    week = (local - timedelta(days=local.weekday())).replace(hour=0, minute=0, second=0, microsecond=0)
+    # Start one week back so an occurrence that began before `since` is included
+    occurrence = week + timedelta(minutes=start_minute) - timedelta(days=7)
+    while occurrence.timestamp() < until:
+        end = occurrence + duration
+        if end.timestamp() > since:
+            yield occurrence.timestamp(), end.timestamp()
+        occurrence += timedelta(days=7)
+
+class ChangeCalendar:
+    """Answers whether a change to an app is inside a freeze window."""
+
+    def __init__(self, state_store: Any, namespaces: Any):
+        self.state_store = state_store
+        self.namespaces = namespaces
+
+    def org_windows(self) -> List[Dict[str, Any]]:
+        return self.state_store.get_setting(ORG_SETTING_KEY) or []
+
+    def set_org_windows(self, windows: Any) -> Dict[str, Any]:
+        windows, error = validate_windows(windows)
+        if error:
+            return {"error": error}
+        if not self.state_store.save_setting(ORG_SETTING_KEY, windows):
+            return {"error": "Failed to save freeze windows"}
+        self.state_store.log_event(SYSTEM_EVENT_SCOPE, "freeze_windows_updated", {"scope": ORG_SCOPE, "windows": windows})
+        return {"scope": ORG_SCOPE, "windows": windows}
+
+    def _scoped_windows(self, namespace: Optional[str]) -> List[Tuple[str, Dict[str, Any]]]:
+        scoped = [(ORG_SCOPE, window) for window in self.org_windows()]
+        if namespace:
+            scoped += [(namespace, window) for window in self.namespaces.get_config(namespace).get("freezeWindows") or []]
+        return scoped
+
+    def upcoming(self, namespace: Optional[str] = None, days: int = 14,
+                 now: Optional[float] = None) -> List[Dict[str, Any]]:
+        """Windows that apply to a namespace (or only org-wide ones), active or starting
+        within `days`, earliest first."""
+        now = now or time.time()
+        result = []
+        for scope, window in self._scoped_windows(namespace):
+            for starts_at, ends_at in occurrences(window, now, now + days * 86400):
+                result.append({
+                    "name": window["name"],
+                    "scope": scope,
+                    "starts_at": starts_at,
+                    "ends_at": ends_at,
+                    "active": starts_at <= now < ends_at,
+                    "timezone": window["timezone"]
+                })
+        return sorted(result, key=lambda item: item["starts_at"])
+
+    def active(self, namespace: Optional[str], now: Optional[float] = None) -> Optional[Dict[str, Any]]:
+        """The freeze window in effect for a namespace right now, if any."""
+        now = now or time.time()
+        current = [item for item in self.upcoming(namespace, days=0, now=now) if item["active"]]
+        return max(current, key=lambda item: item["ends_at"]) if current else None
+
+    def check(self, action: str, namespace: Optional[str], app_name: Optional[str], user: str,
+              override_reason: Optional[str] = None) -> Optional[Dict[str, Any]]:
+        """None if the change may go ahead, otherwise {"error", "window"}. Overrides during a
+        window are allowed and recorded."""
+        window = self.active(namespace)
+        if not window:
+            return None
+        ends = datetime.fromtimestamp(window["ends_at"], ZoneInfo(window["timezone"])).strftime("%a %Y-%m-%d %H:%M %Z")
+        if override_reason and override_reason.strip():
+            self.state_store.log_event(app_name or SYSTEM_EVENT_SCOPE, "freeze_window_override", {
+                "action": action,
+                "namespace": namespace,
+                "window": window["name"],
+                "scope": window["scope"],
+                "user": user,
+                "reason": override_reason.strip()[:500]
+            })
+            logger.warning(f"{user} overrode freeze window {window['name']} to {action} {app_name}: {override_reason}")
+            return None
+        return {
+            "error": f"Changes are frozen by the {window['scope']} freeze window '{window['name']}' until {ends}; "
+                     f"supply an override reason to proceed",
+            "window": window
+        }
@@ -0,0 +1,130 @@
+"""
+Chaos testing actions for resilience validation.
+Kills replicas, injects health-check failures and pauses nginx so operators can
+verify self-healing and alerting in staging. Every action is logged as an event.
+"""
+
+import random
+import threading
+import logging
+from typing import Any, Dict, Optional
+
+logger = logging.getLogger(__name__)
+
+# Events for actions that are not tied to a single app are logged under this name
+SYSTEM_EVENT_SCOPE = "orchestry"
+
+MAX_CHAOS_DURATION_SECONDS = 600
+
+class ChaosMonkey:
+    """Runs chaos actions against the components owned by the controller."""
+
+    def __init__(self, app_manager: Any, nginx_manager: Any, state_store: Any):
+        self.app_manager = app_manager
+        self.nginx = nginx_manager
+        self.state_store = state_store
+        self._nginx_paused = False
+        self._lock = threading.Lock()
+
+    def _ready_instances(self, app_name: str):
+        with self.app_manager._lock:
+            return [inst for inst in self.app_manager.instances.get(app_name, []) if inst.state == "ready"]
+
+    def kill_replica(self, app_name: str, container_id: Optional[str] = None) -> Dict[str, Any]:
+        """Kill one replica of an app (a random one unless container_id is given)."""
+        instances = self._ready_instances(app_name)
+        if not instances:
+            return {"error": f"App {app_name} has no running replicas"}
+
+        if container_id:
+            matches = [inst for inst in instances if inst.container_id.startswith(container_id)]
+            if not matches:
+                return {"error": f"Replica {container_id} not found for app {app_name}"}
+            victim = matches[0]
+        else:
+            victim = random.choice(instances)
+
+        try:
+            container = self.app_manager.docker_client.containers.get(victim.container_id)
+            container.kill()
+        except Exception as e:
+            logger.error(f"Chaos: failed to kill replica {victim.container_id[:12]} of {app_name}: {e}")
+            return {"error": str(e)}
+
+        result = {
+            "action": "kill_replica",
+            "app": app_name,
+            "container_id": victim.container_id[:12],
+            "replicas_before": len(instances)
+        }
+        logger.warning(f"🐒 Chaos: killed replica {victim.container_id[:12]} of {app_name}")
+        self.state_store.log_event(app_name, "chaos_kill_replica", result)
+        return result
+
+    def inject_health_failure(self, app_name: str, duration_seconds: int, replicas: int = 1) -> Dict[str, Any]:
+        """Make some replicas of an app fail health checks for duration_seconds."""
+        instances = self._ready_instances(app_name)
+        checker = self.app_manager.health_checker
+        candidates = [inst for inst in instances if not checker.has_injected_failure(inst.container_id)]
+        if not candidates:
+            return {"error": f"App {app_name} has no healthy replicas to fail"}
+
+        duration_seconds = min(duration_seconds, MAX_CHAOS_DURATION_SECONDS)
+        targets = random.sample(candidates, min(replicas, len(candidates)))
+        for inst in targets:
+            checker.inject_failure(inst.container_id, duration_seconds)
+            timer = threading.Timer(duration_seconds, checker.clear_injected_failure, args=(inst.container_id,))
+            timer.daemon = True
+            timer.start()
+
+        result = {
+            "action": "inject_health_failure",
+            "app": app_name,
+            "container_ids": [inst.container_id[:12] for inst in targets],
+            "duration_seconds": duration_seconds
+        }
+        logger.warning(f"🐒 Chaos: failing health checks for {result['container_ids']} of {app_name} for {duration_seconds}s")
+        self.state_store.log_event(app_name, "chaos_health_failure", result)
+        return result
+
+    def pause_nginx(self, duration_seconds: int) -> Dict[str, Any]:
+        """Pause the nginx container for duration_seconds, then unpause it."""
+        with self._lock:
+            if self._nginx_paused:
+                return {"error": "Nginx is already paused by a chaos action"}
+            self._nginx_paused = True
+
+        duration_seconds = min(duration_seconds, MAX_CHAOS_DURATION_SECONDS)
+        try:
+            self.nginx.pause()
+        except Exception as e:
+            with self._lock:
+                self._nginx_paused = False
+            logger.error(f"Chaos: failed to pause nginx: {e}")
+            return {"error": str(e)}
+
+        timer = threading.Timer(duration_seconds, self._unpause_nginx)
+        timer.daemon = True
+        timer.start()
+
+        result = {
+            "action": "pause_nginx",
+            "container": self.nginx.nginx_container_name,
+            "duration_seconds": duration_seconds
+        }
+        logger.warning(f"🐒 Chaos: paused nginx for {duration_seconds}s")
+        self.state_store.log_event(SYSTEM_EVENT_SCOPE, "chaos_pause_nginx", result)
+        return result
+
+    def _unpause_nginx(self):
+        try:
+            self.nginx.unpause()
+            logger.info("🐒 Chaos: nginx unpaused")
+            self.state_store.log_event(SYSTEM_EVENT_SCOPE, "chaos_unpause_nginx", {
+                "container": self.nginx.nginx_container_name
+            })
+        except Exception as e:
+            logger.error(f"Chaos: failed to unpause nginx: {e}")
+        finally:
+            with self._lock:
+                self._nginx_paused = False
@@ -0,0 +1,33 @@
+"""
+CLI releases advertised by the controller.
+GET /versions tells the CLI which of its versions the controller recommends
+and the oldest one it still works with, so `orchestry version --check` can
+report drift and `orchestry self-update` knows what to install. Standalone
+CLI binaries are downloaded from ORCHESTRY_CLI_DOWNLOAD_URL, a template with
+{version}, {os} and {arch} placeholders; every binary must be published with
+a `<url>.sha256` checksum next to it. CLIs installed with pip upgrade from
+the package index instead.
+"""
+
+import os
+import re
+from typing import Any, Dict, Optional
+
+CLI_VERSION = os.getenv("ORCHESTRY_CLI_VERSION", "")
+CLI_MIN_VERSION = os.getenv("ORCHESTRY_CLI_MIN_VERSION", "")
+CLI_DOWNLOAD_URL = os.getenv("ORCHESTRY_CLI_DOWNLOAD_URL", "")
+# Platforms standalone CLI binaries are built for, as os-arch
+PLATFORMS = ("linux-amd64", "linux-arm64", "darwin-amd64", "darwin-arm64", "windows-amd64")
+VERSION_PATTERN = re.compile(r"^v?\d+(\.\d+){0,2}$")
+
+def _version(value: str) -> Optional[str]:
+    return value.strip().lstrip("v") if value and VERSION_PATTERN.match(value.strip()) else None
+
+def describe() -> Dict[str, Any]:
+    """The CLI versions this controller advertises and where binaries are downloaded from."""
+    return {
+        "recommended": _version(CLI_VERSION),
+        "minimum": _version(CLI_MIN_VERSION),
+        "download_url": CLI_DOWNLOAD_URL or None,
+        "platforms": list(PLATFORMS)
+    }
@@ -0,0 +1,108 @@
+"""
+App cloning.
+A clone is a new app registered from an existing app's latest revision, e.g.
+a review or preview environment of a service. Settings changed at runtime
+since that revision (the scaling policy, IP access rules, access log sampling
+and header rules) are carried over, and secrets the spec references (edge
+auth and TLS) are referenced by the clone as they are. `set` then overrides
+fields of the copy: `image=...`, `env.NAME=...`, or any dotted path such as
+`resources.cpu` (under spec) or `scaling.maxReplicas`. The clone is
+registered stopped, in the source's namespace unless another one is given.
+"""
+
+import copy
+import re
+from typing import Any, Dict, Optional
+
+from .namespaces import validate_namespace_name
+
+APP_NAME_PATTERN = re.compile(r"^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$")
+MAX_OVERRIDES = 50
+# Paths that start with these are set on the spec document itself, everything else under `spec`
+ROOT_FIELDS = {"metadata", "spec", "scaling", "healthCheck", "passiveHealth", "tracing", "auth", "tls", "accessLog",
+               "errorPages", "headers", "publicStatus", "latencyWeighting", "slowStart", "outlierDetection",
+               "continuousDeployment", "placement", "dnsSteering", "availability", "dependsOn", "ttl", "expiresAt"}
+# Settings that can change without a new revision, and where the app record and the spec keep them
+RUNTIME_SETTINGS = (("scaling", None), ("accessLog", None), ("headers", None),
+                    ("allowFrom", "spec"), ("denyFrom", "spec"))
+
+def _set_path(document: Dict[str, Any], path: str, value: Any) -> Optional[str]:
+    """Set a dotted path of document, creating mappings on the way. Returns an error or None."""
+    parts = path.split(".")
+    if not all(parts):
+        return f"{path!r} is not a valid path"
+    if parts[0] == "env" and len(parts) == 2:
+        env = document["spec"].setdefault("env", [])
+        entry = next((entry for entry in env if isinstance(entry, dict) and entry.get("name") == parts[1]), None)
+        if entry is None:
+            env.append({"name": parts[1], "value": str(value)})
+        else:
+            entry.pop("valueFrom", None)
+            entry["value"] = str(value)
+        return None
+    if parts[0] not in ROOT_FIELDS:
+        parts = ["spec"] + parts
+    if parts[:2] == ["metadata", "name"] or parts[:2] == ["metadata", "namespace"]:
+        return "the clone's name and namespace are set with target and namespace"
+    node = document
+    for part in parts[:-1]:
+        child = node.get(part)
+        if child is None:
+            child = node[part] = {}
+        if not isinstance(child, dict):
+            return f"cannot set {path}: {part} is not a mapping"
+        node = child
+    node[parts[-1]] = value
+    return None
+
+def plan_clone(state_store: Any, app_name: str, target: str, namespace: Optional[str] = None,
+               overrides: Optional[Dict[str, Any]] = None) -> Dict[str, Any]:
+    """Work out the spec of a clone of app_name. Returns {"source", "target", "namespace", "spec"}
+    or {"error"}."""
+    if not isinstance(target, str) or not APP_NAME_PATTERN.match(target):
+        return {"error": "target must be 1-63 lowercase letters, digits and hyphens, starting and ending "
+                         "with a letter or digit"}
+    overrides = overrides or {}
+    if len(overrides) > MAX_OVERRIDES:
+        return {"error": f"A clone can override at most {MAX_OVERRIDES} fields"}
+
+    source = state_store.get_app(app_name)
+    if not source:
+        return {"error": f"App {app_name} not found"}
+    if state_store.get_app(target):
+        return {"error": f"App {target} already exists"}
+    namespace, error = validate_namespace_name(namespace or source.namespace)
+    if error:
+        return {"error": error}
+    revision = state_store.get_app_revision(app_name)
+    if not revision:
+        return {"error": f"App {app_name} has no recorded revisions; register it again before cloning"}
+
+    spec = copy.deepcopy(revision["spec"])
+    spec.setdefault("spec", {})
+    for field, section in RUNTIME_SETTINGS:
+        holder = spec["spec"] if section else spec
+        value = (source.spec or {}).get(field)
+        if value:
+            holder[field] = copy.deepcopy(value)
+        else:
+            holder.pop(field, None)
+    # Spec files name the app in metadata and usually in its `app` label too
+    metadata = spec.setdefault("metadata", {})
+    labels = metadata.get("labels")
+    if isinstance(labels, dict) and labels.get("app") == app_name:
+        labels["app"] = target
+    metadata["name"] = target
+    metadata["namespace"] = namespace
+
+    for path, value in overrides.items():
+        error = _set_path(spec, path, value)
+        if error:
+            return {"error": error}
+
+    return {
+        "source": {"app": app_name, "namespace": source.namespace, "revision": revision["revision"]},
+        "target": target,
+        "namespace": namespace,
+        "spec": spec
+    }
@@ -19,13 +19,32 @@ import threading
 import uuid
 import json
 import socket
-from typing import Optional, Dict, Callable, Any
+import requests
+from collections import deque
+from typing import Optional, Dict, List, Callable, Any
 from dataclasses import dataclass, asdict
 from enum import Enum
 from contextlib import contextmanager
 
 logger = logging.getLogger(__name__)
 
+# Controller release and the schema version it reads/writes. Nodes whose schema
+# versions differ by more than one cannot share a cluster, which leaves room for
+# one rolling upgrade at a time.
+CONTROLLER_VERSION = os.getenv("ORCHESTRY_VERSION", "1.0.0")
+SCHEMA_VERSION = 2
+
+# How long a leadership transfer may take before other nodes may campaign again
+LEADER_TRANSFER_TIMEOUT_SECONDS = 20
+
+# How far back cluster_events are inspected when looking for competing leaders
+SPLIT_BRAIN_LOOKBACK_SECONDS = 120
+PEER_PROBE_TIMEOUT_SECONDS = 2
+
+# Lease validity is decided on database time, so node clocks may drift; a node
+# whose clock is further off than this from the database's is reported anyway
+CLOCK_SKEW_WARNING_SECONDS = float(os.getenv("ORCHESTRY_CLOCK_SKEW_WARNING_SECONDS", "2"))
+
 class NodeState(Enum):
     FOLLOWER = "follower"
     CANDIDATE = "candidate" 
@@ -45,10 +64,15 @@ class ClusterNode:
     term: int = 0
     votes_received: int = 0
     is_healthy: bool = True
+    advertise_url: Optional[str] = None
+    version: Optional[str] = None
+    schema_version: Optional[int] = None
+    clock_skew_seconds: Optional[float] = None
 
 @dataclass
 class LeaderLease:
-    """Leader lease information stored in database"""
+    """Leader lease information stored in database. Times are on this node's clock;
+    valid and remaining_seconds are decided on the database's."""
     leader_id: str
     term: int
     acquired_at: float
@@ -56,6 +80,8 @@ class LeaderLease:
     renewed_at: float
     hostname: str
     api_url: str
+    remaining_seconds: float = 0.0
+    valid: bool = False
 
 class DistributedController:
     """
@@ -87,6 +113,9 @@ class DistributedController:
         controller_lb_port = os.getenv("CONTROLLER_LB_PORT", "8000")
         self.external_api_url = f"http://{controller_lb_host}:{controller_lb_port}"
 
+        # URL this node advertises to clients when it holds leadership
+        self.advertise_url = os.getenv("CLUSTER_ADVERTISE_URL", self.external_api_url)
+
         # Cluster state
         self.state = NodeState.FOLLOWER
         self.current_term = 0
@@ -117,6 +146,16 @@ class DistributedController:
         # Cluster membership
         self.cluster_nodes: Dict[str, ClusterNode] = {}
 
+        # Elections are skipped until this time after a deliberate step-down
+        self._election_hold_until = 0.0
+
+        # Split-brain watchdog reports (most recent last)
+        self.split_brain_reports: deque = deque(maxlen=50)
+
+        # This node's clock minus the database's, measured on every heartbeat
+        self.clock_skew_seconds: Optional[float] = None
+        self._clock_skewed = False
+
         logger.info(f"🏗️  Initializing distributed controller node {self.node_id}")
         logger.info(f"📍 Node: {self.hostname}:{self.port} -> {self.api_url}")
 
@@ -131,6 +170,9 @@ class DistributedController:
         # Initialize database tables for clustering
         self._init_cluster_tables()
 
+        # Refuse to join a cluster we cannot safely share state with
+        self._check_compatibility()
+
         # Register this node
         self._register_node()
 
@@ -216,6 +258,20 @@ class DistributedController:
                         )
                     """)
 
+                    cursor.execute("ALTER TABLE cluster_nodes ADD COLUMN IF NOT EXISTS advertise_url VARCHAR(512)")
+                    cursor.execute("ALTER TABLE cluster_nodes ADD COLUMN IF NOT EXISTS version VARCHAR(64)")
+                    cursor.execute("ALTER TABLE cluster_nodes ADD COLUMN IF NOT EXISTS schema_version INTEGER")
+                    cursor.execute("ALTER TABLE cluster_nodes ADD COLUMN IF NOT EXISTS clock_skew_seconds DOUBLE PRECISION")
+
+                    # Cluster-wide settings such as the current schema version
+                    cursor.execute("""
+                        CREATE TABLE IF NOT EXISTS cluster_metadata (
+                            key VARCHAR(255) PRIMARY KEY,
+                            value TEXT NOT NULL,
+                            updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+                        )
+                    """)
+
                     # Create indices for performance
                     cursor.execute("CREATE INDEX IF NOT EXISTS idx_cluster_nodes_state ON cluster_nodes(state)")
                     cursor.execute("CREATE INDEX IF NOT EXISTS idx_cluster_nodes_heartbeat ON cluster_nodes(last_heartbeat)")
@@ -239,12 +295,16 @@ class DistributedController:
                 with conn.cursor() as cursor:
                     cursor.execute("""
                         INSERT INTO cluster_nodes
-                        (node_id, hostname, port, api_url, state, term, last_heartbeat, is_healthy)
-                        VALUES (%s, %s, %s, %s, %s, %s, CURRENT_TIMESTAMP, %s)
+                        (node_id, hostname, port, api_url, state, term, last_heartbeat, is_healthy, advertise_url,
+                         version, schema_version)
+                        VALUES (%s, %s, %s, %s, %s, %s, CURRENT_TIMESTAMP, %s, %s, %s, %s)
                         ON CONFLICT (node_id) DO UPDATE SET
                             hostname = EXCLUDED.hostname,
                             port = EXCLUDED.port,
                             api_url = EXCLUDED.api_url,
+                            advertise_url = EXCLUDED.advertise_url,
+                            version = EXCLUDED.version,
+                            schema_version = EXCLUDED.schema_version,
                             state = EXCLUDED.state,
                             term = EXCLUDED.term,
                             last_heartbeat = CURRENT_TIMESTAMP,
@@ -257,7 +317,10 @@ class DistributedController:
                         self.api_url,
                         self.state.value,
                         self.current_term,
-                        True
+                        True,
+                        self.advertise_url,
+                        CONTROLLER_VERSION,
+                        SCHEMA_VERSION
                     ))
                     conn.commit()
 
@@ -267,6 +330,49 @@ class DistributedController:
 
         logger.info(f"✅ Node {self.node_id} registered in cluster")
 
+    def _check_compatibility(self):
+        """Verify this controller's schema version can coexist with the database and live nodes"""
+        with self._get_db_connection() as conn:
+            with conn.cursor() as cursor:
+                cursor.execute("SELECT value FROM cluster_metadata WHERE key = 'schema_version'")
+                row = cursor.fetchone()
+                cluster_schema = int(row[0]) if row else None
+
+                if cluster_schema is not None and cluster_schema > SCHEMA_VERSION:
+                    raise RuntimeError(
+                        f"Database schema version {cluster_schema} is newer than this controller "
+                        f"supports ({SCHEMA_VERSION}); upgrade this node before joining"
+                    )
+
+                cursor.execute("""
+                    SELECT node_id, version, schema_version FROM cluster_nodes
+                    WHERE node_id != %s
+                      AND state != %s
+                      AND last_heartbeat >= CURRENT_TIMESTAMP - INTERVAL '60 seconds'
+                """, (self.node_id, NodeState.STOPPED.value))
+
+                incompatible = [
+                    f"{node_id} (v{version}, schema {schema})"
+                    for node_id, version, schema in cursor.fetchall()
+                    if abs((schema or 1) - SCHEMA_VERSION) > 1
+                ]
+                if incompatible:
+                    raise RuntimeError(
+                        f"Controller v{CONTROLLER_VERSION} (schema {SCHEMA_VERSION}) is incompatible "
+                        f"with live nodes: {', '.join(incompatible)}"
+                    )
+
+                # Record the newest schema in use so older controllers refuse to join
+                cursor.execute("""
+                    INSERT INTO cluster_metadata (key, value) VALUES ('schema_version', %s)
+                    ON CONFLICT (key) DO UPDATE SET
+                        value = GREATEST(cluster_metadata.value::int, EXCLUDED.value::int)::text,
+                        updated_at = CURRENT_TIMESTAMP
+                """, (str(SCHEMA_VERSION),))
+                conn.commit()
+
+        logger.info(f"🤝 Version handshake passed: v{CONTROLLER_VERSION}, schema {SCHEMA_VERSION}")
+
     def _start_background_tasks(self):
         """Start background monitoring and coordination tasks"""
         # Heartbeat task - maintain node presence
@@ -337,6 +443,7 @@ class DistributedController:
             try:
                 self._update_cluster_membership()
                 self._cleanup_stale_nodes()
+                self._check_split_brain()
 
             except Exception as e:
                 logger.error(f"❌ Cluster monitoring error: {e}")
@@ -348,37 +455,85 @@ class DistributedController:
         try:
             with self._get_db_connection() as conn:
                 with conn.cursor() as cursor:
+                    skew = self._measure_clock_skew(cursor)
                     cursor.execute("""
                         UPDATE cluster_nodes 
                         SET last_heartbeat = CURRENT_TIMESTAMP,
                             state = %s,
                             term = %s,
                             is_healthy = %s,
+                            version = %s,
+                            schema_version = %s,
+                            clock_skew_seconds = %s,
                             updated_at = CURRENT_TIMESTAMP
                         WHERE node_id = %s
                     """, (
                         self.state.value,
                         self.current_term,
                         True,
+                        CONTROLLER_VERSION,
+                        SCHEMA_VERSION,
+                        skew,
                         self.node_id
                     ))
                     conn.commit()
 
+            self._check_clock_skew(skew)
+
         except Exception as e:
             logger.error(f"❌ Failed to send heartbeat: {e}")
 
+    def _measure_clock_skew(self, cursor) -> float:
+        """This node's clock minus the database's, in seconds, halving the query's round trip"""
+        sent = time.time()
+        cursor.execute("SELECT EXTRACT(EPOCH FROM clock_timestamp())")
+        received = time.time()
+        db_now = float(cursor.fetchone()[0])
+        self.clock_skew_seconds = round((sent + received) / 2 - db_now, 3)
+        return self.clock_skew_seconds
+
+    def _check_clock_skew(self, skew: float):
+        """Warn once when this node's clock drifts past the threshold, and once when it is back"""
+        skewed = abs(skew) > CLOCK_SKEW_WARNING_SECONDS
+        if skewed == self._clock_skewed:
+            return
+        self._clock_skewed = skewed
+        if skewed:
+            logger.warning(f"🕰️  Clock of {self.node_id} is {skew:+.3f}s off the database's "
+                           f"(threshold {CLOCK_SKEW_WARNING_SECONDS}s); leases are unaffected, but check NTP")
+            self._log_cluster_event("clock_skew_detected", {"skew_seconds": skew,
+                                                            "threshold_seconds": CLOCK_SKEW_WARNING_SECONDS})
+        else:
+            logger.info(f"🕰️  Clock of {self.node_id} is back within {CLOCK_SKEW_WARNING_SECONDS}s of the database's")
+            self._log_cluster_event("clock_skew_resolved", {"skew_seconds": skew})
+
+    def _db_time(self) -> float:
+        """The database's current time as a Unix timestamp"""
+        with self._get_db_connection() as conn:
+            with conn.cursor() as cursor:
+                cursor.execute("SELECT EXTRACT(EPOCH FROM clock_timestamp())")
+                return float(cursor.fetchone()[0])
+
     def _should_start_election(self) -> bool:
         """Check if we should start a leader election"""
         try:
             # Check if there's a current valid leader
             current_lease = self._get_current_lease()
-            if current_lease and current_lease.expires_at > time.time():
+            if current_lease and current_lease.valid:
                 # Valid leader exists
                 if current_lease.leader_id != self.leader_id:
                     self.leader_id = current_lease.leader_id
                     logger.info(f"👑 Acknowledged leader: {self.leader_id}")
                 return False
 
+            if time.time() < self._election_hold_until:
+                return False
+
+            # Let the designated node win a leadership transfer in progress
+            transfer = self._get_pending_transfer()
+            if transfer and transfer["to"] != self.node_id:
+                return False
+
             # No valid leader - check if we should start election
             if self.state == NodeState.FOLLOWER:
                 logger.info("🗳️  No valid leader found, considering election...")
@@ -485,7 +640,7 @@ class DistributedController:
 
         logger.info(f"👑 Successfully became cluster leader")
 
-    def _lose_leadership(self):
+    def _lose_leadership(self, reason: str = "lease_expired"):
         """Lose leadership (called when lease expires or fails to renew)"""
         if not self.is_leader:
             return
@@ -504,7 +659,7 @@ class DistributedController:
         self._log_cluster_event("leader_lost", {
             "term": self.current_term,
             "node_id": self.node_id,
-            "reason": "lease_expired"
+            "reason": reason
         })
 
         # Notify application that we lost leadership
@@ -535,7 +690,128 @@ class DistributedController:
         except Exception as e:
             logger.error(f"❌ Failed to release leadership lease: {e}")
 
-        self._lose_leadership()
+        self._lose_leadership(reason="released")
+
+    def _get_pending_transfer(self) -> Optional[Dict[str, Any]]:
+        """Get the leadership transfer in progress, if it has not timed out (on database time)"""
+        with self._get_db_connection() as conn:
+            with conn.cursor() as cursor:
+                cursor.execute("""
+                    SELECT value, EXTRACT(EPOCH FROM clock_timestamp())
+                    FROM cluster_metadata WHERE key = 'leader_transfer'
+                """)
+                row = cursor.fetchone()
+        if not row:
+            return None
+        transfer = json.loads(row[0])
+        return transfer if transfer.get("expires_at", 0) > float(row[1]) else None
+
+    def _set_pending_transfer(self, transfer: Optional[Dict[str, Any]]):
+        with self._get_db_connection() as conn:
+            with conn.cursor() as cursor:
+                if transfer is None:
+                    cursor.execute("DELETE FROM cluster_metadata WHERE key = 'leader_transfer'")
+                else:
+                    cursor.execute("""
+                        INSERT INTO cluster_metadata (key, value) VALUES ('leader_transfer', %s)
+                        ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_at = CURRENT_TIMESTAMP
+                    """, (json.dumps(transfer),))
+                conn.commit()
+
+    def transfer_leadership(self, target_id: Optional[str] = None) -> Dict[str, Any]:
+        """Hand leadership to another live node: stop renewing and ask the target to campaign now"""
+        if not self.is_leader:
+            return {"error": "This node is not the leader"}
+        if target_id == self.node_id:
+            return {"error": "Target is already the leader"}
+
+        with self._get_db_connection() as conn:
+            with conn.cursor() as cursor:
+                cursor.execute("""
+                    SELECT node_id, api_url FROM cluster_nodes
+                    WHERE node_id != %s
+                      AND state != %s
+                      AND is_healthy = true
+                      AND last_heartbeat >= CURRENT_TIMESTAMP - INTERVAL '30 seconds'
+                    ORDER BY last_heartbeat DESC
+                """, (self.node_id, NodeState.STOPPED.value))
+                candidates = {row[0]: row[1] for row in cursor.fetchall()}
+
+        if target_id is None:
+            if not candidates:
+                return {"error": "No healthy follower available to take over"}
+            target_id = next(iter(candidates))
+        elif target_id not in candidates:
+            return {"error": f"Node {target_id} is not a live, healthy cluster member"}
+
+        from_term = self.current_term
+        logger.info(f"🔀 Transferring leadership to {target_id} (term {from_term})")
+        self._set_pending_transfer({
+            "from": self.node_id,
+            "to": target_id,
+            "term": from_term,
+            "expires_at": self._db_time() + LEADER_TRANSFER_TIMEOUT_SECONDS
+        })
+        self.step_down(hold_seconds=LEADER_TRANSFER_TIMEOUT_SECONDS)
+
+        try:
+            requests.post(
+                f"{candidates[target_id]}/cluster/leader/campaign",
+                json={"from": self.node_id, "term": from_term},
+                timeout=5
+            )
+        except Exception as e:
+            logger.warning(f"⚠️  Could not reach {target_id} to start its campaign: {e}")
+
+        # Wait for the target to take the lease
+        deadline = time.time() + LEADER_TRANSFER_TIMEOUT_SECONDS
+        new_lease = None
+        while time.time() < deadline:
+            new_lease = self._get_current_lease()
+            if new_lease and new_lease.leader_id == target_id and new_lease.valid:
+                break
+            time.sleep(0.5)
+
+        transferred = bool(new_lease and new_lease.leader_id == target_id)
+        self._set_pending_transfer(None)
+        # Stay out of the way if the handoff worked; otherwise let normal elections resume
+        if not transferred:
+            self._election_hold_until = 0.0
+
+        result = {
+            "status": "transferred" if transferred else "timed_out",
+            "from": self.node_id,
+            "to": target_id,
+            "previous_term": from_term,
+            "term": new_lease.term if new_lease else None,
+            "leader_id": new_lease.leader_id if new_lease else None
+        }
+        self._log_cluster_event("leader_transfer", result)
+        if transferred:
+            logger.info(f"✅ Leadership transferred to {target_id} (term {result['term']})")
+        else:
+            logger.warning(f"⚠️  Leadership transfer to {target_id} timed out; normal election will follow")
+        return result
+
+    def campaign_for_transfer(self, from_node: str, term: int) -> Dict[str, Any]:
+        """Campaign immediately because the leader is handing leadership to this node"""
+        transfer = self._get_pending_transfer()
+        if not transfer or transfer["to"] != self.node_id or transfer["from"] != from_node:
+            return {"error": "No leadership transfer to this node is in progress"}
+
+        logger.info(f"🔀 {from_node} is handing leadership to this node, campaigning now")
+        with self._lock:
+            # Start from the outgoing leader's term so our lease supersedes its old one
+            self.current_term = max(self.current_term, term)
+            if self.state == NodeState.FOLLOWER:
+                self._start_leader_election()
+
+        return {"node_id": self.node_id, "is_leader": self.is_leader, "term": self.current_term}
+
+    def step_down(self, hold_seconds: int = 60):
+        """Hand leadership to another node and stay out of elections for hold_seconds"""
+        self._election_hold_until = time.time() + hold_seconds
+        self._release_leadership()
 
     def _renew_leadership_lease(self):
         """Renew leadership lease to maintain leadership"""
@@ -570,8 +846,13 @@ class DistributedController:
             current_lease = self._get_current_lease()
 
             if current_lease:
-                # Check if lease has expired
-                if current_lease.expires_at <= time.time():
+                # A leader whose renewals stalled must not keep acting once the database says its lease ran out
+                if self.is_leader and (current_lease.leader_id != self.node_id or not current_lease.valid):
+                    logger.warning("⚠️  Database time says this node's lease is no longer valid")
+                    self._lose_leadership()
+
+                # Check if lease has expired, on database time
+                if not current_lease.valid:
                     if self.leader_id == current_lease.leader_id:
                         self.leader_id = None
                         logger.info("⏰ Leader lease expired")
@@ -585,27 +866,36 @@ class DistributedController:
             logger.error(f"❌ Error checking leader health: {e}")
 
     def _get_current_lease(self) -> Optional[LeaderLease]:
-        """Get current leadership lease"""
+        """Get current leadership lease. The database decides whether it is still valid, and
+        its times are returned as offsets from the database's clock, so a node whose clock is
+        off neither keeps a dead leader nor campaigns against a live one."""
         try:
             with self._get_db_connection() as conn:
                 with conn.cursor() as cursor:
                     cursor.execute("""
-                        SELECT leader_id, term, acquired_at, expires_at, 
-                               renewed_at, hostname, api_url
+                        SELECT leader_id, term,
+                               EXTRACT(EPOCH FROM acquired_at - clock_timestamp()),
+                               EXTRACT(EPOCH FROM expires_at - clock_timestamp()),
+                               EXTRACT(EPOCH FROM renewed_at - clock_timestamp()),
+                               hostname, api_url,
+                               expires_at > clock_timestamp()
                         FROM leader_lease 
                         WHERE id = 1
                     """)
 
                     row = cursor.fetchone()
                     if row:
+                        now = time.time()
                         return LeaderLease(
                             leader_id=row[0],
                             term=row[1],
-                            acquired_at=row[2].timestamp(),
-                            expires_at=row[3].timestamp(),
-                            renewed_at=row[4].timestamp(),
+                            acquired_at=now + float(row[2]),
+                            expires_at=now + float(row[3]),
+                            renewed_at=now + float(row[4]),
                             hostname=row[5],
-                            api_url=row[6]
+                            api_url=row[6],
+                            remaining_seconds=max(0.0, round(float(row[3]), 3)),
+                            valid=bool(row[7])
                         )
 
         except Exception as e:
@@ -620,7 +910,8 @@ class DistributedController:
                 with conn.cursor() as cursor:
                     cursor.execute("""
                         SELECT node_id, hostname, port, api_url, state, 
-                               term, last_heartbeat, is_healthy
+                               term, last_heartbeat, is_healthy, advertise_url,
+                               version, schema_version, clock_skew_seconds
                         FROM cluster_nodes
                         WHERE last_heartbeat >= CURRENT_TIMESTAMP - INTERVAL '60 seconds'
                     """)
@@ -635,7 +926,11 @@ class DistributedController:
                             state=NodeState(row[4]),
                             term=row[5],
                             last_heartbeat=row[6].timestamp(),
-                            is_healthy=row[7]
+                            is_healthy=row[7],
+                            advertise_url=row[8],
+                            version=row[9],
+                            schema_version=row[10],
+                            clock_skew_seconds=row[11]
                         )
                         nodes[node.node_id] = node
 
@@ -643,6 +938,10 @@ class DistributedController:
                     old_nodes = set(self.cluster_nodes.keys())
                     new_nodes = set(nodes.keys())
 
+                    # Keep per-node details (versions, terms) fresh between membership changes
+                    for node_id in old_nodes & new_nodes:
+                        self.cluster_nodes[node_id] = nodes[node_id]
+
                     if old_nodes != new_nodes:
                         self.cluster_nodes = nodes
 
@@ -664,6 +963,108 @@ class DistributedController:
         except Exception as e:
             logger.error(f"❌ Failed to update cluster membership: {e}")
 
+    def _find_leader_claimants(self) -> Dict[str, Dict[str, Any]]:
+        """Collect every node that currently believes it is leader, from node rows, events and peer probes"""
+        claimants: Dict[str, Dict[str, Any]] = {}
+
+        if self.is_leader:
+            claimants[self.node_id] = {"term": self.current_term, "sources": ["self"]}
+
+        def add(node_id: str, term: int, source: str):
+            entry = claimants.setdefault(node_id, {"term": term, "sources": []})
+            entry["term"] = max(entry["term"], term)
+            if source not in entry["sources"]:
+                entry["sources"].append(source)
+
+        peer_urls: Dict[str, str] = {}
+        with self._get_db_connection() as conn:
+            with conn.cursor() as cursor:
+                # Nodes whose own heartbeat says they are leader
+                cursor.execute("""
+                    SELECT node_id, term, api_url FROM cluster_nodes
+                    WHERE state = %s
+                      AND last_heartbeat >= CURRENT_TIMESTAMP - INTERVAL '60 seconds'
+                """, (NodeState.LEADER.value,))
+                for node_id, term, api_url in cursor.fetchall():
+                    if node_id != self.node_id:
+                        add(node_id, term, "heartbeat")
+                        peer_urls[node_id] = api_url
+
+                # Live nodes whose latest election was never followed by a leadership loss
+                cursor.execute("""
+                    SELECT e.node_id, e.event_type, e.term, n.api_url
+                    FROM (
+                        SELECT DISTINCT ON (node_id) node_id, event_type, term
+                        FROM cluster_events
+                        WHERE event_type IN ('leader_elected', 'leader_lost')
+                          AND timestamp >= CURRENT_TIMESTAMP - INTERVAL '%s seconds'
+                        ORDER BY node_id, timestamp DESC, id DESC
+                    ) e
+                    JOIN cluster_nodes n ON n.node_id = e.node_id
+                    WHERE n.last_heartbeat >= CURRENT_TIMESTAMP - INTERVAL '60 seconds'
+                """, (SPLIT_BRAIN_LOOKBACK_SECONDS,))
+                for node_id, event_type, term, api_url in cursor.fetchall():
+                    if node_id != self.node_id and event_type == "leader_elected":
+                        add(node_id, term, "events")
+                        peer_urls[node_id] = api_url
+
+        # Ask suspected peers directly; a reachable peer answering as follower is not a claimant
+        for node_id, api_url in peer_urls.items():
+            try:
+                response = requests.get(f"{api_url}/cluster/health", timeout=PEER_PROBE_TIMEOUT_SECONDS)
+                if response.json().get("is_leader"):
+                    add(node_id, claimants[node_id]["term"], "probe")
+                else:
+                    claimants.pop(node_id, None)
+            except Exception as e:
+                logger.debug(f"Split-brain probe of {node_id} at {api_url} failed: {e}")
+
+        return claimants
+
+    def _check_split_brain(self):
+        """Detect competing leaders in the same or adjacent terms and fence the stale one"""
+        try:
+            claimants = self._find_leader_claimants()
+            if len(claimants) < 2:
+                return
+
+            terms = sorted(c["term"] for c in claimants.values())
+            if terms[-1] - terms[0] > 1:
+                # Far-apart terms are a stale leftover rather than concurrent leaders
+                return
+
+            lease = self._get_current_lease()
+            lease_holder = lease.leader_id if lease and lease.valid else None
+
+            action = "none"
+            if self.is_leader and self.node_id in claimants:
+                highest_term = max(c["term"] for c in claimants.values())
+                if lease_holder != self.node_id or self.current_term < highest_term:
+                    action = "stepped_down"
+
+            report = {
+                "detected_at": time.time(),
+                "reported_by": self.node_id,
+                "claimants": [
+                    {"node_id": node_id, "term": info["term"], "sources": info["sources"]}
+                    for node_id, info in sorted(claimants.items())
+                ],
+                "lease_holder": lease_holder,
+                "lease_term": lease.term if lease else None,
+                "action": action
+            }
+            self.split_brain_reports.append(report)
+
+            logger.critical(f"🧠 Split-brain detected: {report['claimants']} (lease holder: {lease_holder})")
+            self._log_cluster_event("split_brain_detected", report)
+
+            if action == "stepped_down":
+                logger.critical(f"🧠 Stepping down: this node holds a stale term ({self.current_term})")
+                self._lose_leadership(reason="split_brain")
+
+        except Exception as e:
+            logger.error(f"❌ Split-brain check failed: {e}")
+
     def _cleanup_stale_nodes(self):
         """Clean up stale/offline nodes from cluster"""
         try:
@@ -739,29 +1140,152 @@ class DistributedController:
         return {
             "node_id": self.node_id,
             "hostname": self.hostname,
+            "version": CONTROLLER_VERSION,
+            "schema_version": SCHEMA_VERSION,
             "state": self.state.value,
             "term": self.current_term,
             "is_leader": self.is_leader,
             "leader_id": self.leader_id,
             "cluster_size": len(self.cluster_nodes),
             "nodes": [asdict(node) for node in self.cluster_nodes.values()],
-            "lease": asdict(current_lease) if current_lease else None
+            "lease": asdict(current_lease) if current_lease else None,
+            "clock_skew_seconds": self.clock_skew_seconds,
+            "warnings": self.get_warnings(),
+            "split_brain": self.split_brain_reports[-1] if self.split_brain_reports else None
         }
 
+    def get_warnings(self) -> List[Dict[str, Any]]:
+        """Cluster conditions that need attention but do not stop the cluster, e.g. node clock skew"""
+        warnings = []
+        for node in sorted(self.cluster_nodes.values(), key=lambda node: node.node_id):
+            skew = self.clock_skew_seconds if node.node_id == self.node_id else node.clock_skew_seconds
+            if skew is not None and abs(skew) > CLOCK_SKEW_WARNING_SECONDS:
+                warnings.append({
+                    "type": "clock_skew",
+                    "node_id": node.node_id,
+                    "skew_seconds": skew,
+                    "threshold_seconds": CLOCK_SKEW_WARNING_SECONDS,
+                    "message": f"Clock of {node.node_id} is {skew:+.3f}s off the database's; "
+                               f"leases use database time, but logs and timestamps from this node will be off"
+                })
+        return warnings
+
+    def get_split_brain_reports(self) -> List[Dict[str, Any]]:
+        """Get split-brain incidents detected by this node, most recent first"""
+        return list(reversed(self.split_brain_reports))
+
+    def get_cluster_events(self, term: Optional[int] = None, node_id: Optional[str] = None,
+                           event_type: Optional[str] = None, since: Optional[float] = None,
+                           until: Optional[float] = None, limit: int = 100) -> List[Dict[str, Any]]:
+        """Get cluster coordination events, newest first, with optional filtering"""
+        query = """
+            SELECT id, node_id, event_type, event_data, term, EXTRACT(EPOCH FROM timestamp)
+            FROM cluster_events WHERE 1=1
+        """
+        params: List[Any] = []
+
+        if term is not None:
+            query += " AND term = %s"
+            params.append(term)
+
+        if node_id:
+            query += " AND node_id = %s"
+            params.append(node_id)
+
+        if event_type:
+            query += " AND event_type = %s"
+            params.append(event_type)
+
+        if since is not None:
+            query += " AND timestamp >= to_timestamp(%s) AT TIME ZONE 'UTC'"
+            params.append(since)
+
+        if until is not None:
+            query += " AND timestamp <= to_timestamp(%s) AT TIME ZONE 'UTC'"
+            params.append(until)
+
+        query += " ORDER BY timestamp DESC, id DESC LIMIT %s"
+        params.append(limit)
+
+        with self._get_db_connection() as conn:
+            with conn.cursor() as cursor:
+                cursor.execute(query, params)
+                events = []
+                for row in cursor.fetchall():
+                    event_data = row[3]
+                    if isinstance(event_data, str):
+                        event_data = json.loads(event_data)
+                    events.append({
+                        "id": row[0],
+                        "node_id": row[1],
+                        "event_type": row[2],
+                        "data": event_data or {},
+                        "term": row[4],
+                        "timestamp": float(row[5])
+                    })
+                return events
+
     def get_leader_info(self) -> Optional[Dict[str, Any]]:
         """Get current leader information"""
         current_lease = self._get_current_lease()
-        if current_lease and current_lease.expires_at > time.time():
+        if current_lease and current_lease.valid:
+            if current_lease.leader_id == self.node_id:
+                advertise_url = self.advertise_url
+            else:
+                leader_node = self.cluster_nodes.get(current_lease.leader_id)
+                advertise_url = (leader_node.advertise_url if leader_node else None) or self.external_api_url
             return {
                 "leader_id": current_lease.leader_id,
-                "hostname": current_lease.hostname, 
+                "hostname": current_lease.hostname,
                 "api_url": current_lease.api_url,  # Internal API URL for status
                 "external_api_url": self.external_api_url,  # Load balancer URL for client redirects
+                "advertise_url": advertise_url,  # URL clients should send writes to
                 "term": current_lease.term,
                 "lease_expires_at": current_lease.expires_at
             }
         return None
 
+    def get_endpoints(self) -> Dict[str, Any]:
+        """List live controller API endpoints with their roles, for configuring an external load balancer"""
+        current_lease = self._get_current_lease()
+        leader_id = None
+        if current_lease and current_lease.valid:
+            leader_id = current_lease.leader_id
+
+        endpoints = []
+        with self._get_db_connection() as conn:
+            with conn.cursor() as cursor:
+                cursor.execute("""
+                    SELECT node_id, hostname, port, api_url, advertise_url, state,
+                           term, last_heartbeat, is_healthy
+                    FROM cluster_nodes
+                    WHERE last_heartbeat >= CURRENT_TIMESTAMP - INTERVAL '60 seconds'
+                    ORDER BY node_id
+                """)
+                for row in cursor.fetchall():
+                    endpoints.append({
+                        "node_id": row[0],
+                        "hostname": row[1],
+                        "port": row[2],
+                        "api_url": row[3],
+                        "advertise_url": row[4],
+                        "role": "leader" if row[0] == leader_id else "follower",
+                        "state": row[5],
+                        "term": row[6],
+                        "last_heartbeat": row[7].timestamp(),
+                        "healthy": row[8],
+                        "accepts_writes": row[0] == leader_id
+                    })
+
+        leader = next((e for e in endpoints if e["role"] == "leader"), None)
+        return {
+            "leader_id": leader_id,
+            "write_endpoint": (leader["advertise_url"] or leader["api_url"]) if leader else None,
+            "read_endpoints": [e["api_url"] for e in endpoints if e["healthy"]],
+            "load_balancer_url": self.external_api_url,
+            "endpoints": endpoints
+        }
+
     def is_cluster_ready(self) -> bool:
         """Check if cluster has minimum nodes and a leader"""
         return (
@@ -0,0 +1,27 @@
+"""
+Per-replica connection limits.
+Apps whose replicas can only handle so many requests at once set
+`maxConnsPerReplica`. nginx then never keeps more than that many connections
+open to one replica (max_conns); requests beyond that go to another replica,
+or fail with 502 when every replica is full, which the autoscaler's
+saturation check reacts to. The autoscaler also uses the limit as the app's
+connections target, so it scales out once replicas reach the scale-out
+threshold of their limit rather than the default of 80 connections.
+"""
+
+from typing import Any, Dict, Optional, Tuple
+
+MAX_CONNS_LIMIT = 100000
+
+def validate_max_conns(value: Any, app_spec: Dict[str, Any]) -> Tuple[Optional[int], Optional[str]]:
+    """Normalize `maxConnsPerReplica`. Returns (limit or None, error)."""
+    if value is None:
+        return None, None
+    if not isinstance(value, int) or isinstance(value, bool) or not 1 <= value <= MAX_CONNS_LIMIT:
+        return None, f"maxConnsPerReplica must be between 1 and {MAX_CONNS_LIMIT}"
+    if app_spec.get("type") != "http":
+        return None, "maxConnsPerReplica is only supported for http apps"
+    return value, None
+
+def max_conns(app_spec: Dict[str, Any]) -> Optional[int]:
+    return app_spec.get("maxConnsPerReplica")
@@ -0,0 +1,207 @@
+"""
+App status conditions.
+An app's status reports, besides the running/degraded/stopped summary, a
+list of conditions that each answer one question about it:
+
+    Available      Are enough replicas ready to serve (minReady, or one)?
+    Progressing    Is the app reaching its desired state, or stuck (a replica
+                   that cannot be started, a failed rollout)?
+    Degraded       Are replicas failing health checks, missing, or is a
+                   dependency down?
+    LBConfigured   Does nginx route the app's traffic to its ready replicas?
+    QuotaOK        Did the app get the host capacity it asked for?
+
+Each condition has a status ("True", "False" or "Unknown"), a CamelCase
+reason, a message and lastTransitionTime, when its status last changed as
+far as this controller has seen.
+"""
+
+import time
+import threading
+from typing import Any, Dict, List, Optional, Tuple
+
+from . import arbiter
+from . import availability
+
+AVAILABLE = "Available"
+PROGRESSING = "Progressing"
+DEGRADED = "Degraded"
+LB_CONFIGURED = "LBConfigured"
+QUOTA_OK = "QuotaOK"
+TYPES = (AVAILABLE, PROGRESSING, DEGRADED, LB_CONFIGURED, QUOTA_OK)
+# The status each condition has when all is well
+HEALTHY = {AVAILABLE: "True", PROGRESSING: "True", DEGRADED: "False", LB_CONFIGURED: "True", QUOTA_OK: "True"}
+# A capacity deferral older than this no longer says anything about the app
+DEFERRAL_STALE_SECONDS = 300
+# Reasons for the Docker error kinds that are not already clear when CamelCased
+_START_FAILURE_REASONS = {"transient": "DockerUnavailable", "unknown": "ReplicaStartFailed"}
+# Apps that are not meant to run, by AppRecord status
+_NOT_RUNNING = {
+    "stopped": ("Stopped", "App is stopped"),
+    "registered": ("NotStarted", "App was never started"),
+    "archived": ("Archived", "App is archived")
+}
+
+def condition(type_: str, ok: Optional[bool], reason: str, message: str,
+              since: Optional[float] = None, **details: Any) -> Dict[str, Any]:
+    """A condition; ok None means Unknown. since is when the cause began, if known."""
+    result = {
+        "type": type_,
+        "status": "Unknown" if ok is None else ("True" if ok else "False"),
+        "reason": reason,
+        "message": message
+    }
+    if since is not None:
+        result["since"] = since
+    result.update(details)
+    return result
+
+def is_healthy(cond: Dict[str, Any]) -> bool:
+    return cond.get("status") == HEALTHY.get(cond.get("type"))
+
+def start_failure_reason(kind: str) -> str:
+    """A docker_errors kind as a condition reason, e.g. image_not_found -> ImageNotFound."""
+    return _START_FAILURE_REASONS.get(kind) or "".join(word.capitalize() for word in kind.split("_"))
+
+def _available(spec: Dict[str, Any], replicas: int, ready: int) -> Dict[str, Any]:
+    config = availability.availability_config(spec)
+    needed = max(1, availability.floor(config, replicas)) if config and replicas else 1
+    if ready >= needed:
+        return condition(AVAILABLE, True, "MinimumReplicasReady",
+                         f"{ready} replica(s) ready, at least {needed} needed")
+    if not replicas:
+        return condition(AVAILABLE, False, "NoReplicas", "No replicas are running")
+    return condition(AVAILABLE, False, "MinimumReplicasUnavailable",
+                     f"{ready} of {replicas} replica(s) ready, at least {needed} needed")
+
+def _progressing(instances: List[Dict[str, Any]], desired: int, failure: Optional[Dict[str, Any]],
+                 rollout: Optional[Dict[str, Any]], queued: Optional[List[Dict[str, Any]]]) -> Dict[str, Any]:
+    if failure:
+        return condition(PROGRESSING, False, start_failure_reason(failure["reason"]),
+                         f"A replica could not be started: {failure['message']}", since=failure["since"],
+                         hint=failure["hint"], attempts=failure["attempts"])
+    if rollout and rollout.get("state") == "failed":
+        return condition(PROGRESSING, False, "RolloutFailed",
+                         f"Rollout of {rollout['image']} failed: {rollout.get('error') or 'unknown error'}",
+                         since=rollout.get("finished_at"))
+    if rollout and rollout.get("state") == "rolling_back":
+        return condition(PROGRESSING, True, "RollingBack",
+                         f"Rolling back to {rollout.get('previous_image')}: {rollout.get('error') or 'rollout failed'}",
+                         since=rollout.get("started_at"))
+    if rollout and rollout.get("state") == "in_progress":
+        return condition(PROGRESSING, True, "RolloutInProgress",
+                         f"Replaced {rollout['replaced']} of {rollout['total']} replica(s) with {rollout['image']}",
+                         since=rollout.get("started_at"))
+    starting = [i for i in instances if i["state"] == "starting"]
+    if starting:
+        return condition(PROGRESSING, True, "ReplicasStarting", f"{len(starting)} replica(s) starting",
+                         since=min(i["state_since"] for i in starting))
+    if len(instances) < desired:
+        return condition(PROGRESSING, True, "ReplicasPending",
+                         f"{len(instances)} of {desired} desired replica(s) running")
+    if queued:
+        operations = ", ".join(entry.get("operation", "operation") for entry in queued)
+        return condition(PROGRESSING, True, "WaitingForMinReady",
+                         f"Held back until enough replicas are ready: {operations}")
+    return condition(PROGRESSING, True, "ReplicasUpToDate", f"{len(instances)} replica(s) running as desired")
+
+def _degraded(instances: List[Dict[str, Any]], desired: int, ready: int,
+              effective_health: Optional[Dict[str, Any]]) -> Dict[str, Any]:
+    unhealthy = [i for i in instances if i["state"] == "unhealthy"]
+    if unhealthy:
+        first = unhealthy[0]
+        detail = f": {first['container_id']} {first['state_reason']}" if first.get("state_reason") else ""
+        return condition(DEGRADED, True, "ReplicasUnhealthy",
+                         f"{len(unhealthy)} replica(s) failing health checks{detail}",
+                         since=min(i["state_since"] for i in unhealthy))
+    wanted = max(len(instances), desired)
+    if ready < wanted:
+        return condition(DEGRADED, True, "ReplicasNotReady", f"{ready} of {wanted} replica(s) ready")
+    if effective_health and effective_health.get("cause") == "dependency":
+        down = effective_health.get("unavailable_dependencies") or []
+        impaired = [d["app"] for d in effective_health.get("dependencies", []) if d["status"] == "degraded"]
+        if down:
+            return condition(DEGRADED, True, "DependencyDown", f"Dependencies unavailable: {', '.join(down)}")
+        return condition(DEGRADED, True, "DependencyDegraded", f"Dependencies degraded: {', '.join(impaired)}")
+    return condition(DEGRADED, False, "AllReplicasReady", f"All {ready} replica(s) ready")
+
+def _lb_configured(lb_state: Optional[Dict[str, Any]]) -> Dict[str, Any]:
+    if not lb_state:
+        return condition(LB_CONFIGURED, None, "NotObserved",
+                         "The controller has not written the app's nginx config since it started")
+    return condition(LB_CONFIGURED, lb_state["configured"], lb_state["reason"], lb_state["message"],
+                     since=lb_state.get("at"))
+
+def quota(app_name: str, capacity_arbiter: Optional[Any], now: Optional[float] = None) -> Dict[str, Any]:
+    """QuotaOK from the capacity arbiter's latest round."""
+    if not arbiter.enabled():
+        return condition(QUOTA_OK, True, "Unlimited", "No host capacity limit is set")
+    last_round = getattr(capacity_arbiter, "last_round", None) if capacity_arbiter else None
+    now = now or time.time()
+    if last_round and now - last_round["timestamp"] <= DEFERRAL_STALE_SECONDS:
+        for decision in last_round["decisions"]:
+            if decision["app"] == app_name and decision.get("deferred"):
+                return condition(QUOTA_OK, False, "CapacityDeferred",
+                                 f"{decision['deferred']} replica(s) deferred, {decision['reason']}",
+                                 since=last_round["timestamp"])
+    return condition(QUOTA_OK, True, "WithinCapacity", "Scale-outs fit the host capacity")
+
+def evaluate(app_name: str, app_status: str, spec: Dict[str, Any], desired: int,
+             instances: List[Dict[str, Any]], failure: Optional[Dict[str, Any]] = None,
+             rollout: Optional[Dict[str, Any]] = None, queued: Optional[List[Dict[str, Any]]] = None,
+             lb_state: Optional[Dict[str, Any]] = None, effective_health: Optional[Dict[str, Any]] = None,
+             capacity_arbiter: Optional[Any] = None) -> List[Dict[str, Any]]:
+    """The conditions of an app from its record's status and spec, its desired replica count
+    and the status entries of its replicas (as AppManager.status lists them)."""
+    ready = sum(1 for i in instances if i["state"] == "ready")
+    not_running = _NOT_RUNNING.get(app_status)
+    if not_running and not instances:
+        reason, message = not_running
+        if failure:
+            progressing = _progressing(instances, desired, failure, rollout, queued)
+        else:
+            progressing = condition(PROGRESSING, False, reason, message)
+        return [
+            condition(AVAILABLE, False, reason, message),
+            progressing,
+            condition(DEGRADED, False, reason, message),
+            condition(LB_CONFIGURED, False, reason, message),
+            quota(app_name, capacity_arbiter)
+        ]
+    return [
+        _available(spec, len(instances), ready),
+        _progressing(instances, desired, failure, rollout, queued),
+        _degraded(instances, desired, ready, effective_health),
+        _lb_configured(lb_state),
+        quota(app_name, capacity_arbiter)
+    ]
+
+class ConditionTracker:
+    """Remembers when each condition of each app last changed status, so lastTransitionTime
+    stays put while the status does."""
+
+    def __init__(self):
+        self._lock = threading.Lock()
+        self._seen: Dict[Tuple[str, str], Tuple[str, float]] = {}
+
+    def observe(self, app_name: str, conditions: List[Dict[str, Any]]) -> List[Dict[str, Any]]:
+        """Stamp conditions with lastTransitionTime. A new status takes the time its cause
+        began (the condition's since) if known, else now."""
+        now = time.time()
+        with self._lock:
+            for cond in conditions:
+                since = cond.pop("since", None)
+                key = (app_name, cond["type"])
+                previous = self._seen.get(key)
+                if previous and previous[0] == cond["status"]:
+                    changed_at = previous[1]
+                else:
+                    changed_at = since if since is not None and since <= now else now
+                    self._seen[key] = (cond["status"], changed_at)
+                cond["lastTransitionTime"] = changed_at
+        return conditions
+
+    def forget(self, app_name: str):
+        with self._lock:
+            for key in [key for key in self._seen if key[0] == app_name]:
+                del self._seen[key]
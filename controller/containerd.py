@@ -0,0 +1,391 @@
+"""
+containerd runtime.
+Implements ContainerRuntime on top of the nerdctl CLI, for hosts that run
+containerd without Docker Engine (ORCHESTRY_RUNTIME=containerd). nerdctl
+speaks Docker's flags and prints Docker-shaped inspect output, so the objects
+here look like the Docker SDK's to the app manager and nginx manager.
+
+containerd events carry no labels: the events stream reports every container
+in the namespace and the manager ignores the ones it does not track.
+"""
+
+import os
+import re
+import json
+import logging
+import tempfile
+import subprocess
+import threading
+from typing import Any, Dict, List, Optional
+
+import docker
+
+from .runtime import ExecResult, labels_match
+
+logger = logging.getLogger(__name__)
+
+NERDCTL_BINARY = os.getenv("ORCHESTRY_NERDCTL", "nerdctl")
+CONTAINERD_ADDRESS = os.getenv("ORCHESTRY_CONTAINERD_ADDRESS", "/run/containerd/containerd.sock")
+CONTAINERD_NAMESPACE = os.getenv("ORCHESTRY_CONTAINERD_NAMESPACE", "default")
+COMMAND_TIMEOUT_SECONDS = 120
+
+# containerd event topics -> the Docker event actions the manager handles
+EVENT_ACTIONS = {
+    "/tasks/start": "start",
+    "/tasks/exit": "die",
+    "/tasks/oom": "oom",
+    "/tasks/paused": "pause",
+    "/tasks/resumed": "unpause",
+    "/containers/delete": "destroy",
+}
+SIZE_UNITS = {"b": 1, "kb": 1000, "mb": 1000 ** 2, "gb": 1000 ** 3, "tb": 1000 ** 4,
+              "kib": 1024, "mib": 1024 ** 2, "gib": 1024 ** 3, "tib": 1024 ** 4}
+SIZE_PATTERN = re.compile(r"^\s*([\d.]+)\s*([a-zA-Z]*)")
+NOT_FOUND_PATTERN = re.compile(r"no such (container|object|image|network)|not found", re.IGNORECASE)
+UNREACHABLE_PATTERN = re.compile(r"containerd\.sock|connection refused|cannot connect", re.IGNORECASE)
+
+def parse_size(text: str) -> int:
+    """Bytes in a human-readable size such as "12.5MiB" or "3kB"."""
+    match = SIZE_PATTERN.match(text or "")
+    if not match:
+        return 0
+    return int(float(match.group(1)) * SIZE_UNITS.get(match.group(2).lower() or "b", 1))
+
+def create_args(config: Dict[str, Any]) -> List[str]:
+    """nerdctl create flags for the keyword arguments of a Docker SDK containers.create() call."""
+    args = []
+    for key, value in config.items():
+        if value is None or value is False or key in ("image", "detach", "publish_all_ports"):
+            continue
+        if key == "name":
+            args += ["--name", value]
+        elif key == "labels":
+            args += [arg for k, v in value.items() for arg in ("--label", f"{k}={v}")]
+        elif key == "environment":
+            args += [arg for k, v in value.items() for arg in ("--env", f"{k}={v}")]
+        elif key == "network":
+            args += ["--network", value]
+        elif key == "ports":
+            for container_port, binding in value.items():
+                host_ip, host_port = binding if isinstance(binding, tuple) else ("", binding)
+                args += ["--publish", f"{host_ip + ':' if host_ip else ''}{host_port}:{container_port}"]
+        elif key == "platform":
+            args += ["--platform", value]
+        elif key == "nano_cpus":
+            args += ["--cpus", str(value / 1_000_000_000)]
+        elif key == "mem_limit":
+            args += ["--memory", str(value)]
+        elif key == "dns":
+            args += [arg for server in value for arg in ("--dns", server)]
+        elif key == "extra_hosts":
+            args += [arg for host, ip in value.items() for arg in ("--add-host", f"{host}:{ip}")]
+        elif key == "sysctls":
+            args += [arg for k, v in value.items() for arg in ("--sysctl", f"{k}={v}")]
+        elif key == "ulimits":
+            args += [arg for u in value for arg in ("--ulimit", f"{u['Name']}={u['Soft']}:{u['Hard']}")]
+        elif key == "shm_size":
+            args += ["--shm-size", str(value)]
+        elif key == "tmpfs":
+            args += [arg for path, opts in value.items() for arg in ("--tmpfs", f"{path}:{opts}" if opts else path)]
+        elif key == "read_only":
+            args.append("--read-only")
+        elif key == "security_opt":
+            args += [arg for opt in value for arg in ("--security-opt", _security_opt(opt))]
+        elif key == "cap_drop":
+            args += [arg for cap in value for arg in ("--cap-drop", cap)]
+        elif key == "cap_add":
+            args += [arg for cap in value for arg in ("--cap-add", cap)]
+        elif key == "user":
+            args += ["--user", value]
+        elif key == "stop_timeout":
+            args += ["--stop-timeout", str(value)]
+        elif key == "restart_policy":
+            args += ["--restart", value.get("Name", "no")]
+        elif key == "storage_opt":
+            logger.warning("storageSize is not supported by the containerd runtime, ignoring it")
+        else:
+            logger.warning(f"containerd runtime ignores unsupported container option {key}")
+    return args
+
+def _security_opt(opt: str) -> str:
+    """Docker takes an inline seccomp profile; nerdctl wants a file."""
+    if opt.startswith("seccomp=") and opt[len("seccomp="):].lstrip().startswith("{"):
+        with tempfile.NamedTemporaryFile("w", suffix=".json", prefix="orchestry-seccomp-", delete=False) as f:
+            f.write(opt[len("seccomp="):])
+        return f"seccomp={f.name}"
+    return opt
+
+class NerdctlContainer:
+    """A container, with the attributes and methods of docker.models.containers.Container
+    that Orchestry uses."""
+
+    def __init__(self, runtime: "NerdctlRuntime", attrs: Dict[str, Any]):
+        self._runtime = runtime
+        self._set_attrs(attrs)
+
+    def _set_attrs(self, attrs: Dict[str, Any]):
+        self.attrs = attrs
+        networks = attrs.setdefault("NetworkSettings", {}).setdefault("Networks", {})
+        # Older nerdctl names networks by interface ("unknown-eth0"); expose them by name
+        wanted = json.loads((attrs.get("Config") or {}).get("Labels", {}).get("nerdctl/networks", "[]") or "[]")
+        interfaces = [n for n in networks.values() if n.get("IPAddress")]
+        for name, network in zip([n for n in wanted if n not in networks], interfaces):
+            networks[name] = network
+
+    @property
+    def id(self) -> str:
+        return self.attrs["Id"]
+
+    @property
+    def name(self) -> str:
+        return self.attrs.get("Name", "").lstrip("/")
+
+    @property
+    def labels(self) -> Dict[str, str]:
+        return (self.attrs.get("Config") or {}).get("Labels") or {}
+
+    @property
+    def status(self) -> str:
+        return (self.attrs.get("State") or {}).get("Status", "unknown")
+
+    def reload(self):
+        self._set_attrs(self._runtime.inspect("container", self.id))
+
+    def start(self):
+        self._runtime.run("start", self.id)
+
+    def stop(self, timeout: Optional[int] = None):
+        self._runtime.run("stop", *(["--time", str(timeout)] if timeout is not None else []), self.id)
+
+    def kill(self, signal: Any = None):
+        self._runtime.run("kill", *(["--signal", str(signal)] if signal else []), self.id)
+
+    def restart(self, timeout: Optional[int] = None):
+        self._runtime.run("restart", *(["--time", str(timeout)] if timeout is not None else []), self.id)
+
+    def pause(self):
+        self._runtime.run("pause", self.id)
+
+    def unpause(self):
+        self._runtime.run("unpause", self.id)
+
+    def remove(self, force: bool = False, v: bool = False):
+        self._runtime.run("rm", *(["--force"] if force else []), *(["--volumes"] if v else []), self.id)
+
+    def update(self, **kwargs):
+        args = []
+        if kwargs.get("nano_cpus"):
+            args += ["--cpus", str(kwargs["nano_cpus"] / 1_000_000_000)]
+        if kwargs.get("mem_limit"):
+            args += ["--memory", str(kwargs["mem_limit"])]
+        if args:
+            self._runtime.run("update", *args, self.id)
+
+    def logs(self, tail: Any = "all", timestamps: bool = False, **kwargs) -> bytes:
+        args = ["logs", "--tail", str(tail)] + (["--timestamps"] if timestamps else []) + [self.id]
+        result = self._runtime.run(*args, raw=True)
+        return result.stdout + result.stderr
+
+    def stats(self, stream: bool = False, **kwargs) -> Dict[str, Any]:
+        """Docker-shaped stats, built from nerdctl's percentages and sizes so the
+        manager's CPU formula yields the same percentage."""
+        line = self._runtime.run("stats", "--no-stream", "--format", "{{json .}}", self.id).strip().splitlines()
+        data = json.loads(line[0]) if line else {}
+        cpu = float(str(data.get("CPUPerc", "0")).rstrip("%") or 0)
+        usage, _, limit = str(data.get("MemUsage", "")).partition("/")
+        return {
+            "cpu_stats": {"cpu_usage": {"total_usage": int(cpu * 1_000_000)},
+                          "system_cpu_usage": 100_000_000, "online_cpus": 1},
+            "precpu_stats": {"cpu_usage": {"total_usage": 0}, "system_cpu_usage": 0},
+            "memory_stats": {"usage": parse_size(usage), "limit": parse_size(limit)}
+        }
+
+    def exec_run(self, cmd: Any, **kwargs) -> ExecResult:
+        cmd = list(cmd) if isinstance(cmd, (list, tuple)) else ["sh", "-c", cmd]
+        result = self._runtime.run("exec", self.id, *cmd, raw=True, check=False)
+        return ExecResult(result.returncode, result.stdout + result.stderr)
+
+class NerdctlContainers:
+    def __init__(self, runtime: "NerdctlRuntime"):
+        self._runtime = runtime
+
+    def create(self, image: str, **kwargs) -> NerdctlContainer:
+        container_id = self._runtime.run("create", *create_args(kwargs), image).strip().splitlines()[-1]
+        return self.get(container_id)
+
+    def run(self, image: str, detach: bool = True, **kwargs) -> NerdctlContainer:
+        container = self.create(image, **kwargs)
+        container.start()
+        container.reload()
+        return container
+
+    def get(self, container_id: str) -> NerdctlContainer:
+        return NerdctlContainer(self._runtime, self._runtime.inspect("container", container_id))
+
+    def list(self, all: bool = False, filters: Optional[Dict[str, Any]] = None, **kwargs) -> List[NerdctlContainer]:
+        filters = filters or {}
+        output = self._runtime.run("ps", "--quiet", "--no-trunc", *(["--all"] if all else []))
+        ids = output.split()
+        if not ids:
+            return []
+        containers = [NerdctlContainer(self._runtime, attrs)
+                      for attrs in json.loads(self._runtime.run("inspect", "--type", "container", *ids))]
+        return [
+            c for c in containers
+            if ("label" not in filters or labels_match(c.labels, filters["label"]))
+            and ("id" not in filters or c.id.startswith(filters["id"]))
+            and ("name" not in filters or filters["name"] in c.name)
+            and ("status" not in filters or c.status == filters["status"])
+        ]
+
+class NerdctlImage:
+    def __init__(self, attrs: Dict[str, Any]):
+        self.attrs = attrs
+        self.id = attrs.get("Id")
+        self.tags = attrs.get("RepoTags") or []
+
+class NerdctlImages:
+    def __init__(self, runtime: "NerdctlRuntime"):
+        self._runtime = runtime
+
+    def get(self, name: str) -> NerdctlImage:
+        try:
+            return NerdctlImage(self._runtime.inspect("image", name))
+        except docker.errors.NotFound as e:
+            raise docker.errors.ImageNotFound(str(e))
+
+    def pull(self, repository: str, tag: Optional[str] = None, **kwargs) -> NerdctlImage:
+        reference = f"{repository}:{tag}" if tag else repository
+        self._runtime.run("pull", "--quiet", reference, timeout=None)
+        return self.get(reference)
+
+    def list(self, **kwargs) -> List[NerdctlImage]:
+        ids = sorted(set(self._runtime.run("images", "--quiet", "--no-trunc").split()))
+        if not ids:
+            return []
+        return [NerdctlImage(attrs) for attrs in json.loads(self._runtime.run("image", "inspect", *ids))]
+
+    def remove(self, image: str, force: bool = False, noprune: bool = False):
+        self._runtime.run("rmi", *(["--force"] if force else []), image)
+
+class NerdctlNetworks:
+    def __init__(self, runtime: "NerdctlRuntime"):
+        self._runtime = runtime
+
+    def get(self, name: str) -> Dict[str, Any]:
+        return self._runtime.inspect("network", name)
+
+    def create(self, name: str, driver: str = "bridge", **kwargs) -> Dict[str, Any]:
+        self._runtime.run("network", "create", "--driver", driver, name)
+        return self.get(name)
+
+class NerdctlAPI:
+    def __init__(self, runtime: "NerdctlRuntime"):
+        self._runtime = runtime
+
+    def containers(self, all: bool = False, size: bool = False, filters: Optional[Dict[str, Any]] = None) -> List[Dict]:
+        """Low-level listing; only the fields Orchestry reads (Id, Names, Labels, State, SizeRw)."""
+        rows = []
+        output = self._runtime.run("ps", "--format", "{{json .}}", *(["--all"] if all else []),
+                                   *(["--size"] if size else []))
+        for line in output.splitlines():
+            row = json.loads(line)
+            if filters and "id" in filters and not row.get("ID", "").startswith(filters["id"]):
+                continue
+            rows.append({"Id": row.get("ID"), "Names": [f"/{row.get('Names', '')}"], "State": row.get("Status"),
+                         "SizeRw": parse_size(row.get("Size", ""))})
+        return rows
+
+class _EventStream:
+    """Iterates `nerdctl events` as Docker-shaped events; close() stops the process."""
+
+    def __init__(self, process: subprocess.Popen):
+        self._process = process
+        self._closed = threading.Event()
+
+    def close(self):
+        self._closed.set()
+        self._process.terminate()
+
+    def __iter__(self):
+        for line in self._process.stdout:
+            if self._closed.is_set():
+                return
+            try:
+                envelope = json.loads(line)
+                event = json.loads(envelope.get("Event") or "{}") if isinstance(envelope.get("Event"), str) \
+                    else envelope.get("Event") or {}
+            except ValueError:
+                continue
+            action = EVENT_ACTIONS.get(envelope.get("Topic", ""))
+            container_id = event.get("container_id") or event.get("id")
+            if action and container_id:
+                yield {"Type": "container", "Action": action, "status": action, "id": container_id,
+                       "Actor": {"ID": container_id, "Attributes": {}}}
+
+class NerdctlRuntime:
+    """ContainerRuntime for containerd, driving the nerdctl CLI."""
+
+    def __init__(self, binary: str = NERDCTL_BINARY, address: str = CONTAINERD_ADDRESS,
+                 namespace: str = CONTAINERD_NAMESPACE):
+        self._base = [binary, "--address", address, "--namespace", namespace]
+        self.containers = NerdctlContainers(self)
+        self.images = NerdctlImages(self)
+        self.networks = NerdctlNetworks(self)
+        self.api = NerdctlAPI(self)
+
+    def run(self, *args: str, raw: bool = False, check: bool = True,
+            timeout: Optional[int] = COMMAND_TIMEOUT_SECONDS) -> Any:
+        """Run a nerdctl command. Failures raise the docker.errors exception Docker would
+        have raised: NotFound, APIError, or DockerException when containerd is unreachable."""
+        try:
+            result = subprocess.run(self._base + list(args), capture_output=True, timeout=timeout)
+        except FileNotFoundError:
+            raise docker.errors.DockerException(f"{self._base[0]} not found; the containerd runtime needs nerdctl")
+        except subprocess.TimeoutExpired:
+            raise docker.errors.APIError(f"nerdctl {args[0]} timed out after {timeout}s")
+        if check and result.returncode != 0:
+            message = result.stderr.decode("utf-8", errors="replace").strip() or f"nerdctl {args[0]} failed"
+            if UNREACHABLE_PATTERN.search(message):
+                raise docker.errors.DockerException(message)
+            if NOT_FOUND_PATTERN.search(message):
+                raise docker.errors.NotFound(message)
+            raise docker.errors.APIError(message)
+        return result if raw else result.stdout.decode("utf-8", errors="replace")
+
+    def inspect(self, kind: str, ref: str) -> Dict[str, Any]:
+        items = json.loads(self.run(kind, "inspect", ref) or "[]")
+        if not items:
+            raise docker.errors.NotFound(f"No such {kind}: {ref}")
+        return items[0]
+
+    def info(self) -> Dict[str, Any]:
+        return json.loads(self.run("info", "--format", "{{json .}}"))
+
+    def ping(self) -> bool:
+        self.run("version")
+        return True
+
+    def df(self) -> Dict[str, Any]:
+        """Disk usage in the shape of Docker's GET /system/df. nerdctl has no system df,
+        so this adds up images, container layers and volumes; build cache is not counted."""
+        rows = self.api.containers(all=True, size=True)
+        images = [{"Id": image.id, "Size": image.attrs.get("Size", 0), "SharedSize": -1, "Containers": -1}
+                  for image in self.images.list()]
+        volumes = []
+        for line in self.run("volume", "ls", "--size", "--format", "{{json .}}").splitlines():
+            row = json.loads(line)
+            volumes.append({"Name": row.get("Name"),
+                            "UsageData": {"Size": parse_size(str(row.get("Size", ""))), "RefCount": -1}})
+        return {
+            "LayersSize": sum(image["Size"] or 0 for image in images),
+            "Images": images,
+            "Containers": [{"Id": row["Id"], "State": row["State"], "SizeRw": row["SizeRw"]} for row in rows],
+            "Volumes": volumes,
+            "BuildCache": []
+        }
+
+    def events(self, decode: bool = False, filters: Optional[Dict[str, Any]] = None) -> _EventStream:
+        process = subprocess.Popen(self._base + ["events", "--format", "{{json .}}"],
+                                   stdout=subprocess.PIPE, stderr=subprocess.DEVNULL, text=True)
+        return _EventStream(process)
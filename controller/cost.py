@@ -0,0 +1,125 @@
+"""
+Resource accounting and cost estimation for Orchestry apps.
+Samples running replicas with their requested CPU/memory and prices the
+accumulated CPU-hours and GB-hours.
+"""
+
+import os
+import re
+import time
+import logging
+from typing import Dict, Any, Optional
+
+logger = logging.getLogger(__name__)
+
+# How often usage is sampled, and the longest gap a single sample may cover
+USAGE_SAMPLE_INTERVAL_SECONDS = 60
+MAX_SAMPLE_GAP_SECONDS = 300
+
+_RANGE_UNITS = {"h": 3600, "d": 86400, "w": 7 * 86400}
+
+def parse_cpu(value: Any) -> float:
+    """Convert a Kubernetes-style CPU quantity ("100m", "0.5", "1") to cores."""
+    if value is None:
+        return 0.0
+    cpu_str = str(value).strip()
+    if cpu_str.endswith("m"):
+        return float(cpu_str[:-1]) / 1000
+    return float(cpu_str)
+
+def parse_memory_gb(value: Any) -> float:
+    """Convert a memory quantity ("128Mi", "1Gi", "512M", bytes) to GiB."""
+    if value is None:
+        return 0.0
+    memory_str = str(value).strip()
+    units = {
+        "Ki": 1024, "Mi": 1024 ** 2, "Gi": 1024 ** 3, "Ti": 1024 ** 4,
+        "K": 1000, "M": 1000 ** 2, "G": 1000 ** 3, "T": 1000 ** 4,
+    }
+    for suffix in ("Ki", "Mi", "Gi", "Ti", "K", "M", "G", "T"):
+        if memory_str.endswith(suffix):
+            return float(memory_str[:-len(suffix)]) * units[suffix] / 1024 ** 3
+    return float(memory_str) / 1024 ** 3
+
+def parse_range(range_str: str) -> int:
+    """Convert a range like "30d", "12h" or "2w" to seconds."""
+    match = re.fullmatch(r"(\d+)([hdw])", range_str.strip())
+    if not match:
+        raise ValueError(f"Invalid range '{range_str}', expected e.g. 12h, 30d or 2w")
+    return int(match.group(1)) * _RANGE_UNITS[match.group(2)]
+
+class CostEstimator:
+    """Records per-app resource usage and turns it into cost reports."""
+
+    def __init__(self, state_store: Any):
+        self.state_store = state_store
+        self.price_per_cpu_hour = float(os.getenv("ORCHESTRY_PRICE_PER_CPU_HOUR", "0.04"))
+        self.price_per_gb_hour = float(os.getenv("ORCHESTRY_PRICE_PER_GB_HOUR", "0.005"))
+        self.currency = os.getenv("ORCHESTRY_COST_CURRENCY", "USD")
+        self._last_sample: Optional[float] = None
+
+    def sample_due(self) -> bool:
+        """Whether enough time has passed since the last usage sample."""
+        return self._last_sample is None or time.time() - self._last_sample >= USAGE_SAMPLE_INTERVAL_SECONDS
+
+    def record_usage(self, replica_counts: Dict[str, int]):
+        """Record one usage sample for each app, covering the time since the previous sample."""
+        now = time.time()
+        duration = USAGE_SAMPLE_INTERVAL_SECONDS if self._last_sample is None else now - self._last_sample
+        # Don't bill across long gaps (controller restarts, lost leadership)
+        duration = min(duration, MAX_SAMPLE_GAP_SECONDS)
+        self._last_sample = now
+
+        for app_name, replicas in replica_counts.items():
+            try:
+                app_record = self.state_store.get_app(app_name)
+                if not app_record:
+                    continue
+                resources = app_record.spec.get("resources", {}) or {}
+                self.state_store.record_resource_usage(
+                    app_name,
+                    replicas,
+                    parse_cpu(resources.get("cpu", "100m")),
+                    parse_memory_gb(resources.get("memory", "128Mi")),
+                    duration
+                )
+            except Exception as e:
+                logger.error(f"Failed to record resource usage for {app_name}: {e}")
+
+    def report(self, app_name: str, range_str: str = "30d") -> Dict[str, Any]:
+        """Build a cost report for an app over the given range."""
+        until = time.time()
+        since = until - parse_range(range_str)
+        usage = self.state_store.get_resource_usage(app_name, since, until)
+
+        for day in usage["daily"]:
+            day["cost"] = round(self._price(day["cpu_hours"], day["memory_gb_hours"]), 4)
+
+        cpu_cost = usage["cpu_hours"] * self.price_per_cpu_hour
+        memory_cost = usage["memory_gb_hours"] * self.price_per_gb_hour
+
+        return {
+            "app": app_name,
+            "range": range_str,
+            "since": since,
+            "until": until,
+            "pricing": {
+                "per_cpu_hour": self.price_per_cpu_hour,
+                "per_gb_hour": self.price_per_gb_hour,
+                "currency": self.currency
+            },
+            "usage": {
+                "replica_hours": round(usage["replica_hours"], 3),
+                "cpu_hours": round(usage["cpu_hours"], 3),
+                "memory_gb_hours": round(usage["memory_gb_hours"], 3)
+            },
+            "cost": {
+                "cpu": round(cpu_cost, 4),
+                "memory": round(memory_cost, 4),
+                "total": round(cpu_cost + memory_cost, 4)
+            },
+            "daily": usage["daily"]
+        }
+
+    def _price(self, cpu_hours: float, memory_gb_hours: float) -> float:
+        return cpu_hours * self.price_per_cpu_hour + memory_gb_hours * self.price_per_gb_hour
@@ -0,0 +1,100 @@
+"""
+External scaling decision webhooks.
+An app can set `scaling.decisionWebhook` to hand its scaling decisions to an
+external service. When the autoscaler wants to scale the app, the leader
+POSTs the decision there first; the service approves it, vetoes it or
+changes the target. If the service cannot be reached, times out or answers
+with something unusable, the local decision is carried out as if no webhook
+were configured.
+"""
+
+import os
+import hmac
+import json
+import hashlib
+import logging
+import requests
+from dataclasses import replace
+from typing import Any, Dict, Optional, Tuple
+from urllib.parse import urlparse
+
+logger = logging.getLogger(__name__)
+
+DEFAULT_TIMEOUT_SECONDS = 2.0
+MAX_TIMEOUT_SECONDS = 30.0
+# Requests are signed with this secret when it is set (X-Orchestry-Signature: sha256=<hex>)
+SIGNING_SECRET = os.getenv("ORCHESTRY_DECISION_WEBHOOK_SECRET", "")
+
+def validate_decision_webhook(config: Any) -> Tuple[Optional[Dict[str, Any]], Optional[str]]:
+    """Normalize `scaling.decisionWebhook`. Returns (config to store or None, error)."""
+    if config is None:
+        return None, None
+    if isinstance(config, str):
+        config = {"url": config}
+    if not isinstance(config, dict):
+        return None, "scaling.decisionWebhook must be a URL or an object with url and timeoutSeconds"
+    url = config.get("url")
+    parsed = urlparse(url) if isinstance(url, str) else None
+    if not parsed or parsed.scheme not in ("http", "https") or not parsed.netloc:
+        return None, "scaling.decisionWebhook.url must be an http(s) URL"
+    timeout = config.get("timeoutSeconds", DEFAULT_TIMEOUT_SECONDS)
+    if not isinstance(timeout, (int, float)) or isinstance(timeout, bool) or not 0 < timeout <= MAX_TIMEOUT_SECONDS:
+        return None, f"scaling.decisionWebhook.timeoutSeconds must be between 0 and {MAX_TIMEOUT_SECONDS:g}"
+    return {"url": url, "timeoutSeconds": timeout}, None
+
+def webhook_config(app_spec: Dict[str, Any]) -> Optional[Dict[str, Any]]:
+    return (app_spec.get("scaling") or {}).get("decisionWebhook")
+
+def _signature(body: bytes) -> str:
+    return "sha256=" + hmac.new(SIGNING_SECRET.encode(), body, hashlib.sha256).hexdigest()
+
+def _payload(app_name: str, decision: Any, policy: Any) -> Dict[str, Any]:
+    return {
+        "app": app_name,
+        "current_replicas": decision.current_replicas,
+        "target_replicas": decision.target_replicas,
+        "reason": decision.reason,
+        "triggered_by": decision.triggered_by,
+        "metrics": decision.metrics.__dict__ if decision.metrics else None,
+        "min_replicas": policy.min_replicas if policy else None,
+        "max_replicas": policy.max_replicas if policy else None
+    }
+
+def consult(app_name: str, decision: Any, policy: Any, config: Dict[str, Any]) -> Tuple[Any, str]:
+    """Ask the app's decision webhook about a scaling decision.
+    Returns (decision to carry out, outcome) where outcome is one of approved,
+    vetoed, adjusted or fallback."""
+    body = json.dumps(_payload(app_name, decision, policy), default=str).encode()
+    headers = {"Content-Type": "application/json"}
+    if SIGNING_SECRET:
+        headers["X-Orchestry-Signature"] = _signature(body)
+
+    try:
+        response = requests.post(config["url"], data=body, headers=headers, timeout=config["timeoutSeconds"])
+        if response.status_code >= 300:
+            raise ValueError(f"returned {response.status_code}")
+        answer = response.json()
+        if not isinstance(answer, dict) or not isinstance(answer.get("approve"), bool):
+            raise ValueError("response needs a boolean 'approve'")
+        target = answer.get("targetReplicas", decision.target_replicas)
+        if not isinstance(target, int) or isinstance(target, bool):
+            raise ValueError("targetReplicas must be an integer")
+    except Exception as e:
+        logger.warning(f"Decision webhook for {app_name} unavailable, using the local decision: {e}")
+        return decision, "fallback"
+
+    note = str(answer.get("reason") or "no reason given")[:200]
+    if not answer["approve"]:
+        return replace(decision, should_scale=False, target_replicas=decision.current_replicas,
+                       reason=f"Vetoed by decision webhook: {note} (local: {decision.reason})"), "vetoed"
+
+    if policy:
+        target = max(policy.min_replicas, min(policy.max_replicas, target))
+    if target == decision.target_replicas:
+        return decision, "approved"
+    if target == decision.current_replicas:
+        return replace(decision, should_scale=False, target_replicas=target,
+                       reason=f"Decision webhook kept {target} replicas: {note} (local: {decision.reason})"), "vetoed"
+    return replace(decision, target_replicas=target,
+                   reason=f"Decision webhook adjusted target to {target}: {note} (local: {decision.reason})",
+                   triggered_by=list(decision.triggered_by) + ["decision_webhook"]), "adjusted"
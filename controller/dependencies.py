@@ -0,0 +1,130 @@
+"""
+App dependencies.
+An app lists the apps it needs with `dependsOn`. Its status then carries an
+effective health that tells "my replicas are down" (down) apart from "an app
+I depend on is down" (dependency_down), rolled up through dependencies of
+dependencies. GET /apps/graph returns the whole graph for visualization.
+Dependencies only affect reporting: they do not change start order or
+block operations. A dependency that is not registered counts as down.
+"""
+
+import re
+from typing import Any, Dict, List, Optional, Tuple
+
+_VALID_APP_NAME = re.compile(r"^[A-Za-z0-9_-]+$")
+
+def validate_depends_on(value: Any, app_name: str) -> Tuple[Optional[List[str]], Optional[str]]:
+    """Normalize `dependsOn`. Returns (app names or None, error)."""
+    if not value:
+        return None, None
+    if isinstance(value, str):
+        value = [value]
+    if not isinstance(value, list):
+        return None, "dependsOn must be a list of app names"
+    names = []
+    for name in value:
+        if not isinstance(name, str) or not _VALID_APP_NAME.match(name.strip()):
+            return None, f"dependsOn entry {name!r} is not a valid app name"
+        name = name.strip()
+        if name == app_name:
+            return None, f"App {app_name} cannot depend on itself"
+        if name not in names:
+            names.append(name)
+    return names, None
+
+def find_cycle(app_name: str, depends_on: List[str], graph: Dict[str, List[str]]) -> Optional[List[str]]:
+    """The dependency path back to app_name if it declared depends_on, or None when
+    there is no cycle. graph maps the other registered apps to their dependencies."""
+    graph = dict(graph, **{app_name: depends_on})
+    stack = [(app_name, [app_name])]
+    seen = set()
+    while stack:
+        name, path = stack.pop()
+        for dependency in graph.get(name, []):
+            if dependency == app_name:
+                return path + [app_name]
+            if dependency not in seen:
+                seen.add(dependency)
+                stack.append((dependency, path + [dependency]))
+    return None
+
+def own_health(app: Dict[str, Any], runtime: Optional[Dict[str, Any]]) -> str:
+    """up, degraded or down from the app's own replicas, as public status classifies them."""
+    runtime = runtime or {}
+    ready = runtime.get("ready_replicas", 0)
+    if app.get("status") != "running" or ready == 0:
+        return "down"
+    if ready < max(runtime.get("replicas", 0), app.get("replicas") or 0):
+        return "degraded"
+    return "up"
+
+def rollup(app_name: str, graph: Dict[str, List[str]], health: Dict[str, str],
+           _memo: Optional[Dict[str, Dict[str, Any]]] = None,
+           _visiting: Optional[set] = None) -> Dict[str, Any]:
+    """Effective health of an app. graph maps apps to their dependencies and health
+    maps registered apps to their own health.
+
+    status is down when the app's own replicas are down, dependency_down when they
+    are not but a dependency is (or is itself dependency_down), degraded when the
+    app or a dependency is degraded, else up. cause says which one decided it."""
+    memo = {} if _memo is None else _memo
+    visiting = set() if _visiting is None else _visiting
+    if app_name in memo:
+        return memo[app_name]
+    own = health.get(app_name, "missing")
+    visiting.add(app_name)
+    dependencies = []
+    for dependency in graph.get(app_name, []):
+        if dependency not in health:
+            dependencies.append({"app": dependency, "status": "missing"})
+        elif dependency in visiting:
+            # Cycles are rejected at registration; specs stored before that are cut here
+            dependencies.append({"app": dependency, "status": health[dependency]})
+        else:
+            dependencies.append({"app": dependency,
+                                 "status": rollup(dependency, graph, health, memo, visiting)["status"]})
+    visiting.discard(app_name)
+
+    unavailable = [d["app"] for d in dependencies if d["status"] in ("down", "dependency_down", "missing")]
+    impaired = [d["app"] for d in dependencies if d["status"] == "degraded"]
+    if own in ("down", "missing"):
+        status, cause = "down", "replicas"
+    elif unavailable:
+        status, cause = "dependency_down", "dependency"
+    elif own == "degraded":
+        status, cause = "degraded", "replicas"
+    elif impaired:
+        status, cause = "degraded", "dependency"
+    else:
+        status, cause = "up", None
+    result = {
+        "status": status,
+        "own": own,
+        "cause": cause,
+        "dependencies": dependencies,
+        "unavailable_dependencies": unavailable
+    }
+    memo[app_name] = result
+    return result
+
+def dependency_graph(apps: List[Dict[str, Any]], health: Dict[str, str]) -> Dict[str, Any]:
+    """Nodes and dependsOn edges for the registered apps. Dependencies that are not
+    registered show up as nodes with status missing."""
+    graph = {app["name"]: (app.get("spec") or {}).get("dependsOn") or [] for app in apps}
+    memo: Dict[str, Dict[str, Any]] = {}
+    nodes = []
+    for app in apps:
+        effective = rollup(app["name"], graph, health, memo)
+        nodes.append({
+            "name": app["name"],
+            "namespace": app.get("namespace", "default"),
+            "status": health[app["name"]],
+            "effective_status": effective["status"],
+            "cause": effective["cause"]
+        })
+    missing = sorted({d for deps in graph.values() for d in deps if d not in graph})
+    for name in missing:
+        nodes.append({"name": name, "namespace": None, "status": "missing",
+                      "effective_status": "missing", "cause": None})
+    edges = [{"from": name, "to": dependency} for name, deps in graph.items() for dependency in deps]
+    return {"nodes": nodes, "edges": edges}
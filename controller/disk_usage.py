@@ -0,0 +1,172 @@
+"""
+Docker disk usage monitoring on controller nodes.
+Every node reads the disk usage of its own Docker host (images, containers,
+volumes and build cache) every ORCHESTRY_DISK_USAGE_INTERVAL_SECONDS and
+records it, so /metrics shows each host's usage. When a host's total crosses
+ORCHESTRY_DISK_WARNING_GB or ORCHESTRY_DISK_CRITICAL_GB the node raises an
+alert, and logs an event once usage is back under the warning threshold.
+With ORCHESTRY_DISK_AUTO_GC on, crossing a threshold also requests an image
+garbage collection on all nodes.
+"""
+
+import os
+import time
+import logging
+import threading
+from typing import Any, Dict, Optional
+
+logger = logging.getLogger(__name__)
+
+DISK_USAGE_INTERVAL_SECONDS = int(os.getenv("ORCHESTRY_DISK_USAGE_INTERVAL_SECONDS", "300"))
+DISK_WARNING_GB = float(os.getenv("ORCHESTRY_DISK_WARNING_GB", "50"))
+DISK_CRITICAL_GB = float(os.getenv("ORCHESTRY_DISK_CRITICAL_GB", "100"))
+DISK_AUTO_GC = os.getenv("ORCHESTRY_DISK_AUTO_GC", "false").lower() in ("1", "true", "yes")
+
+LEVELS = ("ok", "warning", "critical")
+CATEGORIES = ("images", "containers", "volumes", "build_cache")
+SYSTEM_EVENT_SCOPE = "orchestry"
+
+def _size(value: Any) -> int:
+    # Docker reports -1 for sizes it has not calculated
+    return value if isinstance(value, int) and value > 0 else 0
+
+def summarize(df: Dict[str, Any]) -> Dict[str, Any]:
+    """Bytes used and reclaimable per category from a GET /system/df response.
+    Reclaimable means not used by any container (or, for containers, not running)."""
+    images = df.get("Images") or []
+    containers = df.get("Containers") or []
+    volumes = df.get("Volumes") or []
+    cache = df.get("BuildCache") or []
+    image_bytes = _size(df.get("LayersSize")) or sum(_size(image.get("Size")) for image in images)
+
+    usage = {
+        "images": {
+            "count": len(images),
+            "bytes": image_bytes,
+            "reclaimable_bytes": sum(_size(image.get("Size")) - _size(image.get("SharedSize"))
+                                     for image in images if image.get("Containers") == 0)
+        },
+        "containers": {
+            "count": len(containers),
+            "bytes": sum(_size(c.get("SizeRw")) for c in containers),
+            "reclaimable_bytes": sum(_size(c.get("SizeRw")) for c in containers
+                                     if not str(c.get("State", "")).lower().startswith(("running", "up")))
+        },
+        "volumes": {
+            "count": len(volumes),
+            "bytes": sum(_size((v.get("UsageData") or {}).get("Size")) for v in volumes),
+            "reclaimable_bytes": sum(_size((v.get("UsageData") or {}).get("Size")) for v in volumes
+                                     if (v.get("UsageData") or {}).get("RefCount") == 0)
+        },
+        "build_cache": {
+            "count": len(cache),
+            "bytes": sum(_size(entry.get("Size")) for entry in cache if not entry.get("Shared")),
+            "reclaimable_bytes": sum(_size(entry.get("Size")) for entry in cache
+                                     if not entry.get("Shared") and not entry.get("InUse"))
+        }
+    }
+    usage["total_bytes"] = sum(usage[category]["bytes"] for category in CATEGORIES)
+    usage["reclaimable_bytes"] = sum(usage[category]["reclaimable_bytes"] for category in CATEGORIES)
+    return usage
+
+def level(total_bytes: int) -> str:
+    """ok, warning or critical for a total usage; a threshold of 0 is off."""
+    if DISK_CRITICAL_GB > 0 and total_bytes >= DISK_CRITICAL_GB * 1000 ** 3:
+        return "critical"
+    if DISK_WARNING_GB > 0 and total_bytes >= DISK_WARNING_GB * 1000 ** 3:
+        return "warning"
+    return "ok"
+
+def thresholds() -> Dict[str, Any]:
+    return {
+        "interval_seconds": DISK_USAGE_INTERVAL_SECONDS,
+        "warning_gb": DISK_WARNING_GB,
+        "critical_gb": DISK_CRITICAL_GB,
+        "auto_gc": DISK_AUTO_GC
+    }
+
+class DiskUsageMonitor:
+    """Records this node's Docker disk usage and alerts when it crosses a threshold."""
+
+    def __init__(self, state_store: Any, docker_client: Any, cluster_controller: Any, alerts: Any,
+                 image_gc: Any = None, freeze_state: Any = None):
+        self.state_store = state_store
+        self.docker_client = docker_client
+        self.cluster = cluster_controller
+        self.alerts = alerts
+        self.image_gc = image_gc
+        self.freeze = freeze_state
+        self._level: Optional[str] = None
+        self._active = False
+        self._thread: Optional[threading.Thread] = None
+
+    @property
+    def node_id(self) -> str:
+        return self.cluster.node_id
+
+    def start(self):
+        if self._active:
+            return
+        self._active = True
+        self._thread = threading.Thread(target=self._loop, daemon=True)
+        self._thread.start()
+        logger.info(f"Disk usage monitor started on node {self.node_id}")
+
+    def stop(self):
+        self._active = False
+
+    def _loop(self):
+        while self._active:
+            try:
+                self.run_once()
+            except Exception as e:
+                logger.error(f"Error in disk usage loop: {e}")
+            time.sleep(DISK_USAGE_INTERVAL_SECONDS)
+
+    def run_once(self) -> Dict[str, Any]:
+        """Measure and record this node's usage, alerting if its level went up or back to ok."""
+        usage = summarize(self.docker_client.df())
+        current = level(usage["total_bytes"])
+        if self._level is None:
+            # Do not alert again for a level recorded before a restart
+            previous = {row["node_id"]: row for row in self.state_store.list_disk_usage()}.get(self.node_id)
+            self._level = previous["level"] if previous and previous["level"] in LEVELS else "ok"
+
+        previous_level, self._level = self._level, current
+        self.state_store.save_disk_usage(self.node_id, current, usage)
+        if LEVELS.index(current) > LEVELS.index(previous_level):
+            self._raise(current, usage)
+        elif current == "ok" and previous_level != "ok":
+            self.state_store.log_event(SYSTEM_EVENT_SCOPE, "disk_usage_recovered",
+                                       {"node_id": self.node_id, "total_bytes": usage["total_bytes"]},
+                                       severity="info",
+                                       message=f"Docker disk usage on node {self.node_id} is back under the warning threshold")
+        return {"node_id": self.node_id, "level": current, **usage}
+
+    def _raise(self, current: str, usage: Dict[str, Any]):
+        limit = DISK_CRITICAL_GB if current == "critical" else DISK_WARNING_GB
+        details = {
+            "node_id": self.node_id,
+            "total_bytes": usage["total_bytes"],
+            "reclaimable_bytes": usage["reclaimable_bytes"],
+            "threshold_gb": limit,
+            **{f"{category}_bytes": usage[category]["bytes"] for category in CATEGORIES}
+        }
+        message = (f"Docker disk usage on node {self.node_id} is {usage['total_bytes'] / 1000 ** 3:.1f} GB, "
+                   f"over the {current} threshold of {limit:g} GB")
+        logger.warning(message)
+        self.alerts.notify(SYSTEM_EVENT_SCOPE, f"disk_usage_{current}", message, details, severity=current)
+
+        if DISK_AUTO_GC and self.image_gc:
+            if self.freeze and self.freeze.is_frozen():
+                logger.info("Not requesting image GC for disk usage while controllers are frozen")
+                return
+            self.image_gc.request(reason=f"disk usage {current} on node {self.node_id}")
+
+    def status(self) -> Dict[str, Any]:
+        """The thresholds and each node's latest usage, as reported by /metrics."""
+        return {
+            "thresholds": thresholds(),
+            "nodes": [{"node_id": row["node_id"], "level": row["level"], "updated_at": row["updated_at"],
+                       **row["usage"]} for row in self.state_store.list_disk_usage()]
+        }
@@ -0,0 +1,276 @@
+"""
+DNS-based traffic steering between federated clusters.
+An app that runs on several clusters can set `dnsSteering` to have one DNS
+name point at all of them, weighted by how many healthy replicas each cluster
+has. The leader of every cluster that runs the app periodically reads each
+cluster's public status endpoint (`/public/apps/<name>/status`) and writes
+the weights to Route53 (weighted records) or to a Cloudflare load balancer
+pool. All of them compute the same weights, so it does not matter which one
+writes last, and steering keeps working when a whole cluster is down.
+"""
+
+import os
+import re
+import hmac
+import time
+import hashlib
+import ipaddress
+import logging
+import threading
+import requests
+from datetime import datetime, timezone
+from typing import Any, Dict, Optional, Tuple
+from xml.sax.saxutils import escape
+
+from . import public_status
+
+logger = logging.getLogger(__name__)
+
+SYNC_INTERVAL_SECONDS = int(os.getenv("ORCHESTRY_DNS_STEERING_INTERVAL", "30"))
+REQUEST_TIMEOUT_SECONDS = 10
+DEFAULT_TTL_SECONDS = 60
+PROVIDERS = ("route53", "cloudflare")
+# Route53 weights are 0-255
+MAX_ROUTE53_WEIGHT = 255
+
+RECORD_PATTERN = re.compile(r"^(?=.{1,253}$)([a-z0-9_]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}\.?$", re.IGNORECASE)
+
+ROUTE53_ENDPOINT = "https://route53.amazonaws.com/2013-04-01"
+CLOUDFLARE_ENDPOINT = "https://api.cloudflare.com/client/v4"
+
+def validate_dns_steering(config: Any, public: Optional[Dict[str, Any]]) -> Tuple[Optional[Dict[str, Any]], Optional[str]]:
+    """Normalize `dnsSteering`. Returns (config to store or None, error)."""
+    if not config:
+        return None, None
+    if not isinstance(config, dict):
+        return None, "dnsSteering must be a mapping"
+    if config.get("enabled") is False:
+        return None, None
+    if not public:
+        return None, "dnsSteering reads each cluster's public status, so it needs publicStatus.enabled"
+
+    provider = config.get("provider")
+    if provider not in PROVIDERS:
+        return None, f"dnsSteering.provider must be one of {', '.join(PROVIDERS)}"
+    record = config.get("record")
+    if not isinstance(record, str) or not RECORD_PATTERN.match(record):
+        return None, "dnsSteering.record must be a DNS name, e.g. shop.example.com"
+    targets = config.get("targets")
+    if not isinstance(targets, dict) or not targets:
+        return None, "dnsSteering.targets must map cluster names to the address of each cluster's nginx"
+    for cluster, address in targets.items():
+        if not isinstance(address, str) or not address.strip():
+            return None, f"dnsSteering.targets.{cluster} must be an IP address or host name"
+
+    normalized = {
+        "enabled": True,
+        "provider": provider,
+        "record": record.rstrip(".").lower(),
+        "targets": {str(cluster): address.strip() for cluster, address in targets.items()}
+    }
+    if provider == "route53":
+        if not isinstance(config.get("zoneId"), str) or not config["zoneId"].strip():
+            return None, "dnsSteering.zoneId (the Route53 hosted zone) is required"
+        normalized["zoneId"] = config["zoneId"].strip().split("/")[-1]
+        try:
+            ttl = int(config.get("ttl", DEFAULT_TTL_SECONDS))
+        except (TypeError, ValueError):
+            return None, "dnsSteering.ttl must be a number of seconds"
+        if not 1 <= ttl <= 86400:
+            return None, "dnsSteering.ttl must be between 1 and 86400 seconds"
+        normalized["ttl"] = ttl
+    else:
+        if not isinstance(config.get("poolId"), str) or not config["poolId"].strip():
+            return None, "dnsSteering.poolId (the Cloudflare load balancer pool) is required"
+        normalized["poolId"] = config["poolId"].strip()
+    return normalized, None
+
+def record_type(address: str) -> str:
+    try:
+        return "AAAA" if ipaddress.ip_address(address).version == 6 else "A"
+    except ValueError:
+        return "CNAME"
+
+def weights_from_health(health: Dict[str, Dict[str, Any]]) -> Dict[str, int]:
+    """A cluster's weight is its number of ready replicas; down or unreachable clusters get 0."""
+    return {
+        cluster: (status.get("ready_replicas") or 0) if status.get("status") in ("up", "degraded") else 0
+        for cluster, status in health.items()
+    }
+
+def _sign(key: bytes, message: str) -> bytes:
+    return hmac.new(key, message.encode(), hashlib.sha256).digest()
+
+def sigv4_headers(method: str, url: str, body: bytes, access_key: str, secret_key: str,
+                  session_token: Optional[str] = None, region: str = "us-east-1", service: str = "route53",
+                  now: Optional[datetime] = None) -> Dict[str, str]:
+    """AWS Signature Version 4 headers for a request without query parameters."""
+    now = now or datetime.now(timezone.utc)
+    amz_date = now.strftime("%Y%m%dT%H%M%SZ")
+    date = now.strftime("%Y%m%d")
+    host, _, path = url.split("://", 1)[1].partition("/")
+    payload_hash = hashlib.sha256(body).hexdigest()
+    headers = {"host": host, "x-amz-content-sha256": payload_hash, "x-amz-date": amz_date}
+    if session_token:
+        headers["x-amz-security-token"] = session_token
+
+    signed_headers = ";".join(sorted(headers))
+    canonical_headers = "".join(f"{key}:{headers[key]}\n" for key in sorted(headers))
+    canonical_request = "\n".join([method, "/" + path, "", canonical_headers, signed_headers, payload_hash])
+    scope = f"{date}/{region}/{service}/aws4_request"
+    string_to_sign = "\n".join(["AWS4-HMAC-SHA256", amz_date, scope,
+                                hashlib.sha256(canonical_request.encode()).hexdigest()])
+    key = _sign(_sign(_sign(_sign(f"AWS4{secret_key}".encode(), date), region), service), "aws4_request")
+    signature = hmac.new(key, string_to_sign.encode(), hashlib.sha256).hexdigest()
+    headers["Authorization"] = (f"AWS4-HMAC-SHA256 Credential={access_key}/{scope}, "
+                                f"SignedHeaders={signed_headers}, Signature={signature}")
+    return headers
+
+def route53_change_batch(config: Dict[str, Any], weights: Dict[str, int], comment: str) -> bytes:
+    """ChangeResourceRecordSets body that upserts one weighted record per cluster."""
+    changes = []
+    for cluster, address in config["targets"].items():
+        weight = min(weights.get(cluster, 0), MAX_ROUTE53_WEIGHT)
+        changes.append(
+            "<Change><Action>UPSERT</Action><ResourceRecordSet>"
+            f"<Name>{escape(config['record'])}</Name><Type>{record_type(address)}</Type>"
+            f"<SetIdentifier>{escape(cluster)}</SetIdentifier><Weight>{weight}</Weight>"
+            f"<TTL>{config['ttl']}</TTL><ResourceRecords><ResourceRecord>"
+            f"<Value>{escape(address)}</Value></ResourceRecord></ResourceRecords>"
+            "</ResourceRecordSet></Change>"
+        )
+    return (
+        '<?xml version="1.0" encoding="UTF-8"?>'
+        '<ChangeResourceRecordSetsRequest xmlns="https://route53.amazonaws.com/doc/2013-04-01/">'
+        f"<ChangeBatch><Comment>{escape(comment)}</Comment><Changes>{''.join(changes)}</Changes></ChangeBatch>"
+        "</ChangeResourceRecordSetsRequest>"
+    ).encode()
+
+def apply_route53(config: Dict[str, Any], weights: Dict[str, int], comment: str) -> Optional[str]:
+    """Write the weights as Route53 weighted records. Returns an error message or None."""
+    access_key, secret_key = os.getenv("AWS_ACCESS_KEY_ID"), os.getenv("AWS_SECRET_ACCESS_KEY")
+    if not access_key or not secret_key:
+        return "AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set on the controllers"
+    url = f"{ROUTE53_ENDPOINT}/hostedzone/{config['zoneId']}/rrset"
+    body = route53_change_batch(config, weights, comment)
+    headers = sigv4_headers("POST", url, body, access_key, secret_key, os.getenv("AWS_SESSION_TOKEN"))
+    response = requests.post(url, data=body, headers=headers, timeout=REQUEST_TIMEOUT_SECONDS)
+    if response.status_code != 200:
+        return f"Route53 returned HTTP {response.status_code}: {response.text[:300]}"
+    return None
+
+def cloudflare_origins(config: Dict[str, Any], weights: Dict[str, int]) -> list:
+    """Pool origins with weights relative to the healthiest cluster (Cloudflare weights are 0-1)."""
+    top = max(weights.values(), default=0)
+    origins = []
+    for cluster, address in config["targets"].items():
+        weight = weights.get(cluster, 0)
+        origins.append({
+            "name": cluster,
+            "address": address,
+            # With nothing healthy anywhere, keep every origin rather than take the name down
+            "enabled": weight > 0 or top == 0,
+            "weight": round(weight / top, 2) if top else 1
+        })
+    return origins
+
+def apply_cloudflare(config: Dict[str, Any], weights: Dict[str, int], comment: str) -> Optional[str]:
+    """Write the weights to the origins of a Cloudflare load balancer pool."""
+    token, account = os.getenv("CLOUDFLARE_API_TOKEN"), os.getenv("CLOUDFLARE_ACCOUNT_ID")
+    if not token or not account:
+        return "CLOUDFLARE_API_TOKEN and CLOUDFLARE_ACCOUNT_ID must be set on the controllers"
+    response = requests.patch(
+        f"{CLOUDFLARE_ENDPOINT}/accounts/{account}/load_balancers/pools/{config['poolId']}",
+        json={"origins": cloudflare_origins(config, weights), "description": comment},
+        headers={"Authorization": f"Bearer {token}"},
+        timeout=REQUEST_TIMEOUT_SECONDS
+    )
+    if response.status_code != 200:
+        return f"Cloudflare returned HTTP {response.status_code}: {response.text[:300]}"
+    return None
+
+APPLY = {"route53": apply_route53, "cloudflare": apply_cloudflare}
+
+class DnsSteering:
+    """Keeps the DNS weights of steered apps in line with each cluster's healthy replicas."""
+
+    def __init__(self, state_store: Any, app_manager: Any, federation: Any, cluster_controller: Any):
+        self.state_store = state_store
+        self.app_manager = app_manager
+        self.federation = federation
+        self.cluster = cluster_controller
+        self.status: Dict[str, Dict[str, Any]] = {}  # app_name -> last sync
+        self._active = False
+        self._thread: Optional[threading.Thread] = None
+
+    def start(self):
+        if self._active:
+            return
+        self._active = True
+        self._thread = threading.Thread(target=self._loop, daemon=True)
+        self._thread.start()
+
+    def stop(self):
+        self._active = False
+
+    def _loop(self):
+        while self._active:
+            try:
+                if self.cluster.is_leader:
+                    self.run_once()
+            except Exception as e:
+                logger.error(f"Error in DNS steering loop: {e}")
+            time.sleep(SYNC_INTERVAL_SECONDS)
+
+    def run_once(self) -> int:
+        """Sync every steered app. Returns the number of apps whose records were written."""
+        written = 0
+        for item in self.state_store.list_apps():
+            record = self.state_store.get_app(item["name"])
+            config = (record.spec or {}).get("dnsSteering") if record else None
+            if config and self.sync(record, config):
+                written += 1
+        return written
+
+    def cluster_health(self, record: Any, cluster: str) -> Dict[str, Any]:
+        """An app's public status on one cluster, or {"status": "unreachable"}."""
+        if self.federation.is_local(cluster):
+            return public_status.public_status(record, self.app_manager.runtime_summary().get(record.name))
+        result = self.federation.get(cluster, f"/public/apps/{record.name}/status")
+        if "error" in result:
+            return {"status": "unreachable", "error": result["error"]}
+        return result
+
+    def sync(self, record: Any, config: Dict[str, Any], force: bool = False) -> bool:
+        """Write an app's weights if they changed since the last sync (or force). Returns True if written."""
+        health = {cluster: self.cluster_health(record, cluster) for cluster in config["targets"]}
+        weights = weights_from_health(health)
+        previous = self.status.get(record.name) or {}
+        if not force and previous.get("weights") == weights and not previous.get("error") \
+                and previous.get("config") == config:
+            previous["checked_at"] = time.time()
+            return False
+
+        comment = f"orchestry: {record.name} weighted by healthy replicas"
+        try:
+            error = APPLY[config["provider"]](config, weights, comment)
+        except requests.RequestException as e:
+            error = str(e)
+        self.status[record.name] = {
+            "record": config["record"],
+            "provider": config["provider"],
+            "config": config,
+            "health": health,
+            "weights": weights,
+            "error": error,
+            "checked_at": time.time(),
+            "synced_at": None if error else time.time()
+        }
+        if error:
+            logger.warning(f"DNS steering of {config['record']} for {record.name} failed: {error}")
+            return False
+        self.state_store.log_event(record.name, "dns_weights_updated", {
+            "record": config["record"], "provider": config["provider"], "weights": weights
+        })
+        logger.info(f"Steered {config['record']} for {record.name}: {weights}")
+        return True
@@ -0,0 +1,99 @@
+"""
+Docker API error classification.
+Calls to the Docker daemon fail in two ways. Transient failures (the
+connection dropped with an EOF, a read timed out, the daemon is restarting)
+usually succeed when tried again, so they are retried a few times with
+backoff. Permanent failures (the image does not exist, the host port is
+taken, the command is not in the image) fail the same way every time; the
+app manager records them as `replica_start_failed` events with a hint at the
+fix and reports them as a condition in the app's status until a replica of
+the app starts again.
+"""
+
+import os
+import time
+import socket
+import logging
+from typing import Any, Callable, Dict, Optional
+
+import docker
+import requests
+
+logger = logging.getLogger(__name__)
+
+RETRY_ATTEMPTS = max(1, int(os.getenv("ORCHESTRY_DOCKER_RETRY_ATTEMPTS", "3")))
+RETRY_BACKOFF_SECONDS = float(os.getenv("ORCHESTRY_DOCKER_RETRY_BACKOFF_SECONDS", "0.5"))
+MAX_BACKOFF_SECONDS = 10
+
+TRANSIENT = "transient"
+UNKNOWN = "unknown"
+# Permanent kinds, the message fragments Docker (or Podman, or nerdctl) reports them with, and what to do
+PERMANENT = (
+    ("image_not_found", ("no such image", "manifest unknown", "not found: manifest", "repository does not exist"),
+     "Check the image name and tag in the spec, and that the image was pushed"),
+    ("registry_auth", ("pull access denied", "unauthorized", "authentication required", "denied: requested access"),
+     "Log the controller hosts in to the registry, or make the image public"),
+    ("port_conflict", ("port is already allocated", "address already in use"),
+     "Free the host port or change the app's hostPort/publishRange"),
+    ("name_conflict", ("is already in use by container", "name is already in use"),
+     "Remove the leftover container with that name, e.g. with orchestry fsck"),
+    ("invalid_config", ("executable file not found", "oci runtime create failed", "invalid reference format",
+                        "invalid mount config", "invalid argument"),
+     "Fix the spec: the image's command, mounts or options are not valid"),
+    ("resources", ("no space left on device", "cannot allocate memory", "insufficient"),
+     "Free disk space or memory on the controller hosts, or lower the app's resources"),
+)
+TRANSIENT_MESSAGES = ("eof", "connection reset", "connection refused", "broken pipe", "timed out", "timeout",
+                      "i/o timeout", "context deadline exceeded", "tls handshake", "server misbehaving",
+                      "service unavailable", "too many requests", "is restarting", "try again")
+TRANSIENT_EXCEPTIONS = (requests.exceptions.ConnectionError, requests.exceptions.Timeout,
+                        requests.exceptions.ChunkedEncodingError, ConnectionError, socket.timeout, TimeoutError)
+
+def _message(error: BaseException) -> str:
+    explanation = getattr(error, "explanation", None)
+    return str(explanation or error).lower()
+
+def classify(error: BaseException) -> str:
+    """transient, one of the PERMANENT kinds, or unknown."""
+    if isinstance(error, docker.errors.ImageNotFound):
+        return "image_not_found"
+    message = _message(error)
+    for kind, fragments, _ in PERMANENT:
+        if any(fragment in message for fragment in fragments):
+            return kind
+    if isinstance(error, TRANSIENT_EXCEPTIONS):
+        return TRANSIENT
+    status = getattr(getattr(error, "response", None), "status_code", None)
+    if status in (429, 502, 503, 504) or any(fragment in message for fragment in TRANSIENT_MESSAGES):
+        return TRANSIENT
+    return UNKNOWN
+
+def is_transient(error: BaseException) -> bool:
+    return classify(error) == TRANSIENT
+
+def hint(kind: str) -> Optional[str]:
+    """What to do about a permanent error kind, or None."""
+    for name, _, text in PERMANENT:
+        if name == kind:
+            return text
+    return None
+
+def describe(error: BaseException) -> Dict[str, Any]:
+    """An error as events and app conditions report it."""
+    kind = classify(error)
+    return {"kind": kind, "message": str(getattr(error, "explanation", None) or error), "hint": hint(kind)}
+
+def call(operation: Callable[[], Any], description: str, attempts: Optional[int] = None) -> Any:
+    """Run a Docker operation, trying it again after transient failures with exponential
+    backoff. The last error, and every non-transient one, is raised."""
+    attempts = attempts or RETRY_ATTEMPTS
+    for attempt in range(1, attempts + 1):
+        try:
+            return operation()
+        except Exception as e:
+            if attempt == attempts or not is_transient(e):
+                raise
+            delay = min(MAX_BACKOFF_SECONDS, RETRY_BACKOFF_SECONDS * 2 ** (attempt - 1))
+            logger.warning(f"Transient Docker error during {description} (attempt {attempt}/{attempts}), "
+                           f"retrying in {delay:g}s: {e}")
+            time.sleep(delay)
@@ -0,0 +1,159 @@
+"""
+Edge authentication for Orchestry apps.
+Apps can ask nginx to require HTTP basic auth (credentials from a secret in
+htpasswd format) or an OIDC login handled by an oauth2-proxy sidecar, so
+internal tools get access control without changing the app itself.
+"""
+
+import os
+import json
+import hashlib
+import logging
+import docker
+from typing import Any, Dict, Optional
+
+logger = logging.getLogger(__name__)
+
+AUTH_TYPES = ("basic", "oidc")
+OAUTH2_PROXY_IMAGE = os.getenv("ORCHESTRY_OAUTH2_PROXY_IMAGE", "quay.io/oauth2-proxy/oauth2-proxy:v7.6.0")
+OAUTH2_PROXY_PORT = 4180
+
+def validate_auth_config(auth: Optional[Dict[str, Any]]) -> Optional[str]:
+    """Check an app's `auth` block. Returns an error message, or None if it is valid."""
+    if not auth:
+        return None
+    auth_type = auth.get("type")
+    if auth_type not in AUTH_TYPES:
+        return f"auth.type must be one of {', '.join(AUTH_TYPES)}"
+
+    if auth_type == "basic":
+        if not auth.get("secretRef"):
+            return "auth.secretRef is required for basic auth (a secret holding htpasswd entries)"
+        return None
+
+    oidc = auth.get("oidc") or {}
+    for field in ("issuerUrl", "clientId", "clientSecretRef", "cookieSecretRef"):
+        if not oidc.get(field):
+            return f"auth.oidc.{field} is required for OIDC auth"
+    return None
+
+def secret_refs(auth: Optional[Dict[str, Any]]) -> set:
+    """Names of the secrets an app's `auth` block depends on."""
+    if not auth:
+        return set()
+    if auth.get("type") == "basic":
+        return {auth.get("secretRef")} - {None}
+    oidc = auth.get("oidc") or {}
+    return {oidc.get("clientSecretRef"), oidc.get("cookieSecretRef")} - {None}
+
+class EdgeAuthManager:
+    """Prepares the nginx-side pieces of an app's edge authentication."""
+
+    def __init__(self, docker_client: Any, nginx_manager: Any):
+        self.client = docker_client
+        self.nginx = nginx_manager
+        self.secrets: Optional[Any] = None  # SecretStore, set once the controller starts
+
+    def prepare(self, app_name: str, auth: Optional[Dict[str, Any]]) -> Optional[Dict[str, Any]]:
+        """Get the template context for an app's auth, creating files or sidecars it needs.
+        Raises ValueError if the auth config cannot be satisfied."""
+        if not auth:
+            self.remove(app_name)
+            return None
+
+        error = validate_auth_config(auth)
+        if error:
+            raise ValueError(error)
+
+        if auth["type"] == "basic":
+            self._remove_oauth2_proxy(app_name)
+            htpasswd = self._resolve_secret(auth["secretRef"])
+            user_file = self.nginx.write_auth_file(app_name, htpasswd)
+            realm = "".join(c for c in (auth.get("realm") or app_name) if c.isprintable() and c not in '"\\')
+            return {
+                "type": "basic",
+                "realm": realm,
+                "user_file": user_file
+            }
+
+        self.nginx.remove_auth_file(app_name)
+        return {
+            "type": "oidc",
+            "proxy": self._ensure_oauth2_proxy(app_name, auth["oidc"])
+        }
+
+    def remove(self, app_name: str):
+        """Remove everything created for an app's edge authentication."""
+        self.nginx.remove_auth_file(app_name)
+        self._remove_oauth2_proxy(app_name)
+
+    def _resolve_secret(self, name: str) -> str:
+        if not self.secrets or not self.secrets.enabled:
+            raise ValueError(f"Secret {name} is needed but secrets are disabled (ORCHESTRY_SECRET_KEY is not set)")
+        value = self.secrets.get(name)
+        if value is None:
+            raise ValueError(f"Secret {name} not found")
+        return value
+
+    def _ensure_oauth2_proxy(self, app_name: str, oidc: Dict[str, Any]) -> str:
+        """Run (or reuse) the app's oauth2-proxy sidecar and return its address."""
+        environment = {
+            "OAUTH2_PROXY_PROVIDER": "oidc",
+            "OAUTH2_PROXY_OIDC_ISSUER_URL": oidc["issuerUrl"],
+            "OAUTH2_PROXY_CLIENT_ID": oidc["clientId"],
+            "OAUTH2_PROXY_CLIENT_SECRET": self._resolve_secret(oidc["clientSecretRef"]),
+            "OAUTH2_PROXY_COOKIE_SECRET": self._resolve_secret(oidc["cookieSecretRef"]),
+            "OAUTH2_PROXY_EMAIL_DOMAINS": ",".join(oidc.get("emailDomains") or ["*"]),
+            "OAUTH2_PROXY_HTTP_ADDRESS": f"0.0.0.0:{OAUTH2_PROXY_PORT}",
+            "OAUTH2_PROXY_UPSTREAMS": "static://202",
+            "OAUTH2_PROXY_REVERSE_PROXY": "true",
+            "OAUTH2_PROXY_SET_XAUTHREQUEST": "true",
+            "OAUTH2_PROXY_COOKIE_SECURE": str(oidc.get("cookieSecure", True)).lower(),
+        }
+        if oidc.get("redirectUrl"):
+            environment["OAUTH2_PROXY_REDIRECT_URL"] = oidc["redirectUrl"]
+
+        # Recreate the sidecar when its configuration (including secret values) changes
+        config_hash = hashlib.sha256(json.dumps(environment, sort_keys=True).encode()).hexdigest()[:16]
+        name = f"{app_name}-oauth2-proxy"
+
+        try:
+            container = self.client.containers.get(name)
+            if container.labels.get("orchestry.auth-hash") != config_hash:
+                logger.info(f"OIDC settings for {app_name} changed, recreating {name}")
+                container.remove(force=True)
+                container = None
+            elif container.status != "running":
+                container.start()
+        except docker.errors.NotFound:
+            container = None
+
+        if container is None:
+            container = self.client.containers.run(
+                OAUTH2_PROXY_IMAGE,
+                name=name,
+                environment=environment,
+                labels={
+                    "orchestry.sidecar": app_name,
+                    "orchestry.auth-hash": config_hash
+                },
+                network="orchestry",
+                restart_policy={"Name": "unless-stopped"},
+                detach=True
+            )
+            logger.info(f"Started oauth2-proxy sidecar for {app_name}")
+
+        container.reload()
+        ip = container.attrs["NetworkSettings"]["Networks"]["orchestry"]["IPAddress"]
+        if not ip:
+            raise ValueError(f"oauth2-proxy sidecar for {app_name} has no address yet")
+        return f"{ip}:{OAUTH2_PROXY_PORT}"
+
+    def _remove_oauth2_proxy(self, app_name: str):
+        try:
+            self.client.containers.get(f"{app_name}-oauth2-proxy").remove(force=True)
+            logger.info(f"Removed oauth2-proxy sidecar for {app_name}")
+        except docker.errors.NotFound:
+            pass
+        except Exception as e:
+            logger.warning(f"Failed to remove oauth2-proxy sidecar for {app_name}: {e}")
@@ -0,0 +1,124 @@
+"""
+Edge header rules.
+Apps can have nginx add, replace and remove headers without changing their
+code, e.g. tell the app which environment it runs in, strip headers that
+leak implementation details, or answer with CORS headers:
+
+    headers:
+      request:
+        set:
+          X-Env: production
+        remove: [Cookie]
+      response:
+        set:
+          Access-Control-Allow-Origin: "https://example.com"
+        remove: [X-Powered-By]
+
+Request headers are set or removed before requests reach a replica. A
+response header in `set` replaces the header of the same name sent by the
+app, and one in `remove` is hidden from clients; removing `Server` leaves
+only "nginx" in it, since nginx always sends its own. Headers the controller
+itself manages (Host, forwarding headers, X-Request-ID, tracing and HSTS)
+cannot be changed. PUT /apps/{name}/headers replaces the rules at runtime.
+"""
+
+import re
+from typing import Any, Dict, List, Optional, Tuple
+
+DIRECTIONS = ("request", "response")
+MAX_HEADERS = 30
+MAX_VALUE_LENGTH = 1024
+_NAME = re.compile(r"^[A-Za-z0-9][A-Za-z0-9-]{0,63}$")
+# nginx has no escape for $ in strings; quotes and backslashes would end the value
+_VALUE = re.compile(r'^[\x20-\x7e]*$')
+_VALUE_FORBIDDEN = set('"\\$')
+RESERVED = {
+    "request": {"host", "x-forwarded-for", "x-real-ip", "x-forwarded-proto", "x-request-id", "traceparent",
+                "x-forwarded-user", "x-forwarded-email", "x-orchestry-shadow", "connection"},
+    "response": {"x-request-id", "strict-transport-security", "retry-after", "content-length",
+                 "transfer-encoding", "connection"}
+}
+
+def _validate_direction(direction: str, config: Any) -> Tuple[Optional[Dict[str, Any]], Optional[str]]:
+    where = f"headers.{direction}"
+    if not isinstance(config, dict):
+        return None, f"{where} must be an object"
+    unknown = set(config) - {"set", "remove"}
+    if unknown:
+        return None, f"Unknown {where} field(s): {', '.join(sorted(unknown))}"
+    values = config.get("set") or {}
+    removed = config.get("remove") or []
+    if not isinstance(values, dict):
+        return None, f"{where}.set must be a mapping of header names to values"
+    if not isinstance(removed, list):
+        return None, f"{where}.remove must be a list of header names"
+    if len(values) + len(removed) > MAX_HEADERS:
+        return None, f"{where} can set and remove at most {MAX_HEADERS} headers"
+    seen = set()
+    for name in [*values, *removed]:
+        if not isinstance(name, str) or not _NAME.match(name):
+            return None, f"{where} has an invalid header name {name!r}"
+        if name.lower() in RESERVED[direction]:
+            return None, f"{where} cannot change {name}, it is managed by Orchestry"
+        if name.lower() in seen:
+            return None, f"{where} lists {name} more than once"
+        seen.add(name.lower())
+    if direction == "response" and any(name.lower() == "server" for name in values):
+        return None, f"{where}.set cannot replace Server, nginx always sends its own"
+    normalized_values = {}
+    for name, value in values.items():
+        if isinstance(value, (int, float)) and not isinstance(value, bool):
+            value = str(value)
+        if not isinstance(value, str) or not value or len(value) > MAX_VALUE_LENGTH:
+            return None, f"{where}.set.{name} must be a non-empty string of at most {MAX_VALUE_LENGTH} characters"
+        if not _VALUE.match(value) or set(value) & _VALUE_FORBIDDEN:
+            return None, f"{where}.set.{name} can only contain printable ASCII without quotes, backslashes or $"
+        normalized_values[name] = value
+    normalized = {}
+    if normalized_values:
+        normalized["set"] = normalized_values
+    if removed:
+        normalized["remove"] = list(removed)
+    return normalized or None, None
+
+def validate_headers(config: Any) -> Tuple[Optional[Dict[str, Any]], Optional[str]]:
+    """Normalize `headers`. Returns (rules to store or None, error)."""
+    if not config:
+        return None, None
+    if not isinstance(config, dict):
+        return None, "headers must be an object"
+    unknown = set(config) - set(DIRECTIONS)
+    if unknown:
+        return None, f"Unknown headers field(s): {', '.join(sorted(unknown))}"
+    rules = {}
+    for direction in DIRECTIONS:
+        if config.get(direction) is None:
+            continue
+        normalized, error = _validate_direction(direction, config[direction])
+        if error:
+            return None, error
+        if normalized:
+            rules[direction] = normalized
+    return rules or None, None
+
+def describe(config: Optional[Dict[str, Any]]) -> Dict[str, Any]:
+    """The stored `headers` block as the API reports it."""
+    return {direction: {"set": dict((config or {}).get(direction, {}).get("set", {})),
+                        "remove": list((config or {}).get(direction, {}).get("remove", []))}
+            for direction in DIRECTIONS}
+
+def nginx_context(config: Optional[Dict[str, Any]]) -> Optional[Dict[str, List]]:
+    """What the nginx template needs to apply an app's header rules, or None without rules."""
+    if not config:
+        return None
+    request = config.get("request", {})
+    response = config.get("response", {})
+    removed = response.get("remove", [])
+    return {
+        # An empty value keeps nginx from passing the header on
+        "request": [*request.get("set", {}).items(), *((name, "") for name in request.get("remove", []))],
+        "response": list(response.get("set", {}).items()),
+        # The app's own header is hidden so a set header replaces it instead of being sent twice
+        "hide": [name for name in [*response.get("set", {}), *removed] if name.lower() != "server"],
+        "server_tokens_off": any(name.lower() == "server" for name in removed)
+    }
@@ -0,0 +1,128 @@
+"""
+Edge TLS for Orchestry apps.
+Apps with a `tls` block get HTTPS terminated by nginx on port 443, with the
+certificate chain and private key read from secrets. Per app they choose
+whether plain HTTP requests are redirected to HTTPS, the HSTS policy sent
+with responses and the oldest TLS version clients may use. A config that
+nginx -t rejects (for example a key that does not match its certificate) is
+never reloaded; the app keeps its previous config.
+"""
+
+from typing import Any, Dict, Optional, Tuple
+
+TLS_VERSIONS = ("TLSv1", "TLSv1.1", "TLSv1.2", "TLSv1.3")
+DEFAULT_MIN_VERSION = "TLSv1.2"
+DEFAULT_HSTS_MAX_AGE_SECONDS = 31536000
+# hstspreload.org only accepts policies of at least a year that cover subdomains
+PRELOAD_MIN_MAX_AGE_SECONDS = 31536000
+HSTS_FIELDS = ("maxAgeSeconds", "includeSubDomains", "preload")
+
+def validate_tls(config: Any) -> Tuple[Optional[Dict[str, Any]], Optional[str]]:
+    """Normalize an app's `tls` block. Returns (tls or None, error)."""
+    if not config:
+        return None, None
+    if not isinstance(config, dict):
+        return None, "tls must be a mapping"
+    tls = {}
+    for field, holds in (("certificateSecretRef", "certificate chain"), ("keySecretRef", "private key")):
+        if not isinstance(config.get(field), str) or not config[field].strip():
+            return None, f"tls.{field} is required (a secret holding the PEM {holds})"
+        tls[field] = config[field].strip()
+
+    redirect = config.get("redirectHttp", True)
+    if not isinstance(redirect, bool):
+        return None, "tls.redirectHttp must be true or false"
+    tls["redirectHttp"] = redirect
+
+    min_version = config.get("minVersion", DEFAULT_MIN_VERSION)
+    if min_version not in TLS_VERSIONS:
+        return None, f"tls.minVersion must be one of {', '.join(TLS_VERSIONS)}"
+    tls["minVersion"] = min_version
+
+    hsts = config.get("hsts")
+    if hsts:
+        if hsts is True:
+            hsts = {}
+        if not isinstance(hsts, dict):
+            return None, "tls.hsts must be true or a mapping"
+        unknown = set(hsts) - set(HSTS_FIELDS)
+        if unknown:
+            return None, f"tls.hsts does not support {', '.join(sorted(unknown))}"
+        max_age = hsts.get("maxAgeSeconds", DEFAULT_HSTS_MAX_AGE_SECONDS)
+        if not isinstance(max_age, int) or isinstance(max_age, bool) or max_age < 0:
+            return None, "tls.hsts.maxAgeSeconds must be a non-negative integer"
+        policy = {"maxAgeSeconds": max_age}
+        for flag in ("includeSubDomains", "preload"):
+            if not isinstance(hsts.get(flag, False), bool):
+                return None, f"tls.hsts.{flag} must be true or false"
+            policy[flag] = hsts.get(flag, False)
+        if policy["preload"] and (max_age < PRELOAD_MIN_MAX_AGE_SECONDS or not policy["includeSubDomains"]):
+            return None, (f"tls.hsts.preload needs includeSubDomains and a maxAgeSeconds of at least "
+                          f"{PRELOAD_MIN_MAX_AGE_SECONDS}")
+        tls["hsts"] = policy
+    return tls, None
+
+def secret_refs(tls: Optional[Dict[str, Any]]) -> set:
+    """Names of the secrets an app's `tls` block depends on."""
+    if not tls:
+        return set()
+    return {tls.get("certificateSecretRef"), tls.get("keySecretRef")} - {None}
+
+def protocols(min_version: str) -> str:
+    """The ssl_protocols value that allows min_version and every newer version."""
+    return " ".join(TLS_VERSIONS[TLS_VERSIONS.index(min_version):])
+
+def hsts_header(policy: Optional[Dict[str, Any]]) -> Optional[str]:
+    if not policy:
+        return None
+    header = f"max-age={policy['maxAgeSeconds']}"
+    if policy.get("includeSubDomains"):
+        header += "; includeSubDomains"
+    if policy.get("preload"):
+        header += "; preload"
+    return header
+
+class EdgeTLSManager:
+    """Prepares the certificate files and template context of an app's TLS."""
+
+    def __init__(self, nginx_manager: Any):
+        self.nginx = nginx_manager
+        self.secrets: Optional[Any] = None  # SecretStore, set once the controller starts
+
+    def prepare(self, app_name: str, tls: Optional[Dict[str, Any]]) -> Optional[Dict[str, Any]]:
+        """Get the template context for an app's TLS, writing its certificate and key.
+        Raises ValueError if the TLS config cannot be satisfied."""
+        if not tls:
+            self.remove(app_name)
+            return None
+
+        tls, error = validate_tls(tls)
+        if error:
+            raise ValueError(error)
+        certificate = self._resolve_secret(tls["certificateSecretRef"])
+        key = self._resolve_secret(tls["keySecretRef"])
+        if "-----BEGIN CERTIFICATE-----" not in certificate:
+            raise ValueError(f"Secret {tls['certificateSecretRef']} does not hold a PEM certificate")
+        if "PRIVATE KEY-----" not in key:
+            raise ValueError(f"Secret {tls['keySecretRef']} does not hold a PEM private key")
+
+        certificate_file, key_file = self.nginx.write_tls_files(app_name, certificate, key)
+        return {
+            "certificate": certificate_file,
+            "key": key_file,
+            "protocols": protocols(tls["minVersion"]),
+            "redirect": tls["redirectHttp"],
+            "hsts": hsts_header(tls.get("hsts"))
+        }
+
+    def remove(self, app_name: str):
+        """Remove an app's certificate and key files."""
+        self.nginx.remove_tls_files(app_name)
+
+    def _resolve_secret(self, name: str) -> str:
+        if not self.secrets or not self.secrets.enabled:
+            raise ValueError(f"Secret {name} is needed but secrets are disabled (ORCHESTRY_SECRET_KEY is not set)")
+        value = self.secrets.get(name)
+        if value is None:
+            raise ValueError(f"Secret {name} not found")
+        return value
@@ -0,0 +1,71 @@
+"""
+Env variables from files.
+Teams usually keep local configuration in .env files. The CLI reads the
+files an app's `envFile` names (relative to the spec) and those given with
+`orchestry register --env-file`, and merges their variables into the spec's
+`env` before submitting it; the controller never reads files itself, so a
+spec that still has `envFile` is rejected. Since merged specs easily end up
+setting a variable twice, the controller keeps the last value of each name.
+It also warns about literal values that look like credentials, which are
+stored in revisions in plain text; they belong in a secret.
+"""
+
+import re
+from typing import Any, Dict, List, Optional, Tuple
+
+SECRET_NAME_PATTERN = re.compile(r"(PASSWORD|PASSWD|SECRET|TOKEN|API_?KEY|ACCESS_?KEY|PRIVATE_?KEY|CREDENTIAL)",
+                                 re.IGNORECASE)
+# Well-known credential formats, whatever the variable is called
+SECRET_VALUE_PATTERNS = (
+    ("an AWS access key", re.compile(r"^(AKIA|ASIA)[A-Z0-9]{16}$")),
+    ("a private key", re.compile(r"-----BEGIN [A-Z ]*PRIVATE KEY-----")),
+    ("a GitHub token", re.compile(r"^gh[pousr]_[A-Za-z0-9]{30,}$")),
+    ("a Slack token", re.compile(r"^xox[abposr]-[A-Za-z0-9-]{10,}$")),
+    ("a Stripe secret key", re.compile(r"^[sr]k_live_[A-Za-z0-9]{16,}$")),
+    ("a URL with a password", re.compile(r"^[a-z][a-z0-9+.-]*://[^/:@\s]+:[^/@\s]+@", re.IGNORECASE)),
+)
+# Values that are obviously not credentials
+PLACEHOLDERS = {"", "changeme", "change-me", "example", "xxx", "todo", "none", "null", "false", "true"}
+
+def dedupe_env(env: Any) -> Tuple[Any, List[str]]:
+    """Keep the last entry of each variable in an app's `env`, where its name was first
+    listed. Returns (env, names that were set more than once)."""
+    if not isinstance(env, list):
+        return env, []
+    entries: Dict[str, Dict[str, Any]] = {}
+    unnamed, duplicates = [], []
+    for entry in env:
+        name = entry.get("name") if isinstance(entry, dict) else None
+        if not isinstance(name, str):
+            unnamed.append(entry)
+            continue
+        if name in entries and name not in duplicates:
+            duplicates.append(name)
+        entries[name] = entry
+    return list(entries.values()) + unnamed, duplicates
+
+def secret_warnings(env: Any) -> List[str]:
+    """Warnings for literal env values that look like credentials."""
+    warnings = []
+    for entry in env if isinstance(env, list) else []:
+        if not isinstance(entry, dict) or entry.get("valueFrom") or not isinstance(entry.get("name"), str):
+            continue
+        name, value = entry["name"], str(entry.get("value", ""))
+        if value.strip().lower() in PLACEHOLDERS:
+            continue
+        kind = next((kind for kind, pattern in SECRET_VALUE_PATTERNS if pattern.search(value)), None)
+        if kind:
+            warnings.append(f"env {name} looks like {kind}; store it as a secret instead of in the spec")
+        elif SECRET_NAME_PATTERN.search(name):
+            warnings.append(f"env {name} looks like a credential; store it as a secret instead of in the spec")
+    return warnings
+
+def check_env(app_spec: Dict[str, Any]) -> Tuple[Optional[List[str]], Optional[str]]:
+    """Dedupe an app's `env` in place. Returns (warnings, error)."""
+    if app_spec.get("envFile") is not None:
+        return None, "envFile is read by the CLI: register the spec with 'orchestry register' to merge it into env"
+    env, duplicates = dedupe_env(app_spec.get("env"))
+    if duplicates:
+        app_spec["env"] = env
+    warnings = [f"env {name} is set more than once; the last value is used" for name in duplicates]
+    return warnings + secret_warnings(env), None
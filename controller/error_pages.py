@@ -0,0 +1,111 @@
+"""
+Edge error pages and maintenance mode.
+An app's `errorPages` replaces nginx's default error output with the app's own
+HTML: "502", "503" and "504" are served when nginx cannot reach a replica or
+times out (for example while replicas are being replaced), and "503" is also
+served while the app has no ready replica, instead of removing its nginx
+config. Maintenance mode (`orchestry maintenance on APP`) answers every request
+with 503 and the "maintenance" page, or a built-in page showing the message,
+while the app's replicas keep running, so turning it off restores traffic at
+once. Maintenance mode is stored per app and survives redeploys.
+"""
+
+import os
+import time
+from html import escape
+from typing import Any, Dict, Optional, Tuple
+
+PAGE_KEYS = ("502", "503", "504", "maintenance")
+MAX_PAGE_BYTES = 64 * 1024
+MAX_MESSAGE_LENGTH = 500
+# Clients are asked to retry maintenance responses after this long
+MAINTENANCE_RETRY_AFTER_SECONDS = int(os.getenv("ORCHESTRY_MAINTENANCE_RETRY_AFTER_SECONDS", "120"))
+SETTING_PREFIX = "maintenance:"
+
+DEFAULT_MAINTENANCE_PAGE = """<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{title}</title></head>
+<body style="font-family: sans-serif; text-align: center; padding: 4em 1em;">
+<h1>{title}</h1>
+<p>{message}</p>
+</body>
+</html>
+"""
+
+def validate_error_pages(config: Any) -> Tuple[Optional[Dict[str, str]], Optional[str]]:
+    """Normalize `errorPages` to {"502"|"503"|"504"|"maintenance": html}. Returns (pages or None, error)."""
+    if not config:
+        return None, None
+    if not isinstance(config, dict):
+        return None, "errorPages must be a mapping of 502, 503, 504 or maintenance to HTML"
+    pages = {}
+    for key, html in config.items():
+        key = str(key)
+        if key not in PAGE_KEYS:
+            return None, f"errorPages.{key} is not supported, use one of {', '.join(PAGE_KEYS)}"
+        if not isinstance(html, str) or not html.strip():
+            return None, f"errorPages.{key} must be a non-empty HTML document"
+        if len(html.encode()) > MAX_PAGE_BYTES:
+            return None, f"errorPages.{key} must be at most {MAX_PAGE_BYTES // 1024} KiB"
+        pages[key] = html
+    return pages, None
+
+def validate_message(message: Any) -> Tuple[Optional[str], Optional[str]]:
+    """Normalize a maintenance message. Returns (message or None, error)."""
+    if message is None or (isinstance(message, str) and not message.strip()):
+        return None, None
+    if not isinstance(message, str) or len(message) > MAX_MESSAGE_LENGTH:
+        return None, f"message must be at most {MAX_MESSAGE_LENGTH} characters"
+    return message.strip(), None
+
+def default_maintenance_page(app_name: str, message: Optional[str]) -> str:
+    return DEFAULT_MAINTENANCE_PAGE.format(
+        title=escape(f"{app_name} is down for maintenance"),
+        message=escape(message or "We'll be back shortly.")
+    )
+
+def page_files(app_name: str, pages: Optional[Dict[str, str]], maintenance: Optional[Dict[str, Any]]) -> Dict[str, str]:
+    """The HTML files nginx serves for an app, by file name."""
+    files = {f"{key}.html": html for key, html in (pages or {}).items() if key != "maintenance"}
+    if maintenance:
+        files["maintenance.html"] = (pages or {}).get("maintenance") or default_maintenance_page(
+            app_name, maintenance.get("message"))
+    return files
+
+def nginx_context(directory: str, files: Dict[str, str], maintenance: bool) -> Dict[str, Any]:
+    """Template context: the page directory and which file answers each status code."""
+    codes = {key[:-len(".html")]: key for key in files if key != "maintenance.html"}
+    if maintenance:
+        codes["503"] = "maintenance.html"
+    return {
+        "dir": directory,
+        "codes": dict(sorted(codes.items())),
+        "maintenance": maintenance,
+        "retry_after": MAINTENANCE_RETRY_AFTER_SECONDS
+    }
+
+def serves_without_replicas(context: Optional[Dict[str, Any]]) -> bool:
+    """Whether nginx should keep answering for an app that has no ready replica."""
+    return bool(context and (context["maintenance"] or "503" in context["codes"]))
+
+class MaintenanceMode:
+    """Reads and changes apps' maintenance mode, kept in cluster settings."""
+
+    def __init__(self, state_store: Any):
+        self.state_store = state_store
+
+    def get(self, app_name: str) -> Optional[Dict[str, Any]]:
+        return self.state_store.get_setting(SETTING_PREFIX + app_name)
+
+    def enable(self, app_name: str, message: Optional[str], requested_by: Optional[str]) -> Optional[Dict[str, Any]]:
+        """Turn maintenance mode on, or change its message. Returns the state, or None if it was not saved."""
+        previous = self.get(app_name) or {}
+        state = {
+            "message": message,
+            "since": previous.get("since") or time.time(),
+            "requested_by": requested_by
+        }
+        return state if self.state_store.save_setting(SETTING_PREFIX + app_name, state) else None
+
+    def disable(self, app_name: str) -> bool:
+        return self.state_store.delete_setting(SETTING_PREFIX + app_name)
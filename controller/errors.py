@@ -0,0 +1,112 @@
+"""
+Machine-readable API errors.
+Every error response carries a stable code next to the message, so clients
+can branch on the code instead of parsing text:
+
+    {"detail": "App shop not found",
+     "error": {"code": "APP_NOT_FOUND", "message": "App shop not found", "status": 404}}
+
+`detail` is kept as it was for existing clients. Codes are only ever added,
+never renamed. Errors raised as plain HTTPExceptions get the code for their
+status.
+"""
+
+import re
+from typing import Any, Dict, Optional
+import docker
+import requests
+from fastapi import HTTPException
+
+APP_NOT_FOUND = "APP_NOT_FOUND"
+NOT_FOUND = "NOT_FOUND"
+NOT_LEADER = "NOT_LEADER"
+QUOTA_EXCEEDED = "QUOTA_EXCEEDED"
+VALIDATION_FAILED = "VALIDATION_FAILED"
+DOCKER_UNAVAILABLE = "DOCKER_UNAVAILABLE"
+UNAUTHORIZED = "UNAUTHORIZED"
+FORBIDDEN = "FORBIDDEN"
+CONFLICT = "CONFLICT"
+FROZEN = "FROZEN"
+UPSTREAM_ERROR = "UPSTREAM_ERROR"
+UNAVAILABLE = "UNAVAILABLE"
+INTERNAL_ERROR = "INTERNAL_ERROR"
+UNSUPPORTED_API_VERSION = "UNSUPPORTED_API_VERSION"
+OPERATION_IN_PROGRESS = "OPERATION_IN_PROGRESS"
+RESOURCE_VERSION_TOO_OLD = "RESOURCE_VERSION_TOO_OLD"
+
+# How the app manager reports a missing app
+APP_NOT_FOUND_PATTERN = re.compile(r"^App \S+ not found$")
+
+DEFAULT_CODES = {
+    400: VALIDATION_FAILED,
+    401: UNAUTHORIZED,
+    403: FORBIDDEN,
+    404: NOT_FOUND,
+    409: CONFLICT,
+    410: RESOURCE_VERSION_TOO_OLD,
+    422: VALIDATION_FAILED,
+    423: FROZEN,
+    429: QUOTA_EXCEEDED,
+    502: UPSTREAM_ERROR,
+    503: UNAVAILABLE,
+}
+
+class ApiError(HTTPException):
+    """An HTTPException with an explicit error code."""
+
+    def __init__(self, status_code: int, code: str, message: str,
+                 headers: Optional[Dict[str, str]] = None, details: Any = None):
+        super().__init__(status_code=status_code, detail=message, headers=headers)
+        self.code = code
+        self.details = details
+
+def error_code(exc: HTTPException) -> str:
+    return getattr(exc, "code", None) or DEFAULT_CODES.get(exc.status_code, INTERNAL_ERROR)
+
+def error_body(status_code: int, code: str, message: Any, details: Any = None) -> Dict[str, Any]:
+    """The JSON body of an error response."""
+    error = {"code": code, "message": message if isinstance(message, str) else str(message), "status": status_code}
+    if details is not None:
+        error["details"] = details
+    return {"detail": message, "error": error}
+
+def app_not_found(name: str) -> ApiError:
+    return ApiError(404, APP_NOT_FOUND, f"App {name} not found")
+
+def not_leader(leader_id: Optional[str]) -> ApiError:
+    if not leader_id:
+        return ApiError(503, NOT_LEADER, "No leader elected, cluster not ready")
+    return ApiError(503, NOT_LEADER, f"Not the leader. Leader is: {leader_id}",
+                    headers={"X-Current-Leader": leader_id})
+
+def quota_exceeded(message: str, retry_after: int) -> ApiError:
+    return ApiError(429, QUOTA_EXCEEDED, message, headers={"Retry-After": str(retry_after)})
+
+def validation_failed(message: str, details: Any = None) -> ApiError:
+    return ApiError(400, VALIDATION_FAILED, message, details=details)
+
+def docker_unavailable(e: Exception) -> bool:
+    """Whether an exception means the Docker daemon could not be reached, as opposed to
+    Docker refusing a request (missing container, bad image name...)."""
+    if isinstance(e, requests.exceptions.ConnectionError):
+        return True
+    if isinstance(e, docker.errors.APIError):
+        return e.is_server_error() and e.status_code in (502, 503, 504)
+    # docker.from_env() raises the base class when the daemon socket does not answer
+    return type(e) is docker.errors.DockerException
+
+def internal_error(e: Exception) -> ApiError:
+    """The error for an unexpected exception in a handler."""
+    if docker_unavailable(e):
+        return ApiError(503, DOCKER_UNAVAILABLE, f"Docker is unavailable: {e}")
+    return ApiError(500, INTERNAL_ERROR, str(e))
+
+def from_result(result: Dict[str, Any], status_code: int = 400) -> ApiError:
+    """The error for the {"error": ...} result of a manager call. A missing app is always a 404,
+    an app busy with another operation a 409."""
+    message = result["error"]
+    if APP_NOT_FOUND_PATTERN.match(message):
+        return ApiError(404, APP_NOT_FOUND, message)
+    if "active_operation" in result:
+        return ApiError(409, OPERATION_IN_PROGRESS, message, details=result["active_operation"])
+    return ApiError(status_code, DEFAULT_CODES.get(status_code, INTERNAL_ERROR), message)
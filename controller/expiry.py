@@ -0,0 +1,164 @@
+"""
+Ephemeral apps.
+Preview deployments of a branch or pull request should not outlive it. An
+app registered with `ttl` (how long after its latest registration) or
+`expiresAt` (a fixed time) is stopped and deleted by the leader once that
+time has passed:
+
+    metadata:
+      name: shop-pr-1234
+      labels:
+        branch: feature/new-checkout
+    ttl: 72h
+
+Registering the app again, e.g. when a new commit is pushed to the branch,
+starts the ttl over. Protected apps are never deleted automatically since
+deleting them needs a second approval, and nothing is deleted while the
+controller is frozen; both are recorded as events so the app can be cleaned
+up by hand.
+"""
+
+import os
+import re
+import time
+import logging
+import threading
+from datetime import datetime, timezone
+from typing import Any, Dict, Optional, Tuple
+
+from . import approvals
+
+logger = logging.getLogger(__name__)
+
+REAP_INTERVAL_SECONDS = int(os.getenv("ORCHESTRY_EXPIRY_INTERVAL_SECONDS", "60"))
+MIN_TTL_SECONDS = 300
+MAX_TTL_SECONDS = 90 * 86400
+REQUESTED_BY = "orchestry:expiry"
+DURATION_PATTERN = re.compile(r"^(\d+)([smhd])$")
+DURATION_UNITS = {"s": 1, "m": 60, "h": 3600, "d": 86400}
+
+def parse_duration(value: Any) -> Optional[int]:
+    """Seconds of a ttl given as an integer or as 30m, 48h, 7d... None if it is neither."""
+    if isinstance(value, int) and not isinstance(value, bool):
+        return value
+    match = DURATION_PATTERN.match(value.strip()) if isinstance(value, str) else None
+    if not match:
+        return None
+    return int(match.group(1)) * DURATION_UNITS[match.group(2)]
+
+def _parse_time(value: Any) -> Optional[float]:
+    """Epoch seconds of an ISO 8601 timestamp with a timezone, or None."""
+    if not isinstance(value, str):
+        return None
+    try:
+        moment = datetime.fromisoformat(value.strip().replace("Z", "+00:00"))
+    except ValueError:
+        return None
+    if moment.tzinfo is None:
+        return None
+    return moment.timestamp()
+
+def validate_expiry(ttl: Any, expires_at: Any, now: Optional[float] = None) -> Tuple[Optional[Dict[str, Any]], Optional[str]]:
+    """Normalize `ttl` / `expiresAt` of a registration into the `expiry` block to store.
+    Returns (expiry or None, error)."""
+    if ttl is None and expires_at is None:
+        return None, None
+    if ttl is not None and expires_at is not None:
+        return None, "ttl and expiresAt cannot both be set"
+    now = time.time() if now is None else now
+    if ttl is not None:
+        seconds = parse_duration(ttl)
+        if seconds is None or not MIN_TTL_SECONDS <= seconds <= MAX_TTL_SECONDS:
+            return None, (f"ttl must be a duration such as 30m, 48h or 7d between {MIN_TTL_SECONDS // 60} minutes "
+                          f"and {MAX_TTL_SECONDS // 86400} days")
+        return {"ttlSeconds": seconds, "expiresAt": now + seconds}, None
+    moment = _parse_time(expires_at)
+    if moment is None:
+        return None, "expiresAt must be an ISO 8601 timestamp with a timezone, e.g. 2024-06-01T18:00:00Z"
+    if moment <= now:
+        return None, "expiresAt is in the past"
+    if moment - now > MAX_TTL_SECONDS:
+        return None, f"expiresAt must be at most {MAX_TTL_SECONDS // 86400} days away"
+    return {"expiresAt": moment}, None
+
+def describe(expiry: Optional[Dict[str, Any]], now: Optional[float] = None) -> Optional[Dict[str, Any]]:
+    """An app's expiry as the API reports it, or None for apps that do not expire."""
+    if not expiry:
+        return None
+    now = time.time() if now is None else now
+    return {
+        "expires_at": expiry["expiresAt"],
+        "expires_at_iso": datetime.fromtimestamp(expiry["expiresAt"], timezone.utc).isoformat(),
+        "ttl_seconds": expiry.get("ttlSeconds"),
+        "remaining_seconds": max(0, int(expiry["expiresAt"] - now))
+    }
+
+class ExpiryReaper:
+    """Deletes apps whose `ttl` or `expiresAt` has passed. Only the leader reaps."""
+
+    def __init__(self, state_store: Any, app_manager: Any, cluster_controller: Any, freeze_state: Any = None):
+        self.state_store = state_store
+        self.app_manager = app_manager
+        self.cluster = cluster_controller
+        self.freeze = freeze_state
+        # Apps whose deletion was held back, so the event is recorded once per expiry
+        self._held: Dict[str, float] = {}
+        self._active = False
+        self._thread: Optional[threading.Thread] = None
+
+    def start(self):
+        if self._active:
+            return
+        self._active = True
+        self._thread = threading.Thread(target=self._loop, daemon=True)
+        self._thread.start()
+
+    def stop(self):
+        self._active = False
+
+    def _loop(self):
+        while self._active:
+            try:
+                if self.cluster.is_leader:
+                    self.run_once()
+            except Exception as e:
+                logger.error(f"Error in expiry reaper loop: {e}")
+            time.sleep(REAP_INTERVAL_SECONDS)
+
+    def run_once(self, now: Optional[float] = None) -> int:
+        """Delete every expired app that may be deleted. Returns the number of apps deleted."""
+        now = time.time() if now is None else now
+        frozen = bool(self.freeze and self.freeze.is_frozen())
+        deleted = 0
+        for item in self.state_store.list_apps():
+            spec = item.get("spec") or {}
+            expiry = spec.get("expiry")
+            if not expiry or expiry.get("expiresAt", now) > now or item.get("status") == "archived":
+                continue
+            if self.reap(item["name"], spec, expiry, frozen):
+                deleted += 1
+        return deleted
+
+    def reap(self, app_name: str, spec: Dict[str, Any], expiry: Dict[str, Any], frozen: bool = False) -> bool:
+        """Delete one expired app unless it is protected or the controller is frozen."""
+        held_by = None
+        if approvals.approval_reason(spec, "delete", {}):
+            held_by = "the app is protected; delete it with an approved operation"
+        elif frozen:
+            held_by = "the controller is frozen"
+        if held_by:
+            if self._held.get(app_name) != expiry["expiresAt"]:
+                self._held[app_name] = expiry["expiresAt"]
+                logger.warning(f"App {app_name} expired but is not deleted: {held_by}")
+                self.state_store.log_event(app_name, "expiry_held", {**describe(expiry), "reason": held_by})
+            return False
+
+        logger.info(f"App {app_name} expired, deleting it")
+        result = self.app_manager.delete(app_name, wait=False, requested_by=REQUESTED_BY)
+        if "error" in result:
+            logger.warning(f"Failed to delete expired app {app_name}: {result['error']}")
+            return False
+        self._held.pop(app_name, None)
+        self.state_store.log_event(app_name, "deleted", {**result, "requested_by": REQUESTED_BY, "reason": "expired",
+                                                         "expires_at": expiry["expiresAt"]})
+        return True
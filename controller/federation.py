@@ -0,0 +1,145 @@
+"""
+Federation of several Orchestry clusters (e.g. one per region).
+Each controller can be told about its peers with ORCHESTRY_FEDERATION
+("us-east=http://orchestry.us-east:8000,eu-west=http://orchestry.eu-west:8000")
+and its own name with ORCHESTRY_CLUSTER_NAME. The federation endpoints then
+list apps across every cluster and register a spec on each cluster named in
+its `placement.clusters`. Peers are reached through their normal API, on the
+leader they advertise, so every cluster still applies its own quotas, freeze
+windows, approvals and namespace policies.
+"""
+
+import os
+import re
+import logging
+import requests
+from concurrent.futures import ThreadPoolExecutor
+from typing import Any, Dict, List, Optional, Tuple
+from urllib.parse import urlparse
+
+logger = logging.getLogger(__name__)
+
+CLUSTER_NAME = os.getenv("ORCHESTRY_CLUSTER_NAME", "")
+REQUEST_TIMEOUT_SECONDS = float(os.getenv("ORCHESTRY_FEDERATION_TIMEOUT", "10"))
+CLUSTER_NAME_PATTERN = re.compile(r"^[a-z0-9]([a-z0-9-]{0,38}[a-z0-9])?$")
+
+# Headers passed on to peers so changes are recorded under the original caller
+FORWARDED_HEADERS = ("X-Orchestry-User", "X-Approver-Token", "X-Override-Reason")
+
+def parse_clusters(value: str) -> Dict[str, str]:
+    """ORCHESTRY_FEDERATION as {name: url}. Malformed entries are skipped with a warning."""
+    clusters = {}
+    for entry in (value or "").split(","):
+        name, _, url = entry.strip().partition("=")
+        name, url = name.strip(), url.strip().rstrip("/")
+        if not name and not url:
+            continue
+        parsed = urlparse(url)
+        if not CLUSTER_NAME_PATTERN.match(name) or parsed.scheme not in ("http", "https") or not parsed.netloc:
+            logger.warning(f"Ignoring federation entry {entry!r}: expected name=http(s)://host:port")
+            continue
+        clusters[name] = url
+    return clusters
+
+def validate_placement(placement: Any) -> Tuple[Optional[Dict[str, Any]], Optional[str]]:
+    """Normalize an app's `placement` block. Returns (placement or None, error)."""
+    if not placement:
+        return None, None
+    if isinstance(placement, list):
+        placement = {"clusters": placement}
+    if not isinstance(placement, dict):
+        return None, "placement must be a mapping with a clusters list"
+    names = placement.get("clusters")
+    if isinstance(names, str):
+        names = [names]
+    if not isinstance(names, list) or not names:
+        return None, "placement.clusters must list at least one cluster"
+    for name in names:
+        if not isinstance(name, str) or not CLUSTER_NAME_PATTERN.match(name):
+            return None, f"placement.clusters: {name!r} is not a valid cluster name"
+    return {"clusters": list(dict.fromkeys(names))}, None
+
+class Federation:
+    """Talks to the peer clusters listed in ORCHESTRY_FEDERATION."""
+
+    def __init__(self, clusters: Optional[Dict[str, str]] = None, local_name: Optional[str] = None):
+        self.clusters = clusters if clusters is not None else parse_clusters(os.getenv("ORCHESTRY_FEDERATION", ""))
+        self.local_name = local_name if local_name is not None else CLUSTER_NAME
+
+    def is_local(self, name: str) -> bool:
+        return bool(self.local_name) and name == self.local_name
+
+    def names(self) -> List[str]:
+        names = list(self.clusters)
+        if self.local_name and self.local_name not in names:
+            names.insert(0, self.local_name)
+        return names
+
+    def _write_url(self, url: str) -> str:
+        """The URL of the leader a cluster advertises, falling back to url."""
+        try:
+            response = requests.get(f"{url}/health", timeout=REQUEST_TIMEOUT_SECONDS)
+            leader = response.json().get("leader") if response.status_code == 200 else None
+            advertise_url = leader.get("advertise_url") if leader else None
+            if advertise_url:
+                return advertise_url.rstrip("/")
+        except Exception:
+            pass
+        return url
+
+    def status(self) -> List[Dict[str, Any]]:
+        """Every cluster with whether its controller answers."""
+        def probe(name: str) -> Dict[str, Any]:
+            if self.is_local(name):
+                return {"name": name, "url": self.clusters.get(name), "local": True, "reachable": True}
+            url = self.clusters[name]
+            try:
+                response = requests.get(f"{url}/health", timeout=REQUEST_TIMEOUT_SECONDS)
+                reachable = response.status_code == 200
+                error = None if reachable else f"HTTP {response.status_code}"
+            except requests.RequestException as e:
+                reachable, error = False, str(e)
+            return {"name": name, "url": url, "local": False, "reachable": reachable, "error": error}
+        return self._map(probe, self.names())
+
+    def get(self, name: str, path: str, params: Optional[Dict[str, Any]] = None) -> Dict[str, Any]:
+        """GET path on a peer. Returns the JSON body, or {"error": ...}."""
+        url = self.clusters.get(name)
+        if not url:
+            return {"error": f"Unknown cluster {name}"}
+        try:
+            response = requests.get(f"{url}{path}", params=params, timeout=REQUEST_TIMEOUT_SECONDS)
+            if response.status_code != 200:
+                return {"error": f"HTTP {response.status_code}: {_detail(response)}"}
+            return response.json()
+        except (requests.RequestException, ValueError) as e:
+            return {"error": str(e)}
+
+    def post(self, name: str, path: str, body: Any, headers: Optional[Dict[str, str]] = None) -> Tuple[int, Dict[str, Any]]:
+        """POST to a peer's leader. Returns (status code, JSON body); status 0 if unreachable."""
+        url = self.clusters.get(name)
+        if not url:
+            return 0, {"error": f"Unknown cluster {name}"}
+        forwarded = {key: value for key, value in (headers or {}).items() if key in FORWARDED_HEADERS}
+        try:
+            response = requests.post(f"{self._write_url(url)}{path}", json=body, headers=forwarded,
+                                     timeout=REQUEST_TIMEOUT_SECONDS * 3)
+            try:
+                data = response.json()
+            except ValueError:
+                data = {"detail": response.text}
+            return response.status_code, data
+        except requests.RequestException as e:
+            return 0, {"error": str(e)}
+
+    def _map(self, function, names: List[str]) -> List[Any]:
+        if not names:
+            return []
+        with ThreadPoolExecutor(max_workers=min(8, len(names))) as pool:
+            return list(pool.map(function, names))
+
+def _detail(response: Any) -> str:
+    try:
+        return str(response.json().get("detail", response.text))
+    except ValueError:
+        return response.text
@@ -0,0 +1,98 @@
+"""
+Scaling flap detection.
+An app flaps when the autoscaler keeps undoing its own decisions: it scales
+out, then back in (or in, then out) shortly after. Every replica started or
+stopped that way costs a container start and a config reload for nothing.
+The app's recent scaling history is scored by the share of its scaling
+actions, after the first, that reversed the previous one within
+ORCHESTRY_FLAP_WINDOW_SECONDS.
+GET /apps/{name}/metrics shows the score, and a flapping app gets a
+`scaling_flapping` warning with suggested cooldown and threshold changes.
+"""
+
+import math
+import os
+import time
+from typing import Any, Dict, List, Optional
+
+# A scaling action undoing the previous one this soon after it counts as a flap
+FLAP_WINDOW_SECONDS = int(os.getenv("ORCHESTRY_FLAP_WINDOW_SECONDS", "600"))
+# How much scaling history is scored
+FLAP_LOOKBACK_SECONDS = int(os.getenv("ORCHESTRY_FLAP_LOOKBACK_SECONDS", "3600"))
+# An app with at least this score and MIN_FLAPS flaps is flapping
+FLAP_WARNING_SCORE = float(os.getenv("ORCHESTRY_FLAP_WARNING_SCORE", "0.5"))
+MIN_FLAPS = 2
+# Scaling actions read from the history, newest first
+HISTORY_LIMIT = 200
+# Thresholds closer than this (in percentage points) leave little room between scaling out and in
+MIN_THRESHOLD_GAP_PCT = 50
+MIN_SCALE_IN_THRESHOLD_PCT = 5
+
+def _direction(action: Dict[str, Any]) -> int:
+    change = action["to_replicas"] - action["from_replicas"]
+    return (change > 0) - (change < 0)
+
+def _suggestions(policy: Any, flaps: List[Dict[str, Any]]) -> List[Dict[str, Any]]:
+    """Spec changes that would have damped the flaps, keyed by the `scaling` field to change."""
+    suggestions = []
+    if policy is None:
+        return suggestions
+    # A cooldown longer than the slowest reversal would have held each of them back
+    longest = max(flap["seconds"] for flap in flaps)
+    cooldown = max(policy.cooldown_seconds * 2, math.ceil((longest + 1) / 60) * 60)
+    suggestions.append({
+        "field": "cooldownSeconds", "current": policy.cooldown_seconds, "suggested": cooldown,
+        "reason": f"scaling was reversed within {round(longest)}s of the previous change"
+    })
+    gap = policy.scale_out_threshold_pct - policy.scale_in_threshold_pct
+    scale_in = max(MIN_SCALE_IN_THRESHOLD_PCT,
+                   policy.scale_out_threshold_pct - MIN_THRESHOLD_GAP_PCT if gap < MIN_THRESHOLD_GAP_PCT
+                   else policy.scale_in_threshold_pct - 10)
+    if scale_in < policy.scale_in_threshold_pct:
+        suggestions.append({
+            "field": "scaleInThresholdPct", "current": policy.scale_in_threshold_pct, "suggested": scale_in,
+            "reason": f"replicas are removed at {policy.scale_in_threshold_pct}% load and added at "
+                      f"{policy.scale_out_threshold_pct}%; a wider gap keeps load after a scale-out from triggering a scale-in"
+        })
+    if policy.window_seconds < 120:
+        suggestions.append({
+            "field": "windowSeconds", "current": policy.window_seconds, "suggested": policy.window_seconds * 2,
+            "reason": "a longer metrics window smooths out short bursts"
+        })
+    return suggestions
+
+def analyze(history: List[Dict[str, Any]], policy: Any = None, now: Optional[float] = None) -> Dict[str, Any]:
+    """Score an app's scaling history (as from get_scaling_history) for oscillation."""
+    now = time.time() if now is None else now
+    actions = sorted(
+        (action for action in history
+         if action["timestamp"] >= now - FLAP_LOOKBACK_SECONDS and _direction(action)),
+        key=lambda action: action["timestamp"]
+    )
+    flaps = []
+    for previous, action in zip(actions, actions[1:]):
+        seconds = action["timestamp"] - previous["timestamp"]
+        if _direction(action) == -_direction(previous) and seconds <= FLAP_WINDOW_SECONDS:
+            flaps.append({
+                "first": "scale_out" if _direction(previous) > 0 else "scale_in",
+                "replicas": [previous["from_replicas"], previous["to_replicas"], action["to_replicas"]],
+                "at": action["timestamp"], "seconds": round(seconds, 1)
+            })
+    score = round(len(flaps) / (len(actions) - 1), 2) if len(actions) > 1 else 0.0
+    flapping = len(flaps) >= MIN_FLAPS and score >= FLAP_WARNING_SCORE
+    return {
+        "score": score,
+        "flapping": flapping,
+        "flaps": len(flaps),
+        "scaling_actions": len(actions),
+        "window_seconds": FLAP_WINDOW_SECONDS,
+        "lookback_seconds": FLAP_LOOKBACK_SECONDS,
+        "recent_flaps": flaps[-5:],
+        "suggestions": _suggestions(policy, flaps) if flapping else []
+    }
+
+def warning_message(app_name: str, report: Dict[str, Any]) -> str:
+    hints = ", ".join(f"{s['field']} {s['current']} -> {s['suggested']}" for s in report["suggestions"])
+    message = (f"{app_name} is flapping: {report['flaps']} of its last {report['scaling_actions']} scaling actions "
+               f"undid the one before within {report['window_seconds']}s (score {report['score']})")
+    return f"{message}; consider {hints}" if hints else message
@@ -0,0 +1,64 @@
+"""
+Cluster-wide maintenance freeze.
+While frozen, the controller keeps serving reads but stops acting on its own:
+no autoscaling, no automatic restarts or minReplicas enforcement, and no
+orphaned container cleanup. The flag is stored in the database so every
+controller in the cluster (and the next leader) sees the same state.
+"""
+
+import time
+import logging
+from typing import Any, Dict, Optional
+
+logger = logging.getLogger(__name__)
+
+SYSTEM_EVENT_SCOPE = "orchestry"
+FREEZE_SETTING_KEY = "freeze"
+# Followers pick up freeze changes made through the leader within this many seconds
+REFRESH_INTERVAL_SECONDS = 5
+
+class FreezeState:
+    """Reads and changes the maintenance freeze flag."""
+
+    def __init__(self, state_store: Any):
+        self.state_store = state_store
+        self._cached: Dict[str, Any] = {"frozen": False}
+        self._loaded_at = 0.0
+
+    def status(self, refresh: bool = False) -> Dict[str, Any]:
+        """Current freeze state: frozen, reason, frozen_by and frozen_at."""
+        if refresh or time.time() - self._loaded_at >= REFRESH_INTERVAL_SECONDS:
+            value = self.state_store.get_setting(FREEZE_SETTING_KEY)
+            self._cached = value if isinstance(value, dict) else {"frozen": False}
+            self._loaded_at = time.time()
+        return dict(self._cached)
+
+    def is_frozen(self) -> bool:
+        return bool(self.status().get("frozen"))
+
+    def freeze(self, reason: str, frozen_by: Optional[str] = None) -> Dict[str, Any]:
+        current = self.status(refresh=True)
+        if current.get("frozen"):
+            return {"error": f"Controller is already frozen: {current.get('reason')}"}
+        value = {
+            "frozen": True,
+            "reason": reason,
+            "frozen_by": frozen_by,
+            "frozen_at": time.time()
+        }
+        return self._save(value, "frozen")
+
+    def unfreeze(self) -> Dict[str, Any]:
+        if not self.status(refresh=True).get("frozen"):
+            return {"error": "Controller is not frozen"}
+        return self._save({"frozen": False}, "unfrozen")
+
+    def _save(self, value: Dict[str, Any], action: str) -> Dict[str, Any]:
+        if not self.state_store.save_setting(FREEZE_SETTING_KEY, value):
+            return {"error": "Failed to save freeze state"}
+        self._cached = value
+        self._loaded_at = time.time()
+        self.state_store.log_event(SYSTEM_EVENT_SCOPE, f"controller_{action}", value)
+        logger.warning(f"Controller {action} for maintenance" +
+                       (f": {value.get('reason')}" if value.get("reason") else ""))
+        return self.status()
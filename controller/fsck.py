@@ -0,0 +1,207 @@
+"""
+Controller data consistency checker.
+Cross-checks the four places that describe what is running: Docker containers
+labeled orchestry.app, the instances table, the app manager's in-memory
+instance maps and the nginx conf files. Reports every inconsistency with a
+suggested repair, and can apply the repairs.
+"""
+
+import time
+import logging
+from typing import Any, Callable, Dict, List, Optional
+
+from .manager import InstanceState
+from . import warm_pool
+
+logger = logging.getLogger(__name__)
+
+class ConsistencyChecker:
+    """Finds (and optionally repairs) disagreements between Docker, the database,
+    the in-memory instance maps and nginx."""
+
+    def __init__(self, app_manager: Any, state_store: Any, nginx_manager: Any):
+        self.app_manager = app_manager
+        self.state_store = state_store
+        self.nginx = nginx_manager
+
+    def _docker_containers(self) -> Dict[str, Dict[str, Any]]:
+        containers = {}
+        for container in self.app_manager.docker_client.containers.list(all=True, filters={"label": "orchestry.app"}):
+            if warm_pool.is_standby(container) and self.state_store.get_app(container.labels.get("orchestry.app")):
+                continue  # idle warm pool standbys are not replicas
+            containers[container.id] = {
+                "app": container.labels.get("orchestry.app"),
+                "name": container.name,
+                "status": container.status,
+                "container": container
+            }
+        return containers
+
+    def check(self, fix: bool = False) -> Dict[str, Any]:
+        """Run every check. With fix, apply each issue's repair and record the outcome."""
+        started = time.time()
+        apps = {app["name"]: app for app in self.state_store.list_apps()}
+        containers = self._docker_containers()
+        with self.app_manager._lock:
+            memory = {
+                app_name: [inst for inst in instances if inst.state != InstanceState.DOWN]
+                for app_name, instances in self.app_manager.instances.items()
+            }
+        tracked = {inst.container_id: app_name for app_name, instances in memory.items() for inst in instances}
+        rows = {}
+        for app_name in apps:
+            for record in self.state_store.get_instances(app_name):
+                rows[record.container_id] = record
+        nginx_configs = self.nginx.configured_upstreams()
+
+        issues: List[Dict[str, Any]] = []
+
+        def issue(kind: str, app_name: Optional[str], detail: str, repair: str,
+                  action: Optional[Callable[[], Any]], container_id: Optional[str] = None):
+            issues.append({
+                "type": kind,
+                "app": app_name,
+                "container_id": container_id[:12] if container_id else None,
+                "detail": detail,
+                "repair": repair,
+                "_action": action
+            })
+
+        # Docker containers the controller does not know about
+        needs_reconcile = set()
+        for container_id, info in containers.items():
+            app_name = info["app"]
+            if app_name not in apps:
+                issue("orphaned_container", app_name,
+                      f"Container {info['name']} ({info['status']}) belongs to an app that is not registered",
+                      "remove the container", lambda c=info["container"]: self._remove_container(c), container_id)
+            elif container_id not in tracked:
+                if apps[app_name].get("status") == "running":
+                    needs_reconcile.add(app_name)
+                    issue("untracked_container", app_name,
+                          f"Container {info['name']} ({info['status']}) is not tracked by the controller",
+                          "adopt it with reconcile", lambda a=app_name: self.app_manager.reconcile_app(a), container_id)
+                else:
+                    issue("stale_container", app_name,
+                          f"Container {info['name']} ({info['status']}) exists but the app is {apps[app_name].get('status')}",
+                          "remove the container", lambda c=info["container"]: self._remove_container(c), container_id)
+            elif info["status"] != "running":
+                issue("container_not_running", app_name,
+                      f"Tracked container {info['name']} is {info['status']}",
+                      "drop it from tracking so the replica is recreated",
+                      lambda a=app_name, c=container_id: self._forget_instance(a, c), container_id)
+
+        # In-memory instances
+        for app_name, instances in memory.items():
+            if app_name not in apps:
+                issue("unregistered_app_in_memory", app_name,
+                      f"{len(instances)} instance(s) tracked in memory for an app that is not registered",
+                      "drop the app from tracking", lambda a=app_name: self._forget_app(a))
+                continue
+            for inst in instances:
+                if inst.container_id not in containers:
+                    issue("missing_container", app_name,
+                          f"Tracked instance {inst.ip}:{inst.port} ({inst.state.value}) has no Docker container",
+                          "drop it from tracking so the replica is recreated",
+                          lambda a=app_name, c=inst.container_id: self._forget_instance(a, c), inst.container_id)
+                elif inst.container_id not in rows:
+                    issue("missing_instance_row", app_name,
+                          f"Tracked instance {inst.ip}:{inst.port} has no row in the instances table",
+                          "save its current health to the instances table",
+                          lambda c=inst.container_id: self.app_manager.health_checker.persist(c), inst.container_id)
+
+        # Instances table rows
+        for container_id, record in rows.items():
+            if container_id not in containers:
+                issue("stale_instance_row", record.app_name,
+                      f"Instances table row {record.ip}:{record.port} ({record.status}) has no Docker container",
+                      "delete the row", lambda c=container_id: self.state_store.delete_instance(c), container_id)
+            elif container_id not in tracked and record.app_name not in needs_reconcile:
+                issue("untracked_instance_row", record.app_name,
+                      f"Instances table row {record.ip}:{record.port} is for a container the controller does not track",
+                      "delete the row", lambda c=container_id: self.state_store.delete_instance(c), container_id)
+
+        # Nginx conf files
+        for app_name, servers in nginx_configs.items():
+            if app_name not in apps:
+                issue("orphaned_nginx_config", app_name,
+                      "Nginx config exists for an app that is not registered",
+                      "remove the config", lambda a=app_name: self.nginx.remove_app_config(a))
+                continue
+            expected = sorted(f"{inst.ip}:{inst.port}" for inst in memory.get(app_name, []) if inst.routable)
+            if servers != expected:
+                issue("stale_nginx_upstreams", app_name,
+                      f"Nginx routes to {servers or 'nothing'} but the ready replicas are {expected or 'none'}",
+                      "re-render the app's nginx config",
+                      lambda a=app_name: self.app_manager._update_nginx_config(a))
+        for app_name, instances in memory.items():
+            if app_name in apps and app_name not in nginx_configs and any(inst.routable for inst in instances):
+                issue("missing_nginx_config", app_name,
+                      "The app has ready replicas but no nginx config",
+                      "re-render the app's nginx config",
+                      lambda a=app_name: self.app_manager._update_nginx_config(a))
+
+        if fix:
+            self._repair(issues)
+
+        for item in issues:
+            item.pop("_action", None)
+        report = {
+            "consistent": not issues,
+            "issues": issues,
+            "count": len(issues),
+            "checked": {
+                "apps": len(apps),
+                "containers": len(containers),
+                "instance_rows": len(rows),
+                "tracked_instances": len(tracked),
+                "nginx_configs": len(nginx_configs)
+            },
+            "fixed": fix,
+            "duration_seconds": round(time.time() - started, 3)
+        }
+        logger.info(f"Consistency check found {len(issues)} issue(s){' and repaired them' if fix else ''}")
+        return report
+
+    def _repair(self, issues: List[Dict[str, Any]]):
+        done = set()
+        for item in issues:
+            # Several issues can share one repair (e.g. reconciling an app adopts all its containers)
+            key = (item["repair"], item["app"]) if item["repair"].startswith(("adopt", "re-render")) else id(item)
+            if key in done:
+                item["repaired"] = True
+                continue
+            try:
+                result = item["_action"]()
+                item["repaired"] = result is not False
+            except Exception as e:
+                logger.error(f"Failed to repair {item['type']} for {item['app']}: {e}")
+                item["repaired"] = False
+                item["repair_error"] = str(e)
+            done.add(key)
+        touched = {item["app"] for item in issues if item["type"] in ("missing_container", "container_not_running")}
+        for app_name in touched:
+            self.app_manager._update_nginx_config(app_name)
+        for item in issues:
+            if item.get("repaired"):
+                self.state_store.log_event(item["app"] or "orchestry", "fsck_repaired", {
+                    "issue": item["type"], "container_id": item["container_id"], "repair": item["repair"]
+                })
+
+    @staticmethod
+    def _remove_container(container: Any):
+        if container.status == "running":
+            container.stop(timeout=10)
+        container.remove()
+
+    def _forget_instance(self, app_name: str, container_id: str):
+        with self.app_manager._lock:
+            instances = self.app_manager.instances.get(app_name, [])
+            self.app_manager.instances[app_name] = [inst for inst in instances if inst.container_id != container_id]
+        self.app_manager.health_checker.remove_target(container_id)
+
+    def _forget_app(self, app_name: str):
+        with self.app_manager._lock:
+            instances = self.app_manager.instances.pop(app_name, [])
+        for inst in instances:
+            self.app_manager.health_checker.remove_target(inst.container_id)
@@ -1,17 +1,32 @@
 """
-Health checking functionality for HTTP applications.
-Performs HTTP health checks and manages container health state.
+Health checking functionality for HTTP and UDP applications.
+Performs HTTP health checks (or UDP probes) and manages container health state.
 """
 
 import aiohttp
 import asyncio
+import os
 import time
 import logging
-from typing import Dict, List, Optional
-from dataclasses import dataclass
+from typing import Any, Dict, List, Optional
+from dataclasses import dataclass, field
+
+from state.db import InstanceRecord
+from . import health_content
 
 logger = logging.getLogger(__name__)
 
+# Health state is written to the instances table at most this often per container
+# (and on every healthy/unhealthy transition) so a restarted controller or a new
+# leader can pick up where the last one left off.
+PERSIST_INTERVAL_SECONDS = 15
+# Persisted state older than this (or three check intervals) is not trusted on restore
+WARM_RESTORE_MAX_AGE_SECONDS = 60
+# With sharded checks, results saved by other nodes are read back this often
+SHARD_SYNC_INTERVAL_SECONDS = 2
+# Default for gracePeriodSeconds: failed checks this soon after a replica starts are not counted
+DEFAULT_GRACE_PERIOD_SECONDS = int(os.getenv("ORCHESTRY_HEALTH_GRACE_SECONDS", "0"))
+
 @dataclass
 class HealthCheckConfig:
     path: str = "/healthz"
@@ -19,6 +34,27 @@ class HealthCheckConfig:
     timeout_seconds: int = 2
     failure_threshold: int = 3
     success_threshold: int = 1
+    type: str = "http"  # http or udp
+    port: Optional[int] = None  # defaults to the container port
+    send: str = ""  # UDP probe payload
+    expect: Optional[str] = None  # UDP reply must contain this; without it a silent port passes
+    initial_delay_seconds: int = 0  # no checks this soon after the replica started
+    grace_period_seconds: int = 0  # failed checks this soon after the replica started are not counted
+    content_expressions: List[str] = field(default_factory=list)  # JSON payload must satisfy all (HTTP)
+
+class _UdpProbe(asyncio.DatagramProtocol):
+    """Resolves a future with the first reply, or the ICMP error if the port is closed."""
+
+    def __init__(self, reply: asyncio.Future):
+        self.reply = reply
+
+    def datagram_received(self, data, addr):
+        if not self.reply.done():
+            self.reply.set_result(data)
+
+    def error_received(self, exc):
+        if not self.reply.done():
+            self.reply.set_exception(exc)
 
 @dataclass
 class HealthStatus:
@@ -28,20 +64,54 @@ class HealthStatus:
     last_check: float = 0.0
     last_success: float = 0.0
     response_time_ms: float = 0.0
+    last_error: str = ""  # why the last check failed
 
 class HealthChecker:
-    def __init__(self):
+    def __init__(self, state_store: Any = None):
+        self.state_store = state_store
         self.health_configs: Dict[str, HealthCheckConfig] = {}
         self.health_status: Dict[str, HealthStatus] = {}
         self.container_info: Dict[str, Dict] = {}  # Store container IP and port info
         self.session: Optional[aiohttp.ClientSession] = None
         self._running = False
         self._health_change_callback = None  # Callback for when health status changes
+        self._observer_callback = None  # Callback for health synced from the store while inactive
+        self._injected_failures: Dict[str, float] = {}  # container_id -> injected failure expiry
+        self._last_persisted: Dict[str, float] = {}  # container_id -> last time health was saved
+        self._is_active = lambda: True
+        self._owns = None  # container_id -> whether this node probes it (sharded checks)
+        self._last_sync = 0.0
 
     def set_health_change_callback(self, callback):
         """Set callback function to be called when container health status changes."""
         self._health_change_callback = callback
 
+    def set_observer_callback(self, callback):
+        """Set callback called with (container_id, is_healthy) when a standby picks up
+        a health change persisted by the active checker."""
+        self._observer_callback = callback
+
+    def set_active_check(self, is_active):
+        """Only run checks while is_active() is true (e.g. while this node is the leader)."""
+        self._is_active = is_active
+
+    def set_shard_owner(self, owns):
+        """Only probe the targets owns(container_id) accepts, on every node; results for
+        the rest are read back from the store (see controller/health_shards.py)."""
+        self._owns = owns
+
+    def _checks_target(self, container_id: str) -> bool:
+        if self._owns is not None:
+            return self._owns(container_id)
+        return self._is_active()
+
+    def _notify_change(self, container_id: str, is_healthy: bool):
+        """Only the active node acts on a health change; a node probing its shard while
+        inactive just mirrors the result."""
+        callback = self._health_change_callback if self._is_active() else self._observer_callback
+        if callback:
+            callback(container_id, is_healthy)
+
     async def start(self):
         """Start the health checker background task."""
         if not self._running:
@@ -60,21 +130,151 @@ class HealthChecker:
             self.session = None
         logger.info("Health checker stopped")
 
-    def add_target(self, container_id: str, ip: str, port: int, config: HealthCheckConfig):
-        """Add a container to health monitoring."""
+    def add_target(self, container_id: str, ip: str, port: int, config: HealthCheckConfig,
+                   app_name: Optional[str] = None, started_at: Optional[float] = None):
+        """Add a container to health monitoring, restoring its last-known health if it is recent.
+        started_at is when the replica (re)started; the initial delay and grace period count
+        from it, and a target without it (e.g. one adopted after a controller restart) gets neither."""
         target_key = f"{ip}:{port}"
-        self.health_configs[container_id] = config or HealthCheckConfig()
-        self.health_status[container_id] = HealthStatus(is_healthy=False)
-        self.container_info[container_id] = {"ip": ip, "port": port}
-        logger.info(f"Added health check target: {target_key} for container {container_id}")
+        config = config or HealthCheckConfig()
+        self.health_configs[container_id] = config
+        self.container_info[container_id] = {"ip": ip, "port": port, "app_name": app_name}
+        if started_at:
+            self.container_info[container_id]["checks_from"] = started_at + config.initial_delay_seconds
+            self.container_info[container_id]["grace_until"] = started_at + config.grace_period_seconds
+
+        restored = self._restore_status(container_id, ip, port, config)
+        self.health_status[container_id] = restored or HealthStatus(is_healthy=False)
+        if restored:
+            logger.info(f"Restored health check target: {target_key} for container {container_id} "
+                        f"({'healthy' if restored.is_healthy else 'unhealthy'})")
+        else:
+            logger.info(f"Added health check target: {target_key} for container {container_id}")
+        # A standby must not overwrite what the node probing this target has saved; the
+        # active node always saves new targets so other nodes can find them
+        if self._is_active() or self._checks_target(container_id):
+            self._persist(container_id)
 
     def remove_target(self, container_id: str):
         """Remove a container from health monitoring."""
         self.health_configs.pop(container_id, None)
         self.health_status.pop(container_id, None)
-        self.container_info.pop(container_id, None)
+        info = self.container_info.pop(container_id, None)
+        self._injected_failures.pop(container_id, None)
+        self._last_persisted.pop(container_id, None)
+        if self.state_store and info and info.get("app_name"):
+            self.state_store.delete_instance(container_id)
         logger.info(f"Removed health check target: {container_id}")
 
+    def _restore_status(self, container_id: str, ip: str, port: int,
+                        config: HealthCheckConfig) -> Optional[HealthStatus]:
+        """Get the persisted health of a container if it still describes the same target."""
+        if not self.state_store:
+            return None
+        try:
+            record = self.state_store.get_instance(container_id)
+        except Exception as e:
+            logger.warning(f"Could not load persisted health for container {container_id}: {e}")
+            return None
+
+        if not record or record.ip != ip or record.port != port or not record.last_health_check:
+            return None
+        max_age = max(WARM_RESTORE_MAX_AGE_SECONDS, 3 * config.interval_seconds)
+        if time.time() - record.last_health_check > max_age:
+            return None
+
+        return HealthStatus(
+            is_healthy=record.is_healthy,
+            consecutive_failures=record.failure_count or 0,
+            consecutive_successes=record.consecutive_successes or 0,
+            last_check=record.last_health_check,
+            last_success=record.last_success or 0.0
+        )
+
+    def reload_persisted(self, notify: bool = False, container_ids: Optional[List[str]] = None,
+                         callback=None) -> int:
+        """Replace in-memory health with recent persisted state, e.g. after taking over as leader.
+        With notify, callback (default: the observer callback) is told about targets whose
+        health changed. container_ids limits the reload to some targets."""
+        callback = callback or self._observer_callback
+        restored = 0
+        for container_id in container_ids if container_ids is not None else list(self.container_info):
+            info = self.container_info.get(container_id)
+            if not info:
+                continue
+            config = self.health_configs.get(container_id) or HealthCheckConfig()
+            status = self._restore_status(container_id, info["ip"], info["port"], config)
+            if status:
+                previous = self.health_status.get(container_id)
+                self.health_status[container_id] = status
+                restored += 1
+                if previous is None or not previous.last_check:
+                    # A target still starting is only reported once it settles
+                    changed = status.is_healthy or status.consecutive_failures >= config.failure_threshold
+                else:
+                    changed = previous.is_healthy != status.is_healthy
+                if notify and changed and callback:
+                    callback(container_id, status.is_healthy)
+        return restored
+
+    def persist(self, container_id: str):
+        """Save a container's current health right away (e.g. to repair a missing instances row)."""
+        self._persist(container_id)
+
+    def _persist(self, container_id: str):
+        """Save a container's current health to the instances table."""
+        info = self.container_info.get(container_id)
+        status = self.health_status.get(container_id)
+        if not self.state_store or not info or not status or not info.get("app_name"):
+            return
+
+        now = time.time()
+        try:
+            self.state_store.save_instance(InstanceRecord(
+                app_name=info["app_name"],
+                container_id=container_id,
+                ip=info["ip"],
+                port=info["port"],
+                status="ready" if status.is_healthy else ("unhealthy" if status.last_check else "starting"),
+                created_at=now,
+                updated_at=now,
+                failure_count=status.consecutive_failures,
+                last_health_check=status.last_check or None,
+                is_healthy=status.is_healthy,
+                consecutive_successes=status.consecutive_successes,
+                last_success=status.last_success or None
+            ))
+            self._last_persisted[container_id] = now
+        except Exception as e:
+            logger.warning(f"Failed to persist health for container {container_id}: {e}")
+
+    def inject_failure(self, container_id: str, duration_seconds: float):
+        """Force a container to report unhealthy for a while (chaos testing)."""
+        self._injected_failures[container_id] = time.time() + duration_seconds
+        status = self.health_status.setdefault(container_id, HealthStatus(is_healthy=True))
+        was_healthy = status.is_healthy
+        status.is_healthy = False
+        status.consecutive_successes = 0
+        logger.warning(f"Injected health check failure for container {container_id} for {duration_seconds}s")
+        if was_healthy and self._health_change_callback:
+            self._health_change_callback(container_id, False)
+
+    def clear_injected_failure(self, container_id: str):
+        """Stop forcing a container unhealthy and restore it to service."""
+        if self._injected_failures.pop(container_id, None) is None:
+            return
+        status = self.health_status.get(container_id)
+        if status and not status.is_healthy:
+            status.is_healthy = True
+            status.consecutive_failures = 0
+            logger.info(f"Cleared injected health check failure for container {container_id}")
+            if self._health_change_callback:
+                self._health_change_callback(container_id, True)
+
+    def has_injected_failure(self, container_id: str) -> bool:
+        """Check whether a container currently has an injected health failure."""
+        return self._injected_failures.get(container_id, 0) > time.time()
+
     def get_health_status(self, container_id: str) -> Optional[HealthStatus]:
         """Get the current health status of a container."""
         return self.health_status.get(container_id)
@@ -84,13 +284,37 @@ class HealthChecker:
         status = self.health_status.get(container_id)
         return status.is_healthy if status else False
 
+    def in_grace_period(self, container_id: str, now: Optional[float] = None) -> bool:
+        """True while a recently started container's failed checks do not count yet."""
+        info = self.container_info.get(container_id) or {}
+        return (now or time.time()) < max(info.get("checks_from", 0), info.get("grace_until", 0))
+
     async def _health_check_loop(self):
         """Main health checking loop."""
         while self._running:
             try:
-                # Create tasks for all health checks
+                active = self._is_active()
+                if self._owns is None and not active:
+                    # Follow the active checker's results so instance states stay current
+                    if time.time() - self._last_sync >= PERSIST_INTERVAL_SECONDS:
+                        self._last_sync = time.time()
+                        await asyncio.to_thread(self.reload_persisted, True)
+                    await asyncio.sleep(1)
+                    continue
+
+                if self._owns is not None and time.time() - self._last_sync >= SHARD_SYNC_INTERVAL_SECONDS:
+                    # Pick up what other nodes found for their shards; the leader routes on it
+                    self._last_sync = time.time()
+                    remote = [container_id for container_id in list(self.health_configs) if not self._owns(container_id)]
+                    if remote:
+                        callback = self._health_change_callback if active else self._observer_callback
+                        await asyncio.to_thread(self.reload_persisted, True, remote, callback)
+
+                # Create tasks for the health checks this node runs
                 tasks = []
                 for container_id in list(self.health_configs.keys()):
+                    if not self._checks_target(container_id):
+                        continue
                     task = asyncio.create_task(self._check_container_health(container_id))
                     tasks.append(task)
 
@@ -117,6 +341,9 @@ class HealthChecker:
         now = time.time()
         if now - status.last_check < config.interval_seconds:
             return
+        if now < self.container_info.get(container_id, {}).get("checks_from", 0):
+            return  # still within initialDelaySeconds
+        was_healthy_before = status.is_healthy
 
         # Get container info (this would be passed from the manager)
         # For now, we'll need to reconstruct this from the container_id
@@ -127,11 +354,16 @@ class HealthChecker:
             if not container_info:
                 return
 
-            ip, port = container_info["ip"], container_info["port"]
+            ip, port = container_info["ip"], config.port or container_info["port"]
 
-            # Perform the health check
+            # Perform the health check, unless a failure has been injected
             start_time = time.time()
-            is_healthy = await self._perform_http_check(ip, port, config)
+            if self.has_injected_failure(container_id):
+                is_healthy = False
+            elif config.type == "udp":
+                is_healthy = await self._perform_udp_check(ip, port, config)
+            else:
+                is_healthy = await self._perform_http_check(ip, port, config, status)
             response_time = (time.time() - start_time) * 1000  # Convert to ms
 
             # Update status
@@ -142,6 +374,7 @@ class HealthChecker:
                 status.consecutive_successes += 1
                 status.consecutive_failures = 0
                 status.last_success = now
+                status.last_error = ""
 
                 # Mark as healthy if we've had enough consecutive successes
                 if status.consecutive_successes >= config.success_threshold:
@@ -150,34 +383,46 @@ class HealthChecker:
                     if was_unhealthy:
                         logger.info(f"Container {container_id} is now healthy")
                         # Notify callback of health status change
-                        if self._health_change_callback:
-                            self._health_change_callback(container_id, True)
+                        self._notify_change(container_id, True)
+            elif self.in_grace_period(container_id, now):
+                status.consecutive_successes = 0
+                logger.debug(f"Container {container_id} failed a health check during its grace period")
             else:
                 status.consecutive_failures += 1
                 status.consecutive_successes = 0
 
                 # Mark as unhealthy if we've had too many consecutive failures
                 if status.consecutive_failures >= config.failure_threshold:
-                    was_healthy = status.is_healthy
+                    was_healthy = status.is_healthy or self._never_passed(status, config)
                     status.is_healthy = False
                     if was_healthy:
                         logger.warning(f"Container {container_id} is now unhealthy")
                         # Notify callback of health status change
-                        if self._health_change_callback:
-                            self._health_change_callback(container_id, False)
+                        self._notify_change(container_id, False)
 
         except Exception as e:
             logger.error(f"Health check failed for container {container_id}: {e}")
-            status.consecutive_failures += 1
             status.consecutive_successes = 0
-            if status.consecutive_failures >= config.failure_threshold:
-                was_healthy = status.is_healthy
-                status.is_healthy = False
-                if was_healthy:
-                    logger.warning(f"Container {container_id} marked unhealthy due to health check failure")
-                    # Notify callback of health status change
-                    if self._health_change_callback:
-                        self._health_change_callback(container_id, False)
+            if not self.in_grace_period(container_id, now):
+                status.consecutive_failures += 1
+                if status.consecutive_failures >= config.failure_threshold:
+                    was_healthy = status.is_healthy or self._never_passed(status, config)
+                    status.is_healthy = False
+                    if was_healthy:
+                        logger.warning(f"Container {container_id} marked unhealthy due to health check failure")
+                        # Notify callback of health status change
+                        self._notify_change(container_id, False)
+
+        # Save transitions right away and everything else periodically
+        if (status.is_healthy != was_healthy_before or
+                now - self._last_persisted.get(container_id, 0) >= PERSIST_INTERVAL_SECONDS):
+            await asyncio.to_thread(self._persist, container_id)
+
+    @staticmethod
+    def _never_passed(status: HealthStatus, config: HealthCheckConfig) -> bool:
+        """True the first time a target that has never passed a check reaches the failure
+        threshold, so a container stuck starting is reported unhealthy once."""
+        return not status.last_success and status.consecutive_failures == config.failure_threshold
 
     def _get_container_info(self, container_id: str) -> Optional[Dict]:
         """Get container IP and port info."""
@@ -191,11 +436,20 @@ class HealthChecker:
             interval_seconds=health_spec.get("periodSeconds", 5),
             timeout_seconds=health_spec.get("timeoutSeconds", 2),
             failure_threshold=health_spec.get("failureThreshold", 3),
-            success_threshold=health_spec.get("successThreshold", 1)
+            success_threshold=health_spec.get("successThreshold", 1),
+            type=health_spec.get("type", "http"),
+            port=health_spec.get("port"),
+            send=health_spec.get("send") or "",
+            expect=health_spec.get("expect"),
+            initial_delay_seconds=health_spec.get("initialDelaySeconds", 0),
+            grace_period_seconds=health_spec.get("gracePeriodSeconds", DEFAULT_GRACE_PERIOD_SECONDS),
+            content_expressions=(health_spec.get("content") or {}).get("expressions") or []
         )
 
-    async def _perform_http_check(self, ip: str, port: int, config: HealthCheckConfig) -> bool:
-        """Perform an HTTP health check against a container."""
+    async def _perform_http_check(self, ip: str, port: int, config: HealthCheckConfig,
+                                  status: Optional[HealthStatus] = None) -> bool:
+        """Perform an HTTP health check against a container. With content expressions, the
+        JSON payload must satisfy them too; status.last_error says which one did not."""
         if not self.session:
             return False
 
@@ -207,18 +461,64 @@ class HealthChecker:
                 timeout=aiohttp.ClientTimeout(total=config.timeout_seconds)
             ) as response:
                 # Consider 2xx and 3xx responses as healthy
-                return 200 <= response.status < 400
+                if not 200 <= response.status < 400:
+                    if status:
+                        status.last_error = f"HTTP {response.status}"
+                    return False
+                if not config.content_expressions:
+                    return True
+                body = await response.content.read(health_content.MAX_BODY_BYTES + 1)
+                error = health_content.check_payload(body, config.content_expressions)
+                if error:
+                    logger.debug(f"Health payload of {ip}:{port} failed: {error}")
+                    if status:
+                        status.last_error = error
+                    return False
+                return True
 
         except asyncio.TimeoutError:
             logger.debug(f"Health check timeout for {ip}:{port}")
+            if status:
+                status.last_error = f"timed out after {config.timeout_seconds}s"
             return False
         except aiohttp.ClientError as e:
             logger.debug(f"Health check connection error for {ip}:{port}: {e}")
+            if status:
+                status.last_error = f"connection error: {e}"
             return False
         except Exception as e:
             logger.warning(f"Unexpected error during health check for {ip}:{port}: {e}")
             return False
 
+    async def _perform_udp_check(self, ip: str, port: int, config: HealthCheckConfig) -> bool:
+        """Probe a container's UDP port. A reply (containing `expect`, if set) passes; a
+        closed port fails; silence passes only when no reply is expected."""
+        loop = asyncio.get_running_loop()
+        reply = loop.create_future()
+        transport = None
+        try:
+            transport, _ = await loop.create_datagram_endpoint(lambda: _UdpProbe(reply), remote_addr=(ip, port))
+            transport.sendto(config.send.encode())
+            try:
+                data = await asyncio.wait_for(reply, timeout=config.timeout_seconds)
+            except asyncio.TimeoutError:
+                # No reply and no ICMP port unreachable: the port is open but silent
+                return config.expect is None
+            return config.expect is None or config.expect.encode() in data
+
+        except ConnectionRefusedError:
+            logger.debug(f"UDP health check for {ip}:{port}: port unreachable")
+            return False
+        except OSError as e:
+            logger.debug(f"UDP health check error for {ip}:{port}: {e}")
+            return False
+        except Exception as e:
+            logger.warning(f"Unexpected error during UDP health check for {ip}:{port}: {e}")
+            return False
+        finally:
+            if transport:
+                transport.close()
+
     def get_all_healthy_containers(self) -> List[str]:
         """Get list of all healthy container IDs."""
         healthy = []
@@ -244,10 +544,12 @@ class HealthChecker:
 
             summary["targets"][container_id] = {
                 "healthy": status.is_healthy,
+                "in_grace_period": self.in_grace_period(container_id),
                 "consecutive_failures": status.consecutive_failures,
                 "consecutive_successes": status.consecutive_successes,
                 "last_success": status.last_success,
-                "response_time_ms": status.response_time_ms
+                "response_time_ms": status.response_time_ms,
+                "last_error": status.last_error or None
             }
 
         return summary
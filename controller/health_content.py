@@ -0,0 +1,181 @@
+"""
+Health check content validation.
+An HTTP health check normally passes on any 2xx/3xx response. With
+`health.content`, the response must also be a JSON document for which every
+one of `health.content.expressions` holds, so a replica whose own check
+reports a degraded dependency, e.g. {"status": "ok", "db": "down"}, is taken
+out of nginx like any other replica failing its checks (it is not restarted):
+
+    health:
+      path: /healthz
+      content:
+        expressions:
+          - status == "ok"
+          - db in ["ok", "degraded"]
+          - queue.depth < 1000
+
+Expressions use a small, safe subset of Python syntax: dotted paths into the
+payload (`checks.db.status`, `checks["my-db"]`, `replicas[0]`), string,
+number, true/false/null and list literals, comparisons (== != < <= > >= in,
+not in), and/or/not. A path the payload does not have is null. Anything else
+is rejected when the app is registered.
+"""
+
+import ast
+import json
+import functools
+from typing import Any, Dict, List, Optional, Tuple
+
+MAX_EXPRESSIONS = 20
+MAX_EXPRESSION_LENGTH = 500
+# Health payloads larger than this fail the check
+MAX_BODY_BYTES = 64 * 1024
+
+_CONSTANT_NAMES = {"true": True, "false": False, "null": None, "True": True, "False": False, "None": None}
+_COMPARISONS = {
+    ast.Eq: lambda a, b: a == b,
+    ast.NotEq: lambda a, b: a != b,
+    ast.Lt: lambda a, b: a < b,
+    ast.LtE: lambda a, b: a <= b,
+    ast.Gt: lambda a, b: a > b,
+    ast.GtE: lambda a, b: a >= b,
+    ast.In: lambda a, b: a in b,
+    ast.NotIn: lambda a, b: a not in b,
+}
+
+def _index(node: ast.AST) -> Any:
+    """The string or integer literal a path is indexed with (negative integers count from
+    the end of a list), or None if it is anything else."""
+    if isinstance(node, ast.UnaryOp) and isinstance(node.op, ast.USub):
+        value = _index(node.operand)
+        return -value if isinstance(value, int) else None
+    if isinstance(node, ast.Constant) and isinstance(node.value, (str, int)) and not isinstance(node.value, bool):
+        return node.value
+    return None
+
+def _check_node(node: ast.AST) -> Optional[str]:
+    """Why node is not allowed in a health expression, or None."""
+    if isinstance(node, ast.BoolOp):
+        return next(filter(None, (_check_node(value) for value in node.values)), None)
+    if isinstance(node, ast.UnaryOp):
+        if not isinstance(node.op, (ast.Not, ast.USub)):
+            return "only 'not' and '-' are allowed as unary operators"
+        return _check_node(node.operand)
+    if isinstance(node, ast.Compare):
+        if not all(type(op) in _COMPARISONS for op in node.ops):
+            return "only ==, !=, <, <=, >, >=, in and not in comparisons are allowed"
+        return next(filter(None, (_check_node(part) for part in [node.left, *node.comparators])), None)
+    if isinstance(node, ast.Constant):
+        if not isinstance(node.value, (str, int, float, bool, type(None))):
+            return "only string, number and boolean literals are allowed"
+        return None
+    if isinstance(node, (ast.List, ast.Tuple)):
+        return next(filter(None, (_check_node(element) for element in node.elts)), None)
+    if isinstance(node, ast.Name):
+        return None
+    if isinstance(node, ast.Attribute):
+        return _check_node(node.value)
+    if isinstance(node, ast.Subscript):
+        if _index(node.slice) is None:
+            return "paths can only be indexed with a string or integer literal"
+        return _check_node(node.value)
+    return f"uses {type(node).__name__}, which is not allowed"
+
+def compile_expression(expression: Any) -> Tuple[Optional[ast.AST], Optional[str]]:
+    """Parse and check one expression. Returns (tree, None) or (None, error)."""
+    if not isinstance(expression, str) or not expression.strip():
+        return None, "must be a non-empty string"
+    if len(expression) > MAX_EXPRESSION_LENGTH:
+        return None, f"must be at most {MAX_EXPRESSION_LENGTH} characters"
+    try:
+        tree = ast.parse(expression.strip(), mode="eval").body
+    except SyntaxError as e:
+        return None, f"is not a valid expression ({e.msg})"
+    error = _check_node(tree)
+    if error:
+        return None, error
+    return tree, None
+
+def validate_health_content(config: Any, health_type: str = "http") -> Tuple[Optional[Dict[str, Any]], Optional[str]]:
+    """Normalize `health.content`. Returns (content to store or None, error)."""
+    if config is None:
+        return None, None
+    if health_type != "http":
+        return None, "health.content only applies to HTTP health checks"
+    if not isinstance(config, dict):
+        return None, "health.content must be an object"
+    unknown = set(config) - {"expressions"}
+    if unknown:
+        return None, f"Unknown health.content field(s): {', '.join(sorted(unknown))}"
+    expressions = config.get("expressions")
+    if not isinstance(expressions, list) or not expressions:
+        return None, "health.content.expressions must be a non-empty list"
+    if len(expressions) > MAX_EXPRESSIONS:
+        return None, f"health.content.expressions can have at most {MAX_EXPRESSIONS} entries"
+    for index, expression in enumerate(expressions):
+        _, error = compile_expression(expression)
+        if error:
+            return None, f"health.content.expressions[{index}] {error}"
+    return {"expressions": [expression.strip() for expression in expressions]}, None
+
+@functools.lru_cache(maxsize=1024)
+def _compiled(expression: str) -> Tuple[Optional[ast.AST], Optional[str]]:
+    return compile_expression(expression)
+
+def _evaluate(node: ast.AST, payload: Any) -> Any:
+    if isinstance(node, ast.BoolOp):
+        values = (_evaluate(value, payload) for value in node.values)
+        return all(values) if isinstance(node.op, ast.And) else any(values)
+    if isinstance(node, ast.UnaryOp):
+        operand = _evaluate(node.operand, payload)
+        return not operand if isinstance(node.op, ast.Not) else -operand
+    if isinstance(node, ast.Compare):
+        left = _evaluate(node.left, payload)
+        for op, comparator in zip(node.ops, node.comparators):
+            right = _evaluate(comparator, payload)
+            try:
+                if not _COMPARISONS[type(op)](left, right):
+                    return False
+            except TypeError:
+                return False  # e.g. null < 5, or a number in a string
+            left = right
+        return True
+    if isinstance(node, ast.Constant):
+        return node.value
+    if isinstance(node, (ast.List, ast.Tuple)):
+        return [_evaluate(element, payload) for element in node.elts]
+    if isinstance(node, ast.Name):
+        if node.id in _CONSTANT_NAMES:
+            return _CONSTANT_NAMES[node.id]
+        return payload.get(node.id) if isinstance(payload, dict) else None
+    if isinstance(node, ast.Attribute):
+        value = _evaluate(node.value, payload)
+        return value.get(node.attr) if isinstance(value, dict) else None
+    if isinstance(node, ast.Subscript):
+        value, key = _evaluate(node.value, payload), _index(node.slice)
+        if isinstance(value, dict):
+            return value.get(key)
+        if isinstance(value, list) and isinstance(key, int) and -len(value) <= key < len(value):
+            return value[key]
+        return None
+    raise ValueError(f"{type(node).__name__} is not allowed")
+
+def check_payload(body: bytes, expressions: List[str]) -> Optional[str]:
+    """Why a health response body fails the expressions, or None if every one holds."""
+    if len(body) > MAX_BODY_BYTES:
+        return f"health payload is larger than {MAX_BODY_BYTES} bytes"
+    try:
+        payload = json.loads(body)
+    except ValueError:
+        return "health payload is not JSON"
+    for expression in expressions:
+        tree, error = _compiled(expression)
+        if error:
+            return f"{expression!r} {error}"
+        try:
+            holds = _evaluate(tree, payload)
+        except TypeError:
+            holds = False  # e.g. -"text"
+        if not holds:
+            return f"{expression} is false"
+    return None
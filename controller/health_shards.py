@@ -0,0 +1,106 @@
+"""
+Health check sharding across controller nodes.
+With ORCHESTRY_HEALTH_SHARDING enabled, every live controller node probes a
+share of the health check targets instead of the leader probing them all.
+Targets are assigned with a consistent hash ring over container IDs, so a node
+joining or leaving only moves the targets next to it on the ring. Nodes save
+their results to the instances table; the leader picks them up from there and
+updates routing, and followers mirror them.
+"""
+
+import os
+import time
+import bisect
+import hashlib
+import logging
+from typing import Any, Dict, List, Optional
+
+logger = logging.getLogger(__name__)
+
+HEALTH_SHARDING_ENABLED = os.getenv("ORCHESTRY_HEALTH_SHARDING", "false").lower() in ("1", "true", "yes")
+# Points per node on the ring; more points spread targets more evenly
+VIRTUAL_NODES = 64
+# Nodes whose last heartbeat is older than this do not get a shard
+SHARD_NODE_TIMEOUT_SECONDS = int(os.getenv("ORCHESTRY_HEALTH_SHARD_NODE_TIMEOUT", "30"))
+# How often membership is re-read from the cluster controller
+MEMBERSHIP_REFRESH_SECONDS = 2
+
+def _hash(key: str) -> int:
+    return int(hashlib.md5(key.encode()).hexdigest()[:16], 16)
+
+class HashRing:
+    """Consistent hash ring mapping keys to node IDs."""
+
+    def __init__(self, nodes: Optional[List[str]] = None, virtual_nodes: int = VIRTUAL_NODES):
+        self.virtual_nodes = virtual_nodes
+        self.nodes: List[str] = []
+        self._points: List[int] = []
+        self._owners: List[str] = []
+        self.set_nodes(nodes or [])
+
+    def set_nodes(self, nodes: List[str]) -> bool:
+        """Rebuild the ring for a set of nodes. Returns True if the set changed."""
+        nodes = sorted(set(nodes))
+        if nodes == self.nodes:
+            return False
+        ring = sorted((_hash(f"{node}#{i}"), node) for node in nodes for i in range(self.virtual_nodes))
+        self.nodes = nodes
+        self._points = [point for point, _ in ring]
+        self._owners = [node for _, node in ring]
+        return True
+
+    def owner(self, key: str) -> Optional[str]:
+        if not self._points:
+            return None
+        index = bisect.bisect(self._points, _hash(key)) % len(self._points)
+        return self._owners[index]
+
+class HealthShards:
+    """Decides which health check targets this controller node probes."""
+
+    def __init__(self, cluster_controller: Any):
+        self.cluster = cluster_controller
+        self.ring = HashRing([cluster_controller.node_id])
+        self._last_refresh = 0.0
+
+    def _live_nodes(self) -> List[str]:
+        now = time.time()
+        nodes = [
+            node.node_id for node in list(self.cluster.cluster_nodes.values())
+            if node.state.value != "stopped" and node.is_healthy
+            and now - node.last_heartbeat <= SHARD_NODE_TIMEOUT_SECONDS
+        ]
+        # This node keeps a shard even before it shows up in the membership table
+        return nodes + [self.cluster.node_id]
+
+    def refresh(self, force: bool = False):
+        now = time.time()
+        if not force and now - self._last_refresh < MEMBERSHIP_REFRESH_SECONDS:
+            return
+        self._last_refresh = now
+        if self.ring.set_nodes(self._live_nodes()):
+            logger.info(f"Health check shards rebalanced across {len(self.ring.nodes)} node(s): {', '.join(self.ring.nodes)}")
+
+    def owner(self, container_id: str) -> Optional[str]:
+        self.refresh()
+        return self.ring.owner(container_id)
+
+    def owns(self, container_id: str) -> bool:
+        """Whether this node probes the container."""
+        return self.owner(container_id) == self.cluster.node_id
+
+    def describe(self, container_ids: List[str]) -> Dict[str, Any]:
+        """Shard membership and how many of the given targets each node probes."""
+        self.refresh(force=True)
+        targets = {node: 0 for node in self.ring.nodes}
+        for container_id in container_ids:
+            owner = self.ring.owner(container_id)
+            if owner:
+                targets[owner] = targets.get(owner, 0) + 1
+        return {
+            "enabled": True,
+            "node_id": self.cluster.node_id,
+            "nodes": self.ring.nodes,
+            "targets_per_node": targets,
+            "total_targets": len(container_ids)
+        }
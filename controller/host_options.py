@@ -0,0 +1,191 @@
+"""
+Docker HostConfig options for app containers.
+Apps can set custom DNS servers (`dns`), /etc/hosts entries (`extraHosts`),
+namespaced kernel parameters (`sysctls`), resource limits (`ulimits`), the
+size of /dev/shm (`shmSize`), size-limited tmpfs scratch mounts (`tmpfs`) and a
+cap on the container's writable layer (`storageSize`, Docker's storage-opt size)
+in their spec. Values are validated at registration and stored normalized, then
+applied whenever a container is created.
+"""
+
+import re
+import ipaddress
+from typing import Any, Dict, List, Optional, Tuple
+
+import docker
+
+HOSTNAME_PATTERN = re.compile(r"^(?=.{1,253}$)[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
+# Only sysctls that are namespaced per container can be set (see `docker run --sysctl`)
+NAMESPACED_SYSCTL_PREFIXES = ("net.", "kernel.msg", "kernel.shm", "fs.mqueue.")
+NAMESPACED_SYSCTLS = ("kernel.sem",)
+ULIMIT_NAMES = (
+    "core", "cpu", "data", "fsize", "locks", "memlock", "msgqueue", "nice",
+    "nofile", "nproc", "rss", "rtprio", "rttime", "sigpending", "stack"
+)
+TMPFS_MODE_PATTERN = re.compile(r"^[0-7]{3,4}$")
+SIZE_UNITS = {"": 1, "k": 1024, "ki": 1024, "m": 1024 ** 2, "mi": 1024 ** 2, "g": 1024 ** 3, "gi": 1024 ** 3}
+
+def _parse_size(value: Any) -> Optional[int]:
+    match = re.match(r"^\s*(\d+)\s*([a-zA-Z]{0,2})\s*$", str(value))
+    if not match or match.group(2).lower() not in SIZE_UNITS:
+        return None
+    return int(match.group(1)) * SIZE_UNITS[match.group(2).lower()]
+
+def _validate_dns(servers: Any) -> Tuple[List[str], Optional[str]]:
+    if not isinstance(servers, list):
+        return [], "dns must be a list of IP addresses"
+    normalized = []
+    for server in servers:
+        try:
+            normalized.append(str(ipaddress.ip_address(str(server).strip())))
+        except ValueError:
+            return [], f"dns: '{server}' is not a valid IP address"
+    return normalized, None
+
+def _validate_extra_hosts(entries: Any) -> Tuple[Dict[str, str], Optional[str]]:
+    # Accept a {host: ip} mapping or a list of "host:ip" strings (as in docker compose)
+    if isinstance(entries, dict):
+        pairs = list(entries.items())
+    elif isinstance(entries, list):
+        pairs = []
+        for entry in entries:
+            if not isinstance(entry, str) or ":" not in entry:
+                return {}, f"extraHosts: '{entry}' must look like hostname:ip"
+            host, ip = entry.split(":", 1)
+            pairs.append((host, ip))
+    else:
+        return {}, "extraHosts must be a list of hostname:ip entries or a hostname -> ip mapping"
+
+    normalized = {}
+    for host, ip in pairs:
+        host, ip = str(host).strip(), str(ip).strip()
+        if not HOSTNAME_PATTERN.match(host):
+            return {}, f"extraHosts: '{host}' is not a valid hostname"
+        if ip != "host-gateway":
+            try:
+                ip = str(ipaddress.ip_address(ip))
+            except ValueError:
+                return {}, f"extraHosts: '{ip}' for {host} is not a valid IP address (or host-gateway)"
+        normalized[host] = ip
+    return normalized, None
+
+def _validate_sysctls(sysctls: Any) -> Tuple[Dict[str, str], Optional[str]]:
+    if not isinstance(sysctls, dict):
+        return {}, "sysctls must be a mapping of name -> value"
+    normalized = {}
+    for name, value in sysctls.items():
+        name = str(name).strip()
+        if not (name.startswith(NAMESPACED_SYSCTL_PREFIXES) or name in NAMESPACED_SYSCTLS):
+            return {}, (f"sysctls: '{name}' cannot be set per container "
+                        f"(allowed: net.*, kernel.msg*, kernel.sem, kernel.shm*, fs.mqueue.*)")
+        if value is None or isinstance(value, (dict, list)):
+            return {}, f"sysctls: value for '{name}' must be a string or number"
+        normalized[name] = str(value)
+    return normalized, None
+
+def _validate_ulimits(ulimits: Any) -> Tuple[Dict[str, Dict[str, int]], Optional[str]]:
+    # {name: n} sets soft and hard to n; {name: {soft, hard}} sets them separately
+    if not isinstance(ulimits, dict):
+        return {}, "ulimits must be a mapping of name -> limit or {soft, hard}"
+    normalized = {}
+    for name, limit in ulimits.items():
+        if name not in ULIMIT_NAMES:
+            return {}, f"ulimits: unknown limit '{name}' (use one of {', '.join(ULIMIT_NAMES)})"
+        if isinstance(limit, dict):
+            soft, hard = limit.get("soft"), limit.get("hard", limit.get("soft"))
+        else:
+            soft = hard = limit
+        try:
+            soft, hard = int(soft), int(hard)
+        except (TypeError, ValueError):
+            return {}, f"ulimits: '{name}' needs integer soft/hard values"
+        if soft < -1 or hard < -1 or (hard != -1 and (soft == -1 or soft > hard)):
+            return {}, f"ulimits: '{name}' soft limit must not exceed the hard limit (-1 means unlimited)"
+        normalized[name] = {"soft": soft, "hard": hard}
+    return normalized, None
+
+def _validate_tmpfs(mounts: Any) -> Tuple[Dict[str, Dict[str, Any]], Optional[str]]:
+    # [{path, size, mode}] -> {path: {size (bytes), mode}}; the stored mapping form is accepted too
+    if isinstance(mounts, dict):
+        mounts = [{"path": path, **(m if isinstance(m, dict) else {"size": m})} for path, m in mounts.items()]
+    if not isinstance(mounts, list):
+        return {}, "tmpfs must be a list of {path, size} mounts"
+    normalized = {}
+    for mount in mounts:
+        if not isinstance(mount, dict) or not mount.get("path"):
+            return {}, "tmpfs: every mount needs a path"
+        path = str(mount["path"]).strip().rstrip("/")
+        if not path.startswith("/") or path in ("", "/proc", "/sys", "/dev"):
+            return {}, f"tmpfs: '{mount['path']}' must be an absolute path other than /, /proc, /sys or /dev"
+        if path in normalized:
+            return {}, f"tmpfs: '{path}' is mounted twice"
+        size = _parse_size(mount.get("size", ""))
+        if not size:
+            return {}, f"tmpfs: {path} needs a size such as 64Mi (tmpfs counts against the container's memory)"
+        entry: Dict[str, Any] = {"size": size}
+        if mount.get("mode") is not None:
+            mode = str(mount["mode"]).strip()
+            if not TMPFS_MODE_PATTERN.match(mode):
+                return {}, f"tmpfs: mode for {path} must be octal, e.g. 1777"
+            entry["mode"] = mode
+        normalized[path] = entry
+    return normalized, None
+
+def validate_host_options(spec: Dict[str, Any]) -> Tuple[Dict[str, Any], Optional[str]]:
+    """Validate the HostConfig fields of an app spec. Returns (normalized fields, error)."""
+    options: Dict[str, Any] = {}
+    if spec.get("dns"):
+        options["dns"], error = _validate_dns(spec["dns"])
+        if error:
+            return {}, error
+    if spec.get("extraHosts"):
+        options["extraHosts"], error = _validate_extra_hosts(spec["extraHosts"])
+        if error:
+            return {}, error
+    if spec.get("sysctls"):
+        options["sysctls"], error = _validate_sysctls(spec["sysctls"])
+        if error:
+            return {}, error
+    if spec.get("ulimits"):
+        options["ulimits"], error = _validate_ulimits(spec["ulimits"])
+        if error:
+            return {}, error
+    if spec.get("shmSize"):
+        size = _parse_size(spec["shmSize"])
+        if not size:
+            return {}, f"shmSize '{spec['shmSize']}' must be a size such as 64Mi or 1Gi"
+        options["shmSize"] = size
+    if spec.get("tmpfs"):
+        options["tmpfs"], error = _validate_tmpfs(spec["tmpfs"])
+        if error:
+            return {}, error
+    if spec.get("storageSize"):
+        size = _parse_size(spec["storageSize"])
+        if not size:
+            return {}, f"storageSize '{spec['storageSize']}' must be a size such as 2Gi"
+        options["storageSize"] = size
+    return options, None
+
+def apply(container_config: Dict[str, Any], spec: Dict[str, Any]):
+    """Add an app's (already normalized) HostConfig options to a containers.create() call."""
+    if spec.get("dns"):
+        container_config["dns"] = list(spec["dns"])
+    if spec.get("extraHosts"):
+        container_config["extra_hosts"] = dict(spec["extraHosts"])
+    if spec.get("sysctls"):
+        container_config["sysctls"] = dict(spec["sysctls"])
+    if spec.get("ulimits"):
+        container_config["ulimits"] = [
+            docker.types.Ulimit(name=name, soft=limit["soft"], hard=limit["hard"])
+            for name, limit in spec["ulimits"].items()
+        ]
+    if spec.get("shmSize"):
+        container_config["shm_size"] = int(spec["shmSize"])
+    if spec.get("tmpfs"):
+        container_config["tmpfs"] = {
+            path: ",".join([f"size={mount['size']}"] + ([f"mode={mount['mode']}"] if mount.get("mode") else []))
+            for path, mount in spec["tmpfs"].items()
+        }
+    if spec.get("storageSize"):
+        # Needs a storage driver with quota support (overlay2 on xfs with pquota, btrfs, zfs)
+        container_config["storage_opt"] = {"size": str(int(spec["storageSize"]))}
@@ -0,0 +1,266 @@
+"""
+Garbage collection of unused images on controller nodes.
+Rolling updates leave the previous images behind on every node's Docker host.
+The leader requests a collection every ORCHESTRY_IMAGE_GC_INTERVAL_SECONDS
+(when ORCHESTRY_IMAGE_GC is on) or when an admin asks for one, and every node
+then removes, from its own host, images of the repositories Orchestry apps
+use that are no longer needed. An image is kept if it belongs to one of the
+last ORCHESTRY_IMAGE_GC_KEEP_REVISIONS revisions of any app, is used by a
+container, is younger than ORCHESTRY_IMAGE_GC_MIN_AGE_HOURS, or carries the
+orchestry.gc=keep label. Images of other repositories (nginx, postgres, the
+controller itself) are never touched. Each node records a report of what it
+removed, or would remove on a dry run.
+"""
+
+import os
+import time
+import uuid
+import calendar
+import logging
+import threading
+from typing import Any, Dict, List, Optional, Set
+
+from docker.utils import parse_repository_tag
+
+logger = logging.getLogger(__name__)
+
+IMAGE_GC_ENABLED = os.getenv("ORCHESTRY_IMAGE_GC", "false").lower() in ("1", "true", "yes")
+IMAGE_GC_INTERVAL_SECONDS = int(os.getenv("ORCHESTRY_IMAGE_GC_INTERVAL_SECONDS", "21600"))
+IMAGE_GC_KEEP_REVISIONS = max(1, int(os.getenv("ORCHESTRY_IMAGE_GC_KEEP_REVISIONS", "3")))
+IMAGE_GC_MIN_AGE_HOURS = float(os.getenv("ORCHESTRY_IMAGE_GC_MIN_AGE_HOURS", "24"))
+# How often each node looks for a new collection request
+IMAGE_GC_POLL_SECONDS = 30
+
+# Images built with LABEL orchestry.gc=keep are never collected
+KEEP_LABEL = "orchestry.gc"
+KEEP_LABEL_VALUE = "keep"
+
+REQUEST_SETTING_KEY = "image_gc_request"
+SYSTEM_EVENT_SCOPE = "orchestry"
+
+def repository(reference: str) -> str:
+    """The repository of an image reference, as Docker Hub spells it without defaults:
+    docker.io/library/nginx:alpine -> nginx."""
+    repo, _ = parse_repository_tag(reference)
+    for prefix in ("docker.io/", "index.docker.io/", "registry-1.docker.io/"):
+        if repo.startswith(prefix):
+            repo = repo[len(prefix):]
+            if repo.startswith("library/"):
+                repo = repo[len("library/"):]
+            break
+    return repo
+
+def canonical(reference: str) -> str:
+    """repository:tag or repository@digest, with :latest if neither is given."""
+    _, tag = parse_repository_tag(reference)
+    tag = tag or "latest"
+    return f"{repository(reference)}{'@' if tag.startswith('sha256:') else ':'}{tag}"
+
+def _timestamp(value: Any) -> Optional[float]:
+    """Epoch seconds of a Docker timestamp such as 2024-01-15T10:31:00.123456789Z."""
+    if not isinstance(value, str) or not value or value.startswith("0001-"):
+        return None
+    try:
+        base, _, fraction = value.rstrip("Z").partition(".")
+        fraction = fraction.split("+")[0].split("-")[0]
+        parsed = calendar.timegm(time.strptime(base[:19], "%Y-%m-%dT%H:%M:%S"))
+        return parsed + (float(f"0.{fraction[:6]}") if fraction.isdigit() else 0.0)
+    except ValueError:
+        return None
+
+def policy() -> Dict[str, Any]:
+    """The configured collection policy, as reported by GET /images/gc."""
+    return {
+        "enabled": IMAGE_GC_ENABLED,
+        "interval_seconds": IMAGE_GC_INTERVAL_SECONDS,
+        "keep_revisions": IMAGE_GC_KEEP_REVISIONS,
+        "min_age_hours": IMAGE_GC_MIN_AGE_HOURS,
+        "keep_label": f"{KEEP_LABEL}={KEEP_LABEL_VALUE}"
+    }
+
+def retained_images(state_store: Any, keep_revisions: int = IMAGE_GC_KEEP_REVISIONS):
+    """(references to keep, repositories Orchestry manages) from the recorded revisions."""
+    keep: Set[str] = set()
+    managed: Set[str] = set()
+    seen: Dict[str, int] = {}
+    for row in state_store.list_app_revision_images():
+        managed.add(repository(row["image"]))
+        seen[row["app"]] = seen.get(row["app"], 0) + 1
+        if seen[row["app"]] <= keep_revisions:
+            keep.add(canonical(row["image"]))
+    # Apps keep their current image even if their revisions were lost
+    for app in state_store.list_apps():
+        record = state_store.get_app(app["name"])
+        image = (record.spec or {}).get("image") if record else None
+        if image:
+            keep.add(canonical(image))
+            managed.add(repository(image))
+    return keep, managed
+
+class ImageGarbageCollector:
+    """Removes unused app images from this node's Docker host when a collection is requested."""
+
+    def __init__(self, state_store: Any, docker_client: Any, cluster_controller: Any, freeze_state: Any = None):
+        self.state_store = state_store
+        self.docker_client = docker_client
+        self.cluster = cluster_controller
+        self.freeze = freeze_state
+        self._active = False
+        self._thread: Optional[threading.Thread] = None
+        self._lock = threading.Lock()
+
+    @property
+    def node_id(self) -> str:
+        return self.cluster.node_id
+
+    def request(self, dry_run: bool = False, requested_by: Optional[str] = None,
+                reason: str = "manual") -> Dict[str, Any]:
+        """Ask every node to collect images. Only the leader calls this."""
+        request = {
+            "id": uuid.uuid4().hex[:12],
+            "dry_run": dry_run,
+            "reason": reason,
+            "requested_by": requested_by,
+            "requested_at": time.time()
+        }
+        if not self.state_store.save_setting(REQUEST_SETTING_KEY, request):
+            return {"error": "Failed to record the image GC request"}
+        self.state_store.log_event(SYSTEM_EVENT_SCOPE, "image_gc_requested", request)
+        logger.info(f"Requested image GC on all nodes ({reason}{', dry run' if dry_run else ''})")
+        return request
+
+    def start(self):
+        if self._active:
+            return
+        self._active = True
+        self._thread = threading.Thread(target=self._loop, daemon=True)
+        self._thread.start()
+        logger.info(f"Image garbage collector started on node {self.node_id}")
+
+    def stop(self):
+        self._active = False
+
+    def _loop(self):
+        while self._active:
+            try:
+                self._schedule()
+                self.run_once()
+            except Exception as e:
+                logger.error(f"Error in image GC loop: {e}")
+            time.sleep(IMAGE_GC_POLL_SECONDS)
+
+    def _schedule(self):
+        """On the leader, request a scheduled collection once the interval has passed."""
+        if not IMAGE_GC_ENABLED or not self.cluster.is_leader:
+            return
+        if self.freeze and self.freeze.is_frozen():
+            return
+        last = self.state_store.get_setting(REQUEST_SETTING_KEY) or {}
+        if time.time() - last.get("requested_at", 0) >= IMAGE_GC_INTERVAL_SECONDS:
+            self.request(reason="scheduled")
+
+    def run_once(self) -> Optional[Dict[str, Any]]:
+        """Carry out the latest request if this node has not yet. Returns the report."""
+        request = self.state_store.get_setting(REQUEST_SETTING_KEY)
+        if not request:
+            return None
+        done = {row["node_id"]: row for row in self.state_store.list_image_gc_reports()}.get(self.node_id)
+        if done and done["request_id"] == request["id"]:
+            return None
+        report = self.collect(dry_run=request.get("dry_run", False))
+        report["request"] = request
+        self.state_store.save_image_gc_report(self.node_id, request["id"], report)
+        return report
+
+    def collect(self, dry_run: bool = False, keep_revisions: int = IMAGE_GC_KEEP_REVISIONS,
+                min_age_hours: float = IMAGE_GC_MIN_AGE_HOURS) -> Dict[str, Any]:
+        """Remove (or with dry_run, list) this host's unneeded app images."""
+        with self._lock:
+            started = time.time()
+            keep, managed = retained_images(self.state_store, keep_revisions)
+            used = set()
+            for container in self.docker_client.containers.list(all=True):
+                attrs = getattr(container, "attrs", {}) or {}
+                for ref in (attrs.get("Image"), (attrs.get("Config") or {}).get("Image")):
+                    if ref:
+                        used.add(ref)
+                        used.add(canonical(ref) if not ref.startswith("sha256:") else ref)
+
+            removed: List[Dict[str, Any]] = []
+            kept: List[Dict[str, Any]] = []
+            errors: List[Dict[str, Any]] = []
+            for image in self.docker_client.images.list():
+                attrs = image.attrs or {}
+                references = list(attrs.get("RepoTags") or []) + list(attrs.get("RepoDigests") or [])
+                references = [ref for ref in references if ref and not ref.startswith("<none>")]
+                if not references or not {repository(ref) for ref in references} & managed:
+                    continue
+                names = sorted({canonical(ref) for ref in references})
+                entry = {"id": image.id, "references": names, "size": attrs.get("Size", 0)}
+                created = _timestamp((attrs.get("Metadata") or {}).get("LastTagTime")) or _timestamp(attrs.get("Created"))
+                labels = (attrs.get("Config") or {}).get("Labels") or {}
+
+                if set(names) & keep:
+                    kept.append({**entry, "reason": f"in the last {keep_revisions} revisions of an app"})
+                elif image.id in used or set(names) & used:
+                    kept.append({**entry, "reason": "used by a container"})
+                elif labels.get(KEEP_LABEL) == KEEP_LABEL_VALUE:
+                    kept.append({**entry, "reason": f"labelled {KEEP_LABEL}={KEEP_LABEL_VALUE}"})
+                elif created is None:
+                    kept.append({**entry, "reason": "age unknown"})
+                elif started - created < min_age_hours * 3600:
+                    kept.append({**entry, "reason": f"younger than {min_age_hours:g}h"})
+                elif dry_run:
+                    removed.append(entry)
+                else:
+                    error = self._remove(image, attrs)
+                    if error:
+                        errors.append({**entry, "error": error})
+                    else:
+                        removed.append(entry)
+
+            report = {
+                "node_id": self.node_id,
+                "dry_run": dry_run,
+                "started_at": started,
+                "finished_at": time.time(),
+                "removed": removed,
+                "kept": kept,
+                "errors": errors,
+                "reclaimed_bytes": sum(entry["size"] or 0 for entry in removed)
+            }
+            if removed and not dry_run:
+                logger.info(f"Image GC on node {self.node_id} removed {len(removed)} image(s), "
+                            f"{report['reclaimed_bytes'] / 1024 ** 2:.0f} MiB")
+            return report
+
+    def _remove(self, image: Any, attrs: Dict[str, Any]) -> Optional[str]:
+        """Remove an image by each of its tags, then by ID if it is still there. Returns an
+        error message on failure; Docker refuses images that a stopped container still uses."""
+        tags = list(attrs.get("RepoTags") or [])
+        try:
+            for tag in tags:
+                self.docker_client.images.remove(tag, noprune=False)
+            if not tags:
+                self.docker_client.images.remove(image.id, noprune=False)
+            return None
+        except Exception as e:
+            logger.warning(f"Image GC could not remove {image.id[:19]} on node {self.node_id}: {e}")
+            return str(e)[:500]
+
+    def status(self) -> Dict[str, Any]:
+        """The policy, the latest request and each node's report of it."""
+        request = self.state_store.get_setting(REQUEST_SETTING_KEY)
+        reports = self.state_store.list_image_gc_reports()
+        node_ids = {node.node_id for node in list(self.cluster.cluster_nodes.values())
+                    if node.state.value != "stopped"}
+        node_ids.add(self.node_id)
+
+        nodes = {}
+        for row in reports:
+            nodes[row["node_id"]] = {**row["report"], "current": bool(request and row["request_id"] == request["id"])}
+        for node_id in node_ids - set(nodes):
+            nodes[node_id] = {"node_id": node_id, "current": False}
+        pending = sorted(node_id for node_id in node_ids if not nodes[node_id]["current"]) if request else []
+        return {"policy": policy(), "request": request, "pending_nodes": pending,
+                "nodes": [nodes[node_id] for node_id in sorted(nodes)]}
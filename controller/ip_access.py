@@ -0,0 +1,55 @@
+"""
+Per-app IP allow/deny lists enforced by nginx.
+Rules are CIDR lists from the app spec (`allowFrom` / `denyFrom`). Addresses the
+controller itself probes from are always allowed and may not be denied, so a
+rule change cannot lock the controller out of the app.
+"""
+
+import os
+import ipaddress
+from typing import Any, Dict, List, Optional, Tuple
+
+def probe_networks() -> List[str]:
+    """Networks the controller reaches apps through nginx from."""
+    raw = os.getenv("ORCHESTRY_PROBE_CIDRS", "127.0.0.1/32")
+    return [str(ipaddress.ip_network(c.strip(), strict=False)) for c in raw.split(",") if c.strip()]
+
+def _normalize(cidrs: Optional[List[Any]], field: str) -> Tuple[List[str], Optional[str]]:
+    normalized = []
+    for cidr in cidrs or []:
+        try:
+            network = str(ipaddress.ip_network(str(cidr).strip(), strict=False))
+        except ValueError:
+            return [], f"{field}: '{cidr}' is not a valid IP address or CIDR"
+        if network not in normalized:
+            normalized.append(network)
+    return normalized, None
+
+def validate_access_rules(allow_from: Optional[List[Any]],
+                          deny_from: Optional[List[Any]]) -> Tuple[Dict[str, List[str]], Optional[str]]:
+    """Normalize allow/deny CIDR lists. Returns (rules, error)."""
+    allow, error = _normalize(allow_from, "allowFrom")
+    if error:
+        return {}, error
+    deny, error = _normalize(deny_from, "denyFrom")
+    if error:
+        return {}, error
+
+    for probe in probe_networks():
+        probe_net = ipaddress.ip_network(probe)
+        for cidr in deny:
+            denied = ipaddress.ip_network(cidr)
+            if denied.version == probe_net.version and probe_net.overlaps(denied):
+                return {}, (
+                    f"denyFrom entry {cidr} would block the controller probe address {probe}"
+                )
+
+    return {"allowFrom": allow, "denyFrom": deny}, None
+
+def render_context(spec: Dict[str, Any]) -> Optional[Dict[str, List[str]]]:
+    """Template context for an app's rules, or None when the app has none."""
+    allow = spec.get("allowFrom") or []
+    deny = spec.get("denyFrom") or []
+    if not allow and not deny:
+        return None
+    return {"probe": probe_networks(), "allow": allow, "deny": deny}
@@ -0,0 +1,62 @@
+"""
+Latency-weighted routing.
+With `latencyWeighting.enabled`, the controller periodically reads each
+replica's upstream response times from the app's nginx access log and turns
+them into nginx upstream weights: the fastest replica gets MAX_WEIGHT and
+slower ones proportionally less, down to 1. This moves traffic away from
+replicas on busy or noisy hosts. Replicas without enough samples keep the
+full weight, and nginx is only reloaded when a weight moves noticeably.
+"""
+
+import logging
+from typing import Any, Dict, List, Optional, Tuple
+
+logger = logging.getLogger(__name__)
+
+MAX_WEIGHT = 10
+DEFAULT_INTERVAL_SECONDS = 30
+# Replicas with fewer samples than this in an interval keep their current weight
+MIN_SAMPLES = 20
+# A weight change smaller than this is not worth an nginx reload
+MIN_WEIGHT_CHANGE = 2
+
+def validate_latency_weighting(config: Any, app_spec: Dict[str, Any]) -> Tuple[Optional[Dict[str, Any]], Optional[str]]:
+    """Normalize `latencyWeighting`. Returns (config to store or None, error)."""
+    if config is None:
+        return None, None
+    if isinstance(config, bool):
+        config = {"enabled": config}
+    if not isinstance(config, dict):
+        return None, "latencyWeighting must be true/false or an object with enabled and intervalSeconds"
+    if not config.get("enabled", True):
+        return None, None
+    if app_spec.get("type") != "http":
+        return None, "latencyWeighting is only supported for http apps"
+    interval = config.get("intervalSeconds", DEFAULT_INTERVAL_SECONDS)
+    if not isinstance(interval, int) or isinstance(interval, bool) or not 10 <= interval <= 3600:
+        return None, "latencyWeighting.intervalSeconds must be between 10 and 3600"
+    return {"enabled": True, "intervalSeconds": interval}, None
+
+def weighting_config(app_spec: Dict[str, Any]) -> Optional[Dict[str, Any]]:
+    return app_spec.get("latencyWeighting")
+
+def compute_weights(latencies: Dict[str, Dict[str, float]], upstreams: List[str],
+                    current: Dict[str, int]) -> Dict[str, int]:
+    """Weights for the given upstreams (ip:port) from their mean response times.
+    Upstreams without enough samples keep their current weight (MAX_WEIGHT if new)."""
+    measured = {
+        upstream: stats["mean_ms"] for upstream, stats in latencies.items()
+        if upstream in upstreams and stats["requests"] >= MIN_SAMPLES
+    }
+    weights = {upstream: current.get(upstream, MAX_WEIGHT) for upstream in upstreams}
+    if len(measured) < 2:
+        # Nothing to compare against; weighting a lone replica changes nothing
+        return {upstream: MAX_WEIGHT for upstream in upstreams}
+    fastest = max(min(measured.values()), 1.0)
+    for upstream, mean_ms in measured.items():
+        weights[upstream] = max(1, min(MAX_WEIGHT, round(MAX_WEIGHT * fastest / max(mean_ms, 1.0))))
+    return weights
+
+def significant_change(old: Dict[str, int], new: Dict[str, int]) -> bool:
+    """Whether new weights are worth reloading nginx for."""
+    return any(abs(old.get(upstream, MAX_WEIGHT) - weight) >= MIN_WEIGHT_CHANGE for upstream, weight in new.items())
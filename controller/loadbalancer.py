@@ -0,0 +1,225 @@
+"""
+Load balancers.
+LoadBalancer is what the controller needs from the proxy in front of the apps;
+DockerNginxManager implements it with nginx config files and a container.
+FakeLoadBalancer keeps each app's upstreams in memory, so routing decisions
+can be asserted in unit tests:
+
+    lb = FakeLoadBalancer()
+    manager = AppManager(state_store, lb, runtime=FakeRuntime())
+    ...
+    assert lb.servers("web") == ["172.30.0.3:8080", "172.30.0.4:8080"]
+"""
+
+import time
+from typing import Any, Dict, List, Optional, Protocol, Tuple
+
+class LoadBalancer(Protocol):
+    """The proxy operations the controller uses. update_* and remove_app_config return
+    False when the config could not be applied; the getters return None or an
+    {"error": ...} dict when the data is unavailable, like DockerNginxManager."""
+
+    nginx_container_name: str
+
+    def update_upstreams(self, app_name: str, servers: List[Dict[str, str]], tracing: bool = False,
+                         auth: Optional[Dict] = None, access: Optional[Dict] = None,
+                         shadow: Optional[Dict] = None, error_pages: Optional[Dict] = None,
+                         tls: Optional[Dict] = None, access_log: Optional[Dict] = None,
+                         passive: Optional[Dict] = None, headers: Optional[Dict] = None) -> bool: ...
+
+    def update_stream_upstreams(self, app_name: str, servers: List[Dict[str, str]], stream: Dict,
+                                access: Optional[Dict] = None, passive: Optional[Dict] = None) -> bool: ...
+
+    def remove_app_config(self, app_name: str) -> bool: ...
+
+    def write_auth_file(self, app_name: str, htpasswd: str) -> str: ...
+
+    def remove_auth_file(self, app_name: str): ...
+
+    def write_tls_files(self, app_name: str, certificate: str, key: str) -> Tuple[str, str]: ...
+
+    def remove_tls_files(self, app_name: str): ...
+
+    def write_error_pages(self, app_name: str, pages: Dict[str, str]) -> str: ...
+
+    def remove_error_pages(self, app_name: str): ...
+
+    def list_app_configs(self) -> List[str]: ...
+
+    def configured_upstreams(self) -> Dict[str, List[str]]: ...
+
+    def get_nginx_status(self) -> Dict: ...
+
+    def test_config(self) -> bool: ...
+
+    def get_access_logs(self, app_name: str, lines: int = 100, request_id: Optional[str] = None) -> Dict: ...
+
+    def get_upstream_errors(self, app_name: str, seconds: int, lines: int = 5000) -> Optional[Dict]: ...
+
+    def get_upstream_latencies(self, app_name: str, seconds: int, lines: int = 5000) -> Optional[Dict]: ...
+
+    def get_response_stats(self, app_name: str, seconds: int, shadow: bool = False,
+                           lines: int = 5000) -> Optional[Dict]: ...
+
+    def get_container_logs(self, lines: int = 100) -> str: ...
+
+    def pause(self): ...
+
+    def unpause(self): ...
+
+    def restart_nginx(self) -> bool: ...
+
+class FakeLoadBalancer:
+    """An in-memory LoadBalancer. Tests feed it traffic with record_request() and
+    read back what the controller configured with servers() and configs."""
+
+    def __init__(self):
+        self.nginx_container_name = "fake-nginx"
+        self.configs: Dict[str, Dict[str, Any]] = {}  # app_name -> last applied config
+        self.auth_files: Dict[str, str] = {}
+        self.error_pages: Dict[str, Dict[str, str]] = {}  # app_name -> file name -> HTML
+        self.tls_files: Dict[str, Tuple[str, str]] = {}  # app_name -> (certificate, key)
+        self.access_log: Dict[str, List[Dict[str, Any]]] = {}
+        self.shadow_log: Dict[str, List[Dict[str, Any]]] = {}  # requests mirrored to shadow replicas
+        self.updates: List[str] = []  # app names, in the order their configs were applied
+        self.paused = False
+        self.fail_updates = False  # make every update fail, like a config that does not pass nginx -t
+        self.requests = 0
+        self.active_connections = 0
+
+    def servers(self, app_name: str) -> List[str]:
+        """The "ip:port" upstreams currently configured for an app."""
+        config = self.configs.get(app_name)
+        return sorted(f"{s['ip']}:{s['port']}" for s in config["servers"]) if config else []
+
+    def record_request(self, app_name: str, upstream: str, status: int = 200, response_time: float = 0.01,
+                       request_id: Optional[str] = None, shadow: bool = False):
+        """Add an access log entry, as nginx would for a proxied request (or, with shadow,
+        for a copy of one mirrored to a shadow replica)."""
+        if not shadow:
+            self.requests += 1
+        (self.shadow_log if shadow else self.access_log).setdefault(app_name, []).append({
+            "time": time.time(), "status": status, "upstream": upstream,
+            "upstream_status": str(status), "upstream_response_time": f"{response_time:.3f}",
+            "request_id": request_id
+        })
+
+    def _apply(self, app_name: str, config: Dict[str, Any]) -> bool:
+        if self.fail_updates:
+            return False
+        if not config["servers"] and not config.get("error_pages"):
+            self.remove_app_config(app_name)
+            return False
+        self.configs[app_name] = config
+        self.updates.append(app_name)
+        return True
+
+    def update_upstreams(self, app_name: str, servers: List[Dict[str, str]], tracing: bool = False,
+                         auth: Optional[Dict] = None, access: Optional[Dict] = None,
+                         shadow: Optional[Dict] = None, error_pages: Optional[Dict] = None,
+                         tls: Optional[Dict] = None, access_log: Optional[Dict] = None,
+                         passive: Optional[Dict] = None, headers: Optional[Dict] = None) -> bool:
+        return self._apply(app_name, {"type": "http", "servers": list(servers), "tracing": tracing,
+                                      "auth": auth, "access": access, "shadow": shadow,
+                                      "error_pages": error_pages, "tls": tls, "access_log": access_log,
+                                      "passive": passive, "headers": headers})
+
+    def update_stream_upstreams(self, app_name: str, servers: List[Dict[str, str]], stream: Dict,
+                                access: Optional[Dict] = None, passive: Optional[Dict] = None) -> bool:
+        return self._apply(app_name, {"type": "stream", "servers": list(servers), "stream": stream,
+                                      "access": access, "passive": passive})
+
+    def remove_app_config(self, app_name: str) -> bool:
+        self.configs.pop(app_name, None)
+        return True
+
+    def write_auth_file(self, app_name: str, htpasswd: str) -> str:
+        self.auth_files[app_name] = htpasswd
+        return f"/etc/nginx/conf.d/{app_name}.htpasswd"
+
+    def remove_auth_file(self, app_name: str):
+        self.auth_files.pop(app_name, None)
+
+    def write_tls_files(self, app_name: str, certificate: str, key: str) -> Tuple[str, str]:
+        self.tls_files[app_name] = (certificate, key)
+        return f"/etc/nginx/conf.d/tls/{app_name}.crt", f"/etc/nginx/conf.d/tls/{app_name}.key"
+
+    def remove_tls_files(self, app_name: str):
+        self.tls_files.pop(app_name, None)
+
+    def write_error_pages(self, app_name: str, pages: Dict[str, str]) -> str:
+        self.error_pages[app_name] = dict(pages)
+        return f"/etc/nginx/conf.d/error_pages/{app_name}"
+
+    def remove_error_pages(self, app_name: str):
+        self.error_pages.pop(app_name, None)
+
+    def list_app_configs(self) -> List[str]:
+        return list(self.configs)
+
+    def configured_upstreams(self) -> Dict[str, List[str]]:
+        return {app_name: self.servers(app_name) for app_name in self.configs}
+
+    def get_nginx_status(self) -> Dict:
+        if self.paused:
+            return {"error": "Failed to get nginx status", "details": "container is paused"}
+        return {"active_connections": self.active_connections, "accepts": self.requests,
+                "handled": self.requests, "requests": self.requests,
+                "reading": 0, "writing": 0, "waiting": 0}
+
+    def test_config(self) -> bool:
+        return not self.fail_updates
+
+    def _recent(self, app_name: str, seconds: int, shadow: bool = False) -> List[Dict[str, Any]]:
+        cutoff = time.time() - seconds
+        return [e for e in (self.shadow_log if shadow else self.access_log).get(app_name, []) if e["time"] >= cutoff]
+
+    def get_access_logs(self, app_name: str, lines: int = 100, request_id: Optional[str] = None) -> Dict:
+        entries = self.access_log.get(app_name, [])
+        if request_id:
+            entries = [e for e in entries if e.get("request_id") == request_id]
+        return {"app": app_name, "entries": entries[-lines:], "count": len(entries[-lines:])}
+
+    def get_upstream_errors(self, app_name: str, seconds: int, lines: int = 5000) -> Optional[Dict]:
+        entries = self._recent(app_name, seconds)
+        return {
+            "requests": len(entries),
+            "bad_gateway": sum(1 for e in entries if e["status"] == 502),
+            "gateway_timeout": sum(1 for e in entries if e["status"] == 504),
+            "upstream_errors": 0
+        }
+
+    def get_upstream_latencies(self, app_name: str, seconds: int, lines: int = 5000) -> Optional[Dict]:
+        stats: Dict[str, Dict[str, Any]] = {}
+        for entry in self._recent(app_name, seconds):
+            upstream = stats.setdefault(entry["upstream"], {"requests": 0, "errors": 0, "total_ms": 0.0})
+            upstream["requests"] += 1
+            upstream["errors"] += 1 if entry["status"] >= 500 else 0
+            upstream["total_ms"] += float(entry["upstream_response_time"]) * 1000
+        return {
+            upstream: {"requests": s["requests"], "errors": s["errors"], "mean_ms": s["total_ms"] / s["requests"]}
+            for upstream, s in stats.items()
+        }
+
+    def get_response_stats(self, app_name: str, seconds: int, shadow: bool = False,
+                           lines: int = 5000) -> Optional[Dict]:
+        samples = sorted(float(e["upstream_response_time"]) * 1000 for e in self._recent(app_name, seconds, shadow))
+        return {
+            "requests": len(samples),
+            "errors": sum(1 for e in self._recent(app_name, seconds, shadow) if e["status"] >= 500),
+            "mean_ms": sum(samples) / len(samples) if samples else None,
+            "p95_ms": samples[min(len(samples) - 1, int(len(samples) * 0.95))] if samples else None
+        }
+
+    def get_container_logs(self, lines: int = 100) -> str:
+        return ""
+
+    def pause(self):
+        self.paused = True
+
+    def unpause(self):
+        self.paused = False
+
+    def restart_nginx(self) -> bool:
+        self.paused = False
+        return True
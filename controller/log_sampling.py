@@ -0,0 +1,88 @@
+"""
+Access log sampling.
+High-RPS apps can keep their nginx access log from filling the nginx
+container's disk with `accessLog`: mode `all` (the default) logs every
+request, `sampled` logs one in `sampleRate` responses below 500 and every
+5xx, and `errors` logs only 5xx responses. PUT /apps/{name}/access-logs/sampling
+changes it at runtime. Every entry records the sample rate it was logged
+with, so the controller weights sampled entries when it counts requests and
+errors or measures latency. An errors-only log cannot tell how many requests
+succeeded: saturation detection, latency-weighted routing, outlier detection
+and shadow comparisons get no data for the app while it is in that mode.
+"""
+
+from typing import Any, Dict, List, Optional, Tuple
+
+MODES = ("all", "sampled", "errors")
+DEFAULT_SAMPLE_RATE = 10
+MAX_SAMPLE_RATE = 10000
+# Logged as the sample rate of entries of an errors-only log
+ERRORS_ONLY_RATE = 0
+
+def validate_access_log(config: Any) -> Tuple[Optional[Dict[str, Any]], Optional[str]]:
+    """Normalize `accessLog`. Returns (config or None for mode all, error)."""
+    if not config:
+        return None, None
+    if not isinstance(config, dict):
+        return None, "accessLog must be a mapping"
+    mode = config.get("mode", "all")
+    if mode not in MODES:
+        return None, f"accessLog.mode must be one of {', '.join(MODES)}"
+    if mode == "all":
+        return None, None
+    if mode == "errors":
+        return {"mode": "errors"}, None
+    rate = config.get("sampleRate", DEFAULT_SAMPLE_RATE)
+    if not isinstance(rate, int) or isinstance(rate, bool) or not 2 <= rate <= MAX_SAMPLE_RATE:
+        return None, f"accessLog.sampleRate must be an integer between 2 and {MAX_SAMPLE_RATE}"
+    return {"mode": "sampled", "sampleRate": rate}, None
+
+def describe(config: Optional[Dict[str, Any]]) -> Dict[str, Any]:
+    """The stored `accessLog` block as the API reports it."""
+    return dict(config) if config else {"mode": "all"}
+
+def nginx_context(app_name: str, config: Optional[Dict[str, Any]]) -> Dict[str, Any]:
+    """What the nginx template needs to log an app's requests."""
+    mode = (config or {}).get("mode", "all")
+    context = {
+        "mode": mode,
+        # nginx variable names cannot contain dashes
+        "variable": f"orchestry_log_{app_name.replace('-', '_')}",
+        "sample_rate": 1
+    }
+    if mode == "sampled":
+        context["sample_rate"] = config["sampleRate"]
+        # split_clients takes percentages with up to two decimals
+        context["percent"] = f"{100 / config['sampleRate']:.2f}".rstrip("0").rstrip(".")
+    elif mode == "errors":
+        context["sample_rate"] = ERRORS_ONLY_RATE
+    return context
+
+def entry_weight(entry: Dict[str, Any]) -> Optional[int]:
+    """How many requests an access log entry stands for: 1 for a 5xx, the sample rate for
+    other responses. None for entries of an errors-only log."""
+    try:
+        rate = int(entry.get("sample_rate") or 1)
+    except (TypeError, ValueError):
+        rate = 1
+    if rate == ERRORS_ONLY_RATE:
+        return None
+    try:
+        status = int(entry.get("status", 0))
+    except (TypeError, ValueError):
+        status = 0
+    return 1 if status >= 500 else rate
+
+def weighted_percentile(samples: List[Tuple[float, int]], fraction: float) -> Optional[float]:
+    """The value below which `fraction` of the weighted samples (value, weight) fall."""
+    if not samples:
+        return None
+    samples = sorted(samples)
+    total = sum(weight for _, weight in samples)
+    threshold = total * fraction
+    seen = 0
+    for value, weight in samples:
+        seen += weight
+        if seen > threshold:
+            return value
+    return samples[-1][0]
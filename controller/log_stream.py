@@ -0,0 +1,112 @@
+"""
+Log streaming.
+GET /apps/{name}/logs/stream keeps the connection open and sends the log
+lines of every replica of an app as server-sent events while they are
+written. The controller polls Docker for lines newer than the last one it
+sent from each container, so replicas that start while the stream is open
+are picked up on the next poll and ones that are removed simply stop
+sending. Each event's id is the line's timestamp: a client that reconnects
+with Last-Event-ID (or `since`) continues after the last line it received
+instead of missing lines or getting them twice.
+"""
+
+import json
+import logging
+from datetime import datetime
+from typing import Any, Dict, List, Optional, Tuple
+
+logger = logging.getLogger(__name__)
+
+POLL_SECONDS = 1.0
+# A comment line is sent when no line was written for this long
+HEARTBEAT_SECONDS = 15
+MAX_TAIL = 1000
+
+# (epoch seconds, nanoseconds): Docker's RFC 3339 timestamps have more precision than a float
+Timestamp = Tuple[int, int]
+
+def parse_timestamp(value: str) -> Optional[Timestamp]:
+    """A Docker log timestamp, e.g. 2024-01-15T10:30:15.123456789Z, or None."""
+    try:
+        seconds, _, fraction = value.rstrip("Z").partition(".")
+        whole = datetime.fromisoformat(seconds + "+00:00")
+        return int(whole.timestamp()), int((fraction + "000000000")[:9] or 0)
+    except ValueError:
+        return None
+
+def parse_since(value: Optional[str]) -> Optional[Timestamp]:
+    """`since` or Last-Event-ID as sent by clients: an event id or Unix seconds."""
+    if not value:
+        return None
+    seconds, _, nanos = str(value).partition(".")
+    if not seconds.isdigit() or (nanos and not nanos.isdigit()):
+        raise ValueError("since must be a log event id or Unix timestamp")
+    return int(seconds), int((nanos + "000000000")[:9])
+
+def event_id(timestamp: Timestamp) -> str:
+    return f"{timestamp[0]}.{timestamp[1]:09d}"
+
+class LogFollower:
+    """The lines of an app's containers that have not been sent to one client yet."""
+
+    def __init__(self, client: Any, since: Optional[Timestamp] = None):
+        self.client = client
+        self.since = since
+        # Per container: the timestamp of the last line sent and the lines sent with it
+        self._sent: Dict[str, Tuple[Timestamp, set]] = {}
+
+    def poll(self, instances: List[Any], tail: Optional[int] = None) -> List[Dict[str, Any]]:
+        """New lines of the given replicas, oldest first. tail limits what each container sends
+        the first time it is polled when the stream did not start from a timestamp."""
+        entries = []
+        for instance in instances:
+            container_id = instance.container_id
+            last = self._sent.get(container_id)
+            start = last[0] if last else self.since
+            try:
+                container = self.client.containers.get(container_id)
+                if start:
+                    output = container.logs(since=start[0], timestamps=True, stdout=True, stderr=True)
+                else:
+                    output = container.logs(tail=tail if tail is not None else "all", timestamps=True,
+                                            stdout=True, stderr=True)
+            except Exception as e:
+                logger.debug(f"Cannot read logs of container {container_id[:12]}: {e}")
+                continue
+            entries.extend(self._new_lines(container_id, output.decode("utf-8", errors="replace"), start))
+        entries.sort(key=lambda entry: entry["_ts"])
+        if entries:
+            self.since = max(self.since or (0, 0), entries[-1]["_ts"])
+        return entries
+
+    def _new_lines(self, container_id: str, output: str, start: Optional[Timestamp]) -> List[Dict[str, Any]]:
+        last_ts, last_lines = self._sent.get(container_id, (start, set()))
+        entries = []
+        for line in output.split("\n"):
+            if not line:
+                continue
+            stamp, _, message = line.partition(" ")
+            timestamp = parse_timestamp(stamp)
+            if timestamp is None:
+                continue
+            # Docker filters by whole seconds; drop what this client already has
+            if last_ts and (timestamp < last_ts or (timestamp == last_ts and message in last_lines)):
+                continue
+            if timestamp != last_ts:
+                last_ts, last_lines = timestamp, set()
+            last_lines.add(message)
+            entries.append({
+                "_ts": timestamp,
+                "id": event_id(timestamp),
+                "timestamp": timestamp[0] + timestamp[1] / 1e9,
+                "container": container_id[:12],
+                "message": message
+            })
+        if last_ts:
+            self._sent[container_id] = (last_ts, last_lines)
+        return entries
+
+def sse_event(entry: Dict[str, Any]) -> str:
+    """A log line as a server-sent event; its id lets clients resume with Last-Event-ID."""
+    data = {key: value for key, value in entry.items() if not key.startswith("_")}
+    return f"id: {entry['id']}\nevent: log\ndata: {json.dumps(data)}\n\n"
@@ -11,6 +11,7 @@ import sys
 import logging
 import signal
 import argparse
+import socket
 from pathlib import Path
 from dotenv import load_dotenv
 
@@ -20,6 +21,8 @@ load_dotenv()
 project_root = Path(__file__).parent.parent
 sys.path.insert(0, str(project_root))
 
+from controller.tracing import RequestIdFilter
+
 def setup_logging(level: str = "INFO"):
     """Set up logging configuration."""
     # Determine the appropriate logs directory
@@ -35,13 +38,18 @@ def setup_logging(level: str = "INFO"):
     
     log_file_path = logs_dir / 'orchestry-controller.log'
     
+    handlers = [
+        logging.StreamHandler(),
+        logging.FileHandler(log_file_path)
+    ]
+    # Every record gets the ID of the API request it was written under ("-" outside requests)
+    for handler in handlers:
+        handler.addFilter(RequestIdFilter())
+
     logging.basicConfig(
         level=getattr(logging, level.upper()),
-        format='%(asctime)s - %(name)s - %(levelname)s - %(message)s',
-        handlers=[
-            logging.StreamHandler(),
-            logging.FileHandler(log_file_path)
-        ]
+        format='%(asctime)s - %(name)s - %(levelname)s - [%(request_id)s] %(message)s',
+        handlers=handlers
     )
     
     # Log where we're writing logs to
@@ -53,6 +61,12 @@ def signal_handler(signum, frame):
     logging.info(f"Received signal {signum}, shutting down...")
     sys.exit(0)
 
+def _bind_socket(host: str, port: int) -> socket.socket:
+    sock = socket.socket(socket.AF_INET, socket.SOCK_STREAM)
+    sock.setsockopt(socket.SOL_SOCKET, socket.SO_REUSEADDR, 1)
+    sock.bind((host, port))
+    return sock
+
 def main():
     """Main entry point for the controller daemon."""
     parser = argparse.ArgumentParser(description="Orchestry Controller Daemon")
@@ -65,6 +79,9 @@ def main():
                        help="Database path (deprecated - using PostgreSQL HA cluster)")
     parser.add_argument("--nginx-container", default=None,
                        help="Nginx container name (default: from environment)")
+    parser.add_argument("--simulate-nodes", type=int, default=None,
+                       help="Run this many cluster nodes in-process on consecutive ports, for "
+                            "developing HA features locally (default: ORCHESTRY_SIMULATED_NODES)")
     
     args = parser.parse_args()
     
@@ -103,6 +120,18 @@ def main():
         os.environ["ORCHESTRY_DB_PATH"] = db_path
     os.environ["ORCHESTRY_NGINX_CONTAINER"] = nginx_container
     
+    # Simulated cluster mode is read from the environment when the controller starts
+    simulated_nodes = args.simulate_nodes if args.simulate_nodes is not None \
+        else int(os.getenv("ORCHESTRY_SIMULATED_NODES", "0"))
+    if simulated_nodes > 1:
+        from controller.simulated_cluster import validate_size
+        size_error = validate_size(simulated_nodes)
+        if size_error:
+            logger.error(size_error)
+            sys.exit(1)
+        os.environ["ORCHESTRY_SIMULATED_NODES"] = str(simulated_nodes)
+        logger.warning(f"Simulated cluster mode: {simulated_nodes} nodes on ports {port}-{port + simulated_nodes - 1}")
+
     logger.info(f"Database: PostgreSQL HA Cluster (postgres-primary -> postgres-replica)")
     logger.info(f"Nginx container: {nginx_container}")
     
@@ -117,6 +146,13 @@ def main():
         log_config = uvicorn.config.LOGGING_CONFIG
         log_config["handlers"]["default"]["stream"] = "ext://sys.stdout"
         
+        if simulated_nodes > 1:
+            # One server listening on a port per simulated node
+            config = uvicorn.Config(app, host=host, port=port, log_level=args.log_level.lower(),
+                                    access_log=True, log_config=log_config)
+            uvicorn.Server(config).run(sockets=[_bind_socket(host, port + index) for index in range(simulated_nodes)])
+            return
+
         # Run the FastAPI server
         uvicorn.run(
             app, 
@@ -4,43 +4,174 @@ Handles container creation, scaling, health checks, and removal.
 """
 
 import docker
+import copy
 import time
 import logging
 import threading
-from typing import Dict, Optional, Any
-from dataclasses import dataclass
+import functools
+from contextlib import contextmanager
+from enum import Enum
+from typing import Callable, Dict, Optional, Any
+from dataclasses import dataclass, field
 
 from state.db import get_database_manager, AppRecord
 from .nginx import DockerNginxManager
+from .loadbalancer import LoadBalancer
+from .runtime import ContainerRuntime, configured_runtime
 from .health import HealthChecker
+from .alerts import AlertManager
+from .edge_auth import EdgeAuthManager, validate_auth_config, secret_refs
+from . import ip_access
+from . import platforms
+from . import host_options
+from . import security
+from . import approvals
+from . import public_status
+from . import ports
+from . import udp
+from . import warm_pool
+from . import decision_hooks
+from . import metrics_sources
+from . import latency_weights
+from . import outliers
+from . import rollout
+from . import registry_webhook
+from . import federation
+from . import dns_steering
+from . import process_runtime
+from . import shadow
+from . import availability
+from . import termination
+from . import dependencies
+from . import toggles
+from . import operation_journal
+from . import health_content
+from . import slow_start
+from . import concurrency
+from . import app_locks
+from . import status_timeline
+from . import arbiter
+from . import error_pages
+from . import edge_tls
+from . import log_sampling
+from . import passive_health
+from . import conditions
+from . import edge_headers
+from . import env_files
+from . import expiry
+from . import docker_errors
+from .namespaces import NamespaceManager, validate_namespace_name
+from .scaler import policy_from_scaling
 
 logger = logging.getLogger(__name__)
 
+class InstanceState(str, Enum):
+    STARTING = "starting"    # container running, not yet passing health checks
+    READY = "ready"          # receiving traffic
+    UNHEALTHY = "unhealthy"  # running but failing health checks
+    DRAINING = "draining"    # removed from nginx, about to be stopped
+    DOWN = "down"            # container stopped or gone
+
+# Allowed transitions; anything else is rejected and logged
+INSTANCE_TRANSITIONS = {
+    InstanceState.STARTING: {InstanceState.READY, InstanceState.UNHEALTHY, InstanceState.DRAINING, InstanceState.DOWN},
+    InstanceState.READY: {InstanceState.UNHEALTHY, InstanceState.DRAINING, InstanceState.DOWN},
+    InstanceState.UNHEALTHY: {InstanceState.READY, InstanceState.DRAINING, InstanceState.DOWN},
+    InstanceState.DRAINING: {InstanceState.DOWN},
+    InstanceState.DOWN: {InstanceState.STARTING},
+}
+
+# Measuring a container's writable layer walks its files, so do it less often than CPU/memory
+DISK_STATS_INTERVAL_SECONDS = 60
+# Status of a decommissioned app whose spec and history are kept
+ARCHIVED = "archived"
+
 @dataclass
 class ContainerInstance:
     container_id: str
     ip: str
     port: int
-    state: str  # ready, draining, down
+    state: InstanceState = InstanceState.STARTING
     cpu_percent: float = 0.0
     memory_percent: float = 0.0
+    disk_usage_bytes: int = 0
+    disk_checked_at: float = 0.0
     last_seen: float = 0.0
     failures: int = 0
+    state_changed_at: float = field(default_factory=time.time)
+    state_reason: str = ""
+    host_port: Optional[int] = None  # published on the Docker host (hostPort / publishRange)
+
+    def transition(self, new_state: InstanceState, reason: str = "") -> bool:
+        """Move to new_state if the state machine allows it. Returns True if the state changed."""
+        if new_state == self.state:
+            return False
+        if new_state not in INSTANCE_TRANSITIONS[self.state]:
+            logger.debug(f"Ignoring transition {self.state.value} -> {new_state.value} for {self.container_id[:12]} ({reason})")
+            return False
+        logger.info(f"Instance {self.container_id[:12]}: {self.state.value} -> {new_state.value}" + (f" ({reason})" if reason else ""))
+        self.state = new_state
+        self.state_changed_at = time.time()
+        self.state_reason = reason
+        return True
+
+    @property
+    def routable(self) -> bool:
+        """Whether nginx should send traffic to this instance."""
+        return self.state == InstanceState.READY
+
+def _locked(operation: str):
+    """Run an AppManager method that takes the app name first under the app's operation
+    lock. Callers can pass wait=False to fail fast and requested_by for visibility."""
+    def decorator(method):
+        @functools.wraps(method)
+        def wrapper(self, app_name: str, *args, wait: bool = True, requested_by: Optional[str] = None, **kwargs):
+            with self.app_operation(app_name, operation, requested_by, wait) as busy:
+                return busy or method(self, app_name, *args, **kwargs)
+        return wrapper
+    return decorator
 
 class AppManager:
-    def __init__(self, state_store: Any = None, nginx_manager: DockerNginxManager = None):
-        self.client = docker.from_env()
+    def __init__(self, state_store: Any = None, nginx_manager: Optional[LoadBalancer] = None,
+                 runtime: Optional[ContainerRuntime] = None):
+        self.client = runtime or configured_runtime()
         self.state_store = state_store or get_database_manager()
-        self.nginx = nginx_manager or DockerNginxManager()
-        self.health_checker = HealthChecker()
+        self.nginx = nginx_manager or DockerNginxManager(docker_client=self.client)
+        self.health_checker = HealthChecker(state_store=self.state_store)
         # Set up callback for health status changes
         self.health_checker.set_health_change_callback(self._on_health_status_change)
+        self.health_checker.set_observer_callback(self._apply_health_state)
+        self.alerts = AlertManager(self.state_store)
+        self.edge_auth = EdgeAuthManager(self.client, self.nginx)
+        self.edge_tls = edge_tls.EdgeTLSManager(self.nginx)
+        self.namespaces = NamespaceManager(self.state_store)
+        self.ports = ports.PortAllocator(self.state_store, self.client)
+        self.freeze: Optional[Any] = None  # FreezeState, set once the controller starts
         self.instances = {}  # app_name -> list of ContainerInstance
+        self.latency_weights: Dict[str, Dict[str, int]] = {}  # app_name -> ip:port -> nginx weight
+        self._weights_updated_at: Dict[str, float] = {}
+        self.ramp_weights: Dict[str, Dict[str, int]] = {}  # app_name -> ip:port -> weight of replicas warming up
+        self._outliers_checked_at: Dict[str, float] = {}
+        self.rollouts: Dict[str, dict] = {}  # app_name -> latest rolling update
+        self.shadows: Dict[str, dict] = {}  # app_name -> latest shadow deployment
+        self._shadow_replicas: Dict[str, list] = {}  # app_name -> ContainerInstances receiving mirrored traffic
+        self.queued_disruptions: Dict[str, Dict[str, dict]] = {}  # app_name -> operation -> held back by minReady
+        self.start_failures: Dict[str, dict] = {}  # app_name -> latest permanent Docker error starting a replica
+        self.lb_states: Dict[str, dict] = {}  # app_name -> outcome of the latest nginx config update
+        self.condition_times = conditions.ConditionTracker()
+        self.capacity_arbiter: Optional[Any] = None  # CapacityArbiter, set once the controller starts
+        self.operation_locks = app_locks.AppOperationLocks()
+        self.journal = operation_journal.OperationJournal(self.state_store)
+        self.timeline = status_timeline.StatusTimeline(self.state_store)
+        self.maintenance = error_pages.MaintenanceMode(self.state_store)
         self._lock = threading.RLock()
         self._restart_lock = threading.RLock()
         self._shutdown = False
         self.monitoring_active = False
         self.monitoring_thread = None
+        self._host_platforms = None  # platforms the Docker host can run, loaded on first use
+        self.events_thread = None
+        self._event_stream = None
         self._ensure_network()
 
     def _on_health_status_change(self, container_id: str, is_healthy: bool):
@@ -51,20 +182,107 @@ class AppManager:
                     for instance in instances:
                         if instance.container_id == container_id:
                             logger.info(f"Health status changed for {app_name} container {container_id[:12]}: {'healthy' if is_healthy else 'unhealthy'}")
+                            if is_healthy:
+                                instance.transition(InstanceState.READY, "health check passed")
+                            else:
+                                # e.g. a health payload reporting a degraded dependency
+                                status = self.health_checker.get_health_status(container_id)
+                                reason = f"health check failed: {status.last_error}" if status and status.last_error \
+                                    else "health check failed"
+                                instance.transition(InstanceState.UNHEALTHY, reason)
                             # Update nginx configuration to reflect health change
                             self._update_nginx_config(app_name)
+                            if not is_healthy:
+                                self.alerts.notify(
+                                    app_name, "replica_unhealthy",
+                                    f"Replica {container_id[:12]} of {app_name} is failing health checks",
+                                    {"container_id": container_id[:12]},
+                                    severity="warning"
+                                )
                             return
         except Exception as e:
             logger.error(f"Error handling health status change for container {container_id}: {e}")
 
+    def _register_health(self, app_name: str, instance: ContainerInstance, spec: dict, source: str = "",
+                         started_at: Optional[float] = None):
+        """Start health checking a new instance and settle its initial state.
+        Without a health check a running container is ready straight away; otherwise
+        it stays starting until the first check passes. A replica that just started
+        (started_at) gets the check's initialDelaySeconds and gracePeriodSeconds."""
+        if "health" not in spec:
+            instance.transition(InstanceState.READY, "running, no health check configured")
+            return
+
+        health_config = HealthChecker.create_config_from_spec(spec["health"])
+        self.health_checker.add_target(instance.container_id, instance.ip, instance.port, health_config,
+                                       app_name=app_name, started_at=started_at)
+        logger.info(f"Registered {source}container {instance.container_id[:12]} for health checking")
+
+        # A recently persisted result (warm restart) lets the instance skip the starting phase
+        status = self.health_checker.get_health_status(instance.container_id)
+        if status and status.last_check:
+            if status.is_healthy:
+                instance.transition(InstanceState.READY, "restored healthy state")
+            else:
+                instance.transition(InstanceState.UNHEALTHY, "restored unhealthy state")
+
+    def _apply_health_state(self, container_id: str, is_healthy: bool):
+        """Mirror health results persisted by the leader without touching nginx (followers)."""
+        with self._lock:
+            for instances in self.instances.values():
+                for instance in instances:
+                    if instance.container_id == container_id:
+                        instance.transition(InstanceState.READY if is_healthy else InstanceState.UNHEALTHY,
+                                            "health state synced from leader")
+                        return
+
+    def _find_instance(self, container_id: str):
+        """Return (app_name, instance) for a tracked container, or (None, None)."""
+        for app_name, instances in self.instances.items():
+            for instance in instances:
+                if instance.container_id == container_id:
+                    return app_name, instance
+        return None, None
+
+    def _resolve_platform(self, app_spec: dict) -> Optional[str]:
+        """Validated platform for an app's containers, or None for the host default.
+        Raises ValueError if the platform is malformed or the host cannot run it."""
+        platform, error = platforms.normalize_platform(app_spec.get("platform"))
+        if error:
+            raise ValueError(error)
+        if not platform:
+            return None
+        if self._host_platforms is None:
+            self._host_platforms = platforms.host_platforms(self.client)
+        reason = platforms.unsupported_reason(platform, self._host_platforms)
+        if reason:
+            raise ValueError(reason)
+        return platform
+
+    def _effective_security(self, app_name: str, app_spec: dict) -> dict:
+        """An app's security settings with its namespace policy applied.
+        Raises ValueError if the app no longer satisfies the policy."""
+        app_record = self.state_store.get_app(app_name)
+        namespace = app_record.namespace if app_record else "default"
+        effective, error = security.enforce_policy(
+            app_spec.get("security") or {}, self.namespaces.security_policy(namespace), namespace
+        )
+        if error:
+            raise ValueError(error)
+        return effective
+
+    def _is_frozen(self) -> bool:
+        """Whether the controller is frozen for maintenance (no automatic actions)."""
+        return bool(self.freeze and self.freeze.is_frozen())
+
     @property
     def docker_client(self):
         """Compatibility property for existing code."""
         return self.client
 
-    def reconcile_app(self, app_name: str) -> int:
-        """Adopt existing Docker containers for a registered app.
-        Returns number of adopted (ready) instances."""
+    def reconcile_app(self, app_name: str, report: Optional[Any] = None) -> int:
+        """Adopt existing Docker containers for a registered app, recording what was done
+        in a reconciliation report if given. Returns number of adopted (ready) instances."""
         try:
             app_spec_record = self.state_store.get_app(app_name)
             if not app_spec_record:
@@ -80,7 +298,10 @@ class AppManager:
                 adopted = 0
                 for c in containers:
                     try:
-                        if c.status != "running":
+                        if warm_pool.is_standby(c):
+                            continue  # standbys stay idle until activated
+                        restarted = c.status != "running"
+                        if restarted:
                             logger.info(f"Adopting container {c.name} (was {c.status}), starting...")
                             c.start()
                             c.reload()
@@ -92,9 +313,8 @@ class AppManager:
                             # Fallback: parse trailing dash number
                             parts = c.name.split('-')
                             replica_index = int(parts[-1]) if parts[-1].isdigit() else 0
-                        network_settings = c.attrs.get("NetworkSettings", {})
-                        ip = network_settings.get("Networks", {}).get("orchestry", {}).get("IPAddress", "")
-                        port = app_spec_record.spec.get("ports", [{}])[0].get("containerPort", 0)
+                        ip, port = process_runtime.instance_address(
+                            c, app_spec_record.spec.get("ports", [{}])[0].get("containerPort", 0))
                         # Skip if already tracked
                         if any(inst.container_id == c.id for inst in self.instances[app_name]):
                             continue
@@ -102,39 +322,76 @@ class AppManager:
                             container_id=c.id,
                             ip=ip,
                             port=port,
-                            state="ready",
-                            last_seen=time.time()
+                            state=InstanceState.STARTING,
+                            last_seen=time.time(),
+                            host_port=ports.published_port(c)
                         )
                         self.instances[app_name].append(instance)
 
-                        # Register with health checker if health config is specified
-                        if "health" in app_spec_record.spec:
-                            health_config = HealthChecker.create_config_from_spec(app_spec_record.spec["health"])
-                            self.health_checker.add_target(c.id, ip, port, health_config)
-                            logger.info(f"Registered reconciled container {c.id[:12]} for health checking")
+                        self._register_health(app_name, instance, app_spec_record.spec, "reconciled ")
 
                         adopted += 1
+                        if report:
+                            report.container_adopted(app_name, c.id, restarted=restarted)
                     except Exception as e:
                         logger.warning(f"Failed to adopt container {c.id} for {app_name}: {e}")
+                        if report:
+                            report.fail("adopt", f"container {c.id}: {e}", app_name)
                 if adopted:
                     self._update_nginx_config(app_name)
                     logger.info(f"Reconciled {adopted} container(s) for {app_name}")
+                    if report:
+                        report.nginx_config_rebuilt(app_name)
                 return adopted
         except Exception as e:
             logger.error(f"reconcile_app failed for {app_name}: {e}")
+            if report:
+                report.fail("adopt", e, app_name)
             return 0
 
-    def reconcile_all(self) -> Dict[str, int]:
+    def sync_health_targets(self) -> int:
+        """Follow the instances table the leader keeps: track replicas this node has not seen
+        yet and forget removed ones, so a follower probing a health check shard covers every
+        replica. Docker and nginx are left alone. Returns the number of changes."""
+        changes = 0
+        for app in self.state_store.list_apps():
+            app_name = app["name"]
+            app_record = self.state_store.get_app(app_name)
+            if not app_record or "health" not in (app_record.spec or {}):
+                continue
+            rows = {record.container_id: record for record in self.state_store.get_instances(app_name)}
+            with self._lock:
+                tracked = self.instances.setdefault(app_name, [])
+                known = {inst.container_id for inst in tracked}
+                for container_id, record in rows.items():
+                    if container_id in known:
+                        continue
+                    instance = ContainerInstance(container_id=container_id, ip=record.ip, port=record.port,
+                                                 last_seen=time.time())
+                    tracked.append(instance)
+                    self._register_health(app_name, instance, app_record.spec, "synced ", started_at=record.created_at)
+                    changes += 1
+                for instance in [inst for inst in tracked if inst.container_id not in rows]:
+                    tracked.remove(instance)
+                    self.health_checker.remove_target(instance.container_id)
+                    changes += 1
+        return changes
+
+    def reconcile_all(self, report: Optional[Any] = None) -> Dict[str, int]:
         """Reconcile all registered apps. Returns mapping of app->adopted count."""
         results = {}
         try:
             apps = self.state_store.list_apps()
             for app in apps:
-                adopted = self.reconcile_app(app["name"])
+                if app.get("status") == ARCHIVED:
+                    continue
+                adopted = self.reconcile_app(app["name"], report)
                 results[app["name"]] = adopted
             return results
         except Exception as e:
             logger.error(f"reconcile_all failed: {e}")
+            if report:
+                report.fail("adopt", e)
             return results
 
     def _ensure_network(self):
@@ -148,22 +405,106 @@ class AppManager:
                 labels={"managed_by": "orchestry"}
             )
 
-    def register(self, spec: dict) -> dict:
-        """Register a new application with the given spec."""
+    def register(self, spec: dict, source: Optional[dict] = None) -> dict:
+        """Register a new application with the given spec. Every registration is
+        recorded as a new revision; source describes where it came from (e.g. a promotion)."""
         try:
             app_name = spec["metadata"]["name"]
             app_spec = spec["spec"].copy()  # Make a copy to avoid modifying original
+            existing = self.state_store.get_app(app_name)
+            if existing and existing.status == ARCHIVED:
+                return {"error": f"{app_name} is archived; restore it before registering a new spec"}
 
             # Include scaling config from root level
             if "scaling" in spec:
                 app_spec["scaling"] = spec["scaling"]
 
-            #rn only for http servers
-            if app_spec["type"] != "http":
-                return {"error": "Only HTTP type is currently supported"}
+            # HTTP apps are served by nginx server blocks, UDP apps by stream blocks
+            if app_spec.get("type") not in ("http", "udp"):
+                return {"error": "Only http and udp app types are supported"}
 
             if "ports" not in app_spec or not app_spec["ports"]:
-                return {"error": "HTTP apps must specify at least one port"}
+                return {"error": f"{app_spec['type'].upper()} apps must specify at least one port"}
+
+            # Containers are created for the requested OS/architecture
+            try:
+                platform = self._resolve_platform(app_spec)
+            except ValueError as e:
+                return {"error": str(e)}
+            if platform:
+                app_spec["platform"] = platform
+
+            # DNS, /etc/hosts entries, sysctls, ulimits, shm size, tmpfs and storage limits for the app's containers
+            options, options_error = host_options.validate_host_options(app_spec)
+            if options_error:
+                return {"error": options_error}
+            app_spec.update(options)
+
+            # Replicas get this long to exit after SIGTERM before they are killed
+            grace_error = termination.validate_grace_period(app_spec.get("terminationGracePeriodSeconds"))
+            if grace_error:
+                return {"error": grace_error}
+
+            # Specs merged from .env files may repeat variables or carry credentials
+            env_warnings, env_error = env_files.check_env(app_spec)
+            if env_error:
+                return {"error": env_error}
+
+            # Env variables operators may change with POST /apps/{name}/toggles
+            app_toggles, toggles_error = toggles.validate_toggles(app_spec.get("toggles"), app_spec.get("env"))
+            if toggles_error:
+                return {"error": toggles_error}
+            app_spec.pop("toggles", None)
+            if app_toggles:
+                app_spec["toggles"] = app_toggles
+
+            # nginx keeps at most this many connections open to each replica
+            _, conns_error = concurrency.validate_max_conns(app_spec.get("maxConnsPerReplica"), app_spec)
+            if conns_error:
+                return {"error": conns_error}
+
+            # Replicas can also be published on ports of the Docker host
+            publishing, publishing_error = ports.validate_publishing(app_spec)
+            if publishing_error:
+                return {"error": publishing_error}
+            app_spec.pop("hostPort", None)
+            app_spec.pop("publishRange", None)
+            app_spec.update(publishing)
+            publishing_error = self.ports.check_available(app_name, app_spec)
+            if publishing_error:
+                return {"error": publishing_error}
+
+            # Security hardening, checked against the namespace's policy
+            metadata = spec.get("metadata", {})
+            namespace, namespace_error = validate_namespace_name(metadata.get("namespace"))
+            if namespace_error:
+                return {"error": namespace_error}
+            app_security, security_error = security.validate_security(app_spec.get("security"))
+            if security_error:
+                return {"error": security_error}
+            _, policy_error = security.enforce_policy(
+                app_security, self.namespaces.security_policy(namespace), namespace
+            )
+            if policy_error:
+                return {"error": policy_error}
+            app_spec.pop("security", None)
+            if app_security:
+                app_spec["security"] = app_security
+
+            # Protected apps need a second approval for disruptive changes
+            protection, protection_error = approvals.validate_protection(app_spec.pop("protection", None))
+            if protection_error:
+                return {"error": protection_error}
+            if protection:
+                app_spec["protection"] = protection
+
+            # Preview apps are deleted by the leader once their ttl or expiresAt has passed
+            app_expiry, expiry_error = expiry.validate_expiry(spec.get("ttl"), spec.get("expiresAt"))
+            if expiry_error:
+                return {"error": expiry_error}
+            app_spec.pop("expiry", None)
+            if app_expiry:
+                app_spec["expiry"] = app_expiry
 
             # Map healthCheck -> health for backward compatibility
             if "healthCheck" in app_spec:
@@ -172,6 +513,175 @@ class AppManager:
             if "healthCheck" in spec:
                 app_spec["health"] = spec["healthCheck"]
 
+            # UDP apps get a listen port on nginx and a UDP health probe by default
+            if udp.is_udp(app_spec):
+                udp_fields, udp_error = udp.validate_udp(app_spec)
+                if udp_error:
+                    return {"error": udp_error}
+                app_spec.update(udp_fields)
+                udp_error = udp.check_listen_port(self.state_store, app_name, app_spec)
+                if udp_error:
+                    return {"error": udp_error}
+                if spec.get("auth"):
+                    return {"error": "Edge authentication is only supported for HTTP apps"}
+                if spec.get("tls"):
+                    return {"error": "TLS termination is only supported for HTTP apps"}
+                if spec.get("accessLog"):
+                    return {"error": "Access log sampling is only supported for HTTP apps"}
+                if spec.get("headers"):
+                    return {"error": "Header rules are only supported for HTTP apps"}
+            else:
+                app_spec.pop("udp", None)
+
+            # HTTP checks can also require the JSON payload to report healthy dependencies
+            health = app_spec.get("health")
+            if isinstance(health, dict) and health.get("content") is not None:
+                content, content_error = health_content.validate_health_content(health["content"],
+                                                                                 health.get("type") or "http")
+                if content_error:
+                    return {"error": content_error}
+                app_spec["health"] = {**health, "content": content}
+
+            # nginx skips replicas failing requests between health checks
+            passive, passive_error = passive_health.validate_passive_health(spec.get("passiveHealth"),
+                                                                            udp=udp.is_udp(app_spec))
+            if passive_error:
+                return {"error": passive_error}
+            app_spec.pop("passiveHealth", None)
+            if passive:
+                app_spec["passiveHealth"] = passive
+
+            # High-RPS apps log a sample of their requests
+            sampling, sampling_error = log_sampling.validate_access_log(spec.get("accessLog"))
+            if sampling_error:
+                return {"error": sampling_error}
+            app_spec.pop("accessLog", None)
+            if sampling:
+                app_spec["accessLog"] = sampling
+
+            # nginx adds, replaces and removes headers at the edge
+            header_rules, headers_error = edge_headers.validate_headers(spec.get("headers"))
+            if headers_error:
+                return {"error": headers_error}
+            app_spec.pop("headers", None)
+            if header_rules:
+                app_spec["headers"] = header_rules
+
+            # nginx serves the app's own error and maintenance pages
+            pages, pages_error = error_pages.validate_error_pages(spec.get("errorPages"))
+            if pages_error:
+                return {"error": pages_error}
+            app_spec.pop("errorPages", None)
+            if pages:
+                if udp.is_udp(app_spec):
+                    return {"error": "errorPages are only supported for HTTP apps"}
+                app_spec["errorPages"] = pages
+
+            # IP allow/deny lists are normalized before they are stored
+            if app_spec.get("allowFrom") or app_spec.get("denyFrom"):
+                rules, rules_error = ip_access.validate_access_rules(app_spec.get("allowFrom"), app_spec.get("denyFrom"))
+                if rules_error:
+                    return {"error": rules_error}
+                app_spec.update(rules)
+
+            # Edge authentication is rendered into the app's nginx config
+            auth_error = validate_auth_config(spec.get("auth"))
+            if auth_error:
+                return {"error": auth_error}
+            if spec.get("auth"):
+                app_spec["auth"] = spec["auth"]
+
+            # HTTPS is terminated by nginx with a certificate from secrets
+            tls, tls_error = edge_tls.validate_tls(spec.get("tls"))
+            if tls_error:
+                return {"error": tls_error}
+            app_spec.pop("tls", None)
+            if tls:
+                app_spec["tls"] = tls
+
+            # Apps opt in to the unauthenticated status endpoint and badge
+            public, public_error = public_status.validate_public_status(spec.get("publicStatus"))
+            if public_error:
+                return {"error": public_error}
+            app_spec.pop("publicStatus", None)
+            if public:
+                app_spec["publicStatus"] = public
+
+            # Proxy-level tracing is rendered into the app's nginx config
+            if "tracing" in spec and spec["tracing"]:
+                app_spec["tracing"] = spec["tracing"]
+
+            # Replica weights follow observed upstream latency
+            weighting, weighting_error = latency_weights.validate_latency_weighting(spec.get("latencyWeighting"), app_spec)
+            if weighting_error:
+                return {"error": weighting_error}
+            app_spec.pop("latencyWeighting", None)
+            if weighting:
+                app_spec["latencyWeighting"] = weighting
+
+            # Replicas far worse than their siblings are quarantined and replaced
+            detection, detection_error = outliers.validate_outlier_detection(spec.get("outlierDetection"), app_spec)
+            if detection_error:
+                return {"error": detection_error}
+            app_spec.pop("outlierDetection", None)
+            if detection:
+                app_spec["outlierDetection"] = detection
+
+            # Replicas joining nginx ramp up to full weight
+            ramp, ramp_error = slow_start.validate_slow_start(spec.get("slowStart"), app_spec)
+            if ramp_error:
+                return {"error": ramp_error}
+            app_spec.pop("slowStart", None)
+            if ramp:
+                app_spec["slowStart"] = ramp
+
+            # Automated operations keep at least minReady replicas ready
+            floor_config, floor_error = availability.validate_availability(spec.get("availability"))
+            if floor_error:
+                return {"error": floor_error}
+            app_spec.pop("availability", None)
+            if floor_config:
+                app_spec["availability"] = floor_config
+
+            # Apps this one needs; status rolls their health up into its effective health
+            depends_on, depends_error = dependencies.validate_depends_on(spec.get("dependsOn"), app_name)
+            if depends_error:
+                return {"error": depends_error}
+            app_spec.pop("dependsOn", None)
+            if depends_on:
+                graph = {app["name"]: (app.get("spec") or {}).get("dependsOn") or []
+                         for app in self.state_store.list_apps() if app["name"] != app_name}
+                cycle = dependencies.find_cycle(app_name, depends_on, graph)
+                if cycle:
+                    return {"error": f"dependsOn would create a dependency cycle: {' -> '.join(cycle)}"}
+                app_spec["dependsOn"] = depends_on
+
+            # Registry pushes of matching tags are rolled out automatically
+            deployment, deployment_error = registry_webhook.validate_continuous_deployment(
+                spec.get("continuousDeployment"), app_spec.get("image"))
+            if deployment_error:
+                return {"error": deployment_error}
+            app_spec.pop("continuousDeployment", None)
+            if deployment:
+                app_spec["continuousDeployment"] = deployment
+
+            # Clusters a federated registration puts the app on, kept for reference
+            placement, placement_error = federation.validate_placement(spec.get("placement"))
+            if placement_error:
+                return {"error": placement_error}
+            app_spec.pop("placement", None)
+            if placement:
+                app_spec["placement"] = placement
+
+            # DNS weights across clusters follow each cluster's public status
+            steering, steering_error = dns_steering.validate_dns_steering(
+                spec.get("dnsSteering"), app_spec.get("publicStatus"))
+            if steering_error:
+                return {"error": steering_error}
+            app_spec.pop("dnsSteering", None)
+            if steering:
+                app_spec["dnsSteering"] = steering
+
             # Merge metadata.labels into spec.labels
             if "labels" not in app_spec:
                 app_spec["labels"] = {}
@@ -182,10 +692,53 @@ class AppManager:
             scaling_config = spec.get("scaling", {})
             scaling_mode = scaling_config.get("mode", "auto")
 
+            # Standby containers kept ready for fast scale-out
+            pool, pool_error = warm_pool.validate_warm_pool(scaling_config.get("warmPool"), app_spec)
+            if pool_error:
+                return {"error": pool_error}
+            # External service consulted before scaling decisions are carried out
+            hook, hook_error = decision_hooks.validate_decision_webhook(scaling_config.get("decisionWebhook"))
+            if hook_error:
+                return {"error": hook_error}
+            # Metrics read from plugins and external systems, scaled on next to the built-in ones
+            external_metrics, external_error = metrics_sources.validate_external_metrics(
+                scaling_config.get("externalMetrics"))
+            if external_error:
+                return {"error": external_error}
+            # Share of contended host capacity when several apps scale out at once
+            _, priority_error = arbiter.validate_priority(scaling_config.get("priority"))
+            if priority_error:
+                return {"error": priority_error}
+            if scaling_config:
+                scaling_config = dict(scaling_config)
+                scaling_config.pop("warmPool", None)
+                scaling_config.pop("decisionWebhook", None)
+                scaling_config.pop("externalMetrics", None)
+                if pool:
+                    scaling_config["warmPool"] = pool
+                if hook:
+                    scaling_config["decisionWebhook"] = hook
+                if external_metrics:
+                    scaling_config["externalMetrics"] = external_metrics
+
+            # Fields the app leaves out come from its namespace's scaling defaults
+            try:
+                policy_from_scaling(scaling_config, self.namespaces.scaling_defaults(namespace))
+            except (ValueError, TypeError) as e:
+                return {"error": f"Invalid scaling policy: {e}"}
+
             # Store complete scaling configuration in the app spec
             if scaling_config:
                 app_spec["scaling"] = scaling_config
 
+            # runtime: process apps run a command on the host instead of a container
+            process_fields, process_error = process_runtime.validate_process(app_spec)
+            if process_error:
+                return {"error": process_error}
+            if process_fields:
+                app_spec.pop("workingDir", None)
+                app_spec.update(process_fields)
+
             # Create AppRecord with status='stopped' (no auto-start)
             now = time.time()
             app_record = AppRecord(
@@ -195,20 +748,42 @@ class AppManager:
                 created_at=now,
                 updated_at=now,
                 replicas=0,
-                mode=scaling_mode
+                mode=scaling_mode,
+                owner=metadata.get("owner"),
+                team=metadata.get("team"),
+                contact=metadata.get("contact"),
+                namespace=namespace
             )
+            previous = self.state_store.get_app(app_name)
             self.state_store.save_app(app_record)
+            revision = self.state_store.save_app_revision(app_name, spec, source)
+            previous_publishing = {key: (previous.spec or {}).get(key) for key in ("hostPort", "publishRange")} \
+                if previous else {}
+            if previous and {key: value for key, value in previous_publishing.items() if value} != publishing:
+                # Ports the app no longer publishes can go to other apps; replicas get new ones when recreated
+                self.ports.release(app_name)
+            previous_listen_port = (previous.spec.get("udp") or {}).get("listenPort") if previous else None
+            if previous and (previous_listen_port != (app_spec.get("udp") or {}).get("listenPort")
+                             or not udp.is_udp(app_spec)):
+                # A new fixed listen port (or a range) is assigned the next time nginx is updated
+                udp.release_listen_port(self.state_store, app_name)
 
             # Initialize empty instance list
             self.instances[app_name] = []
+            if not previous:
+                self._record_status(app_name, "registered", f"registered revision {revision}", {"revision": revision})
 
-            logger.info(f"Registered app {app_name} with status='stopped'")
-            return {"status": "registered", "app": app_name}
+            logger.info(f"Registered app {app_name} (revision {revision}) with status='stopped'")
+            result = {"status": "registered", "app": app_name, "revision": revision}
+            if env_warnings:
+                result["warnings"] = env_warnings
+            return result
 
         except Exception as e:
             logger.error(f"Failed to register app: {e}")
             return {"error": str(e)}
 
+    @_locked("start")
     def start(self, app_name: str) -> dict:
         """Start the application containers."""
         try:
@@ -216,6 +791,8 @@ class AppManager:
             app_record = self.state_store.get_app(app_name)
             if not app_record:
                 return {"error": f"App {app_name} not found"}
+            if app_record.status == ARCHIVED:
+                return {"error": f"{app_name} is archived; restore it before starting it"}
 
             logger.info(f"Got app record for {app_name}: {app_record}")
 
@@ -228,6 +805,7 @@ class AppManager:
             app_record.status = 'running'
             app_record.updated_at = time.time()
             self.state_store.save_app(app_record)
+            self._record_status(app_name, "running", "started")
 
             # Adopt existing containers first
             adopted = self.reconcile_app(app_name)
@@ -242,6 +820,11 @@ class AppManager:
                             existing_indices.add(int(idx_label))
                     except Exception:
                         pass
+                # Standby names are taken too, whether or not they get activated below
+                for c in warm_pool.standbys(self.docker_client, app_name):
+                    idx_label = c.labels.get("orchestry.replica")
+                    if idx_label and idx_label.isdigit():
+                        existing_indices.add(int(idx_label))
 
                 # Start additional replicas if below min
                 scaling_config = app_spec.get("scaling", {})
@@ -249,15 +832,27 @@ class AppManager:
                 logger.info(f"Ensuring minimum {min_replicas} replicas for {app_name} (adopted {adopted})")
                 next_index = 0
                 started = 0
+                failed = 0
                 while len(self.instances.get(app_name, [])) < min_replicas:
                     # Find next unused index
                     while next_index in existing_indices:
                         next_index += 1
+                    result = self._activate_standby(app_name, app_spec)
+                    if result:
+                        started += 1
+                        continue
                     logger.info(f"Creating new container replica index {next_index} for {app_name}")
                     result = self._start_container(app_name, app_spec, next_index)
                     if result:
                         existing_indices.add(next_index)
                         started += 1
+                    else:
+                        failed += 1
+                        # Another index gets around a name left taken by an old container; other
+                        # failures would only repeat, and are reported in the app's status instead
+                        reason = (self.start_failures.get(app_name) or {}).get("reason")
+                        if reason != "name_conflict" or failed >= min_replicas:
+                            break
                     next_index += 1
                 total = len(self.instances.get(app_name, []))
 
@@ -271,81 +866,89 @@ class AppManager:
             logger.error(f"Failed to start app {app_name}: {e}")
             return {"error": str(e)}
 
-    def _start_container(self, app_name: str, app_spec: dict, replica_index: int) -> Optional[ContainerInstance]:
-        """Start a single container instance."""
-        try:
-            container_port = app_spec["ports"][0]["containerPort"]
+    def _container_config(self, app_name: str, app_spec: dict, replica_index: int):
+        """Docker create() arguments for a replica. Returns (container_config, host_port)."""
+        # Container configuration
+        container_config = {
+            "image": app_spec.get("image"),
+            "name": f"{app_name}-{replica_index}",
+            "labels": {
+                "orchestry.app": app_name,
+                "orchestry.replica": str(replica_index),
+                "orchestry.type": app_spec["type"]
+            },
+            "network": "orchestry",
+            "detach": True,
+            "ports": {},
+            "publish_all_ports": False,
+        }
 
-            # Container configuration
-            container_config = {
-                "image": app_spec["image"],
-                "name": f"{app_name}-{replica_index}",
-                "labels": {
-                    "orchestry.app": app_name,
-                    "orchestry.replica": str(replica_index),
-                    "orchestry.type": app_spec["type"]
-                },
-                "network": "orchestry",
-                "detach": True,
-                "ports": {},
-                "publish_all_ports": False,
-            }
+        platform = self._resolve_platform(app_spec)
+        if platform:
+            container_config["platform"] = platform
+        host_options.apply(container_config, app_spec)
+        security.apply(container_config, self._effective_security(app_name, app_spec))
+        process_runtime.apply(container_config, app_spec)
+        termination.apply(container_config, app_spec)
+        host_port = self.ports.apply(container_config, app_name, replica_index, app_spec)
 
-            #add resource limits if specified
-            if "resources" in app_spec:
-                resources = app_spec["resources"]
-                if "cpu" in resources:
-                    # Handle Kubernetes-style CPU specifications (e.g., "100m", "0.5", "1")
-                    cpu_str = resources["cpu"]
-                    if cpu_str.endswith("m"):
-                        # Millicpus (e.g., "100m" = 0.1 CPU)
-                        cpu_value = float(cpu_str[:-1]) / 1000
-                    else:
-                        # Regular CPU value (e.g., "0.5", "1")
-                        cpu_value = float(cpu_str)
-                    container_config["nano_cpus"] = int(cpu_value * 1_000_000_000)
-                if "memory" in resources:
-                    # Convert memory string to bytes
-                    memory_str = resources["memory"]
-                    if memory_str.endswith("Mi"):
-                        memory_bytes = int(memory_str[:-2]) * 1024 * 1024
-                        container_config["mem_limit"] = memory_bytes
-                    elif memory_str.endswith("Gi"):
-                        memory_bytes = int(memory_str[:-2]) * 1024 * 1024 * 1024
-                        container_config["mem_limit"] = memory_bytes
-
-            # Add environment variables if specified
-            if "env" in app_spec:
-                env_vars = {}
-                for env in app_spec["env"]:
-                    if env.get("valueFrom") == "sdk":
-                        # Handle SDK-provided values
-                        env_vars[env["name"]] = self._get_sdk_env_value(env["name"])
-                    else:
-                        env_vars[env["name"]] = env.get("value", "")
-                container_config["environment"] = env_vars
+        #add resource limits if specified
+        if "resources" in app_spec:
+            resources = app_spec["resources"]
+            if "cpu" in resources:
+                # Handle Kubernetes-style CPU specifications (e.g., "100m", "0.5", "1")
+                cpu_str = resources["cpu"]
+                if cpu_str.endswith("m"):
+                    # Millicpus (e.g., "100m" = 0.1 CPU)
+                    cpu_value = float(cpu_str[:-1]) / 1000
+                else:
+                    # Regular CPU value (e.g., "0.5", "1")
+                    cpu_value = float(cpu_str)
+                container_config["nano_cpus"] = int(cpu_value * 1_000_000_000)
+            if "memory" in resources:
+                # Convert memory string to bytes
+                memory_str = resources["memory"]
+                if memory_str.endswith("Mi"):
+                    memory_bytes = int(memory_str[:-2]) * 1024 * 1024
+                    container_config["mem_limit"] = memory_bytes
+                elif memory_str.endswith("Gi"):
+                    memory_bytes = int(memory_str[:-2]) * 1024 * 1024 * 1024
+                    container_config["mem_limit"] = memory_bytes
+
+        # Add environment variables if specified
+        if "env" in app_spec:
+            env_vars = {}
+            for env in app_spec["env"]:
+                if env.get("valueFrom") == "sdk":
+                    # Handle SDK-provided values
+                    env_vars[env["name"]] = self._get_sdk_env_value(env["name"])
+                else:
+                    env_vars[env["name"]] = env.get("value", "")
+            container_config["environment"] = env_vars
 
-            # Create container without port publishing
-            container_config.pop("detach", None)  # Remove detach for create
-            container = self.docker_client.containers.create(**container_config)
-            container.start()
+        # Create container without port publishing
+        container_config.pop("detach", None)  # Remove detach for create
+        return container_config, host_port
 
-            # Wait for container to be running and get network info
-            container.reload()
-            if container.status != "running":
-                raise Exception(f"Container failed to start: {container.status}")
+    def _start_container(self, app_name: str, app_spec: dict, replica_index: int) -> Optional[ContainerInstance]:
+        """Start a single container instance."""
+        container_config = None
+        try:
+            container_port = app_spec["ports"][0]["containerPort"]
+            container_config, host_port = self._container_config(app_name, app_spec, replica_index)
+            container = self._create_and_start(container_config)
 
             # Get container IP and port
-            network_settings = container.attrs["NetworkSettings"]
-            container_ip = network_settings["Networks"]["orchestry"]["IPAddress"]
+            container_ip, container_port = process_runtime.instance_address(container, container_port)
 
             # Create instance record
             instance = ContainerInstance(
                 container_id=container.id,
                 ip=container_ip,
                 port=container_port,
-                state="ready",
-                last_seen=time.time()
+                state=InstanceState.STARTING,
+                last_seen=time.time(),
+                host_port=host_port
             )
 
             # Add to instances list
@@ -353,10 +956,8 @@ class AppManager:
                 self.instances[app_name] = []
             self.instances[app_name].append(instance)
 
-            if "health" in app_spec:
-                health_config = HealthChecker.create_config_from_spec(app_spec["health"])
-                self.health_checker.add_target(container.id, container_ip, container_port, health_config)
-                logger.info(f"Registered container {container.id[:12]} for health checking")
+            self._register_health(app_name, instance, app_spec, "", started_at=time.time())
+            self._clear_start_failure(app_name)
 
             logger.info(f"Started container {app_name}-{replica_index} at {container_ip}:{container_port}")
             return instance
@@ -366,19 +967,81 @@ class AppManager:
             logger.error(f"Container config was: {container_config}")
             import traceback
             logger.error(f"Full traceback: {traceback.format_exc()}")
+            self._record_start_failure(app_name, e)
             return None
 
+    def _create_and_start(self, container_config: dict, bring_up: Optional[Callable[[Any], None]] = None):
+        """Create and start a replica's container (or bring it up with bring_up instead, as
+        standbys are), retrying transient Docker errors. Whenever a try fails the container is
+        removed, so no failed start leaves one behind."""
+        name = container_config.get("name")
+
+        def attempt():
+            container = None
+            try:
+                container = self.docker_client.containers.create(**container_config)
+                if bring_up:
+                    bring_up(container)
+                    return container
+                container.start()
+                container.reload()
+                if container.status != "running":
+                    raise Exception(f"Container failed to start: {container.status}")
+                return container
+            except Exception as e:
+                # A create that failed transiently may still have made the container; one that
+                # failed permanently (e.g. the name is taken) must not remove someone else's
+                self._discard_container(container, name if docker_errors.is_transient(e) else None)
+                raise
+
+        return docker_errors.call(attempt, f"starting {name}")
+
+    def _discard_container(self, container: Any, name: Optional[str]):
+        try:
+            if container is None and name:
+                container = self.docker_client.containers.get(name)
+            if container is not None:
+                container.remove(force=True)
+        except Exception:
+            pass  # nothing was created, or the daemon is still unreachable
+
+    def _record_start_failure(self, app_name: str, error: Exception):
+        """Report why a replica of an app could not be started. Transient errors were already
+        retried; an event is logged when the reason changes, not for every failed attempt."""
+        failure = docker_errors.describe(error)
+        previous = self.start_failures.get(app_name)
+        same = previous and (previous["reason"], previous["message"]) == (failure["kind"], failure["message"])
+        self.start_failures[app_name] = {
+            "reason": failure["kind"],
+            "message": failure["message"],
+            "hint": failure["hint"],
+            "since": previous["since"] if same else time.time(),
+            "attempts": previous["attempts"] + 1 if same else 1
+        }
+        if not same:
+            self.state_store.log_event(app_name, "replica_start_failed", failure,
+                                       message=f"Replica of {app_name} could not be started ({failure['kind']}): "
+                                               f"{failure['message']}")
+
+    def _clear_start_failure(self, app_name: str):
+        if self.start_failures.pop(app_name, None):
+            self.state_store.log_event(app_name, "replica_start_recovered", {})
+
     def _get_sdk_env_value(self, env_name: str) -> str:
         """Get SDK-provided environment variable values."""
         # Get values from environment or use defaults for containerized services
         return ""
 
-    def stop(self, app_name: str) -> dict:
-        """Stop all containers for an application."""
+    @_locked("stop")
+    def stop(self, app_name: str, grace_period: Optional[int] = None) -> dict:
+        """Stop all containers for an application. grace_period overrides the app's
+        terminationGracePeriodSeconds."""
         try:
             with self._lock:
                 if app_name not in self.instances:
                     return {"error": f"App {app_name} not found or not running"}
+                if self.shadow_active(app_name):
+                    self.stop_shadow(app_name, "app stopped")
 
                 # Set status to stopped first
                 app_record = self.state_store.get_app(app_name)
@@ -387,12 +1050,14 @@ class AppManager:
                     app_record.updated_at = time.time()
                     app_record.replicas = 0
                     self.state_store.save_app(app_record)
+                    self._record_status(app_name, "stopped", "stopped")
 
+                grace = termination.grace_period(app_record.spec if app_record else None, grace_period)
                 stopped_count = 0
                 for instance in self.instances[app_name]:
                     try:
                         container = self.client.containers.get(instance.container_id)
-                        container.stop(timeout=30)
+                        container.stop(timeout=grace)
                         container.remove()
                         stopped_count += 1
 
@@ -405,8 +1070,14 @@ class AppManager:
                 # Clear instances
                 self.instances[app_name] = []
 
+                for container in warm_pool.standbys(self.docker_client, app_name):
+                    warm_pool.remove(container)
+                self.latency_weights.pop(app_name, None)
+                self.start_failures.pop(app_name, None)
+
             # Remove nginx config
             self._update_nginx_config(app_name)
+            self.edge_auth.remove(app_name)
 
             logger.info(f"Stopped {stopped_count} containers for app {app_name}")
             return {"status": "stopped", "app": app_name, "containers_stopped": stopped_count}
@@ -415,8 +1086,13 @@ class AppManager:
             logger.error(f"Failed to stop app {app_name}: {e}")
             return {"error": str(e)}
 
-    def delete(self, app_name: str) -> dict:
-        """Delete an application completely - stops containers and removes from registry."""
+    @_locked("delete")
+    def delete(self, app_name: str, grace_period: Optional[int] = None, purge: bool = False) -> dict:
+        """Delete an application completely - stops containers and removes from registry.
+        grace_period overrides the app's terminationGracePeriodSeconds. With purge, containers
+        that fail to stop are killed, and the app's database rows (revisions and host ports
+        included) are deleted in one transaction. If a replica is left running the app is
+        not deleted, so no container outlives its record."""
         try:
             logger.info(f"Deleting app {app_name}")
             
@@ -427,38 +1103,66 @@ class AppManager:
             
             # First, stop all containers if any are running
             with self._lock:
+                if self.shadow_active(app_name):
+                    self.stop_shadow(app_name, "app deleted")
                 if app_name in self.instances and len(self.instances[app_name]) > 0:
-                    stopped_count = 0
+                    grace = termination.grace_period(app_record.spec, grace_period)
+                    survivors = []
                     for instance in self.instances[app_name]:
                         try:
                             container = self.client.containers.get(instance.container_id)
-                            container.stop(timeout=30)
+                            container.stop(timeout=grace)
                             container.remove()
-                            stopped_count += 1
-                            
-                            # Remove from health checker
-                            self.health_checker.remove_target(instance.container_id)
-                            
+                        except docker.errors.NotFound:
+                            pass
                         except Exception as e:
                             logger.warning(f"Failed to stop/remove container {instance.container_id}: {e}")
-                    
-                    # Clear instances from memory
-                    self.instances[app_name] = []
+                            if not (purge and self._kill_container(instance.container_id)):
+                                survivors.append(instance)
+                                continue
+                        # Remove from health checker
+                        self.health_checker.remove_target(instance.container_id)
+
+                    stopped_count = len(self.instances[app_name]) - len(survivors)
+                    self.instances[app_name] = survivors
                     logger.info(f"Stopped and removed {stopped_count} containers for app {app_name}")
+                    if survivors:
+                        # Keep the record (and route to what still runs) rather than orphan containers
+                        self._update_nginx_config(app_name)
+                        ids = ", ".join(instance.container_id[:12] for instance in survivors)
+                        hint = "" if purge else "; delete with purge to kill them"
+                        return {"error": f"{len(survivors)} replica(s) of {app_name} could not be removed "
+                                         f"({ids}), so the app was not deleted{hint}"}
+
+                for container in warm_pool.standbys(self.docker_client, app_name):
+                    warm_pool.remove(container)
+                self.latency_weights.pop(app_name, None)
+                self.start_failures.pop(app_name, None)
+                self.lb_states.pop(app_name, None)
+                self.condition_times.forget(app_name)
+                self._weights_updated_at.pop(app_name, None)
+                self._outliers_checked_at.pop(app_name, None)
             
             # Remove nginx configuration
             try:
                 self.nginx.remove_app_config(app_name)
+                self.edge_auth.remove(app_name)
+                self.edge_tls.remove(app_name)
+                self.nginx.remove_error_pages(app_name)
+                self.maintenance.disable(app_name)
                 logger.info(f"Removed nginx configuration for app {app_name}")
             except Exception as e:
                 logger.warning(f"Failed to remove nginx config for {app_name}: {e}")
             
             # Delete app from state store (this also removes instances via cascade)
-            if self.state_store.delete_app(app_name):
+            deleted = self.state_store.purge_app(app_name) if purge else self.state_store.delete_app(app_name)
+            if deleted:
                 logger.info(f"Successfully deleted app {app_name} from state store")
+                self._record_status(app_name, "deleted", "deleted")
                 return {
                     "status": "deleted",
                     "app": app_name,
+                    "purged": purge,
                     "message": f"Application {app_name} deleted successfully"
                 }
             else:
@@ -468,22 +1172,112 @@ class AppManager:
             logger.error(f"Failed to delete app {app_name}: {e}")
             return {"error": str(e)}
 
+    def _kill_container(self, container_id: str) -> bool:
+        """Remove a container that did not stop, killing it if it still runs."""
+        try:
+            self.client.containers.get(container_id).remove(force=True)
+            return True
+        except docker.errors.NotFound:
+            return True
+        except Exception as e:
+            logger.error(f"Failed to force remove container {container_id}: {e}")
+            return False
+
+    @_locked("archive")
+    def archive(self, app_name: str, grace_period: Optional[int] = None) -> dict:
+        """Decommission an app without losing its history: stop its containers and remove its
+        nginx config and published ports, but keep its spec, revisions, events and scaling
+        history. restore() makes it a stopped app again."""
+        try:
+            app_record = self.state_store.get_app(app_name)
+            if not app_record:
+                return {"error": f"App {app_name} not found"}
+            if app_record.status == ARCHIVED:
+                return {"error": f"{app_name} is already archived"}
+
+            stopped_count = 0
+            if app_name in self.instances:
+                result = self.stop(app_name, grace_period)
+                if "error" in result:
+                    return result
+                stopped_count = result["containers_stopped"]
+
+            with self._lock:
+                self.instances.pop(app_name, None)
+                self.queued_disruptions.pop(app_name, None)
+                self.ramp_weights.pop(app_name, None)
+                self._weights_updated_at.pop(app_name, None)
+                self._outliers_checked_at.pop(app_name, None)
+
+            try:
+                self.nginx.remove_app_config(app_name)
+                self.edge_auth.remove(app_name)
+                self.edge_tls.remove(app_name)
+                self.nginx.remove_error_pages(app_name)
+            except Exception as e:
+                logger.warning(f"Failed to remove nginx config for {app_name}: {e}")
+            # Archived apps do not hold on to host ports other apps could use
+            self.ports.release(app_name)
+            udp.release_listen_port(self.state_store, app_name)
+
+            app_record = self.state_store.get_app(app_name)
+            app_record.status = ARCHIVED
+            app_record.replicas = 0
+            app_record.updated_at = time.time()
+            self.state_store.save_app(app_record)
+            self._record_status(app_name, ARCHIVED, "archived")
+
+            logger.info(f"Archived app {app_name}")
+            return {"status": ARCHIVED, "app": app_name, "containers_stopped": stopped_count}
+
+        except Exception as e:
+            logger.error(f"Failed to archive app {app_name}: {e}")
+            return {"error": str(e)}
+
+    @_locked("restore")
+    def restore(self, app_name: str) -> dict:
+        """Bring an archived app back as a stopped app, with its latest spec."""
+        try:
+            app_record = self.state_store.get_app(app_name)
+            if not app_record:
+                return {"error": f"App {app_name} not found"}
+            if app_record.status != ARCHIVED:
+                return {"error": f"{app_name} is not archived"}
+
+            app_record.status = "stopped"
+            app_record.updated_at = time.time()
+            self.state_store.save_app(app_record)
+            self._record_status(app_name, "stopped", "restored from archive")
+            with self._lock:
+                self.instances[app_name] = []
+
+            latest = self.state_store.get_app_revision(app_name)
+            logger.info(f"Restored archived app {app_name}")
+            return {"status": "restored", "app": app_name, "revision": latest["revision"] if latest else None}
+
+        except Exception as e:
+            logger.error(f"Failed to restore app {app_name}: {e}")
+            return {"error": str(e)}
+
     def status(self, app_name: str) -> dict:
         """Get the status of an application."""
         try:
             app_data = self.state_store.get_app(app_name)
             if not app_data:
                 return {"error": f"App {app_name} not found"}
+            if app_data.status == ARCHIVED:
+                return self._with_conditions(app_data, {"app": app_name, "status": ARCHIVED, "replicas": 0,
+                                                        "ready_replicas": 0, "instances": []})
 
             with self._lock:
                 if app_name not in self.instances:
-                    return {
+                    return self._with_conditions(app_data, {
                         "app": app_name,
                         "status": "stopped",
                         "replicas": 0,
                         "ready_replicas": 0,
                         "instances": []
-                    }
+                    })
 
                 # Update container stats
                 self._update_container_stats(app_name)
@@ -493,58 +1287,145 @@ class AppManager:
 
                 # Check again if app was removed during cleanup
                 if app_name not in self.instances:
-                    return {
+                    return self._with_conditions(app_data, {
                         "app": app_name,
                         "status": "stopped",
                         "replicas": 0,
                         "ready_replicas": 0,
                         "instances": []
-                    }
+                    })
 
                 instances_info = []
                 ready_count = 0
                 running_count = 0
+                storage_limit = (app_data.spec or {}).get("storageSize")
 
                 for instance in self.instances[app_name]:
                     # Skip down containers in the instances list
-                    if instance.state == "down":
+                    if instance.state == InstanceState.DOWN:
                         continue
 
                     instance_info = {
                         "container_id": instance.container_id[:12],  # Short ID
                         "ip": instance.ip,
                         "port": instance.port,
-                        "state": instance.state,
+                        "state": instance.state.value,
+                        "state_since": instance.state_changed_at,
+                        "state_reason": instance.state_reason,
                         "cpu_percent": instance.cpu_percent,
                         "memory_percent": instance.memory_percent,
+                        "disk_usage_bytes": instance.disk_usage_bytes,
                         "failures": instance.failures
                     }
+                    if instance.host_port:
+                        instance_info["host_port"] = instance.host_port
+                    if app_name in self.latency_weights:
+                        instance_info["weight"] = self.latency_weights[app_name].get(
+                            f"{instance.ip}:{instance.port}", latency_weights.MAX_WEIGHT)
+                    ramp = self.ramp_weights.get(app_name, {}).get(f"{instance.ip}:{instance.port}")
+                    if ramp:
+                        instance_info["weight"] = ramp
+                        instance_info["warming_up"] = True
+                    if storage_limit:
+                        instance_info["disk_limit_bytes"] = int(storage_limit)
+                        instance_info["disk_percent"] = round(instance.disk_usage_bytes / int(storage_limit) * 100.0, 1)
                     instances_info.append(instance_info)
                     running_count += 1
 
-                    if instance.state == "ready":
+                    if instance.state == InstanceState.READY:
                         ready_count += 1
 
-            return {
+            status = {
                 "app": app_name,
                 "status": "running" if ready_count > 0 else ("degraded" if running_count > 0 else "stopped"),
                 "replicas": running_count,  # Only count non-down containers
                 "ready_replicas": ready_count,
                 "instances": instances_info
             }
+            queued = self.queued_disruptions.get(app_name)
+            if queued:
+                status["queued_operations"] = [dict(entry) for entry in queued.values()]
+            if udp.is_udp(app_data.spec or {}):
+                status["udp_listen_port"] = udp.listen_port(self.state_store, app_name)
+            pool = warm_pool.pool_config(app_data.spec or {})
+            if pool:
+                status["warm_pool"] = dict(pool, standby=len(warm_pool.standbys(self.docker_client, app_name)))
+            return self._with_conditions(app_data, status)
 
         except Exception as e:
             logger.error(f"Failed to get status for app {app_name}: {e}")
             return {"error": str(e)}
 
-    def scale(self, app_name: str, replicas: int) -> dict:
-        """Manually scale an application to the specified number of replicas."""
+    def _with_conditions(self, app_data: AppRecord, status: dict) -> dict:
+        """Add an app's conditions, and its effective health if it declares dependsOn, to its status."""
+        app_name = app_data.name
+        spec = app_data.spec or {}
+        if spec.get("dependsOn"):
+            status["effective_health"] = self.effective_health(app_name)
+        queued = status.get("queued_operations")
+        status["conditions"] = self.condition_times.observe(app_name, conditions.evaluate(
+            app_name, app_data.status, spec, app_data.replicas, status["instances"],
+            failure=self.start_failures.get(app_name), rollout=self.rollouts.get(app_name), queued=queued,
+            lb_state=self.lb_states.get(app_name), effective_health=status.get("effective_health"),
+            capacity_arbiter=self.capacity_arbiter
+        ))
+        return status
+
+    def runtime_summary(self) -> Dict[str, dict]:
+        """Summarize tracked instances per app from in-memory state only (no Docker calls)."""
+        summary = {}
+        with self._lock:
+            for app_name, instances in self.instances.items():
+                live = [inst for inst in instances if inst.state != InstanceState.DOWN]
+                ready = sum(1 for inst in live if inst.state == InstanceState.READY)
+                # Replicas still booting within their grace period are not failing yet
+                checked = [inst for inst in live if self.health_checker.get_health_status(inst.container_id)
+                           and not self.health_checker.in_grace_period(inst.container_id)]
+                failing = sum(1 for inst in checked if not self.health_checker.is_healthy(inst.container_id))
+                summary[app_name] = {
+                    "replicas": len(live),
+                    "ready_replicas": ready,
+                    # Fraction of health-checked replicas currently failing their checks (not a request error rate)
+                    "unhealthy_ratio": round(failing / len(checked), 3) if checked else 0.0
+                }
+        return summary
+
+    def _dependency_state(self):
+        """(registered apps, dependsOn graph, own health per app) from one DB query and in-memory state."""
+        apps = self.state_store.list_apps()
+        runtime = self.runtime_summary()
+        graph = {app["name"]: (app.get("spec") or {}).get("dependsOn") or [] for app in apps}
+        health = {app["name"]: dependencies.own_health(app, runtime.get(app["name"])) for app in apps}
+        return apps, graph, health
+
+    def effective_health(self, app_name: str) -> Optional[dict]:
+        """Health of the app rolled up with the apps it depends on, or None if it declares no dependsOn."""
+        _, graph, health = self._dependency_state()
+        if not graph.get(app_name):
+            return None
+        return dependencies.rollup(app_name, graph, health)
+
+    def dependency_graph(self) -> dict:
+        """Every registered app with its own and effective health, and its dependsOn edges."""
+        apps, _, health = self._dependency_state()
+        return dependencies.dependency_graph(apps, health)
+
+    @_locked("scale")
+    def scale(self, app_name: str, replicas: int, automated: bool = False,
+              grace_period: Optional[int] = None) -> dict:
+        """Scale an application to the specified number of replicas. An automated scale-in
+        that would leave fewer than the app's minReady replicas ready is queued instead.
+        grace_period overrides the app's terminationGracePeriodSeconds for removed replicas."""
+        journal_id = None
         try:
             with self._lock:
                 if app_name not in self.instances:
                     return {"error": f"App {app_name} not found or not running"}
 
                 current_replicas = len(self.instances[app_name])
+                if not (automated and replicas < current_replicas):
+                    # A newer decision replaces a scale-in still waiting for the availability floor
+                    self.queued_disruptions.get(app_name, {}).pop("scale_in", None)
 
                 if replicas == current_replicas:
                     return {"status": "no_change", "app": app_name, "replicas": replicas}
@@ -557,32 +1438,548 @@ class AppManager:
                 app_spec = app_data.spec.copy()
 
                 if replicas > current_replicas:
-                    # Scale up
+                    journal_id = self.journal.begin(app_name, "scale", {
+                        "from": current_replicas, "to": replicas, "automated": automated, "grace_period": grace_period
+                    })
+                    # Scale up, taking standbys from the warm pool first
                     for i in range(current_replicas, replicas):
-                        self._start_container(app_name, app_spec, i)
+                        instance = self._activate_standby(app_name, app_spec) or \
+                            self._start_container(app_name, app_spec, self._next_replica_index(app_name))
+                        if instance:
+                            self.journal.step(journal_id, "started", container=instance.container_id)
                 else:
-                    # Scale down
+                    # Scale down, removing replicas that are not ready first
+                    self.instances[app_name].sort(key=lambda inst: inst.state != InstanceState.READY)
+                    if automated:
+                        blocked = self._availability_blocked(app_name, self.instances[app_name][replicas:])
+                        if blocked:
+                            self._queue_disruption(app_name, "scale_in", blocked, replicas)
+                            return {"status": "deferred", "app": app_name, "replicas": current_replicas,
+                                    "reason": blocked}
+                        self._dequeue_disruption(app_name, "scale_in")
+                    # Take the surplus replicas out of nginx before stopping them
                     containers_to_remove = self.instances[app_name][replicas:]
+                    journal_id = self.journal.begin(app_name, "scale", {
+                        "from": current_replicas, "to": replicas, "automated": automated, "grace_period": grace_period,
+                        "remove": [instance.container_id for instance in containers_to_remove]
+                    })
                     for instance in containers_to_remove:
-                        self._stop_container(instance)
+                        instance.transition(InstanceState.DRAINING, "scaled down")
                     self.instances[app_name] = self.instances[app_name][:replicas]
+                    self._update_nginx_config(app_name)
+                    grace = termination.grace_period(app_spec, grace_period)
+                    for instance in containers_to_remove:
+                        self._stop_container(instance, grace)
+                        self.journal.step(journal_id, "stopped", container=instance.container_id)
 
             # Update nginx configuration
             self._update_nginx_config(app_name)
 
             logger.info(f"Scaled app {app_name} from {current_replicas} to {replicas} replicas")
+            self.journal.finish(journal_id, "completed", {"replicas": len(self.instances.get(app_name, []))})
             return {"status": "scaled", "app": app_name, "replicas": replicas}
 
         except Exception as e:
             logger.error(f"Failed to scale app {app_name}: {e}")
+            self.journal.finish(journal_id, "failed", {"error": str(e)})
             return {"error": str(e)}
 
-    def _stop_container(self, instance: ContainerInstance):
-        """Stop and remove a single container."""
+    def preview_scale(self, app_name: str, replicas: int) -> dict:
+        """The containers a manual scale to `replicas` would create and remove, worked out the
+        way scale() picks them but without touching anything."""
+        with self._lock:
+            if app_name not in self.instances:
+                return {"error": f"App {app_name} not found or not running"}
+            instances = sorted(self.instances[app_name], key=lambda inst: inst.state != InstanceState.READY)
+
+        app_data = self.state_store.get_app(app_name)
+        if not app_data:
+            return {"error": f"App {app_name} specification not found"}
+        app_spec = app_data.spec or {}
+
+        create = max(0, replicas - len(instances))
+        from_warm_pool = 0
+        if create:
+            pool = warm_pool.pool_config(app_spec)
+            if pool:
+                usable = [c for c in warm_pool.standbys(self.docker_client, app_name)
+                          if warm_pool.matches(c, app_spec, pool["mode"])]
+                from_warm_pool = min(create, len(usable))
+
+        removing = instances[replicas:]
+        return {
+            "current_replicas": len(instances),
+            "replicas": replicas,
+            "create": {"count": create, "from_warm_pool": from_warm_pool, "new_containers": create - from_warm_pool},
+            "remove": [{"container": inst.container_id[:12], "state": inst.state.value} for inst in removing],
+            "availability": self._availability_blocked(app_name, removing) if removing else None
+        }
+
+    def _availability_blocked(self, app_name: str, removing: list, replicas: Optional[int] = None) -> Optional[str]:
+        """Why taking `removing` out of service would leave the app below its minReady floor,
+        or None. The floor is computed for `replicas` (default: the replicas left afterwards)."""
+        app_record = self.state_store.get_app(app_name)
+        config = availability.availability_config(app_record.spec or {}) if app_record else None
+        if not config:
+            return None
+        with self._lock:
+            remaining = [inst for inst in self.instances.get(app_name, [])
+                         if inst.state != InstanceState.DOWN and inst not in removing]
+        required = availability.floor(config, len(remaining) if replicas is None else replicas)
+        ready = sum(1 for inst in remaining if inst.state == InstanceState.READY)
+        if ready >= required:
+            return None
+        return (f"{ready} of {len(remaining)} remaining replicas would be ready, below the floor of "
+                f"{required} (minReady {config['minReady']})")
+
+    def _queue_disruption(self, app_name: str, operation: str, reason: str, target: Any, **details):
+        """Hold back an automated operation on target (a replica count or container ID)
+        until the availability floor allows it. Retries of the same operation keep its entry."""
+        with self._lock:
+            queued = self.queued_disruptions.setdefault(app_name, {})
+            entry = queued.get(operation)
+            if entry and entry["target"] == target:
+                entry.update(reason=reason, attempts=entry["attempts"] + 1, **details)
+                return
+            queued[operation] = {"operation": operation, "target": target, "reason": reason,
+                                 "queued_at": time.time(), "attempts": 1, **details}
+        logger.info(f"Queued {operation} of {app_name}: {reason}")
+        self.state_store.log_event(app_name, "disruption_queued",
+                                   {"operation": operation, "reason": reason,
+                                    "target": target[:12] if isinstance(target, str) else target})
+
+    def _dequeue_disruption(self, app_name: str, operation: str):
+        with self._lock:
+            entry = self.queued_disruptions.get(app_name, {}).pop(operation, None)
+        if entry:
+            self.state_store.log_event(app_name, "disruption_resumed", {
+                "operation": operation, "waited_seconds": round(time.time() - entry["queued_at"], 1),
+                "attempts": entry["attempts"]
+            })
+
+    def _retry_queued_disruptions(self):
+        """Retry automated operations held back by an availability floor."""
+        for app_name in list(self.queued_disruptions):
+            for operation, entry in list(self.queued_disruptions.get(app_name, {}).items()):
+                try:
+                    if app_name not in self.instances:
+                        self.queued_disruptions.pop(app_name, None)
+                        break
+                    if operation == "scale_in":
+                        current_replicas = len(self.instances[app_name])
+                        result = self.scale(app_name, entry["target"], automated=True, wait=False)
+                        if result.get("status") == "scaled":
+                            self.state_store.log_event(app_name, "scaled", {
+                                "old_replicas": current_replicas, "new_replicas": entry["target"],
+                                "reason": "queued scale-in resumed"
+                            })
+                    elif operation == "quarantine":
+                        _, instance = self._find_instance(entry["target"])
+                        if not instance or not instance.routable:
+                            # Replaced or recovered in the meantime
+                            self.queued_disruptions.get(app_name, {}).pop(operation, None)
+                            continue
+                        self.quarantine_instance(app_name, instance, entry["quarantine_reason"], wait=False)
+                except Exception as e:
+                    logger.error(f"Error retrying queued {operation} of {app_name}: {e}")
+            if not self.queued_disruptions.get(app_name):
+                self.queued_disruptions.pop(app_name, None)
+
+    def rollout_in_progress(self, app_name: str) -> bool:
+        return (self.rollouts.get(app_name) or {}).get("state") in ("in_progress", "rolling_back")
+
+    @contextmanager
+    def app_operation(self, app_name: str, operation: str, requested_by: Optional[str] = None,
+                      wait: bool = True):
+        """Hold the app's operation lock for the block. Yields None, or the busy result to
+        return instead if the lock could not be taken."""
+        entry, holder = self.operation_locks.acquire(app_name, operation, requested_by, wait)
+        if not entry:
+            yield app_locks.busy_result(app_name, holder)
+            return
+        try:
+            yield None
+        finally:
+            self.operation_locks.release(entry)
+
+    def active_operations(self, app_name: str) -> dict:
+        return self.operation_locks.snapshot(app_name)
+
+    def _record_status(self, app_name: str, status: str, cause: str, details: Optional[dict] = None):
+        """Add a transition to the app's status timeline, naming the operation behind it."""
+        details = dict(details or {})
+        active = self.operation_locks.snapshot(app_name)["active"]
+        if active:
+            details["operation"] = active["operation"]
+            if active.get("requested_by"):
+                details["requested_by"] = active["requested_by"]
+        try:
+            self.timeline.record(app_name, status, cause, details)
+        except Exception as e:
+            logger.warning(f"Failed to record status {status} of {app_name}: {e}")
+
+    def _record_observed_statuses(self):
+        """Record running apps becoming degraded, or recovering, from their replicas' states."""
+        for app in self.state_store.list_apps(status="running"):
+            app_name = app["name"]
+            # Replicas are in flux while an operation (start, scale, rollout...) changes them
+            if self.operation_locks.snapshot(app_name)["active"]:
+                continue
+            with self._lock:
+                instances = list(self.instances.get(app_name, []))
+            status, cause = status_timeline.observe(instances)
+            if self.timeline.record(app_name, status, cause):
+                if status == "degraded":
+                    self.state_store.log_event(app_name, "degraded", {"cause": cause})
+                logger.info(f"{app_name} is {status}: {cause}")
+
+    def _register_running(self, spec: dict, source: Optional[dict] = None) -> dict:
+        """Register spec over a running app and keep its replicas, which register()
+        would otherwise forget while leaving the app stopped."""
+        app_name = spec["metadata"]["name"]
+        with self._lock:
+            instances = self.instances.get(app_name, [])
+            result = self.register(spec, source)
+            if "error" in result:
+                return result
+            self.instances[app_name] = instances
+            record = self.state_store.get_app(app_name)
+            record.status = "running"
+            record.replicas = len([inst for inst in instances if inst.state != InstanceState.DOWN])
+            self.state_store.save_app(record)
+        return result
+
+    def deploy(self, spec: dict, source: Optional[dict] = None, requested_by: Optional[str] = None,
+               ready_timeout: int = rollout.DEFAULT_READY_TIMEOUT_SECONDS,
+               grace_period: Optional[int] = None, wait: bool = True) -> dict:
+        """Register a spec that differs from the app's latest revision only in its image and,
+        if the app is running, replace its replicas one at a time in the background.
+        grace_period overrides the app's terminationGracePeriodSeconds for the old replicas."""
+        return self._start_rollout(spec, source, requested_by, ready_timeout, "image", grace_period=grace_period,
+                                   wait=wait)
+
+    def update_env(self, spec: dict, source: Optional[dict] = None, requested_by: Optional[str] = None,
+                   ready_timeout: int = rollout.DEFAULT_READY_TIMEOUT_SECONDS, restart: bool = True,
+                   grace_period: Optional[int] = None, wait: bool = True) -> dict:
+        """Register a spec that differs from the app's latest revision only in its env and, if
+        the app is running, restart its replicas one at a time in the background. Without
+        restart the change is deferred: only replicas started later get the new env."""
+        return self._start_rollout(spec, source, requested_by, ready_timeout, "env", restart, grace_period, wait)
+
+    def _start_rollout(self, spec: dict, source: Optional[dict], requested_by: Optional[str],
+                       ready_timeout: int, change: str, restart: bool = True,
+                       grace_period: Optional[int] = None, wait: bool = True) -> dict:
+        app_name = spec["metadata"]["name"]
+        # The rollout thread takes over the app's lock and holds it until the rollout finishes
+        entry, holder = self.operation_locks.acquire(app_name, change, requested_by, wait)
+        if not entry:
+            return app_locks.busy_result(app_name, holder)
+        try:
+            result = self._begin_rollout(app_name, spec, source, requested_by, ready_timeout, change,
+                                         restart, grace_period, entry)
+        except Exception:
+            self.operation_locks.release(entry)
+            raise
+        if result.get("status") != "rolling_out":
+            self.operation_locks.release(entry)
+        return result
+
+    def _begin_rollout(self, app_name: str, spec: dict, source: Optional[dict], requested_by: Optional[str],
+                       ready_timeout: int, change: str, restart: bool, grace_period: Optional[int],
+                       entry: dict) -> dict:
+        image = spec["spec"].get("image")
+        with self._lock:
+            if self.rollout_in_progress(app_name):
+                return {"error": f"A rollout of {app_name} is already in progress"}
+            record = self.state_store.get_app(app_name)
+            if not record:
+                return {"error": f"App {app_name} not found"}
+            if change == "image" and process_runtime.is_process(record.spec):
+                return {"error": f"{app_name} runs a process, not an image; register a new command instead"}
+            previous = self.state_store.get_app_revision(app_name)
+            if not previous:
+                return {"error": f"App {app_name} has no recorded revision to update"}
+
+            if record.status != "running" or not restart:
+                result = self._register_running(spec, source) if record.status == "running" else self.register(spec, source)
+                if "error" in result:
+                    return result
+                return {"status": "registered", "app": app_name, "revision": result["revision"],
+                        "image": image, "rollout": None}
+
+            live = [inst for inst in self.instances.get(app_name, []) if inst.state != InstanceState.DOWN]
+            # Journaled before the new spec is registered, so a crash at any point can be recovered
+            journal_id = self.journal.begin(app_name, change, {
+                "image": image, "previous_image": record.spec.get("image"), "previous_revision": previous["revision"],
+                "replicas": len(live), "replace": [inst.container_id for inst in live] if change == "env" else None,
+                "ready_timeout": ready_timeout, "grace_period": grace_period
+            }, requested_by)
+            result = self._register_running(spec, source)
+            if "error" in result:
+                self.journal.finish(journal_id, "failed", {"error": result["error"]})
+                return result
+            self.journal.step(journal_id, "registered", revision=result["revision"])
+            progress = rollout.new_rollout(app_name, result["revision"], image, record.spec.get("image"),
+                                           len(live), requested_by, change, grace_period)
+            progress["journal_id"] = journal_id
+            self.rollouts[app_name] = progress
+
+        self.state_store.log_event(app_name, "rollout_started", {
+            "revision": progress["revision"], "change": change, "image": image,
+            "previous_image": progress["previous_image"], "requested_by": requested_by
+        })
+        # An image rollout replaces the replicas on another image; an env rollout has no such
+        # marker, so it replaces the replicas that were live when it started
+        self.operation_locks.hand_off(entry)
+        threading.Thread(
+            target=self._roll_out, args=(app_name, progress, previous["spec"], ready_timeout,
+                                         live if change == "env" else None, entry),
+            daemon=True, name=f"rollout-{app_name}"
+        ).start()
+        return {"status": "rolling_out", "app": app_name, "revision": progress["revision"],
+                "image": image, "rollout": dict(progress)}
+
+    def _roll_out(self, app_name: str, progress: dict, previous_spec: dict, ready_timeout: int,
+                  replace: Optional[list] = None, lock_entry: Optional[dict] = None,
+                  failed: Optional[str] = None):
+        """Replace an app's replicas with the current spec, rolling back to previous_spec if
+        a new replica does not become ready. replace lists the replicas to restart when the
+        image does not change. lock_entry is the app's operation lock, released when done.
+        With failed (why the rollout failed), only the rollback is carried out."""
+        change = progress["image"] if progress.get("change", "image") == "image" else f"revision {progress['revision']}"
+        journal_id = progress.get("journal_id")
+        if lock_entry:
+            self.operation_locks.adopt(lock_entry)
+        try:
+            record = self.state_store.get_app(app_name)
+            error = failed or self._replace_replicas(app_name, record.spec, progress, ready_timeout, replace,
+                                                     None if replace is None else "the new env")
+            if not error:
+                progress.update(state="succeeded", finished_at=time.time())
+                self.journal.finish(journal_id, "completed", {"replaced": progress["replaced"]})
+                self.state_store.log_event(app_name, "rollout_completed", {
+                    "revision": progress["revision"], "change": progress.get("change", "image"),
+                    "image": progress["image"], "replaced": progress["replaced"]
+                })
+                logger.info(f"Rolled out {change} to {progress['replaced']} replicas of {app_name}")
+                return
+
+            logger.error(f"Rollout of {change} to {app_name} failed, rolling back: {error}")
+            progress.update(state="rolling_back", error=error)
+            if not failed:
+                self.journal.step(journal_id, "rolling_back", error=error)
+            result = self._register_running(previous_spec, {"rolled_back_from": progress["revision"]})
+            if "error" in result:
+                rollback_error = result["error"]
+            else:
+                self.journal.step(journal_id, "rollback_registered", revision=result["revision"])
+                record = self.state_store.get_app(app_name)
+                restarted = None
+                if replace is not None:
+                    # The replicas this rollout started are the ones still running the new env
+                    with self._lock:
+                        restarted = [inst for inst in self.instances.get(app_name, [])
+                                     if inst.state != InstanceState.DOWN and inst not in replace]
+                rollback = {"replaced": 0, "grace_period": progress.get("grace_period"), "journal_id": journal_id}
+                rollback_error = self._replace_replicas(app_name, record.spec, rollback, ready_timeout,
+                                                        restarted, None if replace is None else "the previous env")
+            progress.update(state="failed", rolled_back=not rollback_error, finished_at=time.time())
+            if rollback_error:
+                progress["error"] = f"{error}; rollback failed: {rollback_error}"
+            self.journal.finish(journal_id, "failed" if rollback_error else "rolled_back", {"error": progress["error"]})
+            self.alerts.notify(
+                app_name, "rollout_failed",
+                f"Rollout of {change} to {app_name} failed: {progress['error']}",
+                {"revision": progress["revision"], "image": progress["image"],
+                 "error": progress["error"], "rolled_back": progress["rolled_back"]},
+                severity="critical" if rollback_error else "warning"
+            )
+        except Exception as e:
+            logger.error(f"Rollout of {app_name} failed: {e}")
+            progress.update(state="failed", error=str(e), finished_at=time.time())
+            self.journal.finish(journal_id, "failed", {"error": str(e)})
+        finally:
+            if lock_entry:
+                self.operation_locks.release(lock_entry)
+
+    def recover_operations(self) -> Dict[str, int]:
+        """Replay or roll back the scales and rollouts a previous leader left unfinished in
+        the operation journal. Call after reconciliation. Returns the entries handled, by outcome."""
+        summary: Dict[str, int] = {}
+        for entry in self.journal.unfinished():
+            try:
+                outcome = self._recover_operation(entry)
+            except Exception as e:
+                logger.error(f"Failed to recover {entry['operation']} of {entry['app']} ({entry['id']}): {e}")
+                self.journal.finish(entry["id"], "failed", {"error": f"recovery failed: {e}"})
+                outcome = "failed"
+            summary[outcome] = summary.get(outcome, 0) + 1
+        return summary
+
+    def _recover_operation(self, entry: dict) -> str:
+        app_name, intent = entry["app"], entry["intent"]
+        record = self.state_store.get_app(app_name)
+        if not record or record.status != "running" or app_name not in self.instances:
+            self.journal.finish(entry["id"], "abandoned", {"reason": f"{app_name} is no longer running"})
+            return "abandoned"
+
+        self.journal.adopt(entry["id"])
+        if entry["operation"] == "scale":
+            logger.info(f"Replaying interrupted scale of {app_name} to {intent['to']} replicas")
+            self.state_store.log_event(app_name, "operation_recovered", {
+                "journal_id": entry["id"], "operation": "scale", "action": "replay", "replicas": intent["to"]
+            })
+            result = self.scale(app_name, intent["to"], automated=intent.get("automated", False),
+                                grace_period=intent.get("grace_period"),
+                                requested_by=operation_journal.RECOVERY_REQUESTER)
+            self.journal.finish(entry["id"], "failed" if "error" in result else "replayed", result)
+            return "failed" if "error" in result else "replayed"
+        return self._recover_rollout(entry, record)
+
+    def _recover_rollout(self, entry: dict, record: AppRecord) -> str:
+        """Resume an interrupted rollout in the background, or finish its rollback."""
+        app_name, intent, change = entry["app"], entry["intent"], entry["operation"]
+        previous = self.state_store.get_app_revision(app_name, intent["previous_revision"])
+        latest = self.state_store.get_app_revision(app_name)
+        registered = operation_journal.steps_named(entry, "registered")
+        if not previous or not latest or latest["revision"] == intent["previous_revision"]:
+            self.journal.finish(entry["id"], "abandoned", {"reason": "the new spec was never registered"})
+            return "abandoned"
+        ours = {step["revision"] for step in registered + operation_journal.steps_named(entry, "rollback_registered")}
+        if registered and latest["revision"] not in ours:
+            self.journal.finish(entry["id"], "abandoned",
+                                {"reason": f"superseded by revision {latest['revision']}"})
+            return "abandoned"
+
+        # A replica started but not swapped in yet is the step that was half done: take it out
+        started = {step["container"] for step in operation_journal.steps_named(entry, "started")}
+        finished = {step["new"] for step in operation_journal.steps_named(entry, "replaced")} | \
+            {step["container"] for step in operation_journal.steps_named(entry, "discarded")}
+        grace = termination.grace_period(record.spec, intent.get("grace_period"))
+        with self._lock:
+            half_done = [inst for inst in self.instances.get(app_name, []) if inst.container_id in started - finished]
+            for instance in half_done:
+                instance.transition(InstanceState.DRAINING, "interrupted rollout step")
+                self.instances[app_name].remove(instance)
+            if half_done:
+                self._update_nginx_config(app_name)
+        for instance in half_done:
+            self._stop_container(instance, grace)
+            self.journal.step(entry["id"], "discarded", container=instance.container_id)
+
+        rolling_back = operation_journal.steps_named(entry, "rolling_back")
+        failed = rolling_back[-1]["error"] if rolling_back else None
+        progress = rollout.new_rollout(app_name, latest["revision"], intent["image"], intent["previous_image"],
+                                       intent["replicas"], entry.get("requested_by"), change,
+                                       intent.get("grace_period"))
+        progress.update(journal_id=entry["id"], recovered=True,
+                        replaced=0 if failed else len(operation_journal.steps_named(entry, "replaced")))
+        replace = None
+        if intent.get("replace") is not None:
+            with self._lock:
+                replace = [inst for inst in self.instances.get(app_name, [])
+                           if inst.container_id in intent["replace"]]
+
+        lock_entry, _ = self.operation_locks.acquire(app_name, change, operation_journal.RECOVERY_REQUESTER)
+        with self._lock:
+            self.rollouts[app_name] = progress
+        action = "roll_back" if failed else "resume"
+        logger.info(f"Recovering interrupted {change} rollout of {app_name} to revision {latest['revision']}: {action}")
+        self.state_store.log_event(app_name, "operation_recovered", {
+            "journal_id": entry["id"], "operation": change, "action": action, "revision": latest["revision"],
+            "discarded": len(half_done)
+        })
+        self.operation_locks.hand_off(lock_entry)
+        threading.Thread(
+            target=self._roll_out, args=(app_name, progress, previous["spec"], intent["ready_timeout"],
+                                         replace, lock_entry, failed),
+            daemon=True, name=f"rollout-{app_name}"
+        ).start()
+        return "rolled_back" if failed else "resumed"
+
+    def _replace_replicas(self, app_name: str, app_spec: dict, progress: dict, ready_timeout: int,
+                          replace: Optional[list] = None, label: Optional[str] = None) -> Optional[str]:
+        """Replace every replica not running app_spec's image (or every replica in replace),
+        one at a time, keeping the old replica in nginx until its replacement is ready.
+        Returns an error message on failure."""
+        image = app_spec.get("image")
+        label = label or image
+        grace = termination.grace_period(app_spec, progress.get("grace_period"))
+        with self._lock:
+            if replace is None:
+                stale = [inst for inst in self.instances.get(app_name, [])
+                         if inst.state != InstanceState.DOWN and self._instance_image(inst) != image]
+            else:
+                stale = [inst for inst in replace if inst.state != InstanceState.DOWN]
+
+        for old in stale:
+            if self._shutdown:
+                return "the controller is shutting down"
+            with self._lock:
+                new = self._start_container(app_name, app_spec, self._next_replica_index(app_name))
+            if not new:
+                return f"Failed to start a replica with {label}"
+            self.journal.step(progress.get("journal_id"), "started", container=new.container_id)
+
+            wait_error = self._wait_until_ready(new, ready_timeout)
+            if wait_error:
+                with self._lock:
+                    if new in self.instances.get(app_name, []):
+                        self.instances[app_name].remove(new)
+                    new.transition(InstanceState.DRAINING, "rollout failed")
+                    self._update_nginx_config(app_name)
+                self._stop_container(new, grace)
+                self.journal.step(progress.get("journal_id"), "discarded", container=new.container_id)
+                return f"Replica {new.container_id[:12]} with {label} {wait_error}"
+
+            # Other replicas may have failed meanwhile; wait until the old one can go without
+            # breaking the availability floor
+            deadline = time.time() + ready_timeout
+            blocked = self._availability_blocked(app_name, [old])
+            while blocked and time.time() < deadline and not self._shutdown:
+                self._queue_disruption(app_name, "rollout", blocked, old.container_id)
+                time.sleep(2)
+                blocked = self._availability_blocked(app_name, [old])
+            if blocked:
+                self.queued_disruptions.get(app_name, {}).pop("rollout", None)
+                return f"Replica {old.container_id[:12]} could not be replaced within {ready_timeout}s: {blocked}"
+            self._dequeue_disruption(app_name, "rollout")
+
+            with self._lock:
+                old.transition(InstanceState.DRAINING, f"replaced by {label}")
+                if old in self.instances.get(app_name, []):
+                    self.instances[app_name].remove(old)
+                self._update_nginx_config(app_name)
+            self._stop_container(old, grace)
+            self.journal.step(progress.get("journal_id"), "replaced", old=old.container_id, new=new.container_id)
+            progress["replaced"] += 1
+        return None
+
+    def _wait_until_ready(self, instance: ContainerInstance, timeout: int) -> Optional[str]:
+        """Wait for a new replica to pass its health check. Returns why it did not, or None."""
+        deadline = time.time() + timeout
+        while time.time() < deadline and not self._shutdown:
+            if instance.state == InstanceState.READY:
+                return None
+            if instance.state in (InstanceState.DOWN, InstanceState.DRAINING):
+                return f"stopped before it became ready ({instance.state_reason})"
+            time.sleep(1)
+        return f"did not become ready within {timeout}s ({instance.state.value}: {instance.state_reason})"
+
+    def _instance_image(self, instance: ContainerInstance) -> Optional[str]:
+        try:
+            return self.docker_client.containers.get(instance.container_id).attrs["Config"]["Image"]
+        except Exception:
+            return None
+
+    def _stop_container(self, instance: ContainerInstance,
+                        grace_period: int = termination.DEFAULT_GRACE_PERIOD_SECONDS):
+        """Stop and remove a single container, giving it grace_period seconds to exit after SIGTERM."""
         try:
             container = self.docker_client.containers.get(instance.container_id)
-            container.stop(timeout=30)
+            container.stop(timeout=grace_period)
             container.remove()
+            instance.transition(InstanceState.DOWN, "stopped")
 
             # Remove from health checker
             self.health_checker.remove_target(instance.container_id)
@@ -590,6 +1987,142 @@ class AppManager:
         except Exception as e:
             logger.warning(f"Failed to stop container {instance.container_id}: {e}")
 
+    def shadow_active(self, app_name: Optional[str]) -> bool:
+        return (self.shadows.get(app_name) or {}).get("state") in ("starting", "mirroring")
+
+    def start_shadow(self, app_name: str, image: str, percent: float, replicas: int = 1,
+                     requested_by: Optional[str] = None) -> dict:
+        """Start replicas of a running app with another image in the background and, once
+        they run, mirror percent of the app's requests to them."""
+        with self._lock:
+            if self.shadow_active(app_name):
+                return {"error": f"{app_name} already has a shadow of {self.shadows[app_name]['image']}"}
+            if self.rollout_in_progress(app_name):
+                return {"error": f"A rollout of {app_name} is in progress"}
+            record = self.state_store.get_app(app_name)
+            if not record:
+                return {"error": f"App {app_name} not found"}
+            if record.status != "running" or not self.instances.get(app_name):
+                return {"error": f"App {app_name} is not running"}
+            if process_runtime.is_process(record.spec):
+                return {"error": f"{app_name} runs a process, not an image"}
+            error = shadow.validate(record.spec, percent, replicas)
+            if error:
+                return {"error": error}
+
+            latest = self.state_store.get_app_revision(app_name)
+            progress = shadow.new_shadow(app_name, latest["revision"] if latest else None, image,
+                                         record.spec.get("image"), percent, replicas, requested_by)
+            self.shadows[app_name] = progress
+            candidate = copy.deepcopy(record.spec)
+            candidate["image"] = image
+
+        self.state_store.log_event(app_name, "shadow_started", {
+            "image": image, "percent": percent, "replicas": replicas, "requested_by": requested_by
+        })
+        threading.Thread(target=self._run_shadow, args=(app_name, progress, candidate),
+                         daemon=True, name=f"shadow-{app_name}").start()
+        return {"status": "starting", "app": app_name, "shadow": dict(progress)}
+
+    def _run_shadow(self, app_name: str, progress: dict, candidate: dict):
+        """Start the shadow replicas, then route mirrored traffic to them."""
+        self._remove_shadow_containers(app_name)  # left over from a shadow a crashed leader ran
+        started = []
+        error = None
+        try:
+            self.docker_client.images.get(progress["image"])
+        except docker.errors.ImageNotFound:
+            try:
+                self.docker_client.images.pull(progress["image"])
+            except Exception as e:
+                error = f"Failed to pull {progress['image']}: {e}"
+        except Exception as e:
+            error = f"Failed to look up {progress['image']}: {e}"
+        for index in range(0 if error else progress["replicas"]):
+            try:
+                started.append(self._start_shadow_replica(app_name, candidate, index))
+            except Exception as e:
+                error = f"Failed to start shadow replica {index} with {progress['image']}: {e}"
+                break
+
+        with self._lock:
+            if progress["state"] == "starting" and not error:
+                progress.update(state="mirroring", mirroring_since=time.time())
+                self._shadow_replicas[app_name] = started
+                self._update_nginx_config(app_name)
+                logger.info(f"Mirroring {progress['percent']:g}% of {app_name} requests to "
+                            f"{len(started)} shadow replica(s) of {progress['image']}")
+                return
+            if error:
+                progress.update(state="failed", error=error, stopped_at=time.time())
+        # Failed, or stopped while the replicas were starting
+        self._remove_shadow_containers(app_name)
+        if error:
+            logger.error(error)
+            self.state_store.log_event(app_name, "shadow_failed", {"image": progress["image"], "error": error},
+                                       severity="warning")
+
+    def _start_shadow_replica(self, app_name: str, app_spec: dict, index: int) -> ContainerInstance:
+        container_config, _ = self._container_config(app_name, app_spec, index)
+        container_config["name"] = f"{app_name}-shadow-{index}"
+        labels = container_config["labels"]
+        labels.pop("orchestry.app")
+        labels[shadow.SHADOW_LABEL] = app_name
+        container = self._create_and_start(container_config)
+        ip, port = process_runtime.instance_address(container, app_spec["ports"][0]["containerPort"])
+        return ContainerInstance(container_id=container.id, ip=ip, port=port, state=InstanceState.READY,
+                                 last_seen=time.time())
+
+    def stop_shadow(self, app_name: str, reason: str = "stopped", requested_by: Optional[str] = None) -> dict:
+        """Stop mirroring traffic to an app's shadow and remove its replicas, keeping the
+        final comparison in the shadow's record."""
+        with self._lock:
+            progress = self.shadows.get(app_name)
+            if not self.shadow_active(app_name):
+                return {"error": f"{app_name} has no active shadow"}
+            if progress["state"] == "mirroring":
+                progress["comparison"] = self._compare_shadow(app_name, progress)
+            progress.update(state="stopped", stopped_at=time.time())
+            if self._shadow_replicas.pop(app_name, None) and app_name in self.instances:
+                self._update_nginx_config(app_name)
+
+        self._remove_shadow_containers(app_name)
+        self.state_store.log_event(app_name, "shadow_stopped", {
+            "image": progress["image"], "reason": reason, "requested_by": requested_by,
+            "verdict": (progress["comparison"] or {}).get("verdict")
+        })
+        logger.info(f"Stopped the shadow of {app_name} ({reason})")
+        return {"status": "stopped", "app": app_name, "shadow": dict(progress)}
+
+    def shadow_report(self, app_name: str) -> Optional[dict]:
+        """An app's latest shadow with the comparison of its responses against the app's
+        (live while mirroring, final once stopped). None if there was none."""
+        progress = self.shadows.get(app_name)
+        if not progress:
+            return None
+        report = dict(progress)
+        if progress["state"] == "mirroring":
+            report["comparison"] = self._compare_shadow(app_name, progress)
+        return report
+
+    def _compare_shadow(self, app_name: str, progress: dict) -> dict:
+        seconds = shadow.comparison_window(progress)
+        return dict(shadow.compare(self.nginx.get_response_stats(app_name, seconds),
+                                   self.nginx.get_response_stats(app_name, seconds, shadow=True)),
+                    window_seconds=seconds)
+
+    def _remove_shadow_containers(self, app_name: str):
+        for container in self.docker_client.containers.list(all=True, filters={"label": f"{shadow.SHADOW_LABEL}={app_name}"}):
+            self._remove_container(container)
+
+    def _remove_container(self, container: Any):
+        try:
+            if container.status == "running":
+                container.stop(timeout=10)
+            container.remove()
+        except Exception as e:
+            logger.warning(f"Failed to remove container {container.name}: {e}")
+
     def _update_container_stats(self, app_name: str):
         """Update CPU and memory statistics for all containers of an app."""
         if app_name not in self.instances:
@@ -603,7 +2136,7 @@ class AppManager:
                 container.reload()  # Refresh container state
                 if container.status != "running":
                     logger.info(f"Container {instance.container_id[:12]} is {container.status}, marking as down")
-                    instance.state = "down"
+                    instance.transition(InstanceState.DOWN, f"container {container.status}")
                     instance.cpu_percent = 0.0
                     instance.memory_percent = 0.0
                     continue
@@ -655,16 +2188,29 @@ class AppManager:
                 else:
                     instance.memory_percent = 0.0
 
+                if time.time() - instance.disk_checked_at >= DISK_STATS_INTERVAL_SECONDS:
+                    instance.disk_usage_bytes = self._container_disk_usage(instance.container_id)
+                    instance.disk_checked_at = time.time()
+
                 instance.last_seen = time.time()
 
             except Exception as e:
                 # Container is likely stopped or removed
                 logger.info(f"Container {instance.container_id[:12]} is no longer accessible: {e}")
-                instance.state = "down"
+                instance.transition(InstanceState.DOWN, "container no longer accessible")
                 instance.cpu_percent = 0.0
                 instance.memory_percent = 0.0
                 instance.failures += 1
 
+    def _container_disk_usage(self, container_id: str) -> int:
+        """Bytes written to a container's writable layer (tmpfs mounts count as memory instead)."""
+        try:
+            containers = self.docker_client.api.containers(all=True, size=True, filters={"id": container_id})
+            return int(containers[0].get("SizeRw") or 0) if containers else 0
+        except Exception as e:
+            logger.debug(f"Could not read disk usage for {container_id[:12]}: {e}")
+            return 0
+
     def _cleanup_down_containers(self, app_name: str):
         """Remove down containers from tracking after a grace period."""
         if app_name not in self.instances:
@@ -675,7 +2221,7 @@ class AppManager:
         containers_to_remove = []
 
         for i, instance in enumerate(self.instances[app_name]):
-            if instance.state == "down":
+            if instance.state == InstanceState.DOWN:
                 # If it's been down for more than 30 seconds, remove it from tracking
                 if hasattr(instance, 'last_seen') and (current_time - instance.last_seen) > 30:
                     containers_to_remove.append(i)
@@ -696,11 +2242,15 @@ class AppManager:
     def _update_nginx_config(self, app_name: str):
         """Update nginx configuration with current healthy instances."""
         logger.info(f"Updating nginx config for {app_name}")
+        app_record = self.state_store.get_app(app_name)
 
         with self._lock:
             if app_name not in self.instances:
+                if self._serve_without_replicas(app_name, app_record):
+                    return
                 # No instances, remove config
                 logger.info(f"No instances found for {app_name}, removing nginx config")
+                self._lb_observed(app_name, False, "NoReplicas", "No replicas are running, nginx does not route the app")
                 try:
                     self.nginx.remove_app_config(app_name)
                 except Exception as e:
@@ -709,71 +2259,323 @@ class AppManager:
 
             # Filter for healthy instances
             healthy_servers = []
+            weights = self.latency_weights.get(app_name)
+            ramp = self._ramp_weights(app_name, app_record.spec or {}) if app_record else {}
+            max_conns = concurrency.max_conns(app_record.spec or {}) if app_record else None
+            if ramp:
+                self.ramp_weights[app_name] = ramp
+            else:
+                self.ramp_weights.pop(app_name, None)
             logger.info(f"Checking {len(self.instances[app_name])} instances for {app_name}")
 
             for instance in self.instances[app_name]:
-                # Check both container state and health check status
-                container_ready = instance.state == "ready"
-                health_check_passed = self.health_checker.is_healthy(instance.container_id)
-
-                logger.debug(f"Instance {instance.container_id[:12]} - IP: {instance.ip}, Port: {instance.port}, Ready: {container_ready}, Health: {health_check_passed}")
-
-                # If health checking is configured, require both conditions
-                # If no health checking, just use container state
-                app_spec_record = self.state_store.get_app(app_name)
-                has_health_config = (app_spec_record and 
-                               app_spec_record.spec.get("health") is not None)
-
-                if has_health_config:
-                    # Health checking is configured
-                    health_status = self.health_checker.get_health_status(instance.container_id)
-
-                    # Allow ready containers if:
-                    # 1. Health check passed, OR
-                    # 2. Container is ready but health check hasn't started yet (within initial delay)
-                    if health_check_passed:
-                        healthy_servers.append({
-                            "ip": instance.ip,
-                            "port": instance.port
-                        })
-                        logger.info(f"Added healthy server {instance.ip}:{instance.port} for {app_name} (health check passed)")
-                    elif container_ready and (health_status is None or not hasattr(health_status, 'last_check') or health_status.last_check == 0):
-                        # Container is ready and health check hasn't started yet - allow it during initial delay
-                        healthy_servers.append({
-                            "ip": instance.ip,
-                            "port": instance.port
-                        })
-                        logger.info(f"Added ready server {instance.ip}:{instance.port} for {app_name} (health check pending)")
-                    else:
-                        logger.debug(f"Skipping server {instance.ip}:{instance.port} for {app_name} - not healthy (ready: {container_ready}, health: {health_check_passed})")
+                # Only ready instances receive traffic; starting, unhealthy and draining ones are held back
+                if instance.routable:
+                    server = {
+                        "ip": instance.ip,
+                        "port": instance.port
+                    }
+                    upstream = f"{instance.ip}:{instance.port}"
+                    if upstream in ramp:
+                        server["weight"] = ramp[upstream]
+                    elif weights or ramp:
+                        server["weight"] = (weights or {}).get(upstream, latency_weights.MAX_WEIGHT)
+                    if max_conns:
+                        server["max_conns"] = max_conns
+                    healthy_servers.append(server)
+                    logger.info(f"Added ready server {instance.ip}:{instance.port} for {app_name}")
                 else:
-                    # No health checking configured, just use ready state
-                    if container_ready:
-                        healthy_servers.append({
-                            "ip": instance.ip,
-                            "port": instance.port
-                        })
-                        logger.info(f"Added ready server {instance.ip}:{instance.port} for {app_name}")
+                    logger.debug(f"Skipping server {instance.ip}:{instance.port} for {app_name} - {instance.state.value}")
+
+            mirror = None
+            if self._shadow_replicas.get(app_name):
+                mirror = shadow.nginx_context(app_name, self.shadows[app_name]["percent"], [
+                    {"ip": inst.ip, "port": inst.port} for inst in self._shadow_replicas[app_name]
+                ])
 
         if healthy_servers:
             logger.info(f"Updating nginx config for {app_name} with {len(healthy_servers)} healthy servers")
             try:
-                result = self.nginx.update_upstreams(app_name, healthy_servers)
+                tracing = bool(app_record and (app_record.spec.get("tracing") or {}).get("enabled"))
+                try:
+                    auth = self.edge_auth.prepare(app_name, app_record.spec.get("auth") if app_record else None)
+                except Exception as e:
+                    # Never expose an app that asked for authentication without it
+                    logger.error(f"Edge auth for {app_name} cannot be configured, not routing traffic: {e}")
+                    self._lb_observed(app_name, False, "EdgeAuthFailed",
+                                      f"Authentication cannot be configured, nginx does not route the app: {e}")
+                    self.nginx.remove_app_config(app_name)
+                    return
+                try:
+                    tls = self.edge_tls.prepare(app_name, app_record.spec.get("tls") if app_record else None)
+                except Exception as e:
+                    # nginx keeps serving the app with its previous config and certificate
+                    logger.error(f"TLS for {app_name} cannot be configured, keeping its current nginx config: {e}")
+                    self._lb_observed(app_name, False, "TLSFailed",
+                                      f"TLS cannot be configured, nginx keeps the app's previous config: {e}")
+                    return
+                access = ip_access.render_context(app_record.spec) if app_record else None
+                pages = None
+                if app_record and not udp.is_udp(app_record.spec):
+                    pages = self._error_pages_context(app_name, app_record)
+                if app_record and udp.is_udp(app_record.spec):
+                    listen_port = udp.assign_listen_port(self.state_store, app_name, app_record.spec)
+                    if listen_port is None:
+                        self._lb_observed(app_name, False, "NoListenPort", "No UDP listen port is free on nginx")
+                        return
+                    result = self.nginx.update_stream_upstreams(
+                        app_name, healthy_servers, udp.stream_context(app_record.spec, listen_port), access=access,
+                        passive=passive_health.nginx_context(app_record.spec)
+                    )
+                else:
+                    result = self.nginx.update_upstreams(app_name, healthy_servers, tracing=tracing, auth=auth,
+                                                         access=access, shadow=mirror, error_pages=pages, tls=tls,
+                                                         access_log=log_sampling.nginx_context(
+                                                             app_name, app_record.spec.get("accessLog") if app_record else None),
+                                                         passive=passive_health.nginx_context(
+                                                             app_record.spec if app_record else {}),
+                                                         headers=edge_headers.nginx_context(
+                                                             app_record.spec.get("headers") if app_record else None))
                 if result:
                     logger.info(f"Successfully updated nginx config for {app_name}")
+                    self._lb_observed(app_name, True, "Configured",
+                                      f"nginx routes the app to {len(healthy_servers)} ready replica(s)")
                 else:
                     logger.error(f"Failed to update nginx config for {app_name} - update_upstreams returned False")
+                    self._lb_observed(app_name, False, "ConfigRejected",
+                                      "nginx rejected the new config and keeps the previous one")
             except Exception as e:
                 logger.error(f"Exception updating nginx config for {app_name}: {e}")
-        else:
+                self._lb_observed(app_name, False, "UpdateFailed", f"Updating the nginx config failed: {e}")
+        elif not self._serve_without_replicas(app_name, app_record):
             logger.warning(f"No healthy servers found for {app_name}, removing nginx config")
+            self._lb_observed(app_name, False, "NoReadyReplicas", "No replicas are ready, nginx does not route the app")
             try:
                 self.nginx.remove_app_config(app_name)
             except Exception as e:
                 logger.error(f"Failed to remove nginx config for {app_name}: {e}")
 
-    def cleanup_orphaned_containers(self):
-        """Clean up containers that are not tracked in our state."""
+    def _lb_observed(self, app_name: str, configured: bool, reason: str, message: str):
+        """Record the outcome of an nginx config update for the app's LBConfigured condition."""
+        previous = self.lb_states.get(app_name)
+        same = previous and (previous["configured"], previous["reason"]) == (configured, reason)
+        self.lb_states[app_name] = {"configured": configured, "reason": reason, "message": message,
+                                    "at": previous["at"] if same else time.time()}
+
+    def _error_pages_context(self, app_name: str, app_record: AppRecord) -> Optional[dict]:
+        """Write an app's error pages and maintenance page for nginx and return their
+        template context, or None if nginx should use its own error output."""
+        maintenance = self.maintenance.get(app_name)
+        files = error_pages.page_files(app_name, (app_record.spec or {}).get("errorPages"), maintenance)
+        if not files:
+            self.nginx.remove_error_pages(app_name)
+            return None
+        directory = self.nginx.write_error_pages(app_name, files)
+        return error_pages.nginx_context(directory, files, bool(maintenance))
+
+    def _serve_without_replicas(self, app_name: str, app_record: Optional[AppRecord]) -> bool:
+        """Keep an app without ready replicas answering 503 with its maintenance or 503 page.
+        Returns False if its nginx config should be removed instead."""
+        if not app_record or udp.is_udp(app_record.spec or {}):
+            return False
+        try:
+            pages = self._error_pages_context(app_name, app_record)
+            if not error_pages.serves_without_replicas(pages):
+                return False
+            tls = self.edge_tls.prepare(app_name, app_record.spec.get("tls"))
+            sampling = log_sampling.nginx_context(app_name, app_record.spec.get("accessLog"))
+            if self.nginx.update_upstreams(app_name, [], access=ip_access.render_context(app_record.spec),
+                                           error_pages=pages, tls=tls, access_log=sampling,
+                                           headers=edge_headers.nginx_context(app_record.spec.get("headers"))):
+                logger.info(f"No ready replicas for {app_name}, nginx answers with its "
+                            f"{'maintenance' if pages['maintenance'] else '503'} page")
+                self._lb_observed(app_name, True, "ServingErrorPage",
+                                  f"No replicas are ready, nginx answers with the app's "
+                                  f"{'maintenance' if pages['maintenance'] else '503'} page")
+                return True
+        except Exception as e:
+            logger.error(f"Failed to render error pages for {app_name}: {e}")
+        return False
+
+    def get_access_rules(self, app_name: str) -> dict:
+        """Get an app's IP allow/deny lists."""
+        app_record = self.state_store.get_app(app_name)
+        if not app_record:
+            return {"error": f"App {app_name} not found"}
+        return {
+            "app": app_name,
+            "allowFrom": app_record.spec.get("allowFrom") or [],
+            "denyFrom": app_record.spec.get("denyFrom") or [],
+            "probe": ip_access.probe_networks()
+        }
+
+    def set_access_rules(self, app_name: str, allow_from: list, deny_from: list) -> dict:
+        """Replace an app's IP allow/deny lists and apply them to nginx right away."""
+        app_record = self.state_store.get_app(app_name)
+        if not app_record:
+            return {"error": f"App {app_name} not found"}
+
+        rules, error = ip_access.validate_access_rules(allow_from, deny_from)
+        if error:
+            return {"error": error}
+
+        app_record.spec.update(rules)
+        app_record.updated_at = time.time()
+        if not self.state_store.save_app(app_record):
+            return {"error": f"Failed to save access rules for {app_name}"}
+
+        self.state_store.log_event(app_name, "access_rules_updated", rules)
+        if self.instances.get(app_name):
+            self._update_nginx_config(app_name)
+
+        logger.info(f"Updated access rules for {app_name}: allow={rules['allowFrom']} deny={rules['denyFrom']}")
+        return self.get_access_rules(app_name)
+
+    def get_log_sampling(self, app_name: str) -> dict:
+        """How much of an app's traffic nginx writes to its access log."""
+        app_record = self.state_store.get_app(app_name)
+        if not app_record:
+            return {"error": f"App {app_name} not found"}
+        return {"app": app_name, "accessLog": log_sampling.describe(app_record.spec.get("accessLog"))}
+
+    def set_log_sampling(self, app_name: str, config: dict, requested_by: Optional[str] = None) -> dict:
+        """Replace an app's `accessLog` section and apply it to nginx right away."""
+        app_record = self.state_store.get_app(app_name)
+        if not app_record:
+            return {"error": f"App {app_name} not found"}
+        if udp.is_udp(app_record.spec):
+            return {"error": "Access log sampling is only supported for HTTP apps"}
+
+        sampling, error = log_sampling.validate_access_log(config)
+        if error:
+            return {"error": error}
+        app_record.spec.pop("accessLog", None)
+        if sampling:
+            app_record.spec["accessLog"] = sampling
+        app_record.updated_at = time.time()
+        if not self.state_store.save_app(app_record):
+            return {"error": f"Failed to save access log sampling for {app_name}"}
+
+        self.state_store.log_event(app_name, "log_sampling_updated",
+                                   {**log_sampling.describe(sampling), "requested_by": requested_by})
+        if self.instances.get(app_name):
+            self._update_nginx_config(app_name)
+        logger.info(f"Updated access log sampling for {app_name}: {log_sampling.describe(sampling)}")
+        return self.get_log_sampling(app_name)
+
+    def get_header_rules(self, app_name: str) -> dict:
+        """The headers nginx adds, replaces and removes for an app."""
+        app_record = self.state_store.get_app(app_name)
+        if not app_record:
+            return {"error": f"App {app_name} not found"}
+        return {"app": app_name, "headers": edge_headers.describe(app_record.spec.get("headers"))}
+
+    def set_header_rules(self, app_name: str, config: dict, requested_by: Optional[str] = None) -> dict:
+        """Replace an app's `headers` section and apply it to nginx right away."""
+        app_record = self.state_store.get_app(app_name)
+        if not app_record:
+            return {"error": f"App {app_name} not found"}
+        if udp.is_udp(app_record.spec):
+            return {"error": "Header rules are only supported for HTTP apps"}
+
+        rules, error = edge_headers.validate_headers(config)
+        if error:
+            return {"error": error}
+        app_record.spec.pop("headers", None)
+        if rules:
+            app_record.spec["headers"] = rules
+        app_record.updated_at = time.time()
+        if not self.state_store.save_app(app_record):
+            return {"error": f"Failed to save header rules for {app_name}"}
+
+        self.state_store.log_event(app_name, "headers_updated",
+                                   {**edge_headers.describe(rules), "requested_by": requested_by})
+        if self.instances.get(app_name):
+            self._update_nginx_config(app_name)
+        logger.info(f"Updated header rules for {app_name}")
+        return self.get_header_rules(app_name)
+
+    def get_maintenance(self, app_name: str) -> dict:
+        """Whether an app is in maintenance mode, since when and with what message."""
+        app_record = self.state_store.get_app(app_name)
+        if not app_record:
+            return {"error": f"App {app_name} not found"}
+        state = self.maintenance.get(app_name)
+        return {
+            "app": app_name,
+            "enabled": bool(state),
+            "message": (state or {}).get("message"),
+            "since": (state or {}).get("since"),
+            "requested_by": (state or {}).get("requested_by"),
+            "page": "custom" if (app_record.spec.get("errorPages") or {}).get("maintenance") else "default"
+        }
+
+    def set_maintenance(self, app_name: str, enabled: bool, message: Optional[str] = None,
+                        requested_by: Optional[str] = None) -> dict:
+        """Turn an app's maintenance mode on or off and apply it to nginx right away."""
+        app_record = self.state_store.get_app(app_name)
+        if not app_record:
+            return {"error": f"App {app_name} not found"}
+        if udp.is_udp(app_record.spec):
+            return {"error": "Maintenance mode is only supported for HTTP apps"}
+
+        if enabled:
+            message, message_error = error_pages.validate_message(message)
+            if message_error:
+                return {"error": message_error}
+            if self.maintenance.enable(app_name, message, requested_by) is None:
+                return {"error": f"Failed to save maintenance mode for {app_name}"}
+            self.state_store.log_event(app_name, "maintenance_enabled", {"message": message, "requested_by": requested_by})
+        elif self.maintenance.get(app_name):
+            if not self.maintenance.disable(app_name):
+                return {"error": f"Failed to save maintenance mode for {app_name}"}
+            self.state_store.log_event(app_name, "maintenance_disabled", {"requested_by": requested_by})
+        else:
+            return self.get_maintenance(app_name)
+
+        self._update_nginx_config(app_name)
+        logger.info(f"Maintenance mode for {app_name} is {'on' if enabled else 'off'}")
+        return self.get_maintenance(app_name)
+
+    def scaling_policy(self, app_name: str, scaling: Optional[dict] = None) -> Any:
+        """The autoscaler policy for an app's `scaling` section (its stored one by default) and
+        its namespace's scaling defaults. Raises ValueError if they do not make a valid policy."""
+        app_record = self.state_store.get_app(app_name)
+        if scaling is None:
+            scaling = (app_record.spec or {}).get("scaling") if app_record else None
+        namespace = app_record.namespace if app_record else None
+        return policy_from_scaling(scaling, self.namespaces.scaling_defaults(namespace))
+
+    def set_scaling(self, app_name: str, scaling: dict) -> dict:
+        """Replace an app's stored `scaling` section. The caller applies the policy to the autoscaler."""
+        app_record = self.state_store.get_app(app_name)
+        if not app_record:
+            return {"error": f"App {app_name} not found"}
+
+        app_record.spec["scaling"] = scaling
+        app_record.mode = scaling.get("mode", "auto")
+        app_record.updated_at = time.time()
+        if not self.state_store.save_app(app_record):
+            return {"error": f"Failed to save scaling policy for {app_name}"}
+
+        self.state_store.log_event(app_name, "policy_updated", scaling)
+        logger.info(f"Updated scaling policy for {app_name}: {scaling}")
+        return {"app": app_name, "scaling": scaling}
+
+    def refresh_secret_consumers(self, secret_name: str) -> list:
+        """Re-render nginx config for running apps whose edge auth or TLS uses secret_name."""
+        refreshed = []
+        for app_name in list(self.instances.keys()):
+            app_record = self.state_store.get_app(app_name)
+            if app_record and secret_name in (secret_refs(app_record.spec.get("auth"))
+                                              | edge_tls.secret_refs(app_record.spec.get("tls"))):
+                self._update_nginx_config(app_name)
+                refreshed.append(app_name)
+        return refreshed
+
+    def cleanup_orphaned_containers(self, report: Optional[Any] = None):
+        """Clean up containers that are not tracked in our state, recording them in a
+        reconciliation report if given."""
         try:
             # Get all orchestry containers
             containers = self.docker_client.containers.list(
@@ -799,9 +2601,21 @@ class AppManager:
                     logger.info(f"Cleaning up orphaned container {container_id}")
                     container.stop(timeout=10)
                     container.remove()
+                    if report:
+                        report.container_removed(app_name, container_id)
+
+            # Shadow replicas only live as long as the leader that started them
+            for container in self.docker_client.containers.list(all=True, filters={"label": shadow.SHADOW_LABEL}):
+                if not self.shadow_active(container.labels.get(shadow.SHADOW_LABEL)):
+                    logger.info(f"Cleaning up orphaned shadow replica {container.name}")
+                    self._remove_container(container)
+                    if report:
+                        report.container_removed(container.labels.get("orchestry.app"), container.id)
 
         except Exception as e:
             logger.error(f"Failed to cleanup orphaned containers: {e}")
+            if report:
+                report.fail("orphan_cleanup", e)
 
     def start_container_monitoring(self):
         """Start the container monitoring thread."""
@@ -812,28 +2626,229 @@ class AppManager:
         self.monitoring_active = True
         self.monitoring_thread = threading.Thread(target=self._container_monitoring_loop, daemon=True)
         self.monitoring_thread.start()
+        self.events_thread = threading.Thread(target=self._docker_events_loop, daemon=True)
+        self.events_thread.start()
         logger.info("Started container monitoring thread")
 
     def stop_container_monitoring(self):
         """Stop the container monitoring thread."""
         self.monitoring_active = False
+        if self._event_stream is not None:
+            try:
+                self._event_stream.close()  # unblocks the events thread
+            except Exception:
+                pass
         if self.monitoring_thread and self.monitoring_thread.is_alive():
             self.monitoring_thread.join(timeout=5)
+        if self.events_thread and self.events_thread.is_alive():
+            self.events_thread.join(timeout=5)
         logger.info("Stopped container monitoring thread")
 
+    def _docker_events_loop(self):
+        """Follow Docker container events so instance states change as soon as a container dies,
+        instead of waiting for the next monitoring pass."""
+        while self.monitoring_active:
+            try:
+                self._event_stream = self.client.events(
+                    decode=True,
+                    filters={"type": "container", "label": "orchestry.app"}
+                )
+                for event in self._event_stream:
+                    if not self.monitoring_active:
+                        break
+                    self._handle_docker_event(event)
+            except Exception as e:
+                if self.monitoring_active:
+                    logger.warning(f"Docker event stream interrupted: {e}")
+                    time.sleep(5)
+            finally:
+                self._event_stream = None
+
+    def _handle_docker_event(self, event: dict):
+        """Apply a single Docker container event to the tracked instance states."""
+        action = event.get("Action") or event.get("status") or ""
+        container_id = event.get("id") or event.get("Actor", {}).get("ID")
+        if action not in ("die", "oom") or not container_id:
+            return
+
+        with self._lock:
+            app_name, instance = self._find_instance(container_id)
+            if not instance:
+                return
+            if instance.transition(InstanceState.DOWN, f"docker event: {action}"):
+                self._update_nginx_config(app_name)
+
     def _container_monitoring_loop(self):
         """Main loop for monitoring container health and ensuring minReplicas."""
         logger.info("Container monitoring loop started")
 
         while self.monitoring_active:
             try:
-                self._check_and_restart_containers()
-                self._ensure_min_replicas()
+                if self._is_frozen():
+                    logger.debug("Controller is frozen, skipping automatic restarts and minReplicas enforcement")
+                else:
+                    self._check_and_restart_containers()
+                    self._ensure_min_replicas()
+                    self._maintain_warm_pools()
+                    self._update_latency_weights()
+                    self._ramp_up_replicas()
+                    self._detect_outliers()
+                    self._retry_queued_disruptions()
+                self._record_observed_statuses()
                 time.sleep(10)  # Check every 10 seconds
             except Exception as e:
                 logger.error(f"Error in container monitoring loop: {e}")
                 time.sleep(5)  # Wait a bit before retrying
 
+    def _update_latency_weights(self):
+        """Re-weight replicas of apps with latencyWeighting from their recent response times."""
+        now = time.time()
+        for app_name in list(self.instances.keys()):
+            try:
+                app_record = self.state_store.get_app(app_name)
+                config = latency_weights.weighting_config(app_record.spec or {}) if app_record else None
+                if not config:
+                    if self.latency_weights.pop(app_name, None):
+                        self._update_nginx_config(app_name)
+                    continue
+                if now - self._weights_updated_at.get(app_name, 0) < config["intervalSeconds"]:
+                    continue
+                self._weights_updated_at[app_name] = now
+
+                latencies = self.nginx.get_upstream_latencies(app_name, config["intervalSeconds"])
+                if latencies is None:
+                    continue
+                with self._lock:
+                    upstreams = [f"{inst.ip}:{inst.port}" for inst in self.instances.get(app_name, []) if inst.routable]
+                current = self.latency_weights.get(app_name, {})
+                weights = latency_weights.compute_weights(latencies, upstreams, current)
+                if not latency_weights.significant_change(current, weights):
+                    continue
+                self.latency_weights[app_name] = weights
+                logger.info(f"Re-weighted {app_name} replicas by latency: {weights}")
+                self._update_nginx_config(app_name)
+            except Exception as e:
+                logger.error(f"Error updating latency weights for {app_name}: {e}")
+
+    def _ramp_weights(self, app_name: str, app_spec: dict) -> Dict[str, int]:
+        """Weights of an app's replicas that are still warming up (ip:port -> weight).
+        Empty when the app has no slowStart or no warmed-up replica to carry the rest."""
+        config = slow_start.slow_start_config(app_spec)
+        if not config:
+            return {}
+        now = time.time()
+        with self._lock:
+            routable = [inst for inst in self.instances.get(app_name, []) if inst.routable]
+        warming = [inst for inst in routable if slow_start.warming_up(config, inst.state_changed_at, now)]
+        if not warming or len(warming) == len(routable):
+            return {}
+        weights = self.latency_weights.get(app_name, {})
+        return {
+            f"{inst.ip}:{inst.port}": slow_start.ramp_weight(
+                config, inst.state_changed_at, now,
+                weights.get(f"{inst.ip}:{inst.port}", latency_weights.MAX_WEIGHT))
+            for inst in warming
+        }
+
+    def _ramp_up_replicas(self):
+        """Move replicas of apps with slowStart one step closer to full weight."""
+        for app_name in list(self.instances.keys()):
+            try:
+                app_record = self.state_store.get_app(app_name)
+                if not app_record:
+                    continue
+                if self._ramp_weights(app_name, app_record.spec or {}) != self.ramp_weights.get(app_name, {}):
+                    self._update_nginx_config(app_name)
+            except Exception as e:
+                logger.error(f"Error ramping up replicas of {app_name}: {e}")
+
+    def _detect_outliers(self):
+        """Quarantine at most one outlier replica per app and interval for apps with outlierDetection."""
+        now = time.time()
+        for app_name in list(self.instances.keys()):
+            try:
+                app_record = self.state_store.get_app(app_name)
+                config = outliers.detection_config(app_record.spec or {}) if app_record else None
+                if not config or app_record.status != "running":
+                    continue
+                if now - self._outliers_checked_at.get(app_name, 0) < config["intervalSeconds"]:
+                    continue
+                self._outliers_checked_at[app_name] = now
+
+                stats = self.nginx.get_upstream_latencies(app_name, config["intervalSeconds"])
+                if not stats:
+                    continue
+                # A replica warming up within its health check grace period is not replaced for being slow
+                with self._lock:
+                    routable = {f"{inst.ip}:{inst.port}": inst for inst in self.instances.get(app_name, [])
+                                if inst.routable and not self.health_checker.in_grace_period(inst.container_id)}
+                outlier = outliers.find_outlier({u: s for u, s in stats.items() if u in routable}, config)
+                if outlier:
+                    upstream, reason = outlier
+                    self.quarantine_instance(app_name, routable[upstream], reason, stats[upstream], wait=False)
+            except Exception as e:
+                logger.error(f"Error detecting outliers for {app_name}: {e}")
+
+    @_locked("quarantine")
+    def quarantine_instance(self, app_name: str, instance: ContainerInstance, reason: str,
+                            stats: Optional[dict] = None) -> dict:
+        """Take a misbehaving replica out of nginx, record an incident with its logs and stats,
+        start a replacement and then stop it. If that would break the app's minReady floor,
+        the quarantine is queued instead."""
+        with self._lock:
+            if instance not in self.instances.get(app_name, []):
+                return {"error": f"Instance {instance.container_id[:12]} is not a replica of {app_name}"}
+            # The replacement only counts once it is ready, so the floor is for the current replica count
+            live = [inst for inst in self.instances[app_name] if inst.state != InstanceState.DOWN]
+            blocked = self._availability_blocked(app_name, [instance], replicas=len(live))
+            if blocked:
+                self._queue_disruption(app_name, "quarantine", blocked, instance.container_id,
+                                       quarantine_reason=reason)
+                return {"status": "deferred", "app": app_name, "container_id": instance.container_id[:12],
+                        "reason": blocked}
+            self._dequeue_disruption(app_name, "quarantine")
+            if not instance.transition(InstanceState.DRAINING, f"quarantined: {reason}"):
+                return {"error": f"Instance {instance.container_id[:12]} cannot be quarantined while {instance.state.value}"}
+            self.instances[app_name].remove(instance)
+            self._update_nginx_config(app_name)
+        logger.warning(f"Quarantined replica {instance.container_id[:12]} of {app_name}: {reason}")
+
+        incident = {
+            "container_id": instance.container_id[:12],
+            "ip": instance.ip,
+            "reason": reason,
+            "upstream_stats": stats,
+            "cpu_percent": instance.cpu_percent,
+            "memory_percent": instance.memory_percent,
+            "disk_usage_bytes": instance.disk_usage_bytes,
+            "logs": None
+        }
+        try:
+            container = self.docker_client.containers.get(instance.container_id)
+            logs = container.logs(tail=outliers.INCIDENT_LOG_LINES, timestamps=True)
+            incident["logs"] = logs.decode("utf-8", errors="replace") if isinstance(logs, bytes) else logs
+        except Exception as e:
+            logger.warning(f"Could not capture logs of quarantined replica {instance.container_id[:12]}: {e}")
+        self.state_store.log_event(app_name, "replica_quarantined", incident, severity="warning",
+                                   message=f"Quarantined replica {instance.container_id[:12]} of {app_name}: {reason}")
+
+        # Replace first so the app is back at full capacity before the old replica goes away
+        replacement = None
+        app_record = self.state_store.get_app(app_name)
+        if app_record:
+            with self._lock:
+                replacement = self._activate_standby(app_name, app_record.spec) or \
+                    self._start_container(app_name, app_record.spec, self._next_replica_index(app_name))
+            self._update_nginx_config(app_name)
+        self._stop_container(instance, termination.grace_period(app_record.spec if app_record else None))
+        return {
+            "status": "quarantined",
+            "app": app_name,
+            "container_id": instance.container_id[:12],
+            "replacement": replacement.container_id[:12] if replacement else None,
+            "reason": reason
+        }
+
     def _check_and_restart_containers(self):
         """Check all tracked containers and restart any that are stopped."""
         with self._restart_lock:
@@ -868,8 +2883,12 @@ class AppManager:
 
                                         if container.status == "running":
                                             logger.info(f"Successfully restarted container {container.name}")
-                                            instance.state = "ready"
+                                            instance.transition(InstanceState.DOWN, f"container {container.status}")
+                                            instance.transition(InstanceState.STARTING, "restarted in place")
                                             instance.last_seen = time.time()
+                                            # Start health checking from scratch for the restarted process
+                                            self.health_checker.remove_target(instance.container_id)
+                                            self._register_health(app_name, instance, app_spec_record.spec, "restarted ", started_at=time.time())
                                             continue
                                     except Exception as restart_e:
                                         logger.warning(f"Failed to restart existing container {container.name}: {restart_e}")
@@ -894,6 +2913,14 @@ class AppManager:
                             self.health_checker.remove_target(failed_instance.container_id)
                             self.instances[app_name].pop(idx)
 
+                if instances_to_restart:
+                    self.alerts.notify(
+                        app_name, "replica_failed",
+                        f"{len(instances_to_restart)} replica(s) of {app_name} stopped and are being recreated",
+                        {"container_ids": [inst.container_id[:12] for inst in instances_to_restart]},
+                        severity="critical"
+                    )
+
                 # Recreate containers for failed instances
                 for failed_instance in instances_to_restart:
                     self._recreate_container(app_name, failed_instance)
@@ -909,8 +2936,8 @@ class AppManager:
                 return
 
             # Extract container port from app spec
-            ports = app_spec_record.spec.get("ports", [{}])
-            container_port = ports[0].get("containerPort", 8080) if ports else 8080
+            port_specs = app_spec_record.spec.get("ports", [{}])
+            container_port = port_specs[0].get("containerPort", 8080) if port_specs else 8080
 
             # Find next available replica index
             existing_indices = set()
@@ -937,15 +2964,15 @@ class AppManager:
                 if existing_container.status == "running":
                     logger.info(f"Container {container_name} already running, adopting it")
                     # Adopt the existing running container
-                    network_settings = existing_container.attrs.get("NetworkSettings", {})
-                    container_ip = network_settings.get("Networks", {}).get("orchestry", {}).get("IPAddress", "")
+                    container_ip, container_port = process_runtime.instance_address(existing_container, container_port)
 
                     instance = ContainerInstance(
                         container_id=existing_container.id,
                         ip=container_ip,
                         port=container_port,
-                        state="ready",
-                        last_seen=time.time()
+                        state=InstanceState.STARTING,
+                        last_seen=time.time(),
+                        host_port=ports.published_port(existing_container)
                     )
 
                     with self._lock:
@@ -953,11 +2980,7 @@ class AppManager:
                             self.instances[app_name] = []
                         self.instances[app_name].append(instance)
 
-                    # Register with health checker if health config is specified
-                    if "health" in app_spec_record.spec:
-                        health_config = HealthChecker.create_config_from_spec(app_spec_record.spec["health"])
-                        self.health_checker.add_target(existing_container.id, container_ip, container_port, health_config)
-                        logger.info(f"Registered adopted container {existing_container.id[:12]} for health checking")
+                    self._register_health(app_name, instance, app_spec_record.spec, "adopted ")
 
                     self._update_nginx_config(app_name)
                     return
@@ -968,15 +2991,15 @@ class AppManager:
                     existing_container.reload()
 
                     if existing_container.status == "running":
-                        network_settings = existing_container.attrs.get("NetworkSettings", {})
-                        container_ip = network_settings.get("Networks", {}).get("orchestry", {}).get("IPAddress", "")
+                        container_ip, container_port = process_runtime.instance_address(existing_container, container_port)
 
                         instance = ContainerInstance(
                             container_id=existing_container.id,
                             ip=container_ip,
                             port=container_port,
-                            state="ready",
-                            last_seen=time.time()
+                            state=InstanceState.STARTING,
+                            last_seen=time.time(),
+                            host_port=ports.published_port(existing_container)
                         )
 
                         with self._lock:
@@ -984,11 +3007,7 @@ class AppManager:
                                 self.instances[app_name] = []
                             self.instances[app_name].append(instance)
 
-                        # Register with health checker if health config is specified
-                        if "health" in app_spec_record.spec:
-                            health_config = HealthChecker.create_config_from_spec(app_spec_record.spec["health"])
-                            self.health_checker.add_target(existing_container.id, container_ip, container_port, health_config)
-                            logger.info(f"Registered restarted container {existing_container.id[:12]} for health checking")
+                        self._register_health(app_name, instance, app_spec_record.spec, "restarted ", started_at=time.time())
 
                         self._update_nginx_config(app_name)
                         return
@@ -998,66 +3017,23 @@ class AppManager:
             except Exception as e:
                 logger.warning(f"Error checking existing container {container_name}: {e}")
 
-            # Create completely new container
-            container_config = {
-                "image": app_spec_record["image"],
-                "name": container_name,
-                "network": "orchestry",
-                "detach": True,
-                "labels": {
-                    "orchestry.app": app_name,
-                    "orchestry.replica": str(next_index),
-                    "managed_by": "orchestry"
-                },
-                "restart_policy": {"Name": "unless-stopped"}
-            }
-
-            # Add resource limits if specified
-            if "resources" in app_spec_record:
-                resources = app_spec_record["resources"]
-                if "cpu" in resources:
-                    cpu_str = resources["cpu"]
-                    if cpu_str.endswith("m"):
-                        cpu_value = float(cpu_str[:-1]) / 1000
-                    else:
-                        cpu_value = float(cpu_str)
-                    container_config["nano_cpus"] = int(cpu_value * 1_000_000_000)
-                if "memory" in resources:
-                    memory_str = resources["memory"]
-                    if memory_str.endswith("Mi"):
-                        memory_bytes = int(memory_str[:-2]) * 1024 * 1024
-                        container_config["mem_limit"] = memory_bytes
-
-            # Add environment variables if specified
-            if "env" in app_spec_record:
-                env_vars = {}
-                for env in app_spec_record["env"]:
-                    if env.get("valueFrom") == "sdk":
-                        env_vars[env["name"]] = self._get_sdk_env_value(env["name"])
-                    else:
-                        env_vars[env["name"]] = env.get("value", "")
-                container_config["environment"] = env_vars
-
-            # Create and start container
-            container_config.pop("detach", None)
-            container = self.docker_client.containers.create(**container_config)
-            container.start()
-            container.reload()
-
-            if container.status != "running":
-                raise Exception(f"Container failed to start: {container.status}")
+            # Create completely new container, configured like every other replica
+            container_config, host_port = self._container_config(app_name, app_spec_record.spec, next_index)
+            container_config["labels"]["managed_by"] = "orchestry"
+            container_config["restart_policy"] = {"Name": "unless-stopped"}
+            container = self._create_and_start(container_config)
 
             # Get container IP
-            network_settings = container.attrs["NetworkSettings"]
-            container_ip = network_settings["Networks"]["orchestry"]["IPAddress"]
+            container_ip, container_port = process_runtime.instance_address(container, container_port)
 
             # Create new instance record
             instance = ContainerInstance(
                 container_id=container.id,
                 ip=container_ip,
                 port=container_port,
-                state="ready",
-                last_seen=time.time()
+                state=InstanceState.STARTING,
+                last_seen=time.time(),
+                host_port=host_port
             )
 
             with self._lock:
@@ -1065,11 +3041,8 @@ class AppManager:
                     self.instances[app_name] = []
                 self.instances[app_name].append(instance)
 
-            # Register with health checker if health config is specified
-            if "health" in app_spec_record.spec:
-                health_config = HealthChecker.create_config_from_spec(app_spec_record.spec["health"])
-                self.health_checker.add_target(container.id, container_ip, container_port, health_config)
-                logger.info(f"Registered recreated container {container.id[:12]} for health checking")
+            self._register_health(app_name, instance, app_spec_record.spec, "recreated ", started_at=time.time())
+            self._clear_start_failure(app_name)
 
             self._update_nginx_config(app_name)
 
@@ -1077,6 +3050,7 @@ class AppManager:
 
         except Exception as e:
             logger.error(f"Failed to recreate container for app {app_name}: {e}")
+            self._record_start_failure(app_name, e)
             import traceback
             logger.error(f"Traceback: {traceback.format_exc()}")
 
@@ -1115,14 +3089,14 @@ class AppManager:
                     scaling_policy = app_spec_record.spec.get("scaling", {})
                     min_replicas = scaling_policy.get("minReplicas", 1)
 
-                    # Count healthy running instances
+                    # Count running instances that are not on their way out
                     healthy_instances = []
                     with self._lock:
                         for instance in self.instances.get(app_name, []):
                             try:
                                 container = self.client.containers.get(instance.container_id)
                                 container.reload()
-                                if container.status == "running" and instance.state == "ready":
+                                if container.status == "running" and instance.state not in (InstanceState.DRAINING, InstanceState.DOWN):
                                     healthy_instances.append(instance)
                             except docker.errors.NotFound:
                                 continue  # Container will be handled by _check_and_restart_containers
@@ -1148,18 +3122,13 @@ class AppManager:
             if not app_spec_record:
                 return
 
-            # Find next available replica index
-            existing_indices = set()
-            containers = self.client.containers.list(all=True, filters={"label": f"orchestry.app={app_name}"})
-
-            for container in containers:
-                idx_label = container.labels.get("orchestry.replica")
-                if idx_label and idx_label.isdigit():
-                    existing_indices.add(int(idx_label))
+            with self._lock:
+                instance = self._activate_standby(app_name, app_spec_record.spec)
+            if instance:
+                self._update_nginx_config(app_name)
+                return
 
-            next_index = 0
-            while next_index in existing_indices:
-                next_index += 1
+            next_index = self._next_replica_index(app_name)
 
             # Create new replica
             self._create_container_replica(app_name, app_spec_record.spec, next_index)
@@ -1167,6 +3136,101 @@ class AppManager:
 
         except Exception as e:
             logger.error(f"Failed to create additional replica for app {app_name}: {e}")
+            self._record_start_failure(app_name, e)
+
+    def _next_replica_index(self, app_name: str) -> int:
+        """Lowest replica index no container of the app (standbys included) uses."""
+        existing_indices = set()
+        containers = self.client.containers.list(all=True, filters={"label": f"orchestry.app={app_name}"})
+
+        for container in containers:
+            idx_label = container.labels.get("orchestry.replica")
+            if idx_label and idx_label.isdigit():
+                existing_indices.add(int(idx_label))
+
+        next_index = 0
+        while next_index in existing_indices:
+            next_index += 1
+        return next_index
+
+    def _activate_standby(self, app_name: str, app_spec: dict) -> Optional[ContainerInstance]:
+        """Turn a warm pool standby into a replica (call with the lock held). Returns None
+        if the app has no usable standby."""
+        pool = warm_pool.pool_config(app_spec)
+        if not pool:
+            return None
+        for container in warm_pool.standbys(self.docker_client, app_name):
+            if not warm_pool.matches(container, app_spec, pool["mode"]):
+                continue
+            try:
+                started = time.time()
+                warm_pool.activate(container)
+                container_ip = container.attrs["NetworkSettings"]["Networks"]["orchestry"]["IPAddress"]
+                instance = ContainerInstance(
+                    container_id=container.id,
+                    ip=container_ip,
+                    port=app_spec["ports"][0]["containerPort"],
+                    state=InstanceState.STARTING,
+                    last_seen=time.time()
+                )
+                self.instances.setdefault(app_name, []).append(instance)
+                self._register_health(app_name, instance, app_spec, "warm pool ", started_at=time.time())
+                logger.info(f"Activated standby {container.name} for {app_name} in {time.time() - started:.2f}s")
+                self.state_store.log_event(app_name, "standby_activated", {
+                    "container": container.name, "mode": pool["mode"],
+                    "seconds": round(time.time() - started, 2)
+                })
+                return instance
+            except Exception as e:
+                logger.warning(f"Failed to activate standby {container.name} for {app_name}, removing it: {e}")
+                warm_pool.remove(container)
+        return None
+
+    def maintain_warm_pool(self, app_name: str) -> dict:
+        """Create or remove standbys so a running app has the warm pool its policy asks for.
+        Standbys for an old image or pool mode are replaced."""
+        app_record = self.state_store.get_app(app_name)
+        if not app_record:
+            return {"error": f"App {app_name} not found"}
+        pool = warm_pool.pool_config(app_record.spec) if app_record.status == "running" else None
+        size = pool["size"] if pool else 0
+
+        with self._lock:
+            current = warm_pool.standbys(self.docker_client, app_name)
+            usable = []
+            removed = 0
+            for container in current:
+                if pool and warm_pool.matches(container, app_record.spec, pool["mode"]) and len(usable) < size:
+                    usable.append(container)
+                else:
+                    warm_pool.remove(container)
+                    removed += 1
+
+            created = 0
+            while len(usable) + created < size:
+                replica_index = self._next_replica_index(app_name)
+                container_config, _ = self._container_config(app_name, app_record.spec, replica_index)
+                container_config["labels"][warm_pool.WARM_LABEL] = "true"
+                try:
+                    self._create_and_start(container_config, lambda c: warm_pool.park(c, pool["mode"]))
+                    created += 1
+                except Exception as e:
+                    logger.error(f"Failed to create standby {app_name}-{replica_index}: {e}")
+                    break
+
+        if created or removed:
+            logger.info(f"Warm pool for {app_name}: created {created}, removed {removed}, "
+                        f"{len(usable) + created}/{size} standby(s)")
+        return {"app": app_name, "size": size, "standby": len(usable) + created,
+                "created": created, "removed": removed}
+
+    def _maintain_warm_pools(self):
+        for app in self.state_store.list_apps():
+            if app.get("status") == "running" or app.get("name") in self.instances:
+                try:
+                    self.maintain_warm_pool(app["name"])
+                except Exception as e:
+                    logger.error(f"Error maintaining warm pool for {app['name']}: {e}")
 
     def _create_container_replica(self, app_name: str, app_spec: dict, replica_index: int):
         """Create a single container replica."""
@@ -1186,18 +3250,17 @@ class AppManager:
                     logger.info(f"Restarted existing container {container_name}")
                     # Register with health checker if health config is specified
                     if "health" in app_spec:
-                        network_settings = existing_container.attrs["NetworkSettings"]
-                        container_ip = network_settings["Networks"]["orchestry"]["IPAddress"]
-                        container_port = app_spec.get("ports", [{}])[0].get("containerPort", 8080)
+                        container_ip, container_port = process_runtime.instance_address(existing_container, container_port)
                         health_config = HealthChecker.create_config_from_spec(app_spec["health"])
-                        self.health_checker.add_target(existing_container.id, container_ip, container_port, health_config)
+                        self.health_checker.add_target(existing_container.id, container_ip, container_port, health_config,
+                                                       app_name=app_name, started_at=time.time())
                         logger.info(f"Registered restarted container {existing_container.id[:12]} for health checking")
                     return
         except docker.errors.NotFound:
             pass  # Container doesn't exist, create it
 
         container_config = {
-            "image": app_spec["image"],
+            "image": app_spec.get("image"),
             "name": container_name,
             "network": "orchestry",
             "detach": True,
@@ -1209,6 +3272,15 @@ class AppManager:
             "restart_policy": {"Name": "unless-stopped"}
         }
 
+        platform = self._resolve_platform(app_spec)
+        if platform:
+            container_config["platform"] = platform
+        host_options.apply(container_config, app_spec)
+        security.apply(container_config, self._effective_security(app_name, app_spec))
+        process_runtime.apply(container_config, app_spec)
+        termination.apply(container_config, app_spec)
+        host_port = self.ports.apply(container_config, app_name, replica_index, app_spec)
+
         # Add resource limits if specified
         if "resources" in app_spec:
             resources = app_spec["resources"]
@@ -1239,24 +3311,19 @@ class AppManager:
             container_config["environment"] = env_vars
 
         # Create and start container
-        container = self.docker_client.containers.create(**container_config)
-        container.start()
-        container.reload()
-
-        if container.status != "running":
-            raise Exception(f"Container failed to start: {container.status}")
+        container = self._create_and_start(container_config)
 
         # Get container IP
-        network_settings = container.attrs["NetworkSettings"]
-        container_ip = network_settings["Networks"]["orchestry"]["IPAddress"]
+        container_ip, container_port = process_runtime.instance_address(container, container_port)
 
         # Create instance record
         instance = ContainerInstance(
             container_id=container.id,
             ip=container_ip,
             port=container_port,
-            state="ready",
-            last_seen=time.time()
+            state=InstanceState.STARTING,
+            last_seen=time.time(),
+            host_port=host_port
         )
 
         with self._lock:
@@ -1264,11 +3331,8 @@ class AppManager:
                 self.instances[app_name] = []
             self.instances[app_name].append(instance)
 
-        # Register with health checker if health config is specified
-        if "health" in app_spec:
-            health_config = HealthChecker.create_config_from_spec(app_spec["health"])
-            self.health_checker.add_target(container.id, container_ip, container_port, health_config)
-            logger.info(f"Registered container {container.id[:12]} for health checking")
+        self._register_health(app_name, instance, app_spec, "", started_at=time.time())
+        self._clear_start_failure(app_name)
 
         self._update_nginx_config(app_name)
 
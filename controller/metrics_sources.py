@@ -0,0 +1,342 @@
+"""
+Custom metrics sources for autoscaling.
+An app can scale on metrics Orchestry does not collect itself, such as a
+queue depth in CloudWatch or a Datadog query, by listing them under
+`scaling.externalMetrics`. Each entry names a source, a source-specific
+config and a target; at every evaluation the leader reads the metric and
+the autoscaler treats value / target (per healthy replica with
+`targetPerReplica`) as one more scale factor next to RPS, latency, CPU and
+memory.
+
+Sources are MetricsSource implementations in a registry. `http`, `datadog`
+and `cloudwatch` are compiled in and register_source() adds more. Any
+executable in ORCHESTRY_METRICS_PLUGIN_DIR is an exec plugin named after
+the file: for every read the leader runs it with a JSON request on stdin
+and takes a JSON answer from stdout. A metric that cannot be read is left
+out of that evaluation and never blocks scaling on the other metrics.
+"""
+
+import os
+import re
+import json
+import time
+import logging
+import threading
+import subprocess
+import requests
+from concurrent.futures import ThreadPoolExecutor
+from datetime import datetime, timedelta, timezone
+from typing import Any, Dict, List, Optional, Tuple
+from urllib.parse import urlparse
+
+logger = logging.getLogger(__name__)
+
+PLUGIN_DIR = os.getenv("ORCHESTRY_METRICS_PLUGIN_DIR", "")
+DATADOG_SITE = os.getenv("DD_SITE", "datadoghq.com")
+DEFAULT_TIMEOUT_SECONDS = 5.0
+MAX_TIMEOUT_SECONDS = 30.0
+MAX_EXTERNAL_METRICS = 10
+# Plugin output beyond this is not read
+MAX_PLUGIN_OUTPUT_BYTES = 65536
+PLUGIN_PROTOCOL_VERSION = 1
+METRIC_NAME_PATTERN = re.compile(r"^[a-z][a-z0-9_]{0,62}$")
+TARGET_FIELDS = ("target", "targetPerReplica")
+
+class MetricsSource:
+    """Reads one number for an app's external metric. Implementations are registered
+    by name with register_source() and referenced as `source` in the app spec."""
+
+    name = ""
+    description = ""
+
+    def validate(self, config: Dict[str, Any]) -> Optional[str]:
+        """Check a metric's `config` when the spec is submitted. Returns an error or None."""
+        return None
+
+    def fetch(self, app_name: str, metric: str, config: Dict[str, Any], timeout: float) -> float:
+        """Read the metric's current value. Raises on failure."""
+        raise NotImplementedError
+
+def _number(value: Any, what: str) -> float:
+    if isinstance(value, bool) or not isinstance(value, (int, float)):
+        raise ValueError(f"{what} is not a number: {value!r}")
+    return float(value)
+
+def _dig(document: Any, path: str) -> Any:
+    """Follow a dotted path (list indexes allowed) into a JSON document."""
+    for part in path.split(".") if path else []:
+        if isinstance(document, list) and part.lstrip("-").isdigit():
+            document = document[int(part)]
+        elif isinstance(document, dict) and part in document:
+            document = document[part]
+        else:
+            raise ValueError(f"{path} not found in the response")
+    return document
+
+class HttpSource(MetricsSource):
+    """GETs a URL that answers with a number, or JSON holding one at `path`."""
+
+    name = "http"
+    description = "Custom probe: GET a URL returning a number or JSON (config: url, path, headers)"
+
+    def validate(self, config):
+        url = config.get("url")
+        parsed = urlparse(url) if isinstance(url, str) else None
+        if not parsed or parsed.scheme not in ("http", "https") or not parsed.netloc:
+            return "config.url must be an http(s) URL"
+        if not isinstance(config.get("path", ""), str):
+            return "config.path must be a dotted path such as data.0.value"
+        headers = config.get("headers", {})
+        if not isinstance(headers, dict) or not all(isinstance(value, str) for value in headers.values()):
+            return "config.headers must map header names to strings"
+        return None
+
+    def fetch(self, app_name, metric, config, timeout):
+        response = requests.get(config["url"], headers=config.get("headers") or {}, timeout=timeout)
+        response.raise_for_status()
+        if not config.get("path"):
+            try:
+                return float(response.text.strip())
+            except ValueError:
+                pass
+        return _number(_dig(response.json(), config.get("path", "")), config.get("path") or "response")
+
+class DatadogSource(MetricsSource):
+    """The latest point of a Datadog metrics query, read with DD_API_KEY and DD_APP_KEY."""
+
+    name = "datadog"
+    description = "Datadog metrics query (config: query, windowSeconds); needs DD_API_KEY and DD_APP_KEY"
+
+    def validate(self, config):
+        if not isinstance(config.get("query"), str) or not config["query"].strip():
+            return "config.query is required, e.g. avg:rabbitmq.queue.messages{queue:jobs}"
+        window = config.get("windowSeconds", 300)
+        if not isinstance(window, int) or isinstance(window, bool) or not 60 <= window <= 3600:
+            return "config.windowSeconds must be between 60 and 3600"
+        return None
+
+    def fetch(self, app_name, metric, config, timeout):
+        api_key, app_key = os.getenv("DD_API_KEY"), os.getenv("DD_APP_KEY")
+        if not api_key or not app_key:
+            raise ValueError("DD_API_KEY and DD_APP_KEY must be set on the controller")
+        now = int(time.time())
+        response = requests.get(
+            f"https://api.{DATADOG_SITE}/api/v1/query",
+            params={"query": config["query"], "from": now - config.get("windowSeconds", 300), "to": now},
+            headers={"DD-API-KEY": api_key, "DD-APPLICATION-KEY": app_key},
+            timeout=timeout
+        )
+        response.raise_for_status()
+        points = [point for series in response.json().get("series") or []
+                  for point in series.get("pointlist") or [] if point and point[1] is not None]
+        if not points:
+            raise ValueError("the query returned no points")
+        return _number(max(points, key=lambda point: point[0])[1], "datadog point")
+
+class CloudWatchSource(MetricsSource):
+    """The latest datapoint of a CloudWatch metric. Needs boto3 on the controller and the
+    usual AWS credentials (environment, shared config or instance role)."""
+
+    name = "cloudwatch"
+    description = ("CloudWatch metric (config: namespace, metricName, dimensions, statistic, "
+                   "periodSeconds, region); needs boto3")
+    STATISTICS = ("Average", "Sum", "Minimum", "Maximum", "SampleCount")
+
+    def validate(self, config):
+        for field in ("namespace", "metricName"):
+            if not isinstance(config.get(field), str) or not config[field].strip():
+                return f"config.{field} is required"
+        dimensions = config.get("dimensions", {})
+        if not isinstance(dimensions, dict) or not all(isinstance(value, str) for value in dimensions.values()):
+            return "config.dimensions must map dimension names to strings"
+        if config.get("statistic", "Average") not in self.STATISTICS:
+            return f"config.statistic must be one of {', '.join(self.STATISTICS)}"
+        period = config.get("periodSeconds", 60)
+        if not isinstance(period, int) or isinstance(period, bool) or (period not in (1, 5, 10, 30) and (period < 60 or period % 60)):
+            return "config.periodSeconds must be 1, 5, 10, 30 or a multiple of 60"
+        if "region" in config and not isinstance(config["region"], str):
+            return "config.region must be a string"
+        return None
+
+    def fetch(self, app_name, metric, config, timeout):
+        try:
+            import boto3
+            from botocore.config import Config
+        except ImportError:
+            raise ValueError("boto3 is not installed on the controller")
+        client = boto3.client("cloudwatch", region_name=config.get("region"),
+                              config=Config(connect_timeout=timeout, read_timeout=timeout,
+                                            retries={"max_attempts": 1}))
+        period = config.get("periodSeconds", 60)
+        statistic = config.get("statistic", "Average")
+        now = datetime.now(timezone.utc)
+        answer = client.get_metric_statistics(
+            Namespace=config["namespace"],
+            MetricName=config["metricName"],
+            Dimensions=[{"Name": name, "Value": value} for name, value in (config.get("dimensions") or {}).items()],
+            StartTime=now - timedelta(seconds=period * 5),
+            EndTime=now,
+            Period=period,
+            Statistics=[statistic]
+        )
+        datapoints = answer.get("Datapoints") or []
+        if not datapoints:
+            raise ValueError("no datapoints in the last 5 periods")
+        return _number(max(datapoints, key=lambda point: point["Timestamp"])[statistic], "cloudwatch datapoint")
+
+class ExecSource(MetricsSource):
+    """An executable speaking JSON over stdio. It gets
+    {"version": 1, "action": "fetch", "app": ..., "metric": ..., "config": {...}} on stdin
+    and answers {"value": <number>} or {"error": "<message>"} on stdout."""
+
+    def __init__(self, name: str, path: str):
+        self.name = name
+        self.path = path
+        self.description = f"Exec plugin {path}"
+
+    def fetch(self, app_name, metric, config, timeout):
+        request = {"version": PLUGIN_PROTOCOL_VERSION, "action": "fetch", "app": app_name,
+                   "metric": metric, "config": config}
+        try:
+            result = subprocess.run([self.path], input=json.dumps(request).encode(), capture_output=True,
+                                    timeout=timeout, check=False)
+        except subprocess.TimeoutExpired:
+            raise ValueError(f"plugin did not answer within {timeout:g}s")
+        if result.returncode != 0:
+            stderr = result.stderr.decode(errors="replace").strip()[-200:]
+            raise ValueError(f"plugin exited with {result.returncode}: {stderr or 'no output'}")
+        try:
+            answer = json.loads(result.stdout[:MAX_PLUGIN_OUTPUT_BYTES])
+        except ValueError:
+            raise ValueError("plugin did not answer with JSON")
+        if not isinstance(answer, dict):
+            raise ValueError("plugin answer must be a JSON object")
+        if answer.get("error"):
+            raise ValueError(str(answer["error"])[:200])
+        return _number(answer.get("value"), "plugin value")
+
+class SourceRegistry:
+    """Compiled-in sources plus the exec plugins found in PLUGIN_DIR."""
+
+    def __init__(self, plugin_dir: str = PLUGIN_DIR):
+        self.plugin_dir = plugin_dir
+        self._builtin: Dict[str, MetricsSource] = {}
+        self._plugins: Dict[str, MetricsSource] = {}
+        self._lock = threading.Lock()
+
+    def register(self, source: MetricsSource):
+        if not METRIC_NAME_PATTERN.match(source.name or ""):
+            raise ValueError(f"Invalid metrics source name {source.name!r}")
+        with self._lock:
+            self._builtin[source.name] = source
+
+    def discover(self) -> List[str]:
+        """Rescan the plugin directory. Returns the plugin names found."""
+        plugins = {}
+        if self.plugin_dir and os.path.isdir(self.plugin_dir):
+            for entry in sorted(os.listdir(self.plugin_dir)):
+                path = os.path.join(self.plugin_dir, entry)
+                name = os.path.splitext(entry)[0].replace("-", "_").lower()
+                if not os.path.isfile(path) or not os.access(path, os.X_OK):
+                    continue
+                if not METRIC_NAME_PATTERN.match(name) or name in self._builtin or name in plugins:
+                    logger.warning(f"Ignoring metrics plugin {path}: its name {name!r} is invalid or taken")
+                    continue
+                plugins[name] = ExecSource(name, path)
+        with self._lock:
+            self._plugins = plugins
+        return sorted(plugins)
+
+    def get(self, name: str) -> Optional[MetricsSource]:
+        with self._lock:
+            source = self._builtin.get(name) or self._plugins.get(name)
+        if source is None and self.plugin_dir:
+            # A plugin may have been installed since the last scan
+            self.discover()
+            with self._lock:
+                source = self._plugins.get(name)
+        return source
+
+    def describe(self) -> List[Dict[str, Any]]:
+        with self._lock:
+            return [{"name": source.name, "type": "plugin" if isinstance(source, ExecSource) else "builtin",
+                     "description": source.description}
+                    for source in sorted({**self._plugins, **self._builtin}.values(), key=lambda s: s.name)]
+
+registry = SourceRegistry()
+for _source in (HttpSource(), DatadogSource(), CloudWatchSource()):
+    registry.register(_source)
+registry.discover()
+
+def register_source(source: MetricsSource):
+    """Add a compiled-in metrics source. A source with the same name is replaced."""
+    registry.register(source)
+
+def validate_external_metrics(config: Any) -> Tuple[Optional[List[Dict[str, Any]]], Optional[str]]:
+    """Normalize `scaling.externalMetrics`. Returns (metrics or None, error)."""
+    if not config:
+        return None, None
+    if not isinstance(config, list):
+        return None, "scaling.externalMetrics must be a list"
+    if len(config) > MAX_EXTERNAL_METRICS:
+        return None, f"scaling.externalMetrics takes at most {MAX_EXTERNAL_METRICS} metrics"
+    metrics, seen = [], set()
+    for index, entry in enumerate(config):
+        where = f"scaling.externalMetrics[{index}]"
+        if not isinstance(entry, dict):
+            return None, f"{where} must be a mapping"
+        name = entry.get("name")
+        if not isinstance(name, str) or not METRIC_NAME_PATTERN.match(name):
+            return None, f"{where}.name must be lowercase letters, digits and underscores"
+        if name in seen:
+            return None, f"{where}.name {name} is used twice"
+        seen.add(name)
+        source = registry.get(entry.get("source")) if isinstance(entry.get("source"), str) else None
+        if not source:
+            known = ", ".join(item["name"] for item in registry.describe())
+            return None, f"{where}.source must be one of {known}"
+        targets = [field for field in TARGET_FIELDS if field in entry]
+        if len(targets) != 1:
+            return None, f"{where} needs exactly one of target or targetPerReplica"
+        target = entry[targets[0]]
+        if isinstance(target, bool) or not isinstance(target, (int, float)) or target <= 0:
+            return None, f"{where}.{targets[0]} must be a positive number"
+        timeout = entry.get("timeoutSeconds", DEFAULT_TIMEOUT_SECONDS)
+        if isinstance(timeout, bool) or not isinstance(timeout, (int, float)) or not 0 < timeout <= MAX_TIMEOUT_SECONDS:
+            return None, f"{where}.timeoutSeconds must be between 0 and {MAX_TIMEOUT_SECONDS:g}"
+        source_config = entry.get("config", {})
+        if not isinstance(source_config, dict):
+            return None, f"{where}.config must be a mapping"
+        error = source.validate(source_config)
+        if error:
+            return None, f"{where}.{error}"
+        metrics.append({"name": name, "source": source.name, targets[0]: target,
+                        "timeoutSeconds": timeout, "config": source_config})
+    return metrics, None
+
+def read_metric(app_name: str, metric: Dict[str, Any]) -> Optional[float]:
+    """One external metric's current value, or None if it cannot be read."""
+    source = registry.get(metric["source"])
+    if not source:
+        logger.warning(f"Metrics source {metric['source']} for {app_name}/{metric['name']} is not registered")
+        return None
+    try:
+        return source.fetch(app_name, metric["name"], metric.get("config") or {},
+                            metric.get("timeoutSeconds", DEFAULT_TIMEOUT_SECONDS))
+    except Exception as e:
+        logger.warning(f"Cannot read external metric {metric['name']} of {app_name} from {source.name}: {e}")
+        return None
+
+def collect(app_name: str, metrics: List[Dict[str, Any]]) -> Dict[str, float]:
+    """Read an app's external metrics in parallel. Metrics that cannot be read are left out."""
+    if not metrics:
+        return {}
+    with ThreadPoolExecutor(max_workers=len(metrics)) as pool:
+        values = list(pool.map(lambda metric: read_metric(app_name, metric), metrics))
+    return {metric["name"]: value for metric, value in zip(metrics, values) if value is not None}
+
+def scale_factor(metric: Dict[str, Any], value: float, healthy_replicas: int) -> float:
+    """value / target, per healthy replica for targetPerReplica."""
+    if "targetPerReplica" in metric:
+        return value / max(healthy_replicas, 1) / metric["targetPerReplica"]
+    return value / metric["target"]
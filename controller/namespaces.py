@@ -0,0 +1,168 @@
+"""
+Namespaces group apps that share policies.
+An app picks its namespace with `metadata.namespace` (default: "default").
+Namespaces need no setup; a namespace only gets a row once a policy is set
+for it. The configuration is a JSON document so later policy types can be
+added alongside `security`. A namespace's `scaling` defaults fill in the
+scaling fields its apps leave out.
+"""
+
+import re
+import logging
+from typing import Any, Dict, Optional, Tuple
+
+from . import security
+from . import change_calendar
+from .scaler import SCALING_DEFAULTS, policy_from_scaling
+
+logger = logging.getLogger(__name__)
+
+SYSTEM_EVENT_SCOPE = "orchestry"
+DEFAULT_NAMESPACE = "default"
+_VALID_NAMESPACE = re.compile(r"^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$")
+# Scaling fields a namespace can set defaults for; the mode stays a per-app choice
+SCALING_DEFAULT_FIELDS = tuple(field for field in SCALING_DEFAULTS if field != "mode")
+
+def validate_namespace_name(name: Any) -> Tuple[str, Optional[str]]:
+    """Normalize a namespace name. Returns (name, error)."""
+    if name is None or name == "":
+        return DEFAULT_NAMESPACE, None
+    name = str(name).strip()
+    if not _VALID_NAMESPACE.match(name):
+        return "", f"namespace '{name}' must be 1-63 lowercase letters, digits or dashes"
+    return name, None
+
+def validate_scaling_defaults(defaults: Any) -> Tuple[Dict[str, Any], Optional[str]]:
+    """Normalize a namespace's scaling defaults. Returns (defaults, error)."""
+    if not defaults:
+        return {}, None
+    if not isinstance(defaults, dict):
+        return {}, "scaling defaults must be a mapping"
+    unknown = sorted(set(defaults) - set(SCALING_DEFAULT_FIELDS))
+    if unknown:
+        return {}, f"Unknown scaling default fields: {', '.join(unknown)}"
+    defaults = {key: value for key, value in defaults.items() if value is not None}
+    try:
+        policy_from_scaling({}, defaults)
+    except (ValueError, TypeError) as e:
+        return {}, f"Invalid scaling defaults: {e}"
+    return defaults, None
+
+def inherited_fields(scaling: Optional[Dict[str, Any]], defaults: Dict[str, Any]) -> list:
+    """The scaling fields an app takes from its namespace's defaults."""
+    scaling = scaling or {}
+    return sorted(key for key in defaults if scaling.get(key) is None)
+
+class NamespaceManager:
+    """Reads and updates namespace policies."""
+
+    def __init__(self, state_store: Any):
+        self.state_store = state_store
+
+    def get_config(self, name: str) -> Dict[str, Any]:
+        record = self.state_store.get_namespace(name)
+        return (record or {}).get("config") or {}
+
+    def security_policy(self, name: str) -> Dict[str, Any]:
+        return self.get_config(name).get("security") or {}
+
+    def scaling_defaults(self, name: Optional[str]) -> Dict[str, Any]:
+        return self.get_config(name or DEFAULT_NAMESPACE).get("scaling") or {}
+
+    def get(self, name: str) -> Dict[str, Any]:
+        name, error = validate_namespace_name(name)
+        if error:
+            return {"error": error}
+        record = self.state_store.get_namespace(name) or {}
+        apps = self.state_store.list_apps(namespace=name)
+        return {
+            "name": name,
+            "config": record.get("config") or {},
+            "apps": [app["name"] for app in apps],
+            "updated_at": record.get("updated_at")
+        }
+
+    def list(self) -> Dict[str, Any]:
+        namespaces = self.state_store.list_namespaces()
+        if not any(ns["name"] == DEFAULT_NAMESPACE for ns in namespaces):
+            namespaces.insert(0, {"name": DEFAULT_NAMESPACE, "config": {}, "apps": 0})
+        return {"namespaces": namespaces, "count": len(namespaces)}
+
+    def set_security_policy(self, name: str, policy: Optional[Dict[str, Any]]) -> Dict[str, Any]:
+        """Replace a namespace's security policy. Existing apps that no longer comply are
+        reported; they keep running but new containers are refused until they are fixed."""
+        name, error = validate_namespace_name(name)
+        if error:
+            return {"error": error}
+        policy, error = security.validate_policy(policy)
+        if error:
+            return {"error": error}
+
+        config = self.get_config(name)
+        config["security"] = policy
+        if not self.state_store.save_namespace(name, config):
+            return {"error": f"Failed to save namespace {name}"}
+        self.state_store.log_event(SYSTEM_EVENT_SCOPE, "namespace_policy_updated", {"namespace": name, "security": policy})
+
+        non_compliant = []
+        for app in self.state_store.list_apps(namespace=name):
+            _, violation = security.enforce_policy(app["spec"].get("security") or {}, policy, name)
+            if violation:
+                non_compliant.append({"app": app["name"], "error": violation})
+
+        logger.info(f"Updated security policy for namespace {name}: {policy}")
+        result = self.get(name)
+        result["non_compliant"] = non_compliant
+        return result
+
+    def set_freeze_windows(self, name: str, windows: Any) -> Dict[str, Any]:
+        """Replace a namespace's deployment freeze windows (see change_calendar)."""
+        name, error = validate_namespace_name(name)
+        if error:
+            return {"error": error}
+        windows, error = change_calendar.validate_windows(windows)
+        if error:
+            return {"error": error}
+
+        config = self.get_config(name)
+        config["freezeWindows"] = windows
+        if not self.state_store.save_namespace(name, config):
+            return {"error": f"Failed to save namespace {name}"}
+        self.state_store.log_event(SYSTEM_EVENT_SCOPE, "freeze_windows_updated", {"scope": name, "windows": windows})
+        logger.info(f"Updated freeze windows for namespace {name}: {len(windows)} window(s)")
+        return self.get(name)
+
+    def set_scaling_defaults(self, name: str, defaults: Any) -> Dict[str, Any]:
+        """Replace a namespace's scaling defaults. Apps whose own fields no longer make a valid
+        policy with them are reported as conflicting; they keep the policy they have. The caller
+        applies the new policies of the other apps to the autoscaler."""
+        name, error = validate_namespace_name(name)
+        if error:
+            return {"error": error}
+        defaults, error = validate_scaling_defaults(defaults)
+        if error:
+            return {"error": error}
+
+        config = self.get_config(name)
+        if defaults:
+            config["scaling"] = defaults
+        else:
+            config.pop("scaling", None)
+        if not self.state_store.save_namespace(name, config):
+            return {"error": f"Failed to save namespace {name}"}
+        self.state_store.log_event(SYSTEM_EVENT_SCOPE, "namespace_scaling_defaults_updated",
+                                   {"namespace": name, "scaling": defaults})
+
+        policies, conflicting = {}, []
+        for app in self.state_store.list_apps(namespace=name):
+            scaling = (app["spec"] or {}).get("scaling") or {}
+            try:
+                policies[app["name"]] = policy_from_scaling(scaling, defaults)
+            except (ValueError, TypeError) as e:
+                conflicting.append({"app": app["name"], "error": str(e)})
+
+        logger.info(f"Updated scaling defaults for namespace {name}: {defaults}")
+        result = self.get(name)
+        result["conflicting"] = conflicting
+        result["policies"] = policies
+        return result
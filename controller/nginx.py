@@ -8,18 +8,28 @@ import logging
 import tempfile
 import shutil
 import os
+import re
+import json
+import time
+from datetime import datetime
 from jinja2 import Template
 from pathlib import Path
-from typing import List, Dict
+from typing import Any, List, Dict, Optional, Tuple
 from dotenv import load_dotenv
 
+from .log_sampling import entry_weight, weighted_percentile
+
 load_dotenv()
 
 logger = logging.getLogger(__name__)
 
+UPSTREAM_PATTERN = re.compile(r"upstream\s+app_(\S+)\s*\{")
+SERVER_PATTERN = re.compile(r"^\s*server\s+([0-9a-fA-F.:\[\]]+):(\d+)\b", re.MULTILINE)
+
 class DockerNginxManager:
-    def __init__(self, nginx_container_name: str = None, conf_dir: str = None, template_path: str = "configs/nginx_template.conf"):
-        self.docker_client = docker.from_env()
+    def __init__(self, nginx_container_name: str = None, conf_dir: str = None, template_path: str = "configs/nginx_template.conf",
+                 stream_template_path: str = "configs/nginx_stream_template.conf", docker_client: Any = None):
+        self.docker_client = docker_client or docker.from_env()
 
         self.nginx_container_name = nginx_container_name or os.getenv("ORCHESTRY_NGINX_CONTAINER")
         if not self.nginx_container_name:
@@ -31,11 +41,17 @@ class DockerNginxManager:
         else:
             logger.error("ORCHESTRY_NGINX_CONF_DIR environment variable is required. Please set it in .env file.")
             raise RuntimeError("Missing required environment variable: ORCHESTRY_NGINX_CONF_DIR")
+        # Where conf_dir is mounted inside the nginx container
+        self.container_conf_dir = os.getenv("ORCHESTRY_NGINX_CONTAINER_CONF_DIR", "/etc/nginx/conf.d")
         self.template_path = template_path or "configs/nginx_template.conf"
         self._load_template()
+        # UDP apps get stream configs, included from the stream block of nginx.conf
+        self.stream_template = Template(Path(stream_template_path).read_text())
+        self.stream_dir = self.conf_dir / "stream"
 
-        # Ensure config directory exists
+        # Ensure config directories exist
         self.conf_dir.mkdir(parents=True, exist_ok=True)
+        self.stream_dir.mkdir(parents=True, exist_ok=True)
 
         # Ensure nginx container is running
         self._ensure_nginx_container()
@@ -106,30 +122,77 @@ class DockerNginxManager:
                 return False
         return True
 
-    def update_upstreams(self, app_name: str, servers: List[Dict[str, str]]):
-        """Update nginx upstream configuration for an app."""
+    def update_upstreams(self, app_name: str, servers: List[Dict[str, str]], tracing: bool = False,
+                         auth: Optional[Dict] = None, access: Optional[Dict] = None, shadow: Optional[Dict] = None,
+                         error_pages: Optional[Dict] = None, tls: Optional[Dict] = None,
+                         access_log: Optional[Dict] = None, passive: Optional[Dict] = None,
+                         headers: Optional[Dict] = None):
+        """Update nginx upstream configuration for an app. shadow mirrors a share of its
+        requests to shadow replicas (see controller.shadow.nginx_context); error_pages
+        replaces nginx's error output (see controller.error_pages.nginx_context), and
+        with it the app keeps a config that answers 503 even without servers. tls
+        terminates HTTPS (see controller.edge_tls.EdgeTLSManager.prepare) and access_log
+        samples the access log (see controller.log_sampling.nginx_context). passive sets
+        how nginx marks failing replicas and retries their requests (see
+        controller.passive_health.nginx_context) and headers adds, replaces and removes
+        headers (see controller.edge_headers.nginx_context)."""
         try:
             if not self._validate_app_name(app_name):
                 return False
 
-            if not servers:
+            if not servers and not error_pages:
                 logger.warning(f"No servers provided for app {app_name}, removing config")
                 self.remove_app_config(app_name)
                 return False
             if not self._validate_server(servers):
                 return False
+            if shadow and not self._validate_server(shadow["servers"]):
+                return False
 
             # Render the configuration
-            config = self.template.render(app=app_name, servers=servers)
-            conf_path = self.conf_dir / f"{app_name}.conf"
-            backup_path = self.conf_dir / f"{app_name}.conf.backup"
+            config = self.template.render(app=app_name, servers=servers, tracing=tracing, auth=auth, access=access,
+                                          shadow=shadow, error_pages=error_pages, tls=tls, access_log=access_log,
+                                          passive=passive, headers=headers)
+            return self._apply_config(app_name, self.conf_dir / f"{app_name}.conf", config, len(servers))
+
+        except Exception as e:
+            logger.error(f"Failed to update nginx config for {app_name}: {e}")
+            return False
+
+    def update_stream_upstreams(self, app_name: str, servers: List[Dict[str, str]], stream: Dict,
+                                access: Optional[Dict] = None, passive: Optional[Dict] = None):
+        """Update the nginx stream (UDP) configuration for an app."""
+        try:
+            if not self._validate_app_name(app_name):
+                return False
+
+            if not servers:
+                logger.warning(f"No servers provided for app {app_name}, removing config")
+                self.remove_app_config(app_name)
+                return False
+            if not self._validate_server(servers):
+                return False
+
+            config = self.stream_template.render(app=app_name, servers=servers, access=access, passive=passive,
+                                                **stream)
+            return self._apply_config(app_name, self.stream_dir / f"{app_name}.conf", config, len(servers))
+
+        except Exception as e:
+            logger.error(f"Failed to update nginx stream config for {app_name}: {e}")
+            return False
+
+    def _apply_config(self, app_name: str, conf_path: Path, config: str, server_count: int) -> bool:
+        """Write an app's config, then test and reload nginx, restoring the previous
+        config if either fails."""
+        try:
+            backup_path = conf_path.with_name(f"{conf_path.name}.backup")
 
             if conf_path.exists():
                 shutil.copy2(conf_path, backup_path)
 
             # Write configuration to file
             with tempfile.NamedTemporaryFile(mode='w', delete=False, 
-                                           dir=self.conf_dir, suffix='.tmp') as tmp_file:
+                                           dir=conf_path.parent, suffix='.tmp') as tmp_file:
                 tmp_file.write(config)
                 tmp_path = tmp_file.name
             shutil.move(tmp_path, conf_path)
@@ -162,25 +225,99 @@ class DockerNginxManager:
             if backup_path.exists(): 
                 backup_path.unlink()
 
-            logger.info(f"Updated nginx config for {app_name} with {len(servers)} servers")
+            logger.info(f"Updated nginx config for {app_name} with {server_count} servers")
             return True
 
         except Exception as e:
             logger.error(f"Failed to update nginx config for {app_name}: {e}")
             return False
 
+    def write_auth_file(self, app_name: str, htpasswd: str) -> str:
+        """Write an app's htpasswd file and return its path inside the nginx container."""
+        if not self._validate_app_name(app_name):
+            raise ValueError(f"Invalid app name: {app_name}")
+        auth_path = self.conf_dir / f"{app_name}.htpasswd"
+        with tempfile.NamedTemporaryFile(mode='w', delete=False,
+                                         dir=self.conf_dir, suffix='.tmp') as tmp_file:
+            tmp_file.write(htpasswd.strip() + "\n")
+            tmp_path = tmp_file.name
+        os.chmod(tmp_path, 0o644)
+        shutil.move(tmp_path, auth_path)
+        return f"{self.container_conf_dir}/{app_name}.htpasswd"
+
+    def remove_auth_file(self, app_name: str):
+        """Remove an app's htpasswd file if it has one."""
+        if not self._validate_app_name(app_name):
+            return
+        auth_path = self.conf_dir / f"{app_name}.htpasswd"
+        if auth_path.exists():
+            auth_path.unlink()
+
+    def write_tls_files(self, app_name: str, certificate: str, key: str) -> Tuple[str, str]:
+        """Write an app's certificate chain and private key and return their paths inside
+        the nginx container."""
+        if not self._validate_app_name(app_name):
+            raise ValueError(f"Invalid app name: {app_name}")
+        tls_dir = self.conf_dir / "tls"
+        tls_dir.mkdir(parents=True, exist_ok=True)
+        for file_name, content, mode in ((f"{app_name}.crt", certificate, 0o644), (f"{app_name}.key", key, 0o600)):
+            with tempfile.NamedTemporaryFile(mode='w', delete=False,
+                                             dir=tls_dir, suffix='.tmp') as tmp_file:
+                tmp_file.write(content.strip() + "\n")
+                tmp_path = tmp_file.name
+            os.chmod(tmp_path, mode)
+            shutil.move(tmp_path, tls_dir / file_name)
+        return f"{self.container_conf_dir}/tls/{app_name}.crt", f"{self.container_conf_dir}/tls/{app_name}.key"
+
+    def remove_tls_files(self, app_name: str):
+        """Remove an app's certificate and key if it has them."""
+        if not self._validate_app_name(app_name):
+            return
+        for suffix in ("crt", "key"):
+            path = self.conf_dir / "tls" / f"{app_name}.{suffix}"
+            if path.exists():
+                path.unlink()
+
+    def write_error_pages(self, app_name: str, pages: Dict[str, str]) -> str:
+        """Replace an app's error page files and return their directory inside the nginx container."""
+        if not self._validate_app_name(app_name):
+            raise ValueError(f"Invalid app name: {app_name}")
+        pages_dir = self.conf_dir / "error_pages" / app_name
+        pages_dir.mkdir(parents=True, exist_ok=True)
+        for stale in pages_dir.glob("*.html"):
+            if stale.name not in pages:
+                stale.unlink()
+        for file_name, html in pages.items():
+            with tempfile.NamedTemporaryFile(mode='w', delete=False,
+                                             dir=pages_dir, suffix='.tmp') as tmp_file:
+                tmp_file.write(html)
+                tmp_path = tmp_file.name
+            os.chmod(tmp_path, 0o644)
+            shutil.move(tmp_path, pages_dir / file_name)
+        return f"{self.container_conf_dir}/error_pages/{app_name}"
+
+    def remove_error_pages(self, app_name: str):
+        """Remove an app's error page files if it has any."""
+        if not self._validate_app_name(app_name):
+            return
+        pages_dir = self.conf_dir / "error_pages" / app_name
+        if pages_dir.exists():
+            shutil.rmtree(pages_dir)
+
     def remove_app_config(self, app_name: str):
         """Remove nginx configuration for an app."""
         try:
             if not self._validate_app_name(app_name):
                 return False
 
-            conf_path = self.conf_dir / f"{app_name}.conf"
-            if not conf_path.exists():
+            conf_paths = [path for path in (self.conf_dir / f"{app_name}.conf", self.stream_dir / f"{app_name}.conf")
+                          if path.exists()]
+            if not conf_paths:
                 logger.warning(f"Config for {app_name} does not exist")
                 return True
 
-            conf_path.unlink()
+            for conf_path in conf_paths:
+                conf_path.unlink()
 
             nginx_container = self._get_nginx_container()
             test_result = nginx_container.exec_run(["nginx", "-t"])
@@ -277,7 +414,7 @@ class DockerNginxManager:
         """List all app configurations managed by this manager."""
         try:
             configs = []
-            for conf_file in self.conf_dir.glob("*.conf"):
+            for conf_file in list(self.conf_dir.glob("*.conf")) + list(self.stream_dir.glob("*.conf")):
                 if conf_file.suffix == '.conf' and not conf_file.stem.endswith('.backup'):
                     if conf_file.stem not in ["default", "nginx"]:  # Skip system configs
                         configs.append(conf_file.stem)
@@ -286,6 +423,193 @@ class DockerNginxManager:
             logger.error(f"Failed to list app configs: {e}")
             return []
 
+    def configured_upstreams(self) -> Dict[str, List[str]]:
+        """Upstream servers ("ip:port") of every app that has a conf file (HTTP or stream)."""
+        configs = {}
+        for path in sorted(self.conf_dir.glob("*.conf")) + sorted(self.stream_dir.glob("*.conf")):
+            text = path.read_text()
+            match = UPSTREAM_PATTERN.search(text)
+            if not match:
+                continue  # not an app config written by the controller
+            # Only the app's own upstream block; a shadow upstream may follow it
+            block = text[match.end():text.find("}", match.end())]
+            configs[match.group(1)] = sorted(f"{ip}:{port}" for ip, port in SERVER_PATTERN.findall(block))
+        return configs
+
+    def get_access_logs(self, app_name: str, lines: int = 100, request_id: Optional[str] = None) -> Dict:
+        """Get recent access log entries for an app, optionally only those for one request ID."""
+        try:
+            if not self._validate_app_name(app_name):
+                return {"error": f"Invalid app name: {app_name}"}
+
+            log_path = f"/var/log/nginx/{app_name}.access.log"
+            nginx_container = self._get_nginx_container()
+            if request_id:
+                # Search the whole file; an error report can arrive long after the request
+                result = nginx_container.exec_run(["grep", "-F", f'"request_id":"{request_id}"', log_path])
+            else:
+                result = nginx_container.exec_run(["tail", "-n", str(lines), log_path])
+
+            output = result.output
+            if isinstance(output, bytes):
+                output = output.decode('utf-8', errors='replace')
+
+            # grep exits 1 when nothing matched
+            if result.exit_code not in (0, 1):
+                return {"error": f"Failed to read access log for {app_name}", "details": output}
+
+            entries = []
+            for line in output.splitlines():
+                try:
+                    entries.append(json.loads(line))
+                except ValueError:
+                    continue
+            return {"app": app_name, "entries": entries[-lines:], "count": len(entries[-lines:])}
+
+        except Exception as e:
+            logger.error(f"Failed to get access logs for {app_name}: {e}")
+            return {"error": str(e)}
+
+    def get_upstream_errors(self, app_name: str, seconds: int, lines: int = 5000) -> Optional[Dict]:
+        """Count an app's requests, 502/504 responses and failed upstream attempts over the last
+        `seconds` from its access log, weighting sampled entries. Returns None if the log cannot
+        be read or only has errors."""
+        try:
+            if not self._validate_app_name(app_name):
+                return None
+            log_path = f"/var/log/nginx/{app_name}.access.log"
+            result = self._get_nginx_container().exec_run(["tail", "-n", str(lines), log_path])
+            if result.exit_code != 0:
+                return None
+            output = result.output
+            if isinstance(output, bytes):
+                output = output.decode('utf-8', errors='replace')
+
+            cutoff = time.time() - seconds
+            counts = {"requests": 0, "bad_gateway": 0, "gateway_timeout": 0, "upstream_errors": 0}
+            for line in output.splitlines():
+                try:
+                    entry = json.loads(line)
+                    if datetime.fromisoformat(entry["time"]).timestamp() < cutoff:
+                        continue
+                except (ValueError, KeyError, TypeError):
+                    continue
+                weight = entry_weight(entry)
+                if weight is None:
+                    return None
+                counts["requests"] += weight
+                if entry.get("status") == 502:
+                    counts["bad_gateway"] += 1
+                elif entry.get("status") == 504:
+                    counts["gateway_timeout"] += 1
+                else:
+                    # "502, 200": a replica refused or timed out and nginx retried on another one
+                    attempts = str(entry.get("upstream_status", "")).replace(" : ", ", ").split(", ")
+                    counts["upstream_errors"] += weight * sum(1 for status in attempts if status in ("502", "504"))
+            return counts
+
+        except Exception as e:
+            logger.debug(f"Failed to count upstream errors for {app_name}: {e}")
+            return None
+
+    def get_upstream_latencies(self, app_name: str, seconds: int, lines: int = 5000) -> Optional[Dict]:
+        """Per-upstream (ip:port) request count, 5xx count and mean response time in ms over
+        the last `seconds` from the app's access log, weighting sampled entries. Returns None if
+        the log cannot be read or only has errors."""
+        try:
+            if not self._validate_app_name(app_name):
+                return None
+            log_path = f"/var/log/nginx/{app_name}.access.log"
+            result = self._get_nginx_container().exec_run(["tail", "-n", str(lines), log_path])
+            if result.exit_code != 0:
+                return None
+            output = result.output
+            if isinstance(output, bytes):
+                output = output.decode('utf-8', errors='replace')
+
+            cutoff = time.time() - seconds
+            totals: Dict[str, List[float]] = {}  # upstream -> [weighted ms, requests]
+            errors: Dict[str, int] = {}
+            for line in output.splitlines():
+                try:
+                    entry = json.loads(line)
+                    if datetime.fromisoformat(entry["time"]).timestamp() < cutoff:
+                        continue
+                except (ValueError, KeyError, TypeError):
+                    continue
+                weight = entry_weight(entry)
+                if weight is None:
+                    return None
+                # Retried requests list every attempt: "10.0.0.2:80, 10.0.0.3:80" / "0.500, 0.012"
+                upstreams = str(entry.get("upstream", "")).replace(" : ", ", ").split(", ")
+                times = str(entry.get("upstream_response_time", "")).replace(" : ", ", ").split(", ")
+                statuses = str(entry.get("upstream_status", "")).replace(" : ", ", ").split(", ")
+                for upstream, response_time, status in zip(upstreams, times, statuses):
+                    if status.startswith("5"):
+                        errors[upstream] = errors.get(upstream, 0) + weight
+                    try:
+                        total = totals.setdefault(upstream, [0.0, 0])
+                        total[0] += float(response_time) * 1000 * weight
+                        total[1] += weight
+                    except ValueError:
+                        continue  # "-" when no response was received
+            return {
+                upstream: {"requests": count, "errors": errors.get(upstream, 0), "mean_ms": total_ms / count}
+                for upstream, (total_ms, count) in totals.items()
+            }
+
+        except Exception as e:
+            logger.debug(f"Failed to read upstream latencies for {app_name}: {e}")
+            return None
+
+    def get_response_stats(self, app_name: str, seconds: int, shadow: bool = False,
+                           lines: int = 5000) -> Optional[Dict]:
+        """Request count, 5xx count, and mean and p95 response time in ms over the last `seconds`
+        of an app's access log, weighting sampled entries, or of its shadow log (mirrored
+        requests). Returns None if the log cannot be read or only has errors."""
+        try:
+            if not self._validate_app_name(app_name):
+                return None
+            log_path = f"/var/log/nginx/{app_name}.{'shadow' if shadow else 'access'}.log"
+            result = self._get_nginx_container().exec_run(["tail", "-n", str(lines), log_path])
+            if result.exit_code != 0:
+                # No shadow log yet just means nothing was mirrored
+                return {"requests": 0, "errors": 0, "mean_ms": None, "p95_ms": None} if shadow else None
+            output = result.output
+            if isinstance(output, bytes):
+                output = output.decode('utf-8', errors='replace')
+
+            cutoff = time.time() - seconds
+            samples: List[Tuple[float, int]] = []  # (ms, requests the entry stands for)
+            errors = 0
+            for line in output.splitlines():
+                try:
+                    entry = json.loads(line)
+                    if datetime.fromisoformat(entry["time"]).timestamp() < cutoff:
+                        continue
+                    if shadow and not entry.get("upstream"):
+                        continue  # a request that was not selected for mirroring
+                    # The shadow log is never sampled
+                    weight = 1 if shadow else entry_weight(entry)
+                    if weight is None:
+                        return None
+                    samples.append((float(entry["request_time"]) * 1000, weight))
+                except (ValueError, KeyError, TypeError):
+                    continue
+                if int(entry.get("status", 0)) >= 500:
+                    errors += 1
+            requests = sum(weight for _, weight in samples)
+            return {
+                "requests": requests,
+                "errors": errors,
+                "mean_ms": sum(ms * weight for ms, weight in samples) / requests if samples else None,
+                "p95_ms": weighted_percentile(samples, 0.95)
+            }
+
+        except Exception as e:
+            logger.debug(f"Failed to read response stats for {app_name}: {e}")
+            return None
+
     def get_container_logs(self, lines: int = 100) -> str:
         """Get nginx container logs."""
         try:
@@ -296,6 +620,13 @@ class DockerNginxManager:
             logger.error(f"Failed to get nginx logs: {e}")
             return f"Error getting logs: {e}"
 
+    def pause(self):
+        """Pause the nginx container; traffic stalls until unpause()."""
+        self._get_nginx_container().pause()
+
+    def unpause(self):
+        self._get_nginx_container().unpause()
+
     def restart_nginx(self) -> bool:
         """Restart the nginx container."""
         try:
@@ -0,0 +1,104 @@
+"""
+Operation journal for crash recovery.
+Scales and rolling updates change an app's replicas one container at a time.
+If the leader dies halfway, reconciliation adopts whatever containers happen
+to be running, which can leave a scale short of its target or an app with a
+mix of old and new replicas. Before such an operation touches anything, the
+leader writes its intent to the operation_journal table, then records each
+step as it completes and closes the entry when the operation ends.
+
+When a node becomes leader (on startup or failover) it reconciles the
+containers and then goes through the entries still in progress: scales are
+replayed to their target, interrupted rollouts are resumed from the replicas
+not replaced yet, and rollouts that were rolling back finish their rollback.
+A replica a rollout had started but not yet swapped in is removed first.
+Entries of apps that were deleted or stopped in the meantime are abandoned.
+Finished entries are kept for ORCHESTRY_OPERATION_JOURNAL_RETENTION_DAYS.
+"""
+
+import os
+import time
+import uuid
+import logging
+import threading
+from typing import Any, Dict, List, Optional
+
+logger = logging.getLogger(__name__)
+
+JOURNAL_RETENTION_DAYS = float(os.getenv("ORCHESTRY_OPERATION_JOURNAL_RETENTION_DAYS", "7"))
+JOURNAL_CLEANUP_INTERVAL_SECONDS = 3600
+# in_progress until the operation ends; the others are final
+STATUSES = ("in_progress", "completed", "failed", "rolled_back", "replayed", "abandoned")
+# Recorded as requested_by on operations the journal replays
+RECOVERY_REQUESTER = "operation-journal"
+
+class OperationJournal:
+    """Writes journal entries of the operations this process runs and finds the ones
+    a previous leader left unfinished. Journal writes that fail are logged, not raised:
+    an operation is never blocked because it could not be journaled."""
+
+    def __init__(self, state_store: Any):
+        self.state_store = state_store
+        self._active = set()  # IDs of entries whose operation runs in this process
+        self._lock = threading.Lock()
+        self._last_cleanup = 0.0
+
+    def begin(self, app_name: str, operation: str, intent: Dict[str, Any],
+              requested_by: Optional[str] = None) -> Optional[str]:
+        """Record the intent of an operation about to start. Returns the entry ID, or None."""
+        self._cleanup()
+        entry = {
+            "id": uuid.uuid4().hex[:12],
+            "app": app_name,
+            "operation": operation,
+            "intent": intent,
+            "status": "in_progress",
+            "requested_by": requested_by,
+            "started_at": time.time()
+        }
+        if not self.state_store.save_journal_entry(entry):
+            logger.warning(f"Could not journal {operation} of {app_name}; it cannot be recovered after a crash")
+            return None
+        with self._lock:
+            self._active.add(entry["id"])
+        return entry["id"]
+
+    def step(self, entry_id: Optional[str], step: str, **details):
+        if entry_id:
+            self.state_store.append_journal_step(entry_id, {"step": step, "at": time.time(), **details})
+
+    def adopt(self, entry_id: Optional[str]):
+        """Take over an entry a previous leader left unfinished."""
+        if entry_id:
+            with self._lock:
+                self._active.add(entry_id)
+
+    def finish(self, entry_id: Optional[str], status: str, result: Optional[Dict[str, Any]] = None):
+        if not entry_id:
+            return
+        with self._lock:
+            self._active.discard(entry_id)
+        self.state_store.finish_journal_entry(entry_id, status, result)
+
+    def unfinished(self) -> List[Dict[str, Any]]:
+        """Entries still in progress that no operation in this process is working on, oldest first."""
+        entries = self.state_store.list_journal_entries(status="in_progress", limit=1000, oldest_first=True)
+        with self._lock:
+            return [entry for entry in entries if entry["id"] not in self._active]
+
+    def list(self, app_name: Optional[str] = None, status: Optional[str] = None,
+             limit: int = 100) -> Dict[str, Any]:
+        entries = self.state_store.list_journal_entries(app_name, status, limit)
+        return {"entries": entries, "count": len(entries)}
+
+    def _cleanup(self):
+        now = time.time()
+        if now - self._last_cleanup < JOURNAL_CLEANUP_INTERVAL_SECONDS:
+            return
+        self._last_cleanup = now
+        removed = self.state_store.cleanup_journal_entries(now - JOURNAL_RETENTION_DAYS * 24 * 3600)
+        if removed:
+            logger.debug(f"Removed {removed} finished operation journal entries")
+
+def steps_named(entry: Dict[str, Any], step: str) -> List[Dict[str, Any]]:
+    return [s for s in entry.get("steps") or [] if s.get("step") == step]
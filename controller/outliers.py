@@ -0,0 +1,78 @@
+"""
+Outlier detection for replicas.
+With `outlierDetection.enabled`, the controller compares each replica's
+error rate and mean response time (from the app's nginx access log) with its
+siblings'. A replica that is far worse than the median of the others is
+quarantined before its health endpoint starts failing: it is taken out of
+nginx, its recent logs and stats are recorded in an incident event, and it is
+replaced by a fresh replica.
+"""
+
+import statistics
+from typing import Any, Dict, Optional, Tuple
+
+DEFAULT_INTERVAL_SECONDS = 30
+DEFAULT_MIN_REQUESTS = 20
+DEFAULT_ERROR_RATE_FACTOR = 3.0
+DEFAULT_LATENCY_FACTOR = 3.0
+# An error rate this much above the siblings' median is needed too, so 0.1% vs 0.4% is no outlier
+MIN_ERROR_RATE_EXCESS = 0.05
+# Likewise for latency, in milliseconds
+MIN_LATENCY_EXCESS_MS = 50.0
+# Replicas (with enough traffic) needed to tell an outlier from normal behavior
+MIN_REPLICAS = 3
+# Lines of the quarantined replica's logs kept in the incident event
+INCIDENT_LOG_LINES = 100
+
+def validate_outlier_detection(config: Any, app_spec: Dict[str, Any]) -> Tuple[Optional[Dict[str, Any]], Optional[str]]:
+    """Normalize `outlierDetection`. Returns (config to store or None, error)."""
+    if config is None:
+        return None, None
+    if isinstance(config, bool):
+        config = {"enabled": config}
+    if not isinstance(config, dict):
+        return None, "outlierDetection must be true/false or an object"
+    if not config.get("enabled", True):
+        return None, None
+    if app_spec.get("type") != "http":
+        return None, "outlierDetection is only supported for http apps"
+
+    normalized = {"enabled": True}
+    for key, default, low, high in (("intervalSeconds", DEFAULT_INTERVAL_SECONDS, 10, 3600),
+                                    ("minRequests", DEFAULT_MIN_REQUESTS, 1, 100000),
+                                    ("errorRateFactor", DEFAULT_ERROR_RATE_FACTOR, 1.5, 100),
+                                    ("latencyFactor", DEFAULT_LATENCY_FACTOR, 1.5, 100)):
+        value = config.get(key, default)
+        if not isinstance(value, (int, float)) or isinstance(value, bool) or not low <= value <= high:
+            return None, f"outlierDetection.{key} must be between {low} and {high}"
+        normalized[key] = value
+    return normalized, None
+
+def detection_config(app_spec: Dict[str, Any]) -> Optional[Dict[str, Any]]:
+    return app_spec.get("outlierDetection")
+
+def find_outlier(stats: Dict[str, Dict[str, float]], config: Dict[str, Any]) -> Optional[Tuple[str, str]]:
+    """The worst outlier among upstreams (ip:port -> requests, errors, mean_ms) and why,
+    or None. Each upstream is compared with the median of the others."""
+    measured = {upstream: s for upstream, s in stats.items() if s["requests"] >= config["minRequests"]}
+    if len(measured) < MIN_REPLICAS:
+        return None
+
+    worst = None
+    for upstream, s in measured.items():
+        others = [o for u, o in measured.items() if u != upstream]
+        error_rate = s["errors"] / s["requests"]
+        median_rate = statistics.median(o["errors"] / o["requests"] for o in others)
+        if error_rate >= median_rate * config["errorRateFactor"] and error_rate - median_rate >= MIN_ERROR_RATE_EXCESS:
+            score = (1, error_rate - median_rate)
+            reason = f"error rate {error_rate:.1%} vs {median_rate:.1%} median of siblings"
+        else:
+            median_ms = statistics.median(o["mean_ms"] for o in others)
+            if s["mean_ms"] < median_ms * config["latencyFactor"] or s["mean_ms"] - median_ms < MIN_LATENCY_EXCESS_MS:
+                continue
+            # Latency outliers rank below any error rate outlier
+            score = (0, s["mean_ms"] / max(median_ms, 1.0))
+            reason = f"mean latency {s['mean_ms']:.0f}ms vs {median_ms:.0f}ms median of siblings"
+        if not worst or score > worst[0]:
+            worst = (score, upstream, reason)
+    return (worst[1], worst[2]) if worst else None
@@ -0,0 +1,84 @@
+"""
+Passive health checks.
+The controller's health checker probes replicas every few seconds; between
+probes nginx itself notices replicas that fail requests. After `maxFails`
+failed attempts within `failTimeoutSeconds` nginx stops sending the replica
+requests for `failTimeoutSeconds`, and a request whose attempt fails with one
+of the `nextUpstream` conditions is retried on another replica:
+
+    passiveHealth:
+      maxFails: 2
+      failTimeoutSeconds: 10
+      nextUpstream: [error, timeout, http_502, http_503]
+      nextUpstreamTries: 2
+
+maxFails 0 turns the passive check off, and nextUpstream [off] never retries
+a failed request. UDP apps can only set maxFails and failTimeoutSeconds.
+Without the block apps keep nginx's previous behaviour (3 failures in 5
+seconds, retries on errors, timeouts, 502, 503 and 504).
+"""
+
+from typing import Any, Dict, Optional, Tuple
+
+DEFAULT_MAX_FAILS = 3
+DEFAULT_FAIL_TIMEOUT_SECONDS = 5
+DEFAULT_NEXT_UPSTREAM = ["error", "timeout", "http_502", "http_503", "http_504"]
+MAX_FAILS_LIMIT = 100
+MAX_FAIL_TIMEOUT_SECONDS = 3600
+MAX_TRIES = 10
+MAX_NEXT_UPSTREAM_TIMEOUT_SECONDS = 300
+NEXT_UPSTREAM_CONDITIONS = ("error", "timeout", "invalid_header", "http_500", "http_502", "http_503",
+                            "http_504", "http_403", "http_404", "http_429", "non_idempotent", "off")
+FIELDS = {"maxFails", "failTimeoutSeconds", "nextUpstream", "nextUpstreamTries", "nextUpstreamTimeoutSeconds"}
+HTTP_ONLY_FIELDS = {"nextUpstream", "nextUpstreamTries", "nextUpstreamTimeoutSeconds"}
+
+def _integer(config: Dict[str, Any], field: str, low: int, high: int) -> Optional[str]:
+    value = config.get(field)
+    if value is None:
+        return None
+    if not isinstance(value, int) or isinstance(value, bool) or not low <= value <= high:
+        return f"passiveHealth.{field} must be an integer between {low} and {high}"
+    return None
+
+def validate_passive_health(config: Any, udp: bool = False) -> Tuple[Optional[Dict[str, Any]], Optional[str]]:
+    """Normalize `passiveHealth`. Returns (config to store or None, error)."""
+    if config is None:
+        return None, None
+    if not isinstance(config, dict):
+        return None, "passiveHealth must be an object"
+    unknown = set(config) - FIELDS
+    if unknown:
+        return None, f"Unknown passiveHealth field(s): {', '.join(sorted(unknown))}"
+    if udp and set(config) & HTTP_ONLY_FIELDS:
+        return None, f"passiveHealth.{sorted(set(config) & HTTP_ONLY_FIELDS)[0]} is only supported for HTTP apps"
+    for field, low, high in (("maxFails", 0, MAX_FAILS_LIMIT),
+                             ("failTimeoutSeconds", 1, MAX_FAIL_TIMEOUT_SECONDS),
+                             ("nextUpstreamTries", 0, MAX_TRIES),
+                             ("nextUpstreamTimeoutSeconds", 0, MAX_NEXT_UPSTREAM_TIMEOUT_SECONDS)):
+        error = _integer(config, field, low, high)
+        if error:
+            return None, error
+    conditions = config.get("nextUpstream")
+    if conditions is not None:
+        if not isinstance(conditions, list) or not conditions:
+            return None, "passiveHealth.nextUpstream must be a non-empty list"
+        unknown = [c for c in conditions if c not in NEXT_UPSTREAM_CONDITIONS]
+        if unknown:
+            return None, (f"passiveHealth.nextUpstream has unknown condition {unknown[0]!r}, "
+                          f"expected {', '.join(NEXT_UPSTREAM_CONDITIONS)}")
+        if "off" in conditions and len(conditions) > 1:
+            return None, "passiveHealth.nextUpstream cannot combine off with other conditions"
+        # nginx rejects repeated conditions
+        config = {**config, "nextUpstream": list(dict.fromkeys(conditions))}
+    return {field: config[field] for field in sorted(FIELDS) if config.get(field) is not None} or None, None
+
+def nginx_context(spec: Dict[str, Any]) -> Dict[str, Any]:
+    """What the nginx templates need for an app's passive health checks."""
+    config = spec.get("passiveHealth") or {}
+    return {
+        "max_fails": config.get("maxFails", DEFAULT_MAX_FAILS),
+        "fail_timeout": config.get("failTimeoutSeconds", DEFAULT_FAIL_TIMEOUT_SECONDS),
+        "next_upstream": " ".join(config.get("nextUpstream", DEFAULT_NEXT_UPSTREAM)),
+        "tries": config.get("nextUpstreamTries"),
+        "timeout": config.get("nextUpstreamTimeoutSeconds")
+    }
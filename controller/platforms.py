@@ -0,0 +1,77 @@
+"""
+Container platform (OS/architecture) handling.
+Apps can pin a platform such as `linux/arm64` in `spec.platform`. It is passed to
+Docker when containers are created, and must be a platform the Docker host can
+run: its native one, or one listed in ORCHESTRY_EXTRA_PLATFORMS (e.g. when
+QEMU/binfmt emulation is installed).
+"""
+
+import os
+import logging
+from typing import Any, List, Optional, Tuple
+
+logger = logging.getLogger(__name__)
+
+KNOWN_OS = ("linux", "windows")
+KNOWN_ARCHITECTURES = ("amd64", "arm64", "arm", "386", "ppc64le", "s390x", "riscv64")
+# uname-style names reported by `docker info` -> OCI platform names
+ARCH_ALIASES = {
+    "x86_64": "amd64",
+    "x86-64": "amd64",
+    "aarch64": "arm64",
+    "armv7l": "arm/v7",
+    "armv6l": "arm/v6",
+    "armhf": "arm/v7",
+    "i386": "386",
+    "i686": "386",
+}
+
+def _split(platform: str) -> Tuple[str, str, Optional[str]]:
+    parts = platform.split("/")
+    return parts[0], parts[1], parts[2] if len(parts) > 2 else None
+
+def normalize_platform(value: Any) -> Tuple[Optional[str], Optional[str]]:
+    """Normalize a platform string to os/arch[/variant]. Returns (platform, error)."""
+    if value is None or value == "":
+        return None, None
+    parts = str(value).strip().lower().split("/")
+    if len(parts) not in (2, 3) or not all(parts):
+        return None, f"platform '{value}' must look like os/arch or os/arch/variant (e.g. linux/arm64)"
+
+    os_name = parts[0]
+    arch = ARCH_ALIASES.get(parts[1], parts[1])
+    if "/" in arch:
+        # Alias already carries a variant (armv7l -> arm/v7)
+        arch, variant = arch.split("/")
+        variant = parts[2] if len(parts) == 3 else variant
+    else:
+        variant = parts[2] if len(parts) == 3 else None
+
+    if os_name not in KNOWN_OS:
+        return None, f"platform OS '{os_name}' is not supported (use one of {', '.join(KNOWN_OS)})"
+    if arch not in KNOWN_ARCHITECTURES:
+        return None, f"platform architecture '{parts[1]}' is not supported (use one of {', '.join(KNOWN_ARCHITECTURES)})"
+    return "/".join(p for p in (os_name, arch, variant) if p), None
+
+def host_platforms(docker_client: Any) -> List[str]:
+    """Platforms the Docker host can run: the native one plus ORCHESTRY_EXTRA_PLATFORMS."""
+    info = docker_client.info()
+    native, _ = normalize_platform(f"{info.get('OSType', 'linux')}/{info.get('Architecture', 'x86_64')}")
+    platforms = [native] if native else []
+    for extra in os.getenv("ORCHESTRY_EXTRA_PLATFORMS", "").split(","):
+        normalized, error = normalize_platform(extra.strip())
+        if error:
+            logger.warning(f"Ignoring ORCHESTRY_EXTRA_PLATFORMS entry: {error}")
+        elif normalized and normalized not in platforms:
+            platforms.append(normalized)
+    return platforms
+
+def unsupported_reason(platform: str, supported: List[str]) -> Optional[str]:
+    """Why the host cannot run platform, or None if it can. A variant only has
+    to match when both sides name one."""
+    os_name, arch, variant = _split(platform)
+    for candidate in supported:
+        c_os, c_arch, c_variant = _split(candidate)
+        if c_os == os_name and c_arch == arch and (not variant or not c_variant or variant == c_variant):
+            return None
+    return f"platform {platform} is not supported by the Docker host (supports: {', '.join(supported) or 'unknown'})"
@@ -0,0 +1,122 @@
+"""
+Host port publishing for app replicas.
+Normally replicas are only reachable through nginx on the orchestry network.
+An app can also publish its first container port on the Docker host, either
+on a fixed base port (`hostPort`: replica N gets hostPort + N) or on ports
+picked from a range (`publishRange`). Assignments are kept per Docker host in
+the database, so replicas keep their port when they are recreated and two
+apps never get the same port.
+"""
+
+import os
+import re
+import logging
+from typing import Any, Dict, List, Optional, Tuple
+
+logger = logging.getLogger(__name__)
+
+PORT_RANGE_PATTERN = re.compile(r"^\s*(\d{1,5})\s*-\s*(\d{1,5})\s*$")
+# Address published ports are bound to on the Docker host
+PUBLISH_HOST_IP = os.getenv("ORCHESTRY_PUBLISH_HOST_IP", "0.0.0.0")
+
+def _valid_port(port: Any) -> bool:
+    return isinstance(port, int) and not isinstance(port, bool) and 1 <= port <= 65535
+
+def validate_publishing(spec: Dict[str, Any]) -> Tuple[Dict[str, Any], Optional[str]]:
+    """Normalize an app's `hostPort` / `publishRange`. Returns (fields to store, error)."""
+    host_port = spec.get("hostPort")
+    publish_range = spec.get("publishRange")
+    if host_port is None and not publish_range:
+        return {}, None
+    if host_port is not None and publish_range:
+        return {}, "hostPort and publishRange cannot both be set"
+
+    if host_port is not None:
+        if isinstance(host_port, str) and host_port.isdigit():
+            host_port = int(host_port)
+        if not _valid_port(host_port):
+            return {}, "hostPort must be a port number between 1 and 65535"
+        return {"hostPort": host_port}, None
+
+    if isinstance(publish_range, str):
+        match = PORT_RANGE_PATTERN.match(publish_range)
+        bounds = [int(match.group(1)), int(match.group(2))] if match else None
+    elif isinstance(publish_range, list) and len(publish_range) == 2:
+        bounds = publish_range
+    else:
+        bounds = None
+    if not bounds or not all(_valid_port(port) for port in bounds) or bounds[0] > bounds[1]:
+        return {}, "publishRange must look like 30000-30099 (lowest port first, ports 1-65535)"
+    return {"publishRange": bounds}, None
+
+def candidate_ports(spec: Dict[str, Any], replica_index: int) -> Optional[List[int]]:
+    """The host ports a replica may be published on, in order of preference, or None if
+    the app does not publish host ports."""
+    if spec.get("hostPort"):
+        return [spec["hostPort"] + replica_index]
+    if spec.get("publishRange"):
+        low, high = spec["publishRange"]
+        return list(range(low, high + 1))
+    return None
+
+def published_port(container: Any) -> Optional[int]:
+    """The host port a container's first port is published on, if any."""
+    bindings = (container.attrs.get("HostConfig") or {}).get("PortBindings") or {}
+    for binding in bindings.values():
+        for entry in binding or []:
+            if str(entry.get("HostPort", "")).isdigit():
+                return int(entry["HostPort"])
+    return None
+
+class PortAllocator:
+    """Assigns host ports to replicas of apps that publish them."""
+
+    def __init__(self, state_store: Any, docker_client: Any):
+        self.state_store = state_store
+        self.docker_client = docker_client
+        self._host: Optional[str] = None
+
+    @property
+    def host(self) -> str:
+        """Name of the Docker host that ports are published on."""
+        if self._host is None:
+            try:
+                self._host = self.docker_client.info().get("Name") or "default"
+            except Exception as e:
+                logger.warning(f"Could not read the Docker host name, assigning ports to 'default': {e}")
+                return "default"
+        return self._host
+
+    def check_available(self, app_name: str, spec: Dict[str, Any]) -> Optional[str]:
+        """Error if the app's fixed hostPort is already assigned to another app."""
+        if not spec.get("hostPort"):
+            return None
+        owner = self.state_store.get_host_port_owner(self.host, spec["hostPort"])
+        if owner and owner["app_name"] != app_name:
+            return f"hostPort {spec['hostPort']} is already used by {owner['app_name']} (replica {owner['replica']})"
+        return None
+
+    def apply(self, container_config: Dict[str, Any], app_name: str, replica_index: int,
+              spec: Dict[str, Any]) -> Optional[int]:
+        """Publish the replica's container port on its assigned host port. Returns the host
+        port, or None if the app does not publish one. Raises if no port is free."""
+        candidates = candidate_ports(spec, replica_index)
+        if candidates is None:
+            return None
+        candidates = [port for port in candidates if port <= 65535]
+        host_port = self.state_store.allocate_host_port(self.host, app_name, replica_index, candidates)
+        if host_port is None:
+            raise RuntimeError(f"No free host port for {app_name} replica {replica_index} "
+                               f"(tried {candidates[0] if candidates else '-'}..{candidates[-1] if candidates else '-'})")
+        container_port = spec["ports"][0]["containerPort"]
+        protocol = "udp" if str(spec["ports"][0].get("protocol", "")).upper() == "UDP" else "tcp"
+        container_config["ports"] = {f"{container_port}/{protocol}": (PUBLISH_HOST_IP, host_port)}
+        logger.info(f"Publishing {app_name} replica {replica_index} on {self.host}:{host_port}")
+        return host_port
+
+    def release(self, app_name: str) -> int:
+        """Free every host port assigned to an app."""
+        return self.state_store.release_host_ports(self.host, app_name)
+
+    def assignments(self, app_name: Optional[str] = None) -> List[Dict[str, Any]]:
+        return self.state_store.list_host_ports(self.host, app_name)
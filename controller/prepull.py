@@ -0,0 +1,144 @@
+"""
+Image pre-pulls across controller nodes.
+Each controller node runs containers on its own Docker host, so a replica
+started on a node whose host lacks the image waits for a registry pull. When
+an app is registered or updated (or something expects it to scale soon), the
+leader records a pre-pull request for its image; every node pulls requested
+images in the background and records its progress in the image_prepulls
+table, which the app status reports per node.
+"""
+
+import os
+import time
+import logging
+import threading
+from typing import Any, Dict, List, Optional
+
+from docker.utils import parse_repository_tag
+
+logger = logging.getLogger(__name__)
+
+PREPULL_ENABLED = os.getenv("ORCHESTRY_IMAGE_PREPULL", "true").lower() in ("1", "true", "yes")
+# How often each node looks for new pre-pull requests
+PREPULL_POLL_SECONDS = 5
+# A failed pull is retried after this long
+PREPULL_RETRY_SECONDS = 60
+
+def app_images(state_store: Any) -> Dict[str, List[str]]:
+    """Images of all registered apps, mapped to the apps using them."""
+    images: Dict[str, List[str]] = {}
+    for app in state_store.list_apps():
+        # Archived apps get their image pulled again when they are restored and started
+        if app.get("status") == "archived":
+            continue
+        record = state_store.get_app(app["name"])
+        image = (record.spec or {}).get("image") if record else None
+        if image:
+            images.setdefault(image, []).append(app["name"])
+    return images
+
+class ImagePrePuller:
+    """Pulls requested images on this node's Docker host."""
+
+    def __init__(self, state_store: Any, docker_client: Any, cluster_controller: Any):
+        self.state_store = state_store
+        self.docker_client = docker_client
+        self.cluster = cluster_controller
+        self._active = False
+        self._thread: Optional[threading.Thread] = None
+
+    @property
+    def node_id(self) -> str:
+        return self.cluster.node_id
+
+    def request(self, image: str, reason: str) -> bool:
+        """Ask every node to pull an image, even if it pulled it before (tags move)."""
+        if not PREPULL_ENABLED or not image:
+            return False
+        logger.info(f"Requesting a pre-pull of {image} on all nodes ({reason})")
+        return self.state_store.request_image_prepull(image, reason)
+
+    def start(self):
+        if not PREPULL_ENABLED or self._active:
+            return
+        self._active = True
+        self._thread = threading.Thread(target=self._loop, daemon=True)
+        self._thread.start()
+        logger.info(f"Image pre-puller started on node {self.node_id}")
+
+    def stop(self):
+        self._active = False
+
+    def _loop(self):
+        while self._active:
+            try:
+                self.run_once()
+            except Exception as e:
+                logger.error(f"Error in image pre-pull loop: {e}")
+            time.sleep(PREPULL_POLL_SECONDS)
+
+    def run_once(self) -> int:
+        """Pull every requested image this node has not pulled since it was requested.
+        Returns the number of images pulled."""
+        requests = self.state_store.list_image_prepull_requests()
+        if not requests:
+            return 0
+        in_use = app_images(self.state_store)
+        stale = [r["image"] for r in requests if r["image"] not in in_use]
+        if stale:
+            # Apps moved to another image or were deleted; nothing left to warm up
+            self.state_store.delete_image_prepull_requests(stale)
+
+        done = {row["image"]: row for row in self.state_store.list_image_prepulls(node_id=self.node_id)}
+        pulled = 0
+        now = time.time()
+        for req in requests:
+            if req["image"] not in in_use:
+                continue
+            row = done.get(req["image"])
+            if row and row["requested_at"] >= req["requested_at"]:
+                if row["status"] != "failed" or now - row["updated_at"] < PREPULL_RETRY_SECONDS:
+                    continue
+            if self._pull(req["image"], req["requested_at"]):
+                pulled += 1
+        return pulled
+
+    def _pull(self, image: str, requested_at: float) -> bool:
+        self.state_store.save_image_prepull(image, self.node_id, "pulling", requested_at)
+        started = time.time()
+        try:
+            repository, tag = parse_repository_tag(image)
+            self.docker_client.images.pull(repository, tag=tag or "latest")
+        except Exception as e:
+            logger.warning(f"Pre-pull of {image} on node {self.node_id} failed: {e}")
+            self.state_store.save_image_prepull(image, self.node_id, "failed", requested_at, str(e)[:500])
+            return False
+        logger.info(f"Pre-pulled {image} on node {self.node_id} in {time.time() - started:.1f}s")
+        self.state_store.save_image_prepull(image, self.node_id, "pulled", requested_at)
+        return True
+
+    def status(self, image: str) -> Dict[str, Any]:
+        """Pre-pull state of an image on each known node. Nodes that have not picked up
+        the latest request yet show as pending."""
+        requests = {r["image"]: r for r in self.state_store.list_image_prepull_requests()}
+        req = requests.get(image)
+        rows = {row["node_id"]: row for row in self.state_store.list_image_prepulls(image=image)}
+        node_ids = {node.node_id for node in list(self.cluster.cluster_nodes.values())
+                    if node.state.value != "stopped"}
+        node_ids.add(self.node_id)
+
+        nodes = {}
+        for node_id in sorted(node_ids | set(rows)):
+            row = rows.get(node_id)
+            if req and (not row or row["requested_at"] < req["requested_at"]):
+                nodes[node_id] = {"status": "pending"}
+            elif row:
+                nodes[node_id] = {"status": row["status"], "updated_at": row["updated_at"]}
+                if row["error"]:
+                    nodes[node_id]["error"] = row["error"]
+        return {
+            "image": image,
+            "requested_at": req["requested_at"] if req else None,
+            "reason": req["reason"] if req else None,
+            "nodes": nodes
+        }
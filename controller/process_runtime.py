@@ -0,0 +1,608 @@
+"""
+Process runtime (experimental).
+Apps with `spec.runtime: process` run a command on the controller host instead
+of a container, as a systemd transient unit or as a plain child process. Each
+replica gets its own port in $PORT and is reached at the host's address, so the
+health checks, scaling and nginx upstreams work exactly as for containers.
+
+ProcessRuntime implements the container calls of ContainerRuntime for these
+replicas; RoutedRuntime sends process replicas to it and everything else to
+the container runtime. Replica state is kept in ORCHESTRY_PROCESS_STATE_DIR so
+a restarted controller finds its processes again.
+"""
+
+import os
+import json
+import time
+import uuid
+import shlex
+import shutil
+import signal
+import socket
+import logging
+import threading
+import subprocess
+from pathlib import Path
+from typing import Any, Callable, Dict, List, Optional, Tuple
+
+import docker
+
+from .runtime import EventStream, ExecResult, labels_match
+
+logger = logging.getLogger(__name__)
+
+RUNTIME_LABEL = "orchestry.runtime"
+# Off by default: process apps run arbitrary commands on the controller host
+PROCESS_RUNTIME_ENABLED = os.getenv("ORCHESTRY_PROCESS_RUNTIME", "false").lower() in ("1", "true", "yes")
+PROCESS_BACKENDS = ("auto", "systemd", "exec")
+PROCESS_BACKEND = os.getenv("ORCHESTRY_PROCESS_BACKEND", "auto").strip().lower()
+PROCESS_STATE_DIR = os.getenv("ORCHESTRY_PROCESS_STATE_DIR", "/var/lib/orchestry/processes")
+PROCESS_PORT_RANGE = os.getenv("ORCHESTRY_PROCESS_PORT_RANGE", "31000-31999")
+# Address nginx and the health checker use to reach process replicas (default: the
+# gateway of the orchestry network, i.e. the host as seen from the nginx container)
+PROCESS_ADDRESS = os.getenv("ORCHESTRY_PROCESS_ADDRESS", "")
+# How often running processes are checked for exits
+PROCESS_POLL_SECONDS = 2
+STOP_TIMEOUT_SECONDS = 10
+# Spec fields that only make sense for containers
+CONTAINER_ONLY_FIELDS = ("platform", "dns", "extraHosts", "sysctls", "ulimits", "shmSize", "tmpfs",
+                         "storageSize", "hostPort", "publishRange", "security")
+
+def is_process(app_spec: Dict[str, Any]) -> bool:
+    return (app_spec or {}).get("runtime") == "process"
+
+def validate_process(app_spec: Dict[str, Any]) -> Tuple[Optional[Dict[str, Any]], Optional[str]]:
+    """Normalize spec.runtime, spec.command and spec.workingDir. Returns the fields to
+    store (empty for container apps) or an error."""
+    runtime = app_spec.get("runtime", "container")
+    if runtime == "container":
+        return {}, None
+    if runtime != "process":
+        return None, f"spec.runtime must be container or process, not '{runtime}'"
+    if not PROCESS_RUNTIME_ENABLED:
+        return None, "runtime: process is disabled on this controller (set ORCHESTRY_PROCESS_RUNTIME=true)"
+
+    command = app_spec.get("command")
+    if isinstance(command, str):
+        command = shlex.split(command)
+    if not isinstance(command, list) or not command or not all(isinstance(arg, str) and arg for arg in command):
+        return None, "runtime: process apps need spec.command (a list of arguments or a command line)"
+    if not os.path.isabs(command[0]):
+        return None, f"spec.command must start with an absolute path, not '{command[0]}'"
+    working_dir = app_spec.get("workingDir")
+    if working_dir is not None and (not isinstance(working_dir, str) or not os.path.isabs(working_dir)):
+        return None, "spec.workingDir must be an absolute path"
+    unsupported = [field for field in CONTAINER_ONLY_FIELDS if app_spec.get(field)]
+    if unsupported:
+        return None, f"{', '.join(unsupported)} cannot be used with runtime: process"
+    if (app_spec.get("scaling") or {}).get("warmPool"):
+        return None, "Warm pools are not supported with runtime: process"
+
+    fields: Dict[str, Any] = {"runtime": "process", "command": command}
+    if working_dir:
+        fields["workingDir"] = working_dir
+    health = app_spec.get("health")
+    if health and health.get("port") is not None:
+        # Replicas are probed on the port they are given, not a fixed one
+        if health["port"] != app_spec["ports"][0].get("containerPort"):
+            return None, "healthCheck.port must be left out (or equal containerPort) with runtime: process"
+        fields["health"] = {k: v for k, v in health.items() if k != "port"}
+    return fields, None
+
+def apply(container_config: Dict[str, Any], app_spec: Dict[str, Any]):
+    """Turn a containers.create() call into one for a process replica."""
+    if not is_process(app_spec):
+        return
+    container_config["labels"][RUNTIME_LABEL] = "process"
+    container_config["image"] = app_spec["command"][0]
+    container_config["command"] = list(app_spec["command"])
+    if app_spec.get("workingDir"):
+        container_config["working_dir"] = app_spec["workingDir"]
+
+def instance_address(container: Any, default_port: int) -> Tuple[str, int]:
+    """The ip and port a replica is served on. Process replicas each listen on their
+    own port; containers all use the app's containerPort."""
+    network = ((container.attrs.get("NetworkSettings") or {}).get("Networks") or {}).get("orchestry") or {}
+    return network.get("IPAddress", ""), int(network.get("Port") or default_port)
+
+def _port_range() -> Tuple[int, int]:
+    low, _, high = PROCESS_PORT_RANGE.partition("-")
+    return int(low), int(high or low)
+
+def _systemd_available() -> bool:
+    return bool(shutil.which("systemd-run")) and os.path.isdir("/run/systemd/system")
+
+class ProcessReplica:
+    """A process replica, shaped like docker.models.containers.Container."""
+
+    def __init__(self, runtime: "ProcessRuntime", record: Dict[str, Any]):
+        self._runtime = runtime
+        self.record = record
+
+    @property
+    def id(self) -> str:
+        return self.record["id"]
+
+    @property
+    def name(self) -> str:
+        return self.record["name"]
+
+    @property
+    def labels(self) -> Dict[str, str]:
+        return self.record["labels"]
+
+    @property
+    def status(self) -> str:
+        return self.record["status"]
+
+    @property
+    def attrs(self) -> Dict[str, Any]:
+        r = self.record
+        return {
+            "Id": r["id"],
+            "Name": f"/{r['name']}",
+            "Created": r["created"],
+            "Config": {"Image": r["image"], "Labels": r["labels"], "Cmd": r["command"],
+                       "Env": [f"{k}={v}" for k, v in r["environment"].items()], "WorkingDir": r.get("working_dir")},
+            "HostConfig": {"PortBindings": {}},
+            "State": {"Status": r["status"], "Running": r["status"] == "running", "ExitCode": r.get("exit_code", 0),
+                      "Pid": r.get("pid") or 0, "OOMKilled": False},
+            "NetworkSettings": {"Networks": {"orchestry": {"IPAddress": r["address"], "Port": r["port"]}}}
+        }
+
+    def reload(self):
+        self._runtime._check(self)
+        self._runtime.refresh(self.record)
+
+    def start(self):
+        self._runtime._check(self)
+        if self.status not in ("running", "paused"):
+            self._runtime.launch(self.record)
+
+    def stop(self, timeout: Optional[int] = None):
+        self._runtime._check(self)
+        self._runtime.terminate(self.record, timeout if timeout is not None else STOP_TIMEOUT_SECONDS)
+
+    def kill(self, sig: Any = None):
+        self._runtime._check(self)
+        self._runtime.send_signal(self.record, signal.SIGKILL)
+
+    def restart(self, timeout: Optional[int] = None):
+        self.stop(timeout)
+        self.start()
+
+    def pause(self):
+        self._runtime._check(self)
+        self._runtime.send_signal(self.record, signal.SIGSTOP)
+        self._runtime.set_status(self.record, "paused", action="pause")
+
+    def unpause(self):
+        self._runtime._check(self)
+        self._runtime.send_signal(self.record, signal.SIGCONT)
+        self._runtime.set_status(self.record, "running", action="unpause")
+
+    def remove(self, force: bool = False, v: bool = False):
+        self._runtime._check(self)
+        self._runtime.refresh(self.record)
+        if self.status in ("running", "paused"):
+            if not force:
+                raise docker.errors.APIError(f"Cannot remove running process replica {self.name}")
+            self._runtime.terminate(self.record, 0)
+        self._runtime.forget(self.record)
+
+    def update(self, **kwargs):
+        self._runtime._check(self)
+        self.record["limits"].update({k: v for k, v in kwargs.items() if k in ("nano_cpus", "mem_limit")})
+        self._runtime.save(self.record)
+
+    def logs(self, tail: Any = "all", timestamps: bool = False, **kwargs) -> bytes:
+        return self._runtime.read_logs(self.record, tail, timestamps)
+
+    def stats(self, stream: bool = False, **kwargs) -> Dict[str, Any]:
+        return self._runtime.stats(self.record)
+
+    def exec_run(self, cmd: Any, **kwargs) -> ExecResult:
+        return ExecResult(126, b"exec is not supported for process replicas")
+
+class ProcessReplicas:
+    def __init__(self, runtime: "ProcessRuntime"):
+        self._runtime = runtime
+
+    def create(self, image: str, name: Optional[str] = None, command: Optional[List[str]] = None,
+               labels: Optional[Dict[str, str]] = None, environment: Optional[Dict[str, str]] = None,
+               working_dir: Optional[str] = None, user: Optional[str] = None, **kwargs) -> ProcessReplica:
+        return ProcessReplica(self._runtime, self._runtime.new_record(
+            image, name, command or [image], labels or {}, environment or {}, working_dir, user, kwargs))
+
+    def run(self, image: str, detach: bool = True, **kwargs) -> ProcessReplica:
+        replica = self.create(image, **kwargs)
+        replica.start()
+        return replica
+
+    def get(self, container_id: str) -> ProcessReplica:
+        record = self._runtime.find(container_id)
+        if not record:
+            raise docker.errors.NotFound(f"No such process replica: {container_id}")
+        return ProcessReplica(self._runtime, record)
+
+    def list(self, all: bool = False, filters: Optional[Dict[str, Any]] = None, **kwargs) -> List[ProcessReplica]:
+        filters = filters or {}
+        replicas = []
+        for record in self._runtime.records():
+            self._runtime.refresh(record)
+            if not all and record["status"] != "running":
+                continue
+            if "label" in filters and not labels_match(record["labels"], filters["label"]):
+                continue
+            if "id" in filters and not record["id"].startswith(filters["id"]):
+                continue
+            if "name" in filters and filters["name"] not in record["name"]:
+                continue
+            if "status" in filters and record["status"] != filters["status"]:
+                continue
+            replicas.append(ProcessReplica(self._runtime, record))
+        return replicas
+
+class ProcessRuntime:
+    """Runs process replicas as systemd transient units or direct child processes."""
+
+    def __init__(self, state_dir: str = PROCESS_STATE_DIR, backend: str = PROCESS_BACKEND,
+                 address: Optional[Callable[[], str]] = None):
+        if backend not in PROCESS_BACKENDS:
+            raise RuntimeError(f"Unknown ORCHESTRY_PROCESS_BACKEND '{backend}' (use one of {', '.join(PROCESS_BACKENDS)})")
+        if backend == "auto":
+            backend = "systemd" if _systemd_available() else "exec"
+        self.backend = backend
+        self.state_dir = Path(state_dir)
+        self._address = address or (lambda: PROCESS_ADDRESS or "127.0.0.1")
+        self._lock = threading.RLock()
+        self._records: Dict[str, Dict[str, Any]] = {}
+        self._children: Dict[str, subprocess.Popen] = {}
+        self._cpu_samples: Dict[str, Tuple[int, int]] = {}
+        self._streams: List[Any] = []
+        self._watcher: Optional[threading.Thread] = None
+        self.containers = ProcessReplicas(self)
+        self._load()
+
+    # Records
+
+    def _load(self):
+        if not self.state_dir.is_dir():
+            return
+        for path in self.state_dir.glob("*.json"):
+            try:
+                record = json.loads(path.read_text())
+                self._records[record["id"]] = record
+            except (ValueError, KeyError) as e:
+                logger.warning(f"Ignoring unreadable process replica state {path}: {e}")
+        if self._records:
+            logger.info(f"Loaded {len(self._records)} process replica(s) from {self.state_dir} ({self.backend} backend)")
+
+    def save(self, record: Dict[str, Any]):
+        self.state_dir.mkdir(parents=True, exist_ok=True)
+        path = self.state_dir / f"{record['id']}.json"
+        tmp = path.with_suffix(".tmp")
+        tmp.write_text(json.dumps(record))
+        tmp.replace(path)
+
+    def forget(self, record: Dict[str, Any]):
+        with self._lock:
+            self._records.pop(record["id"], None)
+            self._children.pop(record["id"], None)
+        for suffix in (".json", ".log"):
+            (self.state_dir / f"{record['id']}{suffix}").unlink(missing_ok=True)
+        self._emit(record, "destroy")
+
+    def records(self) -> List[Dict[str, Any]]:
+        with self._lock:
+            return list(self._records.values())
+
+    def find(self, ref: str) -> Optional[Dict[str, Any]]:
+        with self._lock:
+            for record in self._records.values():
+                if ref in (record["id"], record["name"]) or (len(ref) >= 12 and record["id"].startswith(ref)):
+                    return record
+        return None
+
+    def _check(self, replica: ProcessReplica):
+        if replica.id not in self._records:
+            raise docker.errors.NotFound(f"No such process replica: {replica.id}")
+
+    def _free_port(self) -> int:
+        low, high = _port_range()
+        used = {r["port"] for r in self.records()}
+        for port in range(low, high + 1):
+            if port in used:
+                continue
+            with socket.socket(socket.AF_INET, socket.SOCK_STREAM) as probe:
+                try:
+                    probe.bind(("", port))
+                except OSError:
+                    continue
+            return port
+        raise docker.errors.APIError(f"No free port left in ORCHESTRY_PROCESS_PORT_RANGE {PROCESS_PORT_RANGE}")
+
+    def new_record(self, image: str, name: Optional[str], command: List[str], labels: Dict[str, str],
+                   environment: Dict[str, str], working_dir: Optional[str], user: Optional[str],
+                   options: Dict[str, Any]) -> Dict[str, Any]:
+        with self._lock:
+            name = name or f"process-{uuid.uuid4().hex[:8]}"
+            if any(r["name"] == name for r in self._records.values()):
+                raise docker.errors.APIError(f"Conflict. The process replica name \"{name}\" is already in use")
+            port = self._free_port()
+            record = {
+                "id": "proc" + uuid.uuid4().hex + uuid.uuid4().hex[:28],
+                "name": name,
+                "image": image,
+                "command": command,
+                "labels": dict(labels),
+                "environment": dict(environment, PORT=str(port)),
+                "working_dir": working_dir,
+                "user": user,
+                "limits": {k: options[k] for k in ("nano_cpus", "mem_limit") if options.get(k)},
+                "port": port,
+                "address": self._address(),
+                "status": "created",
+                "exit_code": 0,
+                "pid": None,
+                "created": time.strftime("%Y-%m-%dT%H:%M:%SZ", time.gmtime())
+            }
+            self._records[record["id"]] = record
+            self.save(record)
+            return record
+
+    def set_status(self, record: Dict[str, Any], status: str, exit_code: int = 0, action: Optional[str] = None):
+        changed = record["status"] != status
+        record["status"] = status
+        record["exit_code"] = exit_code
+        self.save(record)
+        if action and changed:
+            self._emit(record, action)
+
+    # Process control
+
+    def _systemctl(self, *args: str, check: bool = False) -> subprocess.CompletedProcess:
+        scope = [] if os.geteuid() == 0 else ["--user"]
+        return subprocess.run(["systemctl", *scope, *args], capture_output=True, text=True, check=check)
+
+    def launch(self, record: Dict[str, Any]):
+        environment = dict(record["environment"])
+        limits = record["limits"]
+        if self.backend == "systemd":
+            unit = f"orchestry-{record['name']}.service"
+            self._systemctl("reset-failed", unit)
+            args = ["systemd-run"] + ([] if os.geteuid() == 0 else ["--user"]) + [
+                "--unit", unit, "--collect", "--quiet",
+                "--property", f"Description=Orchestry process replica {record['name']}"]
+            if record.get("working_dir"):
+                args += ["--working-directory", record["working_dir"]]
+            if record.get("user"):
+                args += ["--uid", record["user"]]
+            if limits.get("nano_cpus"):
+                args += ["--property", f"CPUQuota={int(limits['nano_cpus'] / 10_000_000)}%"]
+            if limits.get("mem_limit"):
+                args += ["--property", f"MemoryMax={limits['mem_limit']}"]
+            args += [arg for k, v in environment.items() for arg in ("--setenv", f"{k}={v}")]
+            result = subprocess.run(args + ["--"] + record["command"], capture_output=True, text=True)
+            if result.returncode != 0:
+                self.set_status(record, "exited", result.returncode, "die")
+                raise docker.errors.APIError(f"systemd-run failed for {record['name']}: {result.stderr.strip()}")
+            record["pid"] = None
+        else:
+            if limits:
+                logger.warning(f"CPU and memory limits need the systemd backend; {record['name']} runs without them")
+            if record.get("user"):
+                logger.warning(f"user is not supported by the exec backend; {record['name']} runs as the controller user")
+            self.state_dir.mkdir(parents=True, exist_ok=True)
+            log = open(self.state_dir / f"{record['id']}.log", "ab")
+            try:
+                child = subprocess.Popen(
+                    record["command"], cwd=record.get("working_dir"), stdout=log, stderr=subprocess.STDOUT,
+                    env=dict(PATH=os.getenv("PATH", "/usr/bin:/bin"), **environment), start_new_session=True
+                )
+            except OSError as e:
+                self.set_status(record, "exited", 127, "die")
+                raise docker.errors.APIError(f"Could not start {record['name']}: {e}")
+            finally:
+                log.close()
+            self._children[record["id"]] = child
+            record["pid"] = child.pid
+        self.set_status(record, "running", action="start")
+        self._ensure_watcher()
+
+    def send_signal(self, record: Dict[str, Any], sig: int):
+        if record["status"] not in ("running", "paused"):
+            return
+        if self.backend == "systemd":
+            self._systemctl("kill", "--signal", str(int(sig)), f"orchestry-{record['name']}.service")
+        elif record.get("pid"):
+            try:
+                os.killpg(record["pid"], sig)
+            except ProcessLookupError:
+                pass
+
+    def terminate(self, record: Dict[str, Any], timeout: int):
+        if record["status"] not in ("running", "paused"):
+            return
+        if record["status"] == "paused":
+            self.send_signal(record, signal.SIGCONT)
+        if self.backend == "systemd":
+            self._systemctl("stop", f"orchestry-{record['name']}.service")
+        else:
+            self.send_signal(record, signal.SIGTERM)
+            deadline = time.time() + timeout
+            while time.time() < deadline and self._alive(record):
+                time.sleep(0.2)
+            if self._alive(record):
+                self.send_signal(record, signal.SIGKILL)
+        self.refresh(record)
+
+    def _alive(self, record: Dict[str, Any]) -> bool:
+        child = self._children.get(record["id"])
+        if child is not None:
+            return child.poll() is None
+        pid = record.get("pid")
+        if not pid:
+            return False
+        try:
+            os.kill(pid, 0)
+            return True
+        except ProcessLookupError:
+            return False
+        except PermissionError:
+            return True
+
+    def refresh(self, record: Dict[str, Any]):
+        """Update a running replica's status from systemd or the process table."""
+        if record["status"] not in ("running", "paused"):
+            return
+        exit_code = 0
+        if self.backend == "systemd":
+            shown = self._systemctl("show", f"orchestry-{record['name']}.service",
+                                    "--property", "ActiveState,MainPID,ExecMainStatus").stdout
+            props = dict(line.split("=", 1) for line in shown.splitlines() if "=" in line)
+            if props.get("ActiveState") in ("active", "activating", "reloading", "deactivating"):
+                record["pid"] = int(props.get("MainPID") or 0) or None
+                return
+            exit_code = int(props.get("ExecMainStatus") or 0)
+        else:
+            if self._alive(record):
+                return
+            child = self._children.pop(record["id"], None)
+            exit_code = child.returncode if child is not None and child.returncode is not None else 0
+            exit_code = 128 - exit_code if exit_code < 0 else exit_code  # killed by a signal
+        record["pid"] = None
+        self.set_status(record, "exited", exit_code, "die")
+
+    # Observability
+
+    def read_logs(self, record: Dict[str, Any], tail: Any, timestamps: bool) -> bytes:
+        if self.backend == "systemd":
+            args = ["journalctl"] + ([] if os.geteuid() == 0 else ["--user"]) + [
+                "--unit", f"orchestry-{record['name']}.service", "--no-pager",
+                "--output", "short-iso" if timestamps else "cat"]
+            if tail != "all":
+                args += ["--lines", str(tail)]
+            return subprocess.run(args, capture_output=True).stdout
+        path = self.state_dir / f"{record['id']}.log"
+        if not path.exists():
+            return b""
+        lines = path.read_bytes().splitlines(keepends=True)
+        return b"".join(lines if tail == "all" else lines[-int(tail):])
+
+    def stats(self, record: Dict[str, Any]) -> Dict[str, Any]:
+        """Docker-shaped stats from /proc. The previous sample stands in for precpu_stats."""
+        cpus = os.cpu_count() or 1
+        now = time.monotonic_ns()
+        cpu_ns, rss = 0, 0
+        pid = record.get("pid")
+        if pid:
+            try:
+                fields = Path(f"/proc/{pid}/stat").read_text().rsplit(")", 1)[1].split()
+                ticks = os.sysconf("SC_CLK_TCK")
+                cpu_ns = (int(fields[11]) + int(fields[12])) * 1_000_000_000 // ticks  # utime + stime
+                for line in Path(f"/proc/{pid}/status").read_text().splitlines():
+                    if line.startswith("VmRSS:"):
+                        rss = int(line.split()[1]) * 1024
+            except (OSError, IndexError, ValueError):
+                pass
+        previous_cpu, previous_time = self._cpu_samples.get(record["id"], (cpu_ns, now))
+        self._cpu_samples[record["id"]] = (cpu_ns, now)
+        limit = record["limits"].get("mem_limit") or os.sysconf("SC_PAGE_SIZE") * os.sysconf("SC_PHYS_PAGES")
+        return {
+            "cpu_stats": {"cpu_usage": {"total_usage": cpu_ns}, "system_cpu_usage": now * cpus, "online_cpus": cpus},
+            "precpu_stats": {"cpu_usage": {"total_usage": previous_cpu}, "system_cpu_usage": previous_time * cpus},
+            "memory_stats": {"usage": rss, "limit": limit}
+        }
+
+    # Events
+
+    def _emit(self, record: Dict[str, Any], action: str):
+        event = {"Type": "container", "Action": action, "status": action, "id": record["id"],
+                 "Actor": {"ID": record["id"], "Attributes": dict(record["labels"], name=record["name"])},
+                 "time": int(time.time())}
+        with self._lock:
+            streams = list(self._streams)
+        for stream in streams:
+            stream.put(event)
+
+    def add_stream(self, stream: Any):
+        with self._lock:
+            self._streams.append(stream)
+        self._ensure_watcher()
+
+    def _ensure_watcher(self):
+        with self._lock:
+            if self._watcher and self._watcher.is_alive():
+                return
+            self._watcher = threading.Thread(target=self._watch, daemon=True, name="process-runtime-watch")
+            self._watcher.start()
+
+    def _watch(self):
+        while True:
+            time.sleep(PROCESS_POLL_SECONDS)
+            for record in self.records():
+                try:
+                    self.refresh(record)
+                except Exception as e:
+                    logger.debug(f"Could not refresh process replica {record['name']}: {e}")
+
+class RoutedRuntime:
+    """A ContainerRuntime that sends process replicas to a ProcessRuntime and
+    everything else to the container runtime."""
+
+    def __init__(self, default: Any, processes: ProcessRuntime):
+        self.default = default
+        self.processes = processes
+        self.containers = _RoutedContainers(self)
+        self.networks = default.networks
+        self.images = default.images
+        self.api = _RoutedAPI(self)
+
+    def info(self) -> Dict[str, Any]:
+        return self.default.info()
+
+    def ping(self) -> bool:
+        return self.default.ping()
+
+    def df(self) -> Dict[str, Any]:
+        return self.default.df()
+
+    def events(self, decode: bool = False, filters: Optional[Dict[str, Any]] = None):
+        stream = EventStream(filters)
+        self.processes.add_stream(stream)
+        stream.follow(self.default.events(decode=decode, filters=filters))
+        return stream
+
+class _RoutedContainers:
+    def __init__(self, routed: RoutedRuntime):
+        self._routed = routed
+
+    def _target(self, kwargs: Dict[str, Any]):
+        process = (kwargs.get("labels") or {}).get(RUNTIME_LABEL) == "process"
+        return self._routed.processes.containers if process else self._routed.default.containers
+
+    def create(self, image: str, **kwargs):
+        return self._target(kwargs).create(image, **kwargs)
+
+    def run(self, image: str, **kwargs):
+        return self._target(kwargs).run(image, **kwargs)
+
+    def get(self, container_id: str):
+        if self._routed.processes.find(container_id):
+            return self._routed.processes.containers.get(container_id)
+        return self._routed.default.containers.get(container_id)
+
+    def list(self, all: bool = False, filters: Optional[Dict[str, Any]] = None, **kwargs):
+        return (self._routed.default.containers.list(all=all, filters=filters, **kwargs)
+                + self._routed.processes.containers.list(all=all, filters=filters))
+
+class _RoutedAPI:
+    def __init__(self, routed: RoutedRuntime):
+        self._routed = routed
+
+    def containers(self, all: bool = False, size: bool = False, filters: Optional[Dict[str, Any]] = None):
+        container_id = (filters or {}).get("id")
+        if container_id and self._routed.processes.find(container_id):
+            return [{"Id": container_id, "SizeRw": 0}]  # processes write to the host filesystem
+        return self._routed.default.api.containers(all=all, size=size, filters=filters)
@@ -0,0 +1,106 @@
+"""
+Promotion of apps between namespaces (e.g. staging -> prod).
+A promotion copies the source app's latest spec revision to the matching app in
+the target namespace, with the image pinned to the registry digest the source
+is running, so the target gets exactly the build that was tested.
+"""
+
+import copy
+import logging
+from typing import Any, Dict, Optional, Tuple
+
+import docker
+
+from .namespaces import validate_namespace_name
+
+logger = logging.getLogger(__name__)
+
+def target_app_name(name: str, from_namespace: str, to_namespace: str) -> str:
+    """Default name of the promoted app: shop-staging -> shop-prod, shop -> shop-prod."""
+    suffix = f"-{from_namespace}"
+    base = name[:-len(suffix)] if name.endswith(suffix) else name
+    return f"{base}-{to_namespace}"
+
+def _repository(image: str) -> str:
+    # registry:5000/team/app:1.2 -> registry:5000/team/app
+    name, _, tag = image.rpartition(":")
+    return name if name and "/" not in tag else image
+
+def pin_image(docker_client: Any, app_name: str, image: str) -> Tuple[Optional[str], Optional[str]]:
+    """Resolve image to repository@sha256:... using the image the app's containers run.
+    Returns (pinned image, error)."""
+    if "@sha256:" in image:
+        return image, None
+    repository = _repository(image)
+
+    digests = []
+    try:
+        containers = docker_client.containers.list(filters={"label": f"orchestry.app={app_name}"})
+        if containers:
+            digests = containers[0].image.attrs.get("RepoDigests") or []
+        else:
+            digests = docker_client.images.get(image).attrs.get("RepoDigests") or []
+    except docker.errors.ImageNotFound:
+        return None, f"image {image} is not present on the Docker host; start {app_name} before promoting it"
+    except Exception as e:
+        return None, f"could not resolve the digest of {image}: {e}"
+
+    # Prefer the digest from the repository the spec names; the same image may be pushed to several
+    for digest in digests:
+        digest_repository, _, sha = digest.partition("@")
+        if digest_repository == repository:
+            return f"{repository}@{sha}", None
+    if digests:
+        return f"{repository}@{digests[0].partition('@')[2]}", None
+    return None, f"image {image} has no registry digest; push it to a registry before promoting"
+
+def plan_promotion(state_store: Any, docker_client: Any, app_name: str, from_namespace: str,
+                   to_namespace: str, target: Optional[str] = None) -> Dict[str, Any]:
+    """Work out what promoting app_name would do. The returned plan includes the
+    complete spec to register as the target app."""
+    from_namespace, error = validate_namespace_name(from_namespace)
+    if error:
+        return {"error": error}
+    to_namespace, error = validate_namespace_name(to_namespace)
+    if error:
+        return {"error": error}
+    if from_namespace == to_namespace:
+        return {"error": "Source and target namespaces must differ"}
+
+    source = state_store.get_app(app_name)
+    if not source:
+        return {"error": f"App {app_name} not found"}
+    if source.namespace != from_namespace:
+        return {"error": f"App {app_name} is in namespace {source.namespace}, not {from_namespace}"}
+
+    revision = state_store.get_app_revision(app_name)
+    if not revision:
+        return {"error": f"App {app_name} has no recorded revisions; register it again before promoting"}
+
+    target = target or target_app_name(app_name, from_namespace, to_namespace)
+    existing = state_store.get_app(target)
+    if existing and existing.namespace != to_namespace:
+        return {"error": f"App {target} already exists in namespace {existing.namespace}"}
+
+    spec = copy.deepcopy(revision["spec"])
+    image = (spec.get("spec") or {}).get("image") or source.spec.get("image")
+    pinned, error = pin_image(docker_client, app_name, image)
+    if error:
+        return {"error": error}
+    spec["spec"]["image"] = pinned
+    spec.setdefault("metadata", {})
+    spec["metadata"]["name"] = target
+    spec["metadata"]["namespace"] = to_namespace
+
+    return {
+        "source": {"app": app_name, "namespace": from_namespace, "revision": revision["revision"], "image": image},
+        "target": {
+            "app": target,
+            "namespace": to_namespace,
+            "exists": existing is not None,
+            "status": existing.status if existing else None,
+            "image": existing.spec.get("image") if existing else None
+        },
+        "image": pinned,
+        "spec": spec
+    }
@@ -0,0 +1,84 @@
+"""
+Public health status for apps that opt in with `publicStatus.enabled`.
+Gives teams an unauthenticated status JSON and an SVG badge to embed in
+READMEs and status pages. Only the app's name, state and replica counts
+are exposed.
+"""
+
+import hashlib
+from typing import Any, Dict, Optional, Tuple
+from xml.sax.saxutils import escape
+
+# Public responses may be cached by browsers and proxies for this long
+PUBLIC_STATUS_MAX_AGE_SECONDS = 30
+
+BADGE_COLORS = {
+    "up": "#4c1",
+    "degraded": "#dfb317",
+    "down": "#e05d44",
+}
+
+def validate_public_status(config: Any) -> Tuple[Optional[Dict[str, Any]], Optional[str]]:
+    """Normalize an app's `publicStatus` block. Returns (config or None if off, error)."""
+    if not config:
+        return None, None
+    if not isinstance(config, dict):
+        return None, "publicStatus must be a mapping"
+    if not config.get("enabled"):
+        return None, None
+    label = config.get("label")
+    if label is not None and (not isinstance(label, str) or not label.strip() or len(label) > 40):
+        return None, "publicStatus.label must be 1-40 characters"
+    result = {"enabled": True}
+    if label:
+        result["label"] = label.strip()
+    return result, None
+
+def public_status(app_record: Any, runtime: Optional[Dict[str, Any]]) -> Dict[str, Any]:
+    """Classify an app as up, degraded or down from its tracked replicas."""
+    runtime = runtime or {}
+    ready = runtime.get("ready_replicas", 0)
+    replicas = runtime.get("replicas", 0)
+    if app_record.status != "running" or ready == 0:
+        state = "down"
+    elif ready < max(replicas, app_record.replicas or 0):
+        state = "degraded"
+    else:
+        state = "up"
+    return {
+        "app": app_record.name,
+        "status": state,
+        "ready_replicas": ready,
+        "replicas": replicas
+    }
+
+def _text_width(text: str) -> int:
+    # Close enough to Verdana 11px for badge layout
+    return 7 * len(text) + 10
+
+def render_badge(label: str, status: str) -> str:
+    """A shields.io-style flat SVG badge: label on the left, status on the right."""
+    label_width = _text_width(label)
+    status_width = _text_width(status)
+    width = label_width + status_width
+    color = BADGE_COLORS.get(status, "#9f9f9f")
+    label, status_text = escape(label), escape(status)
+    return (
+        f'<svg xmlns="http://www.w3.org/2000/svg" width="{width}" height="20" role="img" '
+        f'aria-label="{label}: {status_text}">'
+        f'<title>{label}: {status_text}</title>'
+        f'<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/>'
+        f'<stop offset="1" stop-opacity=".1"/></linearGradient>'
+        f'<clipPath id="r"><rect width="{width}" height="20" rx="3" fill="#fff"/></clipPath>'
+        f'<g clip-path="url(#r)">'
+        f'<rect width="{label_width}" height="20" fill="#555"/>'
+        f'<rect x="{label_width}" width="{status_width}" height="20" fill="{color}"/>'
+        f'<rect width="{width}" height="20" fill="url(#s)"/></g>'
+        f'<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">'
+        f'<text x="{label_width / 2}" y="14">{label}</text>'
+        f'<text x="{label_width + status_width / 2}" y="14">{status_text}</text>'
+        f'</g></svg>'
+    )
+
+def etag(body: str) -> str:
+    return '"' + hashlib.sha256(body.encode()).hexdigest()[:16] + '"'
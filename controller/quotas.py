@@ -0,0 +1,157 @@
+"""
+API request quotas.
+Counts write requests per caller, namespace and app in fixed time windows and
+rejects requests once a configured budget is used up, so a runaway CI pipeline
+cannot flood the shared controller. Counts live in the database, so every
+controller (and a new leader after failover) sees the same usage.
+"""
+
+import os
+import json
+import time
+import logging
+from typing import Any, Dict, List, Optional
+
+logger = logging.getLogger(__name__)
+
+QUOTA_ACTIONS = ("register", "up", "down", "delete", "scale", "policy", "access", "promote", "deploy", "env", "toggles", "shadow",
+                 "archive", "restore", "maintenance", "logging", "headers")
+QUOTA_SCOPES = ("caller", "namespace", "app")
+WINDOW_UNITS = {"second": 1, "minute": 60, "hour": 3600, "day": 86400}
+# Ended windows are deleted from the usage table this often
+USAGE_CLEANUP_INTERVAL_SECONDS = 600
+
+def parse_quota_rules(raw: str) -> List[Dict[str, Any]]:
+    """Parse ORCHESTRY_API_QUOTAS, a JSON list of rules such as
+    {"action": "scale", "limit": 10, "per": "minute", "by": "app"}.
+    Invalid rules are skipped with a warning."""
+    if not raw:
+        return []
+    try:
+        entries = json.loads(raw)
+    except Exception as e:
+        logger.warning(f"Invalid ORCHESTRY_API_QUOTAS: {e}")
+        return []
+    if not isinstance(entries, list):
+        logger.warning("ORCHESTRY_API_QUOTAS must be a JSON list, ignoring")
+        return []
+
+    rules = []
+    for entry in entries:
+        if not isinstance(entry, dict):
+            logger.warning(f"Ignoring API quota {entry}: must be an object")
+            continue
+        action = entry.get("action", "*")
+        by = entry.get("by", "caller")
+        per = entry.get("per", "minute")
+        window = WINDOW_UNITS.get(per) if isinstance(per, str) else per
+        limit = entry.get("limit")
+        if action != "*" and action not in QUOTA_ACTIONS:
+            logger.warning(f"Ignoring API quota {entry}: action must be * or one of {', '.join(QUOTA_ACTIONS)}")
+        elif by not in QUOTA_SCOPES:
+            logger.warning(f"Ignoring API quota {entry}: by must be one of {', '.join(QUOTA_SCOPES)}")
+        elif not isinstance(window, int) or window <= 0:
+            logger.warning(f"Ignoring API quota {entry}: per must be {', '.join(WINDOW_UNITS)} or seconds")
+        elif not isinstance(limit, int) or limit < 0:
+            logger.warning(f"Ignoring API quota {entry}: limit must be a non-negative integer")
+        else:
+            rules.append({
+                "action": action,
+                "by": by,
+                "limit": limit,
+                "window_seconds": window,
+                "namespace": entry.get("namespace")
+            })
+    return rules
+
+class QuotaManager:
+    """Checks requests against the API quotas and tracks usage."""
+
+    def __init__(self, state_store: Any):
+        self.state_store = state_store
+        self.rules = parse_quota_rules(os.getenv("ORCHESTRY_API_QUOTAS", ""))
+        self._last_cleanup = 0.0
+        if self.rules:
+            logger.info(f"Enforcing {len(self.rules)} API quota rule(s)")
+
+    def _matching_rules(self, action: str, namespace: str, app_name: Optional[str]):
+        for rule in self.rules:
+            if rule["action"] not in ("*", action):
+                continue
+            if rule["namespace"] and rule["namespace"] != namespace:
+                continue
+            if rule["by"] == "app" and not app_name:
+                continue
+            yield rule
+
+    @staticmethod
+    def _scope(rule: Dict[str, Any], caller: str, namespace: str, app_name: Optional[str]) -> str:
+        subject = {"caller": caller, "namespace": namespace, "app": app_name}[rule["by"]]
+        return f"{rule['by']}:{subject}|{rule['action']}|{rule['window_seconds']}"
+
+    def check(self, action: str, caller: str, namespace: str,
+              app_name: Optional[str] = None) -> Optional[Dict[str, Any]]:
+        """Count one request. Returns None if it is within every quota, otherwise
+        {"error", "retry_after"} for the quota it exceeds."""
+        if not self.rules:
+            return None
+        now = time.time()
+        self._cleanup(now)
+
+        exceeded = None
+        for rule in self._matching_rules(action, namespace, app_name):
+            window = rule["window_seconds"]
+            window_start = float(int(now // window) * window)
+            count = self.state_store.increment_api_usage(
+                self._scope(rule, caller, namespace, app_name), window_start, window
+            )
+            if count is None:
+                continue  # don't block the API because usage could not be recorded
+            if count > rule["limit"]:
+                retry_after = max(1, int(window_start + window - now))
+                if not exceeded or retry_after > exceeded["retry_after"]:
+                    subject = {"caller": caller, "namespace": namespace, "app": app_name}[rule["by"]]
+                    exceeded = {
+                        "error": f"API quota exceeded: {rule['limit']} {rule['action'] if rule['action'] != '*' else 'write'} "
+                                 f"request(s) per {window}s for {rule['by']} {subject}",
+                        "retry_after": retry_after
+                    }
+        if exceeded:
+            logger.warning(f"Rejected {action} request from {caller} ({namespace}/{app_name}): {exceeded['error']}")
+        return exceeded
+
+    def usage(self, caller: str, namespace: str, app_name: Optional[str] = None) -> Dict[str, Any]:
+        """The quotas that apply to a caller, namespace and app, with what is left of each."""
+        now = time.time()
+        current = {row["scope"]: row for row in self.state_store.list_api_usage()}
+        quotas = []
+        seen = set()
+        for action in QUOTA_ACTIONS:
+            for rule in self._matching_rules(action, namespace, app_name):
+                scope = self._scope(rule, caller, namespace, app_name)
+                if scope in seen:
+                    continue
+                seen.add(scope)
+                window = rule["window_seconds"]
+                window_start = float(int(now // window) * window)
+                row = current.get(scope)
+                used = row["count"] if row and row["window_start"] == window_start else 0
+                quotas.append({
+                    "action": rule["action"],
+                    "by": rule["by"],
+                    "subject": {"caller": caller, "namespace": namespace, "app": app_name}[rule["by"]],
+                    "limit": rule["limit"],
+                    "window_seconds": window,
+                    "used": used,
+                    "remaining": max(0, rule["limit"] - used),
+                    "resets_at": window_start + window
+                })
+        return {"caller": caller, "namespace": namespace, "app": app_name, "quotas": quotas}
+
+    def _cleanup(self, now: float):
+        if now - self._last_cleanup < USAGE_CLEANUP_INTERVAL_SECONDS:
+            return
+        self._last_cleanup = now
+        removed = self.state_store.cleanup_api_usage(now)
+        if removed:
+            logger.debug(f"Removed {removed} ended API usage window(s)")
@@ -0,0 +1,110 @@
+"""
+Reconciliation reports.
+When a controller starts, and again when it takes over as leader, it adopts
+the app containers already running (starting stopped ones), removes
+containers of apps that no longer exist, rebuilds the nginx configs of apps
+it adopted replicas for and restores scaling policies. What it did is
+recorded in a report, so operators can check a failover completed cleanly
+without reading the logs:
+
+    GET /admin/last-reconciliation
+
+The latest report of any node is stored in the database and also logged as
+a `reconciled` event, a warning if any step failed.
+"""
+
+import time
+import logging
+from typing import Any, Dict, List, Optional
+
+logger = logging.getLogger(__name__)
+
+SYSTEM_EVENT_SCOPE = "orchestry"
+REPORT_SETTING_KEY = "reconciliation:last"
+EVENT_TYPE = "reconciled"
+TRIGGERS = ("startup", "leader_takeover")
+
+class ReconciliationReport:
+    """Collects what one reconciliation pass did. The app manager and lifecycle hooks
+    record into it as they go; publish() stores and announces the result."""
+
+    def __init__(self, trigger: str, node_id: Optional[str] = None):
+        self.trigger = trigger
+        self.node_id = node_id
+        self.started_at = time.time()
+        self.adopted: List[Dict[str, str]] = []
+        self.restarted: List[Dict[str, str]] = []
+        self.orphaned: List[Dict[str, str]] = []
+        self.nginx_rebuilt: List[str] = []
+        self.policies_restored: List[str] = []
+        self.health_restored = 0
+        self.skipped: List[Dict[str, str]] = []
+        self.failures: List[Dict[str, Optional[str]]] = []
+
+    def container_adopted(self, app_name: str, container_id: str, restarted: bool = False):
+        self.adopted.append({"app": app_name, "container_id": container_id})
+        if restarted:
+            self.restarted.append({"app": app_name, "container_id": container_id})
+
+    def container_removed(self, app_name: Optional[str], container_id: str):
+        self.orphaned.append({"app": app_name, "container_id": container_id})
+
+    def nginx_config_rebuilt(self, app_name: str):
+        self.nginx_rebuilt.append(app_name)
+
+    def policy_restored(self, app_name: str):
+        self.policies_restored.append(app_name)
+
+    def skip(self, step: str, reason: str):
+        self.skipped.append({"step": step, "reason": reason})
+
+    def fail(self, step: str, error: Any, app_name: Optional[str] = None):
+        self.failures.append({"step": step, "app": app_name, "error": str(error)})
+
+    def to_dict(self) -> Dict[str, Any]:
+        finished_at = time.time()
+        return {
+            "trigger": self.trigger,
+            "node_id": self.node_id,
+            "started_at": self.started_at,
+            "finished_at": finished_at,
+            "duration_seconds": round(finished_at - self.started_at, 3),
+            "clean": not self.failures,
+            "counts": {
+                "adopted": len(self.adopted),
+                "restarted": len(self.restarted),
+                "orphaned": len(self.orphaned),
+                "nginx_rebuilt": len(self.nginx_rebuilt),
+                "policies_restored": len(self.policies_restored),
+                "health_restored": self.health_restored,
+                "failures": len(self.failures)
+            },
+            "adopted": self.adopted,
+            "restarted": self.restarted,
+            "orphaned": self.orphaned,
+            "nginx_rebuilt": self.nginx_rebuilt,
+            "policies_restored": self.policies_restored,
+            "skipped": self.skipped,
+            "failures": self.failures
+        }
+
+def publish(state_store: Any, report: ReconciliationReport) -> Dict[str, Any]:
+    """Store a finished report as the latest one and log it as an event."""
+    result = report.to_dict()
+    counts = result["counts"]
+    message = (f"{report.trigger} reconciliation on {report.node_id or 'this node'}: {counts['adopted']} adopted, "
+               f"{counts['restarted']} restarted, {counts['orphaned']} orphaned removed, "
+               f"{counts['nginx_rebuilt']} nginx configs rebuilt, {counts['policies_restored']} policies restored")
+    if result["failures"]:
+        message += f", {counts['failures']} failed"
+    if not state_store.save_setting(REPORT_SETTING_KEY, result):
+        logger.warning("Failed to store the reconciliation report")
+    state_store.log_event(SYSTEM_EVENT_SCOPE, EVENT_TYPE, result, message=message,
+                          severity="info" if result["clean"] else "warning")
+    logger.info(message)
+    return result
+
+def last(state_store: Any) -> Optional[Dict[str, Any]]:
+    """The latest reconciliation report of any node, or None before the first one."""
+    report = state_store.get_setting(REPORT_SETTING_KEY)
+    return report if isinstance(report, dict) else None
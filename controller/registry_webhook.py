@@ -0,0 +1,150 @@
+"""
+Continuous deployment from registry push events.
+Docker Hub, GitHub Container Registry and Harbor can call
+POST /integrations/registry/webhook when an image is pushed. Apps with
+`continuousDeployment.enabled` whose image is in the pushed repository, and
+whose `continuousDeployment.tags` match the pushed tag, get a rolling update
+to the new image, pinned to the pushed digest.
+"""
+
+import os
+import hmac
+import hashlib
+import fnmatch
+import logging
+from typing import Any, Dict, List, Optional, Tuple
+
+logger = logging.getLogger(__name__)
+
+# Shared secret registries authenticate with; the endpoint is off while unset
+WEBHOOK_SECRET_ENV = "ORCHESTRY_REGISTRY_WEBHOOK_SECRET"
+# Name deploys triggered by a push are recorded under
+WEBHOOK_USER = "registry-webhook"
+
+DOCKER_HUB_PREFIXES = ("docker.io/", "index.docker.io/", "registry-1.docker.io/")
+
+def webhook_secret() -> Optional[str]:
+    return os.getenv(WEBHOOK_SECRET_ENV) or None
+
+def authenticate(secret: str, body: bytes, headers: Dict[str, str], token: Optional[str]) -> bool:
+    """Check a push request: GitHub signs the body (X-Hub-Signature-256), Harbor sends the
+    secret in Authorization, and Docker Hub can only pass it as ?token=."""
+    signature = headers.get("x-hub-signature-256")
+    if signature:
+        expected = "sha256=" + hmac.new(secret.encode(), body, hashlib.sha256).hexdigest()
+        return hmac.compare_digest(signature, expected)
+    authorization = headers.get("authorization") or ""
+    if authorization.lower().startswith("bearer "):
+        authorization = authorization[7:]
+    for candidate in (authorization.strip(), token):
+        if candidate and hmac.compare_digest(candidate, secret):
+            return True
+    return False
+
+def split_image(image: str) -> Tuple[str, Optional[str], Optional[str]]:
+    """registry:5000/team/app:1.2@sha256:... -> (registry:5000/team/app, 1.2, sha256:...)"""
+    image, _, digest = image.partition("@")
+    name, _, tag = image.rpartition(":")
+    if not name or "/" in tag:
+        return image, None, digest or None
+    return name, tag, digest or None
+
+def normalize_repository(repository: str) -> str:
+    """Spell a repository the same way whichever registry or spec it comes from."""
+    repository = repository.strip().lower()
+    for prefix in DOCKER_HUB_PREFIXES:
+        if repository.startswith(prefix):
+            repository = repository[len(prefix):]
+    if repository.startswith("library/"):
+        repository = repository[len("library/"):]
+    return repository
+
+def parse_push_event(payload: Any) -> List[Dict[str, Any]]:
+    """The pushes described by a Docker Hub, GHCR (GitHub package event) or Harbor payload,
+    as [{"registry", "repository", "tag", "digest"}]. Untagged pushes are left out."""
+    if not isinstance(payload, dict):
+        return []
+    pushes = []
+
+    # Docker Hub
+    if isinstance(payload.get("push_data"), dict) and isinstance(payload.get("repository"), dict):
+        tag = payload["push_data"].get("tag")
+        repository = payload["repository"].get("repo_name")
+        if tag and repository:
+            pushes.append({"registry": "dockerhub", "repository": repository, "tag": tag, "digest": None})
+
+    # GitHub Container Registry ("package" and "registry_package" events)
+    package = payload.get("package") or payload.get("registry_package")
+    if isinstance(package, dict) and str(package.get("package_type", "")).lower() == "container":
+        version = package.get("package_version") or {}
+        tag = ((version.get("container_metadata") or {}).get("tag") or {})
+        namespace = package.get("namespace") or (package.get("owner") or {}).get("login")
+        digest = tag.get("digest") or (version.get("version") if str(version.get("version", "")).startswith("sha256:") else None)
+        if tag.get("name") and namespace and package.get("name"):
+            pushes.append({"registry": "ghcr", "repository": f"ghcr.io/{namespace}/{package['name']}",
+                           "tag": tag["name"], "digest": digest})
+
+    # Harbor
+    if payload.get("type") in ("PUSH_ARTIFACT", "pushImage") and isinstance(payload.get("event_data"), dict):
+        for resource in payload["event_data"].get("resources") or []:
+            repository, url_tag, _ = split_image(resource.get("resource_url") or "")
+            tag = resource.get("tag") or url_tag
+            if repository and tag:
+                pushes.append({"registry": "harbor", "repository": repository, "tag": tag,
+                               "digest": resource.get("digest")})
+
+    for push in pushes:
+        push["repository"] = normalize_repository(push["repository"])
+    return pushes
+
+def validate_continuous_deployment(config: Any, image: Optional[str]) -> Tuple[Optional[Dict[str, Any]], Optional[str]]:
+    """Normalize `continuousDeployment`. Returns (config to store or None if off, error)."""
+    if not config:
+        return None, None
+    if isinstance(config, bool):
+        config = {"enabled": config}
+    if not isinstance(config, dict):
+        return None, "continuousDeployment must be true/false or a mapping"
+    if not config.get("enabled", True):
+        return None, None
+
+    tags = config.get("tags")
+    if tags is None:
+        # Follow the tag the spec names, e.g. a push of :main redeploys an app on :main
+        _, tag, _ = split_image(image or "")
+        if not tag:
+            return None, "continuousDeployment.tags is required when the image has no tag"
+        tags = [tag]
+    if isinstance(tags, str):
+        tags = [tags]
+    if not isinstance(tags, list) or not tags or not all(isinstance(tag, str) and tag.strip() for tag in tags):
+        return None, "continuousDeployment.tags must be a list of tag patterns, e.g. [main, 'v*']"
+    return {"enabled": True, "tags": [tag.strip() for tag in tags]}, None
+
+def matches(app_spec: Dict[str, Any], push: Dict[str, Any]) -> bool:
+    """Whether a push should be deployed to an app with this (stored) spec."""
+    config = app_spec.get("continuousDeployment")
+    if not config:
+        return False
+    repository, _, _ = split_image(app_spec.get("image") or "")
+    if normalize_repository(repository) != push["repository"]:
+        return False
+    return any(fnmatch.fnmatchcase(push["tag"], pattern) for pattern in config["tags"])
+
+def target_image(app_spec: Dict[str, Any], push: Dict[str, Any], digest: Optional[str]) -> str:
+    """The image to deploy for a push: the app's repository (as the spec spells it) with the
+    pushed tag, pinned to the digest so moving tags are pulled again."""
+    repository, _, _ = split_image(app_spec["image"])
+    image = f"{repository}:{push['tag']}"
+    return f"{image}@{digest}" if digest else image
+
+def resolve_digest(docker_client: Any, app_spec: Dict[str, Any], push: Dict[str, Any]) -> Optional[str]:
+    """The pushed digest, looked up in the registry when the payload has none (Docker Hub)."""
+    if push.get("digest"):
+        return push["digest"]
+    repository, _, _ = split_image(app_spec["image"])
+    try:
+        return docker_client.images.get_registry_data(f"{repository}:{push['tag']}").id
+    except Exception as e:
+        logger.warning(f"Could not resolve the digest of {repository}:{push['tag']}: {e}")
+        return None
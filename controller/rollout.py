@@ -0,0 +1,103 @@
+"""
+Rolling image updates.
+A deploy patches only the image of an app's latest spec revision. If the app is
+running, its replicas are replaced one at a time: a replica with the new image
+is started, and the old one is drained and stopped once the new one is ready.
+If a new replica does not become ready, the previous revision is registered
+again and the replicas already replaced are rolled back the same way.
+Env changes (POST /apps/{name}/env) patch only the spec's env section and roll
+out the same way, except that every replica is replaced since the image stays.
+"""
+
+import os
+import re
+import copy
+import time
+from typing import Any, Dict, List, Optional
+
+# How long a new replica may take to pass its health check
+DEFAULT_READY_TIMEOUT_SECONDS = int(os.getenv("ORCHESTRY_ROLLOUT_READY_TIMEOUT", "300"))
+
+# repository[:tag][@digest], e.g. ghcr.io/acme/api:3f9c2e1 or acme/api@sha256:...
+IMAGE_PATTERN = re.compile(r"^[a-z0-9]+([._/:-][a-z0-9]+)*(:[\w][\w.-]{0,127})?(@sha256:[a-f0-9]{64})?$", re.IGNORECASE)
+# POSIX environment variable names, e.g. LOG_LEVEL
+ENV_NAME_PATTERN = re.compile(r"^[A-Za-z_][A-Za-z0-9_]*$")
+
+def validate_image(image: Any) -> Optional[str]:
+    """Error message if image is not a usable image reference, else None."""
+    if not isinstance(image, str) or not image.strip():
+        return "image is required"
+    if not IMAGE_PATTERN.match(image.strip()):
+        return f"{image} is not a valid image reference"
+    return None
+
+def patch_image(spec: Dict[str, Any], image: str) -> Dict[str, Any]:
+    """A copy of a registered spec with only the image replaced."""
+    patched = copy.deepcopy(spec)
+    patched.setdefault("spec", {})["image"] = image.strip()
+    return patched
+
+def validate_env_changes(values: Any, unset: Any) -> Optional[str]:
+    """Error message if env values to set ({name: value}) or names to unset are invalid, else None."""
+    if not isinstance(values, dict) or not isinstance(unset, list):
+        return "set must be a mapping of names to values and unset a list of names"
+    if not values and not unset:
+        return "nothing to change: give variables to set or unset"
+    for name in list(values) + unset:
+        if not isinstance(name, str) or not ENV_NAME_PATTERN.match(name):
+            return f"{name} is not a valid environment variable name"
+    for name, value in values.items():
+        if not isinstance(value, str):
+            return f"the value of {name} must be a string"
+    both = sorted(set(values) & set(unset))
+    if both:
+        return f"{', '.join(both)} cannot be both set and unset"
+    return None
+
+def patch_env(spec: Dict[str, Any], values: Dict[str, str], unset: List[str]) -> Dict[str, Any]:
+    """A copy of a registered spec with only env changed: values replace (or are appended
+    after) the variables of the same name, and unset names are removed. Other entries,
+    such as valueFrom: sdk ones, keep their order."""
+    patched = copy.deepcopy(spec)
+    app_spec = patched.setdefault("spec", {})
+    remaining = dict(values)
+    env = []
+    for entry in app_spec.get("env") or []:
+        name = entry.get("name")
+        if name in unset:
+            continue
+        if name in remaining:
+            entry = {"name": name, "value": remaining.pop(name)}
+        env.append(entry)
+    env.extend({"name": name, "value": value} for name, value in remaining.items())
+    if env:
+        app_spec["env"] = env
+    else:
+        app_spec.pop("env", None)
+    return patched
+
+def env_values(spec: Dict[str, Any]) -> Dict[str, Optional[str]]:
+    """An app spec's env as {name: value}; valueFrom entries map to None."""
+    return {entry["name"]: None if entry.get("valueFrom") else entry.get("value", "")
+            for entry in spec.get("env") or [] if entry.get("name")}
+
+def new_rollout(app_name: str, revision: Optional[int], image: str, previous_image: Optional[str],
+                total: int, requested_by: Optional[str], change: str = "image",
+                grace_period: Optional[int] = None) -> Dict[str, Any]:
+    """Progress record of a rollout, as returned by GET /apps/{name}/rollout."""
+    return {
+        "app": app_name,
+        "revision": revision,
+        "image": image,
+        "previous_image": previous_image,
+        "change": change,  # image or env
+        "state": "in_progress",  # in_progress, rolling_back, succeeded, failed
+        "replaced": 0,
+        "total": total,
+        "grace_period": grace_period,  # seconds old replicas get after SIGTERM; None: the app's own
+        "rolled_back": False,
+        "error": None,
+        "requested_by": requested_by,
+        "started_at": time.time(),
+        "finished_at": None
+    }
@@ -0,0 +1,459 @@
+"""
+Container runtimes.
+The app manager and its helpers use a small part of the Docker SDK client,
+described by ContainerRuntime. ORCHESTRY_RUNTIME picks the implementation:
+Docker (docker.from_env()), Podman (the same client on Podman's
+Docker-compatible socket) or containerd (NerdctlRuntime in containerd.py).
+FakeRuntime keeps containers, networks and images in memory so the manager
+can be exercised in unit tests without a Docker daemon:
+
+    runtime = FakeRuntime()
+    manager = AppManager(state_store, FakeLoadBalancer(), runtime=runtime)
+    manager.scale("web", 3)
+    runtime.crash(runtime.containers.list()[0].id)   # emits a "die" event
+
+Fake containers fail the same way real ones do (docker.errors.NotFound for a
+missing container, APIError for a name conflict), so the error handling
+paths run unchanged.
+"""
+
+import os
+import queue
+import logging
+import threading
+import time
+import uuid
+from typing import Any, Dict, Iterable, List, Optional, Protocol
+
+import docker
+from docker.utils import parse_repository_tag
+
+logger = logging.getLogger(__name__)
+
+FAKE_SUBNET = "172.30"
+RUNTIMES = ("docker", "podman", "containerd")
+
+class ContainerRuntime(Protocol):
+    """The parts of docker.DockerClient Orchestry relies on."""
+
+    containers: Any  # create/get/list/run, returning objects shaped like docker Container
+    networks: Any    # get/create
+    images: Any      # get/pull/list/remove
+    api: Any         # low-level containers(all, size, filters)
+
+    def info(self) -> Dict[str, Any]: ...
+
+    def df(self) -> Dict[str, Any]: ...  # disk usage shaped like GET /system/df
+
+    def events(self, decode: bool = False, filters: Optional[Dict[str, Any]] = None) -> Iterable[Dict[str, Any]]: ...
+
+def docker_runtime() -> ContainerRuntime:
+    """The runtime for the Docker daemon the environment points at (DOCKER_HOST or the socket)."""
+    return docker.from_env()
+
+def podman_socket() -> str:
+    """Podman's Docker-compatible API socket: ORCHESTRY_PODMAN_SOCKET, else the rootful
+    socket for root and the user's rootless socket otherwise."""
+    configured = os.getenv("ORCHESTRY_PODMAN_SOCKET")
+    if configured:
+        return configured
+    if os.geteuid() == 0:
+        return "/run/podman/podman.sock"
+    return os.path.join(os.getenv("XDG_RUNTIME_DIR", f"/run/user/{os.getuid()}"), "podman", "podman.sock")
+
+def podman_runtime() -> ContainerRuntime:
+    """Podman through its Docker-compatible API (`podman system service`)."""
+    socket = podman_socket()
+    return docker.DockerClient(base_url=socket if "://" in socket else f"unix://{socket}")
+
+def network_gateway(runtime: Any, network: str = "orchestry") -> str:
+    """The host's address on a container network, as seen from its containers."""
+    attrs = runtime.networks.get(network)
+    attrs = getattr(attrs, "attrs", attrs) or {}
+    for config in (attrs.get("IPAM") or {}).get("Config") or []:
+        if config.get("Gateway"):
+            return config["Gateway"]
+    return "127.0.0.1"
+
+def configured_runtime() -> ContainerRuntime:
+    """The runtime selected by ORCHESTRY_RUNTIME (docker, podman or containerd), routing
+    runtime: process apps to the process runtime when it is enabled."""
+    name = os.getenv("ORCHESTRY_RUNTIME", "docker").strip().lower()
+    if name == "docker":
+        runtime = docker_runtime()
+    elif name == "podman":
+        runtime = podman_runtime()
+    elif name == "containerd":
+        from .containerd import NerdctlRuntime
+        runtime = NerdctlRuntime()
+    else:
+        raise RuntimeError(f"Unknown ORCHESTRY_RUNTIME '{name}' (use one of {', '.join(RUNTIMES)})")
+
+    from . import process_runtime
+    if not process_runtime.PROCESS_RUNTIME_ENABLED:
+        return runtime
+    processes = process_runtime.ProcessRuntime(
+        address=lambda: process_runtime.PROCESS_ADDRESS or network_gateway(runtime))
+    return process_runtime.RoutedRuntime(runtime, processes)
+
+def labels_match(labels: Dict[str, str], wanted: Any) -> bool:
+    """Whether labels satisfy a Docker "label" filter ("key", "key=value" or a list of them)."""
+    for label in ([wanted] if isinstance(wanted, str) else wanted or []):
+        key, _, value = label.partition("=")
+        if key not in labels or (value and labels[key] != value):
+            return False
+    return True
+
+class ExecResult:
+    def __init__(self, exit_code: int, output: bytes):
+        self.exit_code = exit_code
+        self.output = output
+
+class FakeContainer:
+    """In-memory stand-in for docker.models.containers.Container."""
+
+    def __init__(self, runtime: "FakeRuntime", name: str, image: str, labels: Dict[str, str],
+                 environment: Optional[Dict[str, str]], network: Optional[str], ports: Optional[Dict],
+                 config: Dict[str, Any]):
+        self._runtime = runtime
+        self.id = uuid.uuid4().hex + uuid.uuid4().hex
+        self.name = name
+        self.labels = dict(labels or {})
+        self.status = "created"
+        self.config = config
+        self.log_lines: List[str] = []
+        self.exec_results: Dict[str, ExecResult] = {}
+        self.attrs: Dict[str, Any] = {
+            "Id": self.id,
+            "Name": f"/{name}",
+            "Created": time.strftime("%Y-%m-%dT%H:%M:%SZ", time.gmtime()),
+            "Config": {
+                "Image": image,
+                "Labels": self.labels,
+                "Env": [f"{k}={v}" for k, v in (environment or {}).items()]
+            },
+            "HostConfig": {"PortBindings": {
+                port: [{"HostIp": "", "HostPort": str(host)}] for port, host in (ports or {}).items() if host
+            }},
+            "State": {"Status": self.status, "Running": False, "ExitCode": 0, "OOMKilled": False},
+            "NetworkSettings": {"Networks": {}}
+        }
+        if network:
+            self.attrs["NetworkSettings"]["Networks"][network] = {"IPAddress": runtime._next_ip()}
+
+    def _set_status(self, status: str, exit_code: int = 0, action: Optional[str] = None):
+        self.status = status
+        self.attrs["State"].update(Status=status, Running=status == "running", ExitCode=exit_code)
+        if action:
+            self._runtime.emit(self, action)
+
+    def _check_exists(self):
+        if self.id not in self._runtime.containers._by_id:
+            raise docker.errors.NotFound(f"No such container: {self.id}")
+
+    def reload(self):
+        self._check_exists()
+
+    def start(self):
+        self._check_exists()
+        if self.name in self._runtime.fail_start:
+            self._set_status("exited", 1, "die")
+            raise docker.errors.APIError(f"Cannot start container {self.name}: simulated failure")
+        if self.status != "running":
+            self._set_status("running", action="start")
+
+    def stop(self, timeout: Optional[int] = None):
+        self._check_exists()
+        if self.status in ("running", "paused"):
+            self._set_status("exited", 0, "die")
+
+    def kill(self, signal: Any = None):
+        self._check_exists()
+        if self.status in ("running", "paused"):
+            self._set_status("exited", 137, "die")
+
+    def restart(self, timeout: Optional[int] = None):
+        self.stop()
+        self.start()
+
+    def pause(self):
+        self._check_exists()
+        self._set_status("paused", action="pause")
+
+    def unpause(self):
+        self._check_exists()
+        self._set_status("running", action="unpause")
+
+    def remove(self, force: bool = False, v: bool = False):
+        self._check_exists()
+        if self.status == "running" and not force:
+            raise docker.errors.APIError(f"Cannot remove running container {self.name}")
+        self._runtime.containers._forget(self)
+        self._runtime.emit(self, "destroy")
+
+    def update(self, **kwargs):
+        self._check_exists()
+        self.config.update(kwargs)
+
+    def logs(self, tail: Any = "all", timestamps: bool = False, **kwargs) -> bytes:
+        lines = self.log_lines if tail == "all" else self.log_lines[-int(tail):]
+        return "".join(f"{line}\n" for line in lines).encode()
+
+    def stats(self, stream: bool = False, **kwargs) -> Dict[str, Any]:
+        return {
+            "cpu_stats": {"cpu_usage": {"total_usage": 0}, "system_cpu_usage": 0, "online_cpus": 1},
+            "precpu_stats": {"cpu_usage": {"total_usage": 0}, "system_cpu_usage": 0},
+            "memory_stats": {"usage": 0, "limit": self.config.get("mem_limit") or 0}
+        }
+
+    def exec_run(self, cmd: Any, **kwargs) -> ExecResult:
+        self._check_exists()
+        key = " ".join(cmd) if isinstance(cmd, (list, tuple)) else cmd
+        return self.exec_results.get(key, ExecResult(0, b""))
+
+class FakeContainers:
+    def __init__(self, runtime: "FakeRuntime"):
+        self._runtime = runtime
+        self._by_id: Dict[str, FakeContainer] = {}
+
+    def _forget(self, container: FakeContainer):
+        self._by_id.pop(container.id, None)
+
+    def create(self, image: str, name: Optional[str] = None, labels: Optional[Dict[str, str]] = None,
+               environment: Optional[Dict[str, str]] = None, network: Optional[str] = None,
+               ports: Optional[Dict] = None, **kwargs) -> FakeContainer:
+        with self._runtime._lock:
+            name = name or f"fake-{uuid.uuid4().hex[:8]}"
+            taken = next((c for c in self._by_id.values() if c.name == name), None)
+            if taken:
+                raise docker.errors.APIError(f"Conflict. The container name \"/{name}\" is already in use by "
+                                             f"container \"{taken.id}\". You have to remove (or rename) that "
+                                             f"container to be able to reuse that name.")
+            if network and network not in self._runtime.networks._names:
+                raise docker.errors.NotFound(f"network {network} not found")
+            if self._runtime.strict_images:
+                self._runtime.images.get(image)
+            container = FakeContainer(self._runtime, name, image, labels, environment, network, ports, kwargs)
+            self._by_id[container.id] = container
+            return container
+
+    def run(self, image: str, detach: bool = True, **kwargs) -> FakeContainer:
+        container = self.create(image, **kwargs)
+        container.start()
+        return container
+
+    def get(self, container_id: str) -> FakeContainer:
+        with self._runtime._lock:
+            for container in self._by_id.values():
+                if container_id in (container.id, container.name) or \
+                        (len(container_id) >= 12 and container.id.startswith(container_id)):
+                    return container
+        raise docker.errors.NotFound(f"No such container: {container_id}")
+
+    def list(self, all: bool = False, filters: Optional[Dict[str, Any]] = None, **kwargs) -> List[FakeContainer]:
+        filters = filters or {}
+        with self._runtime._lock:
+            containers = list(self._by_id.values())
+        result = []
+        for container in containers:
+            if not all and container.status != "running":
+                continue
+            if "label" in filters and not labels_match(container.labels, filters["label"]):
+                continue
+            if "id" in filters and not container.id.startswith(filters["id"]):
+                continue
+            if "name" in filters and filters["name"] not in container.name:
+                continue
+            if "status" in filters and container.status != filters["status"]:
+                continue
+            result.append(container)
+        return result
+
+class FakeNetworks:
+    def __init__(self):
+        self._names: Dict[str, Dict[str, Any]] = {}
+
+    def get(self, name: str) -> Dict[str, Any]:
+        if name not in self._names:
+            raise docker.errors.NotFound(f"network {name} not found")
+        return self._names[name]
+
+    def create(self, name: str, **kwargs) -> Dict[str, Any]:
+        self._names[name] = dict(kwargs, name=name)
+        return self._names[name]
+
+class FakeImage:
+    def __init__(self, name: str, platform: str = "linux/amd64", created: Optional[float] = None,
+                 labels: Optional[Dict[str, str]] = None, size: int = 0):
+        os_name, _, arch = platform.partition("/")
+        self.id = "sha256:" + uuid.uuid4().hex + uuid.uuid4().hex
+        self.tags = [name]
+        self.attrs = {
+            "Id": self.id, "Os": os_name, "Architecture": arch, "RepoTags": self.tags, "RepoDigests": [],
+            "Created": time.strftime("%Y-%m-%dT%H:%M:%SZ", time.gmtime(created or time.time())),
+            "Config": {"Labels": dict(labels or {})}, "Size": size
+        }
+
+class FakeImages:
+    def __init__(self, runtime: Optional["FakeRuntime"] = None):
+        self._runtime = runtime
+        self._images: Dict[str, FakeImage] = {}
+        self.pulls: List[str] = []
+        self.removed: List[str] = []  # references passed to remove(), in order
+
+    def add(self, name: str, platform: str = "linux/amd64", created: Optional[float] = None,
+            labels: Optional[Dict[str, str]] = None, size: int = 0) -> FakeImage:
+        """Add an image; created (a timestamp) and labels feed image GC."""
+        self._images[name] = FakeImage(name, platform, created, labels, size)
+        return self._images[name]
+
+    def list(self, **kwargs) -> List[FakeImage]:
+        return list({id(image): image for image in self._images.values()}.values())
+
+    def remove(self, image: str, force: bool = False, noprune: bool = False):
+        """Untag a reference, or delete an image by ID, refusing (like Docker) while a
+        container was created from it."""
+        found = self._images.get(image) or next((i for i in self._images.values() if i.id == image), None)
+        if not found:
+            raise docker.errors.ImageNotFound(f"No such image: {image}")
+        if not force and self._runtime and any(
+                c.attrs["Config"]["Image"] in found.tags for c in self._runtime.containers.list(all=True)):
+            raise docker.errors.APIError(f"conflict: unable to remove {image}: image is being used by a container")
+        self.removed.append(image)
+        for tag in [image] if image in found.tags else list(found.tags):
+            found.tags.remove(tag)
+            self._images.pop(tag, None)
+
+    def get(self, name: str) -> FakeImage:
+        if name not in self._images:
+            raise docker.errors.ImageNotFound(f"No such image: {name}")
+        return self._images[name]
+
+    def pull(self, repository: str, tag: Optional[str] = None, **kwargs) -> FakeImage:
+        repository, parsed_tag = parse_repository_tag(repository)
+        name = f"{repository}:{tag or parsed_tag or 'latest'}"
+        self.pulls.append(name)
+        return self._images.get(name) or self.add(name)
+
+class FakeAPI:
+    def __init__(self, runtime: "FakeRuntime"):
+        self._runtime = runtime
+
+    def containers(self, all: bool = False, size: bool = False, filters: Optional[Dict[str, Any]] = None) -> List[Dict]:
+        return [
+            {"Id": c.id, "Names": [f"/{c.name}"], "Labels": c.labels, "State": c.status,
+             "SizeRw": self._runtime.disk_usage.get(c.id, 0)}
+            for c in self._runtime.containers.list(all=all, filters=filters)
+        ]
+
+class EventStream:
+    """Blocking iterator over emitted events; close() ends it like the SDK's stream.
+    follow() also forwards another runtime's stream into it."""
+
+    _CLOSED = object()
+
+    def __init__(self, filters: Optional[Dict[str, Any]]):
+        self.filters = filters or {}
+        self._queue: "queue.Queue[Any]" = queue.Queue()
+        self._followed: List[Any] = []
+
+    def put(self, event: Dict[str, Any]):
+        if "label" in self.filters and not labels_match(event["Actor"]["Attributes"], self.filters["label"]):
+            return
+        self._queue.put(event)
+
+    def follow(self, stream: Any):
+        def forward():
+            try:
+                for event in stream:
+                    self._queue.put(event)
+            except Exception as e:
+                logger.debug(f"Followed event stream ended: {e}")
+            self.close()  # the reader reconnects, as it would after a daemon restart
+        self._followed.append(stream)
+        threading.Thread(target=forward, daemon=True, name="runtime-events").start()
+
+    def close(self):
+        for stream in self._followed:
+            try:
+                stream.close()
+            except Exception:
+                pass
+        self._queue.put(self._CLOSED)
+
+    def __iter__(self):
+        while True:
+            event = self._queue.get()
+            if event is self._CLOSED:
+                return
+            yield event
+
+class FakeRuntime:
+    """An in-memory ContainerRuntime. Containers never run anything: they only move
+    between states, and each one gets a unique address on FAKE_SUBNET."""
+
+    def __init__(self, architecture: str = "x86_64", os_type: str = "linux", name: str = "fake-host",
+                 strict_images: bool = False):
+        self._lock = threading.RLock()
+        self._ip_counter = 1
+        self._streams: List[EventStream] = []
+        self.info_data = {"Name": name, "OSType": os_type, "Architecture": architecture, "ServerVersion": "fake"}
+        self.strict_images = strict_images  # creating a container needs the image to be present
+        self.fail_start: set = set()  # container names whose start() fails
+        self.disk_usage: Dict[str, int] = {}  # container id -> SizeRw
+        self.volume_usage: Dict[str, int] = {}  # volume name -> size, reported by df()
+        self.containers = FakeContainers(self)
+        self.networks = FakeNetworks()
+        self.images = FakeImages(self)
+        self.api = FakeAPI(self)
+
+    def _next_ip(self) -> str:
+        with self._lock:
+            self._ip_counter += 1
+            return f"{FAKE_SUBNET}.{self._ip_counter // 250}.{self._ip_counter % 250 + 1}"
+
+    def info(self) -> Dict[str, Any]:
+        return dict(self.info_data)
+
+    def ping(self) -> bool:
+        return True
+
+    def df(self) -> Dict[str, Any]:
+        containers = self.containers.list(all=True)
+        images = []
+        for image in self.images.list():
+            users = sum(1 for c in containers if c.attrs["Config"]["Image"] in image.tags)
+            images.append({"Id": image.id, "Size": image.attrs["Size"], "SharedSize": 0, "Containers": users})
+        return {
+            "LayersSize": sum(image["Size"] for image in images),
+            "Images": images,
+            "Containers": [{"Id": c.id, "State": c.status, "SizeRw": self.disk_usage.get(c.id, 0)} for c in containers],
+            "Volumes": [{"Name": name, "UsageData": {"Size": size, "RefCount": 0}}
+                        for name, size in self.volume_usage.items()],
+            "BuildCache": []
+        }
+
+    def events(self, decode: bool = False, filters: Optional[Dict[str, Any]] = None) -> EventStream:
+        stream = EventStream(filters)
+        with self._lock:
+            self._streams.append(stream)
+        return stream
+
+    def emit(self, container: FakeContainer, action: str):
+        event = {
+            "Type": "container", "Action": action, "status": action, "id": container.id,
+            "Actor": {"ID": container.id, "Attributes": dict(container.labels, name=container.name)},
+            "time": int(time.time())
+        }
+        with self._lock:
+            streams = list(self._streams)
+        for stream in streams:
+            stream.put(event)
+
+    def crash(self, container_id: str, exit_code: int = 1, oom: bool = False):
+        """Make a running container exit as if its process died."""
+        container = self.containers.get(container_id)
+        container.attrs["State"]["OOMKilled"] = oom
+        if oom:
+            self.emit(container, "oom")
+        container._set_status("exited", 137 if oom else exit_code, "die")
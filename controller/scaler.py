@@ -3,20 +3,38 @@ Autoscaling logic for HTTP applications.
 Makes scaling decisions based on metrics like RPS, latency, CPU, and memory.
 """
 
+import os
+import sys
 import time
 import logging
 import statistics
 import math
 import threading
-from typing import Dict, List, Optional, Any
-from dataclasses import dataclass, field
+import heapq
+from typing import Dict, Iterable, List, Optional, Any
+from dataclasses import dataclass, field, fields, is_dataclass
 from collections import deque, defaultdict
 
+from . import metrics_sources
+
 logger = logging.getLogger(__name__)
 
 METRICS_RETENTION_MULTIPLIER = 2 # 2x window for analysis
 MIN_SCALE_IN_STABLE_PERIODS = 3 # req 3 consecutive periods below threshold before scaling in
 EMERGENCY_SCALE_FACTOR = 10.0
+# Load balancer distress (502/504s, failed upstream attempts) is sampled over this many seconds
+SATURATION_SAMPLE_SECONDS = 10
+# Samples older than this are ignored; fewer errors than SATURATION_MIN_ERRORS never trigger
+SATURATION_MAX_AGE_SECONDS = 30
+SATURATION_MIN_ERRORS = 5
+# Default seconds between an app's metric collection and scaling evaluation
+DEFAULT_EVALUATION_INTERVAL_SECONDS = 10
+MAX_EVALUATION_INTERVAL_SECONDS = 3600
+# Caps on what the autoscaler keeps in memory per app: points per metric series and
+# recent decisions. The oldest entries are dropped first, and everything kept for an
+# app is evicted once the app is deleted.
+METRICS_HISTORY_MAX_POINTS = max(10, int(os.getenv("ORCHESTRY_METRICS_HISTORY_MAX_POINTS", "1000")))
+SCALE_DECISIONS_MAX = max(1, int(os.getenv("ORCHESTRY_SCALE_DECISIONS_MAX", "100")))
 
 @dataclass
 class ScalingPolicy:
@@ -32,6 +50,11 @@ class ScalingPolicy:
     cooldown_seconds: int = 30
     max_cpu_percent: float = 70.0
     max_memory_percent: float = 75.0
+    saturation_error_rate_pct: float = 5.0  # 0 disables saturation scale-out
+    saturation_scale_factor: float = 1.5
+    saturation_cooldown_seconds: int = 20
+    evaluation_interval_seconds: int = DEFAULT_EVALUATION_INTERVAL_SECONDS
+    external_metrics: List[Dict[str, Any]] = field(default_factory=list)  # from scaling.externalMetrics
 
     def __post_init__(self):
         """Validate policy parameters."""
@@ -55,6 +78,52 @@ class ScalingPolicy:
             raise ValueError("max_cpu_percent must be between 0 and 100")
         if self.max_memory_percent <= 0 or self.max_memory_percent > 100:
             raise ValueError("max_memory_percent must be between 0 and 100")
+        if self.saturation_error_rate_pct < 0 or self.saturation_error_rate_pct > 100:
+            raise ValueError("saturation_error_rate_pct must be between 0 and 100")
+        if self.saturation_scale_factor <= 1:
+            raise ValueError("saturation_scale_factor must be > 1")
+        if self.saturation_cooldown_seconds < 0:
+            raise ValueError("saturation_cooldown_seconds must be >= 0")
+        if not 1 <= self.evaluation_interval_seconds <= MAX_EVALUATION_INTERVAL_SECONDS:
+            raise ValueError(f"evaluation_interval_seconds must be between 1 and {MAX_EVALUATION_INTERVAL_SECONDS}")
+
+# Defaults for the fields of an app spec's `scaling` section
+SCALING_DEFAULTS = {
+    "mode": "auto",
+    "minReplicas": 1,
+    "maxReplicas": 5,
+    "targetRPSPerReplica": 50,
+    "maxP95LatencyMs": 250,
+    "scaleOutThresholdPct": 80,
+    "scaleInThresholdPct": 30,
+    "windowSeconds": 60,
+    "cooldownSeconds": 300,
+    "saturationErrorRatePct": 5,
+    "saturationScaleFactor": 1.5,
+    "saturationCooldownSeconds": 20,
+    "evaluationIntervalSeconds": DEFAULT_EVALUATION_INTERVAL_SECONDS,
+}
+
+def policy_from_scaling(scaling: Optional[Dict[str, Any]], defaults: Optional[Dict[str, Any]] = None) -> ScalingPolicy:
+    """Build the policy for a spec's `scaling` section, with fields it leaves out taken from
+    defaults (its namespace's) and then SCALING_DEFAULTS. Raises ValueError if it is invalid."""
+    config = {**SCALING_DEFAULTS, **(defaults or {}),
+              **{key: value for key, value in (scaling or {}).items() if value is not None}}
+    return ScalingPolicy(
+        min_replicas=config["minReplicas"],
+        max_replicas=config["maxReplicas"],
+        target_rps_per_replica=config["targetRPSPerReplica"],
+        max_p95_latency_ms=config["maxP95LatencyMs"],
+        scale_out_threshold_pct=config["scaleOutThresholdPct"],
+        scale_in_threshold_pct=config["scaleInThresholdPct"],
+        window_seconds=config["windowSeconds"],
+        cooldown_seconds=config["cooldownSeconds"],
+        saturation_error_rate_pct=config["saturationErrorRatePct"],
+        saturation_scale_factor=config["saturationScaleFactor"],
+        saturation_cooldown_seconds=config["saturationCooldownSeconds"],
+        evaluation_interval_seconds=config["evaluationIntervalSeconds"],
+        external_metrics=list(config.get("externalMetrics") or [])
+    )
 
 @dataclass
 class MetricPoint:
@@ -72,6 +141,25 @@ class ScalingMetrics:
     memory_percent: float = 0.0
     healthy_replicas: int = 0
     total_replicas: int = 0
+    external: Dict[str, float] = field(default_factory=dict)  # external metric name -> value
+
+@dataclass
+class SaturationSample:
+    """Load balancer distress for an app over the last SATURATION_SAMPLE_SECONDS."""
+    timestamp: float
+    requests: int = 0
+    bad_gateway: int = 0  # 502 responses
+    gateway_timeout: int = 0  # 504 responses
+    upstream_errors: int = 0  # failed upstream attempts nginx retried on another replica
+    ready_replicas: int = 0
+
+    @property
+    def errors(self) -> int:
+        return self.bad_gateway + self.gateway_timeout + self.upstream_errors
+
+    @property
+    def error_rate(self) -> float:
+        return self.errors / self.requests if self.requests else 0.0
 
 @dataclass
 class ScalingDecision:
@@ -83,19 +171,34 @@ class ScalingDecision:
     triggered_by: List[str] = field(default_factory=list)
     metrics: Optional[ScalingMetrics] = None
 
+def _deep_size(value: Any) -> int:
+    """Approximate bytes of a value and what it holds."""
+    size = sys.getsizeof(value)
+    if is_dataclass(value):
+        size += sum(_deep_size(getattr(value, item.name)) for item in fields(value))
+    elif isinstance(value, dict):
+        size += sum(_deep_size(key) + _deep_size(item) for key, item in value.items())
+    elif isinstance(value, (list, tuple, set, deque)):
+        size += sum(_deep_size(item) for item in value)
+    return size
+
+_POINT_BYTES = _deep_size(MetricPoint(time.time(), 0.5))
+
 class AutoScaler:
     def __init__(self):
         self._lock = threading.RLock() #to make sure no inconsistent reads shld hppn
 
         self.policies: Dict[str, ScalingPolicy] = {}
         self.metrics_history: Dict[str, Dict[str, deque]] = defaultdict(
-            lambda: defaultdict(lambda: deque(maxlen=1000))
+            lambda: defaultdict(lambda: deque(maxlen=METRICS_HISTORY_MAX_POINTS))
         )
         self.last_scale_time: Dict[str, float] = {}
-        self.scale_decisions: Dict[str, deque] = defaultdict(lambda: deque(maxlen=100))
+        self.scale_decisions: Dict[str, deque] = defaultdict(lambda: deque(maxlen=SCALE_DECISIONS_MAX))
         # Store last calculated scale factors for debug/inspec
         self.last_scale_factors: Dict[str, Dict[str, float]] = {}
         self.scale_in_stable_periods: Dict[str, int] = defaultdict(int)
+        self.saturation: Dict[str, SaturationSample] = {}  # latest unconsumed sample per app
+        self.evicted_apps = 0
 
     def set_policy(self, app_name: str, policy: ScalingPolicy):
         """Set the scaling policy for an application."""
@@ -107,6 +210,13 @@ class AutoScaler:
                 f"scale_out={policy.scale_out_threshold_pct}%, scale_in={policy.scale_in_threshold_pct}%"
             )
 
+    def set_connection_limit(self, app_name: str, max_conns: Optional[int]):
+        """Use an app's maxConnsPerReplica as its connections target; None restores the default."""
+        with self._lock:
+            policy = self.policies.get(app_name)
+            if policy:
+                policy.max_conn_per_replica = max_conns or ScalingPolicy.max_conn_per_replica
+
     def get_policy(self, app_name: str) -> Optional[ScalingPolicy]:
         """Get the scaling policy for an application."""
         with self._lock:
@@ -125,17 +235,57 @@ class AutoScaler:
             history["memory"].append(MetricPoint(timestamp, metrics.memory_percent))
             history["healthy_replicas"].append(MetricPoint(timestamp, metrics.healthy_replicas))
             history["total_replicas"].append(MetricPoint(timestamp, metrics.total_replicas))
+            for name, value in metrics.external.items():
+                history[f"external:{name}"].append(MetricPoint(timestamp, value))
 
             # clean old metrics
             self._clean_old_metrics(app_name, timestamp)
 
+    def record_saturation(self, app_name: str, sample: SaturationSample):
+        """Record the latest load balancer distress sample for an application."""
+        with self._lock:
+            self.saturation[app_name] = sample
+
+    def _saturation_decision(self, app_name: str, current_replicas: int,
+                             policy: ScalingPolicy) -> Optional[ScalingDecision]:
+        """Scale out right away when nginx is failing requests for lack of capacity, instead
+        of waiting for the averaged window (must be called with lock held)."""
+        sample = self.saturation.get(app_name)
+        if not sample or policy.saturation_error_rate_pct <= 0:
+            return None
+        if time.time() - sample.timestamp > SATURATION_MAX_AGE_SECONDS:
+            return None
+        if sample.errors < SATURATION_MIN_ERRORS or sample.error_rate * 100 < policy.saturation_error_rate_pct:
+            return None
+        if sample.ready_replicas == 0:
+            return None  # nothing is serving; that is the no-healthy-replicas path, not saturation
+        if current_replicas >= policy.max_replicas:
+            return None
+        if time.time() - self.last_scale_time.get(app_name, 0) < policy.saturation_cooldown_seconds:
+            return None
+
+        # Each sample triggers at most one scale-out
+        del self.saturation[app_name]
+        target_replicas = min(max(math.ceil(current_replicas * policy.saturation_scale_factor), current_replicas + 1),
+                              policy.max_replicas)
+        reason = (f"Load balancer saturation: {sample.errors}/{sample.requests} requests failed "
+                  f"({sample.error_rate * 100:.1f}% >= {policy.saturation_error_rate_pct:g}%)")
+        logger.warning(f"[{app_name}] {reason}: {current_replicas} -> {target_replicas}")
+        return ScalingDecision(
+            should_scale=True,
+            target_replicas=target_replicas,
+            current_replicas=current_replicas,
+            reason=reason,
+            triggered_by=[f"saturation 502={sample.bad_gateway} 504={sample.gateway_timeout} "
+                          f"upstream_errors={sample.upstream_errors}"]
+        )
+
     def _clean_old_metrics(self, app_name: str, current_time: float):
-        """Remove metrics older than the policy window."""
+        """Remove metrics older than the policy window (the default window without a policy)."""
         policy = self.policies.get(app_name)
-        if not policy:
-            return
+        window_seconds = policy.window_seconds if policy else SCALING_DEFAULTS["windowSeconds"]
 
-        cutoff_time = current_time - (policy.window_seconds * METRICS_RETENTION_MULTIPLIER)
+        cutoff_time = current_time - (window_seconds * METRICS_RETENTION_MULTIPLIER)
 
         for metric_type, points in self.metrics_history[app_name].items():
             while points and points[0].timestamp < cutoff_time:
@@ -173,6 +323,13 @@ class AutoScaler:
                     triggered_by=["min_replicas_enforcement"]
                 )
 
+            # Saturation bypasses the averaged window and uses its own, shorter cooldown
+            saturation = self._saturation_decision(app_name, current_replicas, policy)
+            if saturation:
+                self._reset_scale_in_counter(app_name)
+                self.scale_decisions[app_name].append(saturation)
+                return saturation
+
             # Check cooldown period (but allow minReplicas enforcement to bypass cooldown)
             last_scale = self.last_scale_time.get(app_name, 0)
             time_since_scale = time.time() - last_scale
@@ -324,6 +481,14 @@ class AutoScaler:
         except statistics.StatisticsError:
             avg_total = 1.0
 
+        # External metrics that could not be read are missing from some samples, or all of them
+        external = {}
+        for key, points in history.items():
+            if key.startswith("external:"):
+                recent = [p.value for p in points if p.timestamp >= cutoff_time]
+                if recent:
+                    external[key[len("external:"):]] = statistics.mean(recent)
+
         return ScalingMetrics(
             rps=avg_rps,
             p95_latency_ms=p95_latency,
@@ -331,7 +496,8 @@ class AutoScaler:
             cpu_percent=avg_cpu,
             memory_percent=avg_memory,
             healthy_replicas=max(1, int(avg_healthy)),  # At least 1
-            total_replicas=max(1, int(avg_total))
+            total_replicas=max(1, int(avg_total)),
+            external=external
         )
 
     def _calculate_scale_factors(self, metrics: ScalingMetrics, policy: ScalingPolicy) -> Dict[str, float]:
@@ -373,6 +539,13 @@ class AutoScaler:
         if policy.max_memory_percent > 0 and metrics.memory_percent > 0:
             factors["memory"] = metrics.memory_percent / policy.max_memory_percent
 
+        # External metrics from scaling.externalMetrics
+        for metric in policy.external_metrics:
+            value = metrics.external.get(metric["name"])
+            if value is not None:
+                factors[f"external:{metric['name']}"] = metrics_sources.scale_factor(
+                    metric, value, metrics.healthy_replicas)
+
         return factors
 
     def _make_scaling_decision(
@@ -511,12 +684,116 @@ class AutoScaler:
             self._reset_scale_in_counter(app_name)
             logger.info(f"[{app_name}] Recorded scaling action: now at {new_replicas} replicas")
 
+    def preview(self, app_name: str, replicas: int, mode: str = "auto") -> Dict[str, Any]:
+        """Whether the autoscaler would undo a manual scale to `replicas` (thread-safe, records
+        nothing). The recent load is spread over the new replica count: per-replica metrics, CPU
+        and memory scale with it, latency is taken as it is."""
+        with self._lock:
+            policy = self.policies.get(app_name)
+            result = {"would_counteract": False, "target_replicas": replicas, "after_seconds": None,
+                      "projected_scale_factors": {}}
+            if mode == "manual":
+                return {**result, "reason": "App is in manual scaling mode"}
+            if not policy:
+                return {**result, "reason": "No scaling policy configured"}
+
+            # Minimum replicas are enforced on the next evaluation, cooldown or not
+            if replicas < policy.min_replicas:
+                return {**result, "would_counteract": True, "target_replicas": policy.min_replicas,
+                        "after_seconds": policy.evaluation_interval_seconds,
+                        "reason": f"Below minimum replicas: {replicas} < {policy.min_replicas}"}
+
+            metrics = self._get_recent_metrics(app_name, policy.window_seconds)
+            if not metrics:
+                return {**result, "reason": "No recent metrics available"}
+
+            spread = metrics.healthy_replicas / max(1, replicas)
+            projected = ScalingMetrics(
+                rps=metrics.rps,
+                p95_latency_ms=metrics.p95_latency_ms,
+                active_connections=metrics.active_connections,
+                cpu_percent=metrics.cpu_percent * spread,
+                memory_percent=metrics.memory_percent * spread,
+                healthy_replicas=max(1, replicas),
+                total_replicas=max(1, replicas),
+                external=metrics.external
+            )
+            factors = self._calculate_scale_factors(projected, policy)
+            max_factor = max(factors.values(), default=0.0)
+            result["projected_scale_factors"] = {k: round(v, 3) for k, v in factors.items()}
+
+            cooldown_left = max(0.0, self.last_scale_time.get(app_name, 0) + policy.cooldown_seconds - time.time())
+            scale_out_threshold = policy.scale_out_threshold_pct / 100.0
+            scale_in_threshold = policy.scale_in_threshold_pct / 100.0
+            if max_factor > scale_out_threshold and replicas < policy.max_replicas:
+                target = min(max(math.ceil(replicas * max_factor), replicas + 1), policy.max_replicas)
+                return {**result, "would_counteract": True, "target_replicas": target,
+                        "after_seconds": round(max(cooldown_left, policy.evaluation_interval_seconds), 1),
+                        "reason": f"Scale out: projected max factor {max_factor:.2f} > {scale_out_threshold:.2f}"}
+            if max_factor < scale_in_threshold and replicas > policy.min_replicas:
+                # Scale-in waits for sustained low load and removes one replica at a time
+                waiting = MIN_SCALE_IN_STABLE_PERIODS * policy.evaluation_interval_seconds
+                return {**result, "would_counteract": True, "target_replicas": replicas - 1,
+                        "after_seconds": round(max(cooldown_left, waiting), 1),
+                        "reason": f"Scale in: projected max factor {max_factor:.2f} < {scale_in_threshold:.2f}"}
+            return {**result, "reason": "Projected metrics within thresholds"}
+
     def get_scaling_history(self, app_name: str, limit: int = 10) -> List[ScalingDecision]:
         """Get recent scaling decisions for an application (thread-safe)."""
         with self._lock:
-            decisions = list(self.scale_decisions[app_name])
+            decisions = list(self.scale_decisions.get(app_name, ()))
             return decisions[-limit:] if decisions else []
 
+    def forget(self, app_name: str):
+        """Drop everything kept in memory for an app except its policy."""
+        with self._lock:
+            for state in (self.metrics_history, self.scale_decisions, self.last_scale_factors,
+                          self.last_scale_time, self.scale_in_stable_periods, self.saturation):
+                state.pop(app_name, None)
+
+    def prune(self, app_names: Iterable[str]) -> List[str]:
+        """Evict the state of apps that are no longer registered. Returns the evicted apps."""
+        known = set(app_names)
+        with self._lock:
+            tracked = (set(self.metrics_history) | set(self.scale_decisions) | set(self.last_scale_factors)
+                       | set(self.last_scale_time) | set(self.scale_in_stable_periods) | set(self.saturation))
+            evicted = sorted(tracked - known)
+            for app_name in evicted:
+                self.forget(app_name)
+            self.evicted_apps += len(evicted)
+        if evicted:
+            logger.info(f"Evicted autoscaler state of deleted apps: {', '.join(evicted)}")
+        return evicted
+
+    def state_footprint(self) -> Dict[str, Any]:
+        """Entries and approximate bytes of what the autoscaler keeps in memory, by structure."""
+        with self._lock:
+            points = sum(len(series) for history in self.metrics_history.values() for series in history.values())
+            series_count = sum(len(history) for history in self.metrics_history.values())
+            decisions = sum(len(recent) for recent in self.scale_decisions.values())
+            # Every decision is about the same size, so the latest of each app stands in for the rest
+            decision_bytes = sum(_deep_size(recent[-1]) * len(recent) for recent in self.scale_decisions.values() if recent)
+            factor_bytes = sum(_deep_size(factors) for factors in self.last_scale_factors.values())
+            return {
+                "apps": len(set(self.metrics_history) | set(self.scale_decisions) | set(self.last_scale_factors)),
+                "evicted_apps": self.evicted_apps,
+                "metrics_history": {
+                    "series": series_count,
+                    "points": points,
+                    "max_points_per_series": METRICS_HISTORY_MAX_POINTS,
+                    "estimated_bytes": points * _POINT_BYTES + series_count * sys.getsizeof(deque())
+                },
+                "scale_decisions": {
+                    "entries": decisions,
+                    "max_per_app": SCALE_DECISIONS_MAX,
+                    "estimated_bytes": decision_bytes
+                },
+                "scale_factors": {
+                    "entries": len(self.last_scale_factors),
+                    "estimated_bytes": factor_bytes
+                }
+            }
+
     def get_metrics_summary(self, app_name: str) -> Dict[str, Any]:
         """Get a summary of recent metrics for an application (thread-safe)."""
         with self._lock:
@@ -529,6 +806,7 @@ class AutoScaler:
                 return {"error": "No recent metrics available"}
 
             scale_factors = self._calculate_scale_factors(recent_metrics, policy)
+            saturation = self.saturation.get(app_name)
 
             return {
                 "metrics": {
@@ -538,10 +816,19 @@ class AutoScaler:
                     "cpu_percent": round(recent_metrics.cpu_percent, 2),
                     "memory_percent": round(recent_metrics.memory_percent, 2),
                     "healthy_replicas": recent_metrics.healthy_replicas,
-                    "total_replicas": recent_metrics.total_replicas
+                    "total_replicas": recent_metrics.total_replicas,
+                    "external": {name: round(value, 3) for name, value in recent_metrics.external.items()}
                 },
                 "scale_factors": {k: round(v, 3) for k, v in scale_factors.items()},
                 "scale_in_stable_periods": self.scale_in_stable_periods.get(app_name, 0),
+                "saturation": {
+                    "requests": saturation.requests,
+                    "bad_gateway": saturation.bad_gateway,
+                    "gateway_timeout": saturation.gateway_timeout,
+                    "upstream_errors": saturation.upstream_errors,
+                    "error_rate_pct": round(saturation.error_rate * 100, 2),
+                    "sampled_at": saturation.timestamp
+                } if saturation else None,
                 "policy": {
                     "min_replicas": policy.min_replicas,
                     "max_replicas": policy.max_replicas,
@@ -551,6 +838,56 @@ class AutoScaler:
                     "scale_out_threshold_pct": policy.scale_out_threshold_pct,
                     "scale_in_threshold_pct": policy.scale_in_threshold_pct,
                     "window_seconds": policy.window_seconds,
-                    "cooldown_seconds": policy.cooldown_seconds
+                    "cooldown_seconds": policy.cooldown_seconds,
+                    "saturation_error_rate_pct": policy.saturation_error_rate_pct,
+                    "saturation_scale_factor": policy.saturation_scale_factor,
+                    "saturation_cooldown_seconds": policy.saturation_cooldown_seconds,
+                    "evaluation_interval_seconds": policy.evaluation_interval_seconds,
+                    "external_metrics": [
+                        {key: metric[key] for key in ("name", "source", "target", "targetPerReplica") if key in metric}
+                        for metric in policy.external_metrics
+                    ]
                 }
             }
+
+class EvaluationSchedule:
+    """Priority queue of when each app's metrics are next collected and evaluated.
+    Rescheduling leaves the old heap entry behind; entries that no longer match
+    an app's due time are skipped when popped."""
+
+    def __init__(self):
+        self._heap: List[tuple] = []
+        self._due: Dict[str, float] = {}
+
+    def sync(self, app_names: List[str], now: float):
+        """Schedule new apps right away and forget apps that are gone."""
+        for app_name in set(self._due) - set(app_names):
+            del self._due[app_name]
+        for app_name in app_names:
+            if app_name not in self._due:
+                self._schedule(app_name, now)
+
+    def _schedule(self, app_name: str, due: float):
+        self._due[app_name] = due
+        heapq.heappush(self._heap, (due, app_name))
+
+    def pop_due(self, now: float) -> List[str]:
+        """Apps whose evaluation is due, earliest first. Each must be rescheduled."""
+        due = []
+        while self._heap and self._heap[0][0] <= now:
+            when, app_name = heapq.heappop(self._heap)
+            if self._due.get(app_name) == when:
+                del self._due[app_name]
+                due.append(app_name)
+        return due
+
+    def reschedule(self, app_name: str, interval_seconds: float, now: float):
+        self._schedule(app_name, now + interval_seconds)
+
+    def next_due(self) -> Optional[float]:
+        while self._heap and self._due.get(self._heap[0][1]) != self._heap[0][0]:
+            heapq.heappop(self._heap)
+        return self._heap[0][0] if self._heap else None
+
+    def snapshot(self) -> Dict[str, float]:
+        return dict(self._due)
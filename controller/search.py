@@ -0,0 +1,51 @@
+"""
+Search across apps, containers and events.
+GET /search?q= answers questions like "which app owns container 3f9c2e1"
+or "what runs ghcr.io/acme/billing" in one query: it matches app names,
+images and labels, container ID prefixes and IPs, and the messages of recent
+events. Matching is a case-insensitive substring match, served by trigram
+indexes when the database has pg_trgm.
+"""
+
+import time
+from typing import Any, Dict, List, Optional, Tuple
+
+KINDS = ("apps", "containers", "events")
+MIN_QUERY_LENGTH = 2
+MAX_QUERY_LENGTH = 200
+DEFAULT_LIMIT = 20
+MAX_LIMIT = 100
+# Events older than this are not searched unless the caller asks for more
+DEFAULT_EVENT_DAYS = 7
+MAX_EVENT_DAYS = 90
+
+def validate_query(q: Optional[str], kinds: Optional[str]) -> Tuple[Optional[Tuple[str, List[str]]], Optional[str]]:
+    """Check a search query and comma-separated kinds. Returns ((query, kinds), error)."""
+    query = (q or "").strip()
+    if not MIN_QUERY_LENGTH <= len(query) <= MAX_QUERY_LENGTH:
+        return None, f"q must be {MIN_QUERY_LENGTH} to {MAX_QUERY_LENGTH} characters"
+    parsed = [kind.strip() for kind in (kinds or "").split(",") if kind.strip()] or list(KINDS)
+    unknown = [kind for kind in parsed if kind not in KINDS]
+    if unknown:
+        return None, f"Unknown kind {', '.join(unknown)}, use {', '.join(KINDS)}"
+    return (query, parsed), None
+
+def search(state_store: Any, query: str, kinds: List[str], limit: int = DEFAULT_LIMIT,
+           event_days: int = DEFAULT_EVENT_DAYS) -> Dict[str, Any]:
+    """Run a validated query. Containers also report the app's namespace, so the result says
+    who owns them without a second lookup."""
+    results = state_store.search(query, kinds, limit, events_since=time.time() - event_days * 86400)
+    if results.get("containers"):
+        namespaces = {}
+        for container in results["containers"]:
+            app_name = container["app_name"]
+            if app_name not in namespaces:
+                record = state_store.get_app(app_name)
+                namespaces[app_name] = record.namespace if record else None
+            container["namespace"] = namespaces[app_name]
+    return {
+        "query": query,
+        **results,
+        "count": sum(len(items) for items in results.values()),
+        "indexed": bool(getattr(state_store, "trigram_indexes", False))
+    }
@@ -0,0 +1,73 @@
+"""
+Secrets store for Orchestry.
+Values are encrypted with ORCHESTRY_SECRET_KEY (a Fernet key) before they are
+written to the database and are only decrypted inside the controller. The API
+never returns secret values.
+"""
+
+import os
+import re
+import logging
+from typing import Any, Dict, List, Optional
+from cryptography.fernet import Fernet, InvalidToken
+
+logger = logging.getLogger(__name__)
+
+_VALID_SECRET_NAME = re.compile(r"^[a-zA-Z0-9]([a-zA-Z0-9._-]{0,251}[a-zA-Z0-9])?$")
+
+class SecretStore:
+    """Encrypts, stores and resolves named secrets."""
+
+    def __init__(self, state_store: Any):
+        self.state_store = state_store
+        key = os.getenv("ORCHESTRY_SECRET_KEY")
+        self._fernet: Optional[Fernet] = None
+        if key:
+            try:
+                self._fernet = Fernet(key.encode())
+            except ValueError:
+                logger.error("ORCHESTRY_SECRET_KEY is not a valid Fernet key; secrets are disabled")
+        else:
+            logger.info("ORCHESTRY_SECRET_KEY not set; secrets are disabled")
+
+    @property
+    def enabled(self) -> bool:
+        return self._fernet is not None
+
+    def put(self, name: str, value: str) -> Dict[str, Any]:
+        if not self.enabled:
+            return {"error": "Secrets are disabled: ORCHESTRY_SECRET_KEY is not set"}
+        if not _VALID_SECRET_NAME.match(name):
+            return {"error": f"Invalid secret name: {name}"}
+
+        encrypted = self._fernet.encrypt(value.encode()).decode()
+        if not self.state_store.save_secret(name, encrypted):
+            return {"error": f"Failed to save secret {name}"}
+        logger.info(f"🔑 Stored secret {name}")
+        return {"status": "stored", "name": name}
+
+    def get(self, name: str) -> Optional[str]:
+        """Decrypt a secret for use inside the controller. Returns None if unavailable."""
+        if not self.enabled:
+            return None
+        encrypted = self.state_store.get_secret(name)
+        if encrypted is None:
+            return None
+        try:
+            return self._fernet.decrypt(encrypted.encode()).decode()
+        except InvalidToken:
+            logger.error(f"Secret {name} cannot be decrypted with the current ORCHESTRY_SECRET_KEY")
+            return None
+
+    def list(self) -> List[Dict[str, Any]]:
+        return self.state_store.list_secrets()
+
+    def describe(self, name: str) -> Optional[Dict[str, Any]]:
+        """A secret's name and timestamps, or None if it does not exist."""
+        return next((item for item in self.list() if item["name"] == name), None)
+
+    def delete(self, name: str) -> Dict[str, Any]:
+        if not self.state_store.delete_secret(name):
+            return {"error": f"Secret {name} not found"}
+        logger.info(f"🔑 Deleted secret {name}")
+        return {"status": "deleted", "name": name}
@@ -0,0 +1,181 @@
+"""
+Container security options for Orchestry apps.
+An app's `security` block can make the root filesystem read-only, set
+no-new-privileges, drop or add Linux capabilities, run as a given user/group
+and pick a seccomp profile. A namespace policy can require these settings for
+every app in the namespace; `enforce_policy` fills in what the policy mandates
+and rejects apps that explicitly contradict it.
+"""
+
+import os
+import re
+import json
+from typing import Any, Dict, List, Optional, Tuple
+
+SECCOMP_PROFILE_DIR = os.getenv("ORCHESTRY_SECCOMP_PROFILE_DIR", "/etc/orchestry/seccomp")
+CAPABILITIES = (
+    "AUDIT_CONTROL", "AUDIT_READ", "AUDIT_WRITE", "BLOCK_SUSPEND", "BPF", "CHECKPOINT_RESTORE",
+    "CHOWN", "DAC_OVERRIDE", "DAC_READ_SEARCH", "FOWNER", "FSETID", "IPC_LOCK", "IPC_OWNER",
+    "KILL", "LEASE", "LINUX_IMMUTABLE", "MAC_ADMIN", "MAC_OVERRIDE", "MKNOD", "NET_ADMIN",
+    "NET_BIND_SERVICE", "NET_BROADCAST", "NET_RAW", "PERFMON", "SETFCAP", "SETGID", "SETPCAP",
+    "SETUID", "SYS_ADMIN", "SYS_BOOT", "SYS_CHROOT", "SYS_MODULE", "SYS_NICE", "SYS_PACCT",
+    "SYS_PTRACE", "SYS_RAWIO", "SYS_RESOURCE", "SYS_TIME", "SYS_TTY_CONFIG", "SYSLOG", "WAKE_ALARM"
+)
+_USER_PATTERN = re.compile(r"^[a-zA-Z0-9_][a-zA-Z0-9_.-]{0,31}(:[a-zA-Z0-9_][a-zA-Z0-9_.-]{0,31})?$")
+_PROFILE_NAME = re.compile(r"^[a-zA-Z0-9][a-zA-Z0-9_.-]*$")
+
+POLICY_FIELDS = (
+    "requireReadOnlyRootFilesystem", "requireNoNewPrivileges", "requireNonRoot",
+    "requireSeccomp", "requiredCapDrop", "allowedCapAdd"
+)
+
+def _capabilities(values: Any, field: str) -> Tuple[List[str], Optional[str]]:
+    if values is None:
+        return [], None
+    if not isinstance(values, list):
+        return [], f"{field} must be a list of capabilities"
+    normalized = []
+    for value in values:
+        cap = str(value).strip().upper()
+        if cap.startswith("CAP_"):
+            cap = cap[4:]
+        if cap != "ALL" and cap not in CAPABILITIES:
+            return [], f"{field}: unknown capability '{value}'"
+        if cap not in normalized:
+            normalized.append(cap)
+    return normalized, None
+
+def _is_root(user: Optional[str]) -> bool:
+    if not user:
+        return True  # images run as root unless told otherwise
+    return user.split(":")[0] in ("0", "root")
+
+def validate_security(security: Optional[Dict[str, Any]]) -> Tuple[Dict[str, Any], Optional[str]]:
+    """Validate and normalize an app's `security` block. Returns (security, error)."""
+    if not security:
+        return {}, None
+    if not isinstance(security, dict):
+        return {}, "security must be a mapping"
+
+    normalized: Dict[str, Any] = {}
+    for flag in ("readOnlyRootFilesystem", "noNewPrivileges"):
+        if flag in security and security[flag] is not None:
+            if not isinstance(security[flag], bool):
+                return {}, f"security.{flag} must be true or false"
+            normalized[flag] = security[flag]
+
+    for field in ("capDrop", "capAdd"):
+        caps, error = _capabilities(security.get(field), f"security.{field}")
+        if error:
+            return {}, error
+        if caps:
+            normalized[field] = caps
+
+    if security.get("user") is not None:
+        user = str(security["user"]).strip()
+        if not _USER_PATTERN.match(user):
+            return {}, "security.user must be a user or uid, optionally followed by :group or :gid"
+        normalized["user"] = user
+
+    profile = security.get("seccompProfile")
+    if profile:
+        if profile not in ("default", "unconfined"):
+            if not profile.startswith("localhost/") or not _PROFILE_NAME.match(profile[len("localhost/"):]):
+                return {}, "security.seccompProfile must be default, unconfined or localhost/<profile file name>"
+            path = os.path.join(SECCOMP_PROFILE_DIR, profile[len("localhost/"):])
+            try:
+                with open(path) as f:
+                    json.load(f)
+            except (OSError, ValueError) as e:
+                return {}, f"security.seccompProfile {profile} cannot be loaded from {path}: {e}"
+        normalized["seccompProfile"] = profile
+
+    return normalized, None
+
+def validate_policy(policy: Optional[Dict[str, Any]]) -> Tuple[Dict[str, Any], Optional[str]]:
+    """Validate a namespace security policy. Returns (policy, error)."""
+    if not policy:
+        return {}, None
+    if not isinstance(policy, dict):
+        return {}, "security policy must be a mapping"
+    unknown = set(policy) - set(POLICY_FIELDS)
+    if unknown:
+        return {}, f"unknown security policy fields: {', '.join(sorted(unknown))}"
+
+    normalized: Dict[str, Any] = {}
+    for flag in ("requireReadOnlyRootFilesystem", "requireNoNewPrivileges", "requireNonRoot", "requireSeccomp"):
+        if flag in policy:
+            if not isinstance(policy[flag], bool):
+                return {}, f"{flag} must be true or false"
+            normalized[flag] = policy[flag]
+    for field in ("requiredCapDrop", "allowedCapAdd"):
+        if field in policy:
+            caps, error = _capabilities(policy[field], field)
+            if error:
+                return {}, error
+            normalized[field] = caps
+    return normalized, None
+
+def enforce_policy(security: Dict[str, Any], policy: Dict[str, Any],
+                   namespace: str) -> Tuple[Dict[str, Any], Optional[str]]:
+    """Apply a namespace policy to an app's (validated) security block.
+    Settings the policy requires are filled in; explicit contradictions are errors."""
+    if not policy:
+        return security, None
+    effective = dict(security)
+    where = f"namespace {namespace} policy"
+
+    for flag, field in (("requireReadOnlyRootFilesystem", "readOnlyRootFilesystem"),
+                        ("requireNoNewPrivileges", "noNewPrivileges")):
+        if policy.get(flag):
+            if effective.get(field) is False:
+                return {}, f"{where} requires security.{field}: true"
+            effective[field] = True
+
+    if policy.get("requireNonRoot") and _is_root(effective.get("user")):
+        return {}, f"{where} requires security.user to be set to a non-root user"
+
+    if policy.get("requireSeccomp"):
+        if effective.get("seccompProfile") == "unconfined":
+            return {}, f"{where} does not allow security.seccompProfile: unconfined"
+
+    required_drop = policy.get("requiredCapDrop") or []
+    if required_drop:
+        cap_drop = list(effective.get("capDrop") or [])
+        for cap in required_drop:
+            if cap not in cap_drop and "ALL" not in cap_drop:
+                cap_drop.append(cap)
+        effective["capDrop"] = cap_drop
+
+    if "allowedCapAdd" in policy:
+        allowed = set(policy.get("allowedCapAdd") or [])
+        extra = [cap for cap in effective.get("capAdd") or [] if cap not in allowed and "ALL" not in allowed]
+        if extra:
+            return {}, f"{where} does not allow adding capabilities: {', '.join(extra)}"
+
+    return effective, None
+
+def apply(container_config: Dict[str, Any], security: Dict[str, Any]):
+    """Add an app's effective security settings to a containers.create() call."""
+    if not security:
+        return
+    security_opt = []
+    if security.get("readOnlyRootFilesystem"):
+        container_config["read_only"] = True
+    if security.get("noNewPrivileges"):
+        security_opt.append("no-new-privileges:true")
+    profile = security.get("seccompProfile")
+    if profile == "unconfined":
+        security_opt.append("seccomp=unconfined")
+    elif profile and profile.startswith("localhost/"):
+        # The Docker API takes the profile's JSON content, not a path
+        with open(os.path.join(SECCOMP_PROFILE_DIR, profile[len("localhost/"):])) as f:
+            security_opt.append(f"seccomp={json.dumps(json.load(f))}")
+    if security_opt:
+        container_config["security_opt"] = security_opt
+    if security.get("capDrop"):
+        container_config["cap_drop"] = list(security["capDrop"])
+    if security.get("capAdd"):
+        container_config["cap_add"] = list(security["capAdd"])
+    if security.get("user"):
+        container_config["user"] = security["user"]
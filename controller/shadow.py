@@ -0,0 +1,100 @@
+"""
+Shadow deployments.
+A shadow runs a candidate image next to an app and receives a copy of a share
+of its live traffic: nginx mirrors the chosen requests (split by request ID) to
+the candidate's replicas and discards their responses, so clients only ever
+see the app's own replicas. Mirrored requests are logged to a separate access
+log, and the candidate's error rate and latency are compared with the app's
+over the same period to judge the image before a real rollout.
+
+Shadow replicas carry the orchestry.shadow label instead of orchestry.app, so
+reconciliation, restarts and scaling never treat them as replicas of the app.
+They live as long as the leader that started them; a new leader removes them.
+"""
+
+import os
+import time
+from typing import Any, Dict, List, Optional
+
+SHADOW_LABEL = "orchestry.shadow"
+MAX_SHADOW_REPLICAS = 5
+# A verdict needs at least this many mirrored requests
+SHADOW_MIN_REQUESTS = int(os.getenv("ORCHESTRY_SHADOW_MIN_REQUESTS", "100"))
+# The candidate is worse if its error rate exceeds the app's by more than this many points...
+SHADOW_MAX_ERROR_RATE_INCREASE = float(os.getenv("ORCHESTRY_SHADOW_MAX_ERROR_RATE_INCREASE", "1.0"))
+# ...or its p95 latency exceeds the app's by more than this fraction
+SHADOW_MAX_LATENCY_INCREASE = float(os.getenv("ORCHESTRY_SHADOW_MAX_LATENCY_INCREASE", "0.2"))
+# Compare at most this much traffic, counted back from now
+MAX_COMPARISON_SECONDS = 86400
+
+def validate(app_spec: Dict[str, Any], percent: float, replicas: int) -> Optional[str]:
+    """Error message if an app cannot get a shadow with these settings, else None."""
+    if not 0 < percent <= 100:
+        return "percent must be greater than 0 and at most 100"
+    if not 1 <= replicas <= MAX_SHADOW_REPLICAS:
+        return f"replicas must be between 1 and {MAX_SHADOW_REPLICAS}"
+    if app_spec.get("type", "http") != "http":
+        return "only http apps can have a shadow: nginx can only mirror HTTP requests"
+    if app_spec.get("hostPort") or app_spec.get("publishRange"):
+        return "apps with hostPort or publishRange cannot have a shadow"
+    return None
+
+def new_shadow(app_name: str, revision: Optional[int], image: str, current_image: Optional[str],
+               percent: float, replicas: int, requested_by: Optional[str]) -> Dict[str, Any]:
+    """Record of a shadow deployment, as returned by GET /apps/{name}/shadow."""
+    return {
+        "app": app_name,
+        "revision": revision,  # the app revision the candidate is based on
+        "image": image,
+        "current_image": current_image,
+        "percent": percent,
+        "replicas": replicas,
+        "state": "starting",  # starting, mirroring, stopped, failed
+        "error": None,
+        "requested_by": requested_by,
+        "started_at": time.time(),
+        "mirroring_since": None,
+        "stopped_at": None,
+        "comparison": None  # the last comparison, kept once the shadow is stopped
+    }
+
+def nginx_context(app_name: str, percent: float, servers: List[Dict[str, Any]]) -> Dict[str, Any]:
+    """What the nginx template needs to mirror traffic to shadow replicas."""
+    return {
+        "percent": f"{percent:g}",
+        "servers": servers,
+        # nginx variable names cannot contain dashes
+        "variable": f"orchestry_shadow_{app_name.replace('-', '_')}"
+    }
+
+def _with_rate(stats: Dict[str, Any]) -> Dict[str, Any]:
+    requests = stats.get("requests") or 0
+    return {**stats, "error_rate": round(stats.get("errors", 0) / requests * 100, 2) if requests else None}
+
+def compare(primary: Optional[Dict[str, Any]], candidate: Optional[Dict[str, Any]]) -> Dict[str, Any]:
+    """Compare the app's and the shadow's response stats ({requests, errors, mean_ms, p95_ms}).
+    The verdict is ok, worse, insufficient_data or unavailable (logs could not be read)."""
+    if primary is None or candidate is None:
+        return {"primary": primary, "shadow": candidate, "verdict": "unavailable", "reasons": []}
+    primary, candidate = _with_rate(primary), _with_rate(candidate)
+    result = {"primary": primary, "shadow": candidate, "error_rate_delta": None, "p95_ratio": None, "reasons": []}
+    if candidate["requests"] < SHADOW_MIN_REQUESTS or not primary["requests"]:
+        result["verdict"] = "insufficient_data"
+        result["reasons"].append(f"{candidate['requests']} of the {SHADOW_MIN_REQUESTS} mirrored requests "
+                                 "needed for a verdict")
+        return result
+
+    result["error_rate_delta"] = round(candidate["error_rate"] - primary["error_rate"], 2)
+    if result["error_rate_delta"] > SHADOW_MAX_ERROR_RATE_INCREASE:
+        result["reasons"].append(f"error rate {candidate['error_rate']}% vs {primary['error_rate']}%")
+    if primary.get("p95_ms") and candidate.get("p95_ms") is not None:
+        result["p95_ratio"] = round(candidate["p95_ms"] / primary["p95_ms"], 2)
+        if result["p95_ratio"] > 1 + SHADOW_MAX_LATENCY_INCREASE:
+            result["reasons"].append(f"p95 latency {candidate['p95_ms']:.0f}ms vs {primary['p95_ms']:.0f}ms")
+    result["verdict"] = "worse" if result["reasons"] else "ok"
+    return result
+
+def comparison_window(record: Dict[str, Any]) -> int:
+    """Seconds of traffic to compare: since mirroring began, up to MAX_COMPARISON_SECONDS."""
+    since = record.get("mirroring_since") or record["started_at"]
+    return max(1, min(int(time.time() - since), MAX_COMPARISON_SECONDS))
@@ -0,0 +1,203 @@
+"""
+Simulated cluster mode for local development.
+`python -m controller.main --simulate-nodes 3` (or ORCHESTRY_SIMULATED_NODES=3)
+runs three cluster nodes in one controller process, each with its own node
+ID, listening on ORCHESTRY_PORT, ORCHESTRY_PORT+1 and so on, and all sharing
+the one local database. The nodes elect a leader, renew leases and fail over
+exactly like separate controllers do. A request is served as the node that
+owns the port it came in on, so writes sent to a follower's port get the
+same NOT_LEADER error a real follower returns.
+
+There is only one app manager, autoscaler and health checker in the process.
+They act while any simulated node holds leadership; the leadership callbacks
+fire when the process as a whole gains or loses it. Nodes are stopped,
+crashed (threads halted without releasing the lease, as if the process died)
+and started again through /cluster/simulation, to exercise failover without
+running several controllers. Not for production.
+"""
+
+import os
+import logging
+import threading
+from contextvars import ContextVar
+from typing import Any, Callable, Dict, List, Optional
+
+from .cluster import DistributedController, NodeState
+
+logger = logging.getLogger(__name__)
+
+SIMULATED_NODES = int(os.getenv("ORCHESTRY_SIMULATED_NODES", "0"))
+MAX_SIMULATED_NODES = 9
+NODE_HEADER = "X-Orchestry-Node"
+# Shorter than a real cluster's so failover takes seconds on a laptop
+SIMULATED_LEASE_TTL_SECONDS = int(os.getenv("ORCHESTRY_SIMULATED_LEASE_TTL_SECONDS", "10"))
+SIMULATED_HEARTBEAT_SECONDS = 3
+SIMULATED_ELECTION_TIMEOUT_SECONDS = 5
+ACTIONS = ("start", "stop", "crash")
+
+_bound_node: ContextVar[Optional[DistributedController]] = ContextVar("orchestry_simulated_node", default=None)
+
+def enabled() -> bool:
+    return SIMULATED_NODES > 1
+
+def validate_size(size: int) -> Optional[str]:
+    if not 2 <= size <= MAX_SIMULATED_NODES:
+        return f"A simulated cluster has 2 to {MAX_SIMULATED_NODES} nodes"
+    return None
+
+def bind(node: Optional[DistributedController]):
+    """Serve the current request as node. Returns a token for reset()."""
+    return _bound_node.set(node)
+
+def reset(token):
+    _bound_node.reset(token)
+
+class SimulatedCluster:
+    """Several DistributedController nodes in one process, used where the controller expects
+    its single node. Attributes it does not define are read from the node the current request
+    is bound to, or outside requests from the leading node (the first running node if none leads)."""
+
+    def __init__(self, size: int, hostname: str, base_port: int, db_manager: Any,
+                 node_id_prefix: Optional[str] = None):
+        error = validate_size(size)
+        if error:
+            raise ValueError(error)
+        prefix = node_id_prefix or "sim"
+        self.nodes: List[DistributedController] = []
+        for index in range(size):
+            node = DistributedController(
+                node_id=f"{prefix}-{index + 1}",
+                hostname=hostname,
+                port=base_port + index,
+                db_manager=db_manager,
+                lease_ttl=SIMULATED_LEASE_TTL_SECONDS,
+                heartbeat_interval=SIMULATED_HEARTBEAT_SECONDS,
+                election_timeout=SIMULATED_ELECTION_TIMEOUT_SECONDS
+            )
+            # Clients are sent to the leader's own port rather than a load balancer
+            node.advertise_url = node.api_url
+            node.on_become_leader = lambda node=node: self._node_became_leader(node)
+            node.on_lose_leadership = lambda node=node: self._node_lost_leadership(node)
+            node.on_cluster_change = lambda nodes, node=node: self._node_saw_change(node, nodes)
+            self.nodes.append(node)
+
+        self.on_become_leader: Optional[Callable] = None
+        self.on_lose_leadership: Optional[Callable] = None
+        self.on_cluster_change: Optional[Callable] = None
+        # The node whose leadership the process is acting on
+        self._process_leader: Optional[str] = None
+        self._lock = threading.RLock()
+        logger.warning(f"🧪 Simulated cluster mode: {size} nodes on ports {base_port}-{base_port + size - 1}, "
+                       f"not for production")
+
+    def __getattr__(self, name: str):
+        # Only called for attributes not defined above, e.g. node_id or get_cluster_status
+        if name.startswith("_") or name == "nodes":
+            raise AttributeError(name)
+        return getattr(self.current(), name)
+
+    @property
+    def is_leader(self) -> bool:
+        node = _bound_node.get()
+        if node is not None:
+            return node.is_leader
+        return any(node.is_leader for node in self.nodes)
+
+    def current(self) -> DistributedController:
+        node = _bound_node.get()
+        if node is not None:
+            return node
+        running = [node for node in self.nodes if node._running]
+        return next((node for node in running if node.is_leader), None) or (running or self.nodes)[0]
+
+    def node_for_port(self, port: Optional[int]) -> Optional[DistributedController]:
+        return next((node for node in self.nodes if node.port == port), None)
+
+    def get_node(self, node_id: str) -> Optional[DistributedController]:
+        return next((node for node in self.nodes if node.node_id == node_id), None)
+
+    def start(self):
+        for node in self.nodes:
+            node.start()
+
+    def stop(self):
+        for node in self.nodes:
+            node.stop()
+
+    def _node_became_leader(self, node: DistributedController):
+        with self._lock:
+            if self._process_leader is not None:
+                logger.warning(f"🧪 {node.node_id} became leader while {self._process_leader} still leads")
+                return
+            self._process_leader = node.node_id
+        logger.info(f"🧪 Simulated node {node.node_id} leads; the process takes control of operations")
+        if self.on_become_leader:
+            self.on_become_leader()
+
+    def _node_lost_leadership(self, node: DistributedController):
+        with self._lock:
+            if self._process_leader != node.node_id:
+                return
+            self._process_leader = None
+        logger.info(f"🧪 Simulated node {node.node_id} lost leadership; the process steps down")
+        if self.on_lose_leadership:
+            self.on_lose_leadership()
+
+    def _node_saw_change(self, node: DistributedController, nodes: Dict[str, Any]):
+        # Every node sees the same membership; report it once
+        if node is self.current() and self.on_cluster_change:
+            self.on_cluster_change(nodes)
+
+    def _threads_alive(self, node: DistributedController) -> bool:
+        return any(task is not None and task.is_alive()
+                   for task in (node._heartbeat_task, node._election_task, node._monitoring_task))
+
+    def crash(self, node: DistributedController):
+        """Halt a node as if its process died: its threads stop, but its lease and membership
+        row stay until they expire."""
+        node._running = False
+        with node._lock:
+            was_leader = node.is_leader
+            node.state = NodeState.STOPPED
+            node.is_leader = False
+            node.leader_id = None
+        if was_leader:
+            self._node_lost_leadership(node)
+
+    def act(self, node: DistributedController, action: str) -> Dict[str, Any]:
+        """Start, stop or crash a simulated node. Returns {"error": ...} if the node is not in a
+        state the action applies to."""
+        node_id = node.node_id
+
+        if action == "start":
+            if node._running:
+                return {"error": f"Simulated node {node_id} is already running"}
+            if self._threads_alive(node):
+                return {"error": f"Simulated node {node_id} is still shutting down, try again in a few seconds"}
+            node.state = NodeState.FOLLOWER
+            node.start()
+        elif not node._running:
+            return {"error": f"Simulated node {node_id} is not running"}
+        elif action == "stop":
+            node.stop()
+        else:
+            self.crash(node)
+
+        logger.warning(f"🧪 Simulated node {node_id}: {action}")
+        return {"node": node_id, "action": action, **self.describe()}
+
+    def describe(self) -> Dict[str, Any]:
+        return {
+            "enabled": True,
+            "process_leader": self._process_leader,
+            "lease_ttl_seconds": SIMULATED_LEASE_TTL_SECONDS,
+            "nodes": [{
+                "node_id": node.node_id,
+                "port": node.port,
+                "api_url": node.api_url,
+                "running": node._running,
+                "state": node.state.value,
+                "is_leader": node.is_leader,
+                "term": node.current_term
+            } for node in self.nodes]
+        }
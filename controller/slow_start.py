@@ -0,0 +1,48 @@
+"""
+Slow start.
+With `slowStart.durationSeconds`, a replica that joins nginx (by scaling out,
+a rollout, a restart or recovering from failing health checks) starts at a
+low upstream weight, which grows with every container monitoring pass (10s)
+until it reaches full weight at the end of the warm-up. Replicas with cold
+JIT compilers or caches then see traffic ramp up instead of getting their
+full share at once. Ramping only happens while the app has warmed-up
+replicas to take the rest of its traffic; when an app starts, its replicas
+get full weight right away.
+"""
+
+import math
+from typing import Any, Dict, Optional, Tuple
+
+from .latency_weights import MAX_WEIGHT
+
+MIN_DURATION_SECONDS = 10
+MAX_DURATION_SECONDS = 3600
+
+def validate_slow_start(config: Any, app_spec: Dict[str, Any]) -> Tuple[Optional[Dict[str, Any]], Optional[str]]:
+    """Normalize `slowStart`. Returns (config to store or None, error)."""
+    if config is None:
+        return None, None
+    if isinstance(config, int) and not isinstance(config, bool):
+        config = {"durationSeconds": config}
+    if not isinstance(config, dict):
+        return None, "slowStart must be a number of seconds or an object with durationSeconds"
+    if not config.get("enabled", True):
+        return None, None
+    if app_spec.get("type") != "http":
+        return None, "slowStart is only supported for http apps"
+    duration = config.get("durationSeconds")
+    if not isinstance(duration, int) or isinstance(duration, bool) \
+            or not MIN_DURATION_SECONDS <= duration <= MAX_DURATION_SECONDS:
+        return None, f"slowStart.durationSeconds must be between {MIN_DURATION_SECONDS} and {MAX_DURATION_SECONDS}"
+    return {"durationSeconds": duration}, None
+
+def slow_start_config(app_spec: Dict[str, Any]) -> Optional[Dict[str, Any]]:
+    return app_spec.get("slowStart")
+
+def warming_up(config: Dict[str, Any], ready_since: float, now: float) -> bool:
+    return now - ready_since < config["durationSeconds"]
+
+def ramp_weight(config: Dict[str, Any], ready_since: float, now: float, weight: int = MAX_WEIGHT) -> int:
+    """The share of weight a replica that became ready at ready_since gets now, at least 1."""
+    fraction = min(1.0, max(0.0, now - ready_since) / config["durationSeconds"])
+    return max(1, math.floor(weight * fraction))
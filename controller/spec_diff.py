@@ -0,0 +1,132 @@
+"""
+Structural diffs between app specs.
+`orchestry diff spec.yaml` sends a local spec to POST /apps/{name}/diff, which
+compares it with the app's latest (or a given) revision. Both specs are
+normalized first, so formatting differences do not show up as changes: YAML
+vs JSON, key order, fields left out vs set to null, healthCheck under spec or
+at the root, env order, "0.5" vs "500m" CPUs and "1Gi" vs "1024Mi" memory.
+"""
+
+import re
+from typing import Any, Dict, List
+
+# Changes are reported in this order; paths outside these sections are "other"
+SECTIONS = (
+    ("image", ("spec.image", "spec.platform")),
+    ("env", ("spec.env",)),
+    ("resources", ("spec.resources",)),
+    ("scaling", ("scaling",)),
+)
+OTHER_SECTION = "other"
+
+MEMORY_UNITS = {"": 1, "k": 1000, "m": 1000 ** 2, "g": 1000 ** 3,
+                "ki": 1024, "mi": 1024 ** 2, "gi": 1024 ** 3, "ti": 1024 ** 4}
+_MEMORY = re.compile(r"^(\d+(?:\.\d+)?)\s*([kmgt]i?)?b?$", re.IGNORECASE)
+_CPU = re.compile(r"^(\d+(?:\.\d+)?)(m)?$")
+
+def _cpu(value: Any) -> Any:
+    """CPUs as millicores, e.g. "500m" for 0.5 or "0.5"."""
+    match = _CPU.match(str(value).strip())
+    if not match:
+        return value
+    millis = float(match.group(1)) * (1 if match.group(2) else 1000)
+    return f"{int(millis)}m" if millis == int(millis) else value
+
+def _memory(value: Any) -> Any:
+    """Memory in the largest binary unit it is a whole number of, e.g. "1Gi" for "1024Mi"."""
+    match = _MEMORY.match(str(value).strip())
+    if not match:
+        return value
+    size = float(match.group(1)) * MEMORY_UNITS[(match.group(2) or "").lower()]
+    if size != int(size):
+        return value
+    size = int(size)
+    for unit in ("Ti", "Gi", "Mi", "Ki"):
+        factor = MEMORY_UNITS[unit.lower()]
+        if size and size % factor == 0:
+            return f"{size // factor}{unit}"
+    return str(size)
+
+def _scalar(value: Any) -> Any:
+    # 2.0 and 2 are the same replica count, threshold or port
+    if isinstance(value, float) and value.is_integer():
+        return int(value)
+    return value
+
+def _clean(value: Any) -> Any:
+    """Drop nulls and empty containers, recursively."""
+    if isinstance(value, dict):
+        cleaned = {key: _clean(item) for key, item in value.items()}
+        return {key: item for key, item in cleaned.items() if item not in (None, {}, [])}
+    if isinstance(value, list):
+        return [_clean(item) for item in value]
+    return _scalar(value)
+
+def normalize(spec: Dict[str, Any]) -> Dict[str, Any]:
+    """A registered or local spec in the canonical form the diff compares."""
+    spec = _clean(spec or {})
+    spec.setdefault("apiVersion", "v1")
+    spec.setdefault("kind", "App")
+    app_spec = spec.setdefault("spec", {})
+
+    # healthCheck may sit under spec (and be called health there) or at the root
+    for key in ("healthCheck", "health"):
+        if key in app_spec:
+            spec.setdefault("healthCheck", app_spec.pop(key))
+
+    env = app_spec.get("env")
+    if isinstance(env, list):
+        app_spec["env"] = {
+            entry["name"]: entry.get("value", "") if set(entry) <= {"name", "value"} else
+            {key: item for key, item in entry.items() if key != "name"}
+            for entry in env if isinstance(entry, dict) and entry.get("name")
+        }
+        if not app_spec["env"]:
+            app_spec.pop("env")
+
+    resources = app_spec.get("resources")
+    if isinstance(resources, dict):
+        if "cpu" in resources:
+            resources["cpu"] = _cpu(resources["cpu"])
+        if "memory" in resources:
+            resources["memory"] = _memory(resources["memory"])
+
+    for port in app_spec.get("ports") or []:
+        if isinstance(port, dict) and isinstance(port.get("protocol"), str):
+            port["protocol"] = port["protocol"].upper()
+
+    if isinstance(app_spec.get("command"), str):
+        app_spec["command"] = app_spec["command"].split()
+    if not app_spec:
+        spec.pop("spec")
+    return spec
+
+def section(path: str) -> str:
+    """The section of the diff a changed path belongs to."""
+    for name, prefixes in SECTIONS:
+        if any(path == prefix or path.startswith(prefix + ".") for prefix in prefixes):
+            return name
+    return OTHER_SECTION
+
+def _walk(old: Any, new: Any, path: str, changes: List[Dict[str, Any]]):
+    if isinstance(old, dict) and isinstance(new, dict):
+        for key in sorted(set(old) | set(new), key=str):
+            child = f"{path}.{key}" if path else str(key)
+            if key not in new:
+                changes.append({"path": child, "op": "removed", "old": old[key]})
+            elif key not in old:
+                changes.append({"path": child, "op": "added", "new": new[key]})
+            else:
+                _walk(old[key], new[key], child, changes)
+    elif old != new:
+        changes.append({"path": path, "op": "changed", "old": old, "new": new})
+
+def diff(deployed: Dict[str, Any], local: Dict[str, Any]) -> List[Dict[str, Any]]:
+    """Changes that registering local would make to deployed, as {"path", "section", "op",
+    "old", "new"} (op is added, removed or changed), grouped by section."""
+    changes: List[Dict[str, Any]] = []
+    _walk(normalize(deployed), normalize(local), "", changes)
+    order = [name for name, _ in SECTIONS] + [OTHER_SECTION]
+    for change in changes:
+        change["section"] = section(change["path"])
+    return sorted(changes, key=lambda change: order.index(change["section"]))
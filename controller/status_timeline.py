@@ -0,0 +1,64 @@
+"""
+App status timeline.
+Every change of an app's status is recorded with when it happened and why, so
+a post-incident review can reconstruct when an app degraded and what brought
+it back. Operations record the statuses they set (registered, running,
+stopped, archived, deleted). A running app is degraded while any of its
+replicas fails health checks or has exited, or while none is ready and none
+is still starting; the container monitoring loop records those transitions.
+GET /apps/{name}/timeline returns the transitions, oldest first.
+"""
+
+import threading
+import time
+from typing import Any, Dict, List, Optional, Tuple
+
+DEFAULT_LIMIT = 100
+MAX_LIMIT = 1000
+# Replica states that make a running app degraded
+FAILING_STATES = ("unhealthy", "down")
+
+def _state(instance: Any) -> str:
+    return getattr(instance.state, "value", instance.state)
+
+def observe(instances: List[Any]) -> Tuple[str, str]:
+    """running or degraded from a running app's tracked replicas, and the cause."""
+    ready = [inst for inst in instances if _state(inst) == "ready"]
+    starting = [inst for inst in instances if _state(inst) == "starting"]
+    failing = [inst for inst in instances if _state(inst) in FAILING_STATES]
+    if failing:
+        reasons = "; ".join(f"replica {inst.container_id[:12]} {_state(inst)}"
+                            + (f": {inst.state_reason}" if getattr(inst, "state_reason", "") else "")
+                            for inst in failing)
+        return "degraded", f"{len(ready)} of {len(instances)} replicas ready; {reasons}"
+    if not ready and not starting:
+        return "degraded", "no replicas ready"
+    return "running", f"{len(ready)} of {len(instances)} replicas ready"
+
+class StatusTimeline:
+    """Writes a transition whenever an app's status differs from the last one recorded."""
+
+    def __init__(self, state_store: Any):
+        self.state_store = state_store
+        self._lock = threading.Lock()
+
+    def record(self, app_name: str, status: str, cause: str,
+               details: Optional[Dict[str, Any]] = None) -> bool:
+        """Record that app_name moved to status because of cause. Returns False if that
+        is already its latest status."""
+        with self._lock:
+            previous = self.state_store.get_last_status(app_name)
+            if previous == status:
+                return False
+            return self.state_store.add_status_transition(app_name, previous, status, cause, details) is not None
+
+    def history(self, app_name: str, since: Optional[float] = None, limit: int = DEFAULT_LIMIT,
+                now: Optional[float] = None) -> List[Dict[str, Any]]:
+        """Transitions oldest first, each with how long the app stayed in that status
+        (up to now for the latest one)."""
+        transitions = self.state_store.get_status_history(app_name, since=since, limit=max(1, min(limit, MAX_LIMIT)))
+        now = time.time() if now is None else now
+        for transition, following in zip(transitions, transitions[1:] + [None]):
+            until = following["timestamp"] if following else now
+            transition["duration_seconds"] = round(until - transition["timestamp"], 1)
+        return transitions
@@ -0,0 +1,33 @@
+"""
+Graceful termination.
+Stopping a replica sends it SIGTERM (or the image's STOPSIGNAL) and waits up to
+the app's terminationGracePeriodSeconds for it to exit; only then is it killed
+with SIGKILL. nginx stops sending the replica new requests first, so apps can
+use the window to finish in-flight requests and drain sessions. Stop, delete,
+scale, deploy and env requests can override the period for that operation.
+"""
+
+import os
+from typing import Any, Dict, Optional
+
+DEFAULT_GRACE_PERIOD_SECONDS = int(os.getenv("ORCHESTRY_TERMINATION_GRACE_SECONDS", "30"))
+MAX_GRACE_PERIOD_SECONDS = 3600
+
+def validate_grace_period(value: Any) -> Optional[str]:
+    """Error message if value is not a usable terminationGracePeriodSeconds, else None."""
+    if value is None:
+        return None
+    if not isinstance(value, int) or isinstance(value, bool) or not 0 <= value <= MAX_GRACE_PERIOD_SECONDS:
+        return f"terminationGracePeriodSeconds must be between 0 and {MAX_GRACE_PERIOD_SECONDS}"
+    return None
+
+def grace_period(app_spec: Optional[Dict[str, Any]], override: Optional[int] = None) -> int:
+    """Seconds a replica of the app gets to exit after SIGTERM; override is set per operation."""
+    if override is not None:
+        return override
+    value = (app_spec or {}).get("terminationGracePeriodSeconds")
+    return DEFAULT_GRACE_PERIOD_SECONDS if value is None else value
+
+def apply(container_config: Dict[str, Any], app_spec: Dict[str, Any]):
+    """Set the container's own stop timeout, so stops outside the controller honor the period too."""
+    container_config["stop_timeout"] = grace_period(app_spec)
@@ -0,0 +1,62 @@
+"""
+Self-service env toggles.
+An app's `toggles` allow-list the env variables, such as LOG_LEVEL or feature
+flags, that POST /apps/{name}/toggles may change, optionally restricted to a
+set of values. That endpoint cannot touch anything else in the spec, so
+operators can flip safe toggles without being able to register specs or
+change other env (API quotas can allow the `toggles` action while denying
+`register` and `env`). A change is applied like an env change: a running
+app's replicas are restarted one at a time.
+"""
+
+from typing import Any, Dict, List, Optional, Tuple
+
+from .rollout import ENV_NAME_PATTERN
+
+def validate_toggles(config: Any, env: Optional[List[Dict[str, Any]]] = None) -> Tuple[Optional[List[Dict[str, Any]]], Optional[str]]:
+    """Normalize `toggles` to [{"name", "values"?}]. Returns (toggles or None, error)."""
+    if not config:
+        return None, None
+    if not isinstance(config, list):
+        return None, "toggles must be a list of env variable names or {name, values} mappings"
+    secret_names = {entry.get("name") for entry in env or [] if isinstance(entry, dict) and entry.get("valueFrom")}
+    toggles = []
+    for entry in config:
+        if isinstance(entry, str):
+            entry = {"name": entry}
+        if not isinstance(entry, dict):
+            return None, "toggles entries must be env variable names or {name, values} mappings"
+        name = entry.get("name")
+        if not isinstance(name, str) or not ENV_NAME_PATTERN.match(name):
+            return None, f"toggle {name!r} is not a valid environment variable name"
+        if any(toggle["name"] == name for toggle in toggles):
+            return None, f"toggle {name} is listed more than once"
+        if name in secret_names:
+            return None, f"toggle {name} is set with valueFrom and cannot be changed as a toggle"
+        toggle = {"name": name}
+        values = entry.get("values")
+        if values is not None:
+            if not isinstance(values, list) or not values:
+                return None, f"toggle {name} values must be a non-empty list"
+            # YAML reads true/false and numbers as such; env values are strings
+            toggle["values"] = [str(value).lower() if isinstance(value, bool) else str(value) for value in values]
+        toggles.append(toggle)
+    return toggles, None
+
+def check_changes(toggles: Optional[List[Dict[str, Any]]], values: Dict[str, str], unset: List[str]) -> Optional[str]:
+    """Error message if a change touches a variable that is not a toggle or sets a value
+    the toggle does not allow, else None."""
+    if not toggles:
+        return "the app defines no toggles"
+    allowed = {toggle["name"]: toggle.get("values") for toggle in toggles}
+    for name in list(values) + list(unset):
+        if name not in allowed:
+            return f"{name} is not a toggle of this app (toggles: {', '.join(sorted(allowed))})"
+    for name, value in values.items():
+        if allowed[name] is not None and value not in allowed[name]:
+            return f"{value!r} is not an allowed value of {name} ({', '.join(allowed[name])})"
+    return None
+
+def current_values(toggles: Optional[List[Dict[str, Any]]], env: Dict[str, Optional[str]]) -> List[Dict[str, Any]]:
+    """Each toggle with the value it has in env, or None if it is not set."""
+    return [dict(toggle, value=env.get(toggle["name"])) for toggle in toggles or []]
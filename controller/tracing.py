@@ -0,0 +1,45 @@
+"""
+Request correlation for the controller.
+Every API request carries an X-Request-ID (taken from the caller or nginx, or
+generated here). The ID is kept in a context variable so log records written
+while handling the request can include it.
+"""
+
+import re
+import uuid
+import logging
+from contextvars import ContextVar
+
+REQUEST_ID_HEADER = "X-Request-ID"
+
+# Accept caller supplied IDs only when they are short and log-safe
+_VALID_REQUEST_ID = re.compile(r"^[A-Za-z0-9._:-]{1,128}$")
+
+_request_id: ContextVar[str] = ContextVar("orchestry_request_id", default="-")
+
+def new_request_id() -> str:
+    return uuid.uuid4().hex
+
+def resolve_request_id(incoming: str = None) -> str:
+    """Reuse a well-formed incoming ID, otherwise generate a new one."""
+    if incoming and _VALID_REQUEST_ID.match(incoming):
+        return incoming
+    return new_request_id()
+
+def set_request_id(request_id: str):
+    """Bind request_id to the current context; returns a token for reset_request_id."""
+    return _request_id.set(request_id)
+
+def reset_request_id(token):
+    _request_id.reset(token)
+
+def get_request_id() -> str:
+    return _request_id.get()
+
+class RequestIdFilter(logging.Filter):
+    """Adds the current request ID to log records as %(request_id)s."""
+
+    def filter(self, record: logging.LogRecord) -> bool:
+        if not hasattr(record, "request_id"):
+            record.request_id = _request_id.get()
+        return True
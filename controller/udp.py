@@ -0,0 +1,121 @@
+"""
+UDP apps (game servers, DNS, syslog, ...).
+UDP apps are load balanced by nginx stream blocks instead of HTTP server
+blocks. Each app gets its own UDP listen port on the nginx container, either
+a fixed `udp.listenPort` or one picked from ORCHESTRY_UDP_PORT_RANGE, which
+must be published on the nginx container. Listen ports are kept in the
+host_ports table under the nginx host, so an app keeps its port across
+restarts and failovers.
+"""
+
+import os
+import logging
+from typing import Any, Dict, List, Optional, Tuple
+
+from .ports import PORT_RANGE_PATTERN
+
+logger = logging.getLogger(__name__)
+
+# Host key the nginx listen ports are stored under in the host_ports table
+NGINX_HOST = "nginx"
+HEALTH_TYPES = ("udp", "http")
+DEFAULT_PROXY_TIMEOUT_SECONDS = 30
+
+def udp_port_range() -> List[int]:
+    """The nginx listen ports UDP apps are assigned from (ORCHESTRY_UDP_PORT_RANGE)."""
+    raw = os.getenv("ORCHESTRY_UDP_PORT_RANGE", "20000-20099")
+    match = PORT_RANGE_PATTERN.match(raw)
+    if not match or int(match.group(1)) > int(match.group(2)):
+        logger.warning(f"Invalid ORCHESTRY_UDP_PORT_RANGE {raw!r}, using 20000-20099")
+        return list(range(20000, 20100))
+    return list(range(int(match.group(1)), int(match.group(2)) + 1))
+
+def is_udp(spec: Dict[str, Any]) -> bool:
+    return spec.get("type") == "udp"
+
+def _int_setting(value: Any, name: str, low: int, high: int) -> Tuple[Optional[int], Optional[str]]:
+    if value is None:
+        return None, None
+    if isinstance(value, str) and value.isdigit():
+        value = int(value)
+    if not isinstance(value, int) or isinstance(value, bool) or not low <= value <= high:
+        return None, f"{name} must be an integer between {low} and {high}"
+    return value, None
+
+def validate_udp(app_spec: Dict[str, Any]) -> Tuple[Dict[str, Any], Optional[str]]:
+    """Normalize the UDP settings of a `type: udp` app (the `udp` section, port protocol
+    and health check). Returns (fields to store, error)."""
+    port = app_spec["ports"][0]
+    if str(port.get("protocol", "UDP")).upper() != "UDP":
+        return {}, "The first port of a UDP app must use protocol UDP"
+    ports = [dict(port, protocol="UDP")] + list(app_spec["ports"][1:])
+
+    settings = app_spec.get("udp") or {}
+    if not isinstance(settings, dict):
+        return {}, "udp must be an object"
+    udp = {}
+    for key, name, low, high in (("listenPort", "udp.listenPort", 1, 65535),
+                                 ("proxyResponses", "udp.proxyResponses", 0, 1000),
+                                 ("proxyTimeoutSeconds", "udp.proxyTimeoutSeconds", 1, 3600)):
+        value, error = _int_setting(settings.get(key), name, low, high)
+        if error:
+            return {}, error
+        if value is not None:
+            udp[key] = value
+
+    fields = {"ports": ports, "udp": udp}
+    health = app_spec.get("health")
+    if health:
+        health = dict(health)
+        # Without an explicit type, a UDP app is probed on its UDP port
+        health_type = health.get("type") or "udp"
+        if health_type not in HEALTH_TYPES:
+            return {}, f"health.type must be one of {', '.join(HEALTH_TYPES)}"
+        if health_type == "http" and not health.get("port"):
+            return {}, "An HTTP health check for a UDP app needs health.port (the app's HTTP check port)"
+        for key in ("send", "expect"):
+            if health.get(key) is not None and not isinstance(health[key], str):
+                return {}, f"health.{key} must be a string"
+        health["type"] = health_type
+        fields["health"] = health
+    return fields, None
+
+def listen_port_candidates(spec: Dict[str, Any]) -> List[int]:
+    if (spec.get("udp") or {}).get("listenPort"):
+        return [spec["udp"]["listenPort"]]
+    return udp_port_range()
+
+def check_listen_port(state_store: Any, app_name: str, spec: Dict[str, Any]) -> Optional[str]:
+    """Error if the app's fixed listen port is already assigned to another app."""
+    listen_port = (spec.get("udp") or {}).get("listenPort")
+    if not listen_port:
+        return None
+    owner = state_store.get_host_port_owner(NGINX_HOST, listen_port)
+    if owner and owner["app_name"] != app_name:
+        return f"udp.listenPort {listen_port} is already used by {owner['app_name']}"
+    return None
+
+def assign_listen_port(state_store: Any, app_name: str, spec: Dict[str, Any]) -> Optional[int]:
+    """The nginx UDP port the app is reachable on, assigning one if it has none yet."""
+    candidates = listen_port_candidates(spec)
+    listen_port = state_store.allocate_host_port(NGINX_HOST, app_name, 0, candidates)
+    if listen_port is None:
+        logger.error(f"No free UDP listen port for {app_name} (tried {candidates[0]}..{candidates[-1]})")
+    return listen_port
+
+def release_listen_port(state_store: Any, app_name: str) -> int:
+    return state_store.release_host_ports(NGINX_HOST, app_name)
+
+def listen_port(state_store: Any, app_name: str) -> Optional[int]:
+    """The nginx UDP port currently assigned to an app, if any."""
+    assigned = state_store.list_host_ports(NGINX_HOST, app_name)
+    return assigned[0]["port"] if assigned else None
+
+def stream_context(spec: Dict[str, Any], port: int) -> Dict[str, Any]:
+    """Template variables for an app's nginx stream config."""
+    settings = spec.get("udp") or {}
+    return {
+        "listen_port": port,
+        "proxy_responses": settings.get("proxyResponses"),
+        "proxy_timeout": settings.get("proxyTimeoutSeconds", DEFAULT_PROXY_TIMEOUT_SECONDS)
+    }
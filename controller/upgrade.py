@@ -0,0 +1,384 @@
+"""
+Rolling upgrade coordination for the controller cluster.
+
+The leader replaces follower controller containers one at a time with a new
+image. It waits for each node to rejoin with the target version, and hands
+leadership to an upgraded node before its own container is replaced. Progress
+is stored in the database so the next leader can finish an upgrade the previous
+one started. If a node fails, the nodes already upgraded are rolled back to the
+previous image the same way.
+"""
+
+import os
+import json
+import time
+import logging
+import threading
+import docker
+from typing import Any, Dict, List, Optional
+
+from .cluster import CONTROLLER_VERSION
+
+logger = logging.getLogger(__name__)
+
+DEFAULT_NODE_TIMEOUT_SECONDS = 180
+# Repository `orchestry controller upgrade --version X` pulls X from
+CONTROLLER_IMAGE_REPOSITORY = os.getenv("ORCHESTRY_CONTROLLER_IMAGE", "orchestry-controller")
+
+def controller_image(version: str) -> str:
+    return f"{CONTROLLER_IMAGE_REPOSITORY}:{version}"
+
+class UpgradeCoordinator:
+    """Drives rolling controller upgrades from the leader node"""
+
+    def __init__(self, cluster_controller: Any):
+        self.cluster = cluster_controller
+        self._thread: Optional[threading.Thread] = None
+        self._lock = threading.Lock()
+        self._init_tables()
+
+    def _init_tables(self):
+        with self.cluster._get_db_connection() as conn:
+            with conn.cursor() as cursor:
+                cursor.execute("""
+                    CREATE TABLE IF NOT EXISTS cluster_upgrades (
+                        id SERIAL PRIMARY KEY,
+                        image VARCHAR(512) NOT NULL,
+                        target_version VARCHAR(64) NOT NULL,
+                        status VARCHAR(32) NOT NULL,
+                        plan JSONB NOT NULL,
+                        completed_nodes JSONB NOT NULL DEFAULT '[]',
+                        current_node VARCHAR(255),
+                        node_timeout_seconds INTEGER NOT NULL,
+                        error TEXT,
+                        started_by VARCHAR(255) NOT NULL,
+                        started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                        updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+                    )
+                """)
+                # What to roll back to, and which upgrade a rollback undoes
+                cursor.execute("ALTER TABLE cluster_upgrades ADD COLUMN IF NOT EXISTS previous_image VARCHAR(512)")
+                cursor.execute("ALTER TABLE cluster_upgrades ADD COLUMN IF NOT EXISTS previous_version VARCHAR(64)")
+                cursor.execute("ALTER TABLE cluster_upgrades ADD COLUMN IF NOT EXISTS auto_rollback BOOLEAN NOT NULL DEFAULT true")
+                cursor.execute("ALTER TABLE cluster_upgrades ADD COLUMN IF NOT EXISTS rollback_of INTEGER")
+                conn.commit()
+
+    # Public API
+
+    def start(self, image: str, target_version: str,
+              node_timeout_seconds: int = DEFAULT_NODE_TIMEOUT_SECONDS,
+              auto_rollback: bool = True) -> Dict[str, Any]:
+        """Pull the image, then plan and start a rolling upgrade. Followers go first, the leader last."""
+        if self.get_active():
+            return {"error": "An upgrade is already in progress"}
+
+        # Fail before touching any node if the image cannot be had
+        error = self._pull(image)
+        if error:
+            return {"error": error}
+
+        followers = sorted(
+            node_id for node_id, node in self.cluster.cluster_nodes.items()
+            if node_id != self.cluster.node_id
+        )
+        plan = followers + [self.cluster.node_id]
+        upgrade_id = self._insert(image, target_version, plan, node_timeout_seconds, auto_rollback,
+                                  previous_image=self._current_image(), previous_version=CONTROLLER_VERSION)
+
+        self.cluster._log_cluster_event("upgrade_started", {
+            "upgrade_id": upgrade_id, "image": image, "target_version": target_version, "plan": plan
+        })
+        logger.info(f"⬆️  Starting rolling upgrade {upgrade_id} to v{target_version}: {plan}")
+        self._run_in_background()
+        return self.get_status(upgrade_id)
+
+    def resume(self):
+        """Pick up an upgrade left unfinished by a previous leader"""
+        if self.get_active():
+            logger.info("⬆️  Resuming unfinished rolling upgrade")
+            self._run_in_background()
+
+    def get_active(self) -> Optional[Dict[str, Any]]:
+        """Get the upgrade currently in progress, if any"""
+        return self._load("WHERE status IN ('running', 'leader_pending') ORDER BY id DESC LIMIT 1")
+
+    def get_status(self, upgrade_id: Optional[int] = None) -> Optional[Dict[str, Any]]:
+        """Get an upgrade (the latest one by default) with the versions nodes currently report"""
+        if upgrade_id is None:
+            upgrade = self._load("ORDER BY id DESC LIMIT 1")
+        else:
+            upgrade = self._load("WHERE id = %s", (upgrade_id,))
+        if upgrade:
+            upgrade["nodes"] = self._node_versions()
+        return upgrade
+
+    # Orchestration
+
+    def _run_in_background(self):
+        with self._lock:
+            if self._thread and self._thread.is_alive():
+                return
+            self._thread = threading.Thread(target=self._run, name="UpgradeTask", daemon=True)
+            self._thread.start()
+
+    def _run(self):
+        upgrade = self.get_active()
+        if not upgrade or not self.cluster.is_leader:
+            return
+
+        try:
+            if upgrade["status"] == "leader_pending":
+                # The previous leader handed over to us; replace its container now
+                self._upgrade_node(upgrade, upgrade["current_node"])
+                self._finish(upgrade, "completed")
+                return
+
+            # A leader that took over mid-upgrade still goes last
+            remaining = [n for n in upgrade["plan"] if n not in upgrade["completed_nodes"] and n != self.cluster.node_id]
+            for node_id in remaining:
+                if not self.cluster.is_leader:
+                    logger.warning("⬆️  Lost leadership during upgrade; the next leader will resume it")
+                    return
+                self._upgrade_node(upgrade, node_id)
+
+            if self.cluster.node_id in upgrade["completed_nodes"] or self.cluster.node_id not in upgrade["plan"]:
+                self._finish(upgrade, "completed")
+                return
+
+            # Everyone else is upgraded: hand leadership over, the new leader replaces us
+            self._update(upgrade["id"], status="leader_pending", current_node=self.cluster.node_id)
+            self.cluster._log_cluster_event("upgrade_leader_handoff", {"upgrade_id": upgrade["id"]})
+            logger.info("⬆️  Followers upgraded, stepping down so the new leader can upgrade this node")
+            self.cluster.step_down(hold_seconds=upgrade["node_timeout_seconds"])
+
+        except Exception as e:
+            logger.error(f"❌ Rolling upgrade {upgrade['id']} failed: {e}")
+            self._finish(upgrade, "failed", error=str(e))
+            if self._start_rollback(upgrade):
+                self._run()
+
+    def _start_rollback(self, upgrade: Dict[str, Any]) -> bool:
+        """Queue the nodes a failed upgrade already replaced to go back to the previous image.
+        Rollbacks themselves are not rolled back."""
+        completed = upgrade["completed_nodes"]
+        if not completed or not upgrade["auto_rollback"] or upgrade["rollback_of"] or not upgrade["previous_image"]:
+            return False
+        plan = sorted(node for node in completed if node != self.cluster.node_id)
+        if self.cluster.node_id in completed:
+            plan.append(self.cluster.node_id)
+        rollback_id = self._insert(upgrade["previous_image"], upgrade["previous_version"], plan,
+                                   upgrade["node_timeout_seconds"], False, rollback_of=upgrade["id"])
+        self.cluster._log_cluster_event("upgrade_rollback_started", {
+            "upgrade_id": rollback_id, "rollback_of": upgrade["id"], "image": upgrade["previous_image"], "plan": plan
+        })
+        logger.info(f"↩️  Rolling {plan} back to v{upgrade['previous_version']} after upgrade {upgrade['id']} failed")
+        return True
+
+    def _upgrade_node(self, upgrade: Dict[str, Any], node_id: str):
+        """Replace one node's container and wait for it to rejoin on the target version"""
+        self._update(upgrade["id"], current_node=node_id)
+        logger.info(f"⬆️  Upgrading {node_id} to {upgrade['image']}")
+        started_at = time.time()
+
+        old_container, new_container = self._replace_container(node_id, upgrade["image"])
+        if self._wait_until_healthy(node_id, new_container, upgrade["target_version"], started_at,
+                                    upgrade["node_timeout_seconds"]):
+            old_container.remove(force=True)
+            upgrade["completed_nodes"].append(node_id)
+            self._update(upgrade["id"], completed_nodes=upgrade["completed_nodes"])
+            self.cluster._log_cluster_event("upgrade_node_completed", {
+                "upgrade_id": upgrade["id"], "node_id": node_id, "version": upgrade["target_version"]
+            })
+            logger.info(f"✅ {node_id} rejoined on v{upgrade['target_version']}")
+            return
+
+        # Roll this node back and stop the upgrade
+        logger.error(f"❌ {node_id} did not rejoin healthy on v{upgrade['target_version']}, rolling it back")
+        name = new_container.name
+        new_container.remove(force=True)
+        old_container.rename(name)
+        old_container.start()
+        raise RuntimeError(
+            f"{node_id} did not rejoin healthy on version {upgrade['target_version']} within "
+            f"{upgrade['node_timeout_seconds']}s; node rolled back"
+        )
+
+    def _pull(self, image: str) -> Optional[str]:
+        """Pull image onto the Docker host. A local image that cannot be pulled (e.g. built with
+        docker compose build) is fine. Returns an error message or None."""
+        client = docker.from_env()
+        try:
+            client.images.pull(image)
+            return None
+        except Exception as e:
+            try:
+                client.images.get(image)
+                logger.info(f"⬆️  Could not pull {image} ({e}), using the local image")
+                return None
+            except docker.errors.ImageNotFound:
+                return f"Could not pull {image}: {e}"
+
+    def _current_image(self) -> Optional[str]:
+        """Image of this node's container, which the cluster rolls back to."""
+        try:
+            matches = docker.from_env().containers.list(filters={"label": f"orchestry.node={self.cluster.node_id}"})
+            return matches[0].attrs["Config"]["Image"] if matches else None
+        except Exception as e:
+            logger.warning(f"Could not find this node's controller image, rollback is unavailable: {e}")
+            return None
+
+    def _replace_container(self, node_id: str, image: str):
+        """Stop a controller container and start a copy of it on the new image"""
+        client = docker.from_env()
+        matches = client.containers.list(all=True, filters={"label": f"orchestry.node={node_id}"})
+        if not matches:
+            raise RuntimeError(f"No container labelled orchestry.node={node_id}")
+
+        old = matches[0]
+        name = old.name
+        config = old.attrs["Config"]
+        host_config = old.attrs["HostConfig"]
+        networks = list(old.attrs["NetworkSettings"]["Networks"].keys())
+
+        ports = {}
+        for container_port, bindings in (host_config.get("PortBindings") or {}).items():
+            if bindings:
+                ports[container_port] = int(bindings[0]["HostPort"])
+
+        # Let the new image report its own version
+        environment = [e for e in config.get("Env") or [] if not e.startswith("ORCHESTRY_VERSION=")]
+
+        old.stop(timeout=30)
+        old.rename(f"{name}-pre-upgrade")
+        try:
+            new = client.containers.run(
+                image,
+                name=name,
+                hostname=config.get("Hostname"),
+                environment=environment,
+                labels=config.get("Labels") or {},
+                volumes=host_config.get("Binds") or [],
+                ports=ports,
+                network=networks[0] if networks else None,
+                restart_policy=host_config.get("RestartPolicy") or {},
+                detach=True
+            )
+            for network in networks[1:]:
+                client.networks.get(network).connect(new)
+        except Exception:
+            old.rename(name)
+            old.start()
+            raise
+
+        return old, new
+
+    def _wait_until_healthy(self, node_id: str, container: Any, target_version: str, since: float, timeout: int) -> bool:
+        """Wait for a node to heartbeat as healthy on the target version. Gives up early if
+        its container exits."""
+        deadline = time.time() + timeout
+        while time.time() < deadline:
+            node = self._node_versions().get(node_id)
+            if node and node["version"] == target_version and node["healthy"] and node["last_heartbeat"] >= since:
+                return True
+            container.reload()
+            if container.status in ("exited", "dead"):
+                logger.error(f"❌ The new container of {node_id} exited with code {container.attrs['State'].get('ExitCode')}")
+                return False
+            time.sleep(5)
+        return False
+
+    # Persistence helpers
+
+    def _node_versions(self) -> Dict[str, Dict[str, Any]]:
+        with self.cluster._get_db_connection() as conn:
+            with conn.cursor() as cursor:
+                cursor.execute("""
+                    SELECT node_id, version, schema_version, state, EXTRACT(EPOCH FROM last_heartbeat), is_healthy
+                    FROM cluster_nodes
+                    WHERE last_heartbeat >= CURRENT_TIMESTAMP - INTERVAL '60 seconds'
+                """)
+                return {
+                    row[0]: {
+                        "version": row[1],
+                        "schema_version": row[2],
+                        "state": row[3],
+                        "last_heartbeat": float(row[4]),
+                        "healthy": row[5]
+                    }
+                    for row in cursor.fetchall()
+                }
+
+    def _load(self, clause: str, params: tuple = ()) -> Optional[Dict[str, Any]]:
+        with self.cluster._get_db_connection() as conn:
+            with conn.cursor() as cursor:
+                cursor.execute(f"""
+                    SELECT id, image, target_version, status, plan, completed_nodes, current_node,
+                           node_timeout_seconds, error, started_by,
+                           EXTRACT(EPOCH FROM started_at), EXTRACT(EPOCH FROM updated_at),
+                           previous_image, previous_version, auto_rollback, rollback_of
+                    FROM cluster_upgrades {clause}
+                """, params)
+                row = cursor.fetchone()
+                if not row:
+                    return None
+                return {
+                    "id": row[0],
+                    "image": row[1],
+                    "target_version": row[2],
+                    "status": row[3],
+                    "plan": row[4] if isinstance(row[4], list) else json.loads(row[4]),
+                    "completed_nodes": row[5] if isinstance(row[5], list) else json.loads(row[5]),
+                    "current_node": row[6],
+                    "node_timeout_seconds": row[7],
+                    "failure_reason": row[8],
+                    "started_by": row[9],
+                    "started_at": float(row[10]),
+                    "updated_at": float(row[11]),
+                    "previous_image": row[12],
+                    "previous_version": row[13],
+                    "auto_rollback": row[14],
+                    "rollback_of": row[15]
+                }
+
+    def _insert(self, image: str, target_version: str, plan: List[str], node_timeout_seconds: int,
+                auto_rollback: bool, previous_image: Optional[str] = None, previous_version: Optional[str] = None,
+                rollback_of: Optional[int] = None) -> int:
+        with self.cluster._get_db_connection() as conn:
+            with conn.cursor() as cursor:
+                cursor.execute("""
+                    INSERT INTO cluster_upgrades
+                    (image, target_version, status, plan, node_timeout_seconds, started_by,
+                     previous_image, previous_version, auto_rollback, rollback_of)
+                    VALUES (%s, %s, 'running', %s, %s, %s, %s, %s, %s, %s)
+                    RETURNING id
+                """, (image, target_version, json.dumps(plan), node_timeout_seconds, self.cluster.node_id,
+                      previous_image, previous_version, auto_rollback, rollback_of))
+                upgrade_id = cursor.fetchone()[0]
+                conn.commit()
+        return upgrade_id
+
+    def _update(self, upgrade_id: int, **fields):
+        assignments: List[str] = []
+        params: List[Any] = []
+        for column, value in fields.items():
+            assignments.append(f"{column} = %s")
+            params.append(json.dumps(value) if isinstance(value, list) else value)
+        params.append(upgrade_id)
+
+        with self.cluster._get_db_connection() as conn:
+            with conn.cursor() as cursor:
+                cursor.execute(f"""
+                    UPDATE cluster_upgrades
+                    SET {', '.join(assignments)}, updated_at = CURRENT_TIMESTAMP
+                    WHERE id = %s
+                """, params)
+                conn.commit()
+
+    def _finish(self, upgrade: Dict[str, Any], status: str, error: Optional[str] = None):
+        self._update(upgrade["id"], status=status, current_node=None, error=error)
+        if upgrade.get("rollback_of") and status == "completed":
+            self._update(upgrade["rollback_of"], status="rolled_back")
+        self.cluster._log_cluster_event(f"upgrade_{status}", {
+            "upgrade_id": upgrade["id"], "target_version": upgrade["target_version"], "error": error
+        })
+        logger.info(f"⬆️  Rolling upgrade {upgrade['id']} {status}")
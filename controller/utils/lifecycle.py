@@ -6,29 +6,88 @@ import logging
 import threading
 import time
 import os
+from dataclasses import replace
 from typing import Optional, Any
 
 from controller.manager import AppManager
 from state.db import get_database_manager
 from controller.nginx import DockerNginxManager
-from controller.scaler import AutoScaler, ScalingPolicy
+from controller.runtime import configured_runtime
+from controller.loadbalancer import LoadBalancer
+from controller.scaler import (AutoScaler, SaturationSample, EvaluationSchedule, policy_from_scaling,
+                               SATURATION_SAMPLE_SECONDS, DEFAULT_EVALUATION_INTERVAL_SECONDS)
 from controller.health import HealthChecker
 from controller.cluster import DistributedController
+from controller import simulated_cluster
+from controller.simulated_cluster import SimulatedCluster
+from controller.cost import CostEstimator
+from controller.chaos import ChaosMonkey
+from controller.upgrade import UpgradeCoordinator
+from controller.secret_store import SecretStore
+from controller.freeze import FreezeState
+from controller.change_calendar import ChangeCalendar
+from controller.catalog import Catalog
+from controller.federation import Federation
+from controller.dns_steering import DnsSteering
+from controller.expiry import ExpiryReaper
+from controller.approvals import ApprovalManager
+from controller.quotas import QuotaManager
+from controller.fsck import ConsistencyChecker
+from controller import udp
+from controller.health_shards import HealthShards, HEALTH_SHARDING_ENABLED
+from controller.prepull import ImagePrePuller
+from controller.image_gc import ImageGarbageCollector
+from controller.disk_usage import DiskUsageMonitor
+from controller.watch import WatchHub
+from controller import decision_hooks
+from controller import concurrency
+from controller import flapping
+from controller import arbiter
+from controller import metrics_sources
+from controller import reconciliation
 
 logger = logging.getLogger(__name__)
 
 # Global components - initialized when starting the API
 app_manager: Optional[AppManager] = None
 state_store: Optional[Any] = None
-nginx_manager: Optional[DockerNginxManager] = None
+nginx_manager: Optional[LoadBalancer] = None
 auto_scaler: Optional[AutoScaler] = None
 health_checker: Optional[HealthChecker] = None
-cluster_controller: Optional[DistributedController] = None
+cluster_controller: Optional[DistributedController] = None  # a SimulatedCluster in simulated cluster mode
+cost_estimator: Optional[CostEstimator] = None
+chaos_monkey: Optional[ChaosMonkey] = None
+upgrade_coordinator: Optional[UpgradeCoordinator] = None
+secret_store: Optional[SecretStore] = None
+freeze_state: Optional[FreezeState] = None
+change_calendar: Optional[ChangeCalendar] = None
+catalog: Optional[Catalog] = None
+federation: Optional[Federation] = None
+dns_steering: Optional[DnsSteering] = None
+expiry_reaper: Optional[ExpiryReaper] = None
+approval_manager: Optional[ApprovalManager] = None
+quota_manager: Optional[QuotaManager] = None
+consistency_checker: Optional[ConsistencyChecker] = None
+health_shards: Optional[HealthShards] = None
+image_prepuller: Optional[ImagePrePuller] = None
+image_gc: Optional[ImageGarbageCollector] = None
+disk_monitor: Optional[DiskUsageMonitor] = None
+watch_hub: Optional[WatchHub] = None
 
 # Background monitoring task
 monitoring_task: Optional[threading.Thread] = None
 monitoring_active = False
 
+# When each running app's metrics are next collected and evaluated (leader only)
+evaluation_schedule = EvaluationSchedule()
+# Shares out host capacity when several apps scale out at once (leader only)
+capacity_arbiter = arbiter.CapacityArbiter()
+# Longest the scheduler sleeps when no evaluation is due
+SCHEDULER_IDLE_SECONDS = 2
+# How often the app list is refreshed from the database and cost sampling and alert
+# digests are checked; evaluations in between use the list from the last refresh
+HOUSEKEEPING_INTERVAL_SECONDS = 10
+
 # Nginx request tracking to compute RPS
 _prev_nginx_requests: Optional[int] = None
 _prev_nginx_time: Optional[float] = None
@@ -44,7 +103,7 @@ def get_state_store() -> Optional[Any]:
     return state_store
 
 
-def get_nginx_manager() -> Optional[DockerNginxManager]:
+def get_nginx_manager() -> Optional[LoadBalancer]:
     """Get the global nginx manager instance."""
     return nginx_manager
 
@@ -64,6 +123,91 @@ def get_cluster_controller() -> Optional[DistributedController]:
     return cluster_controller
 
 
+def get_cost_estimator() -> Optional[CostEstimator]:
+    """Get the global cost estimator instance."""
+    return cost_estimator
+
+
+def get_chaos_monkey() -> Optional[ChaosMonkey]:
+    """Get the global chaos testing instance."""
+    return chaos_monkey
+
+
+def get_upgrade_coordinator() -> Optional[UpgradeCoordinator]:
+    """Get the global rolling upgrade coordinator instance."""
+    return upgrade_coordinator
+
+
+def get_secret_store() -> Optional[SecretStore]:
+    """Get the global secrets store instance."""
+    return secret_store
+
+
+def get_freeze_state() -> Optional[FreezeState]:
+    """Get the global freeze state instance."""
+    return freeze_state
+
+
+def get_change_calendar() -> Optional[ChangeCalendar]:
+    """Get the global deployment freeze window calendar."""
+    return change_calendar
+
+
+def get_catalog() -> Optional[Catalog]:
+    """Get the global app template catalog."""
+    return catalog
+
+
+def get_federation() -> Optional[Federation]:
+    """Get the global view of the federated clusters."""
+    return federation
+
+
+def get_dns_steering() -> Optional[DnsSteering]:
+    """Get the global DNS traffic steering instance."""
+    return dns_steering
+
+
+def get_expiry_reaper() -> Optional[ExpiryReaper]:
+    """Get the global expiry reaper instance."""
+    return expiry_reaper
+
+
+def get_approval_manager() -> Optional[ApprovalManager]:
+    """Get the global approval manager instance."""
+    return approval_manager
+
+def get_quota_manager() -> Optional[QuotaManager]:
+    """Get the global API quota manager instance."""
+    return quota_manager
+
+def get_consistency_checker() -> Optional[ConsistencyChecker]:
+    """Get the global consistency checker instance."""
+    return consistency_checker
+
+def get_health_shards() -> Optional[HealthShards]:
+    """Get the global health check sharding instance (None unless sharding is enabled)."""
+    return health_shards
+
+def get_image_prepuller() -> Optional[ImagePrePuller]:
+    """Get the global image pre-puller instance."""
+    return image_prepuller
+
+def get_image_gc() -> Optional[ImageGarbageCollector]:
+    """Get the global image garbage collector instance."""
+    return image_gc
+
+def get_capacity_arbiter() -> arbiter.CapacityArbiter:
+    return capacity_arbiter
+
+def get_disk_monitor() -> Optional[DiskUsageMonitor]:
+    """Get the global disk usage monitor instance."""
+    return disk_monitor
+
+def get_watch_hub() -> Optional[WatchHub]:
+    """Get the global watch hub that serves GET /watch/apps."""
+    return watch_hub
+
 def get_nginx_tracking():
     """Get nginx request tracking state."""
     global _prev_nginx_requests, _prev_nginx_time
@@ -82,11 +226,17 @@ def on_become_leader():
     logger.info("👑 This node has become the cluster leader - taking control of operations")
 
     if app_manager and auto_scaler:
+        report = reconciliation.ReconciliationReport("leader_takeover", getattr(cluster_controller, "node_id", None))
         try:
-            adopted_summary = app_manager.reconcile_all()
+            adopted_summary = app_manager.reconcile_all(report)
             logger.info(f"✅ Leader reconciled existing containers: {adopted_summary}")
+            # Continue from the previous leader's health view instead of starting cold
+            restored = app_manager.health_checker.reload_persisted()
+            report.health_restored = restored
+            logger.info(f"✅ Leader restored persisted health for {restored} replica(s)")
         except Exception as e:
             logger.error(f"❌ Leader failed to reconcile existing containers: {e}")
+            report.fail("adopt", e)
         
         try:
             apps = state_store.list_apps()
@@ -100,20 +250,13 @@ def on_become_leader():
                     if app_record and app_record.spec:
                         scaling_config = app_record.spec.get("scaling", {})
                         
-                        if scaling_config:  # Only restore if scaling config exists
-                            policy = ScalingPolicy(
-                                min_replicas=scaling_config["minReplicas"],
-                                max_replicas=scaling_config["maxReplicas"],
-                                target_rps_per_replica=scaling_config["targetRPSPerReplica"],
-                                max_p95_latency_ms=scaling_config["maxP95LatencyMs"],
-                                scale_out_threshold_pct=scaling_config["scaleOutThresholdPct"],
-                                scale_in_threshold_pct=scaling_config["scaleInThresholdPct"],
-                                window_seconds=scaling_config.get("windowSeconds", 60),  # Optional field
-                                cooldown_seconds=scaling_config.get("cooldownSeconds", 300)  # Optional field
-                            )
+                        defaults = app_manager.namespaces.scaling_defaults(app_record.namespace)
+                        if scaling_config or defaults:  # Only restore if the app or its namespace has scaling config
+                            policy = policy_from_scaling(scaling_config, defaults)
                             
                             auto_scaler.set_policy(app_name, policy)
-                            logger.info(f"✅ Restored scaling policy for {app_name}: targetRPS={scaling_config['targetRPSPerReplica']}, thresholds={scaling_config['scaleOutThresholdPct']}%/{scaling_config['scaleInThresholdPct']}%")
+                            report.policy_restored(app_name)
+                            logger.info(f"✅ Restored scaling policy for {app_name}: targetRPS={policy.target_rps_per_replica}, thresholds={policy.scale_out_threshold_pct}%/{policy.scale_in_threshold_pct}%")
                         else:
                             logger.debug(f"No scaling config found in spec for {app_name}")
                     else:
@@ -121,20 +264,54 @@ def on_become_leader():
                         
                 except Exception as e:
                     logger.error(f"❌ Failed to restore scaling policy for {app_name}: {e}")
+                    report.fail("restore_policy", e, app_name)
                     
             logger.info("✅ Leader completed scaling policy restoration from database")
         except Exception as e:
             logger.error(f"❌ Leader failed to restore scaling policies: {e}")
+            report.fail("restore_policy", e)
         
         # Start container monitoring for automatic restarts and minReplicas enforcement
         app_manager.start_container_monitoring()
         
         # Clean only containers whose app spec no longer exists
+        if app_manager._is_frozen():
+            logger.warning("🧊 Controller is frozen - skipping orphaned container cleanup")
+            report.skip("orphan_cleanup", "the controller is frozen")
+        else:
+            try:
+                app_manager.cleanup_orphaned_containers(report)
+                logger.info("✅ Leader completed orphaned container cleanup")
+            except Exception as e:
+                logger.error(f"❌ Leader failed orphaned container cleanup: {e}")
+                report.fail("orphan_cleanup", e)
+
+        try:
+            reconciliation.publish(state_store, report)
+        except Exception as e:
+            logger.error(f"❌ Leader failed to publish the reconciliation report: {e}")
+
+        # Replay or roll back scales and rollouts a previous leader was in the middle of
+        if app_manager._is_frozen():
+            logger.warning("🧊 Controller is frozen - leaving unfinished journaled operations alone")
+        else:
+            threading.Thread(target=_recover_operations, daemon=True, name="JournalRecovery").start()
+
+    # Finish any rolling upgrade a previous leader started
+    if upgrade_coordinator:
         try:
-            app_manager.cleanup_orphaned_containers()
-            logger.info("✅ Leader completed orphaned container cleanup")
+            upgrade_coordinator.resume()
         except Exception as e:
-            logger.error(f"❌ Leader failed orphaned container cleanup: {e}")
+            logger.error(f"❌ Leader failed to resume rolling upgrade: {e}")
+
+
+def _recover_operations():
+    try:
+        summary = app_manager.recover_operations()
+        if summary:
+            logger.info(f"✅ Leader recovered unfinished operations from the journal: {summary}")
+    except Exception as e:
+        logger.error(f"❌ Leader failed to recover unfinished operations: {e}")
 
 
 def on_lose_leadership():
@@ -152,9 +329,82 @@ def on_cluster_change(nodes):
     logger.info(f"🔄 Cluster membership changed: {node_count} nodes - {node_ids}")
 
 
+def _scheduler_sleep_seconds() -> float:
+    next_due = evaluation_schedule.next_due()
+    if next_due is None:
+        return SCHEDULER_IDLE_SECONDS
+    return min(max(next_due - time.time(), 0.05), SCHEDULER_IDLE_SECONDS)
+
+def get_evaluation_schedule() -> dict:
+    """Next evaluation time of each running app on the leader."""
+    return evaluation_schedule.snapshot()
+
+def _carry_out_scaling(app_name: str, decision: Any):
+    """Scale an app as the autoscaler decided, and record it."""
+    logger.info(f"Scaling {app_name}: {decision.reason}")
+
+    # Perform scaling
+    result = app_manager.scale(app_name, decision.target_replicas, automated=True, wait=False)
+
+    if result.get("status") == "scaled":
+        # Record scaling action
+        auto_scaler.record_scaling_action(app_name, decision.target_replicas)
+
+        # Log to state store
+        state_store.log_scaling_action(
+            app_name,
+            decision.current_replicas,
+            decision.target_replicas,
+            decision.reason,
+            decision.triggered_by,
+            decision.metrics.__dict__ if decision.metrics else None
+        )
+
+        # Log event
+        state_store.log_event(app_name, "scaled", {
+            "old_replicas": decision.current_replicas,
+            "new_replicas": decision.target_replicas,
+            "reason": decision.reason
+        })
+
+        # Scaling that keeps undoing itself usually needs a longer cooldown or wider thresholds
+        report = flapping.analyze(state_store.get_scaling_history(app_name, limit=flapping.HISTORY_LIMIT),
+                                  auto_scaler.get_policy(app_name))
+        if report["flapping"]:
+            app_manager.alerts.notify(app_name, "scaling_flapping",
+                                      flapping.warning_message(app_name, report), report)
+
+def _arbitrate_scale_outs(scale_outs: list, apps: list):
+    """Grant the scale-outs of one evaluation pass from the host capacity left, by priority
+    and proportional fairness, and log what is deferred."""
+    used = arbiter.usage({app["name"]: (app["spec"] or {}, len(app_manager.instances.get(app["name"], [])))
+                          for app in apps})
+    requests = [{
+        "app": app_name,
+        "priority": arbiter.priority(app_record.spec or {}),
+        "current": decision.current_replicas,
+        "target": decision.target_replicas,
+        "min_replicas": policy.min_replicas if policy else 1,
+        "request": arbiter.replica_request(app_record.spec or {})
+    } for app_name, decision, app_record, policy in scale_outs]
+    round_ = capacity_arbiter.arbitrate(requests, used)
+
+    for (app_name, decision, _, _), granted in zip(scale_outs, round_["decisions"]):
+        if granted.get("deferred"):
+            logger.info(f"Deferred {granted['deferred']} replica(s) of {app_name}: {granted['reason']}")
+            state_store.log_event(app_name, "scale_deferred", dict(granted, capacity=round_["capacity"],
+                                                                   free=round_["free"]))
+        if granted["granted"] > decision.current_replicas:
+            if granted["granted"] < decision.target_replicas:
+                decision = replace(decision, target_replicas=granted["granted"],
+                                   reason=f"{decision.reason} ({granted['reason']})")
+            _carry_out_scaling(app_name, decision)
+
 def background_monitoring():
     """Background thread for monitoring and autoscaling."""
     logger.info("Started background monitoring thread")
+    apps = []
+    housekeeping_at = 0.0
     
     while monitoring_active:
         try:
@@ -164,12 +414,38 @@ def background_monitoring():
                 
             # Only run monitoring on the leader node
             if cluster_controller and not cluster_controller.is_leader:
+                if health_shards:
+                    # Followers probing a shard need to know about replicas the leader started
+                    app_manager.sync_health_targets()
+                # A node that becomes leader refreshes the app list on its first pass
+                housekeeping_at = 0.0
                 time.sleep(5)
                 continue
-            
-            # Get list of running apps only - don't scale stopped apps
-            all_apps = state_store.list_apps()
-            apps = [app for app in all_apps if app.get("status") == "running"]
+
+            if time.time() - housekeeping_at >= HOUSEKEEPING_INTERVAL_SECONDS:
+                housekeeping_at = time.time()
+                # Get list of running apps only - don't scale stopped apps
+                all_apps = state_store.list_apps()
+                apps = [app for app in all_apps if app.get("status") == "running"]
+                evaluation_schedule.sync([app["name"] for app in apps], time.time())
+                if all_apps:
+                    # An empty list may be a database error, so only evict with a real answer
+                    auto_scaler.prune(app["name"] for app in all_apps)
+
+                # Periodically record replica counts for resource accounting
+                if cost_estimator and cost_estimator.sample_due():
+                    cost_estimator.record_usage({
+                        app["name"]: len(app_manager.instances.get(app["name"], []))
+                        for app in apps
+                    })
+
+                # Send daily alert digests to channels that asked for them
+                app_manager.alerts.send_due_digests()
+
+            due = set(evaluation_schedule.pop_due(time.time()))
+            if not due:
+                time.sleep(_scheduler_sleep_seconds())
+                continue
 
             # Fetch nginx status once per loop for reuse
             try:
@@ -199,91 +475,112 @@ def background_monitoring():
             for app_info in apps:
                 insts = app_manager.instances.get(app_info['name'], [])
                 total_replicas_global += len(insts)
+
+            # Scale-outs wait for the end of the pass when host capacity is arbitrated
+            scale_outs = []
             
             for app_info in apps:
                 app_name = app_info["name"]
-                
-                # Get current instances
-                if app_name not in app_manager.instances:
+                if app_name not in due:
                     continue
+                try:
+                    # Get current instances
+                    if app_name not in app_manager.instances:
+                        continue
                 
-                instances = app_manager.instances[app_name]
-                if not instances:
-                    continue
+                    instances = app_manager.instances[app_name]
+                    if not instances:
+                        continue
                 
-                # Update container stats
-                app_manager._update_container_stats(app_name)
+                    # Update container stats
+                    app_manager._update_container_stats(app_name)
                 
-                # Collect metrics for scaling
-                healthy_count = sum(1 for inst in instances if inst.state == "ready")
-                total_cpu = sum(inst.cpu_percent for inst in instances) / len(instances) if instances else 0
-                total_memory = sum(inst.memory_percent for inst in instances) / len(instances) if instances else 0
-
-                # Fair-share distribution of global RPS & connections by replica fraction
-                share = (len(instances) / total_replicas_global) if total_replicas_global > 0 else 0
-                app_rps = rps_global * share
-                app_active_conns = int(active_connections_global * share)
-
-                from controller.scaler import ScalingMetrics
-                metrics = ScalingMetrics(
-                    rps=app_rps,
-                    p95_latency_ms=0,  # latency collection not implemented yet
-                    active_connections=app_active_conns,
-                    cpu_percent=total_cpu,
-                    memory_percent=total_memory,
-                    healthy_replicas=healthy_count,
-                    total_replicas=len(instances)
-                )
+                    # Collect metrics for scaling
+                    healthy_count = sum(1 for inst in instances if inst.state == "ready")
+                    total_cpu = sum(inst.cpu_percent for inst in instances) / len(instances) if instances else 0
+                    total_memory = sum(inst.memory_percent for inst in instances) / len(instances) if instances else 0
+
+                    # Fair-share distribution of global RPS & connections by replica fraction
+                    share = (len(instances) / total_replicas_global) if total_replicas_global > 0 else 0
+                    app_rps = rps_global * share
+                    app_active_conns = int(active_connections_global * share)
+
+                    from controller.scaler import ScalingMetrics
+                    metrics = ScalingMetrics(
+                        rps=app_rps,
+                        p95_latency_ms=0,  # latency collection not implemented yet
+                        active_connections=app_active_conns,
+                        cpu_percent=total_cpu,
+                        memory_percent=total_memory,
+                        healthy_replicas=healthy_count,
+                        total_replicas=len(instances)
+                    )
+
+                    # Metrics the app's scaling.externalMetrics read from plugins and external systems
+                    policy = auto_scaler.get_policy(app_name)
+                    if policy and policy.external_metrics:
+                        metrics.external = metrics_sources.collect(app_name, policy.external_metrics)
                 
-                # Add metrics to scaler
-                auto_scaler.add_metrics(app_name, metrics)
+                    # Add metrics to scaler
+                    auto_scaler.add_metrics(app_name, metrics)
+
+                    # 502/504s and failed upstream attempts trigger scale-out without waiting for the window
+                    app_record = state_store.get_app(app_name)
+                    if app_record and not udp.is_udp(app_record.spec or {}):
+                        errors = nginx_manager.get_upstream_errors(app_name, SATURATION_SAMPLE_SECONDS)
+                        if errors:
+                            auto_scaler.record_saturation(app_name, SaturationSample(
+                                timestamp=now_time, ready_replicas=healthy_count, **errors
+                            ))
+
+                    # Keep collecting metrics while frozen, but make no scaling decisions
+                    if freeze_state and freeze_state.is_frozen():
+                        continue
+                    # Replica counts are in flux while a rollout replaces them
+                    if app_manager.rollout_in_progress(app_name):
+                        continue
                 
-                # Get app mode from database
-                app_record = state_store.get_app(app_name)
-                app_mode = app_record.mode if app_record else "auto"
+                    # Get app mode from database
+                    app_mode = app_record.mode if app_record else "auto"
+                    # Replicas with a hard connection ceiling scale out before they reach it
+                    auto_scaler.set_connection_limit(
+                        app_name, concurrency.max_conns(app_record.spec or {}) if app_record else None)
                 
-                # Evaluate scaling decision
-                decision = auto_scaler.evaluate_scaling(app_name, len(instances), mode=app_mode)
+                    # Evaluate scaling decision
+                    decision = auto_scaler.evaluate_scaling(app_name, len(instances), mode=app_mode)
                 
-                # Debug: Always log scaling decisions for debugging
-                policy = auto_scaler.get_policy(app_name)
-                logger.info(
-                    f"Scaling evaluation for {app_name}: RPS={metrics.rps:.2f}, Conns={metrics.active_connections}, "
-                    f"CPU={total_cpu:.1f}%, Mem={total_memory:.1f}%, Replicas={len(instances)}, "
-                    f"Decision={decision.should_scale}, Reason={decision.reason}, "
-                    f"Thresholds: out={policy.scale_out_threshold_pct if policy else 'N/A'}%, "
-                    f"in={policy.scale_in_threshold_pct if policy else 'N/A'}%"
-                )
+                    # Debug: Always log scaling decisions for debugging
+                    policy = auto_scaler.get_policy(app_name)
+                    logger.info(
+                        f"Scaling evaluation for {app_name}: RPS={metrics.rps:.2f}, Conns={metrics.active_connections}, "
+                        f"CPU={total_cpu:.1f}%, Mem={total_memory:.1f}%, Replicas={len(instances)}, "
+                        f"Decision={decision.should_scale}, Reason={decision.reason}, "
+                        f"Thresholds: out={policy.scale_out_threshold_pct if policy else 'N/A'}%, "
+                        f"in={policy.scale_in_threshold_pct if policy else 'N/A'}%"
+                    )
+
+                    # An external decision service may veto or change the target
+                    hook = decision_hooks.webhook_config(app_record.spec or {}) if app_record else None
+                    if decision.should_scale and hook:
+                        decision, outcome = decision_hooks.consult(app_name, decision, policy, hook)
+                        logger.info(f"Decision webhook for {app_name}: {outcome}, target={decision.target_replicas}")
                 
-                if decision.should_scale:
-                    logger.info(f"Scaling {app_name}: {decision.reason}")
-                    
-                    # Perform scaling
-                    result = app_manager.scale(app_name, decision.target_replicas)
-                    
-                    if result.get("status") == "scaled":
-                        # Record scaling action
-                        auto_scaler.record_scaling_action(app_name, decision.target_replicas)
-                        
-                        # Log to state store
-                        state_store.log_scaling_action(
-                            app_name,
-                            decision.current_replicas,
-                            decision.target_replicas,
-                            decision.reason,
-                            decision.triggered_by,
-                            decision.metrics.__dict__ if decision.metrics else None
-                        )
-                        
-                        # Log event
-                        state_store.log_event(app_name, "scaled", {
-                            "old_replicas": decision.current_replicas,
-                            "new_replicas": decision.target_replicas,
-                            "reason": decision.reason
-                        })
+                    if decision.should_scale:
+                        if arbiter.enabled() and decision.target_replicas > decision.current_replicas:
+                            scale_outs.append((app_name, decision, app_record, policy))
+                        else:
+                            _carry_out_scaling(app_name, decision)
+                finally:
+                    # Each app is evaluated on its own cadence from the scaling policy
+                    policy = auto_scaler.get_policy(app_name)
+                    interval = policy.evaluation_interval_seconds if policy else DEFAULT_EVALUATION_INTERVAL_SECONDS
+                    evaluation_schedule.reschedule(app_name, interval, time.time())
             
-            # Sleep before next monitoring cycle
-            time.sleep(10)
+            if scale_outs:
+                _arbitrate_scale_outs(scale_outs, apps)
+
+            # Sleep until the next app is due
+            time.sleep(_scheduler_sleep_seconds())
             
         except Exception as e:
             logger.error(f"Error in background monitoring: {e}")
@@ -294,7 +591,10 @@ def background_monitoring():
 
 async def startup_event():
     """Initialize all components when the API starts."""
-    global app_manager, state_store, nginx_manager, auto_scaler, health_checker, cluster_controller
+    global app_manager, state_store, nginx_manager, auto_scaler, health_checker, cluster_controller, cost_estimator
+    global chaos_monkey, upgrade_coordinator, secret_store, freeze_state, change_calendar, catalog, approval_manager, quota_manager
+    global consistency_checker, health_shards, image_prepuller, image_gc, disk_monitor, federation, dns_steering
+    global watch_hub, expiry_reaper
     global monitoring_task, monitoring_active
     
     try:
@@ -304,12 +604,22 @@ async def startup_event():
         
         # Initialize distributed controller cluster with leader election
         logger.info("🏗️  Initializing distributed controller cluster...")
-        cluster_controller = DistributedController(
-            node_id=os.getenv("CLUSTER_NODE_ID"),
-            hostname=os.getenv("CLUSTER_HOSTNAME", "localhost"),
-            port=int(os.getenv("ORCHESTRY_PORT", "8000")),
-            db_manager=state_store
-        )
+        if simulated_cluster.enabled():
+            # Several nodes in this process, for developing HA features locally
+            cluster_controller = SimulatedCluster(
+                simulated_cluster.SIMULATED_NODES,
+                hostname=os.getenv("CLUSTER_HOSTNAME", "localhost"),
+                base_port=int(os.getenv("ORCHESTRY_PORT", "8000")),
+                db_manager=state_store,
+                node_id_prefix=os.getenv("CLUSTER_NODE_ID")
+            )
+        else:
+            cluster_controller = DistributedController(
+                node_id=os.getenv("CLUSTER_NODE_ID"),
+                hostname=os.getenv("CLUSTER_HOSTNAME", "localhost"),
+                port=int(os.getenv("ORCHESTRY_PORT", "8000")),
+                db_manager=state_store
+            )
         
         # Set up cluster event handlers
         cluster_controller.on_become_leader = on_become_leader
@@ -318,19 +628,65 @@ async def startup_event():
         
         # Start the cluster
         cluster_controller.start()
+        upgrade_coordinator = UpgradeCoordinator(cluster_controller)
         
         # Initialize other components
-        nginx_manager = DockerNginxManager()
+        runtime = configured_runtime()
+        nginx_manager = DockerNginxManager(docker_client=runtime)
         auto_scaler = AutoScaler()
-        health_checker = HealthChecker()
-        app_manager = AppManager(state_store, nginx_manager)
+        app_manager = AppManager(state_store, nginx_manager, runtime=runtime)
+        # The app manager's checker drives routing; only the leader acts on results, and
+        # probes everything unless checks are sharded across the cluster
+        health_checker = app_manager.health_checker
+        health_checker.set_active_check(lambda: cluster_controller.is_leader)
+        if HEALTH_SHARDING_ENABLED and simulated_cluster.enabled():
+            # Simulated nodes share one health checker, which would only probe its own shard
+            logger.warning("Health check sharding is disabled in simulated cluster mode")
+        elif HEALTH_SHARDING_ENABLED:
+            health_shards = HealthShards(cluster_controller)
+            health_checker.set_shard_owner(health_shards.owns)
+            logger.info("Health checks are sharded across controller nodes")
+        cost_estimator = CostEstimator(state_store)
+        chaos_monkey = ChaosMonkey(app_manager, nginx_manager, state_store)
+        secret_store = SecretStore(state_store)
+        app_manager.edge_auth.secrets = secret_store
+        app_manager.edge_tls.secrets = secret_store
+        freeze_state = FreezeState(state_store)
+        app_manager.freeze = freeze_state
+        app_manager.capacity_arbiter = capacity_arbiter
+        change_calendar = ChangeCalendar(state_store, app_manager.namespaces)
+        catalog = Catalog(state_store)
+        federation = Federation()
+        approval_manager = ApprovalManager(state_store)
+        quota_manager = QuotaManager(state_store)
+        consistency_checker = ConsistencyChecker(app_manager, state_store, nginx_manager)
+        # Every node pulls requested images on its own Docker host
+        image_prepuller = ImagePrePuller(state_store, app_manager.client, cluster_controller)
+        image_prepuller.start()
+        # Every node removes unused app images from its Docker host when the leader asks
+        image_gc = ImageGarbageCollector(state_store, app_manager.client, cluster_controller, freeze_state)
+        image_gc.start()
+        # Every node records its Docker disk usage and alerts when it runs high
+        disk_monitor = DiskUsageMonitor(state_store, app_manager.client, cluster_controller, app_manager.alerts,
+                                        image_gc, freeze_state)
+        disk_monitor.start()
+        # The leader keeps DNS weights of steered apps in line with each cluster's health
+        dns_steering = DnsSteering(state_store, app_manager, federation, cluster_controller)
+        dns_steering.start()
+        # The leader deletes preview apps whose ttl or expiresAt has passed
+        expiry_reaper = ExpiryReaper(state_store, app_manager, cluster_controller, freeze_state)
+        expiry_reaper.start()
+        # Every node tails the watch journal for its own watchers; the leader trims it
+        watch_hub = WatchHub(state_store, cluster_controller)
+        watch_hub.start()
         
         # Start health checker
         await health_checker.start()
         
         # Reconcile existing containers BEFORE cleanup
+        report = reconciliation.ReconciliationReport("startup", getattr(cluster_controller, "node_id", None))
         try:
-            adopted_summary = app_manager.reconcile_all()
+            adopted_summary = app_manager.reconcile_all(report)
             logger.info(f"Reconciliation summary on startup: {adopted_summary}")
             
             # Re-register scaling policies for all existing apps from database
@@ -347,22 +703,15 @@ async def startup_event():
                     if app_record and app_record.spec:
                         scaling_config = app_record.spec.get("scaling", {})
                         
-                        if scaling_config:  # Only restore if scaling config exists
+                        defaults = app_manager.namespaces.scaling_defaults(app_record.namespace)
+                        if scaling_config or defaults:  # Only restore if the app or its namespace has scaling config
                             logger.info(f"Scaling config for {app_name}: {scaling_config}")
                             
-                            policy = ScalingPolicy(
-                                min_replicas=scaling_config["minReplicas"],
-                                max_replicas=scaling_config["maxReplicas"],
-                                target_rps_per_replica=scaling_config["targetRPSPerReplica"],
-                                max_p95_latency_ms=scaling_config["maxP95LatencyMs"],
-                                scale_out_threshold_pct=scaling_config["scaleOutThresholdPct"],
-                                scale_in_threshold_pct=scaling_config["scaleInThresholdPct"],
-                                window_seconds=scaling_config.get("windowSeconds", 60),  # Optional field
-                                cooldown_seconds=scaling_config.get("cooldownSeconds", 300)  # Optional field
-                            )
+                            policy = policy_from_scaling(scaling_config, defaults)
                             
                             auto_scaler.set_policy(app_name, policy)
-                            logger.info(f"Successfully restored scaling policy for {app_name}: targetRPS={scaling_config['targetRPSPerReplica']}, thresholds={scaling_config['scaleOutThresholdPct']}%/{scaling_config['scaleInThresholdPct']}%")
+                            report.policy_restored(app_name)
+                            logger.info(f"Successfully restored scaling policy for {app_name}: targetRPS={policy.target_rps_per_replica}, thresholds={policy.scale_out_threshold_pct}%/{policy.scale_in_threshold_pct}%")
                         else:
                             logger.debug(f"No scaling config found in spec for {app_name}")
                     else:
@@ -370,13 +719,19 @@ async def startup_event():
                         
                 except Exception as e:
                     logger.error(f"Failed to restore scaling policy for {app_name}: {e}")
+                    report.fail("restore_policy", e, app_name)
                     import traceback
                     logger.error(f"Full traceback: {traceback.format_exc()}")
                     
         except Exception as e:
             logger.error(f"Failed initial reconciliation: {e}")
+            report.fail("adopt", e)
             import traceback
             logger.error(f"Full traceback: {traceback.format_exc()}")
+        try:
+            reconciliation.publish(state_store, report)
+        except Exception as e:
+            logger.error(f"Failed to publish the startup reconciliation report: {e}")
 
         # Start background monitoring (runs on all nodes but only leader does work)
         monitoring_active = True
@@ -406,6 +761,24 @@ async def shutdown_event():
     if app_manager:
         app_manager.stop_container_monitoring()
     
+    if image_prepuller:
+        image_prepuller.stop()
+
+    if image_gc:
+        image_gc.stop()
+
+    if disk_monitor:
+        disk_monitor.stop()
+    
+    if dns_steering:
+        dns_steering.stop()
+
+    if expiry_reaper:
+        expiry_reaper.stop()
+
+    if watch_hub:
+        watch_hub.stop()
+    
     if health_checker:
         await health_checker.stop()
     
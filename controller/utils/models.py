@@ -8,9 +8,77 @@ class AppSpec(BaseModel):
     spec: Dict[str, Any]      # Changed to Any for flexibility
     scaling: Optional[Dict[str, Any]] = None
     healthCheck: Optional[Dict[str, Any]] = None
+    tracing: Optional[Dict[str, Any]] = None
+    auth: Optional[Dict[str, Any]] = None
+    tls: Optional[Dict[str, Any]] = None
+    accessLog: Optional[Dict[str, Any]] = None
+    errorPages: Optional[Dict[str, Any]] = None
+    headers: Optional[Dict[str, Any]] = None
+    passiveHealth: Optional[Dict[str, Any]] = None
+    publicStatus: Optional[Dict[str, Any]] = None
+    latencyWeighting: Optional[Dict[str, Any]] = None
+    slowStart: Optional[Any] = None
+    outlierDetection: Optional[Dict[str, Any]] = None
+    continuousDeployment: Optional[Any] = None
+    placement: Optional[Any] = None
+    dnsSteering: Optional[Any] = None
+    availability: Optional[Dict[str, Any]] = None
+    dependsOn: Optional[Any] = None
+    ttl: Optional[Any] = None
+    expiresAt: Optional[Any] = None
+
+class NamespacePolicyRequest(BaseModel):
+    policy: Dict[str, Any] = Field(default_factory=dict)
+
+class V1AppRequest(BaseModel):
+    spec: AppSpec
+    running: Optional[bool] = None  # None leaves the app running or stopped as it is
+
+class V1PolicyRequest(BaseModel):
+    policy: Dict[str, Any] = Field(default_factory=dict)
+
+class PromoteRequest(BaseModel):
+    from_namespace: str = Field(..., min_length=1, max_length=63)
+    to_namespace: str = Field(..., min_length=1, max_length=63)
+    target: Optional[str] = Field(None, min_length=1, max_length=63)
+    revision: Optional[int] = None  # refuse if the source has a newer revision than the one confirmed
+    confirm: bool = False
+
+class CloneRequest(BaseModel):
+    target: str = Field(..., min_length=1, max_length=63)
+    namespace: Optional[str] = Field(None, max_length=63)  # default: the source's namespace
+    set: Dict[str, Any] = Field(default_factory=dict)  # dotted path -> value, e.g. {"image": "shop:pr-12"}
+    start: bool = False
+
+class DeployRequest(BaseModel):
+    image: str = Field(..., min_length=1, max_length=512)
+    ready_timeout: Optional[int] = Field(None, ge=1, le=3600)  # seconds each new replica may take to become ready
+    grace_period: Optional[int] = Field(None, ge=0, le=3600)  # seconds old replicas get after SIGTERM
+
+class EnvRequest(BaseModel):
+    set: Dict[str, str] = Field(default_factory=dict)  # variables to add or change
+    unset: List[str] = Field(default_factory=list)     # variables to remove
+    restart: bool = True                               # False defers the change to replicas started later
+    ready_timeout: Optional[int] = Field(None, ge=1, le=3600)
+    grace_period: Optional[int] = Field(None, ge=0, le=3600)
+
+class TogglesRequest(BaseModel):
+    set: Dict[str, str] = Field(default_factory=dict)  # toggles to change
+    unset: List[str] = Field(default_factory=list)     # toggles to remove from env
+    ready_timeout: Optional[int] = Field(None, ge=1, le=3600)
+    grace_period: Optional[int] = Field(None, ge=0, le=3600)
+
+class ImportBundleRequest(BaseModel):
+    bundle: Dict[str, Any]  # as exported by GET /apps/{name}/export
+
+class ShadowRequest(BaseModel):
+    image: str = Field(..., min_length=1, max_length=512)
+    percent: float = Field(10.0, gt=0, le=100)  # share of requests mirrored to the shadow
+    replicas: int = Field(1, ge=1, le=5)
 
 class ScaleRequest(BaseModel):
     replicas: int = Field(..., ge=0, le=100)
+    grace_period: Optional[int] = Field(None, ge=0, le=3600)  # seconds removed replicas get after SIGTERM
 
 class PolicyRequest(BaseModel):
     policy: Dict
@@ -22,12 +90,21 @@ class SimulatedMetricsRequest(BaseModel):
     cpuPercent: float = 0
     memoryPercent: float = 0
     healthyReplicas: int | None = None
+    externalMetrics: Dict[str, float] = Field(default_factory=dict)  # scaling.externalMetrics name -> value
     evaluate: bool = True  # whether to immediately evaluate and act on scaling
 
+class RegisterBatchRequest(BaseModel):
+    apps: List[AppSpec] = Field(..., min_length=1, max_length=200)
+
+class DeregisterBatchRequest(BaseModel):
+    names: List[str] = Field(..., min_length=1, max_length=200)
+
 class AppRegistrationResponse(BaseModel):
     status: str
     app: str
+    revision: Optional[int] = None
     message: Optional[str] = None
+    warnings: Optional[List[str]] = None  # e.g. env values that look like credentials
 
 class AppStatusResponse(BaseModel):
     app: str
@@ -35,4 +112,73 @@ class AppStatusResponse(BaseModel):
     replicas: int
     ready_replicas: int
     instances: List[Dict]
-    mode: str = "auto"
\ No newline at end of file
+    mode: str = "auto"
+    owner: Optional[str] = None
+    team: Optional[str] = None
+    contact: Optional[str] = None
+    namespace: str = "default"
+    udp_listen_port: Optional[int] = None
+    warm_pool: Optional[Dict] = None
+    queued_operations: Optional[List[Dict]] = None
+    conditions: Optional[List[Dict]] = None  # Available, Progressing, Degraded, LBConfigured, QuotaOK
+    effective_health: Optional[Dict] = None
+    image_prepull: Optional[Dict] = None
+    expiry: Optional[Dict] = None
+
+class ChaosKillRequest(BaseModel):
+    container_id: Optional[str] = None  # random replica when omitted
+
+class ChaosHealthFailureRequest(BaseModel):
+    duration_seconds: int = Field(60, ge=1, le=600)
+    replicas: int = Field(1, ge=1)
+
+class ChaosPauseRequest(BaseModel):
+    duration_seconds: int = Field(30, ge=1, le=600)
+
+class UpgradeRequest(BaseModel):
+    image: Optional[str] = None  # Defaults to ORCHESTRY_CONTROLLER_IMAGE:<target_version>
+    target_version: str
+    node_timeout_seconds: int = Field(180, ge=30, le=1800)
+    auto_rollback: bool = True
+
+class CampaignRequest(BaseModel):
+    from_node: str = Field(..., alias="from")
+    term: int
+
+class FreezeWindowsRequest(BaseModel):
+    windows: List[Dict[str, Any]] = Field(default_factory=list)
+
+class CatalogDeployRequest(BaseModel):
+    name: str = Field(..., min_length=1, max_length=63)
+    namespace: Optional[str] = Field(None, min_length=1, max_length=63)
+    values: Dict[str, Any] = Field(default_factory=dict)
+    start: bool = True
+    dry_run: bool = False  # only return the rendered spec
+
+class CatalogTemplateRequest(BaseModel):
+    template: Dict[str, Any]
+
+class ImageGCRequest(BaseModel):
+    dry_run: bool = False  # only report what would be removed
+
+class FreezeRequest(BaseModel):
+    reason: str = Field(..., min_length=1, max_length=500)
+
+class SecretRequest(BaseModel):
+    value: str = Field(..., min_length=1)
+
+class AccessRulesRequest(BaseModel):
+    allowFrom: List[str] = Field(default_factory=list)
+    denyFrom: List[str] = Field(default_factory=list)
+
+class LogSamplingRequest(BaseModel):
+    mode: str = "all"  # all, sampled or errors
+    sampleRate: Optional[int] = None  # log 1 in N responses below 500 (sampled)
+
+class HeaderRulesRequest(BaseModel):
+    request: Optional[Dict[str, Any]] = None  # {"set": {name: value}, "remove": [name]}
+    response: Optional[Dict[str, Any]] = None
+
+class MaintenanceRequest(BaseModel):
+    enabled: bool
+    message: Optional[str] = None  # shown on the built-in maintenance page
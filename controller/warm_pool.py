@@ -0,0 +1,86 @@
+"""
+Warm pools of standby replicas.
+An app can keep a few containers created ahead of time (`created`) or started
+and then paused (`paused`) so scale-out can turn one into a replica in seconds
+instead of creating and booting a container. Standbys carry the
+orchestry.warm label; since labels cannot change, a warm container counts as a
+standby only while it is not running; once activated it is a normal replica.
+"""
+
+import logging
+from typing import Any, Dict, List, Optional, Tuple
+
+logger = logging.getLogger(__name__)
+
+WARM_LABEL = "orchestry.warm"
+WARM_POOL_MODES = ("created", "paused")
+MAX_WARM_POOL_SIZE = 20
+# Docker states a standby can be in; created standbys that were stopped show up as exited
+STANDBY_STATES = ("created", "exited", "paused")
+
+def validate_warm_pool(config: Any, app_spec: Dict[str, Any]) -> Tuple[Optional[Dict[str, Any]], Optional[str]]:
+    """Normalize `scaling.warmPool`. Returns (config to store or None, error)."""
+    if config is None:
+        return None, None
+    if isinstance(config, int) and not isinstance(config, bool):
+        config = {"size": config}
+    if not isinstance(config, dict):
+        return None, "scaling.warmPool must be a number of standbys or an object with size and mode"
+    size = config.get("size", 0)
+    mode = config.get("mode", "created")
+    if not isinstance(size, int) or isinstance(size, bool) or not 0 <= size <= MAX_WARM_POOL_SIZE:
+        return None, f"scaling.warmPool.size must be between 0 and {MAX_WARM_POOL_SIZE}"
+    if mode not in WARM_POOL_MODES:
+        return None, f"scaling.warmPool.mode must be one of {', '.join(WARM_POOL_MODES)}"
+    if size and (app_spec.get("hostPort") or app_spec.get("publishRange")):
+        return None, "scaling.warmPool cannot be used with hostPort or publishRange"
+    if not size:
+        return None, None
+    return {"size": size, "mode": mode}, None
+
+def pool_config(app_spec: Dict[str, Any]) -> Optional[Dict[str, Any]]:
+    return (app_spec.get("scaling") or {}).get("warmPool")
+
+def is_standby(container: Any) -> bool:
+    """Whether a container is an idle warm pool standby (not yet activated)."""
+    return container.labels.get(WARM_LABEL) == "true" and container.status in STANDBY_STATES
+
+def standbys(docker_client: Any, app_name: str) -> List[Any]:
+    """An app's idle standbys, oldest replica index first."""
+    containers = docker_client.containers.list(all=True, filters={"label": [f"orchestry.app={app_name}", WARM_LABEL]})
+    idle = [c for c in containers if is_standby(c)]
+    return sorted(idle, key=lambda c: int(c.labels.get("orchestry.replica", "0") or 0))
+
+def matches(container: Any, app_spec: Dict[str, Any], mode: Optional[str]) -> bool:
+    """Whether a standby was created for the app's current image and pool mode."""
+    image = (container.attrs.get("Config") or {}).get("Image")
+    expected_state = "paused" if mode == "paused" else None
+    if image != app_spec.get("image"):
+        return False
+    return container.status == expected_state if expected_state else container.status != "paused"
+
+def park(container: Any, mode: str):
+    """Put a newly created container into standby: paused standbys are booted first."""
+    if mode == "paused":
+        container.start()
+        container.pause()
+
+def activate(container: Any):
+    """Bring a standby into service and wait until Docker reports it running."""
+    if container.status == "paused":
+        container.unpause()
+    else:
+        container.start()
+    container.reload()
+    if container.status != "running":
+        raise RuntimeError(f"standby {container.name} did not start: {container.status}")
+
+def remove(container: Any):
+    try:
+        if container.status == "paused":
+            container.unpause()
+        if container.status in ("paused", "running"):
+            container.stop(timeout=10)
+        container.remove()
+    except Exception as e:
+        logger.warning(f"Failed to remove standby {container.name}: {e}")
@@ -0,0 +1,182 @@
+"""
+Watch API for apps and instances.
+Every write to an app or instance is journaled, in the same transaction, as
+a typed change (ADDED, MODIFIED or DELETED) numbered by a resource version
+that all controllers share. GET /watch/apps?since=RV returns the changes
+after RV as a long poll, or streams them as server-sent events. A client
+lists first (GET /apps returns the resource version the list is current
+at), then watches from there and sees every later change at least once.
+
+Each controller tails the journal once per WATCH_POLL_INTERVAL_SECONDS for
+all of its watchers, so watchers add no database load. Changes are kept for
+WATCH_RETENTION_SECONDS; a watcher that falls further behind gets 410 Gone
+and lists again. Instances are journaled when they appear or disappear, or
+when their status, health or address changes, not on every health check.
+"""
+
+import asyncio
+import json
+import logging
+import os
+import threading
+import time
+from collections import deque
+from typing import Any, Dict, List, Optional, Sequence, Tuple
+
+logger = logging.getLogger(__name__)
+
+KINDS = ("app", "instance")
+CHANGE_TYPES = ("ADDED", "MODIFIED", "DELETED")
+RESOURCE_VERSION_HEADER = "X-Orchestry-Resource-Version"
+
+WATCH_POLL_INTERVAL_SECONDS = float(os.getenv("ORCHESTRY_WATCH_POLL_INTERVAL_SECONDS", "0.5"))
+WATCH_RETENTION_SECONDS = int(os.getenv("ORCHESTRY_WATCH_RETENTION_SECONDS", "3600"))
+DEFAULT_WATCH_TIMEOUT_SECONDS = 30
+MAX_WATCH_TIMEOUT_SECONDS = 300
+# Comment lines sent on idle event streams so proxies do not close them
+HEARTBEAT_SECONDS = 15
+# Changes kept in memory; watchers further behind are served from the journal
+BUFFER_SIZE = 5000
+PAGE_SIZE = 500
+# A resource version missing from the journal belongs to a transaction that is still
+# committing, or one that rolled back; tailing waits this long for it before moving on
+GAP_GRACE_SECONDS = 5
+CLEANUP_INTERVAL_SECONDS = 300
+
+class ResourceVersionTooOld(Exception):
+    """The changes after a resource version have been dropped from the journal."""
+
+    def __init__(self, since: int, compacted: int):
+        super().__init__(f"Resource version {since} is too old (changes up to {compacted} were dropped), "
+                         f"list again and watch from the resource version the list returns")
+        self.since = since
+        self.compacted = compacted
+
+def validate_kinds(kinds: Optional[str]) -> Optional[List[str]]:
+    """Parse a comma-separated kind filter. Raises ValueError for unknown kinds."""
+    if not kinds:
+        return None
+    parsed = [kind.strip() for kind in kinds.split(",") if kind.strip()]
+    unknown = [kind for kind in parsed if kind not in KINDS]
+    if unknown:
+        raise ValueError(f"Unknown kind {', '.join(unknown)}, use {' or '.join(KINDS)}")
+    return parsed
+
+def matches(change: Dict[str, Any], app_name: Optional[str], kinds: Optional[Sequence[str]]) -> bool:
+    return (not app_name or change["app"] == app_name) and (not kinds or change["kind"] in kinds)
+
+def sse_event(change: Dict[str, Any]) -> str:
+    """A change as a server-sent event; its id lets clients resume with Last-Event-ID."""
+    return f"id: {change['resource_version']}\nevent: {change['type']}\ndata: {json.dumps(change)}\n\n"
+
+class WatchHub:
+    """Tails the watch journal for this controller's watchers."""
+
+    def __init__(self, state_store: Any, cluster_controller: Any = None):
+        self.state_store = state_store
+        self.cluster = cluster_controller
+        self._buffer: deque = deque(maxlen=BUFFER_SIZE)
+        self._latest = 0
+        self._compacted = 0
+        self._gap_since: Optional[float] = None
+        self._last_cleanup = 0.0
+        self._lock = threading.Lock()
+        self._active = False
+        self._thread: Optional[threading.Thread] = None
+
+    def start(self):
+        if self._active:
+            return
+        # Watch from the end of the journal; older changes are read from it on demand
+        self._compacted = self.state_store.get_watch_compacted()
+        self._latest = max(self.state_store.get_latest_watch_version(), self._compacted)
+        self._last_cleanup = time.time()
+        self._active = True
+        self._thread = threading.Thread(target=self._loop, daemon=True, name="watch-hub")
+        self._thread.start()
+        logger.info(f"Watch hub started at resource version {self._latest}")
+
+    def stop(self):
+        self._active = False
+
+    def _loop(self):
+        while self._active:
+            try:
+                self.poll()
+                if time.time() - self._last_cleanup >= CLEANUP_INTERVAL_SECONDS:
+                    self._last_cleanup = time.time()
+                    self.compact()
+            except Exception as e:
+                logger.error(f"Error in watch hub loop: {e}")
+            time.sleep(WATCH_POLL_INTERVAL_SECONDS)
+
+    def poll(self) -> int:
+        """Read new changes from the journal. Returns how many were added."""
+        changes = self.state_store.get_watch_changes(self._latest, limit=PAGE_SIZE)
+        added = 0
+        now = time.time()
+        with self._lock:
+            for change in changes:
+                if change["resource_version"] != self._latest + 1:
+                    if self._gap_since is None:
+                        self._gap_since = now
+                    if now - self._gap_since < GAP_GRACE_SECONDS:
+                        break
+                self._gap_since = None
+                self._buffer.append(change)
+                self._latest = change["resource_version"]
+                added += 1
+        return added
+
+    def compact(self):
+        """Drop changes older than the retention period (leader only) and note what was dropped."""
+        if self.cluster and self.cluster.is_leader:
+            dropped = self.state_store.cleanup_watch_changes(time.time() - WATCH_RETENTION_SECONDS)
+            if dropped:
+                logger.info(f"Dropped {dropped} watch changes older than {WATCH_RETENTION_SECONDS}s")
+        self._compacted = self.state_store.get_watch_compacted()
+
+    def latest_resource_version(self) -> int:
+        """The resource version this controller has seen every change up to."""
+        return self._latest
+
+    def changes_since(self, since: int, app_name: Optional[str] = None, kinds: Optional[Sequence[str]] = None,
+                      limit: int = PAGE_SIZE) -> Tuple[List[Dict[str, Any]], int]:
+        """Changes after resource version since that match the filters, oldest first, and the
+        resource version to continue from. Raises ResourceVersionTooOld if some of them were
+        dropped from the journal."""
+        with self._lock:
+            latest = self._latest
+            if since >= latest:
+                return [], max(since, latest)
+            if self._buffer and since >= self._buffer[0]["resource_version"] - 1:
+                changes = [change for change in self._buffer if change["resource_version"] > since]
+                return self._page(changes, app_name, kinds, limit, latest)
+        if since < self._compacted:
+            raise ResourceVersionTooOld(since, self._compacted)
+        # Further back than the buffer: read the journal up to what the hub has seen
+        changes = [change for change in self.state_store.get_watch_changes(since, limit=PAGE_SIZE)
+                   if change["resource_version"] <= latest]
+        through = changes[-1]["resource_version"] if len(changes) == PAGE_SIZE else latest
+        return self._page(changes, app_name, kinds, limit, through)
+
+    @staticmethod
+    def _page(changes: List[Dict[str, Any]], app_name: Optional[str], kinds: Optional[Sequence[str]],
+              limit: int, through: int) -> Tuple[List[Dict[str, Any]], int]:
+        matching = []
+        for change in changes:
+            if matches(change, app_name, kinds):
+                if len(matching) == limit:
+                    return matching, matching[-1]["resource_version"]
+                matching.append(change)
+        return matching, through
+
+    async def wait(self, since: int, timeout: float, app_name: Optional[str] = None,
+                   kinds: Optional[Sequence[str]] = None) -> Tuple[List[Dict[str, Any]], int]:
+        """Like changes_since, but waits up to timeout seconds for the first change."""
+        deadline = time.time() + timeout
+        while True:
+            changes, since = self.changes_since(since, app_name, kinds)
+            if changes or time.time() >= deadline:
+                return changes, since
+            await asyncio.sleep(WATCH_POLL_INTERVAL_SECONDS)
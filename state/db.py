@@ -26,6 +26,10 @@ class AppRecord:
     replicas: int = 0
     last_scaled_at: Optional[float] = None
     mode: str = 'auto'  # 'auto' or 'manual'
+    owner: Optional[str] = None
+    team: Optional[str] = None
+    contact: Optional[str] = None
+    namespace: str = 'default'
 
 @dataclass
 class InstanceRecord:
@@ -39,6 +43,71 @@ class InstanceRecord:
     updated_at: float
     failure_count: int = 0
     last_health_check: Optional[float] = None
+    is_healthy: bool = False
+    consecutive_successes: int = 0
+    last_success: Optional[float] = None
+
+# Event severities, lowest first
+SEVERITIES = ("info", "warning", "critical")
+# Default severity of event types that are not "info"
+EVENT_SEVERITIES = {
+    "stopped": "warning",
+    "deleted": "warning",
+    "archived": "warning",
+    "degraded": "warning",
+    "replica_unhealthy": "warning",
+    "approval_requested": "warning",
+    "approval_rejected": "warning",
+    "controller_frozen": "warning",
+    "freeze_window_override": "warning",
+    "chaos_kill_replica": "warning",
+    "chaos_health_failure": "warning",
+    "chaos_pause_nginx": "warning",
+    "replica_failed": "critical",
+    "replica_quarantined": "warning",
+    "scale_deferred": "warning",
+    "maintenance_enabled": "warning",
+    "replica_start_failed": "warning",
+}
+
+# Columns the watch journal records for apps and instances
+APP_WATCH_COLUMNS = "name, namespace, status, replicas, mode, owner, team, spec, created_at, updated_at"
+INSTANCE_WATCH_COLUMNS = "container_id, app_name, ip, port, status, is_healthy, created_at, updated_at"
+# Instance fields whose changes are journaled; health check bookkeeping is not
+INSTANCE_WATCH_FIELDS = ("app_name", "ip", "port", "status", "is_healthy")
+# Cluster setting holding the newest resource version dropped from the journal
+WATCH_COMPACTED_SETTING = "watch:compacted"
+
+def _app_watch_object(row) -> Dict[str, Any]:
+    spec = json.loads(row[7]) if isinstance(row[7], str) else row[7]
+    return {
+        "name": row[0],
+        "namespace": row[1] or "default",
+        "status": row[2],
+        "replicas": row[3],
+        "mode": row[4] or "auto",
+        "owner": row[5],
+        "team": row[6],
+        "spec": spec or {},
+        "created_at": row[8],
+        "updated_at": row[9]
+    }
+
+def _instance_watch_object(row) -> Dict[str, Any]:
+    return {
+        "container_id": row[0],
+        "app_name": row[1],
+        "ip": row[2],
+        "port": row[3],
+        "status": row[4],
+        "is_healthy": bool(row[5]),
+        "created_at": row[6],
+        "updated_at": row[7]
+    }
+
+def severities_at_or_above(severity: str) -> List[str]:
+    """All severities at least as severe as severity."""
+    return list(SEVERITIES[SEVERITIES.index(severity):])
 
 @dataclass
 class EventRecord:
@@ -49,6 +118,7 @@ class EventRecord:
     message: str
     timestamp: float
     details: Optional[Dict[str, Any]] = None
+    severity: str = "info"  # info, warning, critical
 
 class PostgreSQLManager:
     """
@@ -89,9 +159,13 @@ class PostgreSQLManager:
         self._last_primary_check = 0
         self._primary_check_interval = 30  # Check primary every 30 seconds
         
+        # Whether pg_trgm indexes back search; without them search falls back to scans
+        self.trigram_indexes = False
+
         # Initialize connection pools and database
         self._init_connection_pools()
         self._init_database()
+        self._init_search_indexes()
         
     def _init_connection_pools(self):
         """Initialize connection pools for primary and replica."""
@@ -156,6 +230,12 @@ class PostgreSQLManager:
                         mode VARCHAR(10) DEFAULT 'auto'
                     )
                 ''')
+
+                # Ownership metadata used for filtering and alert routing
+                cursor.execute('ALTER TABLE apps ADD COLUMN IF NOT EXISTS owner VARCHAR(255)')
+                cursor.execute('ALTER TABLE apps ADD COLUMN IF NOT EXISTS team VARCHAR(255)')
+                cursor.execute('ALTER TABLE apps ADD COLUMN IF NOT EXISTS contact VARCHAR(512)')
+                cursor.execute("ALTER TABLE apps ADD COLUMN IF NOT EXISTS namespace VARCHAR(63) NOT NULL DEFAULT 'default'")
                 
                 # Instances table - stores container instance information
                 cursor.execute('''
@@ -172,6 +252,10 @@ class PostgreSQLManager:
                         FOREIGN KEY (app_name) REFERENCES apps (name) ON DELETE CASCADE
                     )
                 ''')
+                # Last-known health, restored when a controller restarts or takes over
+                cursor.execute('ALTER TABLE instances ADD COLUMN IF NOT EXISTS is_healthy BOOLEAN NOT NULL DEFAULT FALSE')
+                cursor.execute('ALTER TABLE instances ADD COLUMN IF NOT EXISTS consecutive_successes INTEGER DEFAULT 0')
+                cursor.execute('ALTER TABLE instances ADD COLUMN IF NOT EXISTS last_success DOUBLE PRECISION')
                 
                 # Events table - stores system events and audit trail
                 cursor.execute('''
@@ -184,6 +268,7 @@ class PostgreSQLManager:
                         details JSONB
                     )
                 ''')
+                cursor.execute("ALTER TABLE events ADD COLUMN IF NOT EXISTS severity VARCHAR(10) NOT NULL DEFAULT 'info'")
                 
                 # Scaling history table - tracks scaling operations
                 cursor.execute('''
@@ -197,19 +282,227 @@ class PostgreSQLManager:
                         timestamp DOUBLE PRECISION NOT NULL
                     )
                 ''')
+
+                # App status history - every status transition, with its cause
+                cursor.execute('''
+                    CREATE TABLE IF NOT EXISTS app_status_history (
+                        id SERIAL PRIMARY KEY,
+                        app_name VARCHAR(255) NOT NULL,
+                        from_status VARCHAR(50),
+                        to_status VARCHAR(50) NOT NULL,
+                        cause TEXT NOT NULL,
+                        details JSONB,
+                        timestamp DOUBLE PRECISION NOT NULL
+                    )
+                ''')
+
+                # Resource usage table - periodic samples of running replicas and requested resources
+                cursor.execute('''
+                    CREATE TABLE IF NOT EXISTS resource_usage (
+                        id SERIAL PRIMARY KEY,
+                        app_name VARCHAR(255) NOT NULL,
+                        replicas INTEGER NOT NULL,
+                        cpu_cores DOUBLE PRECISION NOT NULL,
+                        memory_gb DOUBLE PRECISION NOT NULL,
+                        duration_seconds DOUBLE PRECISION NOT NULL,
+                        timestamp DOUBLE PRECISION NOT NULL
+                    )
+                ''')
+                
+                # Secrets table - encrypted values referenced by app specs
+                cursor.execute('''
+                    CREATE TABLE IF NOT EXISTS secrets (
+                        name VARCHAR(255) PRIMARY KEY,
+                        value TEXT NOT NULL,
+                        created_at DOUBLE PRECISION NOT NULL,
+                        updated_at DOUBLE PRECISION NOT NULL
+                    )
+                ''')
+                
+                # Namespaces - groups of apps sharing policies (e.g. security requirements)
+                cursor.execute('''
+                    CREATE TABLE IF NOT EXISTS namespaces (
+                        name VARCHAR(63) PRIMARY KEY,
+                        config JSONB NOT NULL,
+                        created_at DOUBLE PRECISION NOT NULL,
+                        updated_at DOUBLE PRECISION NOT NULL
+                    )
+                ''')
+                
+                # App revisions - every registered spec, as submitted; used for promotions
+                cursor.execute('''
+                    CREATE TABLE IF NOT EXISTS app_revisions (
+                        app_name VARCHAR(255) NOT NULL,
+                        revision INTEGER NOT NULL,
+                        spec JSONB NOT NULL,
+                        source JSONB,
+                        created_at DOUBLE PRECISION NOT NULL,
+                        PRIMARY KEY (app_name, revision)
+                    )
+                ''')
+                
+                # Operations on protected apps waiting for a second approval
+                cursor.execute('''
+                    CREATE TABLE IF NOT EXISTS operations (
+                        id VARCHAR(32) PRIMARY KEY,
+                        app_name VARCHAR(255) NOT NULL,
+                        action VARCHAR(50) NOT NULL,
+                        params JSONB NOT NULL,
+                        reason TEXT,
+                        status VARCHAR(20) NOT NULL DEFAULT 'pending',
+                        requested_by VARCHAR(255),
+                        requested_at DOUBLE PRECISION NOT NULL,
+                        expires_at DOUBLE PRECISION NOT NULL,
+                        decided_by VARCHAR(255),
+                        decided_at DOUBLE PRECISION,
+                        result JSONB
+                    )
+                ''')
+                
+                # Host ports published for app replicas, per Docker host
+                cursor.execute('''
+                    CREATE TABLE IF NOT EXISTS host_ports (
+                        host VARCHAR(255) NOT NULL,
+                        port INTEGER NOT NULL,
+                        app_name VARCHAR(255) NOT NULL,
+                        replica INTEGER NOT NULL,
+                        assigned_at DOUBLE PRECISION NOT NULL,
+                        PRIMARY KEY (host, port),
+                        UNIQUE (host, app_name, replica),
+                        FOREIGN KEY (app_name) REFERENCES apps (name) ON DELETE CASCADE
+                    )
+                ''')
+                
+                # API request counts per quota scope and fixed time window
+                cursor.execute('''
+                    CREATE TABLE IF NOT EXISTS api_usage (
+                        scope VARCHAR(400) NOT NULL,
+                        window_start DOUBLE PRECISION NOT NULL,
+                        window_seconds INTEGER NOT NULL,
+                        count INTEGER NOT NULL DEFAULT 0,
+                        PRIMARY KEY (scope, window_start)
+                    )
+                ''')
+                
+                # Images every controller node should pull ahead of scale-out
+                cursor.execute('''
+                    CREATE TABLE IF NOT EXISTS image_prepull_requests (
+                        image VARCHAR(512) PRIMARY KEY,
+                        reason VARCHAR(255),
+                        requested_at DOUBLE PRECISION NOT NULL
+                    )
+                ''')
+                
+                # Pre-pull progress per image and controller node (Docker host)
+                cursor.execute('''
+                    CREATE TABLE IF NOT EXISTS image_prepulls (
+                        image VARCHAR(512) NOT NULL,
+                        node_id VARCHAR(255) NOT NULL,
+                        status VARCHAR(20) NOT NULL,
+                        requested_at DOUBLE PRECISION NOT NULL,
+                        updated_at DOUBLE PRECISION NOT NULL,
+                        error TEXT,
+                        PRIMARY KEY (image, node_id)
+                    )
+                ''')
+                
+                # Latest image garbage collection report of each controller node (Docker host)
+                cursor.execute('''
+                    CREATE TABLE IF NOT EXISTS image_gc_reports (
+                        node_id VARCHAR(255) PRIMARY KEY,
+                        request_id VARCHAR(64),
+                        report JSONB NOT NULL,
+                        updated_at DOUBLE PRECISION NOT NULL
+                    )
+                ''')
+                
+                # Latest Docker disk usage of each controller node (Docker host)
+                cursor.execute('''
+                    CREATE TABLE IF NOT EXISTS disk_usage_reports (
+                        node_id VARCHAR(255) PRIMARY KEY,
+                        level VARCHAR(20) NOT NULL,
+                        usage JSONB NOT NULL,
+                        updated_at DOUBLE PRECISION NOT NULL
+                    )
+                ''')
+                
+                # Cluster-wide settings shared by all controllers (e.g. maintenance freeze)
+                cursor.execute('''
+                    CREATE TABLE IF NOT EXISTS cluster_settings (
+                        key VARCHAR(255) PRIMARY KEY,
+                        value JSONB NOT NULL,
+                        updated_at DOUBLE PRECISION NOT NULL
+                    )
+                ''')
+                
+                # Watch journal - typed changes to apps and instances, numbered by resource version
+                cursor.execute('''
+                    CREATE TABLE IF NOT EXISTS watch_changes (
+                        resource_version BIGSERIAL PRIMARY KEY,
+                        kind VARCHAR(20) NOT NULL,
+                        name VARCHAR(255) NOT NULL,
+                        app_name VARCHAR(255) NOT NULL,
+                        change_type VARCHAR(10) NOT NULL,
+                        object JSONB NOT NULL,
+                        timestamp DOUBLE PRECISION NOT NULL
+                    )
+                ''')
+                
+                # Operation journal - intent and completed steps of scales and rollouts, for crash recovery
+                cursor.execute('''
+                    CREATE TABLE IF NOT EXISTS operation_journal (
+                        id VARCHAR(32) PRIMARY KEY,
+                        app_name VARCHAR(255) NOT NULL,
+                        operation VARCHAR(50) NOT NULL,
+                        intent JSONB NOT NULL,
+                        steps JSONB NOT NULL DEFAULT '[]',
+                        status VARCHAR(20) NOT NULL DEFAULT 'in_progress',
+                        requested_by VARCHAR(255),
+                        started_at DOUBLE PRECISION NOT NULL,
+                        updated_at DOUBLE PRECISION NOT NULL,
+                        finished_at DOUBLE PRECISION,
+                        result JSONB
+                    )
+                ''')
                 
                 # Performance indexes
                 cursor.execute('CREATE INDEX IF NOT EXISTS idx_events_app_time ON events (app_name, timestamp)')
                 cursor.execute('CREATE INDEX IF NOT EXISTS idx_events_type_time ON events (event_type, timestamp)')
+                cursor.execute('CREATE INDEX IF NOT EXISTS idx_events_severity_time ON events (severity, timestamp)')
+                cursor.execute('CREATE INDEX IF NOT EXISTS idx_operations_app_time ON operations (app_name, requested_at)')
                 cursor.execute('CREATE INDEX IF NOT EXISTS idx_apps_status ON apps (status)')
                 cursor.execute('CREATE INDEX IF NOT EXISTS idx_apps_mode ON apps (mode)')
+                cursor.execute('CREATE INDEX IF NOT EXISTS idx_apps_team ON apps (team)')
+                cursor.execute('CREATE INDEX IF NOT EXISTS idx_apps_namespace ON apps (namespace)')
                 cursor.execute('CREATE INDEX IF NOT EXISTS idx_instances_app ON instances (app_name)')
                 cursor.execute('CREATE INDEX IF NOT EXISTS idx_instances_status ON instances (status)')
                 cursor.execute('CREATE INDEX IF NOT EXISTS idx_scaling_app_time ON scaling_history (app_name, timestamp)')
+                cursor.execute('CREATE INDEX IF NOT EXISTS idx_usage_app_time ON resource_usage (app_name, timestamp)')
+                cursor.execute('CREATE INDEX IF NOT EXISTS idx_status_history_app_time ON app_status_history (app_name, timestamp)')
+                cursor.execute('CREATE INDEX IF NOT EXISTS idx_watch_changes_time ON watch_changes (timestamp)')
+                cursor.execute('CREATE INDEX IF NOT EXISTS idx_operation_journal_status ON operation_journal (status, started_at)')
                 
                 conn.commit()
                 
         logger.info("🎉 PostgreSQL database schema initialized successfully")
+
+    def _init_search_indexes(self):
+        """Trigram indexes for GET /search. pg_trgm ships with PostgreSQL but creating the
+        extension needs privileges the database user may not have, so this is best effort."""
+        with self._get_connection(write=True) as conn:
+            with conn.cursor() as cursor:
+                try:
+                    cursor.execute('CREATE EXTENSION IF NOT EXISTS pg_trgm')
+                    cursor.execute('CREATE INDEX IF NOT EXISTS idx_apps_name_trgm ON apps USING gin (name gin_trgm_ops)')
+                    cursor.execute("CREATE INDEX IF NOT EXISTS idx_apps_image_trgm ON apps USING gin ((spec->>'image') gin_trgm_ops)")
+                    cursor.execute("CREATE INDEX IF NOT EXISTS idx_apps_labels_trgm ON apps USING gin (((spec->'labels')::text) gin_trgm_ops)")
+                    cursor.execute('CREATE INDEX IF NOT EXISTS idx_instances_container_trgm ON instances USING gin (container_id gin_trgm_ops)')
+                    cursor.execute('CREATE INDEX IF NOT EXISTS idx_events_message_trgm ON events USING gin (message gin_trgm_ops)')
+                    conn.commit()
+                    self.trigram_indexes = True
+                except psycopg2.Error as e:
+                    conn.rollback()
+                    logger.warning(f"Search indexes not created, search will scan tables instead: {e}")
     
     def _mark_primary_failed(self):
         """Mark primary as failed and record the failure time."""
@@ -389,17 +682,24 @@ class PostgreSQLManager:
                             logger.error(f"Invalid spec type for app {app_record.name}: {type(spec_json)}")
                             spec_json = json.dumps({})
                         
+                        cursor.execute('SELECT 1 FROM apps WHERE name = %s FOR UPDATE', (app_record.name,))
+                        existed = cursor.fetchone() is not None
                         cursor.execute('''
                             INSERT INTO apps 
-                            (name, spec, status, created_at, updated_at, replicas, last_scaled_at, mode)
-                            VALUES (%s, %s, %s, %s, %s, %s, %s, %s)
+                            (name, spec, status, created_at, updated_at, replicas, last_scaled_at, mode,
+                             owner, team, contact, namespace)
+                            VALUES (%s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s)
                             ON CONFLICT (name) DO UPDATE SET
                                 spec = EXCLUDED.spec,
                                 status = EXCLUDED.status,
                                 updated_at = EXCLUDED.updated_at,
                                 replicas = EXCLUDED.replicas,
                                 last_scaled_at = EXCLUDED.last_scaled_at,
-                                mode = EXCLUDED.mode
+                                mode = EXCLUDED.mode,
+                                owner = EXCLUDED.owner,
+                                team = EXCLUDED.team,
+                                contact = EXCLUDED.contact,
+                                namespace = EXCLUDED.namespace
                         ''', (
                             app_record.name,
                             spec_json,
@@ -408,8 +708,13 @@ class PostgreSQLManager:
                             app_record.updated_at,
                             app_record.replicas,
                             app_record.last_scaled_at,
-                            app_record.mode
+                            app_record.mode,
+                            app_record.owner,
+                            app_record.team,
+                            app_record.contact,
+                            app_record.namespace or 'default'
                         ))
+                        self._journal_app(cursor, app_record.name, "MODIFIED" if existed else "ADDED")
                         conn.commit()
                         return True
             except Exception as e:
@@ -443,22 +748,44 @@ class PostgreSQLManager:
                                 updated_at=row[4],
                                 replicas=row[5],
                                 last_scaled_at=row[6],
-                                mode=row[7] if row[7] else 'auto'
+                                mode=row[7] if row[7] else 'auto',
+                                owner=row[8] if len(row) > 8 else None,
+                                team=row[9] if len(row) > 9 else None,
+                                contact=row[10] if len(row) > 10 else None,
+                                namespace=row[11] if len(row) > 11 and row[11] else 'default'
                             )
             except Exception as e:
                 logger.error(f"Failed to get app {name}: {e}")
         return None
         
-    def list_apps(self, status: Optional[str] = None) -> List[Dict[str, Any]]:
-        """List all applications, optionally filtered by status."""
+    def list_apps(self, status: Optional[str] = None, team: Optional[str] = None,
+                  owner: Optional[str] = None, namespace: Optional[str] = None) -> List[Dict[str, Any]]:
+        """List all applications, optionally filtered by status, team, owner or namespace."""
         with self._lock:
             try:
                 with self._get_connection(write=False) as conn:
                     with conn.cursor() as cursor:
+                        query = 'SELECT * FROM apps WHERE 1=1'
+                        params = []
+
                         if status:
-                            cursor.execute('SELECT * FROM apps WHERE status = %s ORDER BY name', (status,))
-                        else:
-                            cursor.execute('SELECT * FROM apps ORDER BY name')
+                            query += ' AND status = %s'
+                            params.append(status)
+
+                        if team:
+                            query += ' AND team = %s'
+                            params.append(team)
+
+                        if owner:
+                            query += ' AND owner = %s'
+                            params.append(owner)
+
+                        if namespace:
+                            query += ' AND namespace = %s'
+                            params.append(namespace)
+
+                        query += ' ORDER BY name'
+                        cursor.execute(query, params)
                         
                         apps = []
                         for row in cursor.fetchall():
@@ -481,7 +808,11 @@ class PostgreSQLManager:
                                     'updated_at': row[4],
                                     'replicas': row[5],
                                     'last_scaled_at': row[6],
-                                    'mode': row[7] if row[7] else 'auto'
+                                    'mode': row[7] if row[7] else 'auto',
+                                    'owner': row[8] if len(row) > 8 else None,
+                                    'team': row[9] if len(row) > 9 else None,
+                                    'contact': row[10] if len(row) > 10 else None,
+                                    'namespace': row[11] if len(row) > 11 and row[11] else 'default'
                                 })
                             except Exception as e:
                                 logger.error(f"Failed to parse app row {row[0]}: {e}")
@@ -491,7 +822,36 @@ class PostgreSQLManager:
             except Exception as e:
                 logger.error(f"Failed to list apps: {e}")
                 return []
-                
+
+    def get_app_summaries(self) -> List[Dict[str, Any]]:
+        """Get one compact row per app, including the latest scaling timestamp, in a single query."""
+        with self._lock:
+            try:
+                with self._get_connection(write=False) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('''
+                            SELECT a.name, a.status, a.mode, a.replicas,
+                                   COALESCE(MAX(sh.timestamp), a.last_scaled_at) AS last_scaled_at
+                            FROM apps a
+                            LEFT JOIN scaling_history sh ON sh.app_name = a.name
+                            GROUP BY a.name, a.status, a.mode, a.replicas, a.last_scaled_at
+                            ORDER BY a.name
+                        ''')
+
+                        return [
+                            {
+                                'name': row[0],
+                                'status': row[1],
+                                'mode': row[2] if row[2] else 'auto',
+                                'replicas': row[3],
+                                'last_scaled_at': row[4]
+                            }
+                            for row in cursor.fetchall()
+                        ]
+            except Exception as e:
+                logger.error(f"Failed to get app summaries: {e}")
+                return []
+
     def delete_app(self, name: str) -> bool:
         """Delete an application and all its instances."""
         with self._lock:
@@ -499,17 +859,53 @@ class PostgreSQLManager:
                 with self._get_connection(write=True) as conn:
                     with conn.cursor() as cursor:
                         # Delete instances first (foreign key constraint)
-                        cursor.execute('DELETE FROM instances WHERE app_name = %s', (name,))
+                        cursor.execute(f'DELETE FROM instances WHERE app_name = %s RETURNING {INSTANCE_WATCH_COLUMNS}', (name,))
+                        for row in cursor.fetchall():
+                            self._record_change(cursor, "instance", "DELETED", _instance_watch_object(row))
                         
                         # Delete the app
-                        cursor.execute('DELETE FROM apps WHERE name = %s', (name,))
+                        cursor.execute(f'DELETE FROM apps WHERE name = %s RETURNING {APP_WATCH_COLUMNS}', (name,))
+                        row = cursor.fetchone()
+                        if row:
+                            self._record_change(cursor, "app", "DELETED", _app_watch_object(row))
                         conn.commit()
                         
-                        return cursor.rowcount > 0
+                        return row is not None
             except Exception as e:
                 logger.error(f"Failed to delete app {name}: {e}")
                 return False
-                
+
+    def purge_app(self, name: str) -> bool:
+        """Delete an application with everything that would outlive delete_app (its revisions,
+        host ports and journal entries) in one transaction, and expire its pending operations.
+        Events and scaling history are kept for the audit trail."""
+        with self._lock:
+            try:
+                with self._get_connection(write=True) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute(f'DELETE FROM instances WHERE app_name = %s RETURNING {INSTANCE_WATCH_COLUMNS}', (name,))
+                        for row in cursor.fetchall():
+                            self._record_change(cursor, "instance", "DELETED", _instance_watch_object(row))
+                        cursor.execute('DELETE FROM host_ports WHERE app_name = %s', (name,))
+                        cursor.execute('DELETE FROM app_revisions WHERE app_name = %s', (name,))
+                        cursor.execute('DELETE FROM operation_journal WHERE app_name = %s', (name,))
+                        cursor.execute('''
+                            UPDATE operations SET status = 'expired', decided_at = %s
+                            WHERE app_name = %s AND status = 'pending'
+                        ''', (time.time(), name))
+
+                        cursor.execute(f'DELETE FROM apps WHERE name = %s RETURNING {APP_WATCH_COLUMNS}', (name,))
+                        row = cursor.fetchone()
+                        if not row:
+                            conn.rollback()
+                            return False
+                        self._record_change(cursor, "app", "DELETED", _app_watch_object(row))
+                        conn.commit()
+                        return True
+            except Exception as e:
+                logger.error(f"Failed to purge app {name}: {e}")
+                return False
+
     def update_app_status(self, name: str, status: str) -> bool:
         """Update application status."""
         with self._lock:
@@ -520,8 +916,11 @@ class PostgreSQLManager:
                             'UPDATE apps SET status = %s, updated_at = %s WHERE name = %s',
                             (status, time.time(), name)
                         )
+                        updated = cursor.rowcount > 0
+                        if updated:
+                            self._journal_app(cursor, name, "MODIFIED")
                         conn.commit()
-                        return cursor.rowcount > 0
+                        return updated
             except Exception as e:
                 logger.error(f"Failed to update app status {name}: {e}")
                 return False
@@ -536,8 +935,11 @@ class PostgreSQLManager:
                             'UPDATE apps SET replicas = %s, last_scaled_at = %s, updated_at = %s WHERE name = %s',
                             (replicas, time.time(), time.time(), name)
                         )
+                        updated = cursor.rowcount > 0
+                        if updated:
+                            self._journal_app(cursor, name, "MODIFIED")
                         conn.commit()
-                        return cursor.rowcount > 0
+                        return updated
             except Exception as e:
                 logger.error(f"Failed to update app replicas {name}: {e}")
                 return False
@@ -549,11 +951,14 @@ class PostgreSQLManager:
             try:
                 with self._get_connection(write=True) as conn:
                     with conn.cursor() as cursor:
+                        cursor.execute(f'SELECT {INSTANCE_WATCH_COLUMNS} FROM instances WHERE container_id = %s FOR UPDATE',
+                                       (instance.container_id,))
+                        previous = cursor.fetchone()
                         cursor.execute('''
                             INSERT INTO instances 
                             (container_id, app_name, ip, port, status, created_at, updated_at, 
-                             failure_count, last_health_check)
-                            VALUES (%s, %s, %s, %s, %s, %s, %s, %s, %s)
+                             failure_count, last_health_check, is_healthy, consecutive_successes, last_success)
+                            VALUES (%s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s)
                             ON CONFLICT (container_id) DO UPDATE SET
                                 app_name = EXCLUDED.app_name,
                                 ip = EXCLUDED.ip,
@@ -561,7 +966,10 @@ class PostgreSQLManager:
                                 status = EXCLUDED.status,
                                 updated_at = EXCLUDED.updated_at,
                                 failure_count = EXCLUDED.failure_count,
-                                last_health_check = EXCLUDED.last_health_check
+                                last_health_check = EXCLUDED.last_health_check,
+                                is_healthy = EXCLUDED.is_healthy,
+                                consecutive_successes = EXCLUDED.consecutive_successes,
+                                last_success = EXCLUDED.last_success
                         ''', (
                             instance.container_id,
                             instance.app_name,
@@ -571,8 +979,12 @@ class PostgreSQLManager:
                             instance.created_at,
                             instance.updated_at,
                             instance.failure_count,
-                            instance.last_health_check
+                            instance.last_health_check,
+                            instance.is_healthy,
+                            instance.consecutive_successes,
+                            instance.last_success
                         ))
+                        self._journal_instance(cursor, previous, instance.container_id)
                         conn.commit()
                         return True
             except Exception as e:
@@ -595,23 +1007,40 @@ class PostgreSQLManager:
                                 'SELECT * FROM instances WHERE app_name = %s', (app_name,)
                             )
                             
-                        return [
-                            InstanceRecord(
-                                container_id=row[0],
-                                app_name=row[1],
-                                ip=row[2],
-                                port=row[3],
-                                status=row[4],
-                                created_at=row[5],
-                                updated_at=row[6],
-                                failure_count=row[7],
-                                last_health_check=row[8]
-                            )
-                            for row in cursor.fetchall()
-                        ]
+                        return [self._row_to_instance(row) for row in cursor.fetchall()]
             except Exception as e:
                 logger.error(f"Failed to get instances for {app_name}: {e}")
                 return []
+
+    def get_instance(self, container_id: str) -> Optional[InstanceRecord]:
+        """Get a single container instance record."""
+        with self._lock:
+            try:
+                with self._get_connection(write=False) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('SELECT * FROM instances WHERE container_id = %s', (container_id,))
+                        row = cursor.fetchone()
+                        return self._row_to_instance(row) if row else None
+            except Exception as e:
+                logger.error(f"Failed to get instance {container_id}: {e}")
+                return None
+
+    @staticmethod
+    def _row_to_instance(row) -> InstanceRecord:
+        return InstanceRecord(
+            container_id=row[0],
+            app_name=row[1],
+            ip=row[2],
+            port=row[3],
+            status=row[4],
+            created_at=row[5],
+            updated_at=row[6],
+            failure_count=row[7],
+            last_health_check=row[8],
+            is_healthy=bool(row[9]) if len(row) > 9 else False,
+            consecutive_successes=(row[10] or 0) if len(row) > 10 else 0,
+            last_success=row[11] if len(row) > 11 else None
+        )
                 
     def delete_instance(self, container_id: str) -> bool:
         """Delete a container instance record."""
@@ -619,9 +1048,13 @@ class PostgreSQLManager:
             try:
                 with self._get_connection(write=True) as conn:
                     with conn.cursor() as cursor:
-                        cursor.execute('DELETE FROM instances WHERE container_id = %s', (container_id,))
+                        cursor.execute(f'DELETE FROM instances WHERE container_id = %s RETURNING {INSTANCE_WATCH_COLUMNS}',
+                                       (container_id,))
+                        row = cursor.fetchone()
+                        if row:
+                            self._record_change(cursor, "instance", "DELETED", _instance_watch_object(row))
                         conn.commit()
-                        return cursor.rowcount > 0
+                        return row is not None
             except Exception as e:
                 logger.error(f"Failed to delete instance {container_id}: {e}")
                 return False
@@ -632,12 +1065,18 @@ class PostgreSQLManager:
             try:
                 with self._get_connection(write=True) as conn:
                     with conn.cursor() as cursor:
+                        cursor.execute(f'SELECT {INSTANCE_WATCH_COLUMNS} FROM instances WHERE container_id = %s FOR UPDATE',
+                                       (container_id,))
+                        previous = cursor.fetchone()
                         cursor.execute(
                             'UPDATE instances SET status = %s, updated_at = %s WHERE container_id = %s',
                             (status, time.time(), container_id)
                         )
+                        updated = cursor.rowcount > 0
+                        if updated:
+                            self._journal_instance(cursor, previous, container_id)
                         conn.commit()
-                        return cursor.rowcount > 0
+                        return updated
             except Exception as e:
                 logger.error(f"Failed to update instance status {container_id}: {e}")
                 return False
@@ -677,15 +1116,16 @@ class PostgreSQLManager:
                                 details_json = json.dumps(str(event.details))
                         
                         cursor.execute('''
-                            INSERT INTO events (app_name, event_type, message, timestamp, details)
-                            VALUES (%s, %s, %s, %s, %s)
+                            INSERT INTO events (app_name, event_type, message, timestamp, details, severity)
+                            VALUES (%s, %s, %s, %s, %s, %s)
                             RETURNING id
                         ''', (
                             event.app_name,
                             event.event_type,
                             event.message,
                             event.timestamp,
-                            details_json
+                            details_json,
+                            event.severity
                         ))
                         conn.commit()
                         return cursor.fetchone()[0]
@@ -694,13 +1134,16 @@ class PostgreSQLManager:
                 return None
                 
     def get_events(self, app_name: Optional[str] = None, event_type: Optional[str] = None, 
-                   limit: int = 100, since: Optional[float] = None) -> List[Dict[str, Any]]:
-        """Get events with optional filtering."""
+                   limit: int = 100, since: Optional[float] = None,
+                   min_severity: Optional[str] = None,
+                   event_types: Optional[List[str]] = None) -> List[Dict[str, Any]]:
+        """Get events with optional filtering. min_severity keeps events at or above that severity,
+        event_types keeps events of any of these types."""
         with self._lock:
             try:
                 with self._get_connection(write=False) as conn:
                     with conn.cursor() as cursor:
-                        query = 'SELECT * FROM events WHERE 1=1'
+                        query = 'SELECT id, app_name, event_type, message, timestamp, details, severity FROM events WHERE 1=1'
                         params = []
                         
                         if app_name:
@@ -710,10 +1153,18 @@ class PostgreSQLManager:
                         if event_type:
                             query += ' AND event_type = %s'
                             params.append(event_type)
+
+                        if event_types:
+                            query += ' AND event_type = ANY(%s)'
+                            params.append(list(event_types))
                             
                         if since:
                             query += ' AND timestamp >= %s'
                             params.append(since)
+
+                        if min_severity:
+                            query += ' AND severity = ANY(%s)'
+                            params.append(severities_at_or_above(min_severity))
                             
                         query += ' ORDER BY timestamp DESC LIMIT %s'
                         params.append(limit)
@@ -741,7 +1192,8 @@ class PostgreSQLManager:
                                     'event_type': row[2],
                                     'message': row[3],
                                     'timestamp': row[4],
-                                    'details': details
+                                    'details': details,
+                                    'severity': row[6] or 'info'
                                 })
                             except Exception as e:
                                 logger.error(f"Failed to parse event row {row[0]}: {e}")
@@ -751,6 +1203,63 @@ class PostgreSQLManager:
             except Exception as e:
                 logger.error(f"Failed to get events: {e}")
                 return []
+
+    def search(self, text: str, kinds: List[str], limit: int = 20,
+               events_since: Optional[float] = None) -> Dict[str, List[Dict[str, Any]]]:
+        """Apps, containers and events containing text (case-insensitive), up to limit of each
+        kind. Apps match on name, image or labels, containers on their ID (prefix) or IP, and
+        events since events_since on their message or type."""
+        results: Dict[str, List[Dict[str, Any]]] = {kind: [] for kind in kinds}
+        pattern = text.replace("\\", "\\\\").replace("%", "\\%").replace("_", "\\_")
+        contains = f"%{pattern}%"
+        with self._lock:
+            try:
+                with self._get_connection(write=False) as conn:
+                    with conn.cursor() as cursor:
+                        if "apps" in kinds:
+                            cursor.execute(
+                                '''SELECT name, namespace, status, spec->>'image', spec->'labels',
+                                          CASE WHEN name ILIKE %s THEN 'name'
+                                               WHEN spec->>'image' ILIKE %s THEN 'image'
+                                               ELSE 'labels' END
+                                   FROM apps
+                                   WHERE name ILIKE %s OR spec->>'image' ILIKE %s OR (spec->'labels')::text ILIKE %s
+                                   ORDER BY name ILIKE %s DESC, length(name), name LIMIT %s''',
+                                (contains, contains, contains, contains, contains, f"{pattern}%", limit))
+                            results["apps"] = [{
+                                "name": row[0], "namespace": row[1], "status": row[2], "image": row[3],
+                                "labels": row[4] or {}, "matched": row[5]
+                            } for row in cursor.fetchall()]
+
+                        if "containers" in kinds:
+                            cursor.execute(
+                                '''SELECT container_id, app_name, ip, port, status, updated_at FROM instances
+                                   WHERE container_id ILIKE %s OR ip = %s
+                                   ORDER BY updated_at DESC LIMIT %s''',
+                                (f"{pattern}%", text, limit))
+                            results["containers"] = [{
+                                "container_id": row[0], "app_name": row[1], "ip": row[2], "port": row[3],
+                                "status": row[4], "updated_at": row[5]
+                            } for row in cursor.fetchall()]
+
+                        if "events" in kinds:
+                            query = '''SELECT id, app_name, event_type, message, timestamp, severity FROM events
+                                       WHERE (message ILIKE %s OR event_type ILIKE %s)'''
+                            params: List[Any] = [contains, contains]
+                            if events_since:
+                                query += ' AND timestamp >= %s'
+                                params.append(events_since)
+                            query += ' ORDER BY timestamp DESC LIMIT %s'
+                            params.append(limit)
+                            cursor.execute(query, params)
+                            results["events"] = [{
+                                "id": row[0], "app_name": row[1], "event_type": row[2], "message": row[3],
+                                "timestamp": row[4], "severity": row[5] or "info"
+                            } for row in cursor.fetchall()]
+                return results
+            except Exception as e:
+                logger.error(f"Failed to search for {text!r}: {e}")
+                return results
                 
     # Scaling history
     def add_scaling_event(self, app_name: str, from_replicas: int, to_replicas: int, 
@@ -790,18 +1299,27 @@ class PostgreSQLManager:
                 logger.error(f"Failed to add scaling event: {e}")
                 return None
                 
-    def get_scaling_history(self, app_name: str, limit: int = 50) -> List[Dict[str, Any]]:
-        """Get scaling history for an application."""
+    def get_scaling_history(self, app_name: Optional[str], limit: int = 50,
+                            since: Optional[float] = None) -> List[Dict[str, Any]]:
+        """Get scaling history for an application (of all applications without one), newest first."""
         with self._lock:
             try:
                 with self._get_connection(write=False) as conn:
                     with conn.cursor() as cursor:
-                        cursor.execute('''
-                            SELECT * FROM scaling_history 
-                            WHERE app_name = %s 
-                            ORDER BY timestamp DESC 
-                            LIMIT %s
-                        ''', (app_name, limit))
+                        query = 'SELECT * FROM scaling_history WHERE 1=1'
+                        params = []
+
+                        if app_name:
+                            query += ' AND app_name = %s'
+                            params.append(app_name)
+
+                        if since:
+                            query += ' AND timestamp >= %s'
+                            params.append(since)
+
+                        query += ' ORDER BY timestamp DESC LIMIT %s'
+                        params.append(limit)
+                        cursor.execute(query, params)
                         
                         scaling_events = []
                         for row in cursor.fetchall():
@@ -836,6 +1354,978 @@ class PostgreSQLManager:
                 logger.error(f"Failed to get scaling history for {app_name}: {e}")
                 return []
                 
+    # Status history
+    def add_status_transition(self, app_name: str, from_status: Optional[str], to_status: str,
+                              cause: str, details: Optional[Dict[str, Any]] = None) -> Optional[int]:
+        """Record a change of an app's status."""
+        with self._lock:
+            try:
+                with self._get_connection(write=True) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('''
+                            INSERT INTO app_status_history
+                            (app_name, from_status, to_status, cause, details, timestamp)
+                            VALUES (%s, %s, %s, %s, %s, %s)
+                            RETURNING id
+                        ''', (app_name, from_status, to_status, cause,
+                              json.dumps(details, default=str) if details else None, time.time()))
+                        conn.commit()
+                        return cursor.fetchone()[0]
+            except Exception as e:
+                logger.error(f"Failed to record status transition of {app_name}: {e}")
+                return None
+
+    def get_last_status(self, app_name: str) -> Optional[str]:
+        """The status an app last moved to, or None if none was recorded."""
+        with self._lock:
+            try:
+                with self._get_connection(write=False) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('''
+                            SELECT to_status FROM app_status_history
+                            WHERE app_name = %s ORDER BY timestamp DESC, id DESC LIMIT 1
+                        ''', (app_name,))
+                        row = cursor.fetchone()
+                        return row[0] if row else None
+            except Exception as e:
+                logger.error(f"Failed to get last status of {app_name}: {e}")
+                return None
+
+    def get_status_history(self, app_name: str, since: Optional[float] = None,
+                           limit: int = 100) -> List[Dict[str, Any]]:
+        """An app's most recent status transitions, oldest first."""
+        with self._lock:
+            try:
+                with self._get_connection(write=False) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('''
+                            SELECT id, from_status, to_status, cause, details, timestamp
+                            FROM app_status_history
+                            WHERE app_name = %s AND timestamp >= %s
+                            ORDER BY timestamp DESC, id DESC
+                            LIMIT %s
+                        ''', (app_name, since or 0, limit))
+                        transitions = []
+                        for row in reversed(cursor.fetchall()):
+                            details = row[4]
+                            if isinstance(details, str):
+                                details = json.loads(details)
+                            transitions.append({
+                                'id': row[0],
+                                'from_status': row[1],
+                                'to_status': row[2],
+                                'cause': row[3],
+                                'details': details,
+                                'timestamp': row[5]
+                            })
+                        return transitions
+            except Exception as e:
+                logger.error(f"Failed to get status history for {app_name}: {e}")
+                return []
+
+    def record_resource_usage(self, app_name: str, replicas: int, cpu_cores: float,
+                              memory_gb: float, duration_seconds: float) -> bool:
+        """Record a resource usage sample covering the last duration_seconds."""
+        with self._lock:
+            try:
+                with self._get_connection(write=True) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('''
+                            INSERT INTO resource_usage
+                            (app_name, replicas, cpu_cores, memory_gb, duration_seconds, timestamp)
+                            VALUES (%s, %s, %s, %s, %s, %s)
+                        ''', (app_name, replicas, cpu_cores, memory_gb, duration_seconds, time.time()))
+                        conn.commit()
+                        return True
+            except Exception as e:
+                logger.error(f"Failed to record resource usage for {app_name}: {e}")
+                return False
+
+    def get_resource_usage(self, app_name: str, since: float, until: Optional[float] = None) -> Dict[str, Any]:
+        """Get replica-hours and requested CPU/GB-hours for an app, in total and per day."""
+        until = until or time.time()
+        with self._lock:
+            try:
+                with self._get_connection(write=False) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('''
+                            SELECT to_char(to_timestamp(timestamp) AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS day,
+                                   SUM(replicas * duration_seconds) / 3600.0,
+                                   SUM(replicas * cpu_cores * duration_seconds) / 3600.0,
+                                   SUM(replicas * memory_gb * duration_seconds) / 3600.0,
+                                   MAX(replicas)
+                            FROM resource_usage
+                            WHERE app_name = %s AND timestamp >= %s AND timestamp <= %s
+                            GROUP BY day
+                            ORDER BY day
+                        ''', (app_name, since, until))
+
+                        daily = [
+                            {
+                                'date': row[0],
+                                'replica_hours': float(row[1] or 0),
+                                'cpu_hours': float(row[2] or 0),
+                                'memory_gb_hours': float(row[3] or 0),
+                                'peak_replicas': row[4]
+                            }
+                            for row in cursor.fetchall()
+                        ]
+
+                        return {
+                            'replica_hours': sum(d['replica_hours'] for d in daily),
+                            'cpu_hours': sum(d['cpu_hours'] for d in daily),
+                            'memory_gb_hours': sum(d['memory_gb_hours'] for d in daily),
+                            'daily': daily
+                        }
+            except Exception as e:
+                logger.error(f"Failed to get resource usage for {app_name}: {e}")
+                return {'replica_hours': 0.0, 'cpu_hours': 0.0, 'memory_gb_hours': 0.0, 'daily': []}
+
+    # Secrets
+    def save_secret(self, name: str, encrypted_value: str) -> bool:
+        """Create or replace a secret. The value must already be encrypted."""
+        now = time.time()
+        with self._lock:
+            try:
+                with self._get_connection(write=True) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('''
+                            INSERT INTO secrets (name, value, created_at, updated_at)
+                            VALUES (%s, %s, %s, %s)
+                            ON CONFLICT (name) DO UPDATE SET
+                                value = EXCLUDED.value,
+                                updated_at = EXCLUDED.updated_at
+                        ''', (name, encrypted_value, now, now))
+                        conn.commit()
+                        return True
+            except Exception as e:
+                logger.error(f"Failed to save secret {name}: {e}")
+                return False
+
+    def get_secret(self, name: str) -> Optional[str]:
+        """Get the encrypted value of a secret."""
+        with self._lock:
+            try:
+                with self._get_connection(write=False) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('SELECT value FROM secrets WHERE name = %s', (name,))
+                        row = cursor.fetchone()
+                        return row[0] if row else None
+            except Exception as e:
+                logger.error(f"Failed to get secret {name}: {e}")
+                return None
+
+    def list_secrets(self) -> List[Dict[str, Any]]:
+        """List secret names and timestamps (never values)."""
+        with self._lock:
+            try:
+                with self._get_connection(write=False) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('SELECT name, created_at, updated_at FROM secrets ORDER BY name')
+                        return [
+                            {'name': row[0], 'created_at': row[1], 'updated_at': row[2]}
+                            for row in cursor.fetchall()
+                        ]
+            except Exception as e:
+                logger.error(f"Failed to list secrets: {e}")
+                return []
+
+    def delete_secret(self, name: str) -> bool:
+        """Delete a secret. Returns False if it did not exist."""
+        with self._lock:
+            try:
+                with self._get_connection(write=True) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('DELETE FROM secrets WHERE name = %s', (name,))
+                        conn.commit()
+                        return cursor.rowcount > 0
+            except Exception as e:
+                logger.error(f"Failed to delete secret {name}: {e}")
+                return False
+
+    # Namespaces
+    def save_namespace(self, name: str, config: Dict[str, Any]) -> bool:
+        """Create or replace a namespace's configuration."""
+        now = time.time()
+        with self._lock:
+            try:
+                with self._get_connection(write=True) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('''
+                            INSERT INTO namespaces (name, config, created_at, updated_at)
+                            VALUES (%s, %s, %s, %s)
+                            ON CONFLICT (name) DO UPDATE SET
+                                config = EXCLUDED.config,
+                                updated_at = EXCLUDED.updated_at
+                        ''', (name, json.dumps(config), now, now))
+                        conn.commit()
+                        return True
+            except Exception as e:
+                logger.error(f"Failed to save namespace {name}: {e}")
+                return False
+
+    def get_namespace(self, name: str) -> Optional[Dict[str, Any]]:
+        """Get a namespace's configuration and timestamps."""
+        with self._lock:
+            try:
+                with self._get_connection(write=False) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute(
+                            'SELECT name, config, created_at, updated_at FROM namespaces WHERE name = %s',
+                            (name,)
+                        )
+                        row = cursor.fetchone()
+                        if row:
+                            return {'name': row[0], 'config': row[1] or {}, 'created_at': row[2], 'updated_at': row[3]}
+            except Exception as e:
+                logger.error(f"Failed to get namespace {name}: {e}")
+        return None
+
+    def list_namespaces(self) -> List[Dict[str, Any]]:
+        """List namespaces that have a configuration or contain apps, with their app counts."""
+        with self._lock:
+            try:
+                with self._get_connection(write=False) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('''
+                            SELECT COALESCE(n.name, a.namespace) AS name, n.config,
+                                   COUNT(a.name) AS app_count
+                            FROM namespaces n
+                            FULL OUTER JOIN apps a ON a.namespace = n.name
+                            GROUP BY COALESCE(n.name, a.namespace), n.config
+                            ORDER BY 1
+                        ''')
+                        return [
+                            {'name': row[0], 'config': row[1] or {}, 'apps': row[2]}
+                            for row in cursor.fetchall()
+                        ]
+            except Exception as e:
+                logger.error(f"Failed to list namespaces: {e}")
+                return []
+
+    # App revisions
+    def save_app_revision(self, app_name: str, spec: Dict[str, Any],
+                          source: Optional[Dict[str, Any]] = None) -> Optional[int]:
+        """Record a new revision of an app's spec. Returns the revision number."""
+        with self._lock:
+            try:
+                with self._get_connection(write=True) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('''
+                            INSERT INTO app_revisions (app_name, revision, spec, source, created_at)
+                            SELECT %s, COALESCE(MAX(revision), 0) + 1, %s, %s, %s
+                            FROM app_revisions WHERE app_name = %s
+                            RETURNING revision
+                        ''', (app_name, json.dumps(spec), json.dumps(source) if source else None,
+                              time.time(), app_name))
+                        revision = cursor.fetchone()[0]
+                        conn.commit()
+                        return revision
+            except Exception as e:
+                logger.error(f"Failed to save revision for app {app_name}: {e}")
+                return None
+
+    def get_app_revision(self, app_name: str, revision: Optional[int] = None) -> Optional[Dict[str, Any]]:
+        """Get one revision of an app's spec, or the latest one if revision is None."""
+        with self._lock:
+            try:
+                with self._get_connection(write=False) as conn:
+                    with conn.cursor() as cursor:
+                        query = 'SELECT app_name, revision, spec, source, created_at FROM app_revisions WHERE app_name = %s'
+                        params: List[Any] = [app_name]
+                        if revision is not None:
+                            query += ' AND revision = %s'
+                            params.append(revision)
+                        cursor.execute(query + ' ORDER BY revision DESC LIMIT 1', params)
+                        row = cursor.fetchone()
+                        if row:
+                            return {'app': row[0], 'revision': row[1], 'spec': row[2],
+                                    'source': row[3], 'created_at': row[4]}
+            except Exception as e:
+                logger.error(f"Failed to get revision for app {app_name}: {e}")
+        return None
+
+    def list_app_revisions(self, app_name: str, limit: int = 20) -> List[Dict[str, Any]]:
+        """List an app's revisions, newest first (without their specs)."""
+        with self._lock:
+            try:
+                with self._get_connection(write=False) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('''
+                            SELECT revision, source, created_at FROM app_revisions
+                            WHERE app_name = %s ORDER BY revision DESC LIMIT %s
+                        ''', (app_name, limit))
+                        return [
+                            {'revision': row[0], 'source': row[1], 'created_at': row[2]}
+                            for row in cursor.fetchall()
+                        ]
+            except Exception as e:
+                logger.error(f"Failed to list revisions for app {app_name}: {e}")
+                return []
+
+    # Operations awaiting approval
+    OPERATION_COLUMNS = ('id', 'app_name', 'action', 'params', 'reason', 'status', 'requested_by',
+                         'requested_at', 'expires_at', 'decided_by', 'decided_at', 'result')
+
+    def _operation_from_row(self, row) -> Dict[str, Any]:
+        operation = dict(zip(self.OPERATION_COLUMNS, row))
+        operation['app'] = operation.pop('app_name')
+        return operation
+
+    def save_operation(self, operation: Dict[str, Any]) -> bool:
+        """Store a new pending operation."""
+        with self._lock:
+            try:
+                with self._get_connection(write=True) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('''
+                            INSERT INTO operations (id, app_name, action, params, reason, status,
+                                                    requested_by, requested_at, expires_at)
+                            VALUES (%s, %s, %s, %s, %s, %s, %s, %s, %s)
+                        ''', (operation['id'], operation['app'], operation['action'],
+                              json.dumps(operation['params']), operation.get('reason'), operation['status'],
+                              operation.get('requested_by'), operation['requested_at'], operation['expires_at']))
+                        conn.commit()
+                        return True
+            except Exception as e:
+                logger.error(f"Failed to save operation {operation.get('id')}: {e}")
+                return False
+
+    def get_operation(self, operation_id: str) -> Optional[Dict[str, Any]]:
+        """Get one operation."""
+        with self._lock:
+            try:
+                with self._get_connection(write=False) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute(
+                            f"SELECT {', '.join(self.OPERATION_COLUMNS)} FROM operations WHERE id = %s",
+                            (operation_id,)
+                        )
+                        row = cursor.fetchone()
+                        if row:
+                            return self._operation_from_row(row)
+            except Exception as e:
+                logger.error(f"Failed to get operation {operation_id}: {e}")
+        return None
+
+    def list_operations(self, app_name: Optional[str] = None, limit: int = 100) -> List[Dict[str, Any]]:
+        """List operations, newest first, optionally for one app."""
+        with self._lock:
+            try:
+                with self._get_connection(write=False) as conn:
+                    with conn.cursor() as cursor:
+                        query = f"SELECT {', '.join(self.OPERATION_COLUMNS)} FROM operations"
+                        params: List[Any] = []
+                        if app_name:
+                            query += ' WHERE app_name = %s'
+                            params.append(app_name)
+                        query += ' ORDER BY requested_at DESC LIMIT %s'
+                        params.append(limit)
+                        cursor.execute(query, params)
+                        return [self._operation_from_row(row) for row in cursor.fetchall()]
+            except Exception as e:
+                logger.error(f"Failed to list operations: {e}")
+                return []
+
+    def update_operation(self, operation_id: str, status: str, decided_by: Optional[str] = None,
+                         result: Optional[Dict[str, Any]] = None,
+                         expected_status: Optional[str] = None) -> bool:
+        """Change an operation's status. With expected_status, only succeeds if the
+        operation is still in that status (so concurrent approvals cannot both win)."""
+        with self._lock:
+            try:
+                with self._get_connection(write=True) as conn:
+                    with conn.cursor() as cursor:
+                        query = '''
+                            UPDATE operations SET status = %s,
+                                decided_by = COALESCE(%s, decided_by),
+                                decided_at = CASE WHEN %s IS NULL THEN decided_at ELSE %s END,
+                                result = COALESCE(%s, result)
+                            WHERE id = %s
+                        '''
+                        params = [status, decided_by, decided_by, time.time(),
+                                  json.dumps(result, default=str) if result is not None else None, operation_id]
+                        if expected_status:
+                            query += ' AND status = %s'
+                            params.append(expected_status)
+                        cursor.execute(query, params)
+                        conn.commit()
+                        return cursor.rowcount > 0
+            except Exception as e:
+                logger.error(f"Failed to update operation {operation_id}: {e}")
+                return False
+
+    # Host ports
+    def allocate_host_port(self, host: str, app_name: str, replica: int,
+                           candidates: List[int]) -> Optional[int]:
+        """Assign a replica the first free candidate port on a host. A replica keeps its
+        existing assignment while that is still a candidate. Returns None if none is free."""
+        with self._lock:
+            try:
+                with self._get_connection(write=True) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute(
+                            'SELECT port FROM host_ports WHERE host = %s AND app_name = %s AND replica = %s',
+                            (host, app_name, replica)
+                        )
+                        row = cursor.fetchone()
+                        if row and row[0] in candidates:
+                            conn.commit()
+                            return row[0]
+                        if row:
+                            cursor.execute(
+                                'DELETE FROM host_ports WHERE host = %s AND app_name = %s AND replica = %s',
+                                (host, app_name, replica)
+                            )
+
+                        cursor.execute('SELECT port FROM host_ports WHERE host = %s AND port = ANY(%s)',
+                                       (host, candidates))
+                        used = {r[0] for r in cursor.fetchall()}
+                        for port in candidates:
+                            if port in used:
+                                continue
+                            cursor.execute('''
+                                INSERT INTO host_ports (host, port, app_name, replica, assigned_at)
+                                VALUES (%s, %s, %s, %s, %s)
+                                ON CONFLICT DO NOTHING
+                                RETURNING port
+                            ''', (host, port, app_name, replica, time.time()))
+                            if cursor.fetchone():
+                                conn.commit()
+                                return port
+                        conn.commit()
+                        return None
+            except Exception as e:
+                logger.error(f"Failed to allocate a host port for {app_name} replica {replica}: {e}")
+                return None
+
+    def get_host_port_owner(self, host: str, port: int) -> Optional[Dict[str, Any]]:
+        """The app and replica a host port is assigned to, or None."""
+        with self._lock:
+            try:
+                with self._get_connection(write=False) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('SELECT app_name, replica FROM host_ports WHERE host = %s AND port = %s',
+                                       (host, port))
+                        row = cursor.fetchone()
+                        return {"app_name": row[0], "replica": row[1]} if row else None
+            except Exception as e:
+                logger.error(f"Failed to look up host port {port}: {e}")
+                return None
+
+    def list_host_ports(self, host: str, app_name: Optional[str] = None) -> List[Dict[str, Any]]:
+        """Host port assignments on a host, optionally for one app."""
+        with self._lock:
+            try:
+                with self._get_connection(write=False) as conn:
+                    with conn.cursor() as cursor:
+                        query = 'SELECT host, port, app_name, replica, assigned_at FROM host_ports WHERE host = %s'
+                        params = [host]
+                        if app_name:
+                            query += ' AND app_name = %s'
+                            params.append(app_name)
+                        query += ' ORDER BY port'
+                        cursor.execute(query, params)
+                        return [
+                            {"host": row[0], "port": row[1], "app": row[2], "replica": row[3], "assigned_at": row[4]}
+                            for row in cursor.fetchall()
+                        ]
+            except Exception as e:
+                logger.error(f"Failed to list host ports: {e}")
+                return []
+
+    def release_host_ports(self, host: str, app_name: str) -> int:
+        """Free every host port assigned to an app on a host."""
+        with self._lock:
+            try:
+                with self._get_connection(write=True) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('DELETE FROM host_ports WHERE host = %s AND app_name = %s', (host, app_name))
+                        conn.commit()
+                        return cursor.rowcount
+            except Exception as e:
+                logger.error(f"Failed to release host ports of {app_name}: {e}")
+                return 0
+
+    # Image pre-pulls
+    def request_image_prepull(self, image: str, reason: str) -> bool:
+        """Ask every controller node to (re)pull an image."""
+        with self._lock:
+            try:
+                with self._get_connection(write=True) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('''
+                            INSERT INTO image_prepull_requests (image, reason, requested_at)
+                            VALUES (%s, %s, %s)
+                            ON CONFLICT (image) DO UPDATE SET
+                                reason = EXCLUDED.reason,
+                                requested_at = EXCLUDED.requested_at
+                        ''', (image, reason, time.time()))
+                        conn.commit()
+                        return True
+            except Exception as e:
+                logger.error(f"Failed to request a pre-pull of {image}: {e}")
+                return False
+
+    def list_image_prepull_requests(self) -> List[Dict[str, Any]]:
+        with self._lock:
+            try:
+                with self._get_connection(write=False) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('SELECT image, reason, requested_at FROM image_prepull_requests ORDER BY requested_at')
+                        return [
+                            {"image": row[0], "reason": row[1], "requested_at": row[2]}
+                            for row in cursor.fetchall()
+                        ]
+            except Exception as e:
+                logger.error(f"Failed to list image pre-pull requests: {e}")
+                return []
+
+    def delete_image_prepull_requests(self, images: List[str]) -> int:
+        """Drop pre-pull requests (and per-node progress) for images."""
+        with self._lock:
+            try:
+                with self._get_connection(write=True) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('DELETE FROM image_prepulls WHERE image = ANY(%s)', (images,))
+                        cursor.execute('DELETE FROM image_prepull_requests WHERE image = ANY(%s)', (images,))
+                        conn.commit()
+                        return cursor.rowcount
+            except Exception as e:
+                logger.error(f"Failed to delete image pre-pull requests: {e}")
+                return 0
+
+    def save_image_prepull(self, image: str, node_id: str, status: str, requested_at: float,
+                           error: Optional[str] = None) -> bool:
+        """Record a node's progress on the pre-pull requested at requested_at."""
+        with self._lock:
+            try:
+                with self._get_connection(write=True) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('''
+                            INSERT INTO image_prepulls (image, node_id, status, requested_at, updated_at, error)
+                            VALUES (%s, %s, %s, %s, %s, %s)
+                            ON CONFLICT (image, node_id) DO UPDATE SET
+                                status = EXCLUDED.status,
+                                requested_at = EXCLUDED.requested_at,
+                                updated_at = EXCLUDED.updated_at,
+                                error = EXCLUDED.error
+                        ''', (image, node_id, status, requested_at, time.time(), error))
+                        conn.commit()
+                        return True
+            except Exception as e:
+                logger.error(f"Failed to save pre-pull status of {image} on {node_id}: {e}")
+                return False
+
+    def list_image_prepulls(self, image: Optional[str] = None, node_id: Optional[str] = None) -> List[Dict[str, Any]]:
+        """Per-node pre-pull progress, optionally for one image or node."""
+        with self._lock:
+            try:
+                with self._get_connection(write=False) as conn:
+                    with conn.cursor() as cursor:
+                        query = 'SELECT image, node_id, status, requested_at, updated_at, error FROM image_prepulls WHERE TRUE'
+                        params = []
+                        if image:
+                            query += ' AND image = %s'
+                            params.append(image)
+                        if node_id:
+                            query += ' AND node_id = %s'
+                            params.append(node_id)
+                        query += ' ORDER BY image, node_id'
+                        cursor.execute(query, params)
+                        return [
+                            {"image": row[0], "node_id": row[1], "status": row[2], "requested_at": row[3],
+                             "updated_at": row[4], "error": row[5]}
+                            for row in cursor.fetchall()
+                        ]
+            except Exception as e:
+                logger.error(f"Failed to list image pre-pulls: {e}")
+                return []
+
+    def list_app_revision_images(self) -> List[Dict[str, Any]]:
+        """The image of every recorded revision of every app, newest revision first per app."""
+        with self._lock:
+            try:
+                with self._get_connection(write=False) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('''
+                            SELECT app_name, revision, spec->'spec'->>'image' FROM app_revisions
+                            WHERE spec->'spec'->>'image' IS NOT NULL
+                            ORDER BY app_name, revision DESC
+                        ''')
+                        return [{"app": row[0], "revision": row[1], "image": row[2]} for row in cursor.fetchall()]
+            except Exception as e:
+                logger.error(f"Failed to list revision images: {e}")
+                return []
+
+    def save_image_gc_report(self, node_id: str, request_id: Optional[str], report: Dict[str, Any]) -> bool:
+        """Replace a node's image garbage collection report."""
+        with self._lock:
+            try:
+                with self._get_connection(write=True) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('''
+                            INSERT INTO image_gc_reports (node_id, request_id, report, updated_at)
+                            VALUES (%s, %s, %s, %s)
+                            ON CONFLICT (node_id) DO UPDATE SET
+                                request_id = EXCLUDED.request_id,
+                                report = EXCLUDED.report,
+                                updated_at = EXCLUDED.updated_at
+                        ''', (node_id, request_id, json.dumps(report), time.time()))
+                        conn.commit()
+                        return True
+            except Exception as e:
+                logger.error(f"Failed to save image GC report of {node_id}: {e}")
+                return False
+
+    def list_image_gc_reports(self) -> List[Dict[str, Any]]:
+        """The latest image garbage collection report of each node."""
+        with self._lock:
+            try:
+                with self._get_connection(write=False) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('SELECT node_id, request_id, report, updated_at FROM image_gc_reports ORDER BY node_id')
+                        return [
+                            {"node_id": row[0], "request_id": row[1], "report": row[2], "updated_at": row[3]}
+                            for row in cursor.fetchall()
+                        ]
+            except Exception as e:
+                logger.error(f"Failed to list image GC reports: {e}")
+                return []
+
+    def save_disk_usage(self, node_id: str, level: str, usage: Dict[str, Any]) -> bool:
+        """Replace a node's Docker disk usage report."""
+        with self._lock:
+            try:
+                with self._get_connection(write=True) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('''
+                            INSERT INTO disk_usage_reports (node_id, level, usage, updated_at)
+                            VALUES (%s, %s, %s, %s)
+                            ON CONFLICT (node_id) DO UPDATE SET
+                                level = EXCLUDED.level,
+                                usage = EXCLUDED.usage,
+                                updated_at = EXCLUDED.updated_at
+                        ''', (node_id, level, json.dumps(usage), time.time()))
+                        conn.commit()
+                        return True
+            except Exception as e:
+                logger.error(f"Failed to save disk usage of {node_id}: {e}")
+                return False
+
+    def list_disk_usage(self) -> List[Dict[str, Any]]:
+        """The latest Docker disk usage report of each node."""
+        with self._lock:
+            try:
+                with self._get_connection(write=False) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('SELECT node_id, level, usage, updated_at FROM disk_usage_reports ORDER BY node_id')
+                        return [
+                            {"node_id": row[0], "level": row[1], "usage": row[2], "updated_at": row[3]}
+                            for row in cursor.fetchall()
+                        ]
+            except Exception as e:
+                logger.error(f"Failed to list disk usage: {e}")
+                return []
+
+    # API usage
+    def increment_api_usage(self, scope: str, window_start: float, window_seconds: int,
+                            amount: int = 1) -> Optional[int]:
+        """Add amount to a scope's request count for one window. Returns the new count."""
+        with self._lock:
+            try:
+                with self._get_connection(write=True) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('''
+                            INSERT INTO api_usage (scope, window_start, window_seconds, count)
+                            VALUES (%s, %s, %s, %s)
+                            ON CONFLICT (scope, window_start) DO UPDATE SET
+                                count = api_usage.count + EXCLUDED.count
+                            RETURNING count
+                        ''', (scope, window_start, window_seconds, amount))
+                        conn.commit()
+                        return cursor.fetchone()[0]
+            except Exception as e:
+                logger.error(f"Failed to record API usage for {scope}: {e}")
+                return None
+
+    def list_api_usage(self, scope_prefix: Optional[str] = None) -> List[Dict[str, Any]]:
+        """Request counts of windows that have not ended yet."""
+        with self._lock:
+            try:
+                with self._get_connection(write=False) as conn:
+                    with conn.cursor() as cursor:
+                        query = '''
+                            SELECT scope, window_start, window_seconds, count FROM api_usage
+                            WHERE window_start + window_seconds > %s
+                        '''
+                        params = [time.time()]
+                        if scope_prefix:
+                            query += ' AND scope LIKE %s'
+                            params.append(scope_prefix.replace('%', r'\%').replace('_', r'\_') + '%')
+                        query += ' ORDER BY scope, window_start'
+                        cursor.execute(query, params)
+                        return [
+                            {"scope": row[0], "window_start": row[1], "window_seconds": row[2], "count": row[3]}
+                            for row in cursor.fetchall()
+                        ]
+            except Exception as e:
+                logger.error(f"Failed to list API usage: {e}")
+                return []
+
+    def cleanup_api_usage(self, before: float) -> int:
+        """Delete request counts of windows that ended before the given time."""
+        with self._lock:
+            try:
+                with self._get_connection(write=True) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('DELETE FROM api_usage WHERE window_start + window_seconds < %s', (before,))
+                        conn.commit()
+                        return cursor.rowcount
+            except Exception as e:
+                logger.error(f"Failed to clean up API usage: {e}")
+                return 0
+
+    # Cluster settings
+    def save_setting(self, key: str, value: Any) -> bool:
+        """Create or replace a cluster-wide setting."""
+        with self._lock:
+            try:
+                with self._get_connection(write=True) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('''
+                            INSERT INTO cluster_settings (key, value, updated_at)
+                            VALUES (%s, %s, %s)
+                            ON CONFLICT (key) DO UPDATE SET
+                                value = EXCLUDED.value,
+                                updated_at = EXCLUDED.updated_at
+                        ''', (key, json.dumps(value), time.time()))
+                        conn.commit()
+                        return True
+            except Exception as e:
+                logger.error(f"Failed to save setting {key}: {e}")
+                return False
+
+    def get_setting(self, key: str, default: Any = None) -> Any:
+        """Get a cluster-wide setting, or default if it is not set."""
+        with self._lock:
+            try:
+                with self._get_connection(write=False) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('SELECT value FROM cluster_settings WHERE key = %s', (key,))
+                        row = cursor.fetchone()
+                        return row[0] if row else default
+            except Exception as e:
+                logger.error(f"Failed to get setting {key}: {e}")
+                return default
+
+    def delete_setting(self, key: str) -> bool:
+        """Remove a cluster-wide setting. Removing one that is not set succeeds."""
+        with self._lock:
+            try:
+                with self._get_connection(write=True) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('DELETE FROM cluster_settings WHERE key = %s', (key,))
+                        conn.commit()
+                        return True
+            except Exception as e:
+                logger.error(f"Failed to delete setting {key}: {e}")
+                return False
+
+    # Watch journal
+    def _record_change(self, cursor, kind: str, change_type: str, obj: Dict[str, Any]):
+        """Journal a change in the transaction that makes it, so watchers never see one that rolled back."""
+        name, app_name = (obj["name"], obj["name"]) if kind == "app" else (obj["container_id"], obj["app_name"])
+        cursor.execute('''
+            INSERT INTO watch_changes (kind, name, app_name, change_type, object, timestamp)
+            VALUES (%s, %s, %s, %s, %s, %s)
+        ''', (kind, name, app_name, change_type, json.dumps(obj), time.time()))
+
+    def _journal_app(self, cursor, name: str, change_type: str):
+        cursor.execute(f'SELECT {APP_WATCH_COLUMNS} FROM apps WHERE name = %s', (name,))
+        row = cursor.fetchone()
+        if row:
+            self._record_change(cursor, "app", change_type, _app_watch_object(row))
+
+    def _journal_instance(self, cursor, previous, container_id: str):
+        """Journal an instance write if it added the instance or changed one of its watched fields."""
+        cursor.execute(f'SELECT {INSTANCE_WATCH_COLUMNS} FROM instances WHERE container_id = %s', (container_id,))
+        row = cursor.fetchone()
+        if not row:
+            return
+        current = _instance_watch_object(row)
+        if previous is None:
+            self._record_change(cursor, "instance", "ADDED", current)
+        elif any(_instance_watch_object(previous)[field] != current[field] for field in INSTANCE_WATCH_FIELDS):
+            self._record_change(cursor, "instance", "MODIFIED", current)
+
+    def get_watch_changes(self, since: int, limit: int = 500) -> List[Dict[str, Any]]:
+        """Journaled changes after resource version since, oldest first."""
+        with self._lock:
+            try:
+                with self._get_connection(write=False) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('''
+                            SELECT resource_version, kind, name, app_name, change_type, object, timestamp
+                            FROM watch_changes WHERE resource_version > %s
+                            ORDER BY resource_version LIMIT %s
+                        ''', (since, limit))
+                        return [
+                            {
+                                "type": row[4],
+                                "kind": row[1],
+                                "name": row[2],
+                                "app": row[3],
+                                "resource_version": row[0],
+                                "timestamp": row[6],
+                                "object": json.loads(row[5]) if isinstance(row[5], str) else row[5]
+                            }
+                            for row in cursor.fetchall()
+                        ]
+            except Exception as e:
+                logger.error(f"Failed to get watch changes since {since}: {e}")
+                return []
+
+    def get_latest_watch_version(self) -> int:
+        """The newest resource version in the journal (0 if it is empty)."""
+        with self._lock:
+            try:
+                with self._get_connection(write=False) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('SELECT COALESCE(MAX(resource_version), 0) FROM watch_changes')
+                        return cursor.fetchone()[0]
+            except Exception as e:
+                logger.error(f"Failed to get the latest watch resource version: {e}")
+                return 0
+
+    def get_watch_compacted(self) -> int:
+        """The newest resource version dropped from the journal (0 if none was)."""
+        return int(self.get_setting(WATCH_COMPACTED_SETTING, 0) or 0)
+
+    def cleanup_watch_changes(self, before: float) -> int:
+        """Drop journaled changes older than before, remembering the newest resource version dropped."""
+        with self._lock:
+            try:
+                with self._get_connection(write=True) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('DELETE FROM watch_changes WHERE timestamp < %s RETURNING resource_version',
+                                       (before,))
+                        dropped = [row[0] for row in cursor.fetchall()]
+                        if dropped:
+                            cursor.execute('''
+                                INSERT INTO cluster_settings (key, value, updated_at)
+                                VALUES (%s, %s, %s)
+                                ON CONFLICT (key) DO UPDATE SET
+                                    value = to_jsonb(GREATEST((cluster_settings.value #>> '{}')::BIGINT,
+                                                              (EXCLUDED.value #>> '{}')::BIGINT)),
+                                    updated_at = EXCLUDED.updated_at
+                            ''', (WATCH_COMPACTED_SETTING, json.dumps(max(dropped)), time.time()))
+                        conn.commit()
+                        return len(dropped)
+            except Exception as e:
+                logger.error(f"Failed to clean up watch changes: {e}")
+                return 0
+
+    # Operation journal
+    JOURNAL_COLUMNS = ('id', 'app_name', 'operation', 'intent', 'steps', 'status', 'requested_by',
+                       'started_at', 'updated_at', 'finished_at', 'result')
+
+    def _journal_entry_from_row(self, row) -> Dict[str, Any]:
+        entry = dict(zip(self.JOURNAL_COLUMNS, row))
+        entry['app'] = entry.pop('app_name')
+        return entry
+
+    def save_journal_entry(self, entry: Dict[str, Any]) -> bool:
+        """Store a new operation journal entry."""
+        with self._lock:
+            try:
+                with self._get_connection(write=True) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('''
+                            INSERT INTO operation_journal (id, app_name, operation, intent, steps, status,
+                                                           requested_by, started_at, updated_at)
+                            VALUES (%s, %s, %s, %s, '[]', %s, %s, %s, %s)
+                        ''', (entry['id'], entry['app'], entry['operation'], json.dumps(entry['intent'], default=str),
+                              entry['status'], entry.get('requested_by'), entry['started_at'], entry['started_at']))
+                        conn.commit()
+                        return True
+            except Exception as e:
+                logger.error(f"Failed to save journal entry {entry.get('id')}: {e}")
+                return False
+
+    def append_journal_step(self, entry_id: str, step: Dict[str, Any]) -> bool:
+        """Record a completed step of a journaled operation."""
+        with self._lock:
+            try:
+                with self._get_connection(write=True) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute('''
+                            UPDATE operation_journal SET steps = steps || %s::jsonb, updated_at = %s
+                            WHERE id = %s
+                        ''', (json.dumps([step], default=str), time.time(), entry_id))
+                        conn.commit()
+                        return cursor.rowcount > 0
+            except Exception as e:
+                logger.error(f"Failed to record a step of journal entry {entry_id}: {e}")
+                return False
+
+    def finish_journal_entry(self, entry_id: str, status: str, result: Optional[Dict[str, Any]] = None) -> bool:
+        """Close a journal entry. Only entries still in progress are closed."""
+        with self._lock:
+            try:
+                with self._get_connection(write=True) as conn:
+                    with conn.cursor() as cursor:
+                        now = time.time()
+                        cursor.execute('''
+                            UPDATE operation_journal SET status = %s, result = %s, updated_at = %s, finished_at = %s
+                            WHERE id = %s AND status = 'in_progress'
+                        ''', (status, json.dumps(result, default=str) if result is not None else None,
+                              now, now, entry_id))
+                        conn.commit()
+                        return cursor.rowcount > 0
+            except Exception as e:
+                logger.error(f"Failed to finish journal entry {entry_id}: {e}")
+                return False
+
+    def list_journal_entries(self, app_name: Optional[str] = None, status: Optional[str] = None,
+                             limit: int = 100, oldest_first: bool = False) -> List[Dict[str, Any]]:
+        """List journal entries, newest first unless oldest_first, optionally for one app or status."""
+        with self._lock:
+            try:
+                with self._get_connection(write=False) as conn:
+                    with conn.cursor() as cursor:
+                        query = f"SELECT {', '.join(self.JOURNAL_COLUMNS)} FROM operation_journal"
+                        conditions, params = [], []
+                        if app_name:
+                            conditions.append('app_name = %s')
+                            params.append(app_name)
+                        if status:
+                            conditions.append('status = %s')
+                            params.append(status)
+                        if conditions:
+                            query += ' WHERE ' + ' AND '.join(conditions)
+                        query += f" ORDER BY started_at {'ASC' if oldest_first else 'DESC'} LIMIT %s"
+                        params.append(limit)
+                        cursor.execute(query, params)
+                        return [self._journal_entry_from_row(row) for row in cursor.fetchall()]
+            except Exception as e:
+                logger.error(f"Failed to list journal entries: {e}")
+                return []
+
+    def cleanup_journal_entries(self, before: float) -> int:
+        """Drop finished journal entries that ended before `before`."""
+        with self._lock:
+            try:
+                with self._get_connection(write=True) as conn:
+                    with conn.cursor() as cursor:
+                        cursor.execute("DELETE FROM operation_journal WHERE status != 'in_progress' AND finished_at < %s",
+                                       (before,))
+                        conn.commit()
+                        return cursor.rowcount
+            except Exception as e:
+                logger.error(f"Failed to clean up the operation journal: {e}")
+                return 0
+
     # Cleanup and maintenance
     def cleanup_old_events(self, days: int = 30) -> int:
         """Clean up old events."""
@@ -899,15 +2389,17 @@ class PostgreSQLManager:
             self._replica_pool.closeall()
         logger.info("🔒 Database connections closed")
         
-    def log_event(self, app_name: str, event_type: str, details: Dict[str, Any] = None):
-        """Log an event (compatibility method)."""
+    def log_event(self, app_name: str, event_type: str, details: Dict[str, Any] = None,
+                  severity: Optional[str] = None, message: Optional[str] = None):
+        """Log an event (compatibility method). The severity defaults to the event type's usual one."""
         event = EventRecord(
             id=None,
             app_name=app_name,
             event_type=event_type,
-            message=event_type,
+            message=message or event_type,
             timestamp=time.time(),
-            details=details
+            details=details,
+            severity=severity if severity in SEVERITIES else EVENT_SEVERITIES.get(event_type, "info")
         )
         self.add_event(event)
         
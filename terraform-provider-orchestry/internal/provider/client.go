@@ -0,0 +1,250 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Registering an app pulls its image, so writes can take a while.
+const requestTimeout = 10 * time.Minute
+
+// Client talks to the controller's /v1 API.
+type Client struct {
+	endpoint       string
+	adminToken     string
+	user           string
+	overrideReason string
+	http           *http.Client
+
+	writeOnce sync.Once
+	writeURL  string
+}
+
+// APIError is a non-2xx reply from the controller.
+type APIError struct {
+	StatusCode int
+	Detail     string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("orchestry API returned %d: %s", e.StatusCode, e.Detail)
+}
+
+func isNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// App is an app as returned by GET /v1/apps/{name}.
+type App struct {
+	Name          string         `json:"name"`
+	Namespace     string         `json:"namespace"`
+	Revision      int            `json:"revision"`
+	Spec          map[string]any `json:"spec"`
+	Status        string         `json:"status"`
+	Running       bool           `json:"running"`
+	Replicas      int            `json:"replicas"`
+	ReadyReplicas int            `json:"ready_replicas"`
+	Mode          string         `json:"mode"`
+}
+
+// Policy is an app's scaling policy, keyed by the spec's camelCase field names.
+type Policy struct {
+	App    string         `json:"app"`
+	Policy map[string]any `json:"policy"`
+	Custom bool           `json:"custom"`
+}
+
+// Secret is a secret's metadata; values are never returned.
+type Secret struct {
+	Name      string  `json:"name"`
+	CreatedAt float64 `json:"created_at"`
+	UpdatedAt float64 `json:"updated_at"`
+}
+
+func NewClient(endpoint, adminToken, user, overrideReason string) *Client {
+	return &Client{
+		endpoint:       strings.TrimRight(endpoint, "/"),
+		adminToken:     adminToken,
+		user:           user,
+		overrideReason: overrideReason,
+		http:           &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// leaderURL returns the write endpoint the cluster leader advertises in /health,
+// falling back to the configured endpoint.
+func (c *Client) leaderURL(ctx context.Context) string {
+	c.writeOnce.Do(func() {
+		c.writeURL = c.endpoint
+		var health struct {
+			Leader *struct {
+				AdvertiseURL string `json:"advertise_url"`
+			} `json:"leader"`
+		}
+		if err := c.send(ctx, http.MethodGet, c.endpoint+"/health", nil, &health); err != nil {
+			return
+		}
+		if health.Leader == nil || health.Leader.AdvertiseURL == "" {
+			return
+		}
+		advertised := strings.TrimRight(health.Leader.AdvertiseURL, "/")
+		if advertised != c.endpoint && c.send(ctx, http.MethodGet, advertised+"/health", nil, nil) == nil {
+			c.writeURL = advertised
+		}
+	})
+	return c.writeURL
+}
+
+func (c *Client) get(ctx context.Context, path string, out any) error {
+	return c.send(ctx, http.MethodGet, c.endpoint+path, nil, out)
+}
+
+func (c *Client) write(ctx context.Context, method, path string, body, out any) error {
+	return c.send(ctx, method, c.leaderURL(ctx)+path, body, out)
+}
+
+func (c *Client) send(ctx context.Context, method, target string, body, out any) error {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.user != "" {
+		req.Header.Set("X-Orchestry-User", c.user)
+	}
+	if c.adminToken != "" {
+		req.Header.Set("X-Admin-Token", c.adminToken)
+	}
+	if c.overrideReason != "" {
+		req.Header.Set("X-Override-Reason", c.overrideReason)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode == http.StatusAccepted {
+		var pending struct {
+			Message   string `json:"message"`
+			Operation struct {
+				ID string `json:"id"`
+			} `json:"operation"`
+		}
+		_ = json.Unmarshal(data, &pending)
+		return fmt.Errorf("change is waiting for approval as operation %s (%s); run apply again once it is approved",
+			pending.Operation.ID, pending.Message)
+	}
+	if resp.StatusCode >= 300 {
+		return &APIError{StatusCode: resp.StatusCode, Detail: errorDetail(data)}
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// errorDetail extracts FastAPI's "detail", which is a string or a list of validation errors.
+func errorDetail(data []byte) string {
+	var reply struct {
+		Detail json.RawMessage `json:"detail"`
+	}
+	if err := json.Unmarshal(data, &reply); err != nil || len(reply.Detail) == 0 {
+		return strings.TrimSpace(string(data))
+	}
+	var detail string
+	if err := json.Unmarshal(reply.Detail, &detail); err == nil {
+		return detail
+	}
+	return string(reply.Detail)
+}
+
+func (c *Client) GetApp(ctx context.Context, name string) (*App, error) {
+	var app App
+	if err := c.get(ctx, "/v1/apps/"+url.PathEscape(name), &app); err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+func (c *Client) PutApp(ctx context.Context, name string, spec map[string]any, running bool) (*App, error) {
+	var app App
+	body := map[string]any{"spec": spec, "running": running}
+	if err := c.write(ctx, http.MethodPut, "/v1/apps/"+url.PathEscape(name), body, &app); err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+func (c *Client) DeleteApp(ctx context.Context, name string) error {
+	return c.write(ctx, http.MethodDelete, "/v1/apps/"+url.PathEscape(name), nil, nil)
+}
+
+func (c *Client) GetPolicy(ctx context.Context, app string) (*Policy, error) {
+	var policy Policy
+	if err := c.get(ctx, "/v1/apps/"+url.PathEscape(app)+"/policy", &policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (c *Client) PutPolicy(ctx context.Context, app string, fields map[string]any) (*Policy, error) {
+	var policy Policy
+	body := map[string]any{"policy": fields}
+	if err := c.write(ctx, http.MethodPut, "/v1/apps/"+url.PathEscape(app)+"/policy", body, &policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (c *Client) DeletePolicy(ctx context.Context, app string) error {
+	return c.write(ctx, http.MethodDelete, "/v1/apps/"+url.PathEscape(app)+"/policy", nil, nil)
+}
+
+func (c *Client) GetSecret(ctx context.Context, name string) (*Secret, error) {
+	var secret Secret
+	if err := c.get(ctx, "/v1/secrets/"+url.PathEscape(name), &secret); err != nil {
+		return nil, err
+	}
+	return &secret, nil
+}
+
+func (c *Client) PutSecret(ctx context.Context, name, value string) (*Secret, error) {
+	var secret Secret
+	body := map[string]any{"value": value}
+	if err := c.write(ctx, http.MethodPut, "/v1/secrets/"+url.PathEscape(name), body, &secret); err != nil {
+		return nil, err
+	}
+	return &secret, nil
+}
+
+func (c *Client) DeleteSecret(ctx context.Context, name string) error {
+	return c.write(ctx, http.MethodDelete, "/v1/secrets/"+url.PathEscape(name), nil, nil)
+}
@@ -0,0 +1,51 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func dataSourceApp() *schema.Resource {
+	return &schema.Resource{
+		Description: "Reads an Orchestry app, e.g. one registered by another pipeline.",
+		ReadContext: dataSourceAppRead,
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"spec": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The spec the app was last registered with, as JSON.",
+			},
+			"running":        {Type: schema.TypeBool, Computed: true},
+			"namespace":      {Type: schema.TypeString, Computed: true},
+			"revision":       {Type: schema.TypeInt, Computed: true},
+			"status":         {Type: schema.TypeString, Computed: true},
+			"replicas":       {Type: schema.TypeInt, Computed: true},
+			"ready_replicas": {Type: schema.TypeInt, Computed: true},
+			"mode":           {Type: schema.TypeString, Computed: true},
+		},
+	}
+}
+
+func dataSourceAppRead(ctx context.Context, d *schema.ResourceData, meta any) diag.Diagnostics {
+	client := meta.(*Client)
+	name := d.Get("name").(string)
+	app, err := client.GetApp(ctx, name)
+	if err != nil {
+		return diag.Errorf("reading app %s: %s", name, err)
+	}
+
+	d.SetId(app.Name)
+	if diags := setAppState(d, app, true); diags.HasError() {
+		return diags
+	}
+	if err := d.Set("mode", app.Mode); err != nil {
+		return diag.FromErr(err)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+// Package provider implements the Orchestry Terraform provider on top of the
+// controller's /v1 API.
+package provider
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// New returns the provider definition.
+func New() *schema.Provider {
+	return &schema.Provider{
+		Schema: map[string]*schema.Schema{
+			"endpoint": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("ORCHESTRY_URL", "http://localhost:8000"),
+				Description: "Controller API URL. Writes go to the leader it advertises. Defaults to ORCHESTRY_URL.",
+			},
+			"admin_token": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
+				DefaultFunc: schema.EnvDefaultFunc("ORCHESTRY_ADMIN_TOKEN", nil),
+				Description: "Admin token, needed for secrets. Defaults to ORCHESTRY_ADMIN_TOKEN.",
+			},
+			"user": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("ORCHESTRY_USER", "terraform"),
+				Description: "Name changes are recorded under in the event log and approvals. Defaults to ORCHESTRY_USER or terraform.",
+			},
+			"override_reason": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("ORCHESTRY_OVERRIDE_REASON", nil),
+				Description: "Audit reason for applying changes during a deployment freeze window. Defaults to ORCHESTRY_OVERRIDE_REASON.",
+			},
+		},
+		ResourcesMap: map[string]*schema.Resource{
+			"orchestry_app":        resourceApp(),
+			"orchestry_app_policy": resourceAppPolicy(),
+			"orchestry_secret":     resourceSecret(),
+		},
+		DataSourcesMap: map[string]*schema.Resource{
+			"orchestry_app": dataSourceApp(),
+		},
+		ConfigureContextFunc: configure,
+	}
+}
+
+func configure(_ context.Context, d *schema.ResourceData) (any, diag.Diagnostics) {
+	return NewClient(
+		d.Get("endpoint").(string),
+		d.Get("admin_token").(string),
+		d.Get("user").(string),
+		d.Get("override_reason").(string),
+	), nil
+}
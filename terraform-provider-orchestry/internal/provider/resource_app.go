@@ -0,0 +1,138 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/structure"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+func resourceApp() *schema.Resource {
+	return &schema.Resource{
+		Description:   "An Orchestry app, registered from a spec.",
+		CreateContext: resourceAppApply,
+		ReadContext:   resourceAppRead,
+		UpdateContext: resourceAppApply,
+		DeleteContext: resourceAppDelete,
+		Importer: &schema.ResourceImporter{
+			StateContext: schema.ImportStatePassthroughContext,
+		},
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(requestTimeout),
+			Update: schema.DefaultTimeout(requestTimeout),
+		},
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "App name. Must match metadata.name in the spec.",
+			},
+			"spec": {
+				Type:             schema.TypeString,
+				Required:         true,
+				ValidateFunc:     validation.StringIsJSON,
+				DiffSuppressFunc: structure.SuppressJsonDiff,
+				Description:      "The app spec as JSON, e.g. jsonencode(yamldecode(file(\"app.yml\"))).",
+			},
+			"running": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+				Description: "Whether the app should be running.",
+			},
+			"namespace": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"revision": {
+				Type:        schema.TypeInt,
+				Computed:    true,
+				Description: "Spec revision the controller recorded for the last registration.",
+			},
+			"status": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"replicas": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"ready_replicas": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func resourceAppApply(ctx context.Context, d *schema.ResourceData, meta any) diag.Diagnostics {
+	client := meta.(*Client)
+	name := d.Get("name").(string)
+
+	var spec map[string]any
+	if err := json.Unmarshal([]byte(d.Get("spec").(string)), &spec); err != nil {
+		return diag.Errorf("spec is not a JSON object: %s", err)
+	}
+
+	app, err := client.PutApp(ctx, name, spec, d.Get("running").(bool))
+	if err != nil {
+		return diag.Errorf("applying app %s: %s", name, err)
+	}
+	d.SetId(app.Name)
+	return setAppState(d, app, false)
+}
+
+func resourceAppRead(ctx context.Context, d *schema.ResourceData, meta any) diag.Diagnostics {
+	client := meta.(*Client)
+	app, err := client.GetApp(ctx, d.Id())
+	if isNotFound(err) {
+		d.SetId("")
+		return nil
+	}
+	if err != nil {
+		return diag.Errorf("reading app %s: %s", d.Id(), err)
+	}
+
+	// A new revision means the app was registered outside Terraform (or imported);
+	// show its spec so the plan puts ours back.
+	changed := d.Get("revision").(int) != app.Revision
+	return setAppState(d, app, changed)
+}
+
+func resourceAppDelete(ctx context.Context, d *schema.ResourceData, meta any) diag.Diagnostics {
+	client := meta.(*Client)
+	if err := client.DeleteApp(ctx, d.Id()); err != nil && !isNotFound(err) {
+		return diag.Errorf("deleting app %s: %s", d.Id(), err)
+	}
+	return nil
+}
+
+func setAppState(d *schema.ResourceData, app *App, withSpec bool) diag.Diagnostics {
+	values := map[string]any{
+		"name":           app.Name,
+		"running":        app.Running,
+		"namespace":      app.Namespace,
+		"revision":       app.Revision,
+		"status":         app.Status,
+		"replicas":       app.Replicas,
+		"ready_replicas": app.ReadyReplicas,
+	}
+	if withSpec {
+		spec, err := json.Marshal(app.Spec)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		values["spec"] = string(spec)
+	}
+	for key, value := range values {
+		if err := d.Set(key, value); err != nil {
+			return diag.FromErr(fmt.Errorf("setting %s: %w", key, err))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+// policyField maps a Terraform attribute to its field in the spec's scaling section.
+type policyField struct {
+	attr        string
+	api         string
+	kind        schema.ValueType
+	description string
+}
+
+var policyFields = []policyField{
+	{"mode", "mode", schema.TypeString, "auto or manual."},
+	{"min_replicas", "minReplicas", schema.TypeInt, "Fewest replicas the autoscaler keeps."},
+	{"max_replicas", "maxReplicas", schema.TypeInt, "Most replicas the autoscaler starts."},
+	{"target_rps_per_replica", "targetRPSPerReplica", schema.TypeInt, "Requests per second each replica should handle."},
+	{"max_p95_latency_ms", "maxP95LatencyMs", schema.TypeInt, "p95 latency above which the app scales out."},
+	{"scale_out_threshold_pct", "scaleOutThresholdPct", schema.TypeInt, "Load, as a percentage of the targets, that triggers a scale-out."},
+	{"scale_in_threshold_pct", "scaleInThresholdPct", schema.TypeInt, "Load, as a percentage of the targets, below which the app scales in."},
+	{"window_seconds", "windowSeconds", schema.TypeInt, "Metrics window evaluated for each decision."},
+	{"cooldown_seconds", "cooldownSeconds", schema.TypeInt, "Minimum time between scaling actions."},
+	{"saturation_error_rate_pct", "saturationErrorRatePct", schema.TypeFloat, "Share of 502/504s that triggers an immediate scale-out (0 disables)."},
+	{"saturation_scale_factor", "saturationScaleFactor", schema.TypeFloat, "Replicas are multiplied by this on saturation."},
+	{"saturation_cooldown_seconds", "saturationCooldownSeconds", schema.TypeInt, "Minimum time between saturation scale-outs."},
+	{"evaluation_interval_seconds", "evaluationIntervalSeconds", schema.TypeInt, "Seconds between scaling evaluations."},
+}
+
+func resourceAppPolicy() *schema.Resource {
+	fields := map[string]*schema.Schema{
+		"app": {
+			Type:        schema.TypeString,
+			Required:    true,
+			ForceNew:    true,
+			Description: "Name of the app the policy applies to.",
+		},
+		"custom": {
+			Type:        schema.TypeBool,
+			Computed:    true,
+			Description: "False when every field has its default value.",
+		},
+	}
+	for _, field := range policyFields {
+		fields[field.attr] = &schema.Schema{
+			Type:        field.kind,
+			Optional:    true,
+			Computed:    true,
+			Description: field.description + " Defaults to the controller's default when not set.",
+		}
+	}
+	fields["mode"].ValidateFunc = validation.StringInSlice([]string{"auto", "manual"}, false)
+
+	return &schema.Resource{
+		Description: "The scaling policy of an Orchestry app. Do not also set `scaling` in the app's spec: " +
+			"registering the spec replaces the policy.",
+		CreateContext: resourceAppPolicyApply,
+		ReadContext:   resourceAppPolicyRead,
+		UpdateContext: resourceAppPolicyApply,
+		DeleteContext: resourceAppPolicyDelete,
+		Importer: &schema.ResourceImporter{
+			StateContext: schema.ImportStatePassthroughContext,
+		},
+		Schema: fields,
+	}
+}
+
+func resourceAppPolicyApply(ctx context.Context, d *schema.ResourceData, meta any) diag.Diagnostics {
+	client := meta.(*Client)
+	app := d.Get("app").(string)
+
+	// Only send what the configuration sets; the controller fills in the defaults
+	config := d.GetRawConfig()
+	body := map[string]any{}
+	for _, field := range policyFields {
+		if !config.GetAttr(field.attr).IsNull() {
+			body[field.api] = d.Get(field.attr)
+		}
+	}
+
+	policy, err := client.PutPolicy(ctx, app, body)
+	if err != nil {
+		return diag.Errorf("setting scaling policy of %s: %s", app, err)
+	}
+	d.SetId(app)
+	return setPolicyState(d, policy)
+}
+
+func resourceAppPolicyRead(ctx context.Context, d *schema.ResourceData, meta any) diag.Diagnostics {
+	client := meta.(*Client)
+	policy, err := client.GetPolicy(ctx, d.Id())
+	if isNotFound(err) {
+		d.SetId("")
+		return nil
+	}
+	if err != nil {
+		return diag.Errorf("reading scaling policy of %s: %s", d.Id(), err)
+	}
+	return setPolicyState(d, policy)
+}
+
+func resourceAppPolicyDelete(ctx context.Context, d *schema.ResourceData, meta any) diag.Diagnostics {
+	client := meta.(*Client)
+	if err := client.DeletePolicy(ctx, d.Id()); err != nil && !isNotFound(err) {
+		return diag.Errorf("resetting scaling policy of %s: %s", d.Id(), err)
+	}
+	return nil
+}
+
+func setPolicyState(d *schema.ResourceData, policy *Policy) diag.Diagnostics {
+	if err := d.Set("app", policy.App); err != nil {
+		return diag.FromErr(err)
+	}
+	if err := d.Set("custom", policy.Custom); err != nil {
+		return diag.FromErr(err)
+	}
+	for _, field := range policyFields {
+		value := policy.Policy[field.api]
+		// JSON numbers decode as float64
+		if number, ok := value.(float64); ok && field.kind == schema.TypeInt {
+			value = int(number)
+		}
+		if err := d.Set(field.attr, value); err != nil {
+			return diag.FromErr(fmt.Errorf("setting %s: %w", field.attr, err))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func resourceSecret() *schema.Resource {
+	return &schema.Resource{
+		Description:   "A secret app specs can reference, e.g. an htpasswd file for edge auth. Needs admin_token.",
+		CreateContext: resourceSecretApply,
+		ReadContext:   resourceSecretRead,
+		UpdateContext: resourceSecretApply,
+		DeleteContext: resourceSecretDelete,
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"value": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Sensitive:   true,
+				Description: "The secret value. The controller never returns it, so it is only compared with Terraform's state.",
+			},
+			"updated_at": {
+				Type:        schema.TypeFloat,
+				Computed:    true,
+				Description: "Unix time the controller last stored the secret.",
+			},
+		},
+	}
+}
+
+func resourceSecretApply(ctx context.Context, d *schema.ResourceData, meta any) diag.Diagnostics {
+	client := meta.(*Client)
+	name := d.Get("name").(string)
+	secret, err := client.PutSecret(ctx, name, d.Get("value").(string))
+	if err != nil {
+		return diag.Errorf("storing secret %s: %s", name, err)
+	}
+	d.SetId(secret.Name)
+	if err := d.Set("updated_at", secret.UpdatedAt); err != nil {
+		return diag.FromErr(err)
+	}
+	return nil
+}
+
+func resourceSecretRead(ctx context.Context, d *schema.ResourceData, meta any) diag.Diagnostics {
+	client := meta.(*Client)
+	secret, err := client.GetSecret(ctx, d.Id())
+	if isNotFound(err) {
+		d.SetId("")
+		return nil
+	}
+	if err != nil {
+		return diag.Errorf("reading secret %s: %s", d.Id(), err)
+	}
+
+	// Stored again outside Terraform: forget our value so the plan writes it back
+	if secret.UpdatedAt > d.Get("updated_at").(float64) {
+		if err := d.Set("value", ""); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+	if err := d.Set("name", secret.Name); err != nil {
+		return diag.FromErr(err)
+	}
+	if err := d.Set("updated_at", secret.UpdatedAt); err != nil {
+		return diag.FromErr(err)
+	}
+	return nil
+}
+
+func resourceSecretDelete(ctx context.Context, d *schema.ResourceData, meta any) diag.Diagnostics {
+	client := meta.(*Client)
+	if err := client.DeleteSecret(ctx, d.Id()); err != nil && !isNotFound(err) {
+		return diag.Errorf("deleting secret %s: %s", d.Id(), err)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+// Command terraform-provider-orchestry is a Terraform provider that manages
+// Orchestry apps, scaling policies and secrets through the controller's
+// stable /v1 API.
+package main
+
+import (
+	"flag"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/plugin"
+
+	"github.com/arjuuuuunnnnn/Orchestry/terraform-provider-orchestry/internal/provider"
+)
+
+func main() {
+	var debug bool
+	flag.BoolVar(&debug, "debug", false, "run the provider with support for debuggers like delve")
+	flag.Parse()
+
+	plugin.Serve(&plugin.ServeOpts{
+		ProviderFunc: provider.New,
+		ProviderAddr: "registry.terraform.io/arjuuuuunnnnn/orchestry",
+		Debug:        debug,
+	})
+}
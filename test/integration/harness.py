@@ -0,0 +1,217 @@
+"""
+Integration test harness.
+Drives the ephemeral stack in docker-compose.yml (Postgres, a Docker-in-Docker
+daemon and two controllers) and gives scenarios a small API to work with:
+register/scale/wait for apps, find and kill the leader, and send traffic
+through nginx.
+"""
+
+import os
+import time
+import subprocess
+from contextlib import contextmanager
+from pathlib import Path
+from typing import Any, Dict, List, Optional
+
+import requests
+
+from cli.verify import DEFAULT_ECHO_IMAGE, echo_app_spec
+
+COMPOSE_FILE = Path(__file__).parent / "docker-compose.yml"
+NODES = {
+    "controller-1": f"http://localhost:{os.getenv('IT_CONTROLLER_1_PORT', '18001')}",
+    "controller-2": f"http://localhost:{os.getenv('IT_CONTROLLER_2_PORT', '18002')}",
+}
+NGINX_URL = f"http://localhost:{os.getenv('IT_NGINX_PORT', '18080')}"
+API_PREFIX = "/v1"
+# Seconds to wait for the stack to come up and for a new leader after failover
+STARTUP_TIMEOUT = int(os.getenv("IT_STARTUP_TIMEOUT", "300"))
+LEADER_TIMEOUT = int(os.getenv("IT_LEADER_TIMEOUT", "90"))
+
+class HarnessError(Exception):
+    """A harness step failed; the message says which one and why."""
+
+class Harness:
+    """Handle on a running integration stack."""
+
+    def __init__(self, timeout: int = 120, image: str = DEFAULT_ECHO_IMAGE):
+        self.timeout = timeout
+        self.image = image
+        self.stopped: List[str] = []
+
+    # Stack lifecycle
+
+    def compose(self, *args: str, check: bool = True) -> subprocess.CompletedProcess:
+        cmd = ["docker", "compose", "-f", str(COMPOSE_FILE), *args]
+        result = subprocess.run(cmd, capture_output=True, text=True)
+        if check and result.returncode != 0:
+            raise HarnessError(f"{' '.join(cmd)} failed: {result.stderr.strip()}")
+        return result
+
+    def up(self, build: bool = True):
+        args = ["up", "-d", "--wait"]
+        if build:
+            args.append("--build")
+        self.compose(*args)
+        self.wait_for_nodes(list(NODES), STARTUP_TIMEOUT)
+        self.wait_for_leader(STARTUP_TIMEOUT)
+
+    def down(self):
+        self.compose("down", "-v", "--remove-orphans", check=False)
+
+    def logs(self, service: Optional[str] = None, tail: int = 200) -> str:
+        args = ["logs", "--no-color", f"--tail={tail}"]
+        if service:
+            args.append(service)
+        return self.compose(*args, check=False).stdout
+
+    def kill_node(self, node: str):
+        self.compose("kill", node)
+        self.stopped.append(node)
+
+    def start_node(self, node: str):
+        self.compose("start", node)
+        if node in self.stopped:
+            self.stopped.remove(node)
+        self.wait_for_nodes([node], STARTUP_TIMEOUT)
+
+    def restore(self):
+        """Bring back nodes a scenario killed, so the next one starts from a full cluster."""
+        for node in list(self.stopped):
+            self.start_node(node)
+
+    # Controllers
+
+    def live_nodes(self) -> List[str]:
+        return [node for node in NODES if node not in self.stopped]
+
+    def wait_for_nodes(self, nodes: List[str], timeout: int):
+        deadline = time.time() + timeout
+        pending = list(nodes)
+        while pending and time.time() < deadline:
+            for node in list(pending):
+                try:
+                    if requests.get(f"{NODES[node]}/health", timeout=5).status_code == 200:
+                        pending.remove(node)
+                except requests.exceptions.RequestException:
+                    pass
+            if pending:
+                time.sleep(2)
+        if pending:
+            raise HarnessError(f"{', '.join(pending)} not healthy after {timeout}s")
+
+    def leader(self) -> Optional[str]:
+        """The node id of the current leader, as seen by any live node."""
+        for node in self.live_nodes():
+            try:
+                response = requests.get(f"{NODES[node]}{API_PREFIX}/cluster/leader", timeout=5)
+                if response.status_code == 200:
+                    return response.json().get("leader_id")
+            except requests.exceptions.RequestException:
+                continue
+        return None
+
+    def wait_for_leader(self, timeout: int = LEADER_TIMEOUT, exclude: Optional[str] = None) -> str:
+        deadline = time.time() + timeout
+        while time.time() < deadline:
+            leader = self.leader()
+            if leader and leader != exclude and leader in self.live_nodes():
+                return leader
+            time.sleep(2)
+        raise HarnessError(f"no leader{f' other than {exclude}' if exclude else ''} after {timeout}s")
+
+    def url(self, node: Optional[str] = None) -> str:
+        """API base URL of a node; writes go to the leader by default."""
+        return f"{NODES[node or self.wait_for_leader()]}{API_PREFIX}"
+
+    def request(self, method: str, path: str, node: Optional[str] = None,
+                expect: int = 200, **kwargs) -> Any:
+        kwargs.setdefault("timeout", self.timeout)
+        response = requests.request(method, f"{self.url(node)}{path}", **kwargs)
+        if response.status_code != expect:
+            try:
+                error = response.json().get("error", {})
+                detail = f"{error.get('message')} [{error.get('code')}]" if error else response.text
+            except ValueError:
+                detail = response.text
+            raise HarnessError(f"{method} {path} returned {response.status_code}, expected {expect}: {detail}")
+        return response.json() if response.content else None
+
+    # Apps
+
+    def app_spec(self, name: str) -> Dict[str, Any]:
+        """The echo app spec verify uses, labelled for the integration tests."""
+        spec = echo_app_spec(name, self.image)
+        spec["metadata"]["labels"]["managed-by"] = "orchestry-it"
+        return spec
+
+    def register(self, spec: Dict[str, Any]) -> Dict[str, Any]:
+        return self.request("POST", "/apps/register", json=spec)
+
+    def start(self, name: str) -> Dict[str, Any]:
+        return self.request("POST", f"/apps/{name}/up")
+
+    def scale(self, name: str, replicas: int) -> Dict[str, Any]:
+        return self.request("POST", f"/apps/{name}/scale", json={"replicas": replicas})
+
+    def status(self, name: str, node: Optional[str] = None) -> Dict[str, Any]:
+        return self.request("GET", f"/apps/{name}/status", node=node or self.live_nodes()[0])
+
+    def delete(self, name: str):
+        try:
+            self.request("POST", f"/apps/{name}/down")
+        except HarnessError:
+            pass
+        self.request("DELETE", f"/apps/{name}", timeout=self.timeout)
+
+    def wait_ready(self, name: str, replicas: int, timeout: Optional[int] = None) -> Dict[str, Any]:
+        timeout = timeout or self.timeout
+        deadline = time.time() + timeout
+        status: Dict[str, Any] = {}
+        while time.time() < deadline:
+            try:
+                status = self.status(name)
+                if status.get("ready_replicas", 0) >= replicas:
+                    return status
+            except (HarnessError, requests.exceptions.RequestException):
+                pass
+            time.sleep(2)
+        raise HarnessError(
+            f"{name}: {status.get('ready_replicas', 0)}/{replicas} replicas ready after {timeout}s"
+        )
+
+    def wait_routed(self, attempts: int = 5, timeout: Optional[int] = None) -> int:
+        """Send requests through nginx until all of them get a 200. Returns how many did."""
+        timeout = timeout or self.timeout
+        deadline = time.time() + timeout
+        ok = 0
+        while time.time() < deadline:
+            ok = 0
+            for _ in range(attempts):
+                try:
+                    if requests.get(f"{NGINX_URL}/", timeout=5).status_code == 200:
+                        ok += 1
+                except requests.exceptions.RequestException:
+                    pass
+            if ok == attempts:
+                return ok
+            time.sleep(2)
+        raise HarnessError(f"only {ok}/{attempts} requests through nginx succeeded after {timeout}s")
+
+    @contextmanager
+    def app(self, name: str, replicas: int = 1, spec: Optional[Dict[str, Any]] = None):
+        """Register and start an app, wait for it to be ready, and delete it afterwards."""
+        spec = spec or self.app_spec(name)
+        self.register(spec)
+        try:
+            self.start(name)
+            if replicas > 1:
+                self.scale(name, replicas)
+            self.wait_ready(name, replicas)
+            yield spec
+        finally:
+            try:
+                self.restore()
+                self.delete(name)
+            except Exception:
+                pass
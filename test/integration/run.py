@@ -0,0 +1,68 @@
+#!/usr/bin/env python3
+"""
+Run the integration scenarios against the ephemeral stack.
+
+    python3 test/integration/run.py                    # all scenarios
+    python3 test/integration/run.py leader-failover    # just one
+    python3 test/integration/run.py --keep             # leave the stack running
+
+Exits 1 if any scenario fails. Needs Docker with the compose plugin.
+"""
+
+import sys
+import time
+import argparse
+from pathlib import Path
+
+# Scenarios import cli.verify from the repository root
+sys.path.insert(0, str(Path(__file__).resolve().parents[2]))
+sys.path.insert(0, str(Path(__file__).resolve().parent))
+
+from harness import Harness  # noqa: E402
+from scenarios import SCENARIOS  # noqa: E402
+
+def main() -> int:
+    parser = argparse.ArgumentParser(description="Orchestry integration tests")
+    parser.add_argument("scenarios", nargs="*", help=f"Scenarios to run (default: all of {', '.join(SCENARIOS)})")
+    parser.add_argument("--keep", action="store_true", help="Leave the stack running afterwards")
+    parser.add_argument("--no-up", action="store_true", help="Use an already running stack (make integration-up)")
+    parser.add_argument("--no-build", action="store_true", help="Don't rebuild the controller image")
+    parser.add_argument("--timeout", type=int, default=120, help="Seconds to wait for each app step")
+    args = parser.parse_args()
+
+    unknown = [name for name in args.scenarios if name not in SCENARIOS]
+    if unknown:
+        print(f"Unknown scenario(s): {', '.join(unknown)}. Available: {', '.join(SCENARIOS)}")
+        return 2
+    selected = args.scenarios or list(SCENARIOS)
+
+    harness = Harness(timeout=args.timeout)
+    failed = []
+    try:
+        if not args.no_up:
+            print("Starting integration stack...")
+            harness.up(build=not args.no_build)
+        for name in selected:
+            start = time.time()
+            try:
+                detail = SCENARIOS[name](harness)
+                print(f"PASS {name} ({time.time() - start:.1f}s) {detail or ''}")
+            except Exception as e:
+                failed.append(name)
+                print(f"FAIL {name} ({time.time() - start:.1f}s) {e}")
+                print(harness.logs(tail=50))
+            finally:
+                harness.restore()
+    except Exception as e:
+        print(f"Integration stack failed: {e}")
+        print(harness.logs(tail=100))
+        return 1
+    finally:
+        if not args.keep and not args.no_up:
+            harness.down()
+
+    print(f"{len(selected) - len(failed)}/{len(selected)} scenario(s) passed")
+    return 1 if failed else 0
+
+if __name__ == "__main__":
+    sys.exit(main())
@@ -0,0 +1,53 @@
+"""
+Integration scenarios.
+Each scenario is a function taking the Harness, decorated with @scenario. It
+raises (usually HarnessError or AssertionError) to fail and returns a short
+summary when it passes. Apps should be created with `harness.app(...)` so they
+are cleaned up even when the scenario fails.
+"""
+
+import uuid
+from typing import Callable, Dict
+
+from harness import Harness, HarnessError, LEADER_TIMEOUT
+
+SCENARIOS: Dict[str, Callable[[Harness], str]] = {}
+
+def scenario(fn: Callable[[Harness], str]) -> Callable[[Harness], str]:
+    """Register a scenario under its function name, with dashes for underscores."""
+    SCENARIOS[fn.__name__.replace("_", "-")] = fn
+    return fn
+
+def app_name(prefix: str) -> str:
+    return f"it-{prefix}-{uuid.uuid4().hex[:6]}"
+
+@scenario
+def register_scale_health(harness: Harness) -> str:
+    name = app_name("scale")
+    with harness.app(name):
+        harness.scale(name, 2)
+        status = harness.wait_ready(name, 2)
+        harness.wait_routed()
+        harness.scale(name, 1)
+        scaled_in = harness.wait_ready(name, 1)
+        assert scaled_in.get("replicas", 0) <= 2, f"expected at most 2 replicas after scaling in, got {scaled_in}"
+        return f"{name}: scaled 1 -> 2 -> 1, {status['ready_replicas']} ready at peak, routed through nginx"
+
+@scenario
+def leader_failover(harness: Harness) -> str:
+    name = app_name("failover")
+    with harness.app(name, replicas=2):
+        old_leader = harness.wait_for_leader()
+        harness.kill_node(old_leader)
+        new_leader = harness.wait_for_leader(LEADER_TIMEOUT, exclude=old_leader)
+
+        # The new leader serves the app state and accepts writes
+        status = harness.wait_ready(name, 2)
+        harness.scale(name, 1)
+        harness.wait_ready(name, 1)
+        harness.wait_routed()
+
+        harness.start_node(old_leader)
+        if harness.wait_for_leader() not in (old_leader, new_leader):
+            raise HarnessError("leadership moved to an unknown node after the old leader rejoined")
+        return f"{old_leader} killed, {new_leader} took over with {status['ready_replicas']} replica(s) ready"
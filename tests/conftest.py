@@ -0,0 +1,141 @@
+import copy
+import os
+import sys
+
+import pytest
+
+# Tests import the controller and state packages from the repository root
+sys.path.insert(0, os.path.dirname(os.path.dirname(os.path.abspath(__file__))))
+
+from controller.loadbalancer import FakeLoadBalancer
+from controller.manager import AppManager
+from controller.runtime import FakeRuntime
+
+
+class MemoryStateStore:
+    """The part of StateStore the app manager uses, kept in memory. Only methods the
+    tests exercise are here, so a new call into the store fails loudly."""
+
+    def __init__(self):
+        self.apps = {}
+        self.revisions = {}  # app_name -> list of revisions, oldest first
+        self.instances = {}  # container_id -> InstanceRecord
+        self.events = []
+        self.status_history = []
+        self.settings = {}
+        self.namespaces = {}
+        self.journal = {}  # entry ID -> entry
+
+    def get_app(self, name):
+        return copy.deepcopy(self.apps.get(name))
+
+    def save_app(self, app_record):
+        self.apps[app_record.name] = copy.deepcopy(app_record)
+        return True
+
+    def list_apps(self, status=None, team=None, owner=None, namespace=None):
+        return [{"name": record.name, "spec": record.spec, "status": record.status,
+                 "replicas": record.replicas, "mode": record.mode, "namespace": record.namespace}
+                for record in self.apps.values() if status is None or record.status == status]
+
+    def delete_app(self, name):
+        for container_id in [i.container_id for i in self.instances.values() if i.app_name == name]:
+            del self.instances[container_id]
+        return self.apps.pop(name, None) is not None
+
+    def purge_app(self, name):
+        if name not in self.apps:
+            return False
+        self.revisions.pop(name, None)
+        self.journal = {key: entry for key, entry in self.journal.items() if entry["app"] != name}
+        return self.delete_app(name)
+
+    def save_app_revision(self, app_name, spec, source=None):
+        revisions = self.revisions.setdefault(app_name, [])
+        revisions.append({"app": app_name, "revision": len(revisions) + 1, "spec": copy.deepcopy(spec),
+                          "source": source, "created_at": 0.0})
+        return len(revisions)
+
+    def get_app_revision(self, app_name, revision=None):
+        revisions = self.revisions.get(app_name) or []
+        if revision is None:
+            return revisions[-1] if revisions else None
+        return next((r for r in revisions if r["revision"] == revision), None)
+
+    def save_instance(self, instance):
+        self.instances[instance.container_id] = copy.deepcopy(instance)
+        return True
+
+    def get_instances(self, app_name, status=None):
+        return [copy.deepcopy(i) for i in self.instances.values()
+                if i.app_name == app_name and (status is None or i.status == status)]
+
+    def delete_instance(self, container_id):
+        return self.instances.pop(container_id, None) is not None
+
+    def log_event(self, app_name, event_type, details=None, severity=None, message=None):
+        self.events.append({"app": app_name, "type": event_type, "details": details,
+                            "severity": severity, "message": message or event_type})
+
+    def add_status_transition(self, app_name, from_status, to_status, cause, details=None):
+        self.status_history.append({"app": app_name, "from": from_status, "to": to_status, "cause": cause})
+        return len(self.status_history)
+
+    def get_last_status(self, app_name):
+        return next((t["to"] for t in reversed(self.status_history) if t["app"] == app_name), None)
+
+    def get_setting(self, key, default=None):
+        return copy.deepcopy(self.settings.get(key, default))
+
+    def delete_setting(self, key):
+        return self.settings.pop(key, None) is not None
+
+    def get_namespace(self, name):
+        return copy.deepcopy(self.namespaces.get(name))
+
+    def save_journal_entry(self, entry):
+        self.journal[entry["id"]] = dict(copy.deepcopy(entry), steps=[], updated_at=entry["started_at"],
+                                         finished_at=None, result=None)
+        return True
+
+    def append_journal_step(self, entry_id, step):
+        if entry_id not in self.journal:
+            return False
+        self.journal[entry_id]["steps"].append(copy.deepcopy(step))
+        return True
+
+    def finish_journal_entry(self, entry_id, status, result=None):
+        entry = self.journal.get(entry_id)
+        if not entry or entry["status"] != "in_progress":
+            return False
+        entry.update(status=status, result=copy.deepcopy(result))
+        return True
+
+    def list_journal_entries(self, app_name=None, status=None, limit=100, oldest_first=False):
+        entries = [copy.deepcopy(e) for e in self.journal.values()
+                   if (app_name is None or e["app"] == app_name) and (status is None or e["status"] == status)]
+        entries.sort(key=lambda e: e["started_at"], reverse=not oldest_first)
+        return entries[:limit]
+
+    def cleanup_journal_entries(self, before):
+        return 0
+
+
+@pytest.fixture
+def state_store():
+    return MemoryStateStore()
+
+
+@pytest.fixture
+def runtime():
+    return FakeRuntime()
+
+
+@pytest.fixture
+def lb():
+    return FakeLoadBalancer()
+
+
+@pytest.fixture
+def manager(state_store, lb, runtime):
+    return AppManager(state_store, lb, runtime=runtime)
@@ -0,0 +1,122 @@
+"""Per-app operation locks: queueing, failing fast and timing out."""
+
+import threading
+import time
+
+from controller.app_locks import AppOperationLocks
+
+
+def _hold(locks, app_name, operation, started, release):
+    """Take the app's lock on another thread and keep it until release is set."""
+    def run():
+        entry, _ = locks.acquire(app_name, operation)
+        started.set()
+        release.wait(5)
+        locks.release(entry)
+    thread = threading.Thread(target=run)
+    thread.start()
+    assert started.wait(5)
+    return thread
+
+
+def test_waiters_run_in_arrival_order():
+    locks = AppOperationLocks()
+    started, release = threading.Event(), threading.Event()
+    holder = _hold(locks, "web", "scale", started, release)
+
+    order = []
+
+    def wait_for_lock(operation):
+        entry, blocked = locks.acquire("web", operation, timeout=5)
+        assert blocked is None
+        order.append(operation)
+        locks.release(entry)
+
+    waiters = []
+    for operation in ("stop", "start"):
+        waiter = threading.Thread(target=wait_for_lock, args=(operation,))
+        waiter.start()
+        waiters.append(waiter)
+        # Queued before the next one arrives
+        while len(locks.snapshot("web")["queued"]) < len(waiters):
+            time.sleep(0.01)
+
+    snapshot = locks.snapshot("web")
+    assert snapshot["active"]["operation"] == "scale"
+    assert [entry["operation"] for entry in snapshot["queued"]] == ["stop", "start"]
+
+    release.set()
+    for thread in [holder] + waiters:
+        thread.join(5)
+    assert order == ["stop", "start"]
+    assert locks.snapshot("web") == {"app": "web", "active": None, "queued": []}
+
+
+def test_fail_mode_reports_the_running_operation():
+    locks = AppOperationLocks()
+    started, release = threading.Event(), threading.Event()
+    holder = _hold(locks, "web", "deploy", started, release)
+
+    entry, blocked = locks.acquire("web", "scale", requested_by="alice", wait=False)
+    assert entry is None
+    assert blocked["operation"] == "deploy"
+    assert not any(key.startswith("_") for key in blocked)
+
+    # Other apps are not held up
+    other, none = locks.acquire("api", "scale", wait=False)
+    assert none is None
+    locks.release(other)
+
+    release.set()
+    holder.join(5)
+
+
+def test_queued_operation_times_out_and_leaves_the_queue():
+    locks = AppOperationLocks()
+    started, release = threading.Event(), threading.Event()
+    holder = _hold(locks, "web", "rollout", started, release)
+
+    began = time.time()
+    entry, blocked = locks.acquire("web", "scale", timeout=0.2)
+    assert entry is None
+    assert blocked["operation"] == "rollout"
+    assert time.time() - began >= 0.2
+    assert locks.snapshot("web")["queued"] == []
+
+    release.set()
+    holder.join(5)
+    entry, blocked = locks.acquire("web", "scale", wait=False)
+    assert blocked is None
+    locks.release(entry)
+
+
+def test_lock_is_reentrant_for_its_thread():
+    locks = AppOperationLocks()
+    outer, _ = locks.acquire("web", "rollout")
+    inner, blocked = locks.acquire("web", "scale", wait=False)
+    assert blocked is None and inner is outer
+    locks.release(inner)
+    assert locks.snapshot("web")["active"]["operation"] == "rollout"
+    locks.release(outer)
+    assert locks.snapshot("web")["active"] is None
+
+
+def test_manager_operation_fails_fast_while_the_app_is_busy(manager):
+    started, release = threading.Event(), threading.Event()
+
+    def deploy():
+        with manager.app_operation("web", "deploy", requested_by="bob"):
+            started.set()
+            release.wait(5)
+
+    holder = threading.Thread(target=deploy)
+    holder.start()
+    assert started.wait(5)
+
+    result = manager.scale("web", 3, wait=False)
+    assert result["error"] == "web is busy: deploy requested by bob is in progress"
+    assert result["active_operation"]["operation"] == "deploy"
+
+    release.set()
+    holder.join(5)
+    assert manager.active_operations("web")["active"] is None
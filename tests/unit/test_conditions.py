@@ -0,0 +1,77 @@
+"""App status conditions, from conditions.evaluate and as AppManager.status reports them."""
+
+import copy
+import time
+
+from controller import conditions
+
+SPEC = {
+    "apiVersion": "v1",
+    "kind": "App",
+    "metadata": {"name": "web"},
+    "spec": {"type": "http", "image": "nginx:alpine", "ports": [{"containerPort": 80}]},
+    "scaling": {"mode": "manual", "minReplicas": 1, "maxReplicas": 5}
+}
+LB_OK = {"configured": True, "reason": "Configured", "message": "2 server(s)", "at": 0.0}
+
+
+def _replica(state, container_id="c1", reason=None):
+    return {"container_id": container_id, "state": state, "state_reason": reason, "state_since": time.time() - 5}
+
+
+def _by_type(conds):
+    return {c["type"]: c for c in conds}
+
+
+def test_healthy_app():
+    conds = conditions.evaluate("web", "running", SPEC["spec"], 2,
+                                [_replica("ready", "c1"), _replica("ready", "c2")], lb_state=LB_OK)
+    assert [c["type"] for c in conds] == list(conditions.TYPES)
+    assert all(conditions.is_healthy(c) for c in conds)
+    assert _by_type(conds)["Degraded"]["reason"] == "AllReplicasReady"
+
+
+def test_stopped_app():
+    conds = _by_type(conditions.evaluate("web", "stopped", SPEC["spec"], 0, []))
+    assert conds["Available"]["status"] == "False"
+    assert conds["Available"]["reason"] == "Stopped"
+    # A stopped app is not degraded, it is just not meant to run
+    assert conds["Degraded"]["status"] == "False"
+    assert conds["LBConfigured"]["status"] == "False"
+
+
+def test_unhealthy_replica_degrades_but_keeps_the_app_available():
+    conds = _by_type(conditions.evaluate(
+        "web", "running", SPEC["spec"], 2,
+        [_replica("ready", "c1"), _replica("unhealthy", "c2", "3 failed checks")], lb_state=LB_OK
+    ))
+    assert conds["Available"]["status"] == "True"
+    assert conds["Degraded"]["status"] == "True"
+    assert conds["Degraded"]["reason"] == "ReplicasUnhealthy"
+    assert "c2 3 failed checks" in conds["Degraded"]["message"]
+
+
+def test_start_failure_stops_progress():
+    failure = {"reason": "image_not_found", "message": "No such image: web:9", "hint": "Check the image",
+               "since": 100.0, "attempts": 3}
+    conds = _by_type(conditions.evaluate("web", "running", SPEC["spec"], 1, [], failure=failure))
+    assert conds["Progressing"]["status"] == "False"
+    assert conds["Progressing"]["reason"] == "ImageNotFound"
+    assert conds["Progressing"]["attempts"] == 3
+    assert conds["Available"]["reason"] == "NoReplicas"
+
+
+def test_manager_status_reports_conditions(manager, runtime):
+    manager.register(copy.deepcopy(SPEC))
+    assert _by_type(manager.status("web")["conditions"])["Available"]["reason"] == "Stopped"
+
+    manager.start("web")
+    conds = _by_type(manager.status("web")["conditions"])
+    assert conds["Available"]["status"] == "True"
+    assert conds["Progressing"]["status"] == "True"
+    assert conds["LBConfigured"]["status"] == "True"
+    first_seen = conds["Available"]["lastTransitionTime"]
+
+    # Unchanged conditions keep their transition time
+    again = _by_type(manager.status("web")["conditions"])
+    assert again["Available"]["lastTransitionTime"] == first_seen
@@ -0,0 +1,76 @@
+"""Deleting apps whose replicas do not stop, with and without purge."""
+
+import copy
+
+import docker
+
+SPEC = {
+    "apiVersion": "v1",
+    "kind": "App",
+    "metadata": {"name": "web"},
+    "spec": {"type": "http", "image": "nginx:alpine", "ports": [{"containerPort": 80}]},
+    "scaling": {"mode": "manual", "minReplicas": 1, "maxReplicas": 5}
+}
+
+
+def _running_app(manager, replicas=2):
+    manager.register(copy.deepcopy(SPEC))
+    manager.start("web")
+    manager.scale("web", replicas)
+
+
+def _stuck(container, killable=True):
+    """Make a container ignore stop, and removal too, unless forced on a killable one."""
+    remove = container.remove
+
+    def refuse(*args, **kwargs):
+        raise docker.errors.APIError(f"cannot stop container {container.name}: did not receive an exit event")
+
+    def remove_if_killed(force=False, v=False):
+        if not (force and killable):
+            refuse()
+        remove(force=True)
+
+    container.stop = refuse
+    container.remove = remove_if_killed
+
+
+def test_delete_keeps_the_app_while_a_replica_is_stuck(manager, state_store, runtime, lb):
+    _running_app(manager)
+    stuck = runtime.containers.list()[0]
+    _stuck(stuck)
+
+    result = manager.delete("web")
+
+    assert "could not be removed" in result["error"]
+    assert "delete with purge" in result["error"]
+    assert "web" in state_store.apps
+    assert runtime.containers.list() == [stuck]
+    assert [instance.container_id for instance in manager.instances["web"]] == [stuck.id]
+    assert len(lb.servers("web")) == 1
+
+
+def test_purge_kills_stuck_replicas_and_deletes_the_rows(manager, state_store, runtime):
+    _running_app(manager)
+    _stuck(runtime.containers.list()[0])
+
+    result = manager.delete("web", purge=True)
+
+    assert result["status"] == "deleted" and result["purged"] is True
+    assert runtime.containers.list(all=True) == []
+    assert "web" not in state_store.apps
+    assert "web" not in state_store.revisions
+
+
+def test_purge_keeps_the_rows_when_a_kill_fails(manager, state_store, runtime):
+    _running_app(manager)
+    stuck = runtime.containers.list()[0]
+    _stuck(stuck, killable=False)
+
+    result = manager.delete("web", purge=True)
+
+    assert "could not be removed" in result["error"]
+    assert "delete with purge" not in result["error"]
+    assert "web" in state_store.apps
+    assert state_store.revisions["web"]
+    assert [instance.container_id for instance in manager.instances["web"]] == [stuck.id]
@@ -0,0 +1,106 @@
+"""Classifying Docker errors, retrying transient ones and reporting replicas that cannot start."""
+
+import copy
+
+import docker
+import requests
+
+from controller import docker_errors
+
+SPEC = {
+    "apiVersion": "v1",
+    "kind": "App",
+    "metadata": {"name": "web"},
+    "spec": {"type": "http", "image": "nginx:alpine", "ports": [{"containerPort": 80}]},
+    "scaling": {"mode": "manual", "minReplicas": 1, "maxReplicas": 5}
+}
+
+
+def test_classify():
+    assert docker_errors.classify(docker.errors.ImageNotFound("No such image: web:9")) == "image_not_found"
+    assert docker_errors.classify(docker.errors.APIError(
+        "driver failed programming external connectivity: Bind for 0.0.0.0:8080 failed: port is already allocated"
+    )) == "port_conflict"
+    assert docker_errors.classify(docker.errors.APIError("pull access denied for private/web")) == "registry_auth"
+    assert docker_errors.classify(requests.exceptions.ConnectionError("Connection aborted")) == "transient"
+    assert docker_errors.classify(docker.errors.APIError("unexpected EOF")) == "transient"
+    assert docker_errors.classify(docker.errors.APIError("something else")) == "unknown"
+    # A permanent message wins over a transient exception type
+    assert docker_errors.classify(requests.exceptions.ConnectionError("no such image")) == "image_not_found"
+
+
+def test_call_retries_transient_errors_only(monkeypatch):
+    monkeypatch.setattr(docker_errors, "RETRY_BACKOFF_SECONDS", 0)
+    calls = []
+
+    def flaky():
+        calls.append(1)
+        if len(calls) < 3:
+            raise requests.exceptions.ConnectionError("Connection reset by peer")
+        return "started"
+
+    assert docker_errors.call(flaky, "starting web-0") == "started"
+    assert len(calls) == 3
+
+    def missing_image():
+        calls.append(1)
+        raise docker.errors.ImageNotFound("No such image: web:9")
+
+    calls.clear()
+    try:
+        docker_errors.call(missing_image, "starting web-0")
+        assert False, "ImageNotFound was not raised"
+    except docker.errors.ImageNotFound:
+        pass
+    assert len(calls) == 1
+
+
+def test_failed_start_is_reported_and_leaves_no_container(manager, state_store, runtime):
+    runtime.fail_start = {"web-0"}
+    manager.register(copy.deepcopy(SPEC))
+    manager.start("web")
+    manager.start("web")
+
+    assert runtime.containers.list(all=True) == []
+    failure = manager.start_failures["web"]
+    assert failure["reason"] == "unknown"
+    assert "simulated failure" in failure["message"]
+    assert failure["attempts"] == 2
+    # One event per reason, not one per attempt
+    assert [e["type"] for e in state_store.events].count("replica_start_failed") == 1
+
+    runtime.fail_start = set()
+    manager.start("web")
+    assert "web" not in manager.start_failures
+    assert len(runtime.containers.list()) == 1
+
+
+def test_transient_create_is_cleaned_up_and_retried(manager, runtime, monkeypatch):
+    monkeypatch.setattr(docker_errors, "RETRY_BACKOFF_SECONDS", 0)
+    create = runtime.containers.create
+    attempts = []
+
+    def create_then_drop_connection(**config):
+        attempts.append(config["name"])
+        container = create(**config)
+        if len(attempts) == 1:
+            # The daemon made the container, but the response never arrived
+            raise requests.exceptions.ConnectionError("Connection aborted: EOF")
+        return container
+
+    monkeypatch.setattr(runtime.containers, "create", create_then_drop_connection)
+    manager.register(copy.deepcopy(SPEC))
+    manager.start("web")
+
+    assert attempts == ["web-0", "web-0"]
+    assert [c.status for c in runtime.containers.list(all=True)] == ["running"]
+    assert "web" not in manager.start_failures
+
+
+def test_name_conflict_does_not_remove_the_other_container(manager, runtime):
+    foreign = runtime.containers.create("busybox", name="web-0")
+    manager.register(copy.deepcopy(SPEC))
+    manager.start("web")
+
+    assert runtime.containers.list(all=True) == [foreign]
+    assert manager.start_failures["web"]["reason"] == "name_conflict"
@@ -0,0 +1,54 @@
+"""Per-app evaluation cadence: EvaluationSchedule and evaluationIntervalSeconds."""
+
+import pytest
+
+from controller.scaler import EvaluationSchedule, policy_from_scaling, DEFAULT_EVALUATION_INTERVAL_SECONDS
+
+
+def test_new_apps_are_due_right_away():
+    schedule = EvaluationSchedule()
+    schedule.sync(["web", "api"], now=100.0)
+    assert sorted(schedule.pop_due(100.0)) == ["api", "web"]
+    # Popped apps are not due again until rescheduled
+    assert schedule.pop_due(1000.0) == []
+    assert schedule.next_due() is None
+
+
+def test_each_app_keeps_its_own_interval():
+    schedule = EvaluationSchedule()
+    schedule.sync(["web", "batch"], now=0.0)
+    schedule.pop_due(0.0)
+    schedule.reschedule("web", 5, now=0.0)
+    schedule.reschedule("batch", 60, now=0.0)
+
+    assert schedule.next_due() == 5
+    assert schedule.pop_due(4.9) == []
+    assert schedule.pop_due(5.0) == ["web"]
+    schedule.reschedule("web", 5, now=5.0)
+    assert schedule.pop_due(59.0) == ["web"]
+    assert schedule.pop_due(60.0) == ["batch"]
+
+
+def test_rescheduling_replaces_the_old_due_time():
+    schedule = EvaluationSchedule()
+    schedule.reschedule("web", 60, now=0.0)
+    schedule.reschedule("web", 10, now=0.0)
+    assert schedule.snapshot() == {"web": 10}
+    assert schedule.pop_due(10.0) == ["web"]
+    # The entry for the old due time is skipped
+    assert schedule.pop_due(60.0) == []
+
+
+def test_sync_forgets_deleted_apps():
+    schedule = EvaluationSchedule()
+    schedule.sync(["web", "api"], now=0.0)
+    schedule.sync(["web"], now=0.0)
+    assert schedule.pop_due(0.0) == ["web"]
+
+
+def test_interval_comes_from_the_scaling_policy():
+    assert policy_from_scaling({}).evaluation_interval_seconds == DEFAULT_EVALUATION_INTERVAL_SECONDS
+    assert policy_from_scaling({"evaluationIntervalSeconds": 5}).evaluation_interval_seconds == 5
+    assert policy_from_scaling({}, {"evaluationIntervalSeconds": 30}).evaluation_interval_seconds == 30
+    with pytest.raises(ValueError):
+        policy_from_scaling({"evaluationIntervalSeconds": 0})
@@ -0,0 +1,32 @@
+"""
+AppManager against FakeRuntime and FakeLoadBalancer: no Docker daemon, no nginx
+and no database, only the in-memory state store from conftest.py.
+"""
+
+import copy
+
+SPEC = {
+    "apiVersion": "v1",
+    "kind": "App",
+    "metadata": {"name": "web"},
+    "spec": {"type": "http", "image": "nginx:alpine", "ports": [{"containerPort": 80}]},
+    "scaling": {"mode": "manual", "minReplicas": 1, "maxReplicas": 5}
+}
+
+
+def test_register_scale_status(manager, runtime, lb):
+    registered = manager.register(copy.deepcopy(SPEC))
+    assert "error" not in registered, registered
+
+    started = manager.start("web")
+    assert "error" not in started, started
+
+    scaled = manager.scale("web", 2)
+    assert "error" not in scaled, scaled
+    assert len(runtime.containers.list()) == 2
+
+    status = manager.status("web")
+    assert status["status"] == "running"
+    assert status["replicas"] == 2
+    assert status["ready_replicas"] == 2
+    assert len(lb.servers("web")) == 2
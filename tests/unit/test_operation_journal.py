@@ -0,0 +1,60 @@
+"""Recovering operations a previous leader left unfinished in the operation journal."""
+
+import copy
+import time
+
+from controller import operation_journal
+
+SPEC = {
+    "apiVersion": "v1",
+    "kind": "App",
+    "metadata": {"name": "web"},
+    "spec": {"type": "http", "image": "nginx:alpine", "ports": [{"containerPort": 80}]},
+    "scaling": {"mode": "manual", "minReplicas": 1, "maxReplicas": 5}
+}
+
+
+def _interrupted_scale(state_store, to):
+    """The journal entry of a scale whose leader died after starting one replica."""
+    entry = {"id": "crashed01", "app": "web", "operation": "scale", "status": "in_progress",
+             "intent": {"from": 1, "to": to, "automated": False, "grace_period": None},
+             "requested_by": "alice", "started_at": time.time() - 60}
+    state_store.save_journal_entry(entry)
+    state_store.append_journal_step(entry["id"], {"step": "started", "at": time.time() - 59, "container": "gone"})
+    return entry["id"]
+
+
+def test_interrupted_scale_is_replayed_to_its_target(manager, state_store, runtime):
+    manager.register(copy.deepcopy(SPEC))
+    manager.start("web")
+    entry_id = _interrupted_scale(state_store, to=3)
+
+    assert manager.recover_operations() == {"replayed": 1}
+
+    assert len(runtime.containers.list()) == 3
+    entry = state_store.journal[entry_id]
+    assert entry["status"] == "replayed"
+    assert entry["result"]["replicas"] == 3
+    # The replay is journaled like any other scale
+    replays = [e for e in state_store.journal.values() if e["id"] != entry_id]
+    assert [e["status"] for e in replays] == ["completed"]
+    assert [e["type"] for e in state_store.events].count("operation_recovered") == 1
+
+
+def test_scale_of_a_stopped_app_is_abandoned(manager, state_store, runtime):
+    manager.register(copy.deepcopy(SPEC))
+    entry_id = _interrupted_scale(state_store, to=3)
+
+    assert manager.recover_operations() == {"abandoned": 1}
+    assert state_store.journal[entry_id]["status"] == "abandoned"
+    assert runtime.containers.list() == []
+
+
+def test_entries_of_running_operations_are_left_alone(state_store):
+    journal = operation_journal.OperationJournal(state_store)
+    ours = journal.begin("web", "scale", {"from": 1, "to": 2})
+    theirs = _interrupted_scale(state_store, to=2)
+
+    assert [entry["id"] for entry in journal.unfinished()] == [theirs]
+    journal.finish(ours, "completed")
+    assert state_store.journal[ours]["status"] == "completed"